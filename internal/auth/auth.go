@@ -11,6 +11,12 @@ type Authenticator interface {
 	Authenticate(ctx context.Context, username, password string) (*database.User, error)
 }
 
+// DirectoryLookup is implemented by authenticators backed by a user
+// directory, which can tell whether an account still exists without a login.
+type DirectoryLookup interface {
+	UserExists(ctx context.Context, username string) (bool, error)
+}
+
 type contextKey string
 
 const userContextKey contextKey = "user"
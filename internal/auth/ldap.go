@@ -139,7 +139,7 @@ func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password
 	if a.config.RecursiveGroups {
 		memberOf = resolveTransitiveGroups(conn, memberOf, a.config.GroupPrefix, a.logger)
 	}
-	a.logger.Debug("LDAP user groups", "username", username, "memberOf", memberOf)
+	a.logger.DebugContext(ctx, "LDAP user groups", "username", username, "memberOf", memberOf)
 
 	// Bind as the user to verify password
 	if err := conn.Bind(userDN, password); err != nil {
@@ -147,10 +147,10 @@ func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password
 	}
 	role, allowed := MapGroupToRole(memberOf, a.config.AdminGroup, a.config.EditorGroup, a.config.ViewerGroup)
 	if !allowed {
-		a.logger.Debug("LDAP user not in any allowed group", "username", username, "admin_group", a.config.AdminGroup, "editor_group", a.config.EditorGroup, "viewer_group", a.config.ViewerGroup)
+		a.logger.DebugContext(ctx, "LDAP user not in any allowed group", "username", username, "admin_group", a.config.AdminGroup, "editor_group", a.config.EditorGroup, "viewer_group", a.config.ViewerGroup)
 		return nil, fmt.Errorf("user not in any allowed group")
 	}
-	a.logger.Debug("LDAP role resolved", "username", username, "role", role)
+	a.logger.DebugContext(ctx, "LDAP role resolved", "username", username, "role", role)
 
 	email := entry.GetAttributeValue("mail")
 
@@ -160,21 +160,140 @@ func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password
 		return nil, fmt.Errorf("provisioning user: %w", err)
 	}
 
+	a.syncAccess(ctx, user, memberOf)
+	return user, nil
+}
+
+// syncAccess syncs the project and global access of a user with their
+// group membership.
+func (a *LDAPAuthenticator) syncAccess(ctx context.Context, user *database.User, memberOf []string) {
 	// Sync project access based on group mappings
 	if a.access != nil && a.groupMappings != nil {
 		if err := a.syncProjectAccess(ctx, user, memberOf); err != nil {
-			a.logger.Warn("syncing LDAP project access", "username", username, "error", err)
+			a.logger.WarnContext(ctx, "syncing LDAP project access", "username", user.Username, "error", err)
 		}
 	}
 
 	// Sync global access based on group membership
 	if a.globalAccess != nil {
 		if err := a.syncGlobalAccess(ctx, user, memberOf); err != nil {
-			a.logger.Warn("syncing LDAP global access", "username", username, "error", err)
+			a.logger.WarnContext(ctx, "syncing LDAP global access", "username", user.Username, "error", err)
 		}
 	}
+}
 
-	return user, nil
+// SyncUsers re-resolves the group membership of every LDAP user with the
+// service account and syncs their access, so that users removed from a
+// group lose its access without logging in again. Users no longer in the
+// directory, or in none of the allowed groups, lose all group access. It
+// returns how many users were synced; a failing search stops the sync
+// rather than revoking access.
+func (a *LDAPAuthenticator) SyncUsers(ctx context.Context) (int, error) {
+	users, err := a.users.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("listing users: %w", err)
+	}
+	var ldapUsers []database.User
+	for _, u := range users {
+		if u.AuthSource == "ldap" {
+			ldapUsers = append(ldapUsers, u)
+		}
+	}
+	if len(ldapUsers) == 0 {
+		return 0, nil
+	}
+
+	conn, err := a.dialer.DialURL(a.config.URL)
+	if err != nil {
+		return 0, fmt.Errorf("connecting to LDAP: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+		return 0, fmt.Errorf("service account bind failed: %w", err)
+	}
+
+	synced := 0
+	for i := range ldapUsers {
+		if err := ctx.Err(); err != nil {
+			return synced, err
+		}
+		user := &ldapUsers[i]
+
+		filter, err := RenderUserFilter(a.config.UserFilter, user.Username)
+		if err != nil {
+			return synced, fmt.Errorf("rendering user filter: %w", err)
+		}
+		searchReq := ldap.NewSearchRequest(
+			a.config.BaseDN,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			1, // size limit
+			0, // time limit
+			false,
+			filter,
+			[]string{"dn", "memberOf"},
+			nil,
+		)
+		result, err := conn.Search(searchReq)
+		if err != nil {
+			return synced, fmt.Errorf("LDAP search for %s failed: %w", user.Username, err)
+		}
+
+		var memberOf []string
+		if len(result.Entries) == 0 {
+			a.logger.InfoContext(ctx, "LDAP user no longer in directory, revoking group access", "username", user.Username)
+		} else {
+			memberOf = result.Entries[0].GetAttributeValues("memberOf")
+			if a.config.RecursiveGroups {
+				memberOf = resolveTransitiveGroups(conn, memberOf, a.config.GroupPrefix, a.logger)
+			}
+			if _, allowed := MapGroupToRole(memberOf, a.config.AdminGroup, a.config.EditorGroup, a.config.ViewerGroup); !allowed {
+				a.logger.InfoContext(ctx, "LDAP user in no allowed group, revoking group access", "username", user.Username)
+				memberOf = nil
+			}
+		}
+
+		a.syncAccess(ctx, user, memberOf)
+		synced++
+	}
+	return synced, nil
+}
+
+// UserExists reports whether the user filter matches an entry in the
+// directory, using the service account.
+func (a *LDAPAuthenticator) UserExists(ctx context.Context, username string) (bool, error) {
+	conn, err := a.dialer.DialURL(a.config.URL)
+	if err != nil {
+		return false, fmt.Errorf("connecting to LDAP: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+		return false, fmt.Errorf("service account bind failed: %w", err)
+	}
+
+	filter, err := RenderUserFilter(a.config.UserFilter, username)
+	if err != nil {
+		return false, fmt.Errorf("rendering user filter: %w", err)
+	}
+
+	searchReq := ldap.NewSearchRequest(
+		a.config.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		1, // size limit
+		0, // time limit
+		false,
+		filter,
+		[]string{"dn"},
+		nil,
+	)
+	result, err := conn.Search(searchReq)
+	if err != nil {
+		return false, fmt.Errorf("LDAP search failed: %w", err)
+	}
+	return len(result.Entries) > 0, nil
 }
 
 // provisionUser creates or updates a user record for an LDAP-authenticated user.
@@ -185,7 +304,7 @@ func (a *LDAPAuthenticator) provisionUser(ctx context.Context, username, email,
 		if existing.Email != email {
 			existing.Email = email
 			if err := a.users.Update(ctx, existing); err != nil {
-				a.logger.Warn("updating LDAP user", "username", username, "error", err)
+				a.logger.WarnContext(ctx, "updating LDAP user", "username", username, "error", err)
 			}
 		}
 		return existing, nil
@@ -202,7 +321,7 @@ func (a *LDAPAuthenticator) provisionUser(ctx context.Context, username, email,
 		return nil, fmt.Errorf("creating LDAP user: %w", err)
 	}
 
-	a.logger.Info("auto-provisioned LDAP user", "username", username, "role", role)
+	a.logger.InfoContext(ctx, "auto-provisioned LDAP user", "username", username, "role", role)
 	return user, nil
 }
 
@@ -216,11 +335,11 @@ func (a *LDAPAuthenticator) syncProjectAccess(ctx context.Context, user *databas
 	}
 
 	if len(mappings) == 0 {
-		a.logger.Debug("no LDAP group mappings configured, skipping project access sync", "username", user.Username)
+		a.logger.DebugContext(ctx, "no LDAP group mappings configured, skipping project access sync", "username", user.Username)
 		return nil
 	}
 
-	a.logger.Debug("syncing LDAP project access", "username", user.Username, "mappings_count", len(mappings), "user_groups", memberOf)
+	a.logger.DebugContext(ctx, "syncing LDAP project access", "username", user.Username, "mappings_count", len(mappings), "user_groups", memberOf)
 
 	// Build a set of user's groups for fast lookup (case-insensitive)
 	userGroups := make(map[string]bool)
@@ -233,10 +352,10 @@ func (a *LDAPAuthenticator) syncProjectAccess(ctx context.Context, user *databas
 
 	for _, mapping := range mappings {
 		matched := userGroups[strings.ToLower(mapping.GroupIdentifier)]
-		a.logger.Debug("LDAP group mapping check", "username", user.Username, "group", mapping.GroupIdentifier, "project_id", mapping.ProjectID, "role", mapping.Role, "matched", matched)
+		a.logger.DebugContext(ctx, "LDAP group mapping check", "username", user.Username, "group", mapping.GroupIdentifier, "project_id", mapping.ProjectID, "role", mapping.Role, "matched", matched)
 		if matched {
 			currentRole := grantedProjects[mapping.ProjectID]
-			if roleHigher(mapping.Role, currentRole) {
+			if RoleHigher(mapping.Role, currentRole) {
 				grantedProjects[mapping.ProjectID] = mapping.Role
 			}
 		}
@@ -256,7 +375,7 @@ func (a *LDAPAuthenticator) syncProjectAccess(ctx context.Context, user *databas
 	// Grant new or update existing access
 	for projectID, role := range grantedProjects {
 		if existingRole, exists := existingProjects[projectID]; !exists || existingRole != role {
-			a.logger.Debug("granting LDAP project access", "username", user.Username, "project_id", projectID, "role", role)
+			a.logger.DebugContext(ctx, "granting LDAP project access", "username", user.Username, "project_id", projectID, "role", role)
 			access := &database.ProjectAccess{
 				ProjectID: projectID,
 				UserID:    user.ID,
@@ -264,7 +383,7 @@ func (a *LDAPAuthenticator) syncProjectAccess(ctx context.Context, user *databas
 				Source:    "ldap",
 			}
 			if err := a.access.Grant(ctx, access); err != nil {
-				a.logger.Warn("granting LDAP project access", "project_id", projectID, "error", err)
+				a.logger.WarnContext(ctx, "granting LDAP project access", "project_id", projectID, "error", err)
 			}
 		}
 	}
@@ -272,14 +391,14 @@ func (a *LDAPAuthenticator) syncProjectAccess(ctx context.Context, user *databas
 	// Revoke access for projects no longer granted by LDAP
 	for projectID := range existingProjects {
 		if _, shouldHave := grantedProjects[projectID]; !shouldHave {
-			a.logger.Debug("revoking LDAP project access", "username", user.Username, "project_id", projectID)
+			a.logger.DebugContext(ctx, "revoking LDAP project access", "username", user.Username, "project_id", projectID)
 			if err := a.access.RevokeBySource(ctx, projectID, user.ID, "ldap"); err != nil {
-				a.logger.Warn("revoking LDAP project access", "project_id", projectID, "error", err)
+				a.logger.WarnContext(ctx, "revoking LDAP project access", "project_id", projectID, "error", err)
 			}
 		}
 	}
 
-	a.logger.Debug("LDAP project access sync complete", "username", user.Username, "granted_projects", len(grantedProjects))
+	a.logger.DebugContext(ctx, "LDAP project access sync complete", "username", user.Username, "granted_projects", len(grantedProjects))
 	return nil
 }
 
@@ -291,7 +410,7 @@ func (a *LDAPAuthenticator) syncGlobalAccess(ctx context.Context, user *database
 		return fmt.Errorf("listing global access rules: %w", err)
 	}
 
-	a.logger.Debug("syncing LDAP global access", "username", user.Username, "rules_count", len(rules), "user_groups", memberOf)
+	a.logger.DebugContext(ctx, "syncing LDAP global access", "username", user.Username, "rules_count", len(rules), "user_groups", memberOf)
 
 	// Build a set of user's groups for fast lookup (case-insensitive)
 	userGroups := make(map[string]bool)
@@ -306,16 +425,16 @@ func (a *LDAPAuthenticator) syncGlobalAccess(ctx context.Context, user *database
 			continue
 		}
 		matched := userGroups[strings.ToLower(rule.SubjectIdentifier)]
-		a.logger.Debug("global access rule check", "username", user.Username, "rule_subject", rule.SubjectIdentifier, "rule_role", rule.Role, "matched", matched)
+		a.logger.DebugContext(ctx, "global access rule check", "username", user.Username, "rule_subject", rule.SubjectIdentifier, "rule_role", rule.Role, "matched", matched)
 		if matched {
-			if roleHigher(rule.Role, bestRole) {
+			if RoleHigher(rule.Role, bestRole) {
 				bestRole = rule.Role
 			}
 		}
 	}
 
 	if bestRole != "" {
-		a.logger.Debug("granting global access", "username", user.Username, "role", bestRole, "source", "ldap")
+		a.logger.DebugContext(ctx, "granting global access", "username", user.Username, "role", bestRole, "source", "ldap")
 		grant := &database.GlobalAccessGrant{
 			UserID: user.ID,
 			Role:   bestRole,
@@ -325,7 +444,7 @@ func (a *LDAPAuthenticator) syncGlobalAccess(ctx context.Context, user *database
 			return fmt.Errorf("upserting global access grant: %w", err)
 		}
 	} else {
-		a.logger.Debug("no matching global access rules, removing LDAP grants", "username", user.Username)
+		a.logger.DebugContext(ctx, "no matching global access rules, removing LDAP grants", "username", user.Username)
 		if err := a.globalAccess.DeleteGrantsBySource(ctx, user.ID, "ldap"); err != nil {
 			return fmt.Errorf("deleting global access grants: %w", err)
 		}
@@ -334,8 +453,8 @@ func (a *LDAPAuthenticator) syncGlobalAccess(ctx context.Context, user *database
 	return nil
 }
 
-// roleHigher returns true if role a is higher priority than role b
-func roleHigher(a, b string) bool {
+// RoleHigher returns true if role a is higher priority than role b
+func RoleHigher(a, b string) bool {
 	priority := map[string]int{"admin": 3, "editor": 2, "viewer": 1, "": 0}
 	return priority[a] > priority[b]
 }
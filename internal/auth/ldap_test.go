@@ -477,6 +477,41 @@ func TestLDAPAuthenticateUserNotFound(t *testing.T) {
 	}
 }
 
+func TestLDAPUserExists(t *testing.T) {
+	userStore, _, _, _ := setupLDAPTest(t)
+
+	cfg := config.LDAPConfig{
+		URL:          "ldap://localhost:389",
+		BindDN:       "cn=admin,dc=example,dc=com",
+		BindPassword: "adminpass",
+		BaseDN:       "dc=example,dc=com",
+		UserFilter:   "(uid={{.Username}})",
+	}
+
+	mockConn := &mockLDAPConn{
+		searchFunc: func(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+			if req.Filter == "(uid=alice)" {
+				return &ldap.SearchResult{Entries: []*ldap.Entry{createTestEntry("uid=alice,dc=example,dc=com", "alice", "", nil)}}, nil
+			}
+			return &ldap.SearchResult{}, nil
+		},
+	}
+	auth := NewLDAPAuthenticatorWithDialer(cfg, userStore, testLogger(), &mockLDAPDialer{conn: mockConn})
+
+	ctx := context.Background()
+	if exists, err := auth.UserExists(ctx, "alice"); err != nil || !exists {
+		t.Errorf("expected alice to exist, got %v, %v", exists, err)
+	}
+	if exists, err := auth.UserExists(ctx, "bob"); err != nil || exists {
+		t.Errorf("expected bob to be missing, got %v, %v", exists, err)
+	}
+
+	failing := NewLDAPAuthenticatorWithDialer(cfg, userStore, testLogger(), &mockLDAPDialer{dialErr: errors.New("connection refused")})
+	if _, err := failing.UserExists(ctx, "alice"); err == nil {
+		t.Error("expected an error when the directory is unreachable")
+	}
+}
+
 func TestLDAPAuthenticateInvalidUserPassword(t *testing.T) {
 	userStore, _, _, _ := setupLDAPTest(t)
 
@@ -937,6 +972,90 @@ func TestLDAPProjectAccessSyncRevokesRemovedGroups(t *testing.T) {
 	}
 }
 
+func TestLDAPSyncUsers(t *testing.T) {
+	userStore, accessStore, mappingStore, projectStore := setupLDAPTest(t)
+	ctx := context.Background()
+
+	project := &database.Project{Slug: "sync-test", Name: "Sync Test", Visibility: database.VisibilityCustom}
+	projectStore.Create(ctx, project)
+	devGroup := "cn=developers,ou=groups,dc=example,dc=com"
+	mappingStore.Create(ctx, &database.AuthGroupMapping{
+		AuthSource:      "ldap",
+		GroupIdentifier: devGroup,
+		ProjectID:       project.ID,
+		Role:            "editor",
+	})
+
+	// dev joined the group, ex-dev left it and gone left the directory,
+	// all without logging in again
+	users := map[string]*database.User{}
+	for _, name := range []string{"dev", "ex-dev", "gone"} {
+		user := &database.User{Username: name, AuthSource: "ldap", Role: "viewer"}
+		userStore.Create(ctx, user)
+		users[name] = user
+	}
+	for _, name := range []string{"ex-dev", "gone"} {
+		accessStore.Grant(ctx, &database.ProjectAccess{ProjectID: project.ID, UserID: users[name].ID, Role: "editor", Source: "ldap"})
+	}
+	builtin := &database.User{Username: "local", AuthSource: "builtin", Role: "viewer"}
+	userStore.Create(ctx, builtin)
+
+	cfg := config.LDAPConfig{
+		URL:          "ldap://localhost:389",
+		BindDN:       "cn=admin,dc=example,dc=com",
+		BindPassword: "adminpass",
+		BaseDN:       "dc=example,dc=com",
+		UserFilter:   "(uid={{.Username}})",
+	}
+	var searched []string
+	var searchErr error
+	mockConn := &mockLDAPConn{
+		searchFunc: func(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+			searched = append(searched, req.Filter)
+			if searchErr != nil {
+				return nil, searchErr
+			}
+			switch req.Filter {
+			case "(uid=dev)":
+				return &ldap.SearchResult{Entries: []*ldap.Entry{createTestEntry("uid=dev,ou=users,dc=example,dc=com", "dev", "", []string{devGroup})}}, nil
+			case "(uid=ex-dev)":
+				return &ldap.SearchResult{Entries: []*ldap.Entry{createTestEntry("uid=ex-dev,ou=users,dc=example,dc=com", "ex-dev", "", nil)}}, nil
+			}
+			return &ldap.SearchResult{}, nil
+		},
+	}
+	auth := NewLDAPAuthenticatorWithDialer(cfg, userStore, testLogger(), &mockLDAPDialer{conn: mockConn})
+	auth.SetStores(accessStore, mappingStore, nil)
+
+	synced, err := auth.SyncUsers(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if synced != 3 || len(searched) != 3 {
+		t.Errorf("expected the 3 LDAP users to be synced, got %d with searches %v", synced, searched)
+	}
+	if access, _ := accessStore.GetAccess(ctx, project.ID, users["dev"].ID); access == nil || access.Role != "editor" {
+		t.Errorf("expected dev to get editor access, got %+v", access)
+	}
+	for _, name := range []string{"ex-dev", "gone"} {
+		if access, _ := accessStore.GetAccess(ctx, project.ID, users[name].ID); access != nil {
+			t.Errorf("expected the access of %s to be revoked", name)
+		}
+	}
+	if !mockConn.closed {
+		t.Error("expected connection to be closed")
+	}
+
+	// A failing directory must not revoke access
+	searchErr = errors.New("server busy")
+	if _, err := auth.SyncUsers(ctx); err == nil {
+		t.Error("expected the search error to be returned")
+	}
+	if access, _ := accessStore.GetAccess(ctx, project.ID, users["dev"].ID); access == nil {
+		t.Error("expected access to be kept when the search fails")
+	}
+}
+
 func TestLDAPSearchFailed(t *testing.T) {
 	userStore, _, _, _ := setupLDAPTest(t)
 
@@ -1241,9 +1360,9 @@ func TestRoleHigher(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got := roleHigher(tt.a, tt.b)
+		got := RoleHigher(tt.a, tt.b)
 		if got != tt.expected {
-			t.Errorf("roleHigher(%q, %q) = %v, expected %v", tt.a, tt.b, got, tt.expected)
+			t.Errorf("RoleHigher(%q, %q) = %v, expected %v", tt.a, tt.b, got, tt.expected)
 		}
 	}
 }
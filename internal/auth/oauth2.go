@@ -114,6 +114,18 @@ func (a *OAuth2Authenticator) HandleCallback(ctx context.Context, code string) (
 	if err != nil {
 		return nil, fmt.Errorf("fetching user info: %w", err)
 	}
+	if a.cfg.GroupsURL != "" {
+		// Failing here rather than logging in without the groups, which
+		// would revoke their access
+		more, err := fetchGroups(client, a.cfg.GroupsURL)
+		if err != nil {
+			return nil, fmt.Errorf("fetching groups: %w", err)
+		}
+		groups = append(groups, more...)
+	}
+	if a.cfg.RecursiveGroups {
+		groups = flattenGroupPaths(groups)
+	}
 
 	if userInfo.Username == "" && userInfo.Email == "" {
 		return nil, fmt.Errorf("no username or email in user info response")
@@ -127,13 +139,13 @@ func (a *OAuth2Authenticator) HandleCallback(ctx context.Context, code string) (
 	}
 
 	// Determine role from group membership (if configured)
-	a.logger.Debug("OAuth2 user groups", "username", username, "groups", groups)
+	a.logger.DebugContext(ctx, "OAuth2 user groups", "username", username, "groups", groups)
 	role, allowed := a.mapGroupsToRole(groups)
 	if !allowed {
-		a.logger.Debug("OAuth2 user not in any allowed group", "username", username, "admin_group", a.cfg.AdminGroup, "editor_group", a.cfg.EditorGroup, "viewer_group", a.cfg.ViewerGroup)
+		a.logger.DebugContext(ctx, "OAuth2 user not in any allowed group", "username", username, "admin_group", a.cfg.AdminGroup, "editor_group", a.cfg.EditorGroup, "viewer_group", a.cfg.ViewerGroup)
 		return nil, fmt.Errorf("user not in any allowed group")
 	}
-	a.logger.Debug("OAuth2 role resolved", "username", username, "role", role)
+	a.logger.DebugContext(ctx, "OAuth2 role resolved", "username", username, "role", role)
 
 	// Auto-provision or update user
 	user, err := a.provisionUser(ctx, username, userInfo.Email, role)
@@ -141,17 +153,22 @@ func (a *OAuth2Authenticator) HandleCallback(ctx context.Context, code string) (
 		return nil, fmt.Errorf("provisioning user: %w", err)
 	}
 
+	// Only groups with the prefix grant project and global access
+	if a.cfg.GroupPrefix != "" {
+		groups = filterGroupPrefix(groups, a.cfg.GroupPrefix)
+	}
+
 	// Sync project access based on group mappings
 	if a.access != nil && a.groupMappings != nil {
 		if err := a.syncProjectAccess(ctx, user, groups); err != nil {
-			a.logger.Warn("syncing OAuth2 project access", "username", username, "error", err)
+			a.logger.WarnContext(ctx, "syncing OAuth2 project access", "username", username, "error", err)
 		}
 	}
 
 	// Sync global access based on group membership
 	if a.globalAccess != nil {
 		if err := a.syncGlobalAccess(ctx, user, groups); err != nil {
-			a.logger.Warn("syncing OAuth2 global access", "username", username, "error", err)
+			a.logger.WarnContext(ctx, "syncing OAuth2 global access", "username", username, "error", err)
 		}
 	}
 
@@ -243,6 +260,91 @@ func extractGroups(rawInfo map[string]any, claimName string) []string {
 	return groups
 }
 
+// fetchGroups reads the user's groups from a groups endpoint. It accepts a
+// list of group names or paths, or of objects with a path or name, like the
+// Keycloak account API returns, either alone or in a "groups" field.
+func fetchGroups(client *http.Client, url string) ([]string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("requesting groups: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("groups endpoint returned %d", resp.StatusCode)
+	}
+
+	var raw any
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("decoding groups: %w", err)
+	}
+	if m, ok := raw.(map[string]any); ok {
+		raw = m["groups"]
+	}
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("groups endpoint returned no list of groups")
+	}
+
+	var groups []string
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			groups = append(groups, v)
+		case map[string]any:
+			if path := getStringField(v, "path"); path != "" {
+				groups = append(groups, path)
+			} else if name := getStringField(v, "name"); name != "" {
+				groups = append(groups, name)
+			}
+		}
+	}
+	return groups, nil
+}
+
+// flattenGroupPaths adds the parents of groups given as paths, as Keycloak
+// sends them: a member of /engineering/docs is also a member of
+// /engineering. Both paths and the names engineering and docs are returned,
+// so that mappings can use either.
+func flattenGroupPaths(groups []string) []string {
+	seen := make(map[string]bool)
+	var flat []string
+	add := func(g string) {
+		if g != "" && !seen[strings.ToLower(g)] {
+			seen[strings.ToLower(g)] = true
+			flat = append(flat, g)
+		}
+	}
+	for _, g := range groups {
+		add(g)
+		if !strings.HasPrefix(g, "/") {
+			continue
+		}
+		segments := strings.Split(strings.Trim(g, "/"), "/")
+		for i := len(segments); i > 0; i-- {
+			add("/" + strings.Join(segments[:i], "/"))
+		}
+		for _, name := range segments {
+			add(name)
+		}
+	}
+	return flat
+}
+
+// filterGroupPrefix keeps the groups whose path or name starts with the
+// prefix, ignoring case.
+func filterGroupPrefix(groups []string, prefix string) []string {
+	prefix = strings.ToLower(prefix)
+	var kept []string
+	for _, g := range groups {
+		name := g[strings.LastIndex(g, "/")+1:]
+		if strings.HasPrefix(strings.ToLower(g), prefix) || strings.HasPrefix(strings.ToLower(name), prefix) {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
 // mapGroupsToRole determines a user's role based on OAuth2 group membership.
 // Returns the role and whether the user is allowed.
 func (a *OAuth2Authenticator) mapGroupsToRole(groups []string) (string, bool) {
@@ -286,7 +388,7 @@ func (a *OAuth2Authenticator) provisionUser(ctx context.Context, username, email
 		if existing.Email != email && email != "" {
 			existing.Email = email
 			if err := a.users.Update(ctx, existing); err != nil {
-				a.logger.Warn("updating OAuth2 user", "username", username, "error", err)
+				a.logger.WarnContext(ctx, "updating OAuth2 user", "username", username, "error", err)
 			}
 		}
 		return existing, nil
@@ -303,7 +405,7 @@ func (a *OAuth2Authenticator) provisionUser(ctx context.Context, username, email
 		return nil, fmt.Errorf("creating OAuth2 user: %w", err)
 	}
 
-	a.logger.Info("auto-provisioned OAuth2 user", "username", username, "role", role)
+	a.logger.InfoContext(ctx, "auto-provisioned OAuth2 user", "username", username, "role", role)
 	return user, nil
 }
 
@@ -316,11 +418,11 @@ func (a *OAuth2Authenticator) syncProjectAccess(ctx context.Context, user *datab
 	}
 
 	if len(mappings) == 0 {
-		a.logger.Debug("no OAuth2 group mappings configured, skipping project access sync", "username", user.Username)
+		a.logger.DebugContext(ctx, "no OAuth2 group mappings configured, skipping project access sync", "username", user.Username)
 		return nil
 	}
 
-	a.logger.Debug("syncing OAuth2 project access", "username", user.Username, "mappings_count", len(mappings), "user_groups", groups)
+	a.logger.DebugContext(ctx, "syncing OAuth2 project access", "username", user.Username, "mappings_count", len(mappings), "user_groups", groups)
 
 	// Build a set of user's groups for fast lookup (case-insensitive)
 	userGroups := make(map[string]bool)
@@ -333,10 +435,10 @@ func (a *OAuth2Authenticator) syncProjectAccess(ctx context.Context, user *datab
 
 	for _, mapping := range mappings {
 		matched := userGroups[strings.ToLower(mapping.GroupIdentifier)]
-		a.logger.Debug("OAuth2 group mapping check", "username", user.Username, "group", mapping.GroupIdentifier, "project_id", mapping.ProjectID, "role", mapping.Role, "matched", matched)
+		a.logger.DebugContext(ctx, "OAuth2 group mapping check", "username", user.Username, "group", mapping.GroupIdentifier, "project_id", mapping.ProjectID, "role", mapping.Role, "matched", matched)
 		if matched {
 			currentRole := grantedProjects[mapping.ProjectID]
-			if roleHigher(mapping.Role, currentRole) {
+			if RoleHigher(mapping.Role, currentRole) {
 				grantedProjects[mapping.ProjectID] = mapping.Role
 			}
 		}
@@ -356,7 +458,7 @@ func (a *OAuth2Authenticator) syncProjectAccess(ctx context.Context, user *datab
 	// Grant new or update existing access
 	for projectID, role := range grantedProjects {
 		if existingRole, exists := existingProjects[projectID]; !exists || existingRole != role {
-			a.logger.Debug("granting OAuth2 project access", "username", user.Username, "project_id", projectID, "role", role)
+			a.logger.DebugContext(ctx, "granting OAuth2 project access", "username", user.Username, "project_id", projectID, "role", role)
 			access := &database.ProjectAccess{
 				ProjectID: projectID,
 				UserID:    user.ID,
@@ -364,7 +466,7 @@ func (a *OAuth2Authenticator) syncProjectAccess(ctx context.Context, user *datab
 				Source:    "oauth2",
 			}
 			if err := a.access.Grant(ctx, access); err != nil {
-				a.logger.Warn("granting OAuth2 project access", "project_id", projectID, "error", err)
+				a.logger.WarnContext(ctx, "granting OAuth2 project access", "project_id", projectID, "error", err)
 			}
 		}
 	}
@@ -372,14 +474,14 @@ func (a *OAuth2Authenticator) syncProjectAccess(ctx context.Context, user *datab
 	// Revoke access for projects no longer granted by OAuth2
 	for projectID := range existingProjects {
 		if _, shouldHave := grantedProjects[projectID]; !shouldHave {
-			a.logger.Debug("revoking OAuth2 project access", "username", user.Username, "project_id", projectID)
+			a.logger.DebugContext(ctx, "revoking OAuth2 project access", "username", user.Username, "project_id", projectID)
 			if err := a.access.RevokeBySource(ctx, projectID, user.ID, "oauth2"); err != nil {
-				a.logger.Warn("revoking OAuth2 project access", "project_id", projectID, "error", err)
+				a.logger.WarnContext(ctx, "revoking OAuth2 project access", "project_id", projectID, "error", err)
 			}
 		}
 	}
 
-	a.logger.Debug("OAuth2 project access sync complete", "username", user.Username, "granted_projects", len(grantedProjects))
+	a.logger.DebugContext(ctx, "OAuth2 project access sync complete", "username", user.Username, "granted_projects", len(grantedProjects))
 	return nil
 }
 
@@ -391,7 +493,7 @@ func (a *OAuth2Authenticator) syncGlobalAccess(ctx context.Context, user *databa
 		return fmt.Errorf("listing global access rules: %w", err)
 	}
 
-	a.logger.Debug("syncing OAuth2 global access", "username", user.Username, "rules_count", len(rules), "user_groups", groups)
+	a.logger.DebugContext(ctx, "syncing OAuth2 global access", "username", user.Username, "rules_count", len(rules), "user_groups", groups)
 
 	// Build a set of user's groups for fast lookup (case-insensitive)
 	userGroups := make(map[string]bool)
@@ -406,16 +508,16 @@ func (a *OAuth2Authenticator) syncGlobalAccess(ctx context.Context, user *databa
 			continue
 		}
 		matched := userGroups[strings.ToLower(rule.SubjectIdentifier)]
-		a.logger.Debug("global access rule check", "username", user.Username, "rule_subject", rule.SubjectIdentifier, "rule_role", rule.Role, "matched", matched)
+		a.logger.DebugContext(ctx, "global access rule check", "username", user.Username, "rule_subject", rule.SubjectIdentifier, "rule_role", rule.Role, "matched", matched)
 		if matched {
-			if roleHigher(rule.Role, bestRole) {
+			if RoleHigher(rule.Role, bestRole) {
 				bestRole = rule.Role
 			}
 		}
 	}
 
 	if bestRole != "" {
-		a.logger.Debug("granting global access", "username", user.Username, "role", bestRole, "source", "oauth2")
+		a.logger.DebugContext(ctx, "granting global access", "username", user.Username, "role", bestRole, "source", "oauth2")
 		grant := &database.GlobalAccessGrant{
 			UserID: user.ID,
 			Role:   bestRole,
@@ -425,7 +527,7 @@ func (a *OAuth2Authenticator) syncGlobalAccess(ctx context.Context, user *databa
 			return fmt.Errorf("upserting global access grant: %w", err)
 		}
 	} else {
-		a.logger.Debug("no matching global access rules, removing OAuth2 grants", "username", user.Username)
+		a.logger.DebugContext(ctx, "no matching global access rules, removing OAuth2 grants", "username", user.Username)
 		if err := a.globalAccess.DeleteGrantsBySource(ctx, user.ID, "oauth2"); err != nil {
 			return fmt.Errorf("deleting global access grants: %w", err)
 		}
@@ -462,5 +564,8 @@ func ValidateOAuth2Config(cfg config.OAuth2Config) error {
 	if cfg.RedirectURL == "" {
 		return fmt.Errorf("OAuth2 redirect URL is required")
 	}
+	if cfg.GroupsURL != "" && !strings.HasPrefix(cfg.GroupsURL, "https://") && !strings.HasPrefix(cfg.GroupsURL, "http://") {
+		return fmt.Errorf("OAuth2 groups URL must be an http or https URL")
+	}
 	return nil
 }
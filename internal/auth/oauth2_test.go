@@ -432,6 +432,24 @@ func TestExtractGroups(t *testing.T) {
 	}
 }
 
+func TestFlattenGroupPaths(t *testing.T) {
+	got := flattenGroupPaths([]string{"/engineering/docs/writers", "plain", "/Engineering"})
+	expected := []string{"/engineering/docs/writers", "/engineering/docs", "/engineering", "engineering", "docs", "writers", "plain"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestFilterGroupPrefix(t *testing.T) {
+	groups := []string{"/docs/team-a", "/docs", "team-b", "Team-C", "everyone", "/other/x"}
+	if got := filterGroupPrefix(groups, "team-"); strings.Join(got, ",") != "/docs/team-a,team-b,Team-C" {
+		t.Errorf("expected groups named team-*, got %v", got)
+	}
+	if got := filterGroupPrefix(groups, "/docs"); strings.Join(got, ",") != "/docs/team-a,/docs" {
+		t.Errorf("expected groups under /docs, got %v", got)
+	}
+}
+
 func TestMapGroupsToRole(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -549,6 +567,7 @@ func TestValidateOAuth2Config(t *testing.T) {
 		{"TokenURL", func(c config.OAuth2Config) config.OAuth2Config { c.TokenURL = ""; return c }},
 		{"UserInfoURL", func(c config.OAuth2Config) config.OAuth2Config { c.UserInfoURL = ""; return c }},
 		{"RedirectURL", func(c config.OAuth2Config) config.OAuth2Config { c.RedirectURL = ""; return c }},
+		{"GroupsURL", func(c config.OAuth2Config) config.OAuth2Config { c.GroupsURL = "ftp://groups"; return c }},
 	}
 
 	for _, f := range fields {
@@ -1162,3 +1181,98 @@ func TestOAuth2StateNotConsumedOnError(t *testing.T) {
 		t.Error("state should still be valid after failed callback")
 	}
 }
+
+func TestOAuth2HandleCallbackGroupsEndpoint(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "mock-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	userInfoServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"preferred_username": "nested-user",
+			"groups":             []string{"docs-editors"},
+		})
+	}))
+	defer userInfoServer.Close()
+
+	groupsFail := false
+	groupsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer mock-token" {
+			t.Errorf("expected the user's access token, got %q", r.Header.Get("Authorization"))
+		}
+		if groupsFail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// Keycloak account API format
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]map[string]any{
+			{"id": "1", "name": "writers", "path": "/docs-org/writers"},
+			{"id": "2", "name": "sales", "path": "/sales"},
+		})
+	}))
+	defer groupsServer.Close()
+
+	db := testutil.NewTestDB(t)
+	userStore := sqlstore.NewUserStore(db)
+	projectStore := sqlstore.NewProjectStore(db)
+	accessStore := sqlstore.NewProjectAccessStore(db)
+	groupMappingStore := sqlstore.NewAuthGroupMappingStore(db)
+	ctx := context.Background()
+
+	handbook := &database.Project{Slug: "handbook", Name: "Handbook", Visibility: database.VisibilityCustom}
+	pricing := &database.Project{Slug: "pricing", Name: "Pricing", Visibility: database.VisibilityCustom}
+	projectStore.Create(ctx, handbook)
+	projectStore.Create(ctx, pricing)
+	// The parent group of the user's group grants access
+	groupMappingStore.Create(ctx, &database.AuthGroupMapping{AuthSource: "oauth2", GroupIdentifier: "/docs-org", ProjectID: handbook.ID, Role: "editor"})
+	// Left out by the group prefix
+	groupMappingStore.Create(ctx, &database.AuthGroupMapping{AuthSource: "oauth2", GroupIdentifier: "/sales", ProjectID: pricing.ID, Role: "viewer"})
+
+	auth := NewOAuth2Authenticator(config.OAuth2Config{
+		GroupsClaim:     "groups",
+		GroupsURL:       groupsServer.URL,
+		RecursiveGroups: true,
+		GroupPrefix:     "docs-",
+		EditorGroup:     "sales",
+	}, userStore, testutil.TestLogger())
+	auth.SetStores(accessStore, groupMappingStore, nil)
+	auth.oauthConfig = &oauth2.Config{
+		ClientID:     "test-client",
+		ClientSecret: "test-secret",
+		Endpoint: oauth2.Endpoint{
+			TokenURL: tokenServer.URL,
+		},
+	}
+	auth.userInfoURL = userInfoServer.URL
+
+	user, err := auth.HandleCallback(ctx, "mock-code")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Roles are mapped from all groups, the prefix only limits access
+	if user.Role != "editor" {
+		t.Errorf("expected role 'editor' from the sales group, got %q", user.Role)
+	}
+	if access, _ := accessStore.GetAccess(ctx, handbook.ID, user.ID); access == nil || access.Role != "editor" {
+		t.Errorf("expected editor access through the parent group, got %+v", access)
+	}
+	if access, _ := accessStore.GetAccess(ctx, pricing.ID, user.ID); access != nil {
+		t.Error("expected no access through a group outside the prefix")
+	}
+
+	groupsFail = true
+	if _, err := auth.HandleCallback(ctx, "mock-code"); err == nil {
+		t.Error("expected login to fail when the groups endpoint fails")
+	}
+	if access, _ := accessStore.GetAccess(ctx, handbook.ID, user.ID); access == nil {
+		t.Error("expected access to be kept when the groups endpoint fails")
+	}
+}
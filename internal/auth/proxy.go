@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/config"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/store"
+)
+
+// proxySyncInterval is how long the role and group access of a proxy user
+// are kept before they are synced again. A change of groups syncs at once.
+const proxySyncInterval = 5 * time.Minute
+
+// ProxyAuthenticator trusts the user name and groups that a reverse proxy
+// such as oauth2-proxy or Authelia sends in request headers. Headers are
+// only honored on requests from the configured trusted proxies.
+type ProxyAuthenticator struct {
+	cfg           config.ProxyAuthConfig
+	trusted       []netip.Prefix
+	users         store.UserStore
+	access        store.ProjectAccessStore
+	groupMappings store.AuthGroupMappingStore
+	globalAccess  store.GlobalAccessStore
+	logger        *slog.Logger
+
+	mu     sync.Mutex
+	synced map[string]proxySync
+}
+
+// proxySync records when a user's groups were last synced.
+type proxySync struct {
+	groups string
+	at     time.Time
+}
+
+// NewProxyAuthenticator creates a proxy authenticator. The config must have
+// passed ValidateProxyAuthConfig.
+func NewProxyAuthenticator(cfg config.ProxyAuthConfig, users store.UserStore, logger *slog.Logger) *ProxyAuthenticator {
+	trusted, _ := parseTrustedProxies(cfg.TrustedProxies)
+	return &ProxyAuthenticator{
+		cfg:     cfg,
+		trusted: trusted,
+		users:   users,
+		logger:  logger,
+		synced:  make(map[string]proxySync),
+	}
+}
+
+// SetStores sets the access, group mapping, and global access stores.
+func (a *ProxyAuthenticator) SetStores(access store.ProjectAccessStore, groupMappings store.AuthGroupMappingStore, globalAccess store.GlobalAccessStore) {
+	a.access = access
+	a.groupMappings = groupMappings
+	a.globalAccess = globalAccess
+}
+
+func (a *ProxyAuthenticator) Name() string {
+	return "proxy"
+}
+
+// Authenticate is not used for proxy authentication (the proxy logs in).
+func (a *ProxyAuthenticator) Authenticate(ctx context.Context, username, password string) (*database.User, error) {
+	return nil, fmt.Errorf("proxy authentication does not support direct authentication")
+}
+
+// LogoutURL returns where to send users who log out, as the proxy would
+// otherwise log them straight back in. Empty if not configured.
+func (a *ProxyAuthenticator) LogoutURL() string {
+	return a.cfg.LogoutURL
+}
+
+// Trusted reports whether a request comes from a trusted proxy.
+func (a *ProxyAuthenticator) Trusted(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateRequest returns the user named in the user header of a
+// request from a trusted proxy, provisioning it on first sight. It returns
+// nil without an error if the request carries no proxy user.
+func (a *ProxyAuthenticator) AuthenticateRequest(ctx context.Context, r *http.Request) (*database.User, error) {
+	username := strings.TrimSpace(r.Header.Get(a.cfg.UserHeader))
+	if username == "" || !a.Trusted(r) {
+		return nil, nil
+	}
+
+	var groups []string
+	if a.cfg.GroupsHeader != "" {
+		for _, g := range strings.Split(r.Header.Get(a.cfg.GroupsHeader), ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				groups = append(groups, g)
+			}
+		}
+	}
+	var email string
+	if a.cfg.EmailHeader != "" {
+		email = strings.TrimSpace(r.Header.Get(a.cfg.EmailHeader))
+	}
+
+	if !a.needsSync(username, groups) {
+		user, err := a.users.GetByUsername(ctx, username)
+		if err == nil {
+			return user, nil
+		}
+	}
+
+	role, allowed := MapGroupToRole(groups, a.cfg.AdminGroup, a.cfg.EditorGroup, a.cfg.ViewerGroup)
+	if !allowed {
+		a.logger.DebugContext(ctx, "proxy user not in any allowed group", "username", username, "groups", groups)
+		return nil, fmt.Errorf("user not in any allowed group")
+	}
+
+	user, err := a.provisionUser(ctx, username, email, role)
+	if err != nil {
+		return nil, fmt.Errorf("provisioning user: %w", err)
+	}
+
+	if a.access != nil && a.groupMappings != nil {
+		if err := a.syncProjectAccess(ctx, user, groups); err != nil {
+			a.logger.WarnContext(ctx, "syncing proxy project access", "username", username, "error", err)
+		}
+	}
+	if a.globalAccess != nil {
+		if err := a.syncGlobalAccess(ctx, user, groups); err != nil {
+			a.logger.WarnContext(ctx, "syncing proxy global access", "username", username, "error", err)
+		}
+	}
+
+	a.mu.Lock()
+	a.synced[username] = proxySync{groups: strings.Join(groups, ","), at: time.Now()}
+	a.mu.Unlock()
+	return user, nil
+}
+
+// needsSync reports whether a user was not synced recently with the same
+// groups.
+func (a *ProxyAuthenticator) needsSync(username string, groups []string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	last, ok := a.synced[username]
+	return !ok || last.groups != strings.Join(groups, ",") || time.Since(last.at) > proxySyncInterval
+}
+
+func (a *ProxyAuthenticator) provisionUser(ctx context.Context, username, email, role string) (*database.User, error) {
+	existing, err := a.users.GetByUsername(ctx, username)
+	if err == nil && existing != nil {
+		// Only update email if changed; preserve manually-assigned role
+		if existing.Email != email && email != "" {
+			existing.Email = email
+			if err := a.users.Update(ctx, existing); err != nil {
+				a.logger.WarnContext(ctx, "updating proxy user", "username", username, "error", err)
+			}
+		}
+		return existing, nil
+	}
+
+	user := &database.User{
+		Username:   username,
+		Email:      email,
+		AuthSource: "proxy",
+		Role:       role,
+	}
+	if err := a.users.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("creating proxy user: %w", err)
+	}
+
+	a.logger.InfoContext(ctx, "auto-provisioned proxy user", "username", username, "role", role)
+	return user, nil
+}
+
+// syncProjectAccess grants the project access mapped to the user's groups
+// and revokes proxy-sourced access of groups the user left.
+func (a *ProxyAuthenticator) syncProjectAccess(ctx context.Context, user *database.User, groups []string) error {
+	mappings, err := a.groupMappings.ListBySource(ctx, "proxy")
+	if err != nil {
+		return fmt.Errorf("listing proxy group mappings: %w", err)
+	}
+	if len(mappings) == 0 {
+		return nil
+	}
+
+	granted := make(map[int64]string)
+	for _, mapping := range mappings {
+		if containsFold(groups, mapping.GroupIdentifier) && RoleHigher(mapping.Role, granted[mapping.ProjectID]) {
+			granted[mapping.ProjectID] = mapping.Role
+		}
+	}
+
+	existingAccess, err := a.access.ListByUserAndSource(ctx, user.ID, "proxy")
+	if err != nil {
+		return fmt.Errorf("listing existing proxy access: %w", err)
+	}
+	existing := make(map[int64]string)
+	for _, access := range existingAccess {
+		existing[access.ProjectID] = access.Role
+	}
+
+	for projectID, role := range granted {
+		if existingRole, ok := existing[projectID]; !ok || existingRole != role {
+			access := &database.ProjectAccess{ProjectID: projectID, UserID: user.ID, Role: role, Source: "proxy"}
+			if err := a.access.Grant(ctx, access); err != nil {
+				a.logger.WarnContext(ctx, "granting proxy project access", "project_id", projectID, "error", err)
+			}
+		}
+	}
+	for projectID := range existing {
+		if _, ok := granted[projectID]; !ok {
+			if err := a.access.RevokeBySource(ctx, projectID, user.ID, "proxy"); err != nil {
+				a.logger.WarnContext(ctx, "revoking proxy project access", "project_id", projectID, "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+// syncGlobalAccess grants the highest role of the proxy_group global access
+// rules matching the user's groups, or removes the user's proxy grant.
+func (a *ProxyAuthenticator) syncGlobalAccess(ctx context.Context, user *database.User, groups []string) error {
+	rules, err := a.globalAccess.ListRules(ctx)
+	if err != nil {
+		return fmt.Errorf("listing global access rules: %w", err)
+	}
+
+	var bestRole string
+	for _, rule := range rules {
+		if rule.SubjectType == "proxy_group" && containsFold(groups, rule.SubjectIdentifier) && RoleHigher(rule.Role, bestRole) {
+			bestRole = rule.Role
+		}
+	}
+
+	if bestRole == "" {
+		if err := a.globalAccess.DeleteGrantsBySource(ctx, user.ID, "proxy"); err != nil {
+			return fmt.Errorf("deleting global access grants: %w", err)
+		}
+		return nil
+	}
+	grant := &database.GlobalAccessGrant{UserID: user.ID, Role: bestRole, Source: "proxy"}
+	if err := a.globalAccess.UpsertGrant(ctx, grant); err != nil {
+		return fmt.Errorf("upserting global access grant: %w", err)
+	}
+	return nil
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool { return strings.EqualFold(v, s) })
+}
+
+// parseTrustedProxies parses IP addresses and CIDR ranges.
+func parseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: use an IP address or CIDR range", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// ValidateProxyAuthConfig checks that required proxy auth config fields are set.
+func ValidateProxyAuthConfig(cfg config.ProxyAuthConfig) error {
+	if len(cfg.TrustedProxies) == 0 {
+		return fmt.Errorf("proxy auth trusted_proxies is required")
+	}
+	if cfg.UserHeader == "" {
+		return fmt.Errorf("proxy auth user header is required")
+	}
+	_, err := parseTrustedProxies(cfg.TrustedProxies)
+	return err
+}
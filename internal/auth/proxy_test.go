@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/config"
+	"github.com/qwc/asiakirjat/internal/database"
+	sqlstore "github.com/qwc/asiakirjat/internal/store/sql"
+	"github.com/qwc/asiakirjat/internal/testutil"
+)
+
+func newTestProxyAuth(t *testing.T, cfg config.ProxyAuthConfig) (*ProxyAuthenticator, *sqlstore.UserStore, *sqlstore.ProjectAccessStore, *sqlstore.AuthGroupMappingStore, *sqlstore.ProjectStore) {
+	t.Helper()
+	userStore, accessStore, mappingStore, projectStore := setupLDAPTest(t)
+	if cfg.UserHeader == "" {
+		cfg.UserHeader = "Remote-User"
+	}
+	a := NewProxyAuthenticator(cfg, userStore, testutil.TestLogger())
+	a.SetStores(accessStore, mappingStore, nil)
+	return a, userStore, accessStore, mappingStore, projectStore
+}
+
+func TestProxyAuthenticatorName(t *testing.T) {
+	a, _, _, _, _ := newTestProxyAuth(t, config.ProxyAuthConfig{TrustedProxies: []string{"127.0.0.1"}})
+	if a.Name() != "proxy" {
+		t.Errorf("expected name 'proxy', got %q", a.Name())
+	}
+	if _, err := a.Authenticate(context.Background(), "user", "pass"); err == nil {
+		t.Error("expected direct authentication to fail")
+	}
+}
+
+func TestProxyTrusted(t *testing.T) {
+	a, _, _, _, _ := newTestProxyAuth(t, config.ProxyAuthConfig{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.5"}})
+
+	tests := []struct {
+		remoteAddr string
+		want       bool
+	}{
+		{"10.1.2.3:4567", true},
+		{"192.168.1.5:80", true},
+		{"192.168.1.6:80", false},
+		{"[::ffff:10.0.0.1]:80", true},
+		{"[::1]:80", false},
+		{"garbage", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if got := a.Trusted(r); got != tt.want {
+			t.Errorf("Trusted(%q) = %v, want %v", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
+
+func TestProxyAuthenticateRequest(t *testing.T) {
+	a, userStore, _, _, _ := newTestProxyAuth(t, config.ProxyAuthConfig{
+		TrustedProxies: []string{"10.0.0.0/8"},
+		EmailHeader:    "Remote-Email",
+		GroupsHeader:   "Remote-Groups",
+		AdminGroup:     "admins",
+		ViewerGroup:    "staff",
+	})
+	ctx := context.Background()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.2:1234"
+	r.Header.Set("Remote-User", "alice")
+	r.Header.Set("Remote-Email", "alice@example.com")
+	r.Header.Set("Remote-Groups", "staff, admins")
+
+	user, err := a.AuthenticateRequest(ctx, r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user == nil || user.Username != "alice" || user.AuthSource != "proxy" || user.Role != "admin" || user.Email != "alice@example.com" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if stored, err := userStore.GetByUsername(ctx, "alice"); err != nil || stored.ID != user.ID {
+		t.Error("expected the user to be provisioned")
+	}
+
+	// The same header from an untrusted address is ignored
+	r.RemoteAddr = "203.0.113.9:1234"
+	if user, err := a.AuthenticateRequest(ctx, r); user != nil || err != nil {
+		t.Errorf("expected untrusted request to be ignored, got %v, %v", user, err)
+	}
+
+	// Users outside the viewer group are rejected
+	r = httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.2:1234"
+	r.Header.Set("Remote-User", "mallory")
+	r.Header.Set("Remote-Groups", "guests")
+	if _, err := a.AuthenticateRequest(ctx, r); err == nil {
+		t.Error("expected user outside the allowed groups to be rejected")
+	}
+	if _, err := userStore.GetByUsername(ctx, "mallory"); err == nil {
+		t.Error("expected rejected user not to be provisioned")
+	}
+
+	// No header means no proxy user
+	r.Header.Del("Remote-User")
+	if user, err := a.AuthenticateRequest(ctx, r); user != nil || err != nil {
+		t.Errorf("expected no user without the header, got %v, %v", user, err)
+	}
+}
+
+func TestProxyProjectAccessSync(t *testing.T) {
+	a, _, accessStore, mappingStore, projectStore := newTestProxyAuth(t, config.ProxyAuthConfig{
+		TrustedProxies: []string{"127.0.0.1"},
+		GroupsHeader:   "Remote-Groups",
+	})
+	ctx := context.Background()
+
+	project := &database.Project{Slug: "project-a", Name: "Project A", Visibility: database.VisibilityPrivate}
+	projectStore.Create(ctx, project)
+	mappingStore.Create(ctx, &database.AuthGroupMapping{AuthSource: "proxy", GroupIdentifier: "writers", ProjectID: project.ID, Role: "editor"})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	r.Header.Set("Remote-User", "bob")
+	r.Header.Set("Remote-Groups", "writers")
+	user, err := a.AuthenticateRequest(ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := accessStore.GetAccess(ctx, project.ID, user.ID)
+	if err != nil || access.Role != "editor" || access.Source != "proxy" {
+		t.Fatalf("expected proxy editor access, got %+v, %v", access, err)
+	}
+
+	// Leaving the group revokes the access at once
+	r.Header.Set("Remote-Groups", "readers")
+	if _, err := a.AuthenticateRequest(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	if access, err := accessStore.GetAccess(ctx, project.ID, user.ID); err == nil && access != nil {
+		t.Errorf("expected access to be revoked, got %+v", access)
+	}
+}
+
+func TestValidateProxyAuthConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.ProxyAuthConfig
+		wantErr bool
+	}{
+		{"valid", config.ProxyAuthConfig{TrustedProxies: []string{"10.0.0.0/8", "::1"}, UserHeader: "Remote-User"}, false},
+		{"no trusted proxies", config.ProxyAuthConfig{UserHeader: "Remote-User"}, true},
+		{"no user header", config.ProxyAuthConfig{TrustedProxies: []string{"127.0.0.1"}}, true},
+		{"invalid proxy", config.ProxyAuthConfig{TrustedProxies: []string{"localhost"}, UserHeader: "Remote-User"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateProxyAuthConfig(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateProxyAuthConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
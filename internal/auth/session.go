@@ -1,23 +1,34 @@
 package auth
 
 import (
-	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/qwc/asiakirjat/internal/database"
 	"github.com/qwc/asiakirjat/internal/store"
 )
 
+// sessionTouchInterval is how often the last use of a session is saved,
+// rather than on every request.
+const sessionTouchInterval = time.Minute
+
+// userAgentMaxLen bounds the user agent kept with a session.
+const userAgentMaxLen = 512
+
 type SessionManager struct {
-	store      store.SessionStore
-	userStore  store.UserStore
-	cookieName string
-	maxAge     int
-	secure     bool
+	store          store.SessionStore
+	userStore      store.UserStore
+	cookieName     string
+	maxAge         int
+	idleTimeout    time.Duration
+	sliding        bool
+	rememberMaxAge int
+	secure         bool
 }
 
 func NewSessionManager(sessionStore store.SessionStore, userStore store.UserStore, cookieName string, maxAge int, secure bool) *SessionManager {
@@ -30,76 +41,250 @@ func NewSessionManager(sessionStore store.SessionStore, userStore store.UserStor
 	}
 }
 
-func (sm *SessionManager) CreateSession(ctx context.Context, w http.ResponseWriter, userID int64) error {
+// SetIdleTimeout ends sessions not used for the given number of seconds,
+// before their max age. Zero keeps them until they expire.
+func (sm *SessionManager) SetIdleTimeout(seconds int) {
+	sm.idleTimeout = time.Duration(seconds) * time.Second
+}
+
+// IdleTimeout returns how long a session may go unused, or zero.
+func (sm *SessionManager) IdleTimeout() time.Duration {
+	return sm.idleTimeout
+}
+
+// SetSliding makes sessions last their max age from their last use rather
+// than from the login.
+func (sm *SessionManager) SetSliding(sliding bool) {
+	sm.sliding = sliding
+}
+
+// SetRememberMaxAge lets "remember me" logins renew their session for the
+// given number of seconds. Zero turns remember-me off.
+func (sm *SessionManager) SetRememberMaxAge(seconds int) {
+	sm.rememberMaxAge = seconds
+}
+
+// RememberEnabled reports whether logins may ask to be remembered.
+func (sm *SessionManager) RememberEnabled() bool {
+	return sm.rememberMaxAge > 0
+}
+
+// rememberCookieName is the name of the cookie holding the remember-me
+// token, which outlives the session cookie.
+func (sm *SessionManager) rememberCookieName() string {
+	return sm.cookieName + "_remember"
+}
+
+// CreateSession logs the user in, remembering the browser and address the
+// request came from for the list of sessions. With remember set, and
+// remember-me enabled, the browser also gets a long-lived token that
+// starts a new session once this one has ended.
+func (sm *SessionManager) CreateSession(w http.ResponseWriter, r *http.Request, userID int64, remember bool) error {
+	// A token left from an earlier login would renew a stray session
+	sm.forgetRemembered(r)
+	var rememberUntil *time.Time
+	if remember && sm.RememberEnabled() {
+		until := time.Now().Add(time.Duration(sm.rememberMaxAge) * time.Second).UTC()
+		rememberUntil = &until
+	}
+	return sm.startSession(w, r, userID, rememberUntil)
+}
+
+// startSession creates a session and sets its cookies. A remember-me
+// token, if any, is replaced by a new one valid until rememberUntil.
+func (sm *SessionManager) startSession(w http.ResponseWriter, r *http.Request, userID int64, rememberUntil *time.Time) error {
 	token, err := GenerateToken(32)
 	if err != nil {
 		return fmt.Errorf("generating session token: %w", err)
 	}
 
+	userAgent := r.UserAgent()
+	if len(userAgent) > userAgentMaxLen {
+		userAgent = userAgent[:userAgentMaxLen]
+	}
+	now := time.Now()
 	session := &database.Session{
-		ID:        token,
-		UserID:    userID,
-		ExpiresAt: time.Now().Add(time.Duration(sm.maxAge) * time.Second),
+		ID:            token,
+		UserID:        userID,
+		ExpiresAt:     now.Add(time.Duration(sm.maxAge) * time.Second),
+		UserAgent:     userAgent,
+		IPAddress:     RequestIP(r),
+		LastSeenAt:    now.UTC(),
+		RememberUntil: rememberUntil,
+	}
+	var rememberToken string
+	if rememberUntil != nil {
+		if rememberToken, err = GenerateToken(32); err != nil {
+			return fmt.Errorf("generating remember-me token: %w", err)
+		}
+		session.RememberHash = HashToken(rememberToken)
 	}
 
-	if err := sm.store.Create(ctx, session); err != nil {
+	if err := sm.store.Create(r.Context(), session); err != nil {
 		return fmt.Errorf("creating session: %w", err)
 	}
 
+	sm.setCookie(w, sm.cookieName, token, sm.maxAge)
+	if rememberUntil != nil {
+		sm.setCookie(w, sm.rememberCookieName(), rememberToken, int(time.Until(*rememberUntil).Seconds()))
+	} else {
+		sm.clearCookie(w, r, sm.rememberCookieName())
+	}
+	// The rest of the request, e.g. a logout, sees the new session
+	setRequestCookie(r, sm.cookieName, token)
+	setRequestCookie(r, sm.rememberCookieName(), rememberToken)
+	return nil
+}
+
+// setRequestCookie replaces a cookie of the request, or removes it if
+// value is empty.
+func setRequestCookie(r *http.Request, name, value string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			r.AddCookie(c)
+		}
+	}
+	if value != "" {
+		r.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+}
+
+func (sm *SessionManager) setCookie(w http.ResponseWriter, name, value string, maxAge int) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     sm.cookieName,
-		Value:    token,
+		Name:     name,
+		Value:    value,
 		Path:     "/",
-		MaxAge:   sm.maxAge,
+		MaxAge:   maxAge,
 		HttpOnly: true,
 		Secure:   sm.secure,
 		SameSite: http.SameSiteLaxMode,
 	})
+}
 
-	return nil
+// clearCookie removes a cookie the request carries.
+func (sm *SessionManager) clearCookie(w http.ResponseWriter, r *http.Request, name string) {
+	if _, err := r.Cookie(name); err == nil {
+		sm.setCookie(w, name, "", -1)
+	}
 }
 
+// GetUserFromRequest returns the user of the session the request carries,
+// without extending or renewing it.
 func (sm *SessionManager) GetUserFromRequest(r *http.Request) *database.User {
-	cookie, err := r.Cookie(sm.cookieName)
-	if err != nil {
+	return sm.Authenticate(nil, r)
+}
+
+// Authenticate returns the user of the session the request carries. It
+// extends sliding sessions, and when the session has ended, starts a new
+// one from a valid remember-me token. Both need w; with a nil w the
+// session is only looked up.
+func (sm *SessionManager) Authenticate(w http.ResponseWriter, r *http.Request) *database.User {
+	ctx := r.Context()
+	now := time.Now()
+
+	if cookie, err := r.Cookie(sm.cookieName); err == nil {
+		if session, err := sm.store.GetByID(ctx, cookie.Value); err == nil {
+			if !session.ExpiresAt.Before(now) && (sm.idleTimeout <= 0 || !session.LastSeenAt.Add(sm.idleTimeout).Before(now)) {
+				user, err := sm.userStore.GetByID(ctx, session.UserID)
+				if err != nil || user.Deactivated {
+					return nil
+				}
+				if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+					expiresAt := session.ExpiresAt
+					if sm.sliding && w != nil {
+						expiresAt = now.Add(time.Duration(sm.maxAge) * time.Second)
+						sm.setCookie(w, sm.cookieName, session.ID, sm.maxAge)
+					}
+					sm.store.Touch(ctx, session.ID, now, expiresAt)
+				}
+				return user
+			}
+			// The remember-me token renews the session below
+			if !remembered(session, now) {
+				sm.store.Delete(ctx, session.ID)
+			}
+		}
+	}
+
+	if w == nil {
 		return nil
 	}
+	return sm.renewSession(w, r, now)
+}
+
+// remembered reports whether the remember-me token of a session is valid.
+func remembered(session *database.Session, now time.Time) bool {
+	return session.RememberUntil != nil && session.RememberUntil.After(now)
+}
 
-	session, err := sm.store.GetByID(r.Context(), cookie.Value)
+// renewSession replaces the session of a valid remember-me token with a new
+// one, and the token with a new one valid as long as the old.
+func (sm *SessionManager) renewSession(w http.ResponseWriter, r *http.Request, now time.Time) *database.User {
+	ctx := r.Context()
+	cookie, err := r.Cookie(sm.rememberCookieName())
 	if err != nil {
 		return nil
 	}
-
-	if session.ExpiresAt.Before(time.Now()) {
-		sm.store.Delete(r.Context(), session.ID)
+	session, err := sm.store.GetByRememberHash(ctx, HashToken(cookie.Value))
+	if err != nil || !remembered(session, now) {
+		if err == nil {
+			sm.store.Delete(ctx, session.ID)
+		}
+		sm.clearCookie(w, r, sm.rememberCookieName())
 		return nil
 	}
-
-	user, err := sm.userStore.GetByID(r.Context(), session.UserID)
-	if err != nil {
+	user, err := sm.userStore.GetByID(ctx, session.UserID)
+	if err != nil || user.Deactivated {
+		return nil
+	}
+	if err := sm.store.Delete(ctx, session.ID); err != nil {
+		return nil
+	}
+	if err := sm.startSession(w, r, user.ID, session.RememberUntil); err != nil {
 		return nil
 	}
-
 	return user
 }
 
-func (sm *SessionManager) DestroySession(w http.ResponseWriter, r *http.Request) {
+// SessionID returns the ID of the session the request carries, or "".
+func (sm *SessionManager) SessionID(r *http.Request) string {
 	cookie, err := r.Cookie(sm.cookieName)
 	if err != nil {
-		return
+		return ""
 	}
+	return cookie.Value
+}
 
-	sm.store.Delete(r.Context(), cookie.Value)
+// Remembered reports whether the request carries a remember-me token, so
+// a new session for it can be remembered too.
+func (sm *SessionManager) Remembered(r *http.Request) bool {
+	_, err := r.Cookie(sm.rememberCookieName())
+	return err == nil && sm.RememberEnabled()
+}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     sm.cookieName,
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   sm.secure,
-		SameSite: http.SameSiteLaxMode,
-	})
+// DestroySession logs the browser out, ending its session and remember-me
+// token.
+func (sm *SessionManager) DestroySession(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sm.cookieName); err == nil {
+		sm.store.Delete(r.Context(), cookie.Value)
+		sm.setCookie(w, sm.cookieName, "", -1)
+	}
+	sm.forgetRemembered(r)
+	sm.clearCookie(w, r, sm.rememberCookieName())
+}
+
+// forgetRemembered deletes the session of the remember-me token the
+// request carries.
+func (sm *SessionManager) forgetRemembered(r *http.Request) {
+	cookie, err := r.Cookie(sm.rememberCookieName())
+	if err != nil {
+		return
+	}
+	if session, err := sm.store.GetByRememberHash(r.Context(), HashToken(cookie.Value)); err == nil {
+		sm.store.Delete(r.Context(), session.ID)
+	}
 }
 
 func GenerateToken(bytes int) (string, error) {
@@ -109,3 +294,17 @@ func GenerateToken(bytes int) (string, error) {
 	}
 	return hex.EncodeToString(b), nil
 }
+
+// RequestIP returns the address of the client: the first address in
+// X-Forwarded-For, as set by a reverse proxy, or the remote address.
+func RequestIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		first, _, _ := strings.Cut(fwd, ",")
+		return strings.TrimSpace(first)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
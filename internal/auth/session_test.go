@@ -41,9 +41,10 @@ func TestCreateSession(t *testing.T) {
 	sm, _, _, user := setupSessionTest(t)
 
 	w := httptest.NewRecorder()
-	ctx := context.Background()
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
 
-	if err := sm.CreateSession(ctx, w, user.ID); err != nil {
+	if err := sm.CreateSession(w, req, user.ID, false); err != nil {
 		t.Fatal(err)
 	}
 
@@ -125,6 +126,140 @@ func TestGetUserFromRequest_ExpiredSession(t *testing.T) {
 	}
 }
 
+func TestGetUserFromRequest_IdleSession(t *testing.T) {
+	sm, _, sessionStore, user := setupSessionTest(t)
+	sm.SetIdleTimeout(1800)
+	ctx := context.Background()
+
+	for id, lastSeen := range map[string]time.Time{
+		"idle-session-token":   time.Now().Add(-time.Hour),
+		"active-session-token": time.Now().Add(-10 * time.Minute),
+	} {
+		session := &database.Session{ID: id, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour), LastSeenAt: lastSeen}
+		if err := sessionStore.Create(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "test_session", Value: "idle-session-token"})
+	if sm.GetUserFromRequest(req) != nil {
+		t.Error("expected nil user for idle session")
+	}
+	if _, err := sessionStore.GetByID(ctx, "idle-session-token"); err == nil {
+		t.Error("expected idle session to be deleted")
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "test_session", Value: "active-session-token"})
+	if sm.GetUserFromRequest(req) == nil {
+		t.Fatal("expected user for active session")
+	}
+	session, err := sessionStore.GetByID(ctx, "active-session-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(session.LastSeenAt) > time.Minute {
+		t.Errorf("expected last seen time to be updated, got %v", session.LastSeenAt)
+	}
+}
+
+func TestAuthenticate_SlidingSession(t *testing.T) {
+	sm, _, sessionStore, user := setupSessionTest(t)
+	sm.SetSliding(true)
+	ctx := context.Background()
+
+	session := &database.Session{ID: "sliding-session-token", UserID: user.ID, ExpiresAt: time.Now().Add(10 * time.Minute), LastSeenAt: time.Now().Add(-5 * time.Minute)}
+	if err := sessionStore.Create(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "test_session", Value: "sliding-session-token"})
+	w := httptest.NewRecorder()
+	if sm.Authenticate(w, req) == nil {
+		t.Fatal("expected user for sliding session")
+	}
+	session, _ = sessionStore.GetByID(ctx, "sliding-session-token")
+	if time.Until(session.ExpiresAt) < 50*time.Minute {
+		t.Errorf("expected the session to be extended to max age, expires at %v", session.ExpiresAt)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge != 3600 {
+		t.Errorf("expected the session cookie to be extended, got %v", cookies)
+	}
+}
+
+func TestAuthenticate_RememberMe(t *testing.T) {
+	sm, _, sessionStore, user := setupSessionTest(t)
+	sm.SetRememberMaxAge(30 * 86400)
+	ctx := context.Background()
+
+	w := httptest.NewRecorder()
+	if err := sm.CreateSession(w, httptest.NewRequest("POST", "/login", nil), user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	cookies := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	remember := cookies["test_session_remember"]
+	if remember == nil || remember.MaxAge < 29*86400 {
+		t.Fatalf("expected a long-lived remember-me cookie, got %v", remember)
+	}
+
+	// The session expires; the remember-me cookie starts a new one
+	session, err := sessionStore.GetByID(ctx, cookies["test_session"].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.ExpiresAt = time.Now().Add(-time.Minute)
+	sessionStore.Delete(ctx, session.ID)
+	sessionStore.Create(ctx, session)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies["test_session"])
+	req.AddCookie(cookies["test_session_remember"])
+	if sm.GetUserFromRequest(req) != nil {
+		t.Error("expected no user without renewing the expired session")
+	}
+	w = httptest.NewRecorder()
+	if got := sm.Authenticate(w, req); got == nil || got.ID != user.ID {
+		t.Fatal("expected the remember-me token to renew the session")
+	}
+	renewed := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		renewed[c.Name] = c
+	}
+	if renewed["test_session"] == nil || renewed["test_session"].Value == session.ID {
+		t.Error("expected a new session cookie")
+	}
+	if renewed["test_session_remember"] == nil || renewed["test_session_remember"].Value == cookies["test_session_remember"].Value {
+		t.Error("expected the remember-me token to be replaced")
+	}
+	if _, err := sessionStore.GetByID(ctx, session.ID); err == nil {
+		t.Error("expected the old session to be deleted")
+	}
+
+	// The replaced token no longer works
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies["test_session_remember"])
+	if sm.Authenticate(httptest.NewRecorder(), req) != nil {
+		t.Error("expected a used remember-me token to be refused")
+	}
+}
+
+func TestCreateSession_RememberDisabled(t *testing.T) {
+	sm, _, _, user := setupSessionTest(t)
+
+	w := httptest.NewRecorder()
+	if err := sm.CreateSession(w, httptest.NewRequest("POST", "/login", nil), user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 {
+		t.Errorf("expected only the session cookie while remember-me is off, got %v", cookies)
+	}
+}
+
 func TestGetUserFromRequest_NoCookie(t *testing.T) {
 	sm, _, _, _ := setupSessionTest(t)
 
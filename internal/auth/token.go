@@ -3,6 +3,8 @@ package auth
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -11,6 +13,85 @@ import (
 	"github.com/qwc/asiakirjat/internal/store"
 )
 
+// Token scopes. A token may carry several scopes; admin:project implies
+// upload, delete and read, but not scim.
+const (
+	ScopeUpload       = "upload"
+	ScopeDelete       = "delete"
+	ScopeRead         = "read"
+	ScopeAdminProject = "admin:project"
+	ScopeSCIM         = "scim"
+)
+
+// AllScopes lists the scopes that can be assigned to an API token.
+var AllScopes = []string{ScopeUpload, ScopeDelete, ScopeRead, ScopeAdminProject, ScopeSCIM}
+
+// ProjectScopes lists the scopes offered for project tokens; provisioning
+// users over SCIM is not about a project.
+var ProjectScopes = []string{ScopeUpload, ScopeDelete, ScopeRead, ScopeAdminProject}
+
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrMissingScope = errors.New("token lacks required scope")
+)
+
+// ParseScopes splits a stored scopes string into its individual scopes.
+// Scopes may be separated by commas or whitespace.
+func ParseScopes(s string) []string {
+	return strings.Fields(strings.ReplaceAll(s, ",", " "))
+}
+
+// NormalizeScopes validates the given scopes and returns them in canonical
+// order as a comma-separated string suitable for storage.
+func NormalizeScopes(scopes []string) (string, error) {
+	selected := make(map[string]bool)
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !isKnownScope(s) {
+			return "", fmt.Errorf("unknown scope %q", s)
+		}
+		selected[s] = true
+	}
+
+	var out []string
+	for _, s := range AllScopes {
+		if selected[s] {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return "", errors.New("at least one scope is required")
+	}
+	return strings.Join(out, ","), nil
+}
+
+// HasScope reports whether the token grants the given scope.
+func HasScope(token *database.APIToken, scope string) bool {
+	for _, s := range ParseScopes(token.Scopes) {
+		if s == scope || s == ScopeAdminProject && impliedByAdminProject(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// impliedByAdminProject reports whether admin:project grants scope.
+func impliedByAdminProject(scope string) bool {
+	return scope == ScopeUpload || scope == ScopeDelete || scope == ScopeRead
+}
+
+func isKnownScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
 type TokenAuthenticator struct {
 	tokens store.TokenStore
 	users  store.UserStore
@@ -42,6 +123,33 @@ func (a *TokenAuthenticator) AuthenticateRequestForProject(r *http.Request, proj
 	return user
 }
 
+// AnyProject is passed to AuthenticateScoped to check a token before the
+// project of the request is known, e.g. before reading an upload. The
+// project must be checked once it is.
+const AnyProject int64 = -1
+
+// AuthenticateScoped authenticates the request and checks that the token grants
+// the given scope. Tokens of a project are refused for other projects, and
+// for requests that are not about a project, which pass a projectID of 0. It
+// returns ErrMissingScope when the token is valid but lacks the scope, and
+// ErrInvalidToken for every other failure.
+func (a *TokenAuthenticator) AuthenticateScoped(r *http.Request, projectID int64, scope string) (*database.User, error) {
+	user, token := a.authenticateRequestInternal(r)
+	if user == nil || token == nil {
+		return nil, ErrInvalidToken
+	}
+
+	if projectID != AnyProject && token.ProjectID != nil && *token.ProjectID != projectID {
+		return nil, ErrInvalidToken
+	}
+
+	if !HasScope(token, scope) {
+		return nil, ErrMissingScope
+	}
+
+	return user, nil
+}
+
 func (a *TokenAuthenticator) authenticateRequestInternal(r *http.Request) (*database.User, *database.APIToken) {
 	header := r.Header.Get("Authorization")
 	if header == "" {
@@ -67,7 +175,7 @@ func (a *TokenAuthenticator) authenticateRequestInternal(r *http.Request) (*data
 	}
 
 	user, err := a.users.GetByID(r.Context(), token.UserID)
-	if err != nil {
+	if err != nil || user.Deactivated {
 		return nil, nil
 	}
 
@@ -382,3 +382,103 @@ func TestTokenAuthenticateRequestCaseInsensitiveBearer(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeScopes(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   []string
+		want    string
+		wantErr bool
+	}{
+		{"single", []string{"read"}, "read", false},
+		{"canonical order", []string{"read", "upload"}, "upload,read", false},
+		{"duplicates", []string{"delete", "delete"}, "delete", false},
+		{"admin", []string{"admin:project"}, "admin:project", false},
+		{"unknown", []string{"upload", "write"}, "", true},
+		{"empty", []string{""}, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NormalizeScopes(tc.input)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	token := &database.APIToken{Scopes: "upload,read"}
+	if !HasScope(token, ScopeUpload) || !HasScope(token, ScopeRead) {
+		t.Error("expected upload and read scopes")
+	}
+	if HasScope(token, ScopeDelete) {
+		t.Error("expected no delete scope")
+	}
+
+	admin := &database.APIToken{Scopes: "admin:project"}
+	for _, scope := range ProjectScopes {
+		if !HasScope(admin, scope) {
+			t.Errorf("expected admin:project to imply %s", scope)
+		}
+	}
+	if HasScope(admin, ScopeSCIM) {
+		t.Error("expected admin:project not to imply scim")
+	}
+}
+
+func TestTokenAuthenticateScoped(t *testing.T) {
+	auth, tokenStore, userStore, projectStore := setupTokenAuth(t)
+	ctx := context.Background()
+
+	user := &database.User{
+		Username:   "robot",
+		AuthSource: "robot",
+		Role:       "editor",
+		IsRobot:    true,
+	}
+	userStore.Create(ctx, user)
+
+	project := &database.Project{Slug: "proj", Name: "Project"}
+	projectStore.Create(ctx, project)
+	other := &database.Project{Slug: "other", Name: "Other"}
+	projectStore.Create(ctx, other)
+
+	rawToken := "read-only-token"
+	tokenStore.Create(ctx, &database.APIToken{
+		UserID:    user.ID,
+		ProjectID: &project.ID,
+		TokenHash: HashToken(rawToken),
+		Name:      "read-only",
+		Scopes:    "read",
+	})
+
+	req := httptest.NewRequest("GET", "/api/projects", nil)
+	req.Header.Set("Authorization", "Bearer "+rawToken)
+
+	if got, err := auth.AuthenticateScoped(req, project.ID, ScopeRead); err != nil || got == nil {
+		t.Fatalf("expected user for read scope, got err %v", err)
+	}
+	if _, err := auth.AuthenticateScoped(req, project.ID, ScopeUpload); err != ErrMissingScope {
+		t.Errorf("expected ErrMissingScope, got %v", err)
+	}
+	if _, err := auth.AuthenticateScoped(req, other.ID, ScopeRead); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for wrong project, got %v", err)
+	}
+	if _, err := auth.AuthenticateScoped(req, 0, ScopeRead); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken without a project, got %v", err)
+	}
+	if got, err := auth.AuthenticateScoped(req, AnyProject, ScopeRead); err != nil || got == nil {
+		t.Errorf("expected user before the project is known, got err %v", err)
+	}
+}
@@ -0,0 +1,563 @@
+// Package backup writes and restores backups of a server: its database, the
+// files of its projects, its search index and its configuration, in one
+// gzip-compressed tar archive.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// FormatVersion is the version of the archive layout written by Create.
+const FormatVersion = 1
+
+// Entries of a backup archive. The files of the projects are below
+// storageDir.
+const (
+	infoEntry        = "backup.json"
+	configEntry      = "config.yaml"
+	sqliteEntry      = "database.sqlite"
+	sqlDumpEntry     = "database.sql"
+	searchIndexEntry = "search-index.zip"
+	storageDir       = "storage/"
+)
+
+// blobsDir holds the files of deduplicated storage, which are hard links to
+// version files and would be stored twice.
+const blobsDir = ".blobs"
+
+var (
+	// ErrNotEmpty is returned when restoring over existing data.
+	ErrNotEmpty = errors.New("restore target is not empty")
+	// ErrUnsupported is returned for backups of a different database.
+	ErrUnsupported = errors.New("backup does not match the configured database")
+)
+
+// Info describes a backup. It is the first entry of the archive.
+type Info struct {
+	FormatVersion int              `json:"format_version"`
+	AppVersion    string           `json:"app_version"`
+	CreatedAt     time.Time        `json:"created_at"`
+	Dialect       database.Dialect `json:"dialect"`
+	SearchIndex   bool             `json:"search_index"`
+}
+
+// Options select what Create writes to a backup.
+type Options struct {
+	DB      *sqlx.DB
+	Dialect database.Dialect
+	DSN     string
+	// StoragePath is the storage base path whose tree is backed up.
+	StoragePath string
+	// Config is the effective configuration, stored as a snapshot.
+	Config []byte
+	// SearchIndex writes a snapshot of the search index; nil leaves it out.
+	SearchIndex func(w io.Writer) error
+	AppVersion  string
+}
+
+// Create writes a backup to w. SQLite databases are copied with VACUUM
+// INTO, PostgreSQL and MySQL databases dumped with pg_dump or mysqldump,
+// which must be installed. The caller keeps uploads from changing the
+// storage while the backup runs.
+func Create(ctx context.Context, w io.Writer, opts Options) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	info := Info{
+		FormatVersion: FormatVersion,
+		AppVersion:    opts.AppVersion,
+		CreatedAt:     time.Now().UTC(),
+		Dialect:       opts.Dialect,
+		SearchIndex:   opts.SearchIndex != nil,
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(tw, infoEntry, data); err != nil {
+		return err
+	}
+	if err := writeEntry(tw, configEntry, opts.Config); err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp("", "asiakirjat-backup-")
+	if err != nil {
+		return fmt.Errorf("creating backup directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dump, entry, err := dumpDatabase(ctx, opts, tmp)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(tw, entry, dump); err != nil {
+		return err
+	}
+
+	if opts.SearchIndex != nil {
+		snapshot := filepath.Join(tmp, searchIndexEntry)
+		if err := writeTo(snapshot, opts.SearchIndex); err != nil {
+			return fmt.Errorf("exporting search index: %w", err)
+		}
+		if err := writeFile(tw, searchIndexEntry, snapshot); err != nil {
+			return err
+		}
+	}
+
+	if err := writeStorage(ctx, tw, opts.StoragePath); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// dumpDatabase writes the database to a file in dir, and returns the file
+// and the archive entry it is stored as.
+func dumpDatabase(ctx context.Context, opts Options, dir string) (string, string, error) {
+	switch opts.Dialect {
+	case database.DialectSQLite:
+		file := filepath.Join(dir, sqliteEntry)
+		if _, err := opts.DB.ExecContext(ctx, "VACUUM INTO ?", file); err != nil {
+			return "", "", fmt.Errorf("copying database: %w", err)
+		}
+		return file, sqliteEntry, nil
+	case database.DialectPostgres:
+		file := filepath.Join(dir, sqlDumpEntry)
+		cmd, err := postgresCommand(ctx, "pg_dump", opts.DSN, "--no-owner", "--no-privileges", "--file="+file)
+		if err != nil {
+			return "", "", err
+		}
+		if err := run(cmd); err != nil {
+			return "", "", fmt.Errorf("dumping database: %w", err)
+		}
+		return file, sqlDumpEntry, nil
+	case database.DialectMySQL:
+		file := filepath.Join(dir, sqlDumpEntry)
+		cmd, err := mysqlCommand(ctx, "mysqldump", opts.DSN, "--single-transaction", "--result-file="+file)
+		if err != nil {
+			return "", "", err
+		}
+		if err := run(cmd); err != nil {
+			return "", "", fmt.Errorf("dumping database: %w", err)
+		}
+		return file, sqlDumpEntry, nil
+	}
+	return "", "", fmt.Errorf("backing up %s databases: %w", opts.Dialect, ErrUnsupported)
+}
+
+// mysqlCommand returns a MySQL client command connecting with the settings
+// of a go-sql-driver DSN. The password is passed in the environment.
+func mysqlCommand(ctx context.Context, name, dsn string, args ...string) (*exec.Cmd, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parsing database DSN: %w", err)
+	}
+	conn := []string{"--user=" + cfg.User}
+	switch cfg.Net {
+	case "unix":
+		conn = append(conn, "--socket="+cfg.Addr)
+	default:
+		host, port := cfg.Addr, ""
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host, port = host[:i], host[i+1:]
+		}
+		conn = append(conn, "--host="+host)
+		if port != "" {
+			conn = append(conn, "--port="+port)
+		}
+	}
+	cmd := exec.CommandContext(ctx, name, append(append(conn, args...), cfg.DBName)...)
+	cmd.Env = append(os.Environ(), "MYSQL_PWD="+cfg.Passwd)
+	return cmd, nil
+}
+
+// postgresCommand returns a PostgreSQL client command connecting with a
+// URL or keyword/value DSN. The password is passed in the environment, so
+// that it does not show in the process list.
+func postgresCommand(ctx context.Context, name, dsn string, args ...string) (*exec.Cmd, error) {
+	dsn, password, err := splitPostgresPassword(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parsing database DSN: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, name, append(args, "--dbname="+dsn)...)
+	cmd.Env = os.Environ()
+	if password != "" {
+		cmd.Env = append(cmd.Env, "PGPASSWORD="+password)
+	}
+	return cmd, nil
+}
+
+// splitPostgresPassword removes the password from a PostgreSQL DSN and
+// returns it separately.
+func splitPostgresPassword(dsn string) (string, string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", "", err
+		}
+		var password string
+		if u.User != nil {
+			password, _ = u.User.Password()
+			u.User = url.User(u.User.Username())
+		}
+		if q := u.Query(); q.Has("password") {
+			password = q.Get("password")
+			q.Del("password")
+			u.RawQuery = q.Encode()
+		}
+		return u.String(), password, nil
+	}
+
+	// Keyword/value settings, with values optionally in single quotes
+	// and backslash escapes
+	var kept []string
+	var password string
+	for rest := strings.TrimSpace(dsn); rest != ""; rest = strings.TrimSpace(rest) {
+		key, after, ok := strings.Cut(rest, "=")
+		if !ok {
+			return "", "", errors.New("setting without a value")
+		}
+		key = strings.TrimSpace(key)
+		rest = strings.TrimLeft(after, " \t\n\r")
+		var value strings.Builder
+		quoted := strings.HasPrefix(rest, "'")
+		if quoted {
+			rest = rest[1:]
+		}
+		for {
+			if rest == "" {
+				if quoted {
+					return "", "", errors.New("unterminated quoted value")
+				}
+				break
+			}
+			c := rest[0]
+			if !quoted && strings.ContainsRune(" \t\n\r", rune(c)) {
+				break
+			}
+			rest = rest[1:]
+			if quoted && c == '\'' {
+				break
+			}
+			if c == '\\' && rest != "" {
+				c, rest = rest[0], rest[1:]
+			}
+			value.WriteByte(c)
+		}
+		if key == "password" {
+			password = value.String()
+			continue
+		}
+		v := strings.ReplaceAll(value.String(), `\`, `\\`)
+		kept = append(kept, key+"='"+strings.ReplaceAll(v, "'", `\'`)+"'")
+	}
+	return strings.Join(kept, " "), password, nil
+}
+
+// run runs a command and adds its error output to the error.
+func run(cmd *exec.Cmd) error {
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// writeStorage adds the files below base to the archive, except the blobs
+// of deduplicated storage.
+func writeStorage(ctx context.Context, tw *tar.Writer, base string) error {
+	err := filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == base && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if d.IsDir() && rel == blobsDir {
+			return fs.SkipDir
+		}
+		name := storageDir + filepath.ToSlash(rel)
+		if d.IsDir() {
+			return tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: 0755, ModTime: time.Now()})
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return writeFile(tw, name, p)
+	})
+	if err != nil {
+		return fmt.Errorf("backing up storage: %w", err)
+	}
+	return nil
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+func writeFile(tw *tar.Writer, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	// A file that grows while it is copied must not overflow its entry
+	if _, err := io.Copy(tw, io.LimitReader(f, info.Size())); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+func writeTo(file string, fn func(w io.Writer) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RestoreOptions are where Restore restores a backup to.
+type RestoreOptions struct {
+	Dialect     database.Dialect
+	DSN         string
+	StoragePath string
+	// ConfigPath receives the configuration snapshot; empty skips it.
+	ConfigPath string
+	// ImportSearchIndex replaces the search index with the snapshot of the
+	// backup; nil skips it.
+	ImportSearchIndex func(r io.Reader) error
+}
+
+// Restore restores a backup written by Create into an empty database and
+// storage. SQLite databases must not exist yet; PostgreSQL and MySQL
+// databases must exist without tables, and are restored with psql or mysql.
+func Restore(ctx context.Context, r io.Reader, opts RestoreOptions) (*Info, error) {
+	if err := checkEmpty(opts); err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading backup: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	var info *Info
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return info, fmt.Errorf("reading backup: %w", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return info, err
+		}
+		if info == nil && hdr.Name != infoEntry {
+			return nil, fmt.Errorf("reading backup: %s is not the first entry", infoEntry)
+		}
+
+		switch name := hdr.Name; {
+		case name == infoEntry:
+			info = &Info{}
+			if err := json.NewDecoder(tr).Decode(info); err != nil {
+				return nil, fmt.Errorf("reading %s: %w", infoEntry, err)
+			}
+			if info.FormatVersion > FormatVersion {
+				return nil, fmt.Errorf("backup format %d is newer than this server supports", info.FormatVersion)
+			}
+			if info.Dialect != opts.Dialect {
+				return nil, fmt.Errorf("restoring a %s backup to %s: %w", info.Dialect, opts.Dialect, ErrUnsupported)
+			}
+		case name == configEntry:
+			if opts.ConfigPath == "" {
+				continue
+			}
+			if err := copyTo(opts.ConfigPath, tr, 0600); err != nil {
+				return info, fmt.Errorf("restoring configuration: %w", err)
+			}
+		case name == sqliteEntry || name == sqlDumpEntry:
+			if err := restoreDatabase(ctx, tr, name, opts); err != nil {
+				return info, err
+			}
+		case name == searchIndexEntry:
+			if opts.ImportSearchIndex == nil {
+				continue
+			}
+			if err := opts.ImportSearchIndex(tr); err != nil {
+				return info, fmt.Errorf("restoring search index: %w", err)
+			}
+		case strings.HasPrefix(name, storageDir):
+			if err := restoreStorage(tr, hdr, opts.StoragePath); err != nil {
+				return info, err
+			}
+		}
+	}
+	if info == nil {
+		return nil, fmt.Errorf("reading backup: %s is missing", infoEntry)
+	}
+	return info, nil
+}
+
+// checkEmpty returns ErrNotEmpty if the storage, the configuration snapshot
+// or an SQLite database exist already.
+func checkEmpty(opts RestoreOptions) error {
+	entries, err := os.ReadDir(opts.StoragePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%w: %s has files", ErrNotEmpty, opts.StoragePath)
+	}
+	if opts.ConfigPath != "" {
+		if _, err := os.Stat(opts.ConfigPath); err == nil {
+			return fmt.Errorf("%w: %s exists", ErrNotEmpty, opts.ConfigPath)
+		}
+	}
+	if opts.Dialect == database.DialectSQLite {
+		if _, err := os.Stat(sqlitePath(opts.DSN)); err == nil {
+			return fmt.Errorf("%w: database %s exists", ErrNotEmpty, sqlitePath(opts.DSN))
+		}
+	}
+	return nil
+}
+
+// sqlitePath returns the database file of an SQLite DSN.
+func sqlitePath(dsn string) string {
+	dsn = strings.TrimPrefix(dsn, "file:")
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		dsn = dsn[:i]
+	}
+	return dsn
+}
+
+func restoreDatabase(ctx context.Context, r io.Reader, entry string, opts RestoreOptions) error {
+	switch {
+	case opts.Dialect == database.DialectSQLite && entry == sqliteEntry:
+		file := sqlitePath(opts.DSN)
+		if dir := filepath.Dir(file); dir != "" {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("restoring database: %w", err)
+			}
+		}
+		if err := copyTo(file, r, 0644); err != nil {
+			return fmt.Errorf("restoring database: %w", err)
+		}
+		return nil
+	case opts.Dialect == database.DialectPostgres && entry == sqlDumpEntry:
+		cmd, err := postgresCommand(ctx, "psql", opts.DSN, "--quiet", "--set=ON_ERROR_STOP=1")
+		if err != nil {
+			return err
+		}
+		cmd.Stdin = r
+		if err := run(cmd); err != nil {
+			return fmt.Errorf("restoring database: %w", err)
+		}
+		return nil
+	case opts.Dialect == database.DialectMySQL && entry == sqlDumpEntry:
+		cmd, err := mysqlCommand(ctx, "mysql", opts.DSN)
+		if err != nil {
+			return err
+		}
+		cmd.Stdin = r
+		if err := run(cmd); err != nil {
+			return fmt.Errorf("restoring database: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("restoring %s to %s: %w", entry, opts.Dialect, ErrUnsupported)
+}
+
+// restoreStorage writes a storage entry below base.
+func restoreStorage(r io.Reader, hdr *tar.Header, base string) error {
+	rel := path.Clean(strings.TrimPrefix(hdr.Name, storageDir))
+	if rel == "." {
+		return nil
+	}
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return fmt.Errorf("restoring storage: unsafe path %q", hdr.Name)
+	}
+	target := filepath.Join(base, filepath.FromSlash(rel))
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return fmt.Errorf("restoring storage: %w", err)
+		}
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("restoring storage: %w", err)
+		}
+		if err := copyTo(target, r, 0644); err != nil {
+			return fmt.Errorf("restoring storage: %w", err)
+		}
+		os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+	}
+	return nil
+}
+
+func copyTo(file string, r io.Reader, perm os.FileMode) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	sqlstore "github.com/qwc/asiakirjat/internal/store/sql"
+)
+
+func TestCreateAndRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dsn := filepath.Join(dir, "asiakirjat.db")
+	db, dialect, err := database.Open("sqlite", dsn, database.Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := database.RunMigrations(db, dialect); err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlstore.NewProjectStore(db).Create(ctx, &database.Project{Slug: "guide", Name: "Guide", Visibility: database.VisibilityPublic}); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := filepath.Join(dir, "projects")
+	os.MkdirAll(filepath.Join(storage, "guide", "1.0.0"), 0755)
+	os.WriteFile(filepath.Join(storage, "guide", "1.0.0", "index.html"), []byte("<h1>Guide</h1>"), 0644)
+	os.MkdirAll(filepath.Join(storage, ".blobs", "ab"), 0755)
+	os.WriteFile(filepath.Join(storage, ".blobs", "ab", "abcd"), []byte("<h1>Guide</h1>"), 0644)
+
+	var archive bytes.Buffer
+	err = Create(ctx, &archive, Options{
+		DB:          db,
+		Dialect:     dialect,
+		DSN:         dsn,
+		StoragePath: storage,
+		Config:      []byte("server:\n  port: 8080\n"),
+		SearchIndex: func(w io.Writer) error {
+			_, err := w.Write([]byte("index"))
+			return err
+		},
+		AppVersion: "1.2.3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := t.TempDir()
+	var index bytes.Buffer
+	opts := RestoreOptions{
+		Dialect:     database.DialectSQLite,
+		DSN:         filepath.Join(target, "data", "asiakirjat.db"),
+		StoragePath: filepath.Join(target, "projects"),
+		ConfigPath:  filepath.Join(target, "config.yaml.restored"),
+		ImportSearchIndex: func(r io.Reader) error {
+			_, err := io.Copy(&index, r)
+			return err
+		},
+	}
+	info, err := Restore(ctx, bytes.NewReader(archive.Bytes()), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.AppVersion != "1.2.3" || info.Dialect != database.DialectSQLite || !info.SearchIndex {
+		t.Errorf("unexpected backup info: %+v", info)
+	}
+
+	restored, _, err := database.Open("sqlite", opts.DSN, database.Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if _, err := sqlstore.NewProjectStore(restored).GetBySlug(ctx, "guide"); err != nil {
+		t.Errorf("expected the project to be restored: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(opts.StoragePath, "guide", "1.0.0", "index.html")); err != nil || string(data) != "<h1>Guide</h1>" {
+		t.Errorf("expected the version files to be restored, got %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(opts.StoragePath, ".blobs")); !os.IsNotExist(err) {
+		t.Error("expected the blobs to be left out")
+	}
+	if data, _ := os.ReadFile(opts.ConfigPath); string(data) != "server:\n  port: 8080\n" {
+		t.Errorf("unexpected config snapshot %q", data)
+	}
+	if index.String() != "index" {
+		t.Errorf("unexpected search index %q", index.String())
+	}
+
+	// Restoring again finds the data of the first restore
+	if _, err := Restore(ctx, bytes.NewReader(archive.Bytes()), opts); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("expected ErrNotEmpty, got %v", err)
+	}
+
+	// Backups only restore to the database they were taken from
+	opts = RestoreOptions{Dialect: database.DialectPostgres, StoragePath: t.TempDir()}
+	if _, err := Restore(ctx, bytes.NewReader(archive.Bytes()), opts); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestRestoreRejectsUnsafePaths(t *testing.T) {
+	for _, name := range []string{"storage/../escape", "storage//etc/passwd"} {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name}
+		if err := restoreStorage(bytes.NewReader(nil), hdr, t.TempDir()); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPostgresCommandHidesPassword(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"postgres://docs:s3cr%40t@db:5432/asiakirjat?sslmode=disable", "postgres://docs@db:5432/asiakirjat?sslmode=disable"},
+		{"postgresql://docs@db/asiakirjat?password=s3cr@t", "postgresql://docs@db/asiakirjat"},
+		{"host=db user=docs password=s3cr@t dbname=asiakirjat", "host='db' user='docs' dbname='asiakirjat'"},
+		{"host=db password = 's3cr@t' dbname='my docs'", "host='db' dbname='my docs'"},
+	}
+	for _, tt := range tests {
+		cmd, err := postgresCommand(context.Background(), "pg_dump", tt.dsn, "--no-owner")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.dsn, err)
+		}
+		if args := strings.Join(cmd.Args, " "); args != "pg_dump --no-owner --dbname="+tt.want {
+			t.Errorf("%s: expected the DSN without the password, got %q", tt.dsn, args)
+		}
+		if !slices.Contains(cmd.Env, "PGPASSWORD=s3cr@t") {
+			t.Errorf("%s: expected the password in the environment", tt.dsn)
+		}
+	}
+
+	if _, err := postgresCommand(context.Background(), "psql", "host=db password='s3cr@t"); err == nil || strings.Contains(err.Error(), "s3cr@t") {
+		t.Errorf("expected an error without the password, got %v", err)
+	}
+}
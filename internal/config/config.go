@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
@@ -11,41 +12,388 @@ import (
 )
 
 type Config struct {
-	Server    ServerConfig    `yaml:"server"`
-	Database  DatabaseConfig  `yaml:"database"`
-	Auth      AuthConfig      `yaml:"auth"`
-	Access    AccessConfig    `yaml:"access"`
-	Storage   StorageConfig   `yaml:"storage"`
-	Retention RetentionConfig `yaml:"retention"`
-	Branding  BrandingConfig  `yaml:"branding"`
-	Projects  ProjectsConfig  `yaml:"projects"`
+	Server        ServerConfig        `yaml:"server"`
+	Database      DatabaseConfig      `yaml:"database"`
+	Auth          AuthConfig          `yaml:"auth"`
+	Access        AccessConfig        `yaml:"access"`
+	Storage       StorageConfig       `yaml:"storage"`
+	Retention     RetentionConfig     `yaml:"retention"`
+	Branding      BrandingConfig      `yaml:"branding"`
+	Projects      ProjectsConfig      `yaml:"projects"`
+	Maintenance   MaintenanceConfig   `yaml:"maintenance"`
+	Upload        UploadConfig        `yaml:"upload"`
+	Events        EventsConfig        `yaml:"events"`
+	Email         EmailConfig         `yaml:"email"`
+	Watch         WatchConfig         `yaml:"watch"`
+	SEO           SEOConfig           `yaml:"seo"`
+	Cache         CacheConfig         `yaml:"cache"`
+	Compression   CompressionConfig   `yaml:"compression"`
+	APIKeys       APIKeysConfig       `yaml:"api_keys"`
+	Offline       OfflineConfig       `yaml:"offline"`
+	Accessibility AccessibilityConfig `yaml:"accessibility"`
+	Thumbnails    ThumbnailsConfig    `yaml:"thumbnails"`
+	Export        ExportConfig        `yaml:"export"`
+	Overlay       OverlayConfig       `yaml:"overlay"`
+	History       HistoryConfig       `yaml:"history"`
+	Analytics     AnalyticsConfig     `yaml:"analytics"`
+	Degraded      DegradedConfig      `yaml:"degraded"`
+	Search        SearchConfig        `yaml:"search"`
+	Chaos         ChaosConfig         `yaml:"chaos"`
+
+	// Hooks are external commands run at uploads, page views and logins.
+	Hooks []HookConfig `yaml:"hooks"`
+
+	// Features switches feature flags on or off by name, overriding their
+	// defaults. Admins can override these in turn.
+	Features map[string]bool `yaml:"features"`
+}
+
+// HookConfig is an external command run at a hook point, see package hooks.
+type HookConfig struct {
+	Point    string   `yaml:"point"`    // "pre_upload", "post_publish", "pre_serve" or "post_login"
+	Command  string   `yaml:"command"`  // Command and arguments, split on spaces
+	Timeout  int      `yaml:"timeout"`  // Seconds per run; default 10
+	Projects []string `yaml:"projects"` // Project slugs to run for; empty for all
+}
+
+// SearchConfig controls where the search index is kept and how it
+// analyzes the text of pages. Analysis changes apply when the index is
+// rebuilt.
+type SearchConfig struct {
+	IndexPath string `yaml:"index_path" env:"ASIAKIRJAT_SEARCH_INDEX_PATH"` // Directory of the embedded index, and of the rebuild state with any backend
+
+	Backend string `yaml:"backend" env:"ASIAKIRJAT_SEARCH_BACKEND"` // "bleve" for the embedded index (default) or "meilisearch"
+	URL     string `yaml:"url" env:"ASIAKIRJAT_SEARCH_URL"`         // URL of the external search engine
+	APIKey  string `yaml:"api_key" env:"ASIAKIRJAT_SEARCH_API_KEY"`
+	Index   string `yaml:"index" env:"ASIAKIRJAT_SEARCH_INDEX"` // Index name in the external search engine; default "asiakirjat"
+
+	Language       string                         `yaml:"language" env:"ASIAKIRJAT_SEARCH_LANGUAGE"`     // e.g. "fi" or "de"; empty for language-neutral analysis
+	Stemming       bool                           `yaml:"stemming" env:"ASIAKIRJAT_SEARCH_STEMMING"`     // Reduce words to their stem; needs a language
+	StopWords      bool                           `yaml:"stop_words" env:"ASIAKIRJAT_SEARCH_STOP_WORDS"` // Leave out the language's most common words
+	ExtraStopWords []string                       `yaml:"extra_stop_words"`
+	Projects       map[string]SearchProjectConfig `yaml:"projects"` // Overrides by project slug
+}
+
+// SearchProjectConfig overrides the analysis of a project's pages. Settings
+// left out are taken from the search section.
+type SearchProjectConfig struct {
+	Language       string   `yaml:"language"`
+	Stemming       *bool    `yaml:"stemming"`
+	StopWords      *bool    `yaml:"stop_words"`
+	ExtraStopWords []string `yaml:"extra_stop_words"`
+}
+
+// ChaosConfig injects faults into a share of requests, to test how
+// clients, proxies and dashboards cope with a failing server. It is meant
+// for test and staging instances only, which must say so with
+// NonProduction.
+type ChaosConfig struct {
+	Enabled              bool     `yaml:"enabled" env:"ASIAKIRJAT_CHAOS_ENABLED"`
+	NonProduction        bool     `yaml:"non_production" env:"ASIAKIRJAT_CHAOS_NON_PRODUCTION"`                 // Confirms that the instance is not production; required by Enabled
+	LatencyPercent       int      `yaml:"latency_percent" env:"ASIAKIRJAT_CHAOS_LATENCY_PERCENT"`               // Share of requests delayed
+	Latency              int      `yaml:"latency" env:"ASIAKIRJAT_CHAOS_LATENCY"`                               // Milliseconds a delayed request waits, at most
+	ErrorPercent         int      `yaml:"error_percent" env:"ASIAKIRJAT_CHAOS_ERROR_PERCENT"`                   // Share of requests answered with a 5xx status
+	DatabaseErrorPercent int      `yaml:"database_error_percent" env:"ASIAKIRJAT_CHAOS_DATABASE_ERROR_PERCENT"` // Share of requests whose database operations fail
+	Paths                []string `yaml:"paths"`                                                                // Path prefixes below the base path to inject faults into; empty for all
+}
+
+// DegradedConfig controls what is served while the database is unreachable.
+type DegradedConfig struct {
+	CheckInterval int  `yaml:"check_interval" env:"ASIAKIRJAT_DEGRADED_CHECK_INTERVAL"` // Seconds between database checks; 0 disables degraded mode
+	ServeDocs     bool `yaml:"serve_docs" env:"ASIAKIRJAT_DEGRADED_SERVE_DOCS"`         // Keep serving documentation anonymous readers can view, with a banner
+}
+
+// AnalyticsConfig controls the per-project view analytics shown to the
+// editors of each project.
+type AnalyticsConfig struct {
+	Enabled       bool `yaml:"enabled" env:"ASIAKIRJAT_ANALYTICS_ENABLED"`
+	SamplePercent int  `yaml:"sample_percent" env:"ASIAKIRJAT_ANALYTICS_SAMPLE_PERCENT"` // Share of page views recorded
+	RetentionDays int  `yaml:"retention_days" env:"ASIAKIRJAT_ANALYTICS_RETENTION_DAYS"` // Older views are deleted; 0 keeps them
+}
+
+// Sample returns the percentage of page views recorded, between 1 and 100.
+func (c AnalyticsConfig) Sample() int {
+	if c.SamplePercent <= 0 || c.SamplePercent > 100 {
+		return 100
+	}
+	return c.SamplePercent
+}
+
+// HistoryConfig controls the "Continue reading" list of the documentation
+// pages each logged-in user visited last.
+type HistoryConfig struct {
+	Enabled bool `yaml:"enabled" env:"ASIAKIRJAT_HISTORY_ENABLED"`
+	Size    int  `yaml:"size" env:"ASIAKIRJAT_HISTORY_SIZE"` // Pages kept per user
+}
+
+// maxHistorySize caps history.size.
+const maxHistorySize = 100
+
+// Pages returns the number of pages kept per user.
+func (c HistoryConfig) Pages() int {
+	if c.Size <= 0 {
+		return 10
+	}
+	return min(c.Size, maxHistorySize)
+}
+
+// OverlayConfig controls injection of the toolbar overlay into
+// documentation pages.
+type OverlayConfig struct {
+	MaxSize string `yaml:"max_size" env:"ASIAKIRJAT_OVERLAY_MAX_SIZE"` // Larger pages are served without the overlay
+}
+
+// MaxSizeBytes returns the size of the largest page the overlay is
+// injected into.
+func (c OverlayConfig) MaxSizeBytes() int64 {
+	return sizeOrDefault(c.MaxSize, 10<<20)
+}
+
+// ThumbnailsConfig controls the preview images shown on the project cards
+// of the front page.
+type ThumbnailsConfig struct {
+	Command string `yaml:"command" env:"ASIAKIRJAT_THUMBNAILS_COMMAND"` // Headless renderer; empty disables thumbnails
+	Timeout int    `yaml:"timeout" env:"ASIAKIRJAT_THUMBNAILS_TIMEOUT"` // Seconds per rendering
+}
+
+// ExportConfig controls the single-file HTML and PDF exports of versions.
+type ExportConfig struct {
+	PDFCommand string `yaml:"pdf_command" env:"ASIAKIRJAT_EXPORT_PDF_COMMAND"` // Headless renderer; empty disables PDF exports
+	Timeout    int    `yaml:"timeout" env:"ASIAKIRJAT_EXPORT_TIMEOUT"`         // Seconds per export
+	MaxSize    string `yaml:"max_size" env:"ASIAKIRJAT_EXPORT_MAX_SIZE"`       // Largest single-file export, e.g. "200MB"
+}
+
+// MaxSizeBytes returns the size limit of single-file exports.
+func (c ExportConfig) MaxSizeBytes() int64 {
+	return sizeOrDefault(c.MaxSize, 200<<20)
+}
+
+// AccessibilityConfig controls the automated accessibility checks of
+// uploaded documentation.
+type AccessibilityConfig struct {
+	CheckUploads bool `yaml:"check_uploads" env:"ASIAKIRJAT_ACCESSIBILITY_CHECK_UPLOADS"` // Check the HTML pages of each upload and keep a report per version
+}
+
+// OfflineConfig controls saving documentation versions in the browser for
+// reading without a network connection.
+type OfflineConfig struct {
+	Enabled bool   `yaml:"enabled" env:"ASIAKIRJAT_OFFLINE_ENABLED"`
+	MaxSize string `yaml:"max_size" env:"ASIAKIRJAT_OFFLINE_MAX_SIZE"` // Larger versions cannot be saved
+}
+
+// MaxSizeBytes returns the size of the largest version that can be saved.
+func (c OfflineConfig) MaxSizeBytes() int64 {
+	return sizeOrDefault(c.MaxSize, 200<<20)
+}
+
+// APIKeysConfig controls the anonymous read-only API keys.
+type APIKeysConfig struct {
+	DefaultQuota int `yaml:"default_quota" env:"ASIAKIRJAT_API_KEYS_DEFAULT_QUOTA"` // Requests per hour of keys without a quota of their own
+}
+
+// CompressionConfig controls brotli/gzip compression of text responses.
+type CompressionConfig struct {
+	Enabled bool   `yaml:"enabled" env:"ASIAKIRJAT_COMPRESSION_ENABLED"`
+	MinSize string `yaml:"min_size" env:"ASIAKIRJAT_COMPRESSION_MIN_SIZE"` // Smaller responses are sent uncompressed
+}
+
+// MinSizeBytes returns the size from which responses are compressed.
+func (c CompressionConfig) MinSizeBytes() int64 {
+	n, err := ParseSize(c.MinSize)
+	if err != nil {
+		return 1 << 10
+	}
+	return n
+}
+
+// CacheConfig controls HTTP caching of documentation files. Files whose
+// name carries a content hash, such as main.3f2a9c1b.js, are always cached
+// for a year.
+type CacheConfig struct {
+	HTMLMaxAge    int    `yaml:"html_max_age" env:"ASIAKIRJAT_CACHE_HTML_MAX_AGE"`       // Seconds; 0 revalidates on every view
+	AssetMaxAge   int    `yaml:"asset_max_age" env:"ASIAKIRJAT_CACHE_ASSET_MAX_AGE"`     // Seconds, for other files
+	MemorySize    string `yaml:"memory_size" env:"ASIAKIRJAT_CACHE_MEMORY_SIZE"`         // In-memory cache of small files; 0 disables
+	MemoryMaxFile string `yaml:"memory_max_file" env:"ASIAKIRJAT_CACHE_MEMORY_MAX_FILE"` // Largest file kept in memory
+	StoreTTL      int    `yaml:"store_ttl" env:"ASIAKIRJAT_CACHE_STORE_TTL"`             // Seconds projects, versions and access are cached; 0 disables
+}
+
+// MemorySizeBytes returns the size of the in-memory file cache, 0 if disabled.
+func (c CacheConfig) MemorySizeBytes() int64 {
+	n, _ := ParseSize(c.MemorySize)
+	return n
+}
+
+// MemoryMaxFileBytes returns the size of the largest file kept in memory.
+func (c CacheConfig) MemoryMaxFileBytes() int64 {
+	return sizeOrDefault(c.MemoryMaxFile, 256<<10)
+}
+
+// SEOConfig controls what robots.txt exposes to search engines and the
+// link previews of public pages.
+type SEOConfig struct {
+	DisallowOldVersions bool `yaml:"disallow_old_versions" env:"ASIAKIRJAT_SEO_DISALLOW_OLD_VERSIONS"` // Disallow all but the latest version of each project
+	SocialPreviews      bool `yaml:"social_previews" env:"ASIAKIRJAT_SEO_SOCIAL_PREVIEWS"`             // Add OpenGraph and Twitter card tags to pages anonymous readers can view
+}
+
+// EventsConfig configures publishing of the event feed to NATS. The feed is
+// always available from /api/events.
+type EventsConfig struct {
+	NATSURL     string `yaml:"nats_url" env:"ASIAKIRJAT_EVENTS_NATS_URL"`         // e.g. nats://nats:4222; empty disables publishing
+	NATSSubject string `yaml:"nats_subject" env:"ASIAKIRJAT_EVENTS_NATS_SUBJECT"` // Subject prefix; the event type is appended
+}
+
+// EmailConfig configures the SMTP server notification emails are sent
+// through. Email is off while SMTPHost is empty.
+type EmailConfig struct {
+	SMTPHost    string   `yaml:"smtp_host" env:"ASIAKIRJAT_EMAIL_SMTP_HOST"`
+	SMTPPort    int      `yaml:"smtp_port" env:"ASIAKIRJAT_EMAIL_SMTP_PORT"` // 0 for 587, or 465 with tls: tls
+	TLS         string   `yaml:"tls" env:"ASIAKIRJAT_EMAIL_TLS"`             // "starttls" (default), "tls" or "none"
+	Username    string   `yaml:"username" env:"ASIAKIRJAT_EMAIL_USERNAME"`   // Empty to send without authentication
+	Password    string   `yaml:"password" env:"ASIAKIRJAT_EMAIL_PASSWORD"`
+	From        string   `yaml:"from" env:"ASIAKIRJAT_EMAIL_FROM"` // Sender, e.g. "Docs <docs@example.com>"
+	AdminAlerts []string `yaml:"admin_alerts"`                     // Addresses alerted to failed jobs; empty for all admins with an email address
+}
+
+// WatchConfig configures how users are told about new versions of the
+// projects they watch. Email needs email to be configured; feeds are
+// always available.
+type WatchConfig struct {
+	Webhooks               bool `yaml:"webhooks" env:"ASIAKIRJAT_WATCH_WEBHOOKS"`                                 // Let users have new versions posted to a URL of theirs
+	WebhookPrivateNetworks bool `yaml:"webhook_private_networks" env:"ASIAKIRJAT_WATCH_WEBHOOK_PRIVATE_NETWORKS"` // Allow webhook URLs on loopback and private addresses
+}
+
+// UploadConfig limits upload and archive extraction sizes. Sizes accept a
+// plain byte count or a KB/MB/GB suffix (powers of 1024).
+type UploadConfig struct {
+	MaxSize          string `yaml:"max_size" env:"ASIAKIRJAT_UPLOAD_MAX_SIZE"`                     // Request body size
+	MaxFileSize      string `yaml:"max_file_size" env:"ASIAKIRJAT_UPLOAD_MAX_FILE_SIZE"`           // Per extracted file
+	MaxExtractedSize string `yaml:"max_extracted_size" env:"ASIAKIRJAT_UPLOAD_MAX_EXTRACTED_SIZE"` // All extracted files
+	MaxFiles         int    `yaml:"max_files" env:"ASIAKIRJAT_UPLOAD_MAX_FILES"`                   // Extracted file count
+	KeepSingleRoot   bool   `yaml:"keep_single_root" env:"ASIAKIRJAT_UPLOAD_KEEP_SINGLE_ROOT"`     // Don't flatten a single top-level directory
+	CheckLinks       bool   `yaml:"check_links" env:"ASIAKIRJAT_UPLOAD_CHECK_LINKS"`               // Report relative links to missing files
+}
+
+// MaxSizeBytes returns the maximum upload request size in bytes.
+func (u UploadConfig) MaxSizeBytes() int64 {
+	return sizeOrDefault(u.MaxSize, 100<<20)
+}
+
+// MaxFileSizeBytes returns the maximum size of a single extracted file.
+func (u UploadConfig) MaxFileSizeBytes() int64 {
+	return sizeOrDefault(u.MaxFileSize, 100<<20)
+}
+
+// MaxExtractedSizeBytes returns the maximum total size of an extracted archive.
+func (u UploadConfig) MaxExtractedSizeBytes() int64 {
+	return sizeOrDefault(u.MaxExtractedSize, 1<<30)
+}
+
+func sizeOrDefault(s string, def int64) int64 {
+	n, err := ParseSize(s)
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
+
+// ParseSize parses a byte size such as "512", "64KB", "100MB" or "1GB".
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// MaintenanceConfig holds cron expressions (five fields or @hourly/@daily/...)
+// for background maintenance tasks. An empty expression disables the
+// scheduled run; the task can still be started from the admin page.
+type MaintenanceConfig struct {
+	Retention      string `yaml:"retention" env:"ASIAKIRJAT_MAINTENANCE_RETENTION"`
+	SessionCleanup string `yaml:"session_cleanup" env:"ASIAKIRJAT_MAINTENANCE_SESSION_CLEANUP"`
+	IndexVerify    string `yaml:"index_verify" env:"ASIAKIRJAT_MAINTENANCE_INDEX_VERIFY"`
+	OwnerCheck     string `yaml:"owner_check" env:"ASIAKIRJAT_MAINTENANCE_OWNER_CHECK"`
+	AnalyticsPrune string `yaml:"analytics_prune" env:"ASIAKIRJAT_MAINTENANCE_ANALYTICS_PRUNE"`
+	BlobPrune      string `yaml:"blob_prune" env:"ASIAKIRJAT_MAINTENANCE_BLOB_PRUNE"`
+	PreviewCleanup string `yaml:"preview_cleanup" env:"ASIAKIRJAT_MAINTENANCE_PREVIEW_CLEANUP"`
+	StorageUsage   string `yaml:"storage_usage" env:"ASIAKIRJAT_MAINTENANCE_STORAGE_USAGE"`
+	StorageGC      string `yaml:"storage_gc" env:"ASIAKIRJAT_MAINTENANCE_STORAGE_GC"`
+	LDAPSync       string `yaml:"ldap_sync" env:"ASIAKIRJAT_MAINTENANCE_LDAP_SYNC"`       // Only with LDAP enabled
+	WatchDigest    string `yaml:"watch_digest" env:"ASIAKIRJAT_MAINTENANCE_WATCH_DIGEST"` // Only with email configured
+	// MaxParallelJobs is how many reindexes, retention runs and storage
+	// jobs may run at once
+	MaxParallelJobs int `yaml:"max_parallel_jobs" env:"ASIAKIRJAT_MAINTENANCE_MAX_PARALLEL_JOBS"`
 }
 
 type ProjectsConfig struct {
 	AutoCreate bool `yaml:"auto_create" env:"ASIAKIRJAT_PROJECTS_AUTO_CREATE"`
+	// Banner texts of deprecated and end-of-life projects and versions
+	// without a message of their own
+	DeprecatedBanner string `yaml:"deprecated_banner" env:"ASIAKIRJAT_PROJECTS_DEPRECATED_BANNER"`
+	EOLBanner        string `yaml:"eol_banner" env:"ASIAKIRJAT_PROJECTS_EOL_BANNER"`
 }
 
 type RetentionConfig struct {
-	NonSemverDays int `yaml:"nonsemver_days" env:"ASIAKIRJAT_RETENTION_NONSEMVER_DAYS"`
+	NonSemverDays int  `yaml:"nonsemver_days" env:"ASIAKIRJAT_RETENTION_NONSEMVER_DAYS"`
+	DryRun        bool `yaml:"dry_run" env:"ASIAKIRJAT_RETENTION_DRY_RUN"` // Log expired versions without deleting them
+	PreviewDays   int  `yaml:"preview_days" env:"ASIAKIRJAT_RETENTION_PREVIEW_DAYS"`
 }
 
 type BrandingConfig struct {
 	AppName   string `yaml:"app_name" env:"ASIAKIRJAT_BRANDING_APP_NAME"`     // Custom app name displayed in navbar
 	LogoURL   string `yaml:"logo_url" env:"ASIAKIRJAT_BRANDING_LOGO_URL"`     // URL or path to custom logo
 	CustomCSS string `yaml:"custom_css" env:"ASIAKIRJAT_BRANDING_CUSTOM_CSS"` // Path to custom CSS file
+
+	Announcement   string            `yaml:"announcement" env:"ASIAKIRJAT_BRANDING_ANNOUNCEMENT"` // Markdown banner at the top of every page; readers can dismiss it
+	FooterHTML     string            `yaml:"footer_html" env:"ASIAKIRJAT_BRANDING_FOOTER_HTML"`   // HTML added to the footer of every page
+	ProjectHeaders map[string]string `yaml:"project_headers"`                                     // HTML shown at the top of a project's page, by project slug
 }
 
 type ServerConfig struct {
-	Address         string `yaml:"address" env:"ASIAKIRJAT_SERVER_ADDRESS"`
-	Port            int    `yaml:"port" env:"ASIAKIRJAT_SERVER_PORT"`
-	BasePath        string `yaml:"base_path" env:"ASIAKIRJAT_SERVER_BASE_PATH"`
-	ProxyStripPath  bool   `yaml:"proxy_strip_path" env:"ASIAKIRJAT_SERVER_PROXY_STRIP_PATH"`
-	LogLevel        string `yaml:"log_level" env:"ASIAKIRJAT_LOG_LEVEL"`
+	Address        string `yaml:"address" env:"ASIAKIRJAT_SERVER_ADDRESS"`
+	Port           int    `yaml:"port" env:"ASIAKIRJAT_SERVER_PORT"`
+	BasePath       string `yaml:"base_path" env:"ASIAKIRJAT_SERVER_BASE_PATH"`
+	ProxyStripPath bool   `yaml:"proxy_strip_path" env:"ASIAKIRJAT_SERVER_PROXY_STRIP_PATH"`
+	PublicURL      string `yaml:"public_url" env:"ASIAKIRJAT_SERVER_PUBLIC_URL"` // External URL incl. base path, for absolute links; derived from requests if empty
+	LogLevel       string `yaml:"log_level" env:"ASIAKIRJAT_LOG_LEVEL"`
+	LogFormat      string `yaml:"log_format" env:"ASIAKIRJAT_LOG_FORMAT"` // text or json
+	// Seconds to wait for running requests and background jobs on shutdown
+	ShutdownTimeout int `yaml:"shutdown_timeout" env:"ASIAKIRJAT_SERVER_SHUTDOWN_TIMEOUT"`
+
+	// Connection limits; timeouts are in seconds, 0 disables them
+	ReadHeaderTimeout int    `yaml:"read_header_timeout" env:"ASIAKIRJAT_SERVER_READ_HEADER_TIMEOUT"`
+	ReadTimeout       int    `yaml:"read_timeout" env:"ASIAKIRJAT_SERVER_READ_TIMEOUT"`   // Whole request incl. upload body
+	WriteTimeout      int    `yaml:"write_timeout" env:"ASIAKIRJAT_SERVER_WRITE_TIMEOUT"` // Whole response incl. ZIP downloads
+	IdleTimeout       int    `yaml:"idle_timeout" env:"ASIAKIRJAT_SERVER_IDLE_TIMEOUT"`   // Between requests on a kept-alive connection
+	MaxHeaderSize     string `yaml:"max_header_size" env:"ASIAKIRJAT_SERVER_MAX_HEADER_SIZE"`
+	KeepAlive         bool   `yaml:"keep_alive" env:"ASIAKIRJAT_SERVER_KEEP_ALIVE"`
+	HTTP2             bool   `yaml:"http2" env:"ASIAKIRJAT_SERVER_HTTP2"` // Accept unencrypted HTTP/2 (h2c), e.g. from a reverse proxy
+}
+
+// MaxHeaderBytes returns the largest accepted size of request headers.
+func (s ServerConfig) MaxHeaderBytes() int {
+	return int(sizeOrDefault(s.MaxHeaderSize, 1<<20))
 }
 
 type DatabaseConfig struct {
 	Driver string `yaml:"driver" env:"ASIAKIRJAT_DB_DRIVER"`
 	DSN    string `yaml:"dsn" env:"ASIAKIRJAT_DB_DSN"`
+	// Connection pool limits; 0 keeps the defaults of database/sql
+	MaxOpenConns    int `yaml:"max_open_conns" env:"ASIAKIRJAT_DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int `yaml:"max_idle_conns" env:"ASIAKIRJAT_DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime int `yaml:"conn_max_lifetime" env:"ASIAKIRJAT_DB_CONN_MAX_LIFETIME"` // Seconds
 }
 
 type AuthConfig struct {
@@ -53,6 +401,8 @@ type AuthConfig struct {
 	Session      SessionConfig      `yaml:"session"`
 	LDAP         LDAPConfig         `yaml:"ldap"`
 	OAuth2       OAuth2Config       `yaml:"oauth2"`
+	Proxy        ProxyAuthConfig    `yaml:"proxy"`
+	SCIM         SCIMConfig         `yaml:"scim"`
 }
 
 type InitialAdminConfig struct {
@@ -61,9 +411,12 @@ type InitialAdminConfig struct {
 }
 
 type SessionConfig struct {
-	CookieName string `yaml:"cookie_name" env:"ASIAKIRJAT_SESSION_COOKIE_NAME"`
-	MaxAge     int    `yaml:"max_age" env:"ASIAKIRJAT_SESSION_MAX_AGE"`
-	Secure     bool   `yaml:"secure" env:"ASIAKIRJAT_SESSION_SECURE"`
+	CookieName     string `yaml:"cookie_name" env:"ASIAKIRJAT_SESSION_COOKIE_NAME"`
+	MaxAge         int    `yaml:"max_age" env:"ASIAKIRJAT_SESSION_MAX_AGE"`                   // Seconds a session lasts at most
+	IdleTimeout    int    `yaml:"idle_timeout" env:"ASIAKIRJAT_SESSION_IDLE_TIMEOUT"`         // Seconds a session may go unused; 0 disables
+	Sliding        bool   `yaml:"sliding" env:"ASIAKIRJAT_SESSION_SLIDING"`                   // Extend sessions to max_age on activity
+	RememberMaxAge int    `yaml:"remember_max_age" env:"ASIAKIRJAT_SESSION_REMEMBER_MAX_AGE"` // Seconds "remember me" keeps a browser logged in; 0 disables
+	Secure         bool   `yaml:"secure" env:"ASIAKIRJAT_SESSION_SECURE"`
 }
 
 type LDAPConfig struct {
@@ -96,6 +449,35 @@ type OAuth2Config struct {
 	EditorGroup   string             `yaml:"editor_group" env:"ASIAKIRJAT_OAUTH2_EDITOR_GROUP"`
 	ViewerGroup   string             `yaml:"viewer_group" env:"ASIAKIRJAT_OAUTH2_VIEWER_GROUP"`
 	ProjectGroups []AuthGroupMapping `yaml:"project_groups"`
+	// GroupsURL is an endpoint listing the user's groups, read with their
+	// access token, e.g. the Keycloak account API
+	GroupsURL       string `yaml:"groups_url" env:"ASIAKIRJAT_OAUTH2_GROUPS_URL"`
+	RecursiveGroups bool   `yaml:"recursive_groups" env:"ASIAKIRJAT_OAUTH2_RECURSIVE_GROUPS"` // Add the parent groups of groups given as paths
+	GroupPrefix     string `yaml:"group_prefix" env:"ASIAKIRJAT_OAUTH2_GROUP_PREFIX"`         // Only groups starting with it are used for project and global access
+}
+
+// ProxyAuthConfig configures login by a trusted reverse proxy, such as
+// oauth2-proxy or Authelia, that sends the user name in a request header.
+type ProxyAuthConfig struct {
+	Enabled        bool               `yaml:"enabled" env:"ASIAKIRJAT_PROXY_AUTH_ENABLED"`
+	TrustedProxies []string           `yaml:"trusted_proxies"` // IP addresses or CIDR ranges the headers are accepted from
+	UserHeader     string             `yaml:"user_header" env:"ASIAKIRJAT_PROXY_AUTH_USER_HEADER"`
+	EmailHeader    string             `yaml:"email_header" env:"ASIAKIRJAT_PROXY_AUTH_EMAIL_HEADER"`
+	GroupsHeader   string             `yaml:"groups_header" env:"ASIAKIRJAT_PROXY_AUTH_GROUPS_HEADER"` // Comma-separated groups; empty ignores groups
+	AdminGroup     string             `yaml:"admin_group" env:"ASIAKIRJAT_PROXY_AUTH_ADMIN_GROUP"`
+	EditorGroup    string             `yaml:"editor_group" env:"ASIAKIRJAT_PROXY_AUTH_EDITOR_GROUP"`
+	ViewerGroup    string             `yaml:"viewer_group" env:"ASIAKIRJAT_PROXY_AUTH_VIEWER_GROUP"`
+	LogoutURL      string             `yaml:"logout_url" env:"ASIAKIRJAT_PROXY_AUTH_LOGOUT_URL"` // The proxy's logout page
+	ProjectGroups  []AuthGroupMapping `yaml:"project_groups"`
+}
+
+// SCIMConfig configures provisioning by an identity provider over SCIM
+// 2.0. The provider authenticates with an API token of an admin that has
+// the scim scope. Provisioned users log in through LDAP, OAuth2 or a proxy.
+type SCIMConfig struct {
+	Enabled       bool               `yaml:"enabled" env:"ASIAKIRJAT_SCIM_ENABLED"`
+	DefaultRole   string             `yaml:"default_role" env:"ASIAKIRJAT_SCIM_DEFAULT_ROLE"` // Role of the users it creates: viewer, editor or admin
+	ProjectGroups []AuthGroupMapping `yaml:"project_groups"`
 }
 
 // AuthGroupMapping represents a mapping from an auth group to project access
@@ -107,11 +489,29 @@ type AuthGroupMapping struct {
 
 type StorageConfig struct {
 	BasePath string `yaml:"base_path" env:"ASIAKIRJAT_STORAGE_PATH"`
+	// Deduplicate stores files shared by versions once, as hard links
+	Deduplicate bool `yaml:"deduplicate" env:"ASIAKIRJAT_STORAGE_DEDUPLICATE"`
+	// Quota bounds the size of all versions together, and ProjectQuota
+	// that of each project without a quota of its own. Empty is unlimited.
+	Quota        string `yaml:"quota" env:"ASIAKIRJAT_STORAGE_QUOTA"`
+	ProjectQuota string `yaml:"project_quota" env:"ASIAKIRJAT_STORAGE_PROJECT_QUOTA"`
+}
+
+// QuotaBytes returns the global storage quota in bytes, or 0 for none.
+func (s StorageConfig) QuotaBytes() int64 {
+	return sizeOrDefault(s.Quota, 0)
+}
+
+// ProjectQuotaBytes returns the default project quota in bytes, or 0 for
+// none.
+func (s StorageConfig) ProjectQuotaBytes() int64 {
+	return sizeOrDefault(s.ProjectQuota, 0)
 }
 
 // AccessConfig controls global access rules for "private" visibility projects.
 type AccessConfig struct {
-	Private PrivateAccessConfig `yaml:"private"`
+	AllowAnonymous bool                `yaml:"allow_anonymous" env:"ASIAKIRJAT_ALLOW_ANONYMOUS"` // false requires a login for every page, public projects included
+	Private        PrivateAccessConfig `yaml:"private"`
 }
 
 // PrivateAccessConfig defines who can access private-visibility projects.
@@ -125,32 +525,133 @@ type AccessRuleConfig struct {
 	Users        []string `yaml:"users"`
 	LDAPGroups   []string `yaml:"ldap_groups"`
 	OAuth2Groups []string `yaml:"oauth2_groups"`
+	ProxyGroups  []string `yaml:"proxy_groups"`
+	SCIMGroups   []string `yaml:"scim_groups"`
 }
 
 func Defaults() Config {
 	return Config{
 		Server: ServerConfig{
-			Address: "0.0.0.0",
-			Port:    8080,
+			Address:           "0.0.0.0",
+			Port:              8080,
+			ShutdownTimeout:   30,
+			ReadHeaderTimeout: 10,
+			ReadTimeout:       300,
+			WriteTimeout:      300,
+			IdleTimeout:       120,
+			MaxHeaderSize:     "1MB",
+			KeepAlive:         true,
 		},
 		Database: DatabaseConfig{
 			Driver: "sqlite",
 			DSN:    "data/asiakirjat.db",
 		},
+		Access: AccessConfig{
+			AllowAnonymous: true,
+		},
 		Auth: AuthConfig{
 			InitialAdmin: InitialAdminConfig{
 				Username: "admin",
 				Password: "admin",
 			},
 			Session: SessionConfig{
-				CookieName: "asiakirjat_session",
-				MaxAge:     86400,
-				Secure:     false,
+				CookieName:     "asiakirjat_session",
+				MaxAge:         86400,
+				RememberMaxAge: 2592000,
+				Secure:         false,
+			},
+			Proxy: ProxyAuthConfig{
+				UserHeader: "Remote-User",
+			},
+			SCIM: SCIMConfig{
+				DefaultRole: "viewer",
 			},
 		},
 		Storage: StorageConfig{
 			BasePath: "data/projects",
 		},
+		Retention: RetentionConfig{
+			PreviewDays: 14,
+		},
+		Maintenance: MaintenanceConfig{
+			Retention:       "0 * * * *",
+			SessionCleanup:  "30 * * * *",
+			IndexVerify:     "0 3 * * *",
+			OwnerCheck:      "0 4 * * *",
+			AnalyticsPrune:  "30 4 * * *",
+			BlobPrune:       "0 5 * * *",
+			PreviewCleanup:  "45 * * * *",
+			StorageUsage:    "15 5 * * *",
+			LDAPSync:        "*/30 * * * *",
+			WatchDigest:     "0 7 * * *",
+			MaxParallelJobs: 2,
+		},
+		Upload: UploadConfig{
+			MaxSize:          "100MB",
+			MaxFileSize:      "100MB",
+			MaxExtractedSize: "1GB",
+			MaxFiles:         10000,
+			CheckLinks:       true,
+		},
+		Events: EventsConfig{
+			NATSSubject: "asiakirjat",
+		},
+		Watch: WatchConfig{
+			Webhooks: true,
+		},
+		Projects: ProjectsConfig{
+			DeprecatedBanner: "This documentation is deprecated.",
+			EOLBanner:        "This documentation has reached end of life and is no longer maintained.",
+		},
+		Cache: CacheConfig{
+			HTMLMaxAge:    60,
+			AssetMaxAge:   3600,
+			MemorySize:    "64MB",
+			MemoryMaxFile: "256KB",
+			StoreTTL:      10,
+		},
+		Compression: CompressionConfig{
+			Enabled: true,
+			MinSize: "1KB",
+		},
+		APIKeys: APIKeysConfig{
+			DefaultQuota: 1000,
+		},
+		Offline: OfflineConfig{
+			MaxSize: "200MB",
+		},
+		Thumbnails: ThumbnailsConfig{
+			Timeout: 30,
+		},
+		Export: ExportConfig{
+			Timeout: 120,
+			MaxSize: "200MB",
+		},
+		Overlay: OverlayConfig{
+			MaxSize: "10MB",
+		},
+		SEO: SEOConfig{
+			SocialPreviews: true,
+		},
+		History: HistoryConfig{
+			Size: 10,
+		},
+		Degraded: DegradedConfig{
+			CheckInterval: 10,
+			ServeDocs:     true,
+		},
+		Search: SearchConfig{
+			IndexPath: "data/search-index",
+			Stemming:  true,
+			StopWords: true,
+		},
+		Analytics: AnalyticsConfig{
+			SamplePercent: 100,
+			RetentionDays: 90,
+		},
+		Chaos: ChaosConfig{
+			Latency: 2000,
+		},
 	}
 }
 
@@ -173,6 +674,31 @@ func Load(path string) (*Config, error) {
 
 	applyEnvOverrides(&cfg)
 
+	for name, size := range map[string]string{
+		"upload.max_size":           cfg.Upload.MaxSize,
+		"upload.max_file_size":      cfg.Upload.MaxFileSize,
+		"upload.max_extracted_size": cfg.Upload.MaxExtractedSize,
+		"cache.memory_size":         cfg.Cache.MemorySize,
+		"cache.memory_max_file":     cfg.Cache.MemoryMaxFile,
+		"compression.min_size":      cfg.Compression.MinSize,
+		"offline.max_size":          cfg.Offline.MaxSize,
+		"server.max_header_size":    cfg.Server.MaxHeaderSize,
+		"overlay.max_size":          cfg.Overlay.MaxSize,
+		"storage.quota":             cfg.Storage.Quota,
+		"storage.project_quota":     cfg.Storage.ProjectQuota,
+	} {
+		if size == "" {
+			continue
+		}
+		if _, err := ParseSize(size); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if err := cfg.Chaos.validate(); err != nil {
+		return nil, err
+	}
+
 	// Normalize base_path: must start with / if non-empty, must not end with /
 	if cfg.Server.BasePath != "" {
 		cfg.Server.BasePath = strings.TrimSuffix(cfg.Server.BasePath, "/")
@@ -184,6 +710,27 @@ func Load(path string) (*Config, error) {
 	return &cfg, nil
 }
 
+// validate checks the shares of requests, and refuses to inject faults
+// into an instance not confirmed to be non-production.
+func (c ChaosConfig) validate() error {
+	for name, percent := range map[string]int{
+		"chaos.latency_percent":        c.LatencyPercent,
+		"chaos.error_percent":          c.ErrorPercent,
+		"chaos.database_error_percent": c.DatabaseErrorPercent,
+	} {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("%s: must be between 0 and 100, got %d", name, percent)
+		}
+	}
+	if c.Latency < 0 {
+		return fmt.Errorf("chaos.latency: must not be negative, got %d", c.Latency)
+	}
+	if c.Enabled && !c.NonProduction {
+		return errors.New("chaos.enabled: chaos testing fails real requests; set chaos.non_production on test and staging instances to confirm")
+	}
+	return nil
+}
+
 func applyEnvOverrides(cfg *Config) {
 	applyEnvToStruct(reflect.ValueOf(cfg).Elem())
 }
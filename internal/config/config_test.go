@@ -23,6 +23,9 @@ func TestDefaults(t *testing.T) {
 	if cfg.Auth.Session.CookieName != "asiakirjat_session" {
 		t.Errorf("expected default cookie name, got %s", cfg.Auth.Session.CookieName)
 	}
+	if !cfg.Access.AllowAnonymous {
+		t.Error("expected anonymous access to be allowed by default")
+	}
 }
 
 func TestLoadYAML(t *testing.T) {
@@ -129,3 +132,130 @@ func TestListenAddr(t *testing.T) {
 		t.Errorf("expected 0.0.0.0:8080, got %s", cfg.ListenAddr())
 	}
 }
+
+func TestMaintenanceDefaults(t *testing.T) {
+	cfg := Defaults()
+	if cfg.Maintenance.Retention != "0 * * * *" {
+		t.Errorf("expected hourly retention schedule, got %q", cfg.Maintenance.Retention)
+	}
+	if cfg.Maintenance.SessionCleanup == "" || cfg.Maintenance.IndexVerify == "" {
+		t.Error("expected session cleanup and index verify schedules by default")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"512":    512,
+		"64KB":   64 << 10,
+		"100MB":  100 << 20,
+		"100 mb": 100 << 20,
+		"1GB":    1 << 30,
+	}
+	for input, want := range tests {
+		got, err := ParseSize(input)
+		if err != nil {
+			t.Errorf("ParseSize(%q): %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseSize(%q) = %d, want %d", input, got, want)
+		}
+	}
+
+	for _, input := range []string{"", "MB", "-1MB", "10TB"} {
+		if _, err := ParseSize(input); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
+func TestUploadSizeEnvOverride(t *testing.T) {
+	t.Setenv("ASIAKIRJAT_UPLOAD_MAX_SIZE", "250MB")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Upload.MaxSizeBytes() != 250<<20 {
+		t.Errorf("expected 250MB max size, got %d", cfg.Upload.MaxSizeBytes())
+	}
+
+	t.Setenv("ASIAKIRJAT_UPLOAD_MAX_SIZE", "lots")
+	if _, err := Load(""); err == nil {
+		t.Error("expected error for invalid upload.max_size")
+	}
+}
+
+func TestServerConnectionSettings(t *testing.T) {
+	cfg := Defaults()
+	if cfg.Server.ReadHeaderTimeout <= 0 || cfg.Server.IdleTimeout <= 0 {
+		t.Error("expected header read and idle timeouts by default")
+	}
+	if !cfg.Server.KeepAlive || cfg.Server.HTTP2 {
+		t.Error("expected keep-alive on and h2c off by default")
+	}
+	if cfg.Server.MaxHeaderBytes() != 1<<20 {
+		t.Errorf("expected 1MB max header size, got %d", cfg.Server.MaxHeaderBytes())
+	}
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	yaml := `
+server:
+  read_timeout: 0
+  max_header_size: 64KB
+  keep_alive: false
+  http2: true
+`
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ASIAKIRJAT_SERVER_WRITE_TIMEOUT", "600")
+
+	loaded, err := Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Server.ReadTimeout != 0 || loaded.Server.WriteTimeout != 600 {
+		t.Errorf("expected read timeout 0 and write timeout 600, got %d and %d", loaded.Server.ReadTimeout, loaded.Server.WriteTimeout)
+	}
+	if loaded.Server.MaxHeaderBytes() != 64<<10 || loaded.Server.KeepAlive || !loaded.Server.HTTP2 {
+		t.Errorf("unexpected server settings %+v", loaded.Server)
+	}
+	if loaded.Server.ReadHeaderTimeout != 10 {
+		t.Errorf("expected the default header timeout to be kept, got %d", loaded.Server.ReadHeaderTimeout)
+	}
+
+	t.Setenv("ASIAKIRJAT_SERVER_MAX_HEADER_SIZE", "huge")
+	if _, err := Load(""); err == nil {
+		t.Error("expected error for invalid server.max_header_size")
+	}
+}
+
+func TestChaosSettings(t *testing.T) {
+	t.Setenv("ASIAKIRJAT_CHAOS_ENABLED", "true")
+	t.Setenv("ASIAKIRJAT_CHAOS_ERROR_PERCENT", "5")
+	if _, err := Load(""); err == nil {
+		t.Error("expected chaos testing to be refused without chaos.non_production")
+	}
+
+	t.Setenv("ASIAKIRJAT_CHAOS_NON_PRODUCTION", "true")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Chaos.Enabled || cfg.Chaos.ErrorPercent != 5 {
+		t.Errorf("unexpected chaos settings %+v", cfg.Chaos)
+	}
+
+	for _, env := range []string{"ASIAKIRJAT_CHAOS_LATENCY_PERCENT", "ASIAKIRJAT_CHAOS_ERROR_PERCENT", "ASIAKIRJAT_CHAOS_DATABASE_ERROR_PERCENT"} {
+		for _, value := range []string{"-1", "101"} {
+			t.Run(env+"="+value, func(t *testing.T) {
+				t.Setenv(env, value)
+				if _, err := Load(""); err == nil {
+					t.Errorf("expected %s=%s to be refused", env, value)
+				}
+			})
+		}
+	}
+}
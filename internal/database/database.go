@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -30,7 +31,31 @@ func DetectDialect(driver string) Dialect {
 	}
 }
 
-func Open(driver, dsn string) (*sqlx.DB, Dialect, error) {
+// Pool limits the connections a database handle keeps. Zero values keep
+// the defaults of database/sql.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+func (p Pool) apply(db *sqlx.DB) {
+	if p.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+}
+
+func Open(driver, dsn string, pool Pool) (*sqlx.DB, Dialect, error) {
+	return open(driver, dsn, pool, false)
+}
+
+func open(driver, dsn string, pool Pool, faults bool) (*sqlx.DB, Dialect, error) {
 	dialect := DetectDialect(driver)
 
 	var driverName string
@@ -47,10 +72,17 @@ func Open(driver, dsn string) (*sqlx.DB, Dialect, error) {
 
 	slog.Info("opening database", "driver", driverName, "dialect", dialect)
 
-	db, err := sqlx.Open(driverName, dsn)
+	var db *sqlx.DB
+	var err error
+	if faults {
+		db, err = openFaultDB(driverName, dsn)
+	} else {
+		db, err = sqlx.Open(driverName, dsn)
+	}
 	if err != nil {
 		return nil, "", fmt.Errorf("opening database: %w", err)
 	}
+	pool.apply(db)
 
 	if err := db.Ping(); err != nil {
 		db.Close()
@@ -1,7 +1,10 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 )
 
 func TestDetectDialect(t *testing.T) {
@@ -32,7 +35,7 @@ func TestDetectDialect(t *testing.T) {
 }
 
 func TestOpenSQLite(t *testing.T) {
-	db, dialect, err := Open("sqlite", ":memory:")
+	db, dialect, err := Open("sqlite", ":memory:", Pool{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -52,8 +55,20 @@ func TestOpenSQLite(t *testing.T) {
 	}
 }
 
+func TestOpenPool(t *testing.T) {
+	db, _, err := Open("sqlite", ":memory:", Pool{MaxOpenConns: 3, MaxIdleConns: 2, ConnMaxLifetime: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if got := db.Stats().MaxOpenConnections; got != 3 {
+		t.Errorf("expected at most 3 open connections, got %d", got)
+	}
+}
+
 func TestMigrations(t *testing.T) {
-	db, _, err := Open("sqlite", ":memory:")
+	db, _, err := Open("sqlite", ":memory:", Pool{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -76,3 +91,27 @@ func TestMigrations(t *testing.T) {
 		}
 	}
 }
+
+func TestOpenWithFaults(t *testing.T) {
+	db, _, err := OpenWithFaults("sqlite", ":memory:", Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var result int
+	if err := db.GetContext(context.Background(), &result, "SELECT 1"); err != nil || result != 1 {
+		t.Fatalf("expected queries to pass through, got %d %v", result, err)
+	}
+
+	ctx := WithInjectedFault(context.Background())
+	if err := db.GetContext(ctx, &result, "SELECT 1"); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("expected the query to fail, got %v", err)
+	}
+	if _, err := db.ExecContext(ctx, "CREATE TABLE t (id INTEGER)"); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("expected the statement to fail, got %v", err)
+	}
+	if _, err := db.BeginTxx(ctx, nil); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("expected the transaction to fail, got %v", err)
+	}
+}
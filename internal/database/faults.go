@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrInjectedFault is the error of database operations run with a context
+// from WithInjectedFault, on a database opened by OpenWithFaults.
+var ErrInjectedFault = errors.New("injected database fault")
+
+type injectedFaultKey struct{}
+
+// WithInjectedFault returns a context that makes the queries, statements
+// and transactions run with it fail with ErrInjectedFault, for testing how
+// the server copes with database errors.
+func WithInjectedFault(ctx context.Context) context.Context {
+	return context.WithValue(ctx, injectedFaultKey{}, true)
+}
+
+func injectedFault(ctx context.Context) error {
+	if ctx.Value(injectedFaultKey{}) != nil {
+		return ErrInjectedFault
+	}
+	return nil
+}
+
+// OpenWithFaults opens the database like Open, but lets contexts from
+// WithInjectedFault make its operations fail.
+func OpenWithFaults(driver, dsn string, pool Pool) (*sqlx.DB, Dialect, error) {
+	return open(driver, dsn, pool, true)
+}
+
+// faultConnector opens connections of a driver wrapped in faultConn.
+type faultConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c faultConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return faultConn{conn}, nil
+}
+
+func (c faultConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func openFaultDB(driverName, dsn string) (*sqlx.DB, error) {
+	// The driver is only reachable through a handle; sql.Open does not
+	// connect.
+	probe, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := probe.Driver()
+	probe.Close()
+	return sqlx.NewDb(sql.OpenDB(faultConnector{dsn: dsn, driver: drv}), driverName), nil
+}
+
+// faultConn passes everything through to the driver's connection, failing
+// the operations whose context asks for a fault. Optional interfaces the
+// connection lacks are reported as driver.ErrSkip, so database/sql falls
+// back as it would without the wrapper.
+type faultConn struct {
+	driver.Conn
+}
+
+func (c faultConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := injectedFault(ctx); err != nil {
+		return nil, err
+	}
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c faultConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := injectedFault(ctx); err != nil {
+		return nil, err
+	}
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c faultConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := injectedFault(ctx); err != nil {
+		return nil, err
+	}
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c faultConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := injectedFault(ctx); err != nil {
+		return nil, err
+	}
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c faultConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c faultConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c faultConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c faultConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
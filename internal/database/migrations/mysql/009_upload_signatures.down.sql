@@ -0,0 +1,4 @@
+ALTER TABLE versions DROP COLUMN signature_key;
+ALTER TABLE versions DROP COLUMN signature_status;
+ALTER TABLE projects DROP COLUMN signing_keys;
+ALTER TABLE projects DROP COLUMN require_signature;
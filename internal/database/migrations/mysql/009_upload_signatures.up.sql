@@ -0,0 +1,5 @@
+ALTER TABLE projects ADD COLUMN require_signature BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE projects ADD COLUMN signing_keys TEXT;
+UPDATE projects SET signing_keys = '';
+ALTER TABLE versions ADD COLUMN signature_status VARCHAR(20) NOT NULL DEFAULT 'unsigned';
+ALTER TABLE versions ADD COLUMN signature_key VARCHAR(255) NOT NULL DEFAULT '';
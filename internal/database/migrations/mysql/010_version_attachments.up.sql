@@ -0,0 +1,11 @@
+CREATE TABLE version_attachments (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    version_id INTEGER NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    sha256 VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY (version_id, kind),
+    FOREIGN KEY (version_id) REFERENCES versions(id) ON DELETE CASCADE
+);
@@ -0,0 +1,8 @@
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    action VARCHAR(100) NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    details TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_audit_log_created_at (created_at)
+);
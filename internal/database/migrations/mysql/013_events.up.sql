@@ -0,0 +1,7 @@
+CREATE TABLE events (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    type VARCHAR(100) NOT NULL,
+    project VARCHAR(128) NOT NULL DEFAULT '',
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
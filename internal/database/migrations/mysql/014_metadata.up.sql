@@ -0,0 +1,14 @@
+CREATE TABLE project_metadata (
+    project_id INTEGER NOT NULL,
+    meta_key VARCHAR(64) NOT NULL,
+    meta_value VARCHAR(512) NOT NULL DEFAULT '',
+    PRIMARY KEY (project_id, meta_key),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
+CREATE TABLE version_metadata (
+    version_id INTEGER NOT NULL,
+    meta_key VARCHAR(64) NOT NULL,
+    meta_value VARCHAR(512) NOT NULL DEFAULT '',
+    PRIMARY KEY (version_id, meta_key),
+    FOREIGN KEY (version_id) REFERENCES versions(id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE projects DROP COLUMN index_old_versions;
@@ -0,0 +1,4 @@
+ALTER TABLE projects DROP COLUMN owner_orphaned;
+ALTER TABLE projects DROP COLUMN owner_contact;
+ALTER TABLE projects DROP COLUMN owner_team;
+ALTER TABLE projects DROP COLUMN owner;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS feedback;
+ALTER TABLE projects DROP COLUMN feedback_url;
+ALTER TABLE projects DROP COLUMN feedback_mode;
@@ -0,0 +1,14 @@
+ALTER TABLE projects ADD COLUMN feedback_mode VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN feedback_url VARCHAR(1024) NOT NULL DEFAULT '';
+CREATE TABLE feedback (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    project_id INTEGER NOT NULL,
+    version_tag VARCHAR(255) NOT NULL DEFAULT '',
+    page_url VARCHAR(2048) NOT NULL DEFAULT '',
+    selection TEXT NOT NULL,
+    message TEXT NOT NULL,
+    author VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_feedback_project_id (project_id),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE projects DROP COLUMN overlay_exclude;
+ALTER TABLE projects DROP COLUMN overlay_include;
@@ -0,0 +1,2 @@
+ALTER TABLE projects ADD COLUMN overlay_include VARCHAR(4096) NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN overlay_exclude VARCHAR(4096) NOT NULL DEFAULT '';
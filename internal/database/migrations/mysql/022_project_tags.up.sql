@@ -0,0 +1,7 @@
+CREATE TABLE project_tags (
+    project_id INTEGER NOT NULL,
+    tag VARCHAR(32) NOT NULL,
+    PRIMARY KEY (project_id, tag),
+    INDEX idx_project_tags_tag (tag),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
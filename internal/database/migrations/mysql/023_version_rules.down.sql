@@ -0,0 +1,3 @@
+ALTER TABLE projects DROP COLUMN normalize_versions;
+ALTER TABLE projects DROP COLUMN version_semver_only;
+ALTER TABLE projects DROP COLUMN version_pattern;
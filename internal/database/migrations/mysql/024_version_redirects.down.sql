@@ -0,0 +1 @@
+DROP TABLE version_redirects;
@@ -0,0 +1,8 @@
+CREATE TABLE version_redirects (
+    project_id INTEGER NOT NULL,
+    old_tag VARCHAR(255) NOT NULL,
+    new_tag VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, old_tag),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
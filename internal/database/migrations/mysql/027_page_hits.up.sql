@@ -0,0 +1,13 @@
+CREATE TABLE page_hits (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    project_id INTEGER NOT NULL,
+    version VARCHAR(255) NOT NULL,
+    path VARCHAR(768) NOT NULL DEFAULT '',
+    user_id INTEGER NULL,
+    status INTEGER NOT NULL DEFAULT 200,
+    viewed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_page_hits_project (project_id, viewed_at),
+    INDEX idx_page_hits_viewed_at (viewed_at),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,8 @@
+CREATE TABLE project_translations (
+    project_id INTEGER NOT NULL,
+    locale VARCHAR(35) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    description TEXT NOT NULL,
+    PRIMARY KEY (project_id, locale),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
@@ -0,0 +1,11 @@
+CREATE TABLE feature_flags (
+    name VARCHAR(64) NOT NULL PRIMARY KEY,
+    enabled BOOLEAN NOT NULL
+);
+CREATE TABLE project_feature_flags (
+    project_id BIGINT NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (project_id, name),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE versions ADD COLUMN release_notes TEXT NOT NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE previews (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    project_id INTEGER NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    content_type VARCHAR(16) NOT NULL DEFAULT 'archive',
+    uploaded_by INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    UNIQUE (project_id, name),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
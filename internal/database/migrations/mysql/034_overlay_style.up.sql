@@ -0,0 +1,4 @@
+ALTER TABLE projects ADD COLUMN overlay_position VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN overlay_theme VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN overlay_color VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN overlay_visibility VARCHAR(16) NOT NULL DEFAULT '';
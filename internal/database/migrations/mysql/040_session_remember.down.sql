@@ -0,0 +1,3 @@
+DROP INDEX idx_sessions_remember_hash ON sessions;
+ALTER TABLE sessions DROP COLUMN remember_until;
+ALTER TABLE sessions DROP COLUMN remember_hash;
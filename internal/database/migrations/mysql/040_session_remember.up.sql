@@ -0,0 +1,3 @@
+ALTER TABLE sessions ADD COLUMN remember_hash VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN remember_until TIMESTAMP NULL;
+CREATE INDEX idx_sessions_remember_hash ON sessions(remember_hash);
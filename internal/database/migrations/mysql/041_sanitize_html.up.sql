@@ -0,0 +1 @@
+ALTER TABLE projects ADD COLUMN sanitize_html BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+ALTER TABLE projects DROP COLUMN max_upload_size;
+ALTER TABLE projects DROP COLUMN storage_quota;
+ALTER TABLE versions DROP COLUMN size_bytes;
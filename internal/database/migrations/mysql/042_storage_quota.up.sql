@@ -0,0 +1,3 @@
+ALTER TABLE versions ADD COLUMN size_bytes BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE projects ADD COLUMN storage_quota BIGINT NULL;
+ALTER TABLE projects ADD COLUMN max_upload_size BIGINT NULL;
@@ -0,0 +1,6 @@
+CREATE TABLE job_locks (
+    name VARCHAR(100) PRIMARY KEY,
+    holder VARCHAR(255) NOT NULL DEFAULT '',
+    slot TIMESTAMP(6) NULL,
+    expires_at TIMESTAMP(6) NULL
+);
@@ -0,0 +1 @@
+DROP TABLE watch_digests;
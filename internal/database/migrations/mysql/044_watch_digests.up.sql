@@ -0,0 +1,6 @@
+CREATE TABLE watch_digests (
+    user_id BIGINT PRIMARY KEY,
+    frequency VARCHAR(16) NOT NULL,
+    sent_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+ALTER TABLE projects ADD COLUMN require_signature BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE projects ADD COLUMN signing_keys TEXT NOT NULL DEFAULT '';
+ALTER TABLE versions ADD COLUMN signature_status TEXT NOT NULL DEFAULT 'unsigned';
+ALTER TABLE versions ADD COLUMN signature_key TEXT NOT NULL DEFAULT '';
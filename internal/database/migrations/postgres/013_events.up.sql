@@ -0,0 +1,7 @@
+CREATE TABLE events (
+    id SERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    project TEXT NOT NULL DEFAULT '',
+    payload TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS version_metadata;
+DROP TABLE IF EXISTS project_metadata;
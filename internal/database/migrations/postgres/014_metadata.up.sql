@@ -0,0 +1,12 @@
+CREATE TABLE project_metadata (
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    meta_key TEXT NOT NULL,
+    meta_value TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (project_id, meta_key)
+);
+CREATE TABLE version_metadata (
+    version_id INTEGER NOT NULL REFERENCES versions(id) ON DELETE CASCADE,
+    meta_key TEXT NOT NULL,
+    meta_value TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (version_id, meta_key)
+);
@@ -0,0 +1 @@
+ALTER TABLE projects ADD COLUMN hide_from_sitemap BOOLEAN NOT NULL DEFAULT FALSE;
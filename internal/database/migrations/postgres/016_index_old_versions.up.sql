@@ -0,0 +1 @@
+ALTER TABLE projects ADD COLUMN index_old_versions BOOLEAN NOT NULL DEFAULT FALSE;
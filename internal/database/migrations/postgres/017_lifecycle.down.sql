@@ -0,0 +1,4 @@
+ALTER TABLE versions DROP COLUMN lifecycle_message;
+ALTER TABLE versions DROP COLUMN lifecycle;
+ALTER TABLE projects DROP COLUMN lifecycle_message;
+ALTER TABLE projects DROP COLUMN lifecycle;
@@ -0,0 +1,2 @@
+ALTER TABLE projects ADD COLUMN overlay_include TEXT NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN overlay_exclude TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+CREATE TABLE project_tags (
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (project_id, tag)
+);
+CREATE INDEX idx_project_tags_tag ON project_tags(tag);
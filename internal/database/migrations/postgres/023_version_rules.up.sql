@@ -0,0 +1,3 @@
+ALTER TABLE projects ADD COLUMN version_pattern VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN version_semver_only BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE projects ADD COLUMN normalize_versions BOOLEAN NOT NULL DEFAULT FALSE;
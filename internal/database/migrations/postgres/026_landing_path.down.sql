@@ -0,0 +1,3 @@
+ALTER TABLE versions DROP COLUMN landing_path;
+ALTER TABLE projects DROP COLUMN detect_landing;
+ALTER TABLE projects DROP COLUMN landing_path;
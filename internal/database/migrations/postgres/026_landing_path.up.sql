@@ -0,0 +1,3 @@
+ALTER TABLE projects ADD COLUMN landing_path VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN detect_landing BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE versions ADD COLUMN landing_path VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+CREATE TABLE page_hits (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    version TEXT NOT NULL,
+    path TEXT NOT NULL DEFAULT '',
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    status INTEGER NOT NULL DEFAULT 200,
+    viewed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_page_hits_project ON page_hits(project_id, viewed_at);
+CREATE INDEX idx_page_hits_viewed_at ON page_hits(viewed_at);
@@ -0,0 +1 @@
+ALTER TABLE projects ADD COLUMN redirects TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN deactivated BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE TABLE scim_groups (
+    id SERIAL PRIMARY KEY,
+    display_name TEXT NOT NULL UNIQUE,
+    external_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE scim_group_members (
+    group_id BIGINT NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX idx_scim_group_members_user ON scim_group_members(user_id);
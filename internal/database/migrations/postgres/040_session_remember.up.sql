@@ -0,0 +1,3 @@
+ALTER TABLE sessions ADD COLUMN remember_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN remember_until TIMESTAMP;
+CREATE INDEX idx_sessions_remember_hash ON sessions(remember_hash);
@@ -0,0 +1 @@
+ALTER TABLE versions ADD COLUMN protected BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE projects DROP COLUMN hide_from_sitemap;
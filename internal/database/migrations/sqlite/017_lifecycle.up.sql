@@ -0,0 +1,4 @@
+ALTER TABLE projects ADD COLUMN lifecycle VARCHAR(16) NOT NULL DEFAULT 'active';
+ALTER TABLE projects ADD COLUMN lifecycle_message TEXT NOT NULL DEFAULT '';
+ALTER TABLE versions ADD COLUMN lifecycle VARCHAR(16) NOT NULL DEFAULT 'active';
+ALTER TABLE versions ADD COLUMN lifecycle_message TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE projects ADD COLUMN owner VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN owner_team VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN owner_contact VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN owner_orphaned BOOLEAN NOT NULL DEFAULT FALSE;
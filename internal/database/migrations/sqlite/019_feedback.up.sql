@@ -0,0 +1,13 @@
+ALTER TABLE projects ADD COLUMN feedback_mode VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN feedback_url VARCHAR(1024) NOT NULL DEFAULT '';
+CREATE TABLE feedback (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    version_tag TEXT NOT NULL DEFAULT '',
+    page_url TEXT NOT NULL DEFAULT '',
+    selection TEXT NOT NULL DEFAULT '',
+    message TEXT NOT NULL DEFAULT '',
+    author TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_feedback_project_id ON feedback(project_id);
@@ -0,0 +1,7 @@
+CREATE TABLE version_redirects (
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    old_tag TEXT NOT NULL,
+    new_tag TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, old_tag)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE feature_flags (
+    name TEXT PRIMARY KEY,
+    enabled BOOLEAN NOT NULL
+);
+CREATE TABLE project_feature_flags (
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (project_id, name)
+);
@@ -0,0 +1 @@
+ALTER TABLE projects ADD COLUMN immutable_versions BOOLEAN NOT NULL DEFAULT FALSE;
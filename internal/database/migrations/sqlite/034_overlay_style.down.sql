@@ -0,0 +1,4 @@
+ALTER TABLE projects DROP COLUMN overlay_visibility;
+ALTER TABLE projects DROP COLUMN overlay_color;
+ALTER TABLE projects DROP COLUMN overlay_theme;
+ALTER TABLE projects DROP COLUMN overlay_position;
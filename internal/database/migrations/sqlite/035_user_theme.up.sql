@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN theme VARCHAR(16) NOT NULL DEFAULT '';
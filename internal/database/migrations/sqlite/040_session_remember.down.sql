@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_sessions_remember_hash;
+ALTER TABLE sessions DROP COLUMN remember_until;
+ALTER TABLE sessions DROP COLUMN remember_hash;
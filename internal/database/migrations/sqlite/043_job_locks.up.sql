@@ -0,0 +1,6 @@
+CREATE TABLE job_locks (
+    name TEXT PRIMARY KEY,
+    holder TEXT NOT NULL DEFAULT '',
+    slot DATETIME,
+    expires_at DATETIME
+);
@@ -5,40 +5,178 @@ import (
 )
 
 type User struct {
-	ID         int64     `db:"id"`
-	Username   string    `db:"username"`
-	Email      string    `db:"email"`
-	Password   *string   `db:"password"`
-	AuthSource string    `db:"auth_source"`
-	Role       string    `db:"role"`
-	IsRobot    bool      `db:"is_robot"`
-	CreatedAt  time.Time `db:"created_at"`
-	UpdatedAt  time.Time `db:"updated_at"`
+	ID         int64   `db:"id"`
+	Username   string  `db:"username"`
+	Email      string  `db:"email"`
+	Password   *string `db:"password"`
+	AuthSource string  `db:"auth_source"`
+	Role       string  `db:"role"`
+	IsRobot    bool    `db:"is_robot"`
+	Theme      string  `db:"theme"`
+	// Deactivated users cannot log in; their identity provider turned
+	// them off over SCIM.
+	Deactivated bool      `db:"deactivated"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
 }
 
+// User themes; ThemeSystem follows the color scheme of the browser
+const (
+	ThemeSystem = ""
+	ThemeLight  = "light"
+	ThemeDark   = "dark"
+)
+
 type Session struct {
-	ID        string    `db:"id"`
+	ID         string    `db:"id"`
+	UserID     int64     `db:"user_id"`
+	ExpiresAt  time.Time `db:"expires_at"`
+	CreatedAt  time.Time `db:"created_at"`
+	UserAgent  string    `db:"user_agent"`
+	IPAddress  string    `db:"ip_address"`
+	LastSeenAt time.Time `db:"last_seen_at"`
+	// RememberHash is the hash of the remember-me token that renews the
+	// session until RememberUntil, or empty.
+	RememberHash  string     `db:"remember_hash"`
+	RememberUntil *time.Time `db:"remember_until"`
+}
+
+// PasswordReset is a pending password reset. Only the hash of the token
+// sent by email is stored, like for API tokens.
+type PasswordReset struct {
+	TokenHash string    `db:"token_hash"`
 	UserID    int64     `db:"user_id"`
 	ExpiresAt time.Time `db:"expires_at"`
 	CreatedAt time.Time `db:"created_at"`
 }
 
+// Watcher is a channel a user is told about new versions of a project on.
+// Target is the URL of webhook watchers and empty otherwise.
+type Watcher struct {
+	ID        int64     `db:"id"`
+	UserID    int64     `db:"user_id"`
+	ProjectID int64     `db:"project_id"`
+	Channel   string    `db:"channel"`
+	Target    string    `db:"target"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// Watch channels; WatchFeed lists the new versions in the personal feed of
+// the user rather than pushing them, WatchDigest collects them into an
+// email sent daily or weekly
+const (
+	WatchEmail   = "email"
+	WatchDigest  = "digest"
+	WatchWebhook = "webhook"
+	WatchFeed    = "rss"
+)
+
+// Digest is how often a user gets the digest of the projects they watch
+// with WatchDigest. SentAt is the end of the period the last digest
+// covered, or when the user chose the frequency.
+type Digest struct {
+	UserID    int64     `db:"user_id"`
+	Frequency string    `db:"frequency"`
+	SentAt    time.Time `db:"sent_at"`
+}
+
+// Digest frequencies; users who never chose one get DigestWeekly
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// SCIMGroup is a group pushed by an identity provider over SCIM. Its
+// members get the access of the group mappings and global access rules of
+// the "scim" source.
+type SCIMGroup struct {
+	ID          int64     `db:"id"`
+	DisplayName string    `db:"display_name"`
+	ExternalID  string    `db:"external_id"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
 // Project visibility constants
 const (
-	VisibilityPublic  = "public"  // Anyone, including anonymous users
-	VisibilityPrivate = "private" // Any authenticated user with global access
-	VisibilityCustom  = "custom"  // Only explicitly assigned users/groups
+	VisibilityPublic   = "public"   // Anyone, including anonymous users
+	VisibilityPrivate  = "private"  // Any authenticated user with global access
+	VisibilityCustom   = "custom"   // Only explicitly assigned users/groups
+	VisibilityUnlisted = "unlisted" // Anyone with the URL; not listed for anonymous users
 )
 
 type Project struct {
-	ID            int64     `db:"id"`
-	Slug          string    `db:"slug"`
-	Name          string    `db:"name"`
-	Description   string    `db:"description"`
-	Visibility    string    `db:"visibility"`
-	RetentionDays *int      `db:"retention_days"`
-	PinnedVersion *string   `db:"pinned_version"`
-	PinPermanent  bool      `db:"pin_permanent"`
+	ID            int64   `db:"id"`
+	Slug          string  `db:"slug"`
+	Name          string  `db:"name"`
+	Description   string  `db:"description"`
+	Visibility    string  `db:"visibility"`
+	RetentionDays *int    `db:"retention_days"`
+	PinnedVersion *string `db:"pinned_version"`
+	PinPermanent  bool    `db:"pin_permanent"`
+	// RequireSignature rejects uploads without a detached signature that
+	// verifies against one of SigningKeys (PEM-encoded public keys).
+	RequireSignature bool   `db:"require_signature"`
+	SigningKeys      string `db:"signing_keys"`
+	// HideFromSitemap leaves a public project out of sitemap.xml and
+	// disallows it in robots.txt.
+	HideFromSitemap bool `db:"hide_from_sitemap"`
+	// IndexOldVersions lets search engines index non-latest versions, which
+	// are otherwise served with noindex and a canonical link to the latest.
+	IndexOldVersions bool `db:"index_old_versions"`
+	// Lifecycle is LifecycleActive, LifecycleDeprecated or LifecycleEOL;
+	// LifecycleMessage replaces the default banner text if set.
+	Lifecycle        string `db:"lifecycle"`
+	LifecycleMessage string `db:"lifecycle_message"`
+	// Owner is the username of the maintainer, OwnerTeam and OwnerContact
+	// (an email address or URL) are shown as "maintained by". OwnerOrphaned
+	// is set when the owner account no longer exists.
+	Owner         string `db:"owner"`
+	OwnerTeam     string `db:"owner_team"`
+	OwnerContact  string `db:"owner_contact"`
+	OwnerOrphaned bool   `db:"owner_orphaned"`
+	// FeedbackMode adds a "report an issue" link to the doc overlay:
+	// FeedbackIssueTracker opens FeedbackURL with the page context filled
+	// in, FeedbackInternal collects reports in asiakirjat.
+	FeedbackMode string `db:"feedback_mode"`
+	FeedbackURL  string `db:"feedback_url"`
+	// Uploaded version tags are lowercased and lose a leading "v" if
+	// NormalizeVersions is set, and are then rejected unless they are
+	// semantic versions (VersionSemverOnly) and match VersionPattern.
+	VersionPattern    string `db:"version_pattern"`
+	VersionSemverOnly bool   `db:"version_semver_only"`
+	NormalizeVersions bool   `db:"normalize_versions"`
+	// ImmutableVersions refuses uploads of a tag that already exists,
+	// unless an admin forces the overwrite.
+	ImmutableVersions bool `db:"immutable_versions"`
+	// OverlayInclude and OverlayExclude hold path patterns, one per line,
+	// of files the doc overlay is additionally or never injected into.
+	OverlayInclude string `db:"overlay_include"`
+	OverlayExclude string `db:"overlay_exclude"`
+	// OverlayPosition, OverlayTheme and OverlayColor, an accent color such
+	// as "#3b82f6", style the doc overlay; OverlayVisibility starts it
+	// collapsed or hides it. Empty values are the defaults.
+	OverlayPosition   string `db:"overlay_position"`
+	OverlayTheme      string `db:"overlay_theme"`
+	OverlayColor      string `db:"overlay_color"`
+	OverlayVisibility string `db:"overlay_visibility"`
+	// Redirects holds redirect rules for paths of every version, in the
+	// format of a _redirects file. A version's own rules take precedence.
+	Redirects string `db:"redirects"`
+	// LandingPath is the page /project/{slug}/{version}/ redirects to, for
+	// archives without an index.html at their root. With DetectLanding, the
+	// landing page of each upload without one is detected instead.
+	LandingPath   string `db:"landing_path"`
+	DetectLanding bool   `db:"detect_landing"`
+	// SanitizeHTML strips scripts and event handlers from the HTML and SVG
+	// files of uploads, which are otherwise served as uploaded under the
+	// origin of the app.
+	SanitizeHTML bool `db:"sanitize_html"`
+	// StorageQuota bounds the bytes all versions of the project may take,
+	// and MaxUploadSize the bytes of one upload, below the global limits.
+	// Nil uses the configured defaults; a StorageQuota of 0 is unlimited.
+	StorageQuota  *int64    `db:"storage_quota"`
+	MaxUploadSize *int64    `db:"max_upload_size"`
 	CreatedAt     time.Time `db:"created_at"`
 	UpdatedAt     time.Time `db:"updated_at"`
 }
@@ -51,8 +189,37 @@ type Version struct {
 	ContentType string    `db:"content_type"` // "archive" or "pdf"
 	UploadedBy  int64     `db:"uploaded_by"`
 	CreatedAt   time.Time `db:"created_at"`
+	// SignatureStatus is SignatureUnsigned or SignatureVerified;
+	// SignatureKey holds the fingerprint of the verifying key.
+	SignatureStatus string `db:"signature_status"`
+	SignatureKey    string `db:"signature_key"`
+	// Protected versions are never removed by retention or manual deletion.
+	Protected bool `db:"protected"`
+	// Lifecycle and LifecycleMessage work like those of Project.
+	Lifecycle        string `db:"lifecycle"`
+	LifecycleMessage string `db:"lifecycle_message"`
+	// LandingPath is the detected landing page of the version, if any.
+	LandingPath string `db:"landing_path"`
+	// ReleaseNotes are the Markdown release notes sent with the upload.
+	ReleaseNotes string `db:"release_notes"`
+	// SizeBytes is the size of the files of the version, counted against
+	// storage quotas.
+	SizeBytes int64 `db:"size_bytes"`
 }
 
+// Lifecycle state constants for projects and versions
+const (
+	LifecycleActive     = "active"
+	LifecycleDeprecated = "deprecated"
+	LifecycleEOL        = "eol" // End of life: kept for reference, no longer maintained
+)
+
+// Version signature status constants
+const (
+	SignatureUnsigned = "unsigned"
+	SignatureVerified = "verified"
+)
+
 type ProjectAccess struct {
 	ID        int64  `db:"id"`
 	ProjectID int64  `db:"project_id"`
@@ -88,10 +255,23 @@ type GlobalAccess struct {
 	ID                int64  `db:"id"`
 	SubjectType       string `db:"subject_type"`       // 'user', 'ldap_group', 'oauth2_group'
 	SubjectIdentifier string `db:"subject_identifier"` // username, LDAP DN, OAuth2 group name
-	Role              string `db:"role"`                // 'viewer' or 'editor'
+	Role              string `db:"role"`               // 'viewer' or 'editor'
 	FromConfig        bool   `db:"from_config"`
 }
 
+// Preview is documentation uploaded for review, such as that of a pull
+// request, under a Name of the uploader's choice. Previews are not
+// versions: they are listed apart and deleted once they expire.
+type Preview struct {
+	ID          int64     `db:"id"`
+	ProjectID   int64     `db:"project_id"`
+	Name        string    `db:"name"`
+	ContentType string    `db:"content_type"`
+	UploadedBy  int64     `db:"uploaded_by"`
+	CreatedAt   time.Time `db:"created_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
+
 type UploadLog struct {
 	ID          int64     `db:"id"`
 	ProjectID   int64     `db:"project_id"`
@@ -103,6 +283,155 @@ type UploadLog struct {
 	CreatedAt   time.Time `db:"created_at"`
 }
 
+// Version attachment kinds
+const (
+	AttachmentProvenance = "provenance" // e.g. SLSA attestation
+	AttachmentSBOM       = "sbom"       // e.g. SPDX or CycloneDX document
+)
+
+// AttachmentKinds lists the accepted attachment kinds in display order.
+var AttachmentKinds = []string{AttachmentProvenance, AttachmentSBOM}
+
+// VersionAttachment is a supply-chain file (provenance, SBOM) uploaded with
+// a version. The file is stored outside the served documentation tree.
+type VersionAttachment struct {
+	ID        int64     `db:"id"`
+	VersionID int64     `db:"version_id"`
+	Kind      string    `db:"kind"`
+	Filename  string    `db:"filename"`
+	Size      int64     `db:"size"`
+	SHA256    string    `db:"sha256"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// Doc overlay positions, themes and visibilities
+const (
+	OverlayTop       = ""
+	OverlayBottom    = "bottom"
+	OverlayDark      = ""
+	OverlayLight     = "light"
+	OverlayAuto      = "auto"
+	OverlayShown     = ""
+	OverlayCollapsed = "collapsed"
+	OverlayHidden    = "hidden"
+)
+
+// Project feedback modes
+const (
+	FeedbackOff          = ""
+	FeedbackIssueTracker = "issue_tracker"
+	FeedbackInternal     = "internal"
+)
+
+// Feedback is a problem report sent from a documentation page. Author is a
+// username, or empty for anonymous readers.
+type Feedback struct {
+	ID         int64     `db:"id"`
+	ProjectID  int64     `db:"project_id"`
+	VersionTag string    `db:"version_tag"`
+	PageURL    string    `db:"page_url"`
+	Selection  string    `db:"selection"`
+	Message    string    `db:"message"`
+	Author     string    `db:"author"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// PageView is a documentation page in a user's history. A page is kept
+// once per project and path, with the version and time of the last view.
+type PageView struct {
+	ID        int64     `db:"id"`
+	UserID    int64     `db:"user_id"`
+	ProjectID int64     `db:"project_id"`
+	Version   string    `db:"version"`
+	Path      string    `db:"path"`
+	ViewedAt  time.Time `db:"viewed_at"`
+}
+
+// PageHit is a sampled request for a file of a documentation version,
+// recorded for the view analytics of its project. UserID is nil for
+// anonymous readers.
+type PageHit struct {
+	ID        int64     `db:"id"`
+	ProjectID int64     `db:"project_id"`
+	Version   string    `db:"version"`
+	Path      string    `db:"path"`
+	UserID    *int64    `db:"user_id"`
+	Status    int       `db:"status"`
+	ViewedAt  time.Time `db:"viewed_at"`
+}
+
+// ProjectTranslation is the name and description of a project in a
+// language, shown to readers who prefer it. Empty fields fall back to the
+// project's own.
+type ProjectTranslation struct {
+	ProjectID   int64  `db:"project_id"`
+	Locale      string `db:"locale"` // Lowercase language tag, such as "fi" or "sv-fi"
+	Name        string `db:"name"`
+	Description string `db:"description"`
+}
+
+// FeatureFlag is a feature switched on or off by an admin, for the whole
+// instance (ProjectID 0) or for one project.
+type FeatureFlag struct {
+	ProjectID int64  `db:"project_id"`
+	Name      string `db:"name"`
+	Enabled   bool   `db:"enabled"`
+}
+
+// HitCount is a number of page hits grouped by version, path or both.
+type HitCount struct {
+	Version string `db:"version"`
+	Path    string `db:"path"`
+	Hits    int    `db:"hits"`
+	Readers int    `db:"readers"` // Distinct logged-in readers
+}
+
+// APIKey grants read access to public projects and search without a user
+// account. Quota is the number of requests per hour; 0 uses the default
+// from the config.
+type APIKey struct {
+	ID        int64     `db:"id"`
+	Name      string    `db:"name"`
+	KeyHash   string    `db:"key_hash"`
+	Quota     int       `db:"quota"`
+	CreatedBy string    `db:"created_by"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// AuditEntry records an administrative or automated action, such as a
+// retention run. Actor is a username, or "system" for background tasks.
+type AuditEntry struct {
+	ID        int64     `db:"id"`
+	Action    string    `db:"action"`
+	Actor     string    `db:"actor"`
+	Details   string    `db:"details"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// Event is an entry in the append-only event feed. Its ID is the cursor
+// for /api/events; Payload is a JSON object describing the change.
+type Event struct {
+	ID        int64     `db:"id"`
+	Type      string    `db:"type"`
+	Project   string    `db:"project"`
+	Payload   string    `db:"payload"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// Event type constants
+const (
+	EventProjectCreated   = "project.created"
+	EventProjectUpdated   = "project.updated"
+	EventProjectDeleted   = "project.deleted"
+	EventVersionPublished = "version.published"
+	EventVersionDeleted   = "version.deleted"
+	EventVersionRenamed   = "version.renamed"
+	EventLifecycleChanged = "lifecycle.changed"
+	EventFeedbackReceived = "feedback.received"
+	EventAccessGranted    = "access.granted"
+	EventAccessRevoked    = "access.revoked"
+)
+
 // GlobalAccessGrant is a resolved per-user grant for private project access.
 // Created from GlobalAccess rules at login time (for LDAP/OAuth2) or manually.
 type GlobalAccessGrant struct {
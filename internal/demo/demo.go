@@ -0,0 +1,318 @@
+// Package demo creates example content for evaluating asiakirjat and for
+// reproducing bug reports and load tests on a known data set.
+package demo
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+	"github.com/qwc/asiakirjat/internal/store"
+)
+
+// demoProject describes an example project. Every version gets the same
+// pages; the content changes between versions so comparing them shows
+// differences.
+type demoProject struct {
+	Slug        string
+	Name        string
+	Description string
+	Visibility  string
+	Versions    []string
+	Topics      []string
+}
+
+var projects = []demoProject{
+	{
+		Slug:        "demo-api",
+		Name:        "Demo API Reference",
+		Description: "Reference of a fictional REST API, with several releases to compare.",
+		Visibility:  database.VisibilityPublic,
+		Versions:    []string{"1.0.0", "1.1.0", "2.0.0"},
+		Topics:      []string{"Authentication", "Projects", "Orders", "Invoices", "Webhooks", "Errors"},
+	},
+	{
+		Slug:        "demo-handbook",
+		Name:        "Demo Team Handbook",
+		Description: "Internal handbook, readable only by users with project access.",
+		Visibility:  database.VisibilityCustom,
+		Versions:    []string{"2024", "2025"},
+		Topics:      []string{"Onboarding", "On-call", "Releases", "Security", "Travel"},
+	},
+	{
+		Slug:        "demo-preview",
+		Name:        "Demo Preview",
+		Description: "Unlisted docs that anyone with the link can read.",
+		Visibility:  database.VisibilityUnlisted,
+		Versions:    []string{"main"},
+		Topics:      []string{"Overview", "Roadmap"},
+	},
+}
+
+// Seeder creates the demo projects, versions, users and tokens.
+type Seeder struct {
+	Storage     docs.Storage
+	Projects    store.ProjectStore
+	Versions    store.VersionStore
+	Users       store.UserStore
+	Access      store.ProjectAccessStore
+	Tokens      store.TokenStore
+	SearchIndex *docs.SearchIndex
+	Logger      *slog.Logger
+}
+
+// Seed creates the demo content. Existing demo projects, versions and users
+// are left as they are, so seeding again only adds what is missing.
+// Passwords and tokens are random and logged once when created.
+func (s *Seeder) Seed(ctx context.Context) error {
+	editor, err := s.ensureUser(ctx, "demo-editor", "editor", false)
+	if err != nil {
+		return err
+	}
+	viewer, err := s.ensureUser(ctx, "demo-viewer", "viewer", false)
+	if err != nil {
+		return err
+	}
+	robot, err := s.ensureUser(ctx, "demo-ci", "editor", true)
+	if err != nil {
+		return err
+	}
+
+	for _, dp := range projects {
+		project, created, err := s.ensureProject(ctx, dp)
+		if err != nil {
+			return err
+		}
+		for _, tag := range dp.Versions {
+			if err := s.ensureVersion(ctx, project, dp, tag, editor.ID); err != nil {
+				return err
+			}
+		}
+		if !created {
+			continue
+		}
+
+		if dp.Visibility == database.VisibilityCustom {
+			for _, grant := range []struct {
+				user *database.User
+				role string
+			}{{editor, "editor"}, {viewer, "viewer"}} {
+				access := &database.ProjectAccess{ProjectID: project.ID, UserID: grant.user.ID, Role: grant.role}
+				if err := s.Access.Grant(ctx, access); err != nil {
+					return fmt.Errorf("granting access to %s: %w", dp.Slug, err)
+				}
+			}
+		}
+		if err := s.createToken(ctx, robot, project, "demo-upload", auth.ScopeUpload+","+auth.ScopeRead); err != nil {
+			return err
+		}
+	}
+
+	s.Logger.Info("seeded demo content", "projects", len(projects))
+	return nil
+}
+
+func (s *Seeder) ensureUser(ctx context.Context, username, role string, robot bool) (*database.User, error) {
+	if user, err := s.Users.GetByUsername(ctx, username); err == nil {
+		return user, nil
+	}
+
+	user := &database.User{Username: username, AuthSource: "builtin", Role: role}
+	var password string
+	if robot {
+		user.AuthSource = "robot"
+		user.IsRobot = true
+	} else {
+		var err error
+		password, err = auth.GenerateToken(9)
+		if err != nil {
+			return nil, fmt.Errorf("generating password: %w", err)
+		}
+		hash, err := auth.HashPassword(password)
+		if err != nil {
+			return nil, fmt.Errorf("hashing password: %w", err)
+		}
+		user.Password = &hash
+	}
+	if err := s.Users.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("creating user %s: %w", username, err)
+	}
+
+	if robot {
+		s.Logger.Info("created demo robot", "username", username)
+	} else {
+		s.Logger.Info("created demo user", "username", username, "password", password, "role", role)
+	}
+	return user, nil
+}
+
+func (s *Seeder) ensureProject(ctx context.Context, dp demoProject) (*database.Project, bool, error) {
+	if project, err := s.Projects.GetBySlug(ctx, dp.Slug); err == nil {
+		return project, false, nil
+	}
+
+	project := &database.Project{
+		Slug:        dp.Slug,
+		Name:        dp.Name,
+		Description: dp.Description,
+		Visibility:  dp.Visibility,
+	}
+	if err := s.Projects.Create(ctx, project); err != nil {
+		return nil, false, fmt.Errorf("creating project %s: %w", dp.Slug, err)
+	}
+	if err := s.Storage.EnsureProjectDir(dp.Slug); err != nil {
+		return nil, false, err
+	}
+	s.Logger.Info("created demo project", "slug", dp.Slug)
+	return project, true, nil
+}
+
+func (s *Seeder) ensureVersion(ctx context.Context, project *database.Project, dp demoProject, tag string, uploaderID int64) error {
+	if _, err := s.Versions.GetByProjectAndTag(ctx, project.ID, tag); err == nil {
+		return nil
+	}
+
+	if err := s.Storage.EnsureVersionDir(dp.Slug, tag); err != nil {
+		return err
+	}
+	storagePath := s.Storage.VersionPath(dp.Slug, tag)
+	if err := writeVersion(storagePath, dp, tag); err != nil {
+		s.Storage.DeleteVersion(dp.Slug, tag)
+		return fmt.Errorf("writing %s %s: %w", dp.Slug, tag, err)
+	}
+
+	version := &database.Version{
+		ProjectID:   project.ID,
+		Tag:         tag,
+		StoragePath: storagePath,
+		UploadedBy:  uploaderID,
+	}
+	if err := s.Versions.Create(ctx, version); err != nil {
+		s.Storage.DeleteVersion(dp.Slug, tag)
+		return fmt.Errorf("creating version %s %s: %w", dp.Slug, tag, err)
+	}
+
+	if s.SearchIndex != nil {
+		if err := s.SearchIndex.IndexVersion(ctx, project.ID, version.ID, project.Slug, project.Name, tag, storagePath); err != nil {
+			s.Logger.Error("indexing demo version", "error", err, "project", dp.Slug, "version", tag)
+		}
+	}
+	return nil
+}
+
+func (s *Seeder) createToken(ctx context.Context, user *database.User, project *database.Project, name, scopes string) error {
+	rawToken, err := auth.GenerateToken(32)
+	if err != nil {
+		return fmt.Errorf("generating token: %w", err)
+	}
+	projectID := project.ID
+	token := &database.APIToken{
+		UserID:    user.ID,
+		ProjectID: &projectID,
+		TokenHash: auth.HashToken(rawToken),
+		Name:      name,
+		Scopes:    scopes,
+	}
+	if err := s.Tokens.Create(ctx, token); err != nil {
+		return fmt.Errorf("creating token for %s: %w", project.Slug, err)
+	}
+	s.Logger.Info("created demo token", "project", project.Slug, "username", user.Username, "scopes", scopes, "token", rawToken)
+	return nil
+}
+
+// writeVersion writes the generated pages of a demo version.
+func writeVersion(dir string, dp demoProject, tag string) error {
+	pages := map[string]string{
+		"index.html": page(dp, tag, "", dp.Name, indexBody(dp, tag)),
+	}
+	for i, topic := range dp.Topics {
+		pages[topicPath(topic)] = page(dp, tag, "../", topic, topicBody(dp, tag, i, topic))
+	}
+	pages["style.css"] = stylesheet
+
+	for name, content := range pages {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func topicPath(topic string) string {
+	return "guide/" + strings.ToLower(strings.ReplaceAll(topic, " ", "-")) + ".html"
+}
+
+func page(dp demoProject, tag, root, title, body string) string {
+	var nav strings.Builder
+	nav.WriteString(`<li><a href="` + root + `index.html">Home</a></li>`)
+	for _, topic := range dp.Topics {
+		nav.WriteString(`<li><a href="` + root + topicPath(topic) + `">` + html.EscapeString(topic) + `</a></li>`)
+	}
+	return `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>` + html.EscapeString(title+" - "+dp.Name+" "+tag) + `</title>
+<link rel="stylesheet" href="` + root + `style.css">
+</head>
+<body>
+<nav aria-label="Contents"><ul>` + nav.String() + `</ul></nav>
+<main>
+` + body + `
+</main>
+</body>
+</html>
+`
+}
+
+func indexBody(dp demoProject, tag string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<h1>%s</h1>\n<p>%s</p>\n", html.EscapeString(dp.Name), html.EscapeString(dp.Description))
+	fmt.Fprintf(&b, "<h2>What's new in %s</h2>\n<ul>\n", html.EscapeString(tag))
+	for i, v := range dp.Versions {
+		fmt.Fprintf(&b, "<li>%s: improvements to %s</li>\n", html.EscapeString(v), html.EscapeString(strings.ToLower(dp.Topics[i%len(dp.Topics)])))
+		if v == tag {
+			break
+		}
+	}
+	b.WriteString("</ul>\n")
+	return b.String()
+}
+
+func topicBody(dp demoProject, tag string, index int, topic string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", html.EscapeString(topic))
+	fmt.Fprintf(&b, "<p>This page describes %s in %s %s. The text is generated for demonstration purposes.</p>\n",
+		html.EscapeString(strings.ToLower(topic)), html.EscapeString(dp.Name), html.EscapeString(tag))
+
+	// Later versions gain sections, so comparing versions shows changes.
+	for i, v := range dp.Versions {
+		fmt.Fprintf(&b, "<h2>%s, part %d</h2>\n", html.EscapeString(topic), i+1)
+		fmt.Fprintf(&b, "<p>Since %s, %s supports option <code>%s_%d</code>. Set it to <code>true</code> to enable the behaviour described here.</p>\n",
+			html.EscapeString(v), html.EscapeString(strings.ToLower(topic)), strings.ToLower(strings.ReplaceAll(topic, "-", "_")), index+i)
+		if v == tag {
+			break
+		}
+	}
+	fmt.Fprintf(&b, "<pre><code>curl https://example.com/%s/%s</code></pre>\n", dp.Slug, strings.ToLower(strings.ReplaceAll(topic, " ", "-")))
+	return b.String()
+}
+
+const stylesheet = `body { font-family: system-ui, sans-serif; margin: 0; display: flex; }
+nav { width: 14rem; padding: 1rem; background: #f6f8fa; min-height: 100vh; }
+nav ul { list-style: none; padding: 0; }
+nav li { margin: 0.4rem 0; }
+main { padding: 1rem 2rem; max-width: 48rem; }
+pre { background: #f6f8fa; padding: 0.75rem; overflow-x: auto; }
+`
@@ -0,0 +1,65 @@
+package demo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/docs"
+	sqlstore "github.com/qwc/asiakirjat/internal/store/sql"
+	"github.com/qwc/asiakirjat/internal/testutil"
+)
+
+func TestSeed(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	seeder := &Seeder{
+		Storage:  docs.NewFilesystemStorage(t.TempDir()),
+		Projects: sqlstore.NewProjectStore(db),
+		Versions: sqlstore.NewVersionStore(db),
+		Users:    sqlstore.NewUserStore(db),
+		Access:   sqlstore.NewProjectAccessStore(db),
+		Tokens:   sqlstore.NewTokenStore(db),
+		Logger:   testutil.TestLogger(),
+	}
+	ctx := context.Background()
+
+	// Seeding twice must not fail or duplicate anything.
+	for i := 0; i < 2; i++ {
+		if err := seeder.Seed(ctx); err != nil {
+			t.Fatalf("seed %d: %v", i+1, err)
+		}
+	}
+
+	for _, dp := range projects {
+		project, err := seeder.Projects.GetBySlug(ctx, dp.Slug)
+		if err != nil {
+			t.Fatalf("expected project %s: %v", dp.Slug, err)
+		}
+		versions, _ := seeder.Versions.ListByProject(ctx, project.ID)
+		if len(versions) != len(dp.Versions) {
+			t.Errorf("%s: expected %d versions, got %d", dp.Slug, len(dp.Versions), len(versions))
+		}
+		tokens, _ := seeder.Tokens.ListByProject(ctx, project.ID)
+		if len(tokens) != 1 {
+			t.Errorf("%s: expected 1 token, got %d", dp.Slug, len(tokens))
+		}
+		for _, topic := range dp.Topics {
+			path := filepath.Join(seeder.Storage.VersionPath(dp.Slug, dp.Versions[0]), topicPath(topic))
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("expected page %s", path)
+			}
+		}
+	}
+
+	handbook, _ := seeder.Projects.GetBySlug(ctx, "demo-handbook")
+	viewer, _ := seeder.Users.GetByUsername(ctx, "demo-viewer")
+	if role, _ := seeder.Access.GetEffectiveRole(ctx, handbook.ID, viewer.ID); role != "viewer" {
+		t.Errorf("expected demo-viewer to read the handbook, got role %q", role)
+	}
+
+	report, err := docs.CheckAccessibility(ctx, seeder.Storage.VersionPath("demo-api", "2.0.0"))
+	if err != nil || report.Total() != 0 {
+		t.Errorf("expected accessible demo pages, got %+v, %v", report, err)
+	}
+}
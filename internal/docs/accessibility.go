@@ -0,0 +1,341 @@
+package docs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// AccessibilityReportFile is the name of the accessibility report stored
+// with a version's attachments.
+const AccessibilityReportFile = "accessibility.json"
+
+// AccessibilityIssue counts the violations of one rule on one page.
+// Example shows the first offending element.
+type AccessibilityIssue struct {
+	Page    string `json:"page"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+	Example string `json:"example,omitempty"`
+}
+
+// AccessibilityReport is the result of checking all HTML pages of a version.
+type AccessibilityReport struct {
+	CheckedAt time.Time            `json:"checked_at"`
+	Pages     int                  `json:"pages"`
+	Issues    []AccessibilityIssue `json:"issues"`
+}
+
+// Total returns the number of violations in the report.
+func (r *AccessibilityReport) Total() int {
+	total := 0
+	for _, issue := range r.Issues {
+		total += issue.Count
+	}
+	return total
+}
+
+// accessibilityRules describes each rule. The checks are static, so they
+// catch what a page's markup gets wrong, not how it renders.
+var accessibilityRules = map[string]string{
+	"html-lang":      "The html element has no lang attribute",
+	"document-title": "The page has no title",
+	"image-alt":      "Image without alt text",
+	"link-name":      "Link without text",
+	"button-name":    "Button without text",
+	"form-label":     "Form field without a label",
+	"heading-order":  "Heading level skipped",
+	"duplicate-id":   "Duplicate id attribute",
+}
+
+// CheckAccessibility checks the HTML pages below root for common
+// accessibility problems. It stops with ctx's error when ctx is cancelled.
+func CheckAccessibility(ctx context.Context, root string) (*AccessibilityReport, error) {
+	report := &AccessibilityReport{CheckedAt: time.Now().UTC(), Issues: []AccessibilityIssue{}}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".html" && ext != ".htm" {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		issues, err := CheckPageAccessibility(f)
+		if err != nil {
+			return fmt.Errorf("checking %s: %w", rel, err)
+		}
+		report.Pages++
+		for _, issue := range issues {
+			issue.Page = filepath.ToSlash(rel)
+			report.Issues = append(report.Issues, issue)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// CheckPageAccessibility checks a single HTML page. The issues are sorted
+// by rule and have no page set.
+func CheckPageAccessibility(r io.Reader) ([]AccessibilityIssue, error) {
+	doc, err := xhtml.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &a11yChecker{
+		issues:   make(map[string]*AccessibilityIssue),
+		ids:      make(map[string]int),
+		labelFor: make(map[string]bool),
+	}
+	// Labels may follow their fields, so collect them first
+	walkHTML(doc, func(n *xhtml.Node) bool {
+		if n.Data == "label" {
+			if id := attr(n, "for"); id != "" {
+				c.labelFor[id] = true
+			}
+		}
+		return true
+	})
+	walkHTML(doc, c.check)
+
+	if !c.hasTitle {
+		c.add("document-title", nil)
+	}
+
+	var issues []AccessibilityIssue
+	for _, issue := range c.issues {
+		issues = append(issues, *issue)
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Rule < issues[j].Rule })
+	return issues, nil
+}
+
+type a11yChecker struct {
+	issues      map[string]*AccessibilityIssue
+	ids         map[string]int
+	labelFor    map[string]bool
+	hasTitle    bool
+	lastHeading int
+}
+
+func (c *a11yChecker) add(rule string, n *xhtml.Node) {
+	issue, ok := c.issues[rule]
+	if !ok {
+		issue = &AccessibilityIssue{Rule: rule, Message: accessibilityRules[rule]}
+		if n != nil {
+			issue.Example = renderStartTag(n)
+		}
+		c.issues[rule] = issue
+	}
+	issue.Count++
+}
+
+// check checks an element. Content hidden from screen readers is skipped.
+func (c *a11yChecker) check(n *xhtml.Node) bool {
+	if id := attr(n, "id"); id != "" {
+		c.ids[id]++
+		if c.ids[id] == 2 {
+			c.add("duplicate-id", n)
+		}
+	}
+	if attr(n, "aria-hidden") == "true" {
+		return false
+	}
+
+	switch n.Data {
+	case "html":
+		if strings.TrimSpace(attr(n, "lang")) == "" {
+			c.add("html-lang", n)
+		}
+	case "title":
+		// An svg title names the image, not the page
+		if n.Namespace == "" && strings.TrimSpace(textContent(n)) != "" {
+			c.hasTitle = true
+		}
+	case "img":
+		if _, ok := attrOK(n, "alt"); !ok && !isPresentational(n) && !hasAccessibleName(n) {
+			c.add("image-alt", n)
+		}
+	case "a":
+		if _, ok := attrOK(n, "href"); ok && !hasAccessibleName(n) && strings.TrimSpace(accessibleText(n)) == "" {
+			c.add("link-name", n)
+		}
+	case "button":
+		if !hasAccessibleName(n) && strings.TrimSpace(accessibleText(n)) == "" {
+			c.add("button-name", n)
+		}
+	case "input", "select", "textarea":
+		if n.Data == "input" {
+			switch strings.ToLower(attr(n, "type")) {
+			case "hidden", "submit", "reset", "button", "image":
+				return true
+			}
+		}
+		if !hasAccessibleName(n) && !c.labelFor[attr(n, "id")] && !insideLabel(n) {
+			c.add("form-label", n)
+		}
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(n.Data[1] - '0')
+		if c.lastHeading > 0 && level > c.lastHeading+1 {
+			c.add("heading-order", n)
+		}
+		c.lastHeading = level
+	}
+	return true
+}
+
+// walkHTML calls fn for every element below n, in document order. The
+// children of an element are skipped if fn returns false.
+func walkHTML(n *xhtml.Node, fn func(*xhtml.Node) bool) {
+	if n.Type == xhtml.ElementNode && !fn(n) {
+		return
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walkHTML(child, fn)
+	}
+}
+
+func attrOK(n *xhtml.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func attr(n *xhtml.Node, key string) string {
+	v, _ := attrOK(n, key)
+	return v
+}
+
+func hasAccessibleName(n *xhtml.Node) bool {
+	return strings.TrimSpace(attr(n, "aria-label")) != "" ||
+		strings.TrimSpace(attr(n, "aria-labelledby")) != "" ||
+		strings.TrimSpace(attr(n, "title")) != ""
+}
+
+func isPresentational(n *xhtml.Node) bool {
+	role := attr(n, "role")
+	return role == "presentation" || role == "none"
+}
+
+func insideLabel(n *xhtml.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == xhtml.ElementNode && p.Data == "label" {
+			return true
+		}
+	}
+	return false
+}
+
+// accessibleText returns the text of an element as a screen reader would
+// read it, including the alt text of images and the names of child elements.
+func accessibleText(n *xhtml.Node) string {
+	var b strings.Builder
+	var walk func(*xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		switch n.Type {
+		case xhtml.TextNode:
+			b.WriteString(n.Data)
+		case xhtml.ElementNode:
+			if attr(n, "aria-hidden") == "true" {
+				return
+			}
+			if hasAccessibleName(n) {
+				b.WriteString(attr(n, "aria-label") + attr(n, "title"))
+			}
+			if n.Data == "img" {
+				b.WriteString(attr(n, "alt"))
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walk(child)
+	}
+	return b.String()
+}
+
+func textContent(n *xhtml.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == xhtml.TextNode {
+			b.WriteString(child.Data)
+		}
+	}
+	return b.String()
+}
+
+// renderStartTag renders the start tag of an element, shortened for
+// display in a report.
+func renderStartTag(n *xhtml.Node) string {
+	var b strings.Builder
+	b.WriteString("<" + n.Data)
+	for _, a := range n.Attr {
+		b.WriteString(fmt.Sprintf(" %s=%q", a.Key, a.Val))
+	}
+	b.WriteString(">")
+	s := []rune(b.String())
+	if len(s) > 200 {
+		return string(s[:197]) + "..."
+	}
+	return string(s)
+}
+
+// WriteAccessibilityReport stores a report in dir.
+func WriteAccessibilityReport(dir string, report *AccessibilityReport) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating report directory: %w", err)
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("encoding accessibility report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, AccessibilityReportFile), data, 0644); err != nil {
+		return fmt.Errorf("writing accessibility report: %w", err)
+	}
+	return nil
+}
+
+// ReadAccessibilityReport loads the report stored in dir. The error
+// satisfies errors.Is(err, fs.ErrNotExist) if the version was not checked.
+func ReadAccessibilityReport(dir string) (*AccessibilityReport, error) {
+	data, err := os.ReadFile(filepath.Join(dir, AccessibilityReportFile))
+	if err != nil {
+		return nil, err
+	}
+	var report AccessibilityReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("decoding accessibility report: %w", err)
+	}
+	return &report, nil
+}
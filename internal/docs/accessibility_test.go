@@ -0,0 +1,89 @@
+package docs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPageAccessibility(t *testing.T) {
+	page := `<html><head><title>Guide</title></head><body>
+<h1>Guide</h1>
+<h3 id="x">Skipped</h3>
+<p id="x"><img src="logo.png"><img src="spacer.gif" alt=""></p>
+<a href="/next"><svg aria-hidden="true"><title>arrow</title></svg></a>
+<a href="/home"><img src="home.png" alt="Home"></a>
+<button></button><button aria-label="Close"></button>
+<label for="q">Query</label><input id="q"><input name="other"><input type="submit">
+<label>Name <input name="name"></label>
+<div aria-hidden="true"><img src="decor.png"></div>
+</body></html>`
+
+	issues, err := CheckPageAccessibility(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int)
+	for _, issue := range issues {
+		got[issue.Rule] = issue.Count
+	}
+	want := map[string]int{
+		"html-lang":     1,
+		"heading-order": 1,
+		"duplicate-id":  1,
+		"image-alt":     1,
+		"link-name":     1,
+		"button-name":   1,
+		"form-label":    1,
+	}
+	for rule, count := range want {
+		if got[rule] != count {
+			t.Errorf("%s: expected %d, got %d", rule, count, got[rule])
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("unexpected issues %+v", issues)
+	}
+	for _, issue := range issues {
+		if issue.Rule == "image-alt" && issue.Example != `<img src="logo.png">` {
+			t.Errorf("expected the first offending image as example, got %q", issue.Example)
+		}
+	}
+}
+
+func TestCheckAccessibility(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "guide"), 0755)
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte(`<html lang="en"><head><title>Home</title></head><body><h1>Home</h1></body></html>`), 0644)
+	os.WriteFile(filepath.Join(dir, "guide", "intro.html"), []byte(`<html lang="en"><body><img src="a.png"></body></html>`), 0644)
+	os.WriteFile(filepath.Join(dir, "style.css"), []byte("body {}"), 0644)
+
+	report, err := CheckAccessibility(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Pages != 2 || report.Total() != 2 {
+		t.Fatalf("expected 2 issues on 2 pages, got %d on %d: %+v", report.Total(), report.Pages, report.Issues)
+	}
+	for _, issue := range report.Issues {
+		if issue.Page != "guide/intro.html" {
+			t.Errorf("unexpected issue on %s: %+v", issue.Page, issue)
+		}
+	}
+
+	reportDir := filepath.Join(t.TempDir(), "attachments")
+	if _, err := ReadAccessibilityReport(reportDir); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a missing report to be fs.ErrNotExist, got %v", err)
+	}
+	if err := WriteAccessibilityReport(reportDir, report); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ReadAccessibilityReport(reportDir)
+	if err != nil || saved.Total() != 2 || saved.Pages != 2 {
+		t.Errorf("expected the report to round-trip, got %+v, %v", saved, err)
+	}
+}
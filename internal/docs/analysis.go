@@ -0,0 +1,297 @@
+package docs
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/token/stop"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
+	tokenmap "github.com/blevesearch/bleve/v2/analysis/tokenmap"
+	"github.com/blevesearch/bleve/v2/mapping"
+
+	// Token filters of the supported languages
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/da"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/de"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/en"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/es"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/fi"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/fr"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/it"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/nl"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/no"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/pt"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/ru"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/sv"
+)
+
+// indexSchemaVersion is the version of the index mapping. Indexes created
+// with an older version, or with other analysis settings, are outdated
+// and must be rebuilt for the current settings to apply. Version 1 is the
+// mapping from before the analysis was configurable, which did not record
+// its schema.
+const indexSchemaVersion = 2
+
+// schemaKey is the internal key of the index schema in the index.
+var schemaKey = []byte("asiakirjat.schema")
+
+// Analysis configures how the text of pages is split into the terms that
+// searches match.
+type Analysis struct {
+	// Language is the language of the text, one of Languages, or empty
+	// for language-neutral analysis with English stop words.
+	Language string `json:"language,omitempty"`
+	// Stemming reduces words to their stem, so that e.g. "configuring"
+	// finds "configured". Only applies with a Language.
+	Stemming bool `json:"stemming"`
+	// StopWords leaves out the language's most common words.
+	StopWords bool `json:"stop_words"`
+	// ExtraStopWords are further words left out, e.g. the product name.
+	ExtraStopWords []string `json:"extra_stop_words,omitempty"`
+}
+
+// DefaultAnalysis is the analysis of indexes created before it was
+// configurable.
+var DefaultAnalysis = Analysis{Stemming: true, StopWords: true}
+
+// languageFilters are the token filters of a language, applied after
+// lowercasing.
+type languageFilters struct {
+	before  []string // before the stop words are removed
+	stop    string
+	after   []string // after the stop words are removed, before stemming
+	stemmer string
+}
+
+var languages = map[string]languageFilters{
+	"da": {stop: "stop_da", stemmer: "stemmer_da_snowball"},
+	"de": {stop: "stop_de", after: []string{"normalize_de"}, stemmer: "stemmer_de_light"},
+	"en": {before: []string{"possessive_en"}, stop: "stop_en", stemmer: "stemmer_en_snowball"},
+	"es": {stop: "stop_es", after: []string{"normalize_es"}, stemmer: "stemmer_es_light"},
+	"fi": {stop: "stop_fi", stemmer: "stemmer_fi_snowball"},
+	"fr": {before: []string{"elision_fr"}, stop: "stop_fr", stemmer: "stemmer_fr_light"},
+	"it": {before: []string{"elision_it"}, stop: "stop_it", stemmer: "stemmer_it_light"},
+	"nl": {stop: "stop_nl", stemmer: "stemmer_nl_snowball"},
+	"no": {stop: "stop_no", stemmer: "stemmer_no_snowball"},
+	"pt": {stop: "stop_pt", stemmer: "stemmer_pt_light"},
+	"ru": {stop: "stop_ru", stemmer: "stemmer_ru_snowball"},
+	"sv": {stop: "stop_sv", stemmer: "stemmer_sv_snowball"},
+}
+
+// Languages returns the supported analysis languages.
+func Languages() []string {
+	return slices.Sorted(maps.Keys(languages))
+}
+
+// Validate checks that the language is supported.
+func (a Analysis) Validate() error {
+	if _, ok := languages[a.Language]; a.Language != "" && !ok {
+		return fmt.Errorf("unsupported search language %q, use one of %s", a.Language, strings.Join(Languages(), ", "))
+	}
+	return nil
+}
+
+// normalized returns a with the settings that have no effect cleared, so
+// that equal analyses compare equal.
+func (a Analysis) normalized() Analysis {
+	if a.Language == "" {
+		a.Stemming = false
+	}
+	var words []string
+	for _, w := range a.ExtraStopWords {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			words = append(words, w)
+		}
+	}
+	slices.Sort(words)
+	a.ExtraStopWords = slices.Compact(words)
+	return a
+}
+
+func (a Analysis) equal(b Analysis) bool {
+	a, b = a.normalized(), b.normalized()
+	return a.Language == b.Language && a.Stemming == b.Stemming && a.StopWords == b.StopWords &&
+		slices.Equal(a.ExtraStopWords, b.ExtraStopWords)
+}
+
+// analyzerName returns the name of the analyzer of a in the index mapping.
+// The language-neutral analysis with stop words is bleve's standard
+// analyzer, which indexes of schema version 1 use.
+func (a Analysis) analyzerName() string {
+	a = a.normalized()
+	if a.Language == "" && a.StopWords && len(a.ExtraStopWords) == 0 {
+		return standard.Name
+	}
+	name := "text"
+	if a.Language != "" {
+		name += "_" + a.Language
+	}
+	if a.Stemming {
+		name += "_stem"
+	}
+	if a.StopWords {
+		name += "_stop"
+	}
+	if len(a.ExtraStopWords) > 0 {
+		h := fnv.New32a()
+		h.Write([]byte(strings.Join(a.ExtraStopWords, "\n")))
+		name += fmt.Sprintf("_%08x", h.Sum32())
+	}
+	return name
+}
+
+// unstemmed returns a without stemming. Stemmed text is also indexed
+// unstemmed, so that suggestions complete words rather than stems.
+func (a Analysis) unstemmed() Analysis {
+	a.Stemming = false
+	return a
+}
+
+// addAnalyzer adds the analyzer of a to the index mapping.
+func (a Analysis) addAnalyzer(m *mapping.IndexMappingImpl) error {
+	a = a.normalized()
+	name := a.analyzerName()
+	if name == standard.Name {
+		return nil
+	}
+	lang := languages[a.Language]
+	filters := append([]string{lowercase.Name}, lang.before...)
+	if a.StopWords {
+		filters = append(filters, cmp.Or(lang.stop, "stop_en"))
+	}
+	if len(a.ExtraStopWords) > 0 {
+		tokens := make([]any, len(a.ExtraStopWords))
+		for i, w := range a.ExtraStopWords {
+			tokens[i] = w
+		}
+		if err := m.AddCustomTokenMap(name+"_words", map[string]any{"type": tokenmap.Name, "tokens": tokens}); err != nil {
+			return err
+		}
+		if err := m.AddCustomTokenFilter(name+"_stop_extra", map[string]any{"type": stop.Name, "stop_token_map": name + "_words"}); err != nil {
+			return err
+		}
+		filters = append(filters, name+"_stop_extra")
+	}
+	filters = append(filters, lang.after...)
+	if a.Stemming {
+		filters = append(filters, lang.stemmer)
+	}
+	tokenFilters := make([]any, len(filters))
+	for i, f := range filters {
+		tokenFilters[i] = f
+	}
+	return m.AddCustomAnalyzer(name, map[string]any{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": tokenFilters,
+	})
+}
+
+// IndexOptions configures a search index.
+type IndexOptions struct {
+	Analysis Analysis
+	// Projects overrides the analysis of projects, by slug.
+	Projects map[string]Analysis
+}
+
+// Validate checks the analysis settings.
+func (o IndexOptions) Validate() error {
+	if err := o.Analysis.Validate(); err != nil {
+		return err
+	}
+	for slug, a := range o.Projects {
+		if err := a.Validate(); err != nil {
+			return fmt.Errorf("project %s: %w", slug, err)
+		}
+	}
+	return nil
+}
+
+// indexSchema records how an index was created.
+type indexSchema struct {
+	Version  int                 `json:"version"`
+	Analysis Analysis            `json:"analysis"`
+	Projects map[string]Analysis `json:"projects,omitempty"`
+}
+
+func newIndexSchema(opts IndexOptions) indexSchema {
+	return indexSchema{Version: indexSchemaVersion, Analysis: opts.Analysis, Projects: opts.Projects}
+}
+
+// legacySchema is the schema of indexes that did not record theirs.
+var legacySchema = indexSchema{Version: 1, Analysis: DefaultAnalysis}
+
+func (s indexSchema) equal(o indexSchema) bool {
+	if s.Version != o.Version || !s.Analysis.equal(o.Analysis) || len(s.Projects) != len(o.Projects) {
+		return false
+	}
+	for slug, a := range s.Projects {
+		b, ok := o.Projects[slug]
+		if !ok || !a.equal(b) {
+			return false
+		}
+	}
+	return true
+}
+
+// analysis returns the analysis of a project's pages.
+func (s indexSchema) analysis(projectSlug string) Analysis {
+	if a, ok := s.Projects[projectSlug]; ok {
+		return a
+	}
+	return s.Analysis
+}
+
+// docType returns the document type of a project's pages in the index
+// mapping: empty for the default analysis, else the analyzer name.
+func (s indexSchema) docType(projectSlug string) string {
+	a, ok := s.Projects[projectSlug]
+	if !ok || a.equal(s.Analysis) {
+		return ""
+	}
+	return a.analyzerName()
+}
+
+// analyses returns the distinct analyses of the schema, the default first.
+func (s indexSchema) analyses() []Analysis {
+	all := []Analysis{s.Analysis}
+	for _, slug := range slices.Sorted(maps.Keys(s.Projects)) {
+		a := s.Projects[slug]
+		if !slices.ContainsFunc(all, a.equal) {
+			all = append(all, a)
+		}
+	}
+	return all
+}
+
+// textAnalyzers returns the analyzers of the page text, for queries to
+// analyze their text the way each project's pages were.
+func (s indexSchema) textAnalyzers() []string {
+	var names []string
+	for _, a := range s.analyses() {
+		names = append(names, a.analyzerName())
+	}
+	return names
+}
+
+func (s indexSchema) encode() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+func decodeIndexSchema(data []byte) (indexSchema, error) {
+	if len(data) == 0 {
+		return legacySchema, nil
+	}
+	var s indexSchema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return indexSchema{}, fmt.Errorf("decoding search index schema: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,137 @@
+package docs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAnalysis(t *testing.T) {
+	base := t.TempDir()
+	ctx := context.Background()
+
+	projects := []ReindexProject{{ID: 1, Slug: "guide", Name: "Guide"}, {ID: 2, Slug: "opas", Name: "Opas"}}
+	var versions []ReindexVersion
+	for i, page := range []string{
+		"<html><head><title>Configuring widgets</title></head><body><p>The widgets are configured here.</p></body></html>",
+		"<html><head><title>Asennus</title></head><body><p>Ohjelma asennetaan taloissa.</p></body></html>",
+	} {
+		dir := filepath.Join(base, projects[i].Slug, "1.0")
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "index.html"), []byte(page), 0644)
+		versions = append(versions, ReindexVersion{ID: int64(i + 1), ProjectID: projects[i].ID, Tag: "1.0", StoragePath: dir})
+	}
+	search := func(si *SearchIndex, q string) []string {
+		t.Helper()
+		results, err := si.Search(ctx, SearchQuery{Query: q, AllVersions: true}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var slugs []string
+		for _, r := range results.Results {
+			slugs = append(slugs, r.ProjectSlug)
+		}
+		return slugs
+	}
+
+	si, err := NewSearchIndex(filepath.Join(base, "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := si.ReindexAll(ctx, projects, versions); err != nil {
+		t.Fatal(err)
+	}
+	if slugs := search(si, "configuration"); len(slugs) != 0 {
+		t.Errorf("expected no stemming by default, got %v", slugs)
+	}
+	si.Close()
+
+	// Reopened with other settings, the index keeps its own until rebuilt
+	opts := IndexOptions{
+		Analysis: Analysis{Language: "en", Stemming: true, StopWords: true},
+		Projects: map[string]Analysis{"opas": {Language: "fi", Stemming: true, StopWords: true}},
+	}
+	si, err = NewSearchIndexWithOptions(filepath.Join(base, "index"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { si.Close() }()
+	if !si.Outdated() {
+		t.Fatal("expected the index to be outdated")
+	}
+	if change := si.AnalysisChange(); change != "language none → en, opas: language none → fi" {
+		t.Errorf("unexpected change %q", change)
+	}
+	if slugs := search(si, "configuration"); len(slugs) != 0 {
+		t.Errorf("expected the old analysis until the rebuild, got %v", slugs)
+	}
+
+	if err := si.ReindexAll(ctx, projects, versions); err != nil {
+		t.Fatal(err)
+	}
+	if si.Outdated() {
+		t.Error("expected the rebuild to apply the settings")
+	}
+	if slugs := search(si, "configuration"); !slices.Equal(slugs, []string{"guide"}) {
+		t.Errorf("expected English stemming to find the guide, got %v", slugs)
+	}
+	if slugs := search(si, "talossa"); !slices.Equal(slugs, []string{"opas"}) {
+		t.Errorf("expected Finnish stemming to find the opas, got %v", slugs)
+	}
+
+	suggestions, err := si.Suggest(ctx, SearchQuery{Query: "conf", AllVersions: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var terms []string
+	for _, s := range suggestions {
+		terms = append(terms, s.Terms...)
+	}
+	slices.Sort(terms)
+	if !slices.Equal(terms, []string{"configured", "configuring"}) {
+		t.Errorf("expected words rather than stems to be suggested, got %v", terms)
+	}
+
+	// Reopened with the same settings, the index is up to date
+	si.Close()
+	si, err = NewSearchIndexWithOptions(filepath.Join(base, "index"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si.Outdated() {
+		t.Error("expected the schema to be kept in the index")
+	}
+
+	if _, err := NewSearchIndexWithOptions(filepath.Join(t.TempDir(), "index"), IndexOptions{Analysis: Analysis{Language: "xx"}}); err == nil || !strings.Contains(err.Error(), "unsupported search language") {
+		t.Errorf("expected unknown languages to be rejected, got %v", err)
+	}
+}
+
+func TestExtraStopWords(t *testing.T) {
+	base := t.TempDir()
+	ctx := context.Background()
+	si, err := NewSearchIndexWithOptions(filepath.Join(base, "index"), IndexOptions{Analysis: Analysis{StopWords: true, ExtraStopWords: []string{"Acme"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer si.Close()
+
+	dir := filepath.Join(base, "guide", "1.0")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html><body>Acme widgets</body></html>"), 0644)
+	if err := si.IndexVersion(ctx, 1, 1, "guide", "Guide", "1.0", dir); err != nil {
+		t.Fatal(err)
+	}
+	for q, want := range map[string]uint64{"widgets": 1, "acme": 0} {
+		results, err := si.Search(ctx, SearchQuery{Query: q, AllVersions: true}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results.Total != want {
+			t.Errorf("search %q: expected %d results, got %d", q, want, results.Total)
+		}
+	}
+}
@@ -6,9 +6,14 @@ import (
 	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -16,42 +21,250 @@ import (
 	"github.com/ulikunitz/xz"
 )
 
-const maxFileSize = 100 << 20 // 100 MB per file
+// ExtractLimits bounds what an archive may expand to, protecting the server
+// from zip bombs. A zero value disables the corresponding limit.
+type ExtractLimits struct {
+	MaxFileSize  int64 // bytes per extracted file
+	MaxTotalSize int64 // bytes across all extracted files
+	MaxFiles     int   // number of extracted files
+}
+
+// DefaultExtractLimits are used by ExtractArchive.
+var DefaultExtractLimits = ExtractLimits{
+	MaxFileSize:  100 << 20, // 100 MB
+	MaxTotalSize: 1 << 30,   // 1 GB
+	MaxFiles:     10000,
+}
+
+// ErrExtractLimit is returned when an archive exceeds its ExtractLimits.
+var ErrExtractLimit = errors.New("archive exceeds extraction limits")
+
+// ExtractOptions controls how an archive is extracted.
+type ExtractOptions struct {
+	Limits ExtractLimits
+	// KeepSingleRoot extracts archives whose entries all live below one
+	// top-level directory as they are, instead of flattening that directory.
+	KeepSingleRoot bool
+	// Manifest, if set, receives the extracted files, which are hashed
+	// while they are written.
+	Manifest *Manifest
+	// SanitizeHTML strips scripts from HTML and SVG files, see SanitizeHTML.
+	SanitizeHTML bool
+}
 
 // ExtractArchive detects the archive format from the filename and extracts to destDir.
 func ExtractArchive(r io.Reader, filename, destDir string) error {
+	return ExtractArchiveWithLimits(r, filename, destDir, DefaultExtractLimits)
+}
+
+// ExtractArchiveWithLimits is ExtractArchive with explicit limits.
+func ExtractArchiveWithLimits(r io.Reader, filename, destDir string, limits ExtractLimits) error {
+	return ExtractArchiveWithOptions(r, filename, destDir, ExtractOptions{Limits: limits})
+}
+
+// ExtractArchiveWithOptions is ExtractArchive with explicit options. Zip and
+// 7z archives are read in place when r is an io.ReaderAt and io.Seeker (such
+// as an *os.File or multipart.File); otherwise they are spooled to a temp file.
+// Unless opts.KeepSingleRoot is set, an archive with a single top-level
+// directory, such as dist/, is extracted from that directory.
+func ExtractArchiveWithOptions(r io.Reader, filename, destDir string, opts ExtractOptions) error {
 	lower := strings.ToLower(filename)
+	e := &extractor{destDir: destDir, limits: opts.Limits, keepRoot: opts.KeepSingleRoot, sanitize: opts.SanitizeHTML, sums: make(map[string]ManifestEntry)}
 
+	var err error
 	switch {
 	case strings.HasSuffix(lower, ".zip"):
-		return extractZip(r, destDir)
+		err = e.extractZip(r)
 	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
-		return extractTarGz(r, destDir)
+		err = e.extractTarGz(r)
 	case strings.HasSuffix(lower, ".tar.bz2") || strings.HasSuffix(lower, ".tbz2"):
-		return extractTarBz2(r, destDir)
+		err = e.extractTarBz2(r)
 	case strings.HasSuffix(lower, ".tar.xz") || strings.HasSuffix(lower, ".txz"):
-		return extractTarXz(r, destDir)
+		err = e.extractTarXz(r)
 	case strings.HasSuffix(lower, ".7z"):
-		return extract7z(r, destDir)
+		err = e.extract7z(r)
 	default:
 		return fmt.Errorf("unsupported archive format: %s", filename)
 	}
+	if err == nil && opts.Manifest != nil {
+		*opts.Manifest = e.manifest()
+	}
+	return err
+}
+
+// extractor writes archive entries below destDir and enforces limits.
+type extractor struct {
+	destDir  string
+	limits   ExtractLimits
+	keepRoot bool
+	sanitize bool
+	files    int
+	total    int64
+	sums     map[string]ManifestEntry // by path below destDir
+	// flattened is the top-level directory moved up into destDir, if any
+	flattened string
+}
+
+// manifest returns the files written, at their final paths.
+func (e *extractor) manifest() Manifest {
+	m := make(Manifest, 0, len(e.sums))
+	for _, entry := range e.sums {
+		if e.flattened != "" {
+			entry.Path = strings.TrimPrefix(entry.Path, e.flattened+"/")
+		}
+		m = append(m, entry)
+	}
+	m.sort()
+	return m
+}
+
+// writeFile copies one archive entry to target, counting it against the limits.
+func (e *extractor) writeFile(src io.Reader, target, name string) error {
+	e.files++
+	if e.limits.MaxFiles > 0 && e.files > e.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrExtractLimit, e.limits.MaxFiles)
+	}
+
+	// Read one byte past the smallest remaining allowance to detect overflow
+	allowed := int64(-1)
+	if e.limits.MaxFileSize > 0 {
+		allowed = e.limits.MaxFileSize
+	}
+	if e.limits.MaxTotalSize > 0 {
+		remaining := e.limits.MaxTotalSize - e.total
+		if allowed < 0 || remaining < allowed {
+			allowed = remaining
+		}
+	}
+	if allowed >= 0 {
+		src = io.LimitReader(src, allowed+1)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+	// A file of a re-uploaded version may be hard-linked to the blobs of
+	// deduplicated storage, so it is replaced rather than overwritten.
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("replacing file: %w", err)
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("creating file: %w", err)
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, hash), src)
+	if err != nil {
+		return fmt.Errorf("writing file: %w", err)
+	}
+	e.total += n
+	if allowed >= 0 && n > allowed {
+		if e.limits.MaxFileSize > 0 && n > e.limits.MaxFileSize {
+			return fmt.Errorf("%w: %s is larger than %d bytes", ErrExtractLimit, name, e.limits.MaxFileSize)
+		}
+		return fmt.Errorf("%w: extracted size exceeds %d bytes", ErrExtractLimit, e.limits.MaxTotalSize)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if e.sanitize {
+		if n, sum, err = e.sanitizeFile(out, target, n, sum); err != nil {
+			return fmt.Errorf("sanitizing %s: %w", name, err)
+		}
+	}
+	if rel, err := filepath.Rel(e.destDir, target); err == nil {
+		rel = filepath.ToSlash(rel)
+		e.sums[rel] = ManifestEntry{Path: rel, Size: n, SHA256: sum}
+	}
+	return nil
+}
+
+// sanitizeFile rewrites the extracted file out, at target, with
+// SanitizeHTML if it is sanitized, see sanitizedCodec, and returns its size
+// and hash. Other files keep their size n and hash sum.
+func (e *extractor) sanitizeFile(out *os.File, target string, n int64, sum string) (int64, string, error) {
+	codec, ok := sanitizedCodec(target)
+	if !ok {
+		return n, sum, nil
+	}
+	f, err := os.Open(target)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	src, err := codec.reader(f, e.limits.MaxFileSize)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var clean bytes.Buffer
+	dst := codec.writer(&clean)
+	if err := SanitizeHTML(dst, src); err != nil {
+		return 0, "", err
+	}
+	if err := dst.Close(); err != nil {
+		return 0, "", err
+	}
+	if err := out.Truncate(0); err != nil {
+		return 0, "", err
+	}
+	if _, err := out.WriteAt(clean.Bytes(), 0); err != nil {
+		return 0, "", err
+	}
+	hash := sha256.Sum256(clean.Bytes())
+	return int64(clean.Len()), hex.EncodeToString(hash[:]), nil
+}
+
+// readerAt returns r as an io.ReaderAt with its size. Readers without random
+// access are copied to a temp file; the returned cleanup func removes it.
+func readerAt(r io.Reader) (io.ReaderAt, int64, func(), error) {
+	if ra, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		size, err := ra.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("determining archive size: %w", err)
+		}
+		if _, err := ra.Seek(0, io.SeekStart); err != nil {
+			return nil, 0, nil, fmt.Errorf("rewinding archive: %w", err)
+		}
+		return ra, size, func() {}, nil
+	}
+
+	tmp, err := os.CreateTemp("", "asiakirjat-archive-*")
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("creating temp file: %w", err)
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, fmt.Errorf("spooling archive: %w", err)
+	}
+	return tmp, size, cleanup, nil
 }
 
-func extractZip(r io.Reader, destDir string) error {
-	// zip.Reader needs io.ReaderAt, so we buffer to memory/disk
-	data, err := io.ReadAll(io.LimitReader(r, maxFileSize*10))
+func (e *extractor) extractZip(r io.Reader) error {
+	ra, size, cleanup, err := readerAt(r)
 	if err != nil {
-		return fmt.Errorf("reading zip data: %w", err)
+		return err
 	}
+	defer cleanup()
 
-	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	zr, err := zip.NewReader(ra, size)
 	if err != nil {
 		return fmt.Errorf("opening zip: %w", err)
 	}
 
 	// Detect single root directory for flattening
-	prefix := detectSingleRoot(zr)
+	var prefix string
+	if !e.keepRoot {
+		prefix = detectSingleRoot(zr)
+	}
 
 	for _, f := range zr.File {
 		name := f.Name
@@ -62,10 +275,10 @@ func extractZip(r io.Reader, destDir string) error {
 			}
 		}
 
-		target := filepath.Join(destDir, name)
+		target := filepath.Join(e.destDir, name)
 
 		// Zip-slip protection
-		if !isPathSafe(destDir, target) {
+		if !isPathSafe(e.destDir, target) {
 			return fmt.Errorf("zip-slip detected: %s", f.Name)
 		}
 
@@ -79,11 +292,7 @@ func extractZip(r io.Reader, destDir string) error {
 			continue
 		}
 
-		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-			return fmt.Errorf("creating directory: %w", err)
-		}
-
-		if err := extractZipFile(f, target); err != nil {
+		if err := e.extractZipFile(f, target); err != nil {
 			return err
 		}
 	}
@@ -91,24 +300,14 @@ func extractZip(r io.Reader, destDir string) error {
 	return nil
 }
 
-func extractZipFile(f *zip.File, target string) error {
+func (e *extractor) extractZipFile(f *zip.File, target string) error {
 	rc, err := f.Open()
 	if err != nil {
 		return fmt.Errorf("opening zip entry: %w", err)
 	}
 	defer rc.Close()
 
-	out, err := os.Create(target)
-	if err != nil {
-		return fmt.Errorf("creating file: %w", err)
-	}
-	defer out.Close()
-
-	if _, err := io.Copy(out, io.LimitReader(rc, maxFileSize)); err != nil {
-		return fmt.Errorf("writing file: %w", err)
-	}
-
-	return nil
+	return e.writeFile(rc, target, f.Name)
 }
 
 func detectSingleRoot(zr *zip.Reader) string {
@@ -136,43 +335,46 @@ func detectSingleRoot(zr *zip.Reader) string {
 	return ""
 }
 
-func extractTarGz(r io.Reader, destDir string) error {
+func (e *extractor) extractTarGz(r io.Reader) error {
 	gr, err := gzip.NewReader(r)
 	if err != nil {
 		return fmt.Errorf("opening gzip: %w", err)
 	}
 	defer gr.Close()
 
-	return extractTar(gr, destDir)
+	return e.extractTar(gr)
 }
 
-func extractTarBz2(r io.Reader, destDir string) error {
+func (e *extractor) extractTarBz2(r io.Reader) error {
 	br := bzip2.NewReader(r)
-	return extractTar(br, destDir)
+	return e.extractTar(br)
 }
 
-func extractTarXz(r io.Reader, destDir string) error {
+func (e *extractor) extractTarXz(r io.Reader) error {
 	xr, err := xz.NewReader(r)
 	if err != nil {
 		return fmt.Errorf("opening xz: %w", err)
 	}
-	return extractTar(xr, destDir)
+	return e.extractTar(xr)
 }
 
-func extract7z(r io.Reader, destDir string) error {
-	// sevenzip.Reader needs io.ReaderAt, so we buffer to memory
-	data, err := io.ReadAll(io.LimitReader(r, maxFileSize*10))
+func (e *extractor) extract7z(r io.Reader) error {
+	ra, size, cleanup, err := readerAt(r)
 	if err != nil {
-		return fmt.Errorf("reading 7z data: %w", err)
+		return err
 	}
+	defer cleanup()
 
-	szr, err := sevenzip.NewReader(bytes.NewReader(data), int64(len(data)))
+	szr, err := sevenzip.NewReader(ra, size)
 	if err != nil {
 		return fmt.Errorf("opening 7z: %w", err)
 	}
 
 	// Detect single root directory for flattening
-	prefix := detectSingleRoot7z(szr)
+	var prefix string
+	if !e.keepRoot {
+		prefix = detectSingleRoot7z(szr)
+	}
 
 	for _, f := range szr.File {
 		name := f.Name
@@ -183,10 +385,10 @@ func extract7z(r io.Reader, destDir string) error {
 			}
 		}
 
-		target := filepath.Join(destDir, name)
+		target := filepath.Join(e.destDir, name)
 
 		// Path traversal protection
-		if !isPathSafe(destDir, target) {
+		if !isPathSafe(e.destDir, target) {
 			return fmt.Errorf("path traversal detected: %s", f.Name)
 		}
 
@@ -200,11 +402,7 @@ func extract7z(r io.Reader, destDir string) error {
 			continue
 		}
 
-		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-			return fmt.Errorf("creating directory: %w", err)
-		}
-
-		if err := extract7zFile(f, target); err != nil {
+		if err := e.extract7zFile(f, target); err != nil {
 			return err
 		}
 	}
@@ -212,24 +410,14 @@ func extract7z(r io.Reader, destDir string) error {
 	return nil
 }
 
-func extract7zFile(f *sevenzip.File, target string) error {
+func (e *extractor) extract7zFile(f *sevenzip.File, target string) error {
 	rc, err := f.Open()
 	if err != nil {
 		return fmt.Errorf("opening 7z entry: %w", err)
 	}
 	defer rc.Close()
 
-	out, err := os.Create(target)
-	if err != nil {
-		return fmt.Errorf("creating file: %w", err)
-	}
-	defer out.Close()
-
-	if _, err := io.Copy(out, io.LimitReader(rc, maxFileSize)); err != nil {
-		return fmt.Errorf("writing file: %w", err)
-	}
-
-	return nil
+	return e.writeFile(rc, target, f.Name)
 }
 
 func detectSingleRoot7z(szr *sevenzip.Reader) string {
@@ -256,9 +444,14 @@ func detectSingleRoot7z(szr *sevenzip.Reader) string {
 	return ""
 }
 
-func extractTar(r io.Reader, destDir string) error {
+// extractTar extracts a tar stream. Unlike zip and 7z, the entries of a tar
+// stream are only known once it has been read, so a single root directory
+// is flattened after extraction.
+func (e *extractor) extractTar(r io.Reader) error {
 	tr := tar.NewReader(r)
 
+	var root string
+	single := true
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
@@ -268,18 +461,16 @@ func extractTar(r io.Reader, destDir string) error {
 			return fmt.Errorf("reading tar: %w", err)
 		}
 
-		name := header.Name
-
-		// Strip leading single root if present
-		name = stripSingleRootTar(name)
-		if name == "" || name == "." {
+		// Archives made with "tar -C dir ." name their entries ./...
+		name := strings.TrimPrefix(path.Clean(header.Name), "/")
+		if name == "." || name == "" {
 			continue
 		}
 
-		target := filepath.Join(destDir, name)
+		target := filepath.Join(e.destDir, name)
 
 		// Path traversal protection
-		if !isPathSafe(destDir, target) {
+		if !isPathSafe(e.destDir, target) {
 			return fmt.Errorf("path traversal detected: %s", header.Name)
 		}
 
@@ -287,39 +478,60 @@ func extractTar(r io.Reader, destDir string) error {
 		case tar.TypeDir:
 			os.MkdirAll(target, 0755)
 		case tar.TypeReg:
-			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-				return fmt.Errorf("creating directory: %w", err)
-			}
-
-			out, err := os.Create(target)
-			if err != nil {
-				return fmt.Errorf("creating file: %w", err)
+			if err := e.writeFile(tr, target, header.Name); err != nil {
+				return err
 			}
-
-			if _, err := io.Copy(out, io.LimitReader(tr, maxFileSize)); err != nil {
-				out.Close()
-				return fmt.Errorf("writing file: %w", err)
-			}
-			out.Close()
 		default:
 			// Skip symlinks and other special types
 			continue
 		}
+
+		first, _, nested := strings.Cut(name, "/")
+		if !nested && header.Typeflag != tar.TypeDir {
+			single = false // file at root level
+		}
+		if root == "" {
+			root = first
+		} else if first != root {
+			single = false // multiple roots
+		}
 	}
 
-	return nil
+	if e.keepRoot || !single || root == "" {
+		return nil
+	}
+	e.flattened = root
+	return flattenDir(e.destDir, root)
 }
 
-// stripSingleRootTar is a simple heuristic: if the path starts with
-// a directory name followed by /, strip that prefix.
-// This handles the common case of tarballs with a single root directory.
-func stripSingleRootTar(name string) string {
-	// This is a simplified approach — strips first component if it looks like a single root
-	parts := strings.SplitN(name, "/", 2)
-	if len(parts) == 2 && parts[1] != "" {
-		return parts[1]
+// flattenDir moves the contents of destDir/root up into destDir, replacing
+// what is there. root is first moved aside so that it may contain an entry
+// of its own name.
+func flattenDir(destDir, root string) error {
+	tmp, err := os.MkdirTemp(destDir, ".flatten-")
+	if err != nil {
+		return fmt.Errorf("flattening %s: %w", root, err)
+	}
+	defer os.RemoveAll(tmp)
+
+	moved := filepath.Join(tmp, "root")
+	if err := os.Rename(filepath.Join(destDir, root), moved); err != nil {
+		return fmt.Errorf("flattening %s: %w", root, err)
+	}
+	entries, err := os.ReadDir(moved)
+	if err != nil {
+		return fmt.Errorf("flattening %s: %w", root, err)
 	}
-	return name
+	for _, entry := range entries {
+		target := filepath.Join(destDir, entry.Name())
+		if err := os.RemoveAll(target); err != nil {
+			return fmt.Errorf("flattening %s: %w", root, err)
+		}
+		if err := os.Rename(filepath.Join(moved, entry.Name()), target); err != nil {
+			return fmt.Errorf("flattening %s: %w", root, err)
+		}
+	}
+	return nil
 }
 
 // WriteZipFromDir walks srcDir and streams its contents as a zip archive to w.
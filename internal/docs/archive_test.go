@@ -5,9 +5,11 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -132,6 +134,75 @@ func TestExtractTarGz(t *testing.T) {
 	}
 }
 
+// tarGzWithEntries builds a tar.gz with the given entries in order; names
+// ending in / are directories.
+func tarGzWithEntries(t *testing.T, names ...string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755})
+			continue
+		}
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(name))})
+		tw.Write([]byte(name))
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestExtractTarSingleRoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		keep    bool
+		want    []string
+	}{
+		{"single root", []string{"dist/", "dist/index.html", "dist/css/style.css"}, false, []string{"index.html", "css/style.css"}},
+		{"dot prefix", []string{"./", "./dist/", "./dist/index.html"}, false, []string{"index.html"}},
+		{"root named like its child", []string{"dist/dist/app.js", "dist/index.html"}, false, []string{"dist/app.js", "index.html"}},
+		{"file at root", []string{"index.html", "css/style.css"}, false, []string{"index.html", "css/style.css"}},
+		{"multiple roots", []string{"api/index.html", "guide/index.html"}, false, []string{"api/index.html", "guide/index.html"}},
+		{"kept", []string{"dist/index.html"}, true, []string{"dist/index.html"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := t.TempDir()
+			err := ExtractArchiveWithOptions(bytes.NewReader(tarGzWithEntries(t, tt.entries...)), "docs.tar.gz", dest, ExtractOptions{KeepSingleRoot: tt.keep})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.want {
+				if _, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name))); err != nil {
+					t.Errorf("expected %s to be extracted: %v", name, err)
+				}
+			}
+			entries, _ := os.ReadDir(dest)
+			for _, e := range entries {
+				if strings.HasPrefix(e.Name(), ".flatten-") {
+					t.Errorf("expected the temporary directory to be removed")
+				}
+			}
+		})
+	}
+}
+
+func TestExtractZipKeepSingleRoot(t *testing.T) {
+	dest := t.TempDir()
+	data := zipWithFiles(t, map[string]string{"dist/index.html": "<html>kept</html>"})
+
+	err := ExtractArchiveWithOptions(bytes.NewReader(data), "docs.zip", dest, ExtractOptions{KeepSingleRoot: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "dist", "index.html")); err != nil {
+		t.Errorf("expected the root directory to be kept: %v", err)
+	}
+}
+
 func TestExtractUnsupportedFormat(t *testing.T) {
 	dest := t.TempDir()
 	err := ExtractArchive(bytes.NewReader([]byte("not an archive")), "docs.rar", dest)
@@ -140,6 +211,71 @@ func TestExtractUnsupportedFormat(t *testing.T) {
 	}
 }
 
+func zipWithFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestExtractLimits(t *testing.T) {
+	data := zipWithFiles(t, map[string]string{
+		"a.html": strings.Repeat("a", 600),
+		"b.html": strings.Repeat("b", 600),
+		"c.html": "c",
+	})
+
+	tests := []struct {
+		name   string
+		limits ExtractLimits
+		ok     bool
+	}{
+		{"within limits", ExtractLimits{MaxFileSize: 1000, MaxTotalSize: 2000, MaxFiles: 3}, true},
+		{"file too large", ExtractLimits{MaxFileSize: 500}, false},
+		{"total too large", ExtractLimits{MaxTotalSize: 1000}, false},
+		{"too many files", ExtractLimits{MaxFiles: 2}, false},
+		{"unlimited", ExtractLimits{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ExtractArchiveWithLimits(bytes.NewReader(data), "docs.zip", t.TempDir(), tt.limits)
+			if tt.ok && err != nil {
+				t.Fatalf("expected success, got %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrExtractLimit) {
+				t.Fatalf("expected ErrExtractLimit, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractZipFromStream(t *testing.T) {
+	dest := t.TempDir()
+	data := zipWithFiles(t, map[string]string{"index.html": "<html>streamed</html>"})
+
+	// A plain io.Reader has no random access and is spooled to a temp file
+	err := ExtractArchive(io.MultiReader(bytes.NewReader(data)), "docs.zip", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dest, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "<html>streamed</html>" {
+		t.Errorf("unexpected content: %s", content)
+	}
+}
+
 func TestWriteZipFromDir(t *testing.T) {
 	// Create a temp directory with nested files
 	srcDir := t.TempDir()
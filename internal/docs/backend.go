@@ -0,0 +1,44 @@
+package docs
+
+import (
+	"context"
+	"errors"
+)
+
+// SearchBackend stores the documents of the search index and searches
+// them. SearchIndex extracts the documents from the files of versions and
+// keeps track of rebuilds; the backend only stores what it is given. The
+// embedded bleve index is the default, an external search engine can take
+// its place for large installations, see NewSearchIndexWithBackend.
+type SearchBackend interface {
+	// Index adds the documents of a version and records the content hash
+	// of the version, see IndexedHash.
+	Index(ctx context.Context, versionID int64, docs []Document, hash string) error
+	// DeleteVersion removes the documents and the hash of a version.
+	DeleteVersion(ctx context.Context, projectID, versionID int64) error
+	// DeleteAll removes all documents and hashes.
+	DeleteAll(ctx context.Context) error
+	// IndexedVersionIDs returns the IDs of the versions in the index.
+	IndexedVersionIDs(ctx context.Context) (map[int64]bool, error)
+	// IndexedHash returns the content hash a version was last indexed
+	// with, or "" if it is not known.
+	IndexedHash(ctx context.Context, versionID int64) (string, error)
+	// Search returns the documents matching sq, see SearchIndex.Search.
+	Search(ctx context.Context, sq SearchQuery, latestVersionTags map[string]string) (*SearchResults, error)
+	// Suggest returns the documents completing sq.Query as typed so far,
+	// see SearchIndex.Suggest.
+	Suggest(ctx context.Context, sq SearchQuery, latestVersionTags map[string]string) ([]Suggestion, error)
+	Close() error
+}
+
+// ErrSnapshotUnsupported is returned when exporting an index kept by an
+// external search engine, which has its own backups.
+var ErrSnapshotUnsupported = errors.New("search index snapshots are only supported for the embedded index")
+
+// NewSearchIndexWithBackend returns a search index that keeps its
+// documents in backend. The rebuild state is still kept next to indexPath.
+// The analysis settings only apply to the embedded index; an external
+// engine analyzes text its own way, and the index is never outdated.
+func NewSearchIndexWithBackend(indexPath string, backend SearchBackend) *SearchIndex {
+	return &SearchIndex{backend: backend, path: indexPath}
+}
@@ -0,0 +1,562 @@
+package docs
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/highlight/highlighter/html"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// bleveIndex is the embedded search backend, a bleve index below the
+// storage base path.
+type bleveIndex struct {
+	index bleve.Index
+	path  string
+
+	// mu guards index and schema, which change when a rebuild recreates
+	// the index for other analysis settings
+	mu     sync.RWMutex
+	schema indexSchema // how the index was created
+	wanted indexSchema // how it should be created, see Outdated
+}
+
+// openBleveIndex opens or creates a bleve index at path. An existing index
+// keeps the analysis it was created with until it is recreated.
+func openBleveIndex(path string, wanted indexSchema) (*bleveIndex, error) {
+	b := &bleveIndex{path: path, wanted: wanted}
+
+	idx, err := bleve.Open(path)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		if idx, err = createIndex(path, wanted); err != nil {
+			return nil, err
+		}
+		b.index, b.schema = idx, wanted
+		return b, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening search index: %w", err)
+	}
+
+	data, err := idx.GetInternal(schemaKey)
+	if err == nil {
+		b.schema, err = decodeIndexSchema(data)
+	}
+	if err != nil {
+		idx.Close()
+		return nil, fmt.Errorf("reading search index schema: %w", err)
+	}
+	b.index = idx
+	return b, nil
+}
+
+func buildIndexMapping(schema indexSchema) (*mapping.IndexMappingImpl, error) {
+	indexMapping := bleve.NewIndexMapping()
+	for _, a := range schema.analyses() {
+		if err := a.addAnalyzer(indexMapping); err != nil {
+			return nil, fmt.Errorf("adding analyzer: %w", err)
+		}
+		if a.normalized().Stemming {
+			if err := a.unstemmed().addAnalyzer(indexMapping); err != nil {
+				return nil, fmt.Errorf("adding analyzer: %w", err)
+			}
+		}
+	}
+
+	indexMapping.DefaultMapping = documentMapping(schema.Analysis)
+	for _, a := range schema.analyses()[1:] {
+		indexMapping.AddDocumentMapping(a.analyzerName(), documentMapping(a))
+	}
+
+	return indexMapping, nil
+}
+
+// documentMapping returns the mapping of pages analyzed with a.
+func documentMapping(a Analysis) *mapping.DocumentMapping {
+	docMapping := bleve.NewDocumentMapping()
+
+	textFieldMapping := bleve.NewTextFieldMapping()
+	textFieldMapping.Store = true
+	textFieldMapping.IncludeTermVectors = true
+	textFieldMapping.Analyzer = a.analyzerName()
+
+	keywordFieldMapping := bleve.NewKeywordFieldMapping()
+	keywordFieldMapping.Store = true
+
+	numericFieldMapping := bleve.NewNumericFieldMapping()
+	numericFieldMapping.Store = true
+	numericFieldMapping.Index = false
+
+	docMapping.AddFieldMappingsAt("project_slug", keywordFieldMapping)
+	docMapping.AddFieldMappingsAt("project_name", textFieldMapping)
+	docMapping.AddFieldMappingsAt("version_tag", keywordFieldMapping)
+	docMapping.AddFieldMappingsAt("file_path", keywordFieldMapping)
+	docMapping.AddFieldMappingsAt("page_title", textFieldMapping)
+	docMapping.AddFieldMappingsAt("text_content", textFieldMapping)
+	docMapping.AddFieldMappingsAt("project_id", numericFieldMapping)
+	docMapping.AddFieldMappingsAt("version_id", numericFieldMapping)
+	docMapping.AddFieldMappingsAt("page_number", numericFieldMapping)
+
+	if a.normalized().Stemming {
+		// The words as written, for suggestions
+		for _, field := range []string{"page_title", "text_content"} {
+			wordsMapping := bleve.NewTextFieldMapping()
+			wordsMapping.Name = field + wordsFieldSuffix
+			wordsMapping.Analyzer = a.unstemmed().analyzerName()
+			wordsMapping.IncludeTermVectors = true
+			wordsMapping.IncludeInAll = false
+			docMapping.AddFieldMappingsAt(field, textFieldMapping, wordsMapping)
+		}
+	}
+
+	// Labels are matched exactly, so index them unanalyzed
+	metaMapping := bleve.NewDocumentMapping()
+	metaMapping.DefaultAnalyzer = keyword.Name
+	docMapping.AddSubDocumentMapping("meta", metaMapping)
+
+	return docMapping
+}
+
+// wordsFieldSuffix names the unstemmed fields of stemmed text.
+const wordsFieldSuffix = "_words"
+
+// createIndex creates an index with schema at path.
+func createIndex(path string, schema indexSchema) (bleve.Index, error) {
+	m, err := buildIndexMapping(schema)
+	if err != nil {
+		return nil, fmt.Errorf("creating search index: %w", err)
+	}
+	idx, err := bleve.New(path, m)
+	if err != nil {
+		return nil, fmt.Errorf("creating search index: %w", err)
+	}
+	data, err := schema.encode()
+	if err == nil {
+		err = idx.SetInternal(schemaKey, data)
+	}
+	if err != nil {
+		idx.Close()
+		return nil, fmt.Errorf("saving search index schema: %w", err)
+	}
+	return idx, nil
+}
+
+// current returns the index and how it was created.
+func (b *bleveIndex) current() (bleve.Index, indexSchema) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.index, b.schema
+}
+
+// Outdated reports whether the index was created with other analysis
+// settings than configured, or an older schema. It uses the settings it
+// was created with until a rebuild recreates it, see ReindexAll.
+func (b *bleveIndex) Outdated() bool {
+	_, schema := b.current()
+	return !schema.equal(b.wanted)
+}
+
+// AnalysisChange describes the configured analysis that differs from the
+// index's, e.g. "language en → fi", for admins; it is empty if the index
+// is up to date or only its schema version is old.
+func (b *bleveIndex) AnalysisChange() string {
+	_, schema := b.current()
+	var changes []string
+	describe := func(prefix string, from, to Analysis) {
+		from, to = from.normalized(), to.normalized()
+		if from.Language != to.Language {
+			changes = append(changes, fmt.Sprintf("%slanguage %s → %s", prefix, cmp.Or(from.Language, "none"), cmp.Or(to.Language, "none")))
+		}
+		if from.Language == to.Language && from.Stemming != to.Stemming {
+			changes = append(changes, fmt.Sprintf("%sstemming %s", prefix, onOff(to.Stemming)))
+		}
+		if from.StopWords != to.StopWords {
+			changes = append(changes, fmt.Sprintf("%sstop words %s", prefix, onOff(to.StopWords)))
+		}
+		if !slices.Equal(from.ExtraStopWords, to.ExtraStopWords) {
+			changes = append(changes, prefix+"extra stop words")
+		}
+	}
+	describe("", schema.Analysis, b.wanted.Analysis)
+	slugs := slices.Sorted(maps.Keys(b.wanted.Projects))
+	for slug := range schema.Projects {
+		if _, ok := b.wanted.Projects[slug]; !ok {
+			slugs = append(slugs, slug)
+		}
+	}
+	for _, slug := range slugs {
+		describe(slug+": ", schema.analysis(slug), b.wanted.analysis(slug))
+	}
+	return strings.Join(changes, ", ")
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// recreate replaces the index with an empty one created with the
+// configured settings.
+func (b *bleveIndex) recreate() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.index.Close(); err != nil {
+		return fmt.Errorf("closing search index: %w", err)
+	}
+	if err := os.RemoveAll(b.path); err != nil {
+		return fmt.Errorf("removing search index: %w", err)
+	}
+	idx, err := createIndex(b.path, b.wanted)
+	if err != nil {
+		return err
+	}
+	b.index, b.schema = idx, b.wanted
+	return nil
+}
+
+// Index adds the documents of a version, and its content hash in the same
+// batch.
+func (b *bleveIndex) Index(ctx context.Context, versionID int64, docs []Document, hash string) error {
+	idx, schema := b.current()
+	batch := idx.NewBatch()
+	for _, doc := range docs {
+		doc.docType = schema.docType(doc.ProjectSlug)
+		if err := batch.Index(doc.ID, doc); err != nil {
+			return fmt.Errorf("indexing %s: %w", doc.ID, err)
+		}
+	}
+	batch.SetInternal(hashKey(versionID), []byte(hash))
+
+	if err := idx.Batch(batch); err != nil {
+		return fmt.Errorf("indexing batch: %w", err)
+	}
+	return nil
+}
+
+// IndexedHash returns the content hash stored with the version's
+// documents.
+func (b *bleveIndex) IndexedHash(ctx context.Context, versionID int64) (string, error) {
+	idx, _ := b.current()
+	data, err := idx.GetInternal(hashKey(versionID))
+	if err != nil {
+		return "", fmt.Errorf("reading content hash: %w", err)
+	}
+	return string(data), nil
+}
+
+// DeleteVersion removes all indexed documents for a given version.
+func (b *bleveIndex) DeleteVersion(ctx context.Context, projectID, versionID int64) error {
+	prefix := fmt.Sprintf("%d/%d/", projectID, versionID)
+
+	q := bleve.NewMatchAllQuery()
+	req := bleve.NewSearchRequest(q)
+	req.Size = 10000
+	req.Fields = []string{}
+
+	idx, _ := b.current()
+	results, err := idx.SearchInContext(ctx, req)
+	if err != nil {
+		return fmt.Errorf("searching for version docs: %w", err)
+	}
+
+	batch := idx.NewBatch()
+	for _, hit := range results.Hits {
+		if strings.HasPrefix(hit.ID, prefix) {
+			batch.Delete(hit.ID)
+		}
+	}
+	batch.DeleteInternal(hashKey(versionID))
+
+	if err := idx.Batch(batch); err != nil {
+		return fmt.Errorf("deleting version docs: %w", err)
+	}
+
+	return nil
+}
+
+// IndexedVersionIDs returns the set of version IDs that have at least one
+// document in the index.
+func (b *bleveIndex) IndexedVersionIDs(ctx context.Context) (map[int64]bool, error) {
+	const pageSize = 10000
+	ids := make(map[int64]bool)
+	idx, _ := b.current()
+
+	for from := 0; ; from += pageSize {
+		req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), pageSize, from, false)
+		req.Fields = []string{}
+
+		results, err := idx.SearchInContext(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("listing indexed docs: %w", err)
+		}
+
+		for _, hit := range results.Hits {
+			if vid, ok := versionIDOf(hit.ID); ok {
+				ids[vid] = true
+			}
+		}
+
+		if len(results.Hits) < pageSize {
+			return ids, nil
+		}
+	}
+}
+
+// Search performs a full-text search across indexed documentation.
+func (b *bleveIndex) Search(ctx context.Context, sq SearchQuery, latestVersionTags map[string]string) (*SearchResults, error) {
+	idx, schema := b.current()
+
+	// Build the text query across content and title, analyzed like the
+	// pages of each project were
+	var textQueries []query.Query
+	for _, analyzer := range schema.textAnalyzers() {
+		matchQ := bleve.NewMatchQuery(sq.Query)
+		matchQ.Analyzer = analyzer
+
+		contentPhraseQ := bleve.NewMatchPhraseQuery(sq.Query)
+		contentPhraseQ.SetField("text_content")
+		contentPhraseQ.Analyzer = analyzer
+		contentPhraseQ.SetBoost(2.0)
+
+		titlePhraseQ := bleve.NewMatchPhraseQuery(sq.Query)
+		titlePhraseQ.SetField("page_title")
+		titlePhraseQ.Analyzer = analyzer
+		titlePhraseQ.SetBoost(5.0)
+
+		textQueries = append(textQueries, matchQ, contentPhraseQ, titlePhraseQ)
+	}
+
+	// Fuzzy query for typo tolerance (low boost as fallback)
+	fuzzyContentQ := bleve.NewFuzzyQuery(sq.Query)
+	fuzzyContentQ.SetField("text_content")
+	fuzzyContentQ.SetFuzziness(1) // Allow 1 edit distance
+	fuzzyContentQ.SetBoost(0.5)
+
+	fuzzyTitleQ := bleve.NewFuzzyQuery(sq.Query)
+	fuzzyTitleQ.SetField("page_title")
+	fuzzyTitleQ.SetFuzziness(1)
+	fuzzyTitleQ.SetBoost(0.8)
+
+	textQuery := bleve.NewDisjunctionQuery(append(textQueries, fuzzyContentQ, fuzzyTitleQ)...)
+
+	searchReq := bleve.NewSearchRequestOptions(scopedQuery(textQuery, sq, latestVersionTags), sq.Limit, sq.Offset, false)
+	searchReq.Fields = []string{"project_slug", "project_name", "version_tag", "file_path", "page_title", "page_number"}
+	searchReq.Highlight = bleve.NewHighlightWithStyle(html.Name)
+	searchReq.Highlight.AddField("text_content")
+	searchReq.Highlight.AddField("page_title")
+
+	searchResult, err := idx.SearchInContext(ctx, searchReq)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	results := &SearchResults{
+		Total:   searchResult.Total,
+		Results: make([]SearchResult, 0, len(searchResult.Hits)),
+	}
+
+	for _, hit := range searchResult.Hits {
+		sr := hitResult(hit)
+		if fragments, ok := hit.Fragments["text_content"]; ok && len(fragments) > 0 {
+			sr.Snippet = fragments[0]
+		} else if fragments, ok := hit.Fragments["page_title"]; ok && len(fragments) > 0 {
+			sr.Snippet = fragments[0]
+		}
+		results.Results = append(results.Results, sr)
+	}
+
+	return results, nil
+}
+
+// scopedQuery restricts textQuery to the project, version and labels of sq.
+// Without a version, only the latest versions are searched unless
+// sq.AllVersions is set.
+func scopedQuery(textQuery query.Query, sq SearchQuery, latestVersionTags map[string]string) query.Query {
+	filters := []query.Query{textQuery}
+
+	if sq.ProjectSlug != "" {
+		pq := bleve.NewTermQuery(sq.ProjectSlug)
+		pq.SetField("project_slug")
+		filters = append(filters, pq)
+	}
+
+	for key, value := range sq.Metadata {
+		mq := bleve.NewTermQuery(value)
+		mq.SetField("meta." + key)
+		filters = append(filters, mq)
+	}
+
+	if sq.VersionTag != "" {
+		vq := bleve.NewTermQuery(sq.VersionTag)
+		vq.SetField("version_tag")
+		filters = append(filters, vq)
+	} else if !sq.AllVersions && latestVersionTags != nil && len(latestVersionTags) > 0 {
+		var versionQueries []query.Query
+		for _, tag := range latestVersionTags {
+			vq := bleve.NewTermQuery(tag)
+			vq.SetField("version_tag")
+			versionQueries = append(versionQueries, vq)
+		}
+		if len(versionQueries) > 0 {
+			filters = append(filters, bleve.NewDisjunctionQuery(versionQueries...))
+		}
+	}
+
+	if len(filters) == 1 {
+		return filters[0]
+	}
+	return bleve.NewConjunctionQuery(filters...)
+}
+
+// hitResult returns the search result of a hit, without a snippet.
+func hitResult(hit *search.DocumentMatch) SearchResult {
+	sr := SearchResult{
+		ProjectSlug: fieldString(hit.Fields, "project_slug"),
+		ProjectName: fieldString(hit.Fields, "project_name"),
+		VersionTag:  fieldString(hit.Fields, "version_tag"),
+		FilePath:    fieldString(hit.Fields, "file_path"),
+		PageTitle:   fieldString(hit.Fields, "page_title"),
+		PageNumber:  fieldInt(hit.Fields, "page_number"),
+	}
+	sr.URL = sr.pageURL()
+	return sr
+}
+
+// Suggest looks up the last word as a prefix of the words of the title and
+// text, both as indexed and as written.
+func (b *bleveIndex) Suggest(ctx context.Context, sq SearchQuery, latestVersionTags map[string]string) ([]Suggestion, error) {
+	words := strings.Fields(strings.ToLower(sq.Query))
+	prefix := words[len(words)-1]
+	idx, schema := b.current()
+
+	// Stemmed text is indexed as written too, so that words rather than
+	// stems are suggested
+	var prefixQueries []query.Query
+	for _, field := range []string{"page_title", "text_content"} {
+		for _, name := range []string{field, field + wordsFieldSuffix} {
+			q := bleve.NewPrefixQuery(prefix)
+			q.SetField(name)
+			if field == "page_title" {
+				q.SetBoost(3.0)
+			}
+			prefixQueries = append(prefixQueries, q)
+		}
+	}
+	var textQuery query.Query = bleve.NewDisjunctionQuery(prefixQueries...)
+	if len(words) > 1 {
+		var matchQueries []query.Query
+		for _, analyzer := range schema.textAnalyzers() {
+			matchQ := bleve.NewMatchQuery(strings.Join(words[:len(words)-1], " "))
+			matchQ.Analyzer = analyzer
+			matchQ.SetOperator(query.MatchQueryOperatorAnd)
+			matchQueries = append(matchQueries, matchQ)
+		}
+		textQuery = bleve.NewConjunctionQuery(bleve.NewDisjunctionQuery(matchQueries...), textQuery)
+	}
+
+	searchReq := bleve.NewSearchRequestOptions(scopedQuery(textQuery, sq, latestVersionTags), sq.Limit, sq.Offset, false)
+	searchReq.Fields = []string{"project_slug", "project_name", "version_tag", "file_path", "page_title", "page_number"}
+	searchReq.IncludeLocations = true
+
+	searchResult, err := idx.SearchInContext(ctx, searchReq)
+	if err != nil {
+		return nil, fmt.Errorf("suggest failed: %w", err)
+	}
+
+	suggestions := make([]Suggestion, 0, len(searchResult.Hits))
+	for _, hit := range searchResult.Hits {
+		s := Suggestion{SearchResult: hitResult(hit)}
+		seen := make(map[string]bool)
+		fields := []string{"page_title", "text_content"}
+		if len(hit.Locations["page_title"+wordsFieldSuffix])+len(hit.Locations["text_content"+wordsFieldSuffix]) > 0 {
+			fields = []string{"page_title" + wordsFieldSuffix, "text_content" + wordsFieldSuffix}
+		}
+		for _, field := range fields {
+			for term := range hit.Locations[field] {
+				if strings.HasPrefix(term, prefix) && !seen[term] {
+					seen[term] = true
+					s.Terms = append(s.Terms, term)
+				}
+			}
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, nil
+}
+
+// DeleteAll removes all documents from the index.
+func (b *bleveIndex) DeleteAll(ctx context.Context) error {
+	idx, _ := b.current()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 10000, 0, false)
+		req.Fields = []string{}
+		results, err := idx.SearchInContext(ctx, req)
+		if err != nil {
+			return fmt.Errorf("listing indexed docs: %w", err)
+		}
+		if len(results.Hits) == 0 {
+			return nil
+		}
+		batch := idx.NewBatch()
+		for _, hit := range results.Hits {
+			batch.Delete(hit.ID)
+			if vid, ok := versionIDOf(hit.ID); ok {
+				batch.DeleteInternal(hashKey(vid))
+			}
+		}
+		if err := idx.Batch(batch); err != nil {
+			return fmt.Errorf("deleting indexed docs: %w", err)
+		}
+	}
+}
+
+// Close closes the bleve index.
+func (b *bleveIndex) Close() error {
+	idx, _ := b.current()
+	return idx.Close()
+}
+
+func fieldInt(fields map[string]interface{}, key string) int {
+	val, ok := fields[key]
+	if !ok {
+		return 0
+	}
+	switch v := val.(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
+
+func fieldString(fields map[string]interface{}, key string) string {
+	val, ok := fields[key]
+	if !ok {
+		return ""
+	}
+	switch v := val.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
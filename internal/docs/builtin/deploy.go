@@ -112,6 +112,7 @@ func (d *Deployer) Deploy(ctx context.Context, userID int64) error {
 	if d.SearchIndex != nil {
 		go func() {
 			if err := d.SearchIndex.IndexVersion(
+				context.WithoutCancel(ctx),
 				project.ID, version.ID,
 				project.Slug, project.Name,
 				versionTag, storagePath,
@@ -0,0 +1,63 @@
+package docs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrNoCheckpoint is returned by ResumeReindex when there is no rebuild to
+// continue.
+var ErrNoCheckpoint = errors.New("no interrupted reindex to resume")
+
+// checkpointInterval is how often a running rebuild saves its checkpoint;
+// versions indexed since the last save are indexed again on resume.
+const checkpointInterval = 2 * time.Second
+
+// ReindexCheckpoint is the saved state of a full rebuild of the index.
+type ReindexCheckpoint struct {
+	StartedAt time.Time `json:"started_at"`
+	Queue     []int64   `json:"queue"` // IDs of the versions to index, in order
+	Done      []int64   `json:"done"`  // IDs of the queued versions indexed so far
+}
+
+// Checkpoint returns the state of an interrupted or running rebuild, or
+// nil if the index is complete. The index is also marked incomplete
+// without a queue, e.g. after ImportSearchIndex; the checkpoint's Queue is
+// nil then, and the missing versions are not known.
+func (si *SearchIndex) Checkpoint() (*ReindexCheckpoint, error) {
+	data, err := os.ReadFile(si.incompleteMarker())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading reindex checkpoint: %w", err)
+	}
+	var cp ReindexCheckpoint
+	if len(data) == 0 {
+		return &cp, nil
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("decoding reindex checkpoint: %w", err)
+	}
+	return &cp, nil
+}
+
+// saveCheckpoint writes the checkpoint to the incomplete marker. It is
+// written to a temporary file first so a crash does not leave half of it.
+func (si *SearchIndex) saveCheckpoint(cp *ReindexCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("encoding reindex checkpoint: %w", err)
+	}
+	tmp := si.incompleteMarker() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("saving reindex checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, si.incompleteMarker()); err != nil {
+		return fmt.Errorf("saving reindex checkpoint: %w", err)
+	}
+	return nil
+}
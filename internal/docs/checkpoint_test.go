@@ -0,0 +1,71 @@
+package docs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestResumeReindex(t *testing.T) {
+	base := t.TempDir()
+	si, err := NewSearchIndex(filepath.Join(base, "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer si.Close()
+
+	projects := []ReindexProject{{ID: 1, Slug: "demo", Name: "Demo"}}
+	var versions []ReindexVersion
+	for i, tag := range []string{"1.0", "2.0"} {
+		dir := filepath.Join(base, "demo", tag)
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html><body>Release "+tag+"</body></html>"), 0644)
+		versions = append(versions, ReindexVersion{ID: int64(i + 1), ProjectID: 1, Tag: tag, StoragePath: dir})
+	}
+
+	// Interrupt the rebuild before the second version
+	ctx, cancel := context.WithCancel(context.Background())
+	err = si.ReindexAllWithProgress(ctx, projects, versions, func(p ReindexProgress) {
+		if p.Current == 2 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the rebuild to be cancelled, got %v", err)
+	}
+	cp, err := si.Checkpoint()
+	if err != nil || cp == nil {
+		t.Fatalf("expected a checkpoint, got %v, %v", cp, err)
+	}
+	if !slices.Equal(cp.Queue, []int64{1, 2}) || !slices.Equal(cp.Done, []int64{1}) {
+		t.Fatalf("expected queue [1 2] with 1 done, got %v and %v", cp.Queue, cp.Done)
+	}
+
+	var resumed []string
+	err = si.ResumeReindex(context.Background(), projects, versions, func(p ReindexProgress) {
+		resumed = append(resumed, p.Version)
+		if p.Current != 2 || p.Total != 2 {
+			t.Errorf("expected progress 2/2, got %d/%d", p.Current, p.Total)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(resumed, []string{"2.0"}) {
+		t.Errorf("expected only the remaining version to be indexed, got %v", resumed)
+	}
+	if si.Incomplete() {
+		t.Error("expected the index to be complete")
+	}
+	indexed, _ := si.IndexedVersionIDs(context.Background())
+	if !indexed[1] || !indexed[2] {
+		t.Errorf("expected both versions to be indexed, got %v", indexed)
+	}
+
+	if err := si.ResumeReindex(context.Background(), projects, versions, nil); !errors.Is(err, ErrNoCheckpoint) {
+		t.Errorf("expected ErrNoCheckpoint without an interrupted rebuild, got %v", err)
+	}
+}
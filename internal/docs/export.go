@@ -0,0 +1,464 @@
+package docs
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Exports of a version are stored with its attachments under these names,
+// so a re-upload drops them.
+const (
+	ExportHTMLFile = "export.html"
+	ExportPDFFile  = "export.pdf"
+)
+
+// ErrExportTooLarge is returned when the single-file export of a version
+// would exceed the size limit.
+var ErrExportTooLarge = errors.New("version too large to export")
+
+// cssURLRegex matches url() references in stylesheets.
+var cssURLRegex = regexp.MustCompile(`url\(\s*(['"]?)([^'")]+)(['"]?)\s*\)`)
+
+// exportPage is an HTML page of a version in the export.
+type exportPage struct {
+	path  string
+	id    string
+	title string
+	links []string
+}
+
+// exporter flattens the pages of a version into one document.
+type exporter struct {
+	root    string
+	maxSize int64
+	size    int64 // bytes of the files inlined so far
+	pages   map[string]*exportPage
+	inlined map[string]string // data URLs of files, by path
+}
+
+// ExportSingleHTML writes the HTML pages of the version in root as one
+// self-contained HTML document titled title. Pages follow the links from
+// index.html breadth first, then the pages it does not reach, by path.
+// Stylesheets and images are inlined as data URLs, scripts and frames are
+// left out, and links between pages point to their sections of the
+// document. It fails with ErrExportTooLarge once the document would grow
+// beyond maxSize bytes.
+func ExportSingleHTML(ctx context.Context, w io.Writer, root, title string, maxSize int64) error {
+	e := &exporter{root: root, maxSize: maxSize, pages: make(map[string]*exportPage), inlined: make(map[string]string)}
+
+	var paths []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != root {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if d.IsDir() || (ext != ".html" && ext != ".htm") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no HTML pages to export")
+	}
+
+	// The first pass collects the titles, links and stylesheets, which go
+	// into the head before any page.
+	var styles []string
+	seenStyles := make(map[string]bool)
+	ids := make(map[string]bool)
+	for _, p := range paths {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		doc, err := e.parse(p)
+		if err != nil {
+			return err
+		}
+		page := &exportPage{path: p, id: exportID(p, ids)}
+		walkHTML(doc, func(n *xhtml.Node) bool {
+			switch n.Data {
+			case "title":
+				if page.title == "" {
+					page.title = strings.TrimSpace(nodeText(n))
+				}
+			case "a":
+				if target, _, ok := resolveLocal(p, attr(n, "href")); ok {
+					page.links = append(page.links, target)
+				}
+			case "link":
+				if !strings.EqualFold(attr(n, "rel"), "stylesheet") {
+					break
+				}
+				if target, _, ok := resolveLocal(p, attr(n, "href")); ok && !seenStyles[target] {
+					seenStyles[target] = true
+					css, err := e.stylesheet(target)
+					if err == nil {
+						styles = append(styles, css)
+					} else if errors.Is(err, ErrExportTooLarge) {
+						return false
+					}
+				}
+			case "style":
+				css := nodeText(n)
+				if !seenStyles[css] {
+					seenStyles[css] = true
+					styles = append(styles, css)
+				}
+			}
+			return true
+		})
+		if e.size > e.maxSize {
+			return ErrExportTooLarge
+		}
+		if page.title == "" {
+			page.title = p
+		}
+		e.pages[p] = page
+	}
+
+	order := e.readingOrder(paths)
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	fmt.Fprintf(bw, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", html.EscapeString(title))
+	for _, css := range styles {
+		bw.WriteString("<style>\n" + strings.ReplaceAll(css, "</style", `<\/style`) + "\n</style>\n")
+	}
+	bw.WriteString("<style>\n.export-page{break-before:page}\n.export-toc ol{list-style:none}\n</style>\n</head>\n<body>\n")
+
+	bw.WriteString("<nav class=\"export-toc\" aria-label=\"Contents\">\n<h1>" + html.EscapeString(title) + "</h1>\n<ol>\n")
+	for _, page := range order {
+		fmt.Fprintf(bw, "<li><a href=\"#%s\">%s</a></li>\n", page.id, html.EscapeString(page.title))
+	}
+	bw.WriteString("</ol>\n</nav>\n")
+
+	for _, page := range order {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		doc, err := e.parse(page.path)
+		if err != nil {
+			return err
+		}
+		body := e.flatten(doc, page)
+		if e.size > e.maxSize {
+			return ErrExportTooLarge
+		}
+		if body == nil {
+			continue
+		}
+		fmt.Fprintf(bw, "<section class=\"export-page\" id=\"%s\">\n", page.id)
+		for c := body.FirstChild; c != nil; c = c.NextSibling {
+			if err := xhtml.Render(bw, c); err != nil {
+				return err
+			}
+		}
+		bw.WriteString("\n</section>\n")
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if cw.n > e.maxSize {
+			return ErrExportTooLarge
+		}
+	}
+	bw.WriteString("</body>\n</html>\n")
+	return bw.Flush()
+}
+
+func (e *exporter) parse(page string) (*xhtml.Node, error) {
+	f, err := os.Open(filepath.Join(e.root, filepath.FromSlash(page)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	doc, err := xhtml.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", page, err)
+	}
+	return doc, nil
+}
+
+// readingOrder returns the pages reachable from index.html breadth first,
+// followed by the others by path.
+func (e *exporter) readingOrder(paths []string) []*exportPage {
+	var order []*exportPage
+	visited := make(map[string]bool)
+	queue := []string{"index.html"}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		page, ok := e.pages[p]
+		if !ok || visited[p] {
+			continue
+		}
+		visited[p] = true
+		order = append(order, page)
+		queue = append(queue, page.links...)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if !visited[p] {
+			order = append(order, e.pages[p])
+		}
+	}
+	return order
+}
+
+// flatten prepares the body of a page for the export and returns it, or
+// nil if the page has none.
+func (e *exporter) flatten(doc *xhtml.Node, page *exportPage) *xhtml.Node {
+	var body *xhtml.Node
+	walkHTML(doc, func(n *xhtml.Node) bool {
+		if n.Data == "body" {
+			body = n
+			return false
+		}
+		return true
+	})
+	if body == nil {
+		return nil
+	}
+
+	var remove []*xhtml.Node
+	walkHTML(body, func(n *xhtml.Node) bool {
+		switch n.Data {
+		case "script", "noscript", "iframe", "link", "style", "base", "meta":
+			remove = append(remove, n)
+			return false
+		}
+		for i, a := range n.Attr {
+			switch {
+			case a.Key == "id" || (a.Key == "name" && n.Data == "a"):
+				n.Attr[i].Val = page.id + "--" + a.Val
+			case a.Key == "href" && (n.Data == "a" || n.Data == "area"):
+				n.Attr[i].Val = e.pageLink(page, a.Val)
+			case a.Key == "src" && (n.Data == "img" || n.Data == "source" || n.Data == "video" || n.Data == "audio"):
+				if target, _, ok := resolveLocal(page.path, a.Val); ok {
+					if data, err := e.dataURL(target); err == nil {
+						n.Attr[i].Val = data
+					}
+				}
+			}
+		}
+		// srcset alternatives would point back at the version
+		n.Attr = removeAttr(n.Attr, "srcset")
+		return true
+	})
+	for _, n := range remove {
+		n.Parent.RemoveChild(n)
+	}
+	return body
+}
+
+// pageLink rewrites a link of a page: links to pages of the version point
+// to their sections, other links are kept.
+func (e *exporter) pageLink(page *exportPage, href string) string {
+	href = strings.TrimSpace(href)
+	if frag, ok := strings.CutPrefix(href, "#"); ok {
+		if frag == "" {
+			return "#" + page.id
+		}
+		return "#" + page.id + "--" + frag
+	}
+	target, frag, ok := resolveLocal(page.path, href)
+	if !ok {
+		return href
+	}
+	linked, ok := e.pages[target]
+	if !ok {
+		return href
+	}
+	if frag != "" {
+		return "#" + linked.id + "--" + frag
+	}
+	return "#" + linked.id
+}
+
+// stylesheet returns a stylesheet of the version with the files it
+// references inlined.
+func (e *exporter) stylesheet(target string) (string, error) {
+	css, err := e.read(target)
+	if err != nil {
+		return "", err
+	}
+	var inlineErr error
+	result := cssURLRegex.ReplaceAllStringFunc(string(css), func(m string) string {
+		ref := cssURLRegex.FindStringSubmatch(m)[2]
+		file, _, ok := resolveLocal(target, ref)
+		if !ok {
+			return m
+		}
+		data, err := e.dataURL(file)
+		if err != nil {
+			if errors.Is(err, ErrExportTooLarge) {
+				inlineErr = err
+			}
+			return m
+		}
+		return `url("` + data + `")`
+	})
+	return result, inlineErr
+}
+
+// dataURL returns a file of the version as a data URL.
+func (e *exporter) dataURL(target string) (string, error) {
+	if data, ok := e.inlined[target]; ok {
+		return data, nil
+	}
+	content, err := e.read(target)
+	if err != nil {
+		return "", err
+	}
+	contentType := mime.TypeByExtension(path.Ext(target))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	data := "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(content)
+	e.inlined[target] = data
+	return data, nil
+}
+
+// read reads a file of the version, counting it against the size limit.
+func (e *exporter) read(target string) ([]byte, error) {
+	full := filepath.Join(e.root, filepath.FromSlash(path.Clean("/"+target)))
+	info, err := os.Stat(full)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a file", target)
+	}
+	if e.size += info.Size(); e.size > e.maxSize {
+		return nil, ErrExportTooLarge
+	}
+	return os.ReadFile(full)
+}
+
+// resolveLocal resolves a relative link of page to a path within the
+// version and its fragment. Links to other sites and absolute paths are
+// not local. A directory resolves to its index.html.
+func resolveLocal(page, ref string) (target, fragment string, ok bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "/") {
+		return "", "", false
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" || u.Path == "" {
+		return "", "", false
+	}
+	resolved := (&url.URL{Path: "/" + page}).ResolveReference(u).Path
+	if strings.HasSuffix(resolved, "/") {
+		resolved += "index.html"
+	}
+	return strings.TrimPrefix(path.Clean(resolved), "/"), u.Fragment, true
+}
+
+var exportIDRegex = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// exportID derives a unique section id from the path of a page.
+func exportID(page string, used map[string]bool) string {
+	base := "page-" + strings.Trim(exportIDRegex.ReplaceAllString(strings.TrimSuffix(page, path.Ext(page)), "-"), "-")
+	id := base
+	for i := 2; used[id]; i++ {
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+	used[id] = true
+	return id
+}
+
+func nodeText(n *xhtml.Node) string {
+	var b strings.Builder
+	var walk func(*xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		if n.Type == xhtml.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func removeAttr(attrs []xhtml.Attribute, key string) []xhtml.Attribute {
+	result := attrs[:0]
+	for _, a := range attrs {
+		if a.Key != key {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// ExportPDF renders the single-file export at input to a PDF at output
+// using an external headless renderer. The command is split on spaces like
+// the thumbnail renderer's, e.g.
+//
+//	chromium --headless --no-pdf-header-footer --print-to-pdf={output} {url}
+func ExportPDF(ctx context.Context, command, input, output string) error {
+	input, err := filepath.Abs(input)
+	if err != nil {
+		return fmt.Errorf("resolving export: %w", err)
+	}
+	tmp, err := filepath.Abs(output + ".tmp")
+	if err != nil {
+		return fmt.Errorf("resolving PDF path: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	if err := runRenderer(ctx, "PDF", command, input, tmp); err != nil {
+		return err
+	}
+	info, err := os.Stat(tmp)
+	if err != nil || info.Size() == 0 {
+		return fmt.Errorf("PDF renderer wrote no document")
+	}
+	if err := os.Rename(tmp, output); err != nil {
+		return fmt.Errorf("storing PDF: %w", err)
+	}
+	return nil
+}
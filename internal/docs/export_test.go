@@ -0,0 +1,83 @@
+package docs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportSingleHTML(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		p := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("index.html", `<html><head><title>Home</title><link rel="stylesheet" href="css/site.css"><script src="app.js"></script></head>
+<body><h1 id="top">Home</h1><a href="guide/intro.html#setup">Setup</a><a href="#top">Top</a><img src="img/logo.png" alt="Logo"><script>alert(1)</script></body></html>`)
+	write("guide/intro.html", `<html><head><title>Intro</title><link rel="stylesheet" href="../css/site.css"></head>
+<body><h2 id="setup">Setup</h2><a href="../index.html">Back</a><a href="https://example.com/">Elsewhere</a></body></html>`)
+	write("appendix.html", `<html><head><title>Appendix</title></head><body><p>Unlinked</p></body></html>`)
+	write("css/site.css", `body { background: url("../img/logo.png"); }`)
+	write("img/logo.png", "PNGDATA")
+
+	var buf bytes.Buffer
+	if err := ExportSingleHTML(context.Background(), &buf, root, "Handbook 1.0", 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"<title>Handbook 1.0</title>",
+		`url("data:image/png;base64,UE5HREFUQQ==")`,
+		`<section class="export-page" id="page-index">`,
+		`<h1 id="page-index--top">`,
+		`href="#page-guide-intro--setup"`,
+		`href="#page-index--top"`,
+		`src="data:image/png;base64,UE5HREFUQQ=="`,
+		`href="#page-index">Back`,
+		`href="https://example.com/"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("export missing %s", want)
+		}
+	}
+	if strings.Contains(out, "<script") {
+		t.Error("expected scripts to be left out")
+	}
+	if strings.Count(out, "background: url") != 1 {
+		t.Error("expected a stylesheet shared by pages to be inlined once")
+	}
+	home, intro, appendix := strings.Index(out, `id="page-index"`), strings.Index(out, `id="page-guide-intro"`), strings.Index(out, `id="page-appendix"`)
+	if !(home < intro && intro < appendix) {
+		t.Errorf("expected linked pages in reading order, then unlinked ones: %d %d %d", home, intro, appendix)
+	}
+
+	if err := ExportSingleHTML(context.Background(), &bytes.Buffer{}, root, "Handbook", 100); !errors.Is(err, ErrExportTooLarge) {
+		t.Errorf("expected ErrExportTooLarge, got %v", err)
+	}
+}
+
+func TestExportPDF(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, ExportHTMLFile)
+	os.WriteFile(input, []byte("<html></html>"), 0644)
+	output := filepath.Join(dir, ExportPDFFile)
+
+	if err := ExportPDF(context.Background(), "cp {input} {output}", input, output); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(output); err != nil || string(data) != "<html></html>" {
+		t.Fatalf("expected the renderer output as PDF, got %q, %v", data, err)
+	}
+	if err := ExportPDF(context.Background(), "true {url} {output}", input, filepath.Join(dir, "other.pdf")); err == nil {
+		t.Error("expected a renderer writing no document to return an error")
+	}
+}
@@ -0,0 +1,114 @@
+package docs
+
+import (
+	"container/list"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// FileCache keeps the contents of small, frequently served files in memory
+// and evicts the least recently used ones beyond its size limit. Entries
+// are checked against the file's size and modification time, so replaced
+// files are read again without explicit invalidation. A nil *FileCache
+// caches nothing.
+type FileCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	maxFile  int64
+	size     int64
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type cachedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	data    []byte
+}
+
+// NewFileCache creates a cache holding up to maxBytes of files no larger
+// than maxFile each. It returns nil if maxBytes or maxFile is not positive.
+func NewFileCache(maxBytes, maxFile int64) *FileCache {
+	if maxBytes <= 0 || maxFile <= 0 {
+		return nil
+	}
+	return &FileCache{
+		maxBytes: maxBytes,
+		maxFile:  min(maxFile, maxBytes),
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Len returns the number of cached files.
+func (c *FileCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Size returns the total size of the cached files in bytes.
+func (c *FileCache) Size() int64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// admits reports whether a file of the given size may be cached.
+func (c *FileCache) admits(size int64) bool {
+	return c != nil && size <= c.maxFile
+}
+
+// get returns the cached contents of a file if they match its current
+// size and modification time.
+func (c *FileCache) get(path string, info fs.FileInfo) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[path]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cachedFile)
+	if entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.data, true
+}
+
+// put caches the contents of a file, evicting the least recently used
+// files to stay within the size limit.
+func (c *FileCache) put(path string, info fs.FileInfo, data []byte) {
+	if !c.admits(int64(len(data))) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[path]; ok {
+		c.remove(el)
+	}
+	entry := &cachedFile{path: path, size: info.Size(), modTime: info.ModTime(), data: data}
+	c.entries[path] = c.order.PushFront(entry)
+	c.size += int64(len(data))
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *FileCache) remove(el *list.Element) {
+	entry := c.order.Remove(el).(*cachedFile)
+	delete(c.entries, entry.path)
+	c.size -= int64(len(entry.data))
+}
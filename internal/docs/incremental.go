@@ -0,0 +1,154 @@
+package docs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// hashKeyPrefix prefixes the internal keys of the content hashes of the
+// indexed versions, by version ID.
+const hashKeyPrefix = "asiakirjat.hash/"
+
+func hashKey(versionID int64) []byte {
+	return []byte(hashKeyPrefix + strconv.FormatInt(versionID, 10))
+}
+
+// indexableFile reports whether a file's text is indexed.
+func indexableFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm", ".md", ".markdown", ".pdf":
+		return true
+	}
+	return false
+}
+
+// contentHash hashes what the documents of a version are made of: the
+// paths and contents of its indexable files, and the project and version
+// data stored with them.
+func contentHash(ctx context.Context, projectSlug, projectName, versionTag, docType, storagePath string, metadata map[string]string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q %q\n", projectSlug, projectName, versionTag, docType)
+	for _, k := range slices.Sorted(maps.Keys(metadata)) {
+		fmt.Fprintf(h, "meta %q %q\n", k, metadata[k])
+	}
+	err := filepath.Walk(storagePath, func(path string, info os.FileInfo, walkErr error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if walkErr != nil || info.IsDir() || !indexableFile(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(storagePath, path)
+		if err != nil {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil // skipped when indexing too
+		}
+		defer f.Close()
+		fmt.Fprintf(h, "file %q %d\n", filepath.ToSlash(rel), info.Size())
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("hashing version content: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// indexedHash returns the content hash of a version when it was last
+// indexed, or "" if it is not known.
+func (si *SearchIndex) indexedHash(ctx context.Context, versionID int64) string {
+	hash, err := si.backend.IndexedHash(ctx, versionID)
+	if err != nil {
+		return ""
+	}
+	return hash
+}
+
+// IndexVersionIfChanged indexes a version again unless its content, labels
+// and names are unchanged since it was last indexed. The version's old
+// documents are removed first. It reports whether the version was indexed.
+func (si *SearchIndex) IndexVersionIfChanged(ctx context.Context, projectID, versionID int64, projectSlug, projectName, versionTag, storagePath string, metadata map[string]string) (bool, error) {
+	hash, err := contentHash(ctx, projectSlug, projectName, versionTag, si.docType(projectSlug), storagePath, metadata)
+	if err != nil {
+		return false, err
+	}
+	if old := si.indexedHash(ctx, versionID); old != "" && old == hash {
+		return false, nil
+	}
+	if err := si.DeleteVersion(projectID, versionID); err != nil {
+		return false, err
+	}
+	return true, si.indexVersion(ctx, projectID, versionID, projectSlug, projectName, versionTag, storagePath, metadata, hash)
+}
+
+// ReindexVersions indexes versions again, skipping those whose content is
+// unchanged since they were last indexed unless force is set. Unlike
+// ReindexAll it leaves the other versions in the index alone, and it does
+// not recreate an outdated index. It returns the final progress, with the
+// counts of indexed and skipped versions.
+func (si *SearchIndex) ReindexVersions(ctx context.Context, projects []ReindexProject, versions []ReindexVersion, force bool, progressFn ReindexProgressFunc) (ReindexProgress, error) {
+	projectMap := make(map[int64]ReindexProject, len(projects))
+	for _, p := range projects {
+		projectMap[p.ID] = p
+	}
+
+	progress := ReindexProgress{Total: len(versions)}
+	for i, v := range versions {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+		p, ok := projectMap[v.ProjectID]
+		if !ok {
+			continue
+		}
+		progress.Current, progress.Project, progress.Version = i+1, p.Slug, v.Tag
+		if progressFn != nil {
+			progressFn(progress)
+		}
+
+		metadata := MergeMetadata(p.Metadata, v.Metadata)
+		if force {
+			if err := si.DeleteVersion(p.ID, v.ID); err != nil {
+				return progress, err
+			}
+			if err := si.IndexVersionWithMetadata(ctx, p.ID, v.ID, p.Slug, p.Name, v.Tag, v.StoragePath, metadata); err != nil {
+				return progress, err
+			}
+			progress.Indexed++
+			continue
+		}
+		indexed, err := si.IndexVersionIfChanged(ctx, p.ID, v.ID, p.Slug, p.Name, v.Tag, v.StoragePath, metadata)
+		if err != nil {
+			return progress, err
+		}
+		if indexed {
+			progress.Indexed++
+		} else {
+			progress.Skipped++
+		}
+	}
+	return progress, nil
+}
+
+// versionIDOf returns the version ID of a document ID, which have the form
+// "projectID/versionID/path".
+func versionIDOf(docID string) (int64, bool) {
+	parts := strings.SplitN(docID, "/", 3)
+	if len(parts) < 2 {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	return id, err == nil
+}
@@ -0,0 +1,84 @@
+package docs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReindexVersions(t *testing.T) {
+	base := t.TempDir()
+	ctx := context.Background()
+	si, err := NewSearchIndex(filepath.Join(base, "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer si.Close()
+
+	projects := []ReindexProject{{ID: 1, Slug: "demo", Name: "Demo"}}
+	var versions []ReindexVersion
+	for i, tag := range []string{"1.0", "2.0"} {
+		dir := filepath.Join(base, "demo", tag)
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html><body>Release "+tag+"</body></html>"), 0644)
+		versions = append(versions, ReindexVersion{ID: int64(i + 1), ProjectID: 1, Tag: tag, StoragePath: dir})
+	}
+	total := func(q string) uint64 {
+		t.Helper()
+		results, err := si.Search(ctx, SearchQuery{Query: q, AllVersions: true}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results.Total
+	}
+	reindex := func(force bool) ReindexProgress {
+		t.Helper()
+		progress, err := si.ReindexVersions(ctx, projects, versions, force, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return progress
+	}
+
+	if p := reindex(false); p.Indexed != 2 || p.Skipped != 0 {
+		t.Errorf("expected versions without a hash to be indexed, got %+v", p)
+	}
+	if p := reindex(false); p.Indexed != 0 || p.Skipped != 2 {
+		t.Errorf("expected unchanged versions to be skipped, got %+v", p)
+	}
+
+	// Changed files and labels are indexed again, without old pages
+	os.WriteFile(filepath.Join(versions[0].StoragePath, "index.html"), []byte("<html><body>Rewritten</body></html>"), 0644)
+	os.WriteFile(filepath.Join(versions[0].StoragePath, "style.css"), []byte("body {}"), 0644)
+	versions[1].Metadata = map[string]string{"team": "docs"}
+	if p := reindex(false); p.Indexed != 2 || p.Skipped != 0 || p.Current != 2 || p.Total != 2 {
+		t.Errorf("expected changed versions to be indexed, got %+v", p)
+	}
+	if total("rewritten") != 1 || total("release") != 1 {
+		t.Error("expected the index to follow the changed page")
+	}
+
+	// Files that are not indexed do not count as changes
+	os.WriteFile(filepath.Join(versions[0].StoragePath, "style.css"), []byte("body { color: red }"), 0644)
+	if p := reindex(false); p.Skipped != 2 {
+		t.Errorf("expected unindexed files to be ignored, got %+v", p)
+	}
+	if p := reindex(true); p.Indexed != 2 {
+		t.Errorf("expected force to index unchanged versions, got %+v", p)
+	}
+
+	// Deleted versions and full rebuilds forget their hashes
+	if err := si.DeleteVersion(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if p := reindex(false); p.Indexed != 1 || p.Skipped != 1 {
+		t.Errorf("expected the deleted version to be indexed again, got %+v", p)
+	}
+	if err := si.backend.DeleteAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p := reindex(false); p.Indexed != 2 {
+		t.Errorf("expected emptied index to be indexed again, got %+v", p)
+	}
+}
@@ -1,28 +1,32 @@
 package docs
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"time"
 
-	"github.com/blevesearch/bleve/v2"
-	"github.com/blevesearch/bleve/v2/mapping"
-	"github.com/blevesearch/bleve/v2/search/highlight/highlighter/html"
-	"github.com/blevesearch/bleve/v2/search/query"
 	xhtml "golang.org/x/net/html"
 )
 
-// SearchIndex wraps a bleve index for full-text search of documentation content.
+// SearchIndex is the full-text search of documentation content. It
+// extracts the documents of versions from their files and keeps them in a
+// SearchBackend, the embedded bleve index by default.
 type SearchIndex struct {
-	index bleve.Index
+	backend SearchBackend
+	// bleve is the backend if it is the embedded index, for what only it
+	// supports: analysis settings and snapshots
+	bleve *bleveIndex
 	path  string
 }
 
-// indexDoc is the document structure stored in the bleve index.
-type indexDoc struct {
+// Document is a page, or a page of a PDF, as stored in the index.
+type Document struct {
+	// ID is "projectID/versionID/path", with "#pN" for PDF pages
+	ID          string `json:"-"`
 	ProjectSlug string `json:"project_slug"`
 	ProjectName string `json:"project_name"`
 	VersionTag  string `json:"version_tag"`
@@ -32,6 +36,18 @@ type indexDoc struct {
 	ProjectID   int64  `json:"project_id"`
 	VersionID   int64  `json:"version_id"`
 	PageNumber  int    `json:"page_number"`
+
+	// Metadata holds the project's and version's labels; version labels
+	// override project labels with the same key.
+	Metadata map[string]string `json:"meta,omitempty"`
+
+	docType string
+}
+
+// Type returns the document type, which selects the analysis of
+// projects with their own in the embedded index, see indexSchema.docType.
+func (d Document) Type() string {
+	return d.docType
 }
 
 // SearchQuery describes a full-text search request.
@@ -42,6 +58,7 @@ type SearchQuery struct {
 	AllVersions bool
 	Limit       int
 	Offset      int
+	Metadata    map[string]string // exact label matches, e.g. team=platform
 }
 
 // SearchResult is a single search hit.
@@ -62,58 +79,79 @@ type SearchResults struct {
 	Total   uint64         `json:"total"`
 }
 
-func buildIndexMapping() *mapping.IndexMappingImpl {
-	indexMapping := bleve.NewIndexMapping()
-
-	docMapping := bleve.NewDocumentMapping()
-
-	textFieldMapping := bleve.NewTextFieldMapping()
-	textFieldMapping.Store = true
-	textFieldMapping.IncludeTermVectors = true
+// NewSearchIndex opens or creates a bleve index at the given path, with
+// the default analysis.
+func NewSearchIndex(indexPath string) (*SearchIndex, error) {
+	return NewSearchIndexWithOptions(indexPath, IndexOptions{Analysis: DefaultAnalysis})
+}
 
-	keywordFieldMapping := bleve.NewKeywordFieldMapping()
-	keywordFieldMapping.Store = true
+// NewSearchIndexWithOptions opens or creates a bleve index at the given
+// path. An existing index keeps the analysis it was created with until it
+// is rebuilt, see Outdated.
+func NewSearchIndexWithOptions(indexPath string, opts IndexOptions) (*SearchIndex, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	b, err := openBleveIndex(indexPath, newIndexSchema(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &SearchIndex{backend: b, bleve: b, path: indexPath}, nil
+}
 
-	numericFieldMapping := bleve.NewNumericFieldMapping()
-	numericFieldMapping.Store = true
-	numericFieldMapping.Index = false
+// pageURL returns the link to a result's page.
+func (sr SearchResult) pageURL() string {
+	if sr.PageNumber > 0 {
+		// PDF result: link to the viewer wrapper (without the filename)
+		// so the page fragment (#page=N) works with the embedded PDF
+		return "/project/" + sr.ProjectSlug + "/" + sr.VersionTag + "/"
+	}
+	return "/project/" + sr.ProjectSlug + "/" + sr.VersionTag + "/" + sr.FilePath
+}
 
-	docMapping.AddFieldMappingsAt("project_slug", keywordFieldMapping)
-	docMapping.AddFieldMappingsAt("project_name", textFieldMapping)
-	docMapping.AddFieldMappingsAt("version_tag", keywordFieldMapping)
-	docMapping.AddFieldMappingsAt("file_path", keywordFieldMapping)
-	docMapping.AddFieldMappingsAt("page_title", textFieldMapping)
-	docMapping.AddFieldMappingsAt("text_content", textFieldMapping)
-	docMapping.AddFieldMappingsAt("project_id", numericFieldMapping)
-	docMapping.AddFieldMappingsAt("version_id", numericFieldMapping)
-	docMapping.AddFieldMappingsAt("page_number", numericFieldMapping)
+// Outdated reports whether the index was created with other analysis
+// settings than configured, or an older schema. It uses the settings it
+// was created with until a rebuild recreates it, see ReindexAll. An
+// external backend is never outdated.
+func (si *SearchIndex) Outdated() bool {
+	return si.bleve != nil && si.bleve.Outdated()
+}
 
-	indexMapping.DefaultMapping = docMapping
+// AnalysisChange describes the configured analysis that differs from the
+// index's, e.g. "language en → fi", for admins; it is empty if the index
+// is up to date or only its schema version is old.
+func (si *SearchIndex) AnalysisChange() string {
+	if si.bleve == nil {
+		return ""
+	}
+	return si.bleve.AnalysisChange()
+}
 
-	return indexMapping
+// Embedded reports whether the index is the embedded bleve index rather
+// than an external search engine.
+func (si *SearchIndex) Embedded() bool {
+	return si.bleve != nil
 }
 
-// NewSearchIndex opens or creates a bleve index at the given path.
-func NewSearchIndex(basePath string) (*SearchIndex, error) {
-	indexPath := filepath.Join(basePath, ".search-index")
+// Check reads from the backend to tell whether the index can be searched.
+func (si *SearchIndex) Check(ctx context.Context) error {
+	_, err := si.backend.IndexedHash(ctx, 0)
+	return err
+}
 
-	idx, err := bleve.Open(indexPath)
-	if err == bleve.ErrorIndexPathDoesNotExist {
-		m := buildIndexMapping()
-		idx, err = bleve.New(indexPath, m)
-		if err != nil {
-			return nil, fmt.Errorf("creating search index: %w", err)
-		}
-	} else if err != nil {
-		return nil, fmt.Errorf("opening search index: %w", err)
+// docType returns the document type of a project's pages, see
+// indexSchema.docType.
+func (si *SearchIndex) docType(projectSlug string) string {
+	if si.bleve == nil {
+		return ""
 	}
-
-	return &SearchIndex{index: idx, path: indexPath}, nil
+	_, schema := si.bleve.current()
+	return schema.docType(projectSlug)
 }
 
-// Close closes the bleve index.
+// Close closes the backend.
 func (si *SearchIndex) Close() error {
-	return si.index.Close()
+	return si.backend.Close()
 }
 
 // ExtractTextFromHTML reads an HTML file and returns the page title and plain text content.
@@ -199,10 +237,29 @@ func isBlockElement(tag string) bool {
 }
 
 // IndexVersion walks HTML files in a version's storage path and indexes them.
-func (si *SearchIndex) IndexVersion(projectID, versionID int64, projectSlug, projectName, versionTag, storagePath string) error {
-	batch := si.index.NewBatch()
+// Nothing is indexed if ctx is cancelled before the walk is done.
+func (si *SearchIndex) IndexVersion(ctx context.Context, projectID, versionID int64, projectSlug, projectName, versionTag, storagePath string) error {
+	return si.IndexVersionWithMetadata(ctx, projectID, versionID, projectSlug, projectName, versionTag, storagePath, nil)
+}
 
+// IndexVersionWithMetadata is IndexVersion for a version with labels, which
+// are added to every document so searches can filter on them.
+// The content hash of the version is recorded, see IndexVersionIfChanged.
+func (si *SearchIndex) IndexVersionWithMetadata(ctx context.Context, projectID, versionID int64, projectSlug, projectName, versionTag, storagePath string, metadata map[string]string) error {
+	hash, err := contentHash(ctx, projectSlug, projectName, versionTag, si.docType(projectSlug), storagePath, metadata)
+	if err != nil {
+		return err
+	}
+	return si.indexVersion(ctx, projectID, versionID, projectSlug, projectName, versionTag, storagePath, metadata, hash)
+}
+
+// indexVersion indexes a version and records its content hash.
+func (si *SearchIndex) indexVersion(ctx context.Context, projectID, versionID int64, projectSlug, projectName, versionTag, storagePath string, metadata map[string]string, hash string) error {
+	var docs []Document
 	err := filepath.Walk(storagePath, func(path string, info os.FileInfo, walkErr error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if walkErr != nil {
 			return nil // skip files we can't access
 		}
@@ -219,7 +276,7 @@ func (si *SearchIndex) IndexVersion(projectID, versionID int64, projectSlug, pro
 
 		switch ext {
 		case ".pdf":
-			pdfTitle, pages, extractErr := ExtractPDFPages(path)
+			pdfTitle, pages, extractErr := ExtractPDFPages(ctx, path)
 			if extractErr != nil || len(pages) == 0 {
 				return nil
 			}
@@ -229,7 +286,8 @@ func (si *SearchIndex) IndexVersion(projectID, versionID int64, projectSlug, pro
 				if page.Number > 1 {
 					title = fmt.Sprintf("%s (page %d)", pdfTitle, page.Number)
 				}
-				doc := indexDoc{
+				docs = append(docs, Document{
+					ID:          docID,
 					ProjectSlug: projectSlug,
 					ProjectName: projectName,
 					VersionTag:  versionTag,
@@ -239,18 +297,24 @@ func (si *SearchIndex) IndexVersion(projectID, versionID int64, projectSlug, pro
 					TextContent: page.Text,
 					ProjectID:   projectID,
 					VersionID:   versionID,
-				}
-				batch.Index(docID, doc)
+					Metadata:    metadata,
+				})
 			}
 			return nil
 
-		case ".html", ".htm":
+		case ".html", ".htm", ".md", ".markdown":
 			// handled below
 		default:
 			return nil
 		}
 
-		pageTitle, textContent, extractErr := ExtractTextFromHTML(path)
+		var pageTitle, textContent string
+		var extractErr error
+		if IsMarkdown(path) {
+			pageTitle, textContent, extractErr = extractTextFromMarkdown(path)
+		} else {
+			pageTitle, textContent, extractErr = ExtractTextFromHTML(path)
+		}
 		if extractErr != nil {
 			return nil // skip files we can't parse
 		}
@@ -259,8 +323,8 @@ func (si *SearchIndex) IndexVersion(projectID, versionID int64, projectSlug, pro
 			return nil
 		}
 
-		docID := fmt.Sprintf("%d/%d/%s", projectID, versionID, relPath)
-		doc := indexDoc{
+		docs = append(docs, Document{
+			ID:          fmt.Sprintf("%d/%d/%s", projectID, versionID, relPath),
 			ProjectSlug: projectSlug,
 			ProjectName: projectName,
 			VersionTag:  versionTag,
@@ -269,164 +333,41 @@ func (si *SearchIndex) IndexVersion(projectID, versionID int64, projectSlug, pro
 			TextContent: textContent,
 			ProjectID:   projectID,
 			VersionID:   versionID,
-		}
-
-		batch.Index(docID, doc)
+			Metadata:    metadata,
+		})
 		return nil
 	})
 	if err != nil {
 		return fmt.Errorf("walking version directory: %w", err)
 	}
-
-	if err := si.index.Batch(batch); err != nil {
-		return fmt.Errorf("indexing batch: %w", err)
-	}
-
-	return nil
+	return si.backend.Index(ctx, versionID, docs, hash)
 }
 
 // DeleteVersion removes all indexed documents for a given version.
 func (si *SearchIndex) DeleteVersion(projectID, versionID int64) error {
-	prefix := fmt.Sprintf("%d/%d/", projectID, versionID)
-
-	q := bleve.NewMatchAllQuery()
-	req := bleve.NewSearchRequest(q)
-	req.Size = 10000
-	req.Fields = []string{}
-
-	results, err := si.index.Search(req)
-	if err != nil {
-		return fmt.Errorf("searching for version docs: %w", err)
-	}
-
-	batch := si.index.NewBatch()
-	for _, hit := range results.Hits {
-		if strings.HasPrefix(hit.ID, prefix) {
-			batch.Delete(hit.ID)
-		}
-	}
-
-	if err := si.index.Batch(batch); err != nil {
-		return fmt.Errorf("deleting version docs: %w", err)
-	}
+	return si.backend.DeleteVersion(context.Background(), projectID, versionID)
+}
 
-	return nil
+// IndexedVersionIDs returns the set of version IDs that have at least one
+// document in the index.
+func (si *SearchIndex) IndexedVersionIDs(ctx context.Context) (map[int64]bool, error) {
+	return si.backend.IndexedVersionIDs(ctx)
 }
 
 // Search performs a full-text search across indexed documentation.
-func (si *SearchIndex) Search(sq SearchQuery, latestVersionTags map[string]string) (*SearchResults, error) {
+func (si *SearchIndex) Search(ctx context.Context, sq SearchQuery, latestVersionTags map[string]string) (*SearchResults, error) {
 	if sq.Limit <= 0 {
 		sq.Limit = 20
 	}
-
-	// Build the text query across content and title
-	matchQ := bleve.NewMatchQuery(sq.Query)
-
-	contentPhraseQ := bleve.NewMatchPhraseQuery(sq.Query)
-	contentPhraseQ.SetField("text_content")
-	contentPhraseQ.SetBoost(2.0)
-
-	titlePhraseQ := bleve.NewMatchPhraseQuery(sq.Query)
-	titlePhraseQ.SetField("page_title")
-	titlePhraseQ.SetBoost(5.0)
-
-	// Fuzzy query for typo tolerance (low boost as fallback)
-	fuzzyContentQ := bleve.NewFuzzyQuery(sq.Query)
-	fuzzyContentQ.SetField("text_content")
-	fuzzyContentQ.SetFuzziness(1) // Allow 1 edit distance
-	fuzzyContentQ.SetBoost(0.5)
-
-	fuzzyTitleQ := bleve.NewFuzzyQuery(sq.Query)
-	fuzzyTitleQ.SetField("page_title")
-	fuzzyTitleQ.SetFuzziness(1)
-	fuzzyTitleQ.SetBoost(0.8)
-
-	textQuery := bleve.NewDisjunctionQuery(matchQ, contentPhraseQ, titlePhraseQ, fuzzyContentQ, fuzzyTitleQ)
-
-	// Build filter queries
-	var filters []query.Query
-	filters = append(filters, textQuery)
-
-	if sq.ProjectSlug != "" {
-		pq := bleve.NewTermQuery(sq.ProjectSlug)
-		pq.SetField("project_slug")
-		filters = append(filters, pq)
-	}
-
-	if sq.VersionTag != "" {
-		vq := bleve.NewTermQuery(sq.VersionTag)
-		vq.SetField("version_tag")
-		filters = append(filters, vq)
-	} else if !sq.AllVersions && latestVersionTags != nil && len(latestVersionTags) > 0 {
-		var versionQueries []query.Query
-		for _, tag := range latestVersionTags {
-			vq := bleve.NewTermQuery(tag)
-			vq.SetField("version_tag")
-			versionQueries = append(versionQueries, vq)
-		}
-		if len(versionQueries) > 0 {
-			filters = append(filters, bleve.NewDisjunctionQuery(versionQueries...))
-		}
-	}
-
-	var finalQuery query.Query
-	if len(filters) == 1 {
-		finalQuery = filters[0]
-	} else {
-		finalQuery = bleve.NewConjunctionQuery(filters...)
-	}
-
-	searchReq := bleve.NewSearchRequestOptions(finalQuery, sq.Limit, sq.Offset, false)
-	searchReq.Fields = []string{"project_slug", "project_name", "version_tag", "file_path", "page_title", "page_number"}
-	searchReq.Highlight = bleve.NewHighlightWithStyle(html.Name)
-	searchReq.Highlight.AddField("text_content")
-	searchReq.Highlight.AddField("page_title")
-
-	searchResult, err := si.index.Search(searchReq)
-	if err != nil {
-		return nil, fmt.Errorf("search failed: %w", err)
-	}
-
-	results := &SearchResults{
-		Total:   searchResult.Total,
-		Results: make([]SearchResult, 0, len(searchResult.Hits)),
-	}
-
-	for _, hit := range searchResult.Hits {
-		sr := SearchResult{
-			ProjectSlug: fieldString(hit.Fields, "project_slug"),
-			ProjectName: fieldString(hit.Fields, "project_name"),
-			VersionTag:  fieldString(hit.Fields, "version_tag"),
-			FilePath:    fieldString(hit.Fields, "file_path"),
-			PageTitle:   fieldString(hit.Fields, "page_title"),
-			PageNumber:  fieldInt(hit.Fields, "page_number"),
-		}
-
-		if fragments, ok := hit.Fragments["text_content"]; ok && len(fragments) > 0 {
-			sr.Snippet = fragments[0]
-		} else if fragments, ok := hit.Fragments["page_title"]; ok && len(fragments) > 0 {
-			sr.Snippet = fragments[0]
-		}
-
-		if sr.PageNumber > 0 {
-			// PDF result: link to the viewer wrapper (without the filename)
-			// so the page fragment (#page=N) works with the embedded PDF
-			sr.URL = "/project/" + sr.ProjectSlug + "/" + sr.VersionTag + "/"
-		} else {
-			sr.URL = "/project/" + sr.ProjectSlug + "/" + sr.VersionTag + "/" + sr.FilePath
-		}
-
-		results.Results = append(results.Results, sr)
-	}
-
-	return results, nil
+	return si.backend.Search(ctx, sq, latestVersionTags)
 }
 
 // ReindexProject holds project data for reindexing.
 type ReindexProject struct {
-	ID   int64
-	Slug string
-	Name string
+	ID       int64
+	Slug     string
+	Name     string
+	Metadata map[string]string
 }
 
 // ReindexVersion holds version data for reindexing.
@@ -435,6 +376,7 @@ type ReindexVersion struct {
 	ProjectID   int64
 	Tag         string
 	StoragePath string
+	Metadata    map[string]string
 }
 
 // ReindexProgress reports reindexing progress.
@@ -443,40 +385,88 @@ type ReindexProgress struct {
 	Total   int
 	Project string
 	Version string
+	// Indexed and Skipped count the versions indexed again and those
+	// skipped as unchanged by ReindexVersions
+	Indexed int
+	Skipped int
 }
 
 // ReindexProgressFunc is called for each version during reindexing.
 type ReindexProgressFunc func(progress ReindexProgress)
 
 // ReindexAll rebuilds the entire search index from scratch.
-func (si *SearchIndex) ReindexAll(projects []ReindexProject, versions []ReindexVersion) error {
-	return si.ReindexAllWithProgress(projects, versions, nil)
-}
-
-// ReindexAllWithProgress rebuilds the index with progress reporting.
-func (si *SearchIndex) ReindexAllWithProgress(projects []ReindexProject, versions []ReindexVersion, progressFn ReindexProgressFunc) error {
-	// Delete all existing documents
-	q := bleve.NewMatchAllQuery()
-	req := bleve.NewSearchRequest(q)
-	req.Size = 10000
-	req.Fields = []string{}
-
-	results, err := si.index.Search(req)
-	if err == nil {
-		batch := si.index.NewBatch()
-		for _, hit := range results.Hits {
-			batch.Delete(hit.ID)
+func (si *SearchIndex) ReindexAll(ctx context.Context, projects []ReindexProject, versions []ReindexVersion) error {
+	return si.ReindexAllWithProgress(ctx, projects, versions, nil)
+}
+
+// ReindexAllWithProgress rebuilds the index with progress reporting. An
+// outdated index is recreated with the configured analysis. It stops when
+// ctx is cancelled; the index is marked incomplete until the
+// rebuild finishes, and a checkpoint of the rebuild lets ResumeReindex
+// continue it, see Checkpoint.
+func (si *SearchIndex) ReindexAllWithProgress(ctx context.Context, projects []ReindexProject, versions []ReindexVersion, progressFn ReindexProgressFunc) error {
+	cp := &ReindexCheckpoint{StartedAt: time.Now().UTC(), Queue: make([]int64, 0, len(versions)), Done: []int64{}}
+	for _, v := range versions {
+		cp.Queue = append(cp.Queue, v.ID)
+	}
+	if err := si.saveCheckpoint(cp); err != nil {
+		return err
+	}
+
+	if si.Outdated() {
+		if err := si.bleve.recreate(); err != nil {
+			return err
 		}
-		si.index.Batch(batch)
+	} else if err := si.backend.DeleteAll(ctx); err != nil {
+		return err
 	}
+	return si.reindex(ctx, cp, projects, versions, progressFn)
+}
 
+// ResumeReindex continues the rebuild recorded in the checkpoint with the
+// queued versions that were not indexed yet. Versions missing from
+// versions, e.g. deleted since, are skipped. It returns ErrNoCheckpoint if
+// no rebuild was interrupted.
+func (si *SearchIndex) ResumeReindex(ctx context.Context, projects []ReindexProject, versions []ReindexVersion, progressFn ReindexProgressFunc) error {
+	cp, err := si.Checkpoint()
+	if err != nil {
+		return err
+	}
+	if cp == nil || cp.Queue == nil {
+		return ErrNoCheckpoint
+	}
+	return si.reindex(ctx, cp, projects, versions, progressFn)
+}
+
+// reindex indexes the versions queued in cp that are not done, saving the
+// checkpoint as it goes, and marks the index complete at the end.
+func (si *SearchIndex) reindex(ctx context.Context, cp *ReindexCheckpoint, projects []ReindexProject, versions []ReindexVersion, progressFn ReindexProgressFunc) error {
 	projectMap := make(map[int64]ReindexProject)
 	for _, p := range projects {
 		projectMap[p.ID] = p
 	}
+	versionMap := make(map[int64]ReindexVersion)
+	for _, v := range versions {
+		versionMap[v.ID] = v
+	}
+	done := make(map[int64]bool, len(cp.Done))
+	for _, id := range cp.Done {
+		done[id] = true
+	}
 
-	total := len(versions)
-	for i, v := range versions {
+	saved := time.Now()
+	for _, id := range cp.Queue {
+		if err := ctx.Err(); err != nil {
+			si.saveCheckpoint(cp)
+			return err
+		}
+		if done[id] {
+			continue
+		}
+		v, ok := versionMap[id]
+		if !ok {
+			continue
+		}
 		p, ok := projectMap[v.ProjectID]
 		if !ok {
 			continue
@@ -484,45 +474,63 @@ func (si *SearchIndex) ReindexAllWithProgress(projects []ReindexProject, version
 
 		if progressFn != nil {
 			progressFn(ReindexProgress{
-				Current: i + 1,
-				Total:   total,
+				Current: len(cp.Done) + 1,
+				Total:   len(cp.Queue),
 				Project: p.Slug,
 				Version: v.Tag,
 			})
 		}
 
-		si.IndexVersion(p.ID, v.ID, p.Slug, p.Name, v.Tag, v.StoragePath)
+		if err := si.IndexVersionWithMetadata(ctx, p.ID, v.ID, p.Slug, p.Name, v.Tag, v.StoragePath, MergeMetadata(p.Metadata, v.Metadata)); err != nil && ctx.Err() != nil {
+			si.saveCheckpoint(cp)
+			return ctx.Err()
+		}
+		done[id] = true
+		cp.Done = append(cp.Done, id)
+		if time.Since(saved) >= checkpointInterval {
+			if err := si.saveCheckpoint(cp); err != nil {
+				return err
+			}
+			saved = time.Now()
+		}
 	}
 
-	return nil
+	return si.MarkComplete()
 }
 
-func fieldInt(fields map[string]interface{}, key string) int {
-	val, ok := fields[key]
-	if !ok {
-		return 0
-	}
-	switch v := val.(type) {
-	case float64:
-		return int(v)
-	case int:
-		return v
-	default:
-		return 0
+// incompleteMarker is the path of the file that exists while the index is
+// being rebuilt. It holds the checkpoint of the rebuild.
+func (si *SearchIndex) incompleteMarker() string {
+	return si.path + ".incomplete"
+}
+
+// Incomplete reports whether a rebuild of the index was interrupted, e.g.
+// by a shutdown, so that some versions may be missing from it.
+func (si *SearchIndex) Incomplete() bool {
+	_, err := os.Stat(si.incompleteMarker())
+	return err == nil
+}
+
+// MarkComplete clears the incomplete flag once all missing versions have
+// been indexed.
+func (si *SearchIndex) MarkComplete() error {
+	if err := os.Remove(si.incompleteMarker()); err != nil && !os.IsNotExist(err) {
+		return err
 	}
+	return nil
 }
 
-func fieldString(fields map[string]interface{}, key string) string {
-	val, ok := fields[key]
-	if !ok {
-		return ""
+// MergeMetadata combines project and version labels; version labels win.
+func MergeMetadata(project, version map[string]string) map[string]string {
+	if len(project) == 0 && len(version) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(project)+len(version))
+	for k, v := range project {
+		merged[k] = v
 	}
-	switch v := val.(type) {
-	case string:
-		return v
-	case float64:
-		return strconv.FormatFloat(v, 'f', -1, 64)
-	default:
-		return fmt.Sprintf("%v", v)
+	for k, v := range version {
+		merged[k] = v
 	}
+	return merged
 }
@@ -0,0 +1,187 @@
+package docs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/blevesearch/bleve/v2"
+	bolterrors "go.etcd.io/bbolt/errors"
+)
+
+var (
+	// ErrIndexIncomplete is returned when exporting an index that is being
+	// rebuilt, as the snapshot would miss versions.
+	ErrIndexIncomplete = errors.New("search index is incomplete; wait for the reindex to finish")
+	// ErrIndexInUse is returned when the index is opened by a running server.
+	ErrIndexInUse = errors.New("search index is in use; stop the server or export through the API")
+)
+
+// legacyIndexDir is the directory the index was kept in below the storage
+// base path, before its path became configurable.
+const legacyIndexDir = ".search-index"
+
+// offlineOpenTimeout bounds the wait for the lock of an index held by a
+// running server.
+const offlineOpenTimeout = "2s"
+
+// Export writes a consistent snapshot of the index as a zip archive to w,
+// while the index stays in use.
+func (si *SearchIndex) Export(w io.Writer) error {
+	if si.bleve == nil {
+		return ErrSnapshotUnsupported
+	}
+	if si.Incomplete() {
+		return ErrIndexIncomplete
+	}
+	idx, _ := si.bleve.current()
+	copyable, ok := idx.(bleve.IndexCopyable)
+	if !ok {
+		return fmt.Errorf("search index does not support snapshots")
+	}
+
+	tmp, err := os.MkdirTemp("", "asiakirjat-index-")
+	if err != nil {
+		return fmt.Errorf("creating snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := copyable.CopyTo(bleve.FileSystemDirectory(tmp)); err != nil {
+		return fmt.Errorf("copying search index: %w", err)
+	}
+	return WriteZipFromDir(w, tmp)
+}
+
+// ExportSearchIndex writes a snapshot of the index at indexPath to w.
+// It is meant for a stopped server and fails with ErrIndexInUse otherwise.
+func ExportSearchIndex(indexPath string, w io.Writer) error {
+	idx, err := bleve.OpenUsing(indexPath, map[string]interface{}{"bolt_timeout": offlineOpenTimeout})
+	if err != nil {
+		return openOfflineError(err)
+	}
+	b := &bleveIndex{index: idx, path: indexPath}
+	si := &SearchIndex{backend: b, bleve: b, path: b.path}
+	defer si.Close()
+	return si.Export(w)
+}
+
+// ImportSearchIndex replaces the index at indexPath with a snapshot
+// written by Export. The snapshot is checked before the current index is
+// replaced, and the new index is marked incomplete, see Incomplete. It is
+// meant for a stopped server and fails with ErrIndexInUse otherwise.
+func ImportSearchIndex(indexPath string, r io.Reader) error {
+	staging := indexPath + ".import"
+	if err := os.RemoveAll(staging); err != nil {
+		return fmt.Errorf("clearing import directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return fmt.Errorf("creating import directory: %w", err)
+	}
+	if err := ExtractArchiveWithOptions(r, "index.zip", staging, ExtractOptions{KeepSingleRoot: true}); err != nil {
+		return fmt.Errorf("extracting snapshot: %w", err)
+	}
+	imported, err := bleve.Open(staging)
+	if err != nil {
+		return fmt.Errorf("snapshot is not a search index: %w", err)
+	}
+	imported.Close()
+
+	if _, err := os.Stat(indexPath); err == nil {
+		current, err := bleve.OpenUsing(indexPath, map[string]interface{}{"bolt_timeout": offlineOpenTimeout})
+		if err != nil {
+			return openOfflineError(err)
+		}
+		current.Close()
+	}
+
+	old := indexPath + ".old"
+	if err := os.RemoveAll(old); err != nil {
+		return fmt.Errorf("clearing previous index: %w", err)
+	}
+	if err := os.Rename(indexPath, old); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("moving current index aside: %w", err)
+	}
+	if err := os.Rename(staging, indexPath); err != nil {
+		os.Rename(old, indexPath)
+		return fmt.Errorf("moving snapshot into place: %w", err)
+	}
+	os.RemoveAll(old)
+
+	// Versions uploaded after the snapshot was taken are missing; marking
+	// the index incomplete has the server index them at the next start.
+	if err := os.WriteFile(indexPath+".incomplete", nil, 0o644); err != nil {
+		return fmt.Errorf("marking search index incomplete: %w", err)
+	}
+	return nil
+}
+
+// LegacyIndexPath returns where the index was kept below the storage base
+// path, see RelocateSearchIndex.
+func LegacyIndexPath(storagePath string) string {
+	return filepath.Join(storagePath, legacyIndexDir)
+}
+
+// RelocateSearchIndex moves the index at from, with its rebuild state, to
+// to, and reports whether it did. It does nothing if there is no index at
+// from, or already one at to. Across file systems, the index is copied and
+// then removed from from. It is meant to run before the index is opened.
+func RelocateSearchIndex(from, to string) (bool, error) {
+	if filepath.Clean(from) == filepath.Clean(to) {
+		return false, nil
+	}
+	if _, err := os.Stat(from); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(to); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return false, fmt.Errorf("creating index directory: %w", err)
+	}
+
+	if err := os.Rename(from, to); err != nil {
+		// A copy interrupted halfway must not be taken for an index, so it
+		// is made next to to and renamed once complete.
+		staging := to + ".relocate"
+		if err := os.RemoveAll(staging); err != nil {
+			return false, fmt.Errorf("clearing relocation directory: %w", err)
+		}
+		if err := os.CopyFS(staging, os.DirFS(from)); err != nil {
+			os.RemoveAll(staging)
+			return false, fmt.Errorf("copying search index: %w", err)
+		}
+		if err := os.Rename(staging, to); err != nil {
+			os.RemoveAll(staging)
+			return false, fmt.Errorf("moving search index into place: %w", err)
+		}
+		if err := os.RemoveAll(from); err != nil {
+			return true, fmt.Errorf("removing old search index: %w", err)
+		}
+	}
+
+	marker := from + ".incomplete"
+	if data, err := os.ReadFile(marker); err == nil {
+		if err := os.WriteFile(to+".incomplete", data, 0o644); err != nil {
+			return true, fmt.Errorf("moving rebuild state: %w", err)
+		}
+		os.Remove(marker)
+	}
+	return true, nil
+}
+
+// openOfflineError reports a timeout waiting for the index lock as
+// ErrIndexInUse.
+func openOfflineError(err error) error {
+	if errors.Is(err, bolterrors.ErrTimeout) {
+		return ErrIndexInUse
+	}
+	return fmt.Errorf("opening search index: %w", err)
+}
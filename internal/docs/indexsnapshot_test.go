@@ -0,0 +1,105 @@
+package docs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchIndexSnapshot(t *testing.T) {
+	ctx := context.Background()
+	source := t.TempDir()
+	docsDir := filepath.Join(source, "docs")
+	os.MkdirAll(docsDir, 0755)
+	os.WriteFile(filepath.Join(docsDir, "index.html"), []byte("<html><head><title>Install</title></head><body>Installing the quasar module</body></html>"), 0644)
+
+	si, err := NewSearchIndex(filepath.Join(source, "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := si.IndexVersion(ctx, 1, 1, "demo", "Demo", "1.0", docsDir); err != nil {
+		t.Fatal(err)
+	}
+
+	var snapshot bytes.Buffer
+	if err := si.Export(&snapshot); err != nil {
+		t.Fatalf("exporting open index: %v", err)
+	}
+
+	// The running server holds the lock of the index
+	if err := ImportSearchIndex(filepath.Join(source, "index"), bytes.NewReader(snapshot.Bytes())); !errors.Is(err, ErrIndexInUse) {
+		t.Errorf("expected ErrIndexInUse importing over an open index, got %v", err)
+	}
+	si.Close()
+
+	target := filepath.Join(t.TempDir(), "index")
+	if err := ImportSearchIndex(target, bytes.NewReader(snapshot.Bytes())); err != nil {
+		t.Fatalf("importing snapshot: %v", err)
+	}
+	imported, err := NewSearchIndex(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imported.Close()
+	if !imported.Incomplete() {
+		t.Error("expected imported index to be marked incomplete until missing versions are indexed")
+	}
+	results, err := imported.Search(ctx, SearchQuery{Query: "quasar", AllVersions: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Total != 1 {
+		t.Errorf("expected 1 result in imported index, got %d", results.Total)
+	}
+
+	if err := ImportSearchIndex(target, bytes.NewReader([]byte("not a zip"))); err == nil {
+		t.Error("expected error importing an invalid snapshot")
+	}
+}
+
+func TestRelocateSearchIndex(t *testing.T) {
+	ctx := context.Background()
+	storage := t.TempDir()
+	docsDir := filepath.Join(storage, "guide", "1.0")
+	os.MkdirAll(docsDir, 0755)
+	os.WriteFile(filepath.Join(docsDir, "index.html"), []byte("<html><head><title>Install</title></head><body>Installing the quasar module</body></html>"), 0644)
+
+	legacy := LegacyIndexPath(storage)
+	si, err := NewSearchIndex(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := si.IndexVersion(ctx, 1, 1, "guide", "Guide", "1.0", docsDir); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(legacy+".incomplete", nil, 0o644)
+	si.Close()
+
+	to := filepath.Join(t.TempDir(), "data", "search-index")
+	moved, err := RelocateSearchIndex(legacy, to)
+	if err != nil || !moved {
+		t.Fatalf("expected the index to be moved, got %v, %v", moved, err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("expected the old index to be gone")
+	}
+	relocated, err := NewSearchIndex(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relocated.Close()
+	if !relocated.Incomplete() {
+		t.Error("expected the rebuild state to move along")
+	}
+	results, err := relocated.Search(ctx, SearchQuery{Query: "quasar", AllVersions: true}, nil)
+	if err != nil || results.Total != 1 {
+		t.Errorf("expected the relocated index to keep its pages, got %v, %v", results, err)
+	}
+
+	if moved, err := RelocateSearchIndex(legacy, to); moved || err != nil {
+		t.Errorf("expected nothing to relocate a second time, got %v, %v", moved, err)
+	}
+}
@@ -0,0 +1,47 @@
+package docs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// landingSearchDepth is how many directories deep FindLandingPage looks.
+const landingSearchDepth = 4
+
+// FindLandingPage returns the path, relative to root and with forward
+// slashes, of the index.html closest to the root of a stored version, such
+// as "docs/html/index.html" for Doxygen output. It returns "" when root has
+// an index.html itself or no index.html is found. Of pages at the same
+// depth, the first in lexical order wins.
+func FindLandingPage(root string) string {
+	if info, err := os.Stat(filepath.Join(root, "index.html")); err == nil && info.Mode().IsRegular() {
+		return ""
+	}
+
+	best := ""
+	bestDepth := landingSearchDepth + 1
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		depth := strings.Count(rel, "/")
+		if d.IsDir() {
+			// Files in the directory are one level deeper than it.
+			if rel != "." && (depth+1 >= bestDepth || depth+1 > landingSearchDepth || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// WalkDir visits entries in lexical order, so the first page found
+		// at a depth wins.
+		if d.Name() == "index.html" && d.Type().IsRegular() && depth < bestDepth {
+			best, bestDepth = rel, depth
+		}
+		return nil
+	})
+	return best
+}
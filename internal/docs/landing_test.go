@@ -0,0 +1,53 @@
+package docs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindLandingPage(t *testing.T) {
+	write := func(root string, files ...string) {
+		for _, f := range files {
+			path := filepath.Join(root, filepath.FromSlash(f))
+			os.MkdirAll(filepath.Dir(path), 0755)
+			os.WriteFile(path, []byte("<html></html>"), 0644)
+		}
+	}
+
+	for _, tt := range []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"root index", []string{"index.html", "docs/html/index.html"}, ""},
+		{"doxygen", []string{"docs/html/index.html", "docs/html/files.html"}, "docs/html/index.html"},
+		{"shallowest wins", []string{"a/b/c/index.html", "b/index.html"}, "b/index.html"},
+		{"lexical order", []string{"zeta/index.html", "alpha/index.html"}, "alpha/index.html"},
+		{"hidden dirs skipped", []string{".git/index.html", "site/index.html"}, "site/index.html"},
+		{"too deep", []string{"a/b/c/d/e/index.html"}, ""},
+		{"none", []string{"readme.txt"}, ""},
+	} {
+		root := t.TempDir()
+		write(root, tt.files...)
+		if got := FindLandingPage(root); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindIndexAlternate(t *testing.T) {
+	dir := t.TempDir()
+	if alt := FindIndexAlternate(dir); alt != "" {
+		t.Errorf("expected no alternate in an empty directory, got %q", alt)
+	}
+	os.MkdirAll(filepath.Join(dir, "docs"), 0755)
+	os.WriteFile(filepath.Join(dir, "docs", "index.html"), []byte("docs"), 0644)
+	if alt := FindIndexAlternate(dir); alt != "docs/index.html" {
+		t.Errorf("expected docs/index.html, got %q", alt)
+	}
+	os.WriteFile(filepath.Join(dir, "README.html"), []byte("readme"), 0644)
+	if alt := FindIndexAlternate(dir); alt != "README.html" {
+		t.Errorf("expected README.html to win over docs/index.html, got %q", alt)
+	}
+}
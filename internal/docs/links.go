@@ -0,0 +1,234 @@
+package docs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// LinkReportFile is the name of the link check report stored with a
+// version's attachments.
+const LinkReportFile = "links.json"
+
+// maxBrokenLinks caps the broken links kept in a report.
+const maxBrokenLinks = 1000
+
+// BrokenLink is a link from a page to a file missing from the version.
+// Count is the number of times the page links to it.
+type BrokenLink struct {
+	Page   string `json:"page"`
+	Target string `json:"target"`
+	Count  int    `json:"count"`
+}
+
+// LinkReport is the result of checking the internal links of all HTML
+// pages of a version.
+type LinkReport struct {
+	CheckedAt time.Time    `json:"checked_at"`
+	Pages     int          `json:"pages"`
+	Links     int          `json:"links"`
+	Broken    []BrokenLink `json:"broken"`
+	Truncated bool         `json:"truncated,omitempty"` // More broken links were found than kept
+}
+
+// Total returns the number of broken links in the report.
+func (r *LinkReport) Total() int {
+	total := 0
+	for _, link := range r.Broken {
+		total += link.Count
+	}
+	return total
+}
+
+// linkAttrs are the attributes holding links, by element.
+var linkAttrs = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"link":   "href",
+	"img":    "src",
+	"script": "src",
+	"iframe": "src",
+	"source": "src",
+	"audio":  "src",
+	"video":  "src",
+	"embed":  "src",
+}
+
+// CheckLinks checks the relative links of the HTML pages below root and
+// reports those pointing at files that do not exist. Links to other sites,
+// absolute paths and fragments of the same page are not checked. It stops
+// with ctx's error when ctx is cancelled.
+func CheckLinks(ctx context.Context, root string) (*LinkReport, error) {
+	report := &LinkReport{CheckedAt: time.Now().UTC(), Broken: []BrokenLink{}}
+	exists := make(map[string]bool)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if ext != ".html" && ext != ".htm" {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		page := filepath.ToSlash(rel)
+		targets, err := PageLinks(f, page)
+		if err != nil {
+			return fmt.Errorf("checking %s: %w", rel, err)
+		}
+		report.Pages++
+
+		counts := make(map[string]int)
+		var missing []string
+		for _, target := range targets {
+			report.Links++
+			found, seen := exists[target]
+			if !seen {
+				found = linkTargetExists(root, target)
+				exists[target] = found
+			}
+			if found {
+				continue
+			}
+			if counts[target] == 0 {
+				missing = append(missing, target)
+			}
+			counts[target]++
+		}
+		for _, target := range missing {
+			if len(report.Broken) == maxBrokenLinks {
+				report.Truncated = true
+				break
+			}
+			report.Broken = append(report.Broken, BrokenLink{Page: page, Target: target, Count: counts[target]})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(report.Broken, func(i, j int) bool { return report.Broken[i].Page < report.Broken[j].Page })
+	return report, nil
+}
+
+// PageLinks returns the targets of the relative links of a page, resolved
+// against page, its path within the version. Targets are slash-separated
+// paths within the version; a target ending in / is a directory.
+func PageLinks(r io.Reader, page string) ([]string, error) {
+	doc, err := xhtml.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	pageURL := &url.URL{Path: "/" + page}
+	var refs []string
+	walkHTML(doc, func(n *xhtml.Node) bool {
+		if n.Data == "base" {
+			if href, ok := attrOK(n, "href"); ok {
+				base, err := url.Parse(strings.TrimSpace(href))
+				if err != nil || base.Scheme != "" || base.Host != "" {
+					pageURL = nil // links resolve against another site
+				} else {
+					pageURL = pageURL.ResolveReference(base)
+				}
+			}
+		}
+		if key, ok := linkAttrs[n.Data]; ok {
+			if ref, ok := attrOK(n, key); ok {
+				refs = append(refs, ref)
+			}
+		}
+		return true
+	})
+	if pageURL == nil {
+		return nil, nil
+	}
+
+	var targets []string
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "/") {
+			continue
+		}
+		u, err := url.Parse(ref)
+		if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" {
+			continue
+		}
+		if u.Path == "" {
+			continue // only a query
+		}
+		target := pageURL.ResolveReference(u).Path
+		targets = append(targets, strings.TrimPrefix(target, "/"))
+	}
+	return targets, nil
+}
+
+// linkTargetExists reports whether target names a file below root, or a
+// directory with an index page.
+func linkTargetExists(root, target string) bool {
+	full := filepath.Join(root, filepath.FromSlash(path.Clean("/"+target)))
+	info, err := os.Stat(full)
+	if err != nil {
+		return false
+	}
+	if !info.IsDir() {
+		return !strings.HasSuffix(target, "/")
+	}
+	for _, index := range []string{"index.html", "index.htm"} {
+		if _, err := os.Stat(filepath.Join(full, index)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteLinkReport stores a report in dir.
+func WriteLinkReport(dir string, report *LinkReport) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating report directory: %w", err)
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("encoding link report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, LinkReportFile), data, 0644); err != nil {
+		return fmt.Errorf("writing link report: %w", err)
+	}
+	return nil
+}
+
+// ReadLinkReport loads the report stored in dir. The error satisfies
+// errors.Is(err, fs.ErrNotExist) if the version was not checked.
+func ReadLinkReport(dir string) (*LinkReport, error) {
+	data, err := os.ReadFile(filepath.Join(dir, LinkReportFile))
+	if err != nil {
+		return nil, err
+	}
+	var report LinkReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("decoding link report: %w", err)
+	}
+	return &report, nil
+}
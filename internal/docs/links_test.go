@@ -0,0 +1,94 @@
+package docs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPageLinks(t *testing.T) {
+	page := `<html><head><link rel="stylesheet" href="../css/style.css"></head><body>
+<a href="intro.html#setup">Intro</a>
+<a href="#top">Top</a>
+<a href="https://example.com/">Elsewhere</a>
+<a href="//cdn.example.com/x.js">CDN</a>
+<a href="/project/other/1.0/">Absolute</a>
+<a href="mailto:docs@example.com">Mail</a>
+<a href="?page=2">Query</a>
+<a href="api/">API</a>
+<a name="anchor">No href</a>
+<img src="img/My%20Diagram.png">
+</body></html>`
+
+	targets, err := PageLinks(strings.NewReader(page), "guide/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"css/style.css", "guide/intro.html", "guide/api/", "guide/img/My Diagram.png"}
+	if !slices.Equal(targets, want) {
+		t.Errorf("expected %v, got %v", want, targets)
+	}
+
+	targets, _ = PageLinks(strings.NewReader(`<base href="https://example.com/"><a href="a.html">A</a>`), "index.html")
+	if len(targets) != 0 {
+		t.Errorf("expected links resolving against another site to be skipped, got %v", targets)
+	}
+	targets, _ = PageLinks(strings.NewReader(`<base href="../"><a href="a.html">A</a>`), "guide/index.html")
+	if !slices.Equal(targets, []string{"a.html"}) {
+		t.Errorf("expected a relative base to apply, got %v", targets)
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"index.html":       `<a href="guide/">Guide</a><a href="missing.html">Missing</a><a href="missing.html">Again</a>`,
+		"guide/index.html": `<a href="../index.html">Home</a><img src="../img/logo.png"><a href="../empty/">Empty</a>`,
+		"empty/.keep":      "",
+		"style.css":        `body { background: url(missing.png); }`,
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, []byte(content), 0644)
+	}
+
+	report, err := CheckLinks(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Pages != 2 || report.Links != 6 {
+		t.Errorf("expected 6 links on 2 pages, got %d on %d", report.Links, report.Pages)
+	}
+	want := []BrokenLink{
+		{Page: "guide/index.html", Target: "img/logo.png", Count: 1},
+		{Page: "guide/index.html", Target: "empty/", Count: 1},
+		{Page: "index.html", Target: "missing.html", Count: 2},
+	}
+	if !slices.Equal(report.Broken, want) {
+		t.Errorf("expected %+v, got %+v", want, report.Broken)
+	}
+	if report.Total() != 4 {
+		t.Errorf("expected 4 broken links, got %d", report.Total())
+	}
+
+	dir := t.TempDir()
+	if _, err := ReadLinkReport(dir); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist before writing, got %v", err)
+	}
+	if err := WriteLinkReport(dir, report); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadLinkReport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Total() != 4 || got.Pages != 2 {
+		t.Errorf("unexpected report after reading back: %+v", got)
+	}
+}
@@ -0,0 +1,100 @@
+package docs
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IndexAlternates are the pages tried, in order, when a directory has no
+// index.html.
+var IndexAlternates = []string{"index.htm", "README.html", "readme.html", "docs/index.html", "index.md", "README.md", "readme.md"}
+
+// FindIndexAlternate returns the first of IndexAlternates that is a file
+// in dir, as a slash-separated path relative to dir, or "" if none is.
+func FindIndexAlternate(dir string) string {
+	for _, name := range IndexAlternates {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err == nil && info.Mode().IsRegular() {
+			return name
+		}
+	}
+	return ""
+}
+
+// HasIndexPage reports whether dir has an index.html, which is served for
+// the directory.
+func HasIndexPage(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "index.html"))
+	return err == nil && !info.IsDir()
+}
+
+// DirEntry is a file or directory in a directory listing.
+type DirEntry struct {
+	Name    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// SizeText returns the size of a file in human-readable units.
+func (e DirEntry) SizeText() string {
+	if e.IsDir {
+		return ""
+	}
+	return FormatSize(e.Size)
+}
+
+// FormatSize returns a number of bytes in human-readable units.
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, prefix := float64(n)/unit, 0
+	for size >= unit && prefix < 3 {
+		size /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %ciB", size, "KMGT"[prefix])
+}
+
+// Href returns the link to the entry relative to its directory listing.
+func (e DirEntry) Href() string {
+	href := "./" + url.PathEscape(e.Name)
+	if e.IsDir {
+		href += "/"
+	}
+	return href
+}
+
+// ListDir lists dir for a directory listing page: directories first, then
+// files, each sorted by name. Hidden entries are left out.
+func ListDir(dir string) ([]DirEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]DirEntry, 0, len(entries))
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, DirEntry{Name: e.Name(), IsDir: e.IsDir(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].IsDir != list[j].IsDir {
+			return list[i].IsDir
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
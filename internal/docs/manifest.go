@@ -0,0 +1,101 @@
+package docs
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ManifestEntry is a file of a version with its size and hex SHA-256.
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists the files of a version, sorted by path, which uses
+// forward slashes and is relative to the version directory.
+type Manifest []ManifestEntry
+
+// Size returns the total size of the files.
+func (m Manifest) Size() int64 {
+	var size int64
+	for _, e := range m {
+		size += e.Size
+	}
+	return size
+}
+
+// Digest returns the SHA-256 of the lines "<sha256>  <path>\n" of all
+// files, as sha256sum prints them. It changes with the content or name of
+// any file.
+func (m Manifest) Digest() string {
+	digest := sha256.New()
+	for _, e := range m {
+		fmt.Fprintf(digest, "%s  %s\n", e.SHA256, e.Path)
+	}
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+func (m Manifest) sort() {
+	slices.SortFunc(m, func(a, b ManifestEntry) int { return cmp.Compare(a.Path, b.Path) })
+}
+
+// BuildManifest hashes the regular files below root. Uploads get their
+// manifest while they are extracted; this is for versions stored without
+// one.
+func BuildManifest(ctx context.Context, root string) (Manifest, error) {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing version files: %w", err)
+	}
+
+	m := make(Manifest, 0, len(paths))
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sum, size, err := hashFile(filepath.Join(root, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, err
+		}
+		m = append(m, ManifestEntry{Path: path, Size: size, SHA256: sum})
+	}
+	m.sort()
+	return m, nil
+}
+
+// hashFile returns the hex SHA-256 and size of a file.
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,51 @@
+package docs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildManifest(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "a"), 0755)
+	os.WriteFile(filepath.Join(root, "a", "b.html"), []byte("bee"), 0644)
+	os.WriteFile(filepath.Join(root, "a-b.html"), []byte("ab"), 0644)
+
+	m, err := BuildManifest(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 2 || m.Size() != 5 || m[0].Path != "a-b.html" || m[1].Path != "a/b.html" {
+		t.Errorf("expected 2 files of 5 bytes sorted by path, got %+v", m)
+	}
+
+	// The same as: find . -type f | sed 's|^\./||' | LC_ALL=C sort | xargs sha256sum | sha256sum
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	want := hash(hash("ab") + "  a-b.html\n" + hash("bee") + "  a/b.html\n")
+	if got := m.Digest(); got != want {
+		t.Errorf("expected digest %s, got %s", want, got)
+	}
+}
+
+func TestExtractManifest(t *testing.T) {
+	var m Manifest
+	data := tarGzWithEntries(t, "site/", "site/index.html", "site/css/style.css")
+	if err := ExtractArchiveWithOptions(bytes.NewReader(data), "docs.tar.gz", t.TempDir(), ExtractOptions{Manifest: &m}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 2 || m[0].Path != "css/style.css" || m[1].Path != "index.html" {
+		t.Fatalf("expected the flattened paths, got %+v", m)
+	}
+	sum := sha256.Sum256([]byte("site/index.html"))
+	if m[1].SHA256 != hex.EncodeToString(sum[:]) || m[1].Size != int64(len("site/index.html")) {
+		t.Errorf("unexpected entry %+v", m[1])
+	}
+}
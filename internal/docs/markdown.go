@@ -0,0 +1,225 @@
+package docs
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/markdown"
+)
+
+// maxMarkdownNav caps the pages listed in the navigation of a Markdown
+// page.
+const maxMarkdownNav = 500
+
+var md = markdown.New()
+
+// IsMarkdown reports whether name is a Markdown file by its extension.
+func IsMarkdown(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// MarkdownNavItem is a page or directory in the navigation of a Markdown
+// page.
+type MarkdownNavItem struct {
+	Name     string
+	Href     string // empty for directories
+	Current  bool
+	Children []*MarkdownNavItem
+}
+
+// MarkdownPage is a Markdown file rendered as an HTML document.
+type MarkdownPage struct {
+	Title string
+	Body  template.HTML
+	Nav   []*MarkdownNavItem
+}
+
+// RenderMarkdown converts Markdown to HTML.
+func RenderMarkdown(source []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := md.Convert(source, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderMarkdownPage renders the Markdown file page, a slash-separated path
+// below root, as a standalone HTML document. The navigation lists the
+// Markdown files below root, linked below baseURL, the URL of root ending
+// in a slash.
+func RenderMarkdownPage(root, page, baseURL string) ([]byte, error) {
+	source, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path.Clean("/"+page))))
+	if err != nil {
+		return nil, err
+	}
+	body, err := RenderMarkdown(source)
+	if err != nil {
+		return nil, fmt.Errorf("rendering %s: %w", page, err)
+	}
+	title := markdown.Title(md, source)
+	if title == "" {
+		title = strings.TrimSuffix(path.Base(page), path.Ext(page))
+	}
+
+	var buf bytes.Buffer
+	err = markdownPageTemplate.Execute(&buf, MarkdownPage{
+		Title: title,
+		Body:  template.HTML(body),
+		Nav:   markdownNav(root, page, baseURL),
+	})
+	return buf.Bytes(), err
+}
+
+// MarkdownText returns the text of Markdown without its markup, such as
+// for the description of a link preview.
+func MarkdownText(source string) string {
+	body, err := RenderMarkdown([]byte(source))
+	if err != nil {
+		return source
+	}
+	_, text, err := extractTextFromReader(bytes.NewReader(body))
+	if err != nil {
+		return source
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// extractTextFromMarkdown returns the title and text of a Markdown file
+// for the search index.
+func extractTextFromMarkdown(filePath string) (title, text string, err error) {
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := RenderMarkdown(source)
+	if err != nil {
+		return "", "", err
+	}
+	_, text, err = extractTextFromReader(bytes.NewReader(body))
+	return markdown.Title(md, source), text, err
+}
+
+// markdownNav builds the navigation tree of the Markdown files below root,
+// directories first, then files, each sorted by name. Hidden files and
+// directories are left out.
+func markdownNav(root, current, baseURL string) []*MarkdownNavItem {
+	top := &MarkdownNavItem{}
+	dirs := map[string]*MarkdownNavItem{".": top}
+	count := 0
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != root {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !IsMarkdown(d.Name()) {
+			return nil
+		}
+		if count == maxMarkdownNav {
+			return filepath.SkipAll
+		}
+		count++
+
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		parent := navDir(dirs, path.Dir(rel))
+		parent.Children = append(parent.Children, &MarkdownNavItem{
+			Name:    strings.TrimSuffix(d.Name(), path.Ext(d.Name())),
+			Href:    baseURL + (&url.URL{Path: rel}).EscapedPath(),
+			Current: rel == current,
+		})
+		return nil
+	})
+	sortNav(top.Children)
+	return top.Children
+}
+
+// navDir returns the navigation item of a directory, adding it and its
+// parents as needed.
+func navDir(dirs map[string]*MarkdownNavItem, dir string) *MarkdownNavItem {
+	if item, ok := dirs[dir]; ok {
+		return item
+	}
+	parent := navDir(dirs, path.Dir(dir))
+	item := &MarkdownNavItem{Name: path.Base(dir)}
+	parent.Children = append(parent.Children, item)
+	dirs[dir] = item
+	return item
+}
+
+func sortNav(items []*MarkdownNavItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if (items[i].Href == "") != (items[j].Href == "") {
+			return items[i].Href == ""
+		}
+		return items[i].Name < items[j].Name
+	})
+	for _, item := range items {
+		sortNav(item.Children)
+	}
+}
+
+var markdownPageTemplate = template.Must(template.New("markdown").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<script>(function(){var m=document.cookie.match(/(?:^|;\s*)asiakirjat_theme=(light|dark)/);document.documentElement.setAttribute("data-theme",m?m[1]:window.matchMedia&&matchMedia("(prefers-color-scheme: dark)").matches?"dark":"light")})()</script>
+<style>
+body{margin:0;font:16px/1.6 system-ui,-apple-system,"Segoe UI",sans-serif;color:#1f2937;background:#fff}
+.md-layout{display:flex;max-width:1200px;margin:0 auto}
+.md-nav{flex:0 0 16rem;padding:1.5rem 1rem;border-right:1px solid #e5e7eb;font-size:.9rem;position:sticky;top:0;align-self:flex-start;max-height:100vh;overflow-y:auto;box-sizing:border-box}
+.md-nav ul{list-style:none;margin:0;padding-left:.9rem}
+.md-nav>ul{padding-left:0}
+.md-nav li{margin:.2rem 0}
+.md-nav a{color:#2563eb;text-decoration:none}
+.md-nav a:hover{text-decoration:underline}
+.md-nav a[aria-current]{font-weight:600;color:#1f2937}
+.md-nav .md-dir{color:#6b7280;font-weight:600}
+.md-content{flex:1;min-width:0;padding:1.5rem 2rem 4rem}
+.md-content pre{background:#f6f8fa;padding:1rem;overflow-x:auto;border-radius:6px;font-size:.875rem;line-height:1.45}
+.md-content code{font-family:ui-monospace,SFMono-Regular,Menlo,Consolas,monospace;font-size:.9em}
+.md-content :not(pre)>code{background:#f3f4f6;padding:.1em .3em;border-radius:4px}
+.md-content table{border-collapse:collapse}
+.md-content th,.md-content td{border:1px solid #d1d5db;padding:.4rem .75rem}
+.md-content img{max-width:100%}
+.md-content blockquote{margin-left:0;padding-left:1rem;border-left:4px solid #d1d5db;color:#4b5563}
+.hl-k{color:#cf222e}.hl-s{color:#0a3069}.hl-c{color:#6e7781;font-style:italic}.hl-n{color:#0550ae}
+[data-theme=dark]{color-scheme:dark}
+[data-theme=dark] body{color:#e5e7eb;background:#111827}
+[data-theme=dark] .md-nav,[data-theme=dark] .md-content th,[data-theme=dark] .md-content td{border-color:#374151}
+[data-theme=dark] .md-nav a,[data-theme=dark] .md-content a{color:#60a5fa}
+[data-theme=dark] .md-nav a[aria-current]{color:#e5e7eb}
+[data-theme=dark] .md-content pre,[data-theme=dark] .md-content :not(pre)>code{background:#1f2937}
+[data-theme=dark] .md-content blockquote{border-color:#4b5563;color:#9ca3af}
+[data-theme=dark] .hl-k{color:#ff7b72}[data-theme=dark] .hl-s{color:#a5d6ff}[data-theme=dark] .hl-c{color:#8b949e}[data-theme=dark] .hl-n{color:#79c0ff}
+@media (max-width:768px){.md-layout{display:block}.md-nav{position:static;max-height:none;border-right:0;border-bottom:1px solid #e5e7eb}}
+</style>
+</head>
+<body>
+<div class="md-layout">
+{{if .Nav}}<nav class="md-nav" aria-label="Pages">{{template "nav" .Nav}}</nav>{{end}}
+<main class="md-content">
+{{.Body}}
+</main>
+</div>
+</body>
+</html>
+{{define "nav"}}<ul>{{range .}}<li>{{if .Href}}<a href="{{.Href}}"{{if .Current}} aria-current="page"{{end}}>{{.Name}}</a>{{else}}<span class="md-dir">{{.Name}}</span>{{template "nav" .Children}}{{end}}</li>{{end}}</ul>{{end}}`))
@@ -0,0 +1,422 @@
+package docs
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MeilisearchOptions configures the Meilisearch backend.
+type MeilisearchOptions struct {
+	URL    string // e.g. "http://meilisearch:7700"
+	APIKey string // sent as bearer token; empty for an unprotected instance
+	// Index is the uid of the index of the pages, "asiakirjat" by default.
+	// The content hashes of versions are kept in Index + "-versions".
+	Index string
+}
+
+const (
+	// meiliBatchSize bounds the documents sent per request.
+	meiliBatchSize = 1000
+	// meiliTaskTimeout bounds the wait for a task, e.g. indexing a batch.
+	meiliTaskTimeout  = 5 * time.Minute
+	meiliPollInterval = 50 * time.Millisecond
+
+	// The highlight tags asked for, which cannot be in extracted text
+	// and are replaced with <mark> once the snippet is escaped
+	meiliPreTag  = "\uE000"
+	meiliPostTag = "\uE001"
+)
+
+// meilisearch keeps the search index in a Meilisearch instance, through
+// its REST API.
+type meilisearch struct {
+	url      string
+	apiKey   string
+	index    string // pages
+	versions string // content hashes of versions
+	client   *http.Client
+}
+
+// NewMeilisearchBackend connects to Meilisearch, creating the indexes if
+// they do not exist, and configures which attributes are searched and
+// filtered on.
+func NewMeilisearchBackend(ctx context.Context, opts MeilisearchOptions) (SearchBackend, error) {
+	if opts.URL == "" {
+		return nil, errors.New("meilisearch: url is required")
+	}
+	m := &meilisearch{
+		url:    strings.TrimSuffix(opts.URL, "/"),
+		apiKey: opts.APIKey,
+		index:  cmp.Or(opts.Index, "asiakirjat"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	m.versions = m.index + "-versions"
+
+	for _, uid := range []string{m.index, m.versions} {
+		err := m.write(ctx, "POST", "/indexes", map[string]string{"uid": uid, "primaryKey": "id"})
+		var merr *meiliError
+		if err != nil && !(errors.As(err, &merr) && merr.Code == "index_already_exists") {
+			return nil, fmt.Errorf("creating meilisearch index %s: %w", uid, err)
+		}
+	}
+	settings := map[string]any{
+		"searchableAttributes": []string{"page_title", "text_content", "project_name"},
+		"filterableAttributes": []string{"project_id", "version_id", "project_slug", "version_tag", "meta"},
+	}
+	if err := m.write(ctx, "PATCH", "/indexes/"+m.index+"/settings", settings); err != nil {
+		return nil, fmt.Errorf("configuring meilisearch index: %w", err)
+	}
+	return m, nil
+}
+
+// meiliError is an error returned by Meilisearch, or by one of its tasks.
+type meiliError struct {
+	Message string `json:"message"`
+	Code    string `json:"code"`
+}
+
+func (e *meiliError) Error() string {
+	return "meilisearch: " + e.Message + " (" + e.Code + ")"
+}
+
+// do sends a request with body as JSON and decodes the response into out.
+func (m *meilisearch) do(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, m.url+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("meilisearch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		merr := &meiliError{}
+		if err := json.NewDecoder(resp.Body).Decode(merr); err != nil || merr.Code == "" {
+			return fmt.Errorf("meilisearch: %s %s: %s", method, path, resp.Status)
+		}
+		return merr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// write sends a request that enqueues a task, and waits for the task to
+// finish. Meilisearch applies writes asynchronously.
+func (m *meilisearch) write(ctx context.Context, method, path string, body any) error {
+	var task struct {
+		TaskUID int64 `json:"taskUid"`
+	}
+	if err := m.do(ctx, method, path, body, &task); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, meiliTaskTimeout)
+	defer cancel()
+	for {
+		var status struct {
+			Status string      `json:"status"`
+			Error  *meiliError `json:"error"`
+		}
+		if err := m.do(ctx, "GET", "/tasks/"+strconv.FormatInt(task.TaskUID, 10), nil, &status); err != nil {
+			return err
+		}
+		switch status.Status {
+		case "succeeded":
+			return nil
+		case "failed", "canceled":
+			if status.Error != nil {
+				return status.Error
+			}
+			return fmt.Errorf("meilisearch: task %d %s", task.TaskUID, status.Status)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("meilisearch: waiting for task %d: %w", task.TaskUID, ctx.Err())
+		case <-time.After(meiliPollInterval):
+		}
+	}
+}
+
+// meiliDoc is a page as sent to Meilisearch, whose document IDs may only
+// hold letters, digits, hyphens and underscores.
+type meiliDoc struct {
+	ID string `json:"id"`
+	Document
+}
+
+func meiliID(docID string) string {
+	sum := sha256.Sum256([]byte(docID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// meiliVersion records the content hash of an indexed version.
+type meiliVersion struct {
+	ID   int64  `json:"id"`
+	Hash string `json:"hash"`
+}
+
+func (m *meilisearch) Index(ctx context.Context, versionID int64, docs []Document, hash string) error {
+	for batch := range slices.Chunk(docs, meiliBatchSize) {
+		body := make([]meiliDoc, 0, len(batch))
+		for _, doc := range batch {
+			body = append(body, meiliDoc{ID: meiliID(doc.ID), Document: doc})
+		}
+		if err := m.write(ctx, "POST", "/indexes/"+m.index+"/documents", body); err != nil {
+			return fmt.Errorf("indexing batch: %w", err)
+		}
+	}
+	// Recorded last, so that a version is only skipped as unchanged once
+	// all its pages are in
+	version := []meiliVersion{{ID: versionID, Hash: hash}}
+	if err := m.write(ctx, "POST", "/indexes/"+m.versions+"/documents", version); err != nil {
+		return fmt.Errorf("recording content hash: %w", err)
+	}
+	return nil
+}
+
+func (m *meilisearch) IndexedHash(ctx context.Context, versionID int64) (string, error) {
+	var version meiliVersion
+	err := m.do(ctx, "GET", "/indexes/"+m.versions+"/documents/"+strconv.FormatInt(versionID, 10), nil, &version)
+	var merr *meiliError
+	if errors.As(err, &merr) && merr.Code == "document_not_found" {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading content hash: %w", err)
+	}
+	return version.Hash, nil
+}
+
+func (m *meilisearch) DeleteVersion(ctx context.Context, projectID, versionID int64) error {
+	filter := map[string]string{"filter": "version_id = " + strconv.FormatInt(versionID, 10)}
+	if err := m.write(ctx, "POST", "/indexes/"+m.index+"/documents/delete", filter); err != nil {
+		return fmt.Errorf("deleting version docs: %w", err)
+	}
+	if err := m.write(ctx, "DELETE", "/indexes/"+m.versions+"/documents/"+strconv.FormatInt(versionID, 10), nil); err != nil {
+		return fmt.Errorf("deleting content hash: %w", err)
+	}
+	return nil
+}
+
+func (m *meilisearch) DeleteAll(ctx context.Context) error {
+	for _, uid := range []string{m.index, m.versions} {
+		if err := m.write(ctx, "DELETE", "/indexes/"+uid+"/documents", nil); err != nil {
+			return fmt.Errorf("deleting indexed docs: %w", err)
+		}
+	}
+	return nil
+}
+
+// IndexedVersionIDs returns the versions with a recorded content hash,
+// which are those indexed completely.
+func (m *meilisearch) IndexedVersionIDs(ctx context.Context) (map[int64]bool, error) {
+	const pageSize = 1000
+	ids := make(map[int64]bool)
+	for offset := 0; ; offset += pageSize {
+		var page struct {
+			Results []meiliVersion `json:"results"`
+		}
+		query := url.Values{"limit": {strconv.Itoa(pageSize)}, "offset": {strconv.Itoa(offset)}, "fields": {"id"}}
+		if err := m.do(ctx, "GET", "/indexes/"+m.versions+"/documents?"+query.Encode(), nil, &page); err != nil {
+			return nil, fmt.Errorf("listing indexed versions: %w", err)
+		}
+		for _, v := range page.Results {
+			ids[v.ID] = true
+		}
+		if len(page.Results) < pageSize {
+			return ids, nil
+		}
+	}
+}
+
+// meiliHit is a page found by a search, with its highlighted and cropped
+// attributes.
+type meiliHit struct {
+	Document
+	Formatted struct {
+		PageTitle   string `json:"page_title"`
+		TextContent string `json:"text_content"`
+	} `json:"_formatted"`
+}
+
+func (h meiliHit) result() SearchResult {
+	sr := SearchResult{
+		ProjectSlug: h.ProjectSlug,
+		ProjectName: h.ProjectName,
+		VersionTag:  h.VersionTag,
+		FilePath:    h.FilePath,
+		PageTitle:   h.PageTitle,
+		PageNumber:  h.PageNumber,
+	}
+	sr.URL = sr.pageURL()
+	return sr
+}
+
+// search runs a search with the scope of sq, asking for the title and a
+// cropped part of the text around the matches, highlighted.
+func (m *meilisearch) search(ctx context.Context, sq SearchQuery, latestVersionTags map[string]string, matchAll bool) ([]meiliHit, uint64, error) {
+	body := map[string]any{
+		"q":                     sq.Query,
+		"limit":                 sq.Limit,
+		"offset":                sq.Offset,
+		"attributesToRetrieve":  []string{"project_slug", "project_name", "version_tag", "file_path", "page_title", "page_number"},
+		"attributesToHighlight": []string{"page_title", "text_content"},
+		"attributesToCrop":      []string{"text_content"},
+		"cropLength":            30,
+		"highlightPreTag":       meiliPreTag,
+		"highlightPostTag":      meiliPostTag,
+	}
+	if filter := meiliFilter(sq, latestVersionTags); filter != "" {
+		body["filter"] = filter
+	}
+	if matchAll {
+		body["matchingStrategy"] = "all"
+	}
+	var resp struct {
+		Hits               []meiliHit `json:"hits"`
+		EstimatedTotalHits uint64     `json:"estimatedTotalHits"`
+	}
+	if err := m.do(ctx, "POST", "/indexes/"+m.index+"/search", body, &resp); err != nil {
+		return nil, 0, err
+	}
+	return resp.Hits, resp.EstimatedTotalHits, nil
+}
+
+func (m *meilisearch) Search(ctx context.Context, sq SearchQuery, latestVersionTags map[string]string) (*SearchResults, error) {
+	hits, total, err := m.search(ctx, sq, latestVersionTags, false)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	results := &SearchResults{Total: total, Results: make([]SearchResult, 0, len(hits))}
+	for _, hit := range hits {
+		sr := hit.result()
+		if strings.Contains(hit.Formatted.TextContent, meiliPreTag) {
+			sr.Snippet = meiliSnippet(hit.Formatted.TextContent)
+		} else if strings.Contains(hit.Formatted.PageTitle, meiliPreTag) {
+			sr.Snippet = meiliSnippet(hit.Formatted.PageTitle)
+		}
+		results.Results = append(results.Results, sr)
+	}
+	return results, nil
+}
+
+// Suggest relies on Meilisearch matching the last word of a query as a
+// prefix; all the words have to match.
+func (m *meilisearch) Suggest(ctx context.Context, sq SearchQuery, latestVersionTags map[string]string) ([]Suggestion, error) {
+	words := strings.Fields(strings.ToLower(sq.Query))
+	prefix := words[len(words)-1]
+	hits, _, err := m.search(ctx, sq, latestVersionTags, true)
+	if err != nil {
+		return nil, fmt.Errorf("suggest failed: %w", err)
+	}
+	suggestions := make([]Suggestion, 0, len(hits))
+	for _, hit := range hits {
+		s := Suggestion{SearchResult: hit.result()}
+		seen := make(map[string]bool)
+		for _, word := range slices.Concat(markedWords(hit.Formatted.PageTitle), markedWords(hit.Formatted.TextContent)) {
+			if strings.HasPrefix(word, prefix) && !seen[word] {
+				seen[word] = true
+				s.Terms = append(s.Terms, word)
+			}
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, nil
+}
+
+func (m *meilisearch) Close() error {
+	m.client.CloseIdleConnections()
+	return nil
+}
+
+// meiliFilter restricts a search to the project, version and labels of
+// sq, like scopedQuery.
+func meiliFilter(sq SearchQuery, latestVersionTags map[string]string) string {
+	var filters []string
+	if sq.ProjectSlug != "" {
+		filters = append(filters, "project_slug = "+meiliQuote(sq.ProjectSlug))
+	}
+	for _, key := range slices.Sorted(maps.Keys(sq.Metadata)) {
+		filters = append(filters, "meta."+key+" = "+meiliQuote(sq.Metadata[key]))
+	}
+	if sq.VersionTag != "" {
+		filters = append(filters, "version_tag = "+meiliQuote(sq.VersionTag))
+	} else if !sq.AllVersions && len(latestVersionTags) > 0 {
+		var tags []string
+		for _, tag := range slices.Sorted(maps.Values(latestVersionTags)) {
+			tags = append(tags, meiliQuote(tag))
+		}
+		filters = append(filters, "version_tag IN ["+strings.Join(slices.Compact(tags), ", ")+"]")
+	}
+	return strings.Join(filters, " AND ")
+}
+
+func meiliQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// meiliSnippet escapes a highlighted text for HTML, marking the matches
+// like the embedded index does.
+func meiliSnippet(formatted string) string {
+	return strings.NewReplacer(meiliPreTag, "<mark>", meiliPostTag, "</mark>").Replace(html.EscapeString(formatted))
+}
+
+// markedWords returns the words of a highlighted text that start with a
+// match, lowercased. Matches of prefixes only cover the prefix.
+func markedWords(formatted string) []string {
+	var words []string
+	for {
+		start := strings.Index(formatted, meiliPreTag)
+		if start < 0 {
+			return words
+		}
+		formatted = formatted[start+len(meiliPreTag):]
+		end := strings.Index(formatted, meiliPostTag)
+		if end < 0 {
+			return words
+		}
+		word := formatted[:end]
+		formatted = formatted[end+len(meiliPostTag):]
+		rest := strings.IndexFunc(formatted, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if rest < 0 {
+			rest = len(formatted)
+		}
+		words = append(words, strings.ToLower(word+formatted[:rest]))
+	}
+}
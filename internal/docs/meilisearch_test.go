@@ -0,0 +1,219 @@
+package docs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeMeilisearch is an in-memory Meilisearch with the parts of the API the
+// backend uses. Tasks succeed at once; searches match text containing the
+// query.
+type fakeMeilisearch struct {
+	mu       sync.Mutex
+	indexes  map[string]map[string]map[string]any
+	settings map[string]any
+	searches []map[string]any
+	auth     string
+}
+
+func newFakeMeilisearch(t *testing.T) (*fakeMeilisearch, *httptest.Server) {
+	f := &fakeMeilisearch{indexes: make(map[string]map[string]map[string]any)}
+	mux := http.NewServeMux()
+	task := func(w http.ResponseWriter) {
+		json.NewEncoder(w).Encode(map[string]any{"taskUid": 1})
+	}
+	decode := func(r *http.Request, v any) {
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			t.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+		}
+	}
+	mux.HandleFunc("GET /tasks/{uid}", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"status": "succeeded"})
+	})
+	mux.HandleFunc("POST /indexes", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		decode(r, &body)
+		f.auth = r.Header.Get("Authorization")
+		if f.indexes[body["uid"]] == nil {
+			f.indexes[body["uid"]] = make(map[string]map[string]any)
+		}
+		task(w)
+	})
+	mux.HandleFunc("PATCH /indexes/{uid}/settings", func(w http.ResponseWriter, r *http.Request) {
+		decode(r, &f.settings)
+		task(w)
+	})
+	mux.HandleFunc("POST /indexes/{uid}/documents", func(w http.ResponseWriter, r *http.Request) {
+		var docs []map[string]any
+		decode(r, &docs)
+		for _, doc := range docs {
+			f.indexes[r.PathValue("uid")][docID(doc)] = doc
+		}
+		task(w)
+	})
+	mux.HandleFunc("POST /indexes/{uid}/documents/delete", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		decode(r, &body)
+		for id, doc := range f.indexes[r.PathValue("uid")] {
+			if body["filter"] == "version_id = "+strconv.Itoa(int(doc["version_id"].(float64))) {
+				delete(f.indexes[r.PathValue("uid")], id)
+			}
+		}
+		task(w)
+	})
+	mux.HandleFunc("DELETE /indexes/{uid}/documents", func(w http.ResponseWriter, r *http.Request) {
+		clear(f.indexes[r.PathValue("uid")])
+		task(w)
+	})
+	mux.HandleFunc("DELETE /indexes/{uid}/documents/{id}", func(w http.ResponseWriter, r *http.Request) {
+		delete(f.indexes[r.PathValue("uid")], r.PathValue("id"))
+		task(w)
+	})
+	mux.HandleFunc("GET /indexes/{uid}/documents/{id}", func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := f.indexes[r.PathValue("uid")][r.PathValue("id")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Document not found.", "code": "document_not_found"})
+			return
+		}
+		json.NewEncoder(w).Encode(doc)
+	})
+	mux.HandleFunc("GET /indexes/{uid}/documents", func(w http.ResponseWriter, r *http.Request) {
+		var results []map[string]any
+		for _, doc := range f.indexes[r.PathValue("uid")] {
+			results = append(results, doc)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"results": results})
+	})
+	mux.HandleFunc("POST /indexes/{uid}/search", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		decode(r, &body)
+		f.searches = append(f.searches, body)
+		q := strings.ToLower(body["q"].(string))
+		pre, post := body["highlightPreTag"].(string), body["highlightPostTag"].(string)
+		var hits []map[string]any
+		for _, doc := range f.indexes[r.PathValue("uid")] {
+			text := doc["text_content"].(string)
+			i := strings.Index(strings.ToLower(text), q)
+			if i < 0 {
+				continue
+			}
+			hit := map[string]any{"_formatted": map[string]any{
+				"page_title":   doc["page_title"],
+				"text_content": text[:i] + pre + text[i:i+len(q)] + post + text[i+len(q):],
+			}}
+			for k, v := range doc {
+				hit[k] = v
+			}
+			hits = append(hits, hit)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"hits": hits, "estimatedTotalHits": len(hits)})
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func docID(doc map[string]any) string {
+	switch id := doc["id"].(type) {
+	case float64:
+		return strconv.Itoa(int(id))
+	default:
+		return id.(string)
+	}
+}
+
+func TestMeilisearchBackend(t *testing.T) {
+	ctx := context.Background()
+	fake, srv := newFakeMeilisearch(t)
+	backend, err := NewMeilisearchBackend(ctx, MeilisearchOptions{URL: srv.URL + "/", APIKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := t.TempDir()
+	si := NewSearchIndexWithBackend(filepath.Join(base, "index"), backend)
+	defer si.Close()
+
+	if fake.auth != "Bearer secret" {
+		t.Errorf("expected the API key as bearer token, got %q", fake.auth)
+	}
+	if fake.indexes["asiakirjat"] == nil || fake.indexes["asiakirjat-versions"] == nil {
+		t.Error("expected the default indexes to be created")
+	}
+	if fake.settings["filterableAttributes"] == nil {
+		t.Error("expected the filterable attributes to be configured")
+	}
+
+	dir := filepath.Join(base, "demo", "1.0")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html><head><title>Install</title></head><body>Installing <b>&lt;demo&gt;</b> on servers</body></html>"), 0644)
+	projects := []ReindexProject{{ID: 1, Slug: "demo", Name: "Demo"}}
+	versions := []ReindexVersion{{ID: 7, ProjectID: 1, Tag: "1.0", StoragePath: dir, Metadata: map[string]string{"team": "ops"}}}
+
+	if p, err := si.ReindexVersions(ctx, projects, versions, false, nil); err != nil || p.Indexed != 1 {
+		t.Fatalf("expected the version to be indexed, got %+v, %v", p, err)
+	}
+	if p, err := si.ReindexVersions(ctx, projects, versions, false, nil); err != nil || p.Skipped != 1 {
+		t.Errorf("expected the hash to be kept in meilisearch, got %+v, %v", p, err)
+	}
+	for id := range fake.indexes["asiakirjat"] {
+		if strings.ContainsAny(id, "/#.") {
+			t.Errorf("expected a valid meilisearch document ID, got %q", id)
+		}
+	}
+	if ids, err := si.IndexedVersionIDs(ctx); err != nil || !ids[7] || len(ids) != 1 {
+		t.Errorf("expected version 7 to be indexed, got %v, %v", ids, err)
+	}
+
+	results, err := si.Search(ctx, SearchQuery{Query: "demo", Metadata: map[string]string{"team": "ops"}}, map[string]string{"demo": "1.0", "other": "2.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Total != 1 || results.Results[0].URL != "/project/demo/1.0/index.html" || results.Results[0].PageTitle != "Install" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if snippet := results.Results[0].Snippet; !strings.Contains(snippet, "&lt;<mark>demo</mark>&gt;") {
+		t.Errorf("expected an escaped, highlighted snippet, got %q", snippet)
+	}
+	if filter := fake.searches[0]["filter"]; filter != `meta.team = "ops" AND version_tag IN ["1.0", "2.0"]` {
+		t.Errorf("unexpected filter %q", filter)
+	}
+
+	suggestions, err := si.Suggest(ctx, SearchQuery{Query: "Instal", ProjectSlug: "demo"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 1 || strings.Join(suggestions[0].Terms, ",") != "install" {
+		t.Errorf("expected the word to be suggested, got %+v", suggestions)
+	}
+	if fake.searches[1]["matchingStrategy"] != "all" || fake.searches[1]["filter"] != `project_slug = "demo"` {
+		t.Errorf("unexpected suggest request %v", fake.searches[1])
+	}
+
+	if err := si.DeleteVersion(1, 7); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.indexes["asiakirjat"]) != 0 || len(fake.indexes["asiakirjat-versions"]) != 0 {
+		t.Error("expected the version's documents and hash to be deleted")
+	}
+
+	if si.Outdated() || si.AnalysisChange() != "" {
+		t.Error("expected an external index to never be outdated")
+	}
+	if err := si.Export(&strings.Builder{}); !errors.Is(err, ErrSnapshotUnsupported) {
+		t.Errorf("expected snapshots to be refused, got %v", err)
+	}
+}
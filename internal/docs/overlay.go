@@ -4,51 +4,145 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+// DefaultOverlayMaxSize is the largest response the overlay is injected
+// into unless OverlayOptions say otherwise.
+const DefaultOverlayMaxSize = 10 << 20
+
+// overlaySniffLen is how much of a response is looked at to tell whether it
+// is an HTML document, the same as http.DetectContentType.
+const overlaySniffLen = 512
+
+// OverlayOptions configure InjectOverlayWithOptions.
+type OverlayOptions struct {
+	HeadHTML    string // Inserted before </head>, if there is one
+	OverlayHTML string // Inserted before </body>, or appended
+	// MaxSize is the largest response that is buffered for injection;
+	// larger responses are passed through unchanged. 0 means
+	// DefaultOverlayMaxSize.
+	MaxSize int64
+	// Sniff injects into responses that look like HTML whatever their
+	// Content-Type, and serves them as text/html.
+	Sniff bool
+}
+
 // InjectOverlay wraps an http.ResponseWriter to inject overlay HTML before </body>
 // in HTML responses. Non-HTML responses are passed through unchanged.
 func InjectOverlay(w http.ResponseWriter, r *http.Request, overlayHTML string, serve func(http.ResponseWriter, *http.Request)) {
+	InjectOverlayWithOptions(w, r, OverlayOptions{OverlayHTML: overlayHTML}, serve)
+}
+
+// InjectOverlayWithHead is InjectOverlay that also inserts headHTML before
+// </head>. Pages without a head element only receive the overlay.
+func InjectOverlayWithHead(w http.ResponseWriter, r *http.Request, headHTML, overlayHTML string, serve func(http.ResponseWriter, *http.Request)) {
+	InjectOverlayWithOptions(w, r, OverlayOptions{HeadHTML: headHTML, OverlayHTML: overlayHTML}, serve)
+}
+
+// InjectOverlayWithOptions injects the overlay into responses that are
+// served as text/html and whose content looks like an HTML document, so
+// that JSON or binary files served from HTML-like paths stay intact.
+// Other responses, and those larger than opts.MaxSize, are streamed
+// through without buffering. Range requests for pages are answered with
+// the whole page, as a range of the file would lack the overlay; ranges of
+// other files are served as usual.
+func InjectOverlayWithOptions(w http.ResponseWriter, r *http.Request, opts OverlayOptions, serve func(http.ResponseWriter, *http.Request)) {
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultOverlayMaxSize
+	}
 	rec := &overlayRecorder{
 		ResponseWriter: w,
 		body:           &bytes.Buffer{},
+		maxSize:        maxSize,
+		sniff:          opts.Sniff,
 	}
 
 	serve(rec, r)
 
-	contentType := rec.Header().Get("Content-Type")
-	isHTML := strings.Contains(contentType, "text/html")
-
-	if isHTML && rec.body.Len() > 0 {
-		body := rec.body.String()
-		injected := injectBeforeBodyClose(body, overlayHTML)
-		w.Header().Set("Content-Length", "")
+	if !rec.passthrough && rec.statusCode == http.StatusPartialContent {
+		w.Header().Del("Content-Range")
 		w.Header().Del("Content-Length")
-		for k, vs := range rec.Header() {
-			if k == "Content-Length" {
-				continue
-			}
-			for _, v := range vs {
-				w.Header().Set(k, v)
-			}
+		whole := r.Clone(r.Context())
+		whole.Header.Del("Range")
+		rec = &overlayRecorder{
+			ResponseWriter: w,
+			body:           &bytes.Buffer{},
+			maxSize:        maxSize,
+			sniff:          opts.Sniff,
 		}
-		if rec.statusCode != 0 {
-			w.WriteHeader(rec.statusCode)
+		serve(rec, whole)
+	}
+	if rec.passthrough {
+		return
+	}
+	body := rec.body.Bytes()
+	if (opts.Sniff || isHTMLContentType(rec.Header().Get("Content-Type"))) && SniffHTML(body) {
+		overlayHTML := opts.OverlayHTML
+		if OptsOutOfOverlay(body) {
+			overlayHTML = ""
 		}
-		io.WriteString(w, injected)
-	} else {
-		// Non-HTML: copy headers and body as-is
-		for k, vs := range rec.Header() {
-			for _, v := range vs {
-				w.Header().Set(k, v)
-			}
+		injected := injectBeforeBodyClose(injectBeforeHeadClose(string(body), opts.HeadHTML), overlayHTML)
+		if !isHTMLContentType(w.Header().Get("Content-Type")) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		}
+		w.Header().Del("Content-Length")
+		w.Header().Del("Accept-Ranges")
 		if rec.statusCode != 0 {
 			w.WriteHeader(rec.statusCode)
 		}
-		w.Write(rec.body.Bytes())
+		io.WriteString(w, injected)
+		return
+	}
+	if rec.statusCode != 0 {
+		w.WriteHeader(rec.statusCode)
 	}
+	w.Write(body)
+}
+
+// SniffHTML reports whether content starts like an HTML document: with a
+// tag after an optional byte order mark and white space. XML is only
+// accepted if it is XHTML.
+func SniffHTML(content []byte) bool {
+	head := content[:min(len(content), overlaySniffLen)]
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	head = bytes.TrimLeft(head, " \t\r\n\f")
+	if len(head) == 0 || head[0] != '<' {
+		return false
+	}
+	lower := bytes.ToLower(head)
+	if bytes.HasPrefix(lower, []byte("<?xml")) {
+		return bytes.Contains(lower, []byte("<html"))
+	}
+	return true
+}
+
+var (
+	metaTagPattern         = regexp.MustCompile(`(?i)<meta\s[^>]*>`)
+	overlayMetaNamePattern = regexp.MustCompile(`(?i)\bname\s*=\s*["']?asiakirjat-overlay["'\s/>]`)
+	overlayMetaOffPattern  = regexp.MustCompile(`(?i)\bcontent\s*=\s*["']?(off|none|false)["'\s/>]`)
+)
+
+// OptsOutOfOverlay reports whether a page asks to be served without the doc
+// overlay with <meta name="asiakirjat-overlay" content="off"> in its head.
+func OptsOutOfOverlay(page []byte) bool {
+	head := page
+	if i := bytes.Index(bytes.ToLower(page), []byte("</head>")); i >= 0 {
+		head = page[:i]
+	}
+	for _, tag := range metaTagPattern.FindAll(head, -1) {
+		if overlayMetaNamePattern.Match(tag) && overlayMetaOffPattern.Match(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHTMLContentType(contentType string) bool {
+	return strings.Contains(contentType, "text/html")
 }
 
 // injectBeforeBodyClose inserts the overlay HTML just before </body>.
@@ -62,17 +156,64 @@ func injectBeforeBodyClose(html, overlay string) string {
 	return html[:idx] + overlay + html[idx:]
 }
 
-// overlayRecorder captures the response so we can inspect and modify it.
+// injectBeforeHeadClose inserts HTML just before </head>, if there is one.
+func injectBeforeHeadClose(html, head string) string {
+	if head == "" {
+		return html
+	}
+	idx := strings.Index(strings.ToLower(html), "</head>")
+	if idx == -1 {
+		return html
+	}
+	return html[:idx] + head + html[idx:]
+}
+
+// overlayRecorder captures HTML responses so we can inspect and modify
+// them. Once a response turns out not to be HTML or to be too large, it
+// switches to passing it through.
 type overlayRecorder struct {
 	http.ResponseWriter
-	body       *bytes.Buffer
-	statusCode int
+	body        *bytes.Buffer
+	statusCode  int
+	maxSize     int64
+	sniff       bool
+	started     bool
+	passthrough bool
 }
 
 func (r *overlayRecorder) Write(b []byte) (int, error) {
+	if !r.started {
+		r.started = true
+		n, _ := strconv.ParseInt(r.Header().Get("Content-Length"), 10, 64)
+		if (!r.sniff && !isHTMLContentType(r.Header().Get("Content-Type"))) || n > r.maxSize {
+			r.startPassthrough()
+		}
+	}
+	if !r.passthrough && int64(r.body.Len()+len(b)) > r.maxSize {
+		r.startPassthrough()
+	}
+	if r.passthrough {
+		return r.ResponseWriter.Write(b)
+	}
 	return r.body.Write(b)
 }
 
 func (r *overlayRecorder) WriteHeader(code int) {
+	if r.passthrough {
+		r.ResponseWriter.WriteHeader(code)
+		return
+	}
 	r.statusCode = code
 }
+
+// startPassthrough sends the status and what was buffered so far.
+func (r *overlayRecorder) startPassthrough() {
+	r.passthrough = true
+	if r.statusCode != 0 {
+		r.ResponseWriter.WriteHeader(r.statusCode)
+	}
+	if r.body.Len() > 0 {
+		r.ResponseWriter.Write(r.body.Bytes())
+		r.body.Reset()
+	}
+}
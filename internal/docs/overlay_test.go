@@ -1,8 +1,11 @@
 package docs
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -84,6 +87,21 @@ func TestInjectOverlay_HTMLResponse(t *testing.T) {
 	}
 }
 
+func TestInjectOverlayWithHead(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><HEAD><title>Doc</title></HEAD><body></body></html>"))
+	})
+
+	rec := httptest.NewRecorder()
+	InjectOverlayWithHead(rec, httptest.NewRequest("GET", "/", nil), `<link rel="canonical" href="/x">`, "<div></div>", handler.ServeHTTP)
+
+	want := `<html><HEAD><title>Doc</title><link rel="canonical" href="/x"></HEAD><body><div></div></body></html>`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
 func TestInjectOverlay_NonHTML(t *testing.T) {
 	overlay := `<div id="overlay">test</div>`
 
@@ -143,3 +161,137 @@ func TestInjectOverlay_PreservesStatusCode(t *testing.T) {
 		t.Errorf("expected 404 status, got %d", rec.Code)
 	}
 }
+
+func TestInjectOverlay_SniffsContent(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		inject bool
+	}{
+		{"html document", "<!DOCTYPE html><html><body>Doc</body></html>", true},
+		{"byte order mark and white space", "\xef\xbb\xbf\n  <html><body>Doc</body></html>", true},
+		{"redirect page", `<meta http-equiv="refresh" content="0; url=intro/">`, true},
+		{"xhtml", `<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"><body></body></html>`, true},
+		{"json", `{"title": "<b>not html</b>"}`, false},
+		{"xml", `<?xml version="1.0"?><feed></feed>`, false},
+		{"binary", "\x00\x01\x02<body>", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				io.WriteString(w, tt.body)
+			}
+			rec := httptest.NewRecorder()
+			InjectOverlay(rec, httptest.NewRequest("GET", "/page", nil), "<div>overlay</div>", handler)
+			if got := strings.Contains(rec.Body.String(), "<div>overlay</div>"); got != tt.inject {
+				t.Errorf("injected = %v, want %v", got, tt.inject)
+			}
+			if !tt.inject && rec.Body.String() != tt.body {
+				t.Errorf("expected the body unchanged, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestInjectOverlay_MaxSize(t *testing.T) {
+	page := "<html><body>" + strings.Repeat("x", 100) + "</body></html>"
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		for i := 0; i < len(page); i += 10 {
+			io.WriteString(w, page[i:min(i+10, len(page))])
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	InjectOverlayWithOptions(rec, httptest.NewRequest("GET", "/", nil), OverlayOptions{OverlayHTML: "<div>overlay</div>", MaxSize: 50}, handler)
+	if rec.Body.String() != page {
+		t.Errorf("expected a large page to be passed through, got %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	InjectOverlayWithOptions(rec, httptest.NewRequest("GET", "/", nil), OverlayOptions{OverlayHTML: "<div>overlay</div>", MaxSize: 1000}, handler)
+	if !strings.Contains(rec.Body.String(), "<div>overlay</div></body>") {
+		t.Errorf("expected the overlay in a page below the limit, got %q", rec.Body.String())
+	}
+}
+
+func TestInjectOverlay_SniffOption(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-httpd-php")
+		io.WriteString(w, "<html><body>Page</body></html>")
+	}
+
+	rec := httptest.NewRecorder()
+	InjectOverlay(rec, httptest.NewRequest("GET", "/app.php", nil), "<div>overlay</div>", handler)
+	if strings.Contains(rec.Body.String(), "overlay") {
+		t.Error("expected no overlay without sniffing")
+	}
+
+	rec = httptest.NewRecorder()
+	InjectOverlayWithOptions(rec, httptest.NewRequest("GET", "/app.php", nil), OverlayOptions{OverlayHTML: "<div>overlay</div>", Sniff: true}, handler)
+	if !strings.Contains(rec.Body.String(), "<div>overlay</div>") {
+		t.Error("expected the overlay in sniffed HTML")
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("expected text/html, got %q", ct)
+	}
+}
+
+func TestInjectOverlay_RangeRequests(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html><body>Page</body></html>"), 0644)
+	os.WriteFile(filepath.Join(dir, "LICENSE"), []byte("Licensed under the MIT license"), 0644)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/"+path, nil)
+		req.Header.Set("Range", "bytes=0-7")
+		rec := httptest.NewRecorder()
+		InjectOverlay(rec, req, "<div>overlay</div>", func(w http.ResponseWriter, r *http.Request) {
+			ServeDoc(w, r, dir, path)
+		})
+		return rec
+	}
+
+	rec := serve("")
+	if rec.Code != http.StatusOK || rec.Body.String() != "<html><body>Page<div>overlay</div></body></html>" {
+		t.Errorf("expected the whole page with the overlay, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Range") != "" {
+		t.Errorf("expected no Content-Range, got %q", rec.Header().Get("Content-Range"))
+	}
+
+	rec = serve("LICENSE")
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "Licensed" {
+		t.Errorf("expected a range of a file that is not a page, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOptsOutOfOverlay(t *testing.T) {
+	tests := []struct {
+		page string
+		want bool
+	}{
+		{`<html><head><meta name="asiakirjat-overlay" content="off"></head><body></body></html>`, true},
+		{`<html><head><META content='none' NAME='asiakirjat-overlay' /></head></html>`, true},
+		{`<html><head><meta name=asiakirjat-overlay content=false></head></html>`, true},
+		{`<html><head><meta name="asiakirjat-overlay" content="on"></head></html>`, false},
+		{`<html><head><meta name="viewport" content="none"></head></html>`, false},
+		{`<html><head></head><body><meta name="asiakirjat-overlay" content="off"></body></html>`, false},
+	}
+	for _, tt := range tests {
+		if got := OptsOutOfOverlay([]byte(tt.page)); got != tt.want {
+			t.Errorf("OptsOutOfOverlay(%q) = %v, want %v", tt.page, got, tt.want)
+		}
+	}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, `<html><head><meta name="asiakirjat-overlay" content="off"></head><body>Page</body></html>`)
+	}
+	rec := httptest.NewRecorder()
+	InjectOverlayWithOptions(rec, httptest.NewRequest("GET", "/", nil), OverlayOptions{HeadHTML: "<link>", OverlayHTML: "<div>overlay</div>"}, handler)
+	if strings.Contains(rec.Body.String(), "overlay</div>") || !strings.Contains(rec.Body.String(), "<link></head>") {
+		t.Errorf("expected only the head HTML in a page that opts out, got %q", rec.Body.String())
+	}
+}
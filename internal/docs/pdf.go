@@ -30,22 +30,25 @@ type PDFPage struct {
 // ExtractPDFPages extracts text from a PDF file, returning one PDFPage per page.
 // Tries pdftotext (poppler-utils) first for best quality, falls back to
 // ledongthuc/pdf (pure Go) if pdftotext is not installed.
-func ExtractPDFPages(filePath string) (title string, pages []PDFPage, err error) {
+func ExtractPDFPages(ctx context.Context, filePath string) (title string, pages []PDFPage, err error) {
 	pdftotextChecked.Do(checkPdftotext)
 
 	if hasPdftotext {
-		title, pages, err = extractPagesWithPdftotext(filePath)
+		title, pages, err = extractPagesWithPdftotext(ctx, filePath)
 		if err == nil {
 			return title, pages, nil
 		}
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
 		// Fall through to pure Go on error
 	}
 
 	return extractPagesWithGoPDF(filePath)
 }
 
-func extractPagesWithPdftotext(filePath string) (string, []PDFPage, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func extractPagesWithPdftotext(ctx context.Context, filePath string) (string, []PDFPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "pdftotext", "-layout", filePath, "-")
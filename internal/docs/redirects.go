@@ -0,0 +1,139 @@
+package docs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RedirectsFile in the root of a version defines redirects of its paths.
+const RedirectsFile = "_redirects"
+
+// maxRedirectRules limits the rules of a version or project.
+const maxRedirectRules = 1000
+
+// RedirectRule redirects requests for From, a path within a version, to
+// To. A From ending in "*" matches every path it is a prefix of, and the
+// rest of the path replaces ":splat" in To. To is another path within the
+// version or an absolute http(s) URL. Rules only apply to paths without
+// a file, unless Force is set.
+type RedirectRule struct {
+	From   string `yaml:"from"`
+	To     string `yaml:"to"`
+	Status int    `yaml:"status"`
+	Force  bool   `yaml:"force"`
+}
+
+// ParseRedirects parses rules in the format of Netlify's _redirects file:
+// one "from to [status]" rule per line, with # starting a comment. The
+// status defaults to 301; a status ending in "!", such as "301!", forces
+// the rule.
+func ParseRedirects(text string) ([]RedirectRule, error) {
+	var rules []RedirectRule
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("redirect line %d: expected \"from to [status]\"", n)
+		}
+		rule := RedirectRule{From: fields[0]}
+		if len(fields) > 1 {
+			rule.To = fields[1]
+		}
+		if len(fields) == 3 {
+			status, force := strings.CutSuffix(fields[2], "!")
+			code, err := strconv.Atoi(status)
+			if err != nil {
+				return nil, fmt.Errorf("redirect line %d: invalid status %q", n, fields[2])
+			}
+			rule.Status, rule.Force = code, force
+		}
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("redirect line %d: %w", n, err)
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) > maxRedirectRules {
+		return nil, fmt.Errorf("more than %d redirects", maxRedirectRules)
+	}
+	return rules, scanner.Err()
+}
+
+func (r *RedirectRule) validate() error {
+	if !strings.HasPrefix(r.From, "/") {
+		return fmt.Errorf("source %q must start with /", r.From)
+	}
+	if strings.Contains(strings.TrimSuffix(r.From, "*"), "*") {
+		return fmt.Errorf("source %q may only end in *", r.From)
+	}
+	local := strings.HasPrefix(r.To, "/") && !strings.HasPrefix(r.To, "//")
+	if !local && !strings.HasPrefix(r.To, "https://") && !strings.HasPrefix(r.To, "http://") {
+		return fmt.Errorf("target %q must start with / or be an http(s) URL", r.To)
+	}
+	switch r.Status {
+	case 0:
+		r.Status = http.StatusMovedPermanently
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("status %d is not a redirect status (301, 302, 307 or 308)", r.Status)
+	}
+	return nil
+}
+
+// ReadRedirects reads the redirects of the version stored in dir from its
+// _redirects file and the redirects list of its asiakirjat.yaml. A version
+// with neither has no redirects.
+func ReadRedirects(dir string) ([]RedirectRule, error) {
+	var rules []RedirectRule
+	data, err := os.ReadFile(filepath.Join(dir, RedirectsFile))
+	if err == nil {
+		if rules, err = ParseRedirects(string(data)); err != nil {
+			return nil, fmt.Errorf("%s: %w", RedirectsFile, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	config, err := ReadVersionConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := range config.Redirects {
+		if err := config.Redirects[i].validate(); err != nil {
+			return nil, fmt.Errorf("%s: redirect %d: %w", ConfigFile, i+1, err)
+		}
+	}
+	rules = append(rules, config.Redirects...)
+	if len(rules) > maxRedirectRules {
+		return nil, fmt.Errorf("more than %d redirects", maxRedirectRules)
+	}
+	return rules, nil
+}
+
+// MatchRedirect returns the first rule matching path, a path within a
+// version starting with "/", with the splat filled into its target.
+func MatchRedirect(rules []RedirectRule, path string) (RedirectRule, bool) {
+	for _, rule := range rules {
+		if prefix, ok := strings.CutSuffix(rule.From, "*"); ok {
+			if rest, ok := strings.CutPrefix(path, prefix); ok {
+				rule.To = strings.ReplaceAll(rule.To, ":splat", rest)
+				return rule, true
+			}
+			continue
+		}
+		if path == rule.From {
+			return rule, true
+		}
+	}
+	return RedirectRule{}, false
+}
@@ -0,0 +1,97 @@
+package docs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRedirects(t *testing.T) {
+	rules, err := ParseRedirects(`
+# Moved in 2.0
+/install.html   /getting-started/install.html
+/guide/*        /manual/:splat   302
+/api/*          https://api.example.com/:splat 301!
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RedirectRule{
+		{From: "/install.html", To: "/getting-started/install.html", Status: 301},
+		{From: "/guide/*", To: "/manual/:splat", Status: 302},
+		{From: "/api/*", To: "https://api.example.com/:splat", Status: 301, Force: true},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("expected %d rules, got %+v", len(want), rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d: expected %+v, got %+v", i, want[i], rules[i])
+		}
+	}
+
+	for _, text := range []string{
+		"install.html /install",
+		"/a /b 200",
+		"/a //evil.example.com",
+		"/a javascript:alert(1)",
+		"/a/*/b /c",
+		"/a",
+		"/a /b 301 extra",
+	} {
+		if _, err := ParseRedirects(text); err == nil {
+			t.Errorf("expected %q to be invalid", text)
+		}
+	}
+}
+
+func TestMatchRedirect(t *testing.T) {
+	rules := []RedirectRule{
+		{From: "/old.html", To: "/new.html", Status: 301},
+		{From: "/guide/*", To: "/manual/:splat", Status: 302},
+	}
+	tests := []struct {
+		path, to string
+		ok       bool
+	}{
+		{"/old.html", "/new.html", true},
+		{"/guide/setup/index.html", "/manual/setup/index.html", true},
+		{"/guide/", "/manual/", true},
+		{"/old.html/x", "", false},
+		{"/other.html", "", false},
+	}
+	for _, tt := range tests {
+		rule, ok := MatchRedirect(rules, tt.path)
+		if ok != tt.ok || rule.To != tt.to {
+			t.Errorf("MatchRedirect(%q) = %q, %v; want %q, %v", tt.path, rule.To, ok, tt.to, tt.ok)
+		}
+	}
+}
+
+func TestReadRedirects(t *testing.T) {
+	dir := t.TempDir()
+	if rules, err := ReadRedirects(dir); err != nil || len(rules) != 0 {
+		t.Fatalf("expected no redirects, got %+v, %v", rules, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, RedirectsFile), []byte("/a /b\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ConfigFile), []byte(`
+redirects:
+  - from: /c
+    to: /d
+    status: 308
+    force: true
+`), 0644)
+	rules, err := ReadRedirects(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].To != "/b" || rules[1] != (RedirectRule{From: "/c", To: "/d", Status: 308, Force: true}) {
+		t.Errorf("expected the rules of both files, got %+v", rules)
+	}
+
+	os.WriteFile(filepath.Join(dir, ConfigFile), []byte("redirects:\n  - from: c\n    to: /d\n"), 0644)
+	if _, err := ReadRedirects(dir); err == nil {
+		t.Error("expected an invalid rule in asiakirjat.yaml to be reported")
+	}
+}
@@ -0,0 +1,465 @@
+package docs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// sanitizedExtensions are the files SanitizeHTML is applied to on
+// extraction. SVG images run scripts when opened directly.
+var sanitizedExtensions = map[string]bool{
+	".html":  true,
+	".htm":   true,
+	".xhtml": true,
+	".svg":   true,
+}
+
+// IsSanitizedFile reports whether a file is sanitized when sanitization
+// is on, by its name. Files with an unknown type are sanitized too when
+// they would be served as HTML, see sanitizedCodec.
+func IsSanitizedFile(name string) bool {
+	return sanitizedExtensions[strings.ToLower(path.Ext(name))]
+}
+
+// sanitizeCodec reads and writes the content of a sanitized file, which
+// is compressed in the precompressed copies ServeDoc sends, such as
+// index.html.gz.
+type sanitizeCodec struct {
+	decompress func(io.Reader) (io.Reader, error)
+	compress   func(io.Writer) io.WriteCloser
+}
+
+// compressedCodecs are the codecs of precompressed copies, by extension.
+var compressedCodecs = map[string]sanitizeCodec{
+	".gz": {
+		decompress: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		compress:   func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+	},
+	".br": {
+		decompress: func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		compress:   func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	},
+}
+
+// sanitizedCodec reports whether the extracted file at target is sanitized
+// when sanitization is on, and with which codec: files IsSanitizedFile
+// accepts, precompressed copies of them, and files of an unknown type whose
+// content http.ServeContent would detect as HTML.
+func sanitizedCodec(target string) (sanitizeCodec, bool) {
+	ext := strings.ToLower(filepath.Ext(target))
+	if codec, ok := compressedCodecs[ext]; ok {
+		return codec, IsSanitizedFile(target[:len(target)-len(ext)])
+	}
+	if IsSanitizedFile(target) {
+		return sanitizeCodec{}, true
+	}
+	return sanitizeCodec{}, mime.TypeByExtension(ext) == "" && sniffsHTML(target)
+}
+
+// sniffsHTML reports whether the content of a file is detected as HTML.
+func sniffsHTML(target string) bool {
+	f, err := os.Open(target)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	return strings.HasPrefix(http.DetectContentType(head[:n]), "text/html")
+}
+
+// reader returns the content of the file r, decompressed to at most
+// maxSize bytes if maxSize is positive.
+func (c sanitizeCodec) reader(r io.Reader, maxSize int64) (io.Reader, error) {
+	if c.decompress == nil {
+		return r, nil
+	}
+	d, err := c.decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize <= 0 {
+		return d, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(d, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: decompressed file is larger than %d bytes", ErrExtractLimit, maxSize)
+	}
+	return bytes.NewReader(data), nil
+}
+
+// writer returns a writer of the file content to w, compressed again.
+func (c sanitizeCodec) writer(w io.Writer) io.WriteCloser {
+	if c.compress == nil {
+		return nopWriteCloser{w}
+	}
+	return c.compress(w)
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// droppedElements are removed from sanitized documents with their content.
+// Besides what runs scripts, they include the elements whose content is
+// parsed differently depending on where they appear, which could otherwise
+// turn escaped text back into markup when the document is parsed again.
+var droppedElements = map[string]bool{
+	"script":         true,
+	"object":         true,
+	"embed":          true,
+	"applet":         true,
+	"base":           true,
+	"frame":          true,
+	"frameset":       true,
+	"noscript":       true,
+	"noembed":        true,
+	"noframes":       true,
+	"plaintext":      true,
+	"xmp":            true,
+	"template":       true,
+	"foreignobject":  true,
+	"annotation-xml": true,
+	"mglyph":         true,
+	"malignmark":     true,
+	"metadata":       true,
+}
+
+// allowedElements are the elements kept in sanitized documents, by
+// namespace. Other elements are replaced by their content.
+var allowedElements = map[string]map[string]bool{
+	"": setOf(
+		"html", "head", "body", "title", "meta", "link", "style",
+		"a", "abbr", "address", "area", "article", "aside", "audio", "b", "bdi", "bdo", "big",
+		"blockquote", "br", "button", "canvas", "caption", "center", "cite", "code", "col",
+		"colgroup", "data", "datalist", "dd", "del", "details", "dfn", "dialog", "div", "dl",
+		"dt", "em", "fieldset", "figcaption", "figure", "font", "footer", "form", "h1", "h2",
+		"h3", "h4", "h5", "h6", "header", "hgroup", "hr", "i", "iframe", "img", "input", "ins",
+		"kbd", "label", "legend", "li", "main", "map", "mark", "menu", "meter", "nav", "ol",
+		"optgroup", "option", "output", "p", "picture", "pre", "progress", "q", "rp", "rt",
+		"ruby", "s", "samp", "search", "section", "select", "small", "source", "span", "strike",
+		"strong", "sub", "summary", "sup", "table", "tbody", "td", "textarea", "tfoot", "th",
+		"thead", "time", "tr", "track", "tt", "u", "ul", "var", "video", "wbr",
+	),
+	"svg": setOf(
+		"svg", "g", "defs", "symbol", "use", "image", "switch", "title", "desc", "style",
+		"path", "rect", "circle", "ellipse", "line", "polyline", "polygon", "text", "tspan",
+		"textpath", "a", "marker", "pattern", "clippath", "mask", "lineargradient",
+		"radialgradient", "stop", "view", "animate", "animatemotion", "animatetransform", "set",
+		"mpath", "filter", "feblend", "fecolormatrix", "fecomponenttransfer", "fecomposite",
+		"feconvolvematrix", "fediffuselighting", "fedisplacementmap", "fedistantlight",
+		"fedropshadow", "feflood", "fefunca", "fefuncb", "fefuncg", "fefuncr",
+		"fegaussianblur", "feimage", "femerge", "femergenode", "femorphology", "feoffset",
+		"fepointlight", "fespecularlighting", "fespotlight", "fetile", "feturbulence",
+	),
+	"math": setOf(
+		"math", "semantics", "annotation", "mrow", "mi", "mn", "mo", "ms", "mtext", "mspace",
+		"msub", "msup", "msubsup", "munder", "mover", "munderover", "mmultiscripts",
+		"mprescripts", "none", "mfrac", "msqrt", "mroot", "mstyle", "mpadded", "mphantom",
+		"menclose", "merror", "mtable", "mtr", "mtd", "mlabeledtr",
+	),
+}
+
+// allowedAttrs are the attributes kept in sanitized documents, by
+// namespace, besides globalAttrs and data-* and aria-* attributes. Names
+// are lowercase; SVG has some in camel case, such as viewBox.
+var allowedAttrs = map[string]map[string]bool{
+	"": setOf(
+		"abbr", "accept", "accept-charset", "action", "align", "allow", "allowfullscreen", "alt",
+		"autocomplete", "autoplay", "background", "bgcolor", "border", "cellpadding",
+		"cellspacing", "charset", "checked", "cite", "color", "cols", "colspan", "content",
+		"controls", "coords", "crossorigin", "datetime", "decoding", "default", "disabled",
+		"download", "enctype", "face", "for", "form", "formaction", "frameborder", "headers",
+		"height", "high", "href", "hreflang", "http-equiv", "integrity", "ismap", "itemid",
+		"itemprop", "itemscope", "itemtype", "kind", "label", "list", "loading", "loop", "low",
+		"max", "maxlength", "media", "method", "min", "minlength", "multiple", "muted", "name",
+		"nowrap", "open", "optimum", "pattern", "placeholder", "playsinline", "poster",
+		"preload", "property", "readonly", "referrerpolicy", "rel", "required", "reversed",
+		"rows", "rowspan", "sandbox", "scope", "scrolling", "selected", "shape", "size", "sizes",
+		"span", "spellcheck", "src", "srclang", "srcset", "start", "step", "summary", "target",
+		"type", "usemap", "valign", "value", "width", "wrap",
+	),
+	"svg": setOf(
+		"accumulate", "additive", "alignment-baseline", "amplitude", "attributename",
+		"attributetype", "azimuth", "basefrequency", "baseline-shift", "baseprofile", "begin",
+		"bias", "by", "calcmode", "clip", "clip-path", "clip-rule", "clippathunits", "color",
+		"color-interpolation", "color-interpolation-filters", "cursor", "cx", "cy", "d",
+		"diffuseconstant", "display", "divisor", "dominant-baseline", "dur", "dx", "dy",
+		"edgemode", "elevation", "end", "exponent", "fill", "fill-opacity", "fill-rule",
+		"filter", "filterunits", "flood-color", "flood-opacity", "font-family", "font-size",
+		"font-size-adjust", "font-stretch", "font-style", "font-variant", "font-weight", "from",
+		"fr", "fx", "fy", "gradienttransform", "gradientunits", "height", "href",
+		"image-rendering", "in", "in2", "intercept", "k1", "k2", "k3", "k4", "kernelmatrix",
+		"kernelunitlength", "keypoints", "keysplines", "keytimes", "lengthadjust",
+		"letter-spacing", "lighting-color", "limitingconeangle", "marker-end", "marker-mid",
+		"marker-start", "markerheight", "markerunits", "markerwidth", "mask", "maskcontentunits",
+		"maskunits", "max", "method", "min", "mix-blend-mode", "mode", "numoctaves", "offset",
+		"opacity", "operator", "order", "orient", "overflow", "paint-order", "path", "pathlength",
+		"patterncontentunits", "patterntransform", "patternunits", "pointer-events", "points",
+		"pointsatx", "pointsaty", "pointsatz", "preservealpha", "preserveaspectratio",
+		"primitiveunits", "r", "radius", "refx", "refy", "repeatcount", "repeatdur", "restart",
+		"result", "rotate", "rx", "ry", "scale", "seed", "shape-rendering", "side", "slope",
+		"spacing", "specularconstant", "specularexponent", "spreadmethod", "startoffset",
+		"stddeviation", "stitchtiles", "stop-color", "stop-opacity", "stroke",
+		"stroke-dasharray", "stroke-dashoffset", "stroke-linecap", "stroke-linejoin",
+		"stroke-miterlimit", "stroke-opacity", "stroke-width", "surfacescale",
+		"systemlanguage", "tablevalues", "targetx", "targety", "text-anchor", "text-decoration",
+		"text-rendering", "textlength", "to", "transform", "transform-origin", "type",
+		"values", "vector-effect", "version", "viewbox", "visibility", "width", "word-spacing",
+		"writing-mode", "x", "x1", "x2", "xchannelselector", "xlink:href", "xlink:title", "y",
+		"y1", "y2", "ychannelselector", "z", "zoomandpan",
+	),
+	"math": setOf(
+		"accent", "accentunder", "columnalign", "columnlines", "columnspacing", "columnspan",
+		"depth", "display", "displaystyle", "encoding", "fence", "form", "frame", "height",
+		"largeop", "linethickness", "lspace", "mathbackground", "mathcolor", "mathsize",
+		"mathvariant", "maxsize", "minsize", "movablelimits", "notation", "rowalign",
+		"rowlines", "rowspacing", "rowspan", "rspace", "scriptlevel", "separator", "stretchy",
+		"symmetric", "voffset", "width",
+	),
+}
+
+// globalAttrs are kept on the allowed elements of every namespace.
+var globalAttrs = setOf(
+	"id", "class", "style", "title", "lang", "dir", "hidden", "tabindex", "role", "translate",
+	"xmlns", "xmlns:xlink", "xml:lang", "xml:space",
+)
+
+// urlAttrs hold a URL, whose scheme safeURL checks.
+var urlAttrs = setOf(
+	"href", "src", "action", "formaction", "poster", "cite", "background", "xlink:href",
+)
+
+// embeddedURLAttrs may hold a URL within their value: animation values set
+// other attributes of SVG elements, such as href, meta content may refresh
+// to a URL and styles load images.
+var embeddedURLAttrs = setOf("values", "from", "to", "by", "content", "style")
+
+// safeSchemes are the URL schemes kept in sanitized documents. data: URLs
+// are kept for images other than SVG only.
+var safeSchemes = setOf("http", "https", "mailto", "tel", "ftp")
+
+func setOf(names ...string) map[string]bool {
+	m := make(map[string]bool, len(names))
+	for _, name := range names {
+		m[name] = true
+	}
+	return m
+}
+
+// SanitizeHTML copies an HTML or SVG document from r to w keeping only
+// known-safe elements and attributes. The document is parsed as a browser
+// would parse it, the elements and attributes that are not allowed are
+// removed, as are URLs with schemes other than http, https, mailto, tel and
+// ftp, and the tree is rendered again. Removed elements that run scripts,
+// such as script and object, take their content with them; other elements
+// are replaced by their content. Comments are removed.
+//
+// A complete document, one starting with a doctype or an html, head or body
+// tag, is rendered as a complete document; anything else, such as an SVG
+// image, is rendered as a fragment, without html and body tags added.
+func SanitizeHTML(w io.Writer, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if isDocument(data) {
+		doc, err := html.Parse(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		sanitizeChildren(doc)
+		return html.Render(w, doc)
+	}
+
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(bytes.NewReader(data), context)
+	if err != nil {
+		return err
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	sanitizeChildren(body)
+	for n := range body.ChildNodes() {
+		if err := html.Render(w, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isDocument reports whether data is a complete HTML document rather than
+// a fragment or an SVG image.
+func isDocument(data []byte) bool {
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		switch z.Next() {
+		case html.CommentToken:
+		case html.TextToken:
+			if len(bytes.Trim(z.Text(), " \t\r\n\f\ufeff")) > 0 {
+				return false
+			}
+		case html.DoctypeToken:
+			return strings.EqualFold(z.Token().Data, "html")
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "html", "head", "body":
+				return true
+			}
+			return false
+		default:
+			return false
+		}
+	}
+}
+
+// sanitizeChildren removes what is not allowed from the children of
+// parent, recursively.
+func sanitizeChildren(parent *html.Node) {
+	for c := parent.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.ElementNode:
+			switch name := strings.ToLower(c.Data); {
+			case droppedElements[name]:
+				parent.RemoveChild(c)
+			case !allowedElement(c, parent):
+				// Replace the element by its content, which is checked
+				// in its new place
+				if c.FirstChild != nil {
+					next = c.FirstChild
+				}
+				for gc := c.FirstChild; gc != nil; {
+					gcNext := gc.NextSibling
+					c.RemoveChild(gc)
+					parent.InsertBefore(gc, c)
+					gc = gcNext
+				}
+				parent.RemoveChild(c)
+			default:
+				c.Attr = safeAttrs(c)
+				if c.Namespace == "" && name == "iframe" {
+					// The fallback content of an iframe is raw text
+					for c.FirstChild != nil {
+						c.RemoveChild(c.FirstChild)
+					}
+				}
+				sanitizeChildren(c)
+			}
+		case html.TextNode:
+			// The text of a style element is rendered as it is
+			if parent.Type == html.ElementNode && parent.Namespace == "" && parent.DataAtom == atom.Style &&
+				strings.Contains(strings.ToLower(c.Data), "</style") {
+				parent.RemoveChild(c)
+			}
+		case html.DoctypeNode:
+			if parent.Type != html.DocumentNode {
+				parent.RemoveChild(c)
+			}
+		default:
+			parent.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+// allowedElement reports whether the element n can be kept under parent.
+// An element is kept only in its own namespace, or as the root of an SVG
+// or MathML tree in HTML, so that parsing the sanitized document again
+// gives the same tree.
+func allowedElement(n, parent *html.Node) bool {
+	name := strings.ToLower(n.Data)
+	if !allowedElements[n.Namespace][name] {
+		return false
+	}
+	if n.Namespace == parent.Namespace || parent.Type == html.DocumentNode {
+		return true
+	}
+	return parent.Namespace == "" && (n.Namespace == "svg" && name == "svg" || n.Namespace == "math" && name == "math")
+}
+
+// safeAttrs returns the attributes of n that can be kept in a sanitized
+// document.
+func safeAttrs(n *html.Node) []html.Attribute {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		if safeAttr(n.Namespace, a) {
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
+
+// safeAttr reports whether the attribute a of an element in namespace ns
+// can be kept in a sanitized document.
+func safeAttr(ns string, a html.Attribute) bool {
+	key := strings.ToLower(a.Key)
+	if a.Namespace != "" {
+		key = a.Namespace + ":" + key
+	}
+	if !globalAttrs[key] && !allowedAttrs[ns][key] &&
+		!strings.HasPrefix(key, "data-") && !strings.HasPrefix(key, "aria-") {
+		return false
+	}
+	switch {
+	case urlAttrs[key]:
+		return safeURL(a.Val)
+	case key == "srcset":
+		for _, candidate := range strings.Split(a.Val, ",") {
+			if fields := strings.Fields(candidate); len(fields) > 0 && !safeURL(fields[0]) {
+				return false
+			}
+		}
+	case embeddedURLAttrs[key]:
+		val := normalizeURL(a.Val)
+		for _, scheme := range []string{"javascript:", "vbscript:", "data:text/html"} {
+			if strings.Contains(val, scheme) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// safeURL reports whether a URL is relative or has a safe scheme.
+func safeURL(raw string) bool {
+	val := normalizeURL(raw)
+	i := strings.IndexAny(val, ":/?#")
+	if i < 0 || val[i] != ':' {
+		return true
+	}
+	scheme := val[:i]
+	if scheme == "data" {
+		return strings.HasPrefix(val, "data:image/") && !strings.HasPrefix(val, "data:image/svg")
+	}
+	return safeSchemes[scheme]
+}
+
+// normalizeURL lowercases a URL and removes whitespace and control
+// characters, which browsers ignore in URL schemes.
+func normalizeURL(raw string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(raw))
+}
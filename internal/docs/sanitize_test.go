@@ -0,0 +1,181 @@
+package docs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain page", `<!DOCTYPE html><html><head><title>Doc</title></head><body><p class="x">Hi &amp; bye</p></body></html>`, `<!DOCTYPE html><html><head><title>Doc</title></head><body><p class="x">Hi &amp; bye</p></body></html>`},
+		{"script", `<p>a</p><script>alert("</p>")</script><p>b</p>`, `<p>a</p><p>b</p>`},
+		{"script with source", `<script src="app.js"></script>ok`, `ok`},
+		{"uppercase script", `<SCRIPT>alert(1)</SCRIPT>ok`, `ok`},
+		{"event handler", `<img src="a.png" onerror="alert(1)" alt="A">`, `<img src="a.png" alt="A"/>`},
+		{"javascript link", `<a href=" JaVa&#x09;script:alert(1)">x</a>`, `<a>x</a>`},
+		{"entity in scheme", `<a href="&#106;avascript:alert(1)" title="t">x</a>`, `<a title="t">x</a>`},
+		{"srcdoc", `<iframe srcdoc="<script>alert(1)</script>" src="page.html"></iframe>`, `<iframe src="page.html"></iframe>`},
+		{"nested object", `<object data="a.swf"><object data="b.swf"></object><p>fallback</p></object>after`, `after`},
+		{"embed", `<embed src="a.swf">after`, `after`},
+		{"svg keeps case", `<svg viewBox="0 0 10 10" onload="alert(1)"><linearGradient id="g"/></svg>`, `<svg viewBox="0 0 10 10"><linearGradient id="g"></linearGradient></svg>`},
+		{"svg animation", `<svg><a><animate attributeName="href" values="javascript:alert(1)"/><text>x</text></a></svg>`, `<svg><a><animate attributeName="href"></animate><text>x</text></a></svg>`},
+		{"safe values kept", `<a href="https://example.com/?q=1&amp;r=2">x</a>`, `<a href="https://example.com/?q=1&amp;r=2">x</a>`},
+		{"svg style breakout", `<svg><style><img src=x onerror=alert(1)></style></svg>`, `<svg><style></style></svg>`},
+		{"math title breakout", `<math><title><img src=x onerror=alert(1)>`, `<math></math>`},
+		{"math text html", `<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`, `<math><mtext></mtext></math>`},
+		{"svg foreign object", `<svg><foreignObject><iframe src="javascript:alert(1)"></iframe></foreignObject></svg>`, `<svg></svg>`},
+		{"svg desc html", `<svg><desc><b onclick="alert(1)">x</b></desc></svg>`, `<svg><desc>x</desc></svg>`},
+		{"noscript", `<noscript><p title="</noscript><img src=x onerror=alert(1)>"></noscript>ok`, `<img src="x"/>&#34;&gt;ok`},
+		{"unknown element unwrapped", `<custom-box onclick="alert(1)"><b>x</b></custom-box>`, `<b>x</b>`},
+		{"unknown attribute", `<p onpointerrawupdate="alert(1)" ping="https://evil.example/" data-id="1">x</p>`, `<p data-id="1">x</p>`},
+		{"data image kept", `<img src="data:image/png;base64,AAAA">`, `<img src="data:image/png;base64,AAAA"/>`},
+		{"data html dropped", `<a href="data:text/html,&lt;script&gt;alert(1)&lt;/script&gt;">x</a>`, `<a>x</a>`},
+		{"meta refresh", `<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`, `<meta http-equiv="refresh"/>`},
+		{"base", `<base href="https://evil.example/">ok`, `ok`},
+		{"comment", `<!--[if IE]><script>alert(1)</script><![endif]-->ok`, `ok`},
+		{"xml svg", "<?xml version=\"1.0\"?>\n<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\"><use xlink:href=\"#a\"/><a xlink:href=\"javascript:alert(1)\">x</a></svg>", "\n<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\"><use xlink:href=\"#a\"></use><a>x</a></svg>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := SanitizeHTML(&out, strings.NewReader(tt.in)); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got  %s\nwant %s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractSanitizeHTML(t *testing.T) {
+	dest := t.TempDir()
+	data := zipWithFiles(t, map[string]string{
+		"index.html":  `<p onclick="steal()">Hi</p><script>steal()</script>`,
+		"logo.svg":    `<svg><script>steal()</script></svg>`,
+		"app.js":      `steal()`,
+		"notes.txt":   `<script>kept</script>`,
+		"guide/a.HTM": `<a href="javascript:steal()">a</a>`,
+	})
+
+	var manifest Manifest
+	err := ExtractArchiveWithOptions(bytes.NewReader(data), "docs.zip", dest, ExtractOptions{SanitizeHTML: true, Manifest: &manifest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"index.html":  `<p>Hi</p>`,
+		"logo.svg":    `<svg></svg>`,
+		"app.js":      `steal()`,
+		"notes.txt":   `<script>kept</script>`,
+		"guide/a.HTM": `<a>a</a>`,
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: got %q, want %q", name, got, content)
+		}
+	}
+	for _, entry := range manifest {
+		if entry.Path == "index.html" && entry.Size != int64(len(want["index.html"])) {
+			t.Errorf("expected the manifest to describe the sanitized file, got %+v", entry)
+		}
+	}
+}
+
+func TestExtractSanitizeCompressedAndSniffed(t *testing.T) {
+	unsafe := `<p onclick="steal()">Hi</p><script>steal()</script>`
+	var gz, br bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(unsafe))
+	gw.Close()
+	bw := brotli.NewWriter(&br)
+	bw.Write([]byte(unsafe))
+	bw.Close()
+
+	dest := t.TempDir()
+	data := zipWithFiles(t, map[string]string{
+		"index.html.gz": gz.String(),
+		"index.html.br": br.String(),
+		"app.js.gz":     gz.String(),
+		"page":          `<!DOCTYPE html><html><body onload="steal()">Hi</body></html>`,
+		"page.unknown":  `<html><script>steal()</script></html>`,
+		"data.unknown":  `steal()`,
+	})
+	var manifest Manifest
+	err := ExtractArchiveWithOptions(bytes.NewReader(data), "docs.zip", dest, ExtractOptions{SanitizeHTML: true, Manifest: &manifest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decompress := map[string]func(io.Reader) (io.Reader, error){
+		"index.html.gz": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"index.html.br": func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+	for name, open := range decompress {
+		f, err := os.Open(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := open(f)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := io.ReadAll(r)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(got) != `<p>Hi</p>` {
+			t.Errorf("%s: expected the compressed copy to be sanitized, got %q", name, got)
+		}
+	}
+
+	want := map[string]string{
+		"app.js.gz":    gz.String(),
+		"page":         `<!DOCTYPE html><html><head></head><body>Hi</body></html>`,
+		"page.unknown": `<html><head></head><body></body></html>`,
+		"data.unknown": `steal()`,
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: got %q, want %q", name, got, content)
+		}
+	}
+	for _, entry := range manifest {
+		if info, err := os.Stat(filepath.Join(dest, entry.Path)); err != nil || info.Size() != entry.Size {
+			t.Errorf("expected the manifest to describe the sanitized %s, got %+v", entry.Path, entry)
+		}
+	}
+}
+
+func TestExtractSanitizeCompressedLimit(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(bytes.Repeat([]byte("<p>x</p>"), 1024))
+	gw.Close()
+
+	data := zipWithFiles(t, map[string]string{"index.html.gz": gz.String()})
+	opts := ExtractOptions{SanitizeHTML: true, Limits: ExtractLimits{MaxFileSize: 1024}}
+	err := ExtractArchiveWithOptions(bytes.NewReader(data), "docs.zip", t.TempDir(), opts)
+	if !errors.Is(err, ErrExtractLimit) {
+		t.Errorf("expected a compressed copy that expands past the file size limit to be refused, got %v", err)
+	}
+}
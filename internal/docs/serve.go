@@ -1,15 +1,51 @@
 package docs
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// immutableMaxAge is the Cache-Control max-age of files whose name carries
+// a content hash: a changed file gets a new name, so it never goes stale.
+const immutableMaxAge = 365 * 24 * time.Hour
+
+// CachePolicy sets the Cache-Control header of served documentation files.
+type CachePolicy struct {
+	Private     bool          // Only browsers may cache, not shared proxies
+	HTMLMaxAge  time.Duration // HTML pages; 0 means revalidate on every use
+	AssetMaxAge time.Duration // Other files without a content hash in their name
+}
+
+// ServeOptions controls caching of a served documentation file.
+type ServeOptions struct {
+	// Variant is mixed into the ETag when the served body differs from the
+	// file, e.g. by an injected overlay, so a changed overlay is not
+	// answered with 304 Not Modified.
+	Variant string
+	Policy  *CachePolicy // nil sets no Cache-Control header
+	Cache   *FileCache   // nil reads every file from disk
+}
+
 // ServeDoc serves a documentation file from the storage path.
 // If the path points to a directory, it serves index.html from that directory.
 func ServeDoc(w http.ResponseWriter, r *http.Request, storagePath, filePath string) {
+	ServeDocWithOptions(w, r, storagePath, filePath, ServeOptions{})
+}
+
+// ServeDocWithOptions is ServeDoc with ETag, Cache-Control and in-memory
+// caching. Conditional and range requests are answered by http.ServeContent.
+func ServeDocWithOptions(w http.ResponseWriter, r *http.Request, storagePath, filePath string, opts ServeOptions) {
 	fullPath := filepath.Join(storagePath, filepath.Clean(filePath))
 
 	// Security: ensure the resolved path is within the storage path
@@ -28,6 +64,17 @@ func ServeDoc(w http.ResponseWriter, r *http.Request, storagePath, filePath stri
 		return
 	}
 
+	// Same as http.ServeFile: .../index.html is served as .../
+	if strings.HasSuffix(r.URL.Path, "/index.html") {
+		location := "./"
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+
 	info, err := os.Stat(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -41,12 +88,178 @@ func ServeDoc(w http.ResponseWriter, r *http.Request, storagePath, filePath stri
 	// If directory, serve index.html
 	if info.IsDir() {
 		indexPath := filepath.Join(fullPath, "index.html")
-		if _, err := os.Stat(indexPath); err != nil {
+		info, err = os.Stat(indexPath)
+		if err != nil || info.IsDir() {
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
 		}
 		fullPath = indexPath
 	}
 
-	http.ServeFile(w, r, fullPath)
+	name := info.Name()
+	// Browsers take the type from Content-Type only, so a file of an
+	// unknown type is not run as HTML on a guess
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if opts.Policy != nil {
+		w.Header().Set("Cache-Control", opts.Policy.header(name))
+	}
+	variant := opts.Variant
+	// A compressed copy uploaded next to the file is sent as is. Bodies
+	// with injected HTML are built from the file itself, and ranges are
+	// ranges of the file.
+	if variant == "" && r.Header.Get("Range") == "" {
+		if encPath, encInfo, encoding := precompressed(w, r, fullPath, name); encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+			fullPath, info, variant = encPath, encInfo, encoding
+		}
+	}
+	w.Header().Set("ETag", fileETag(info, variant))
+	// Last-Modified only describes the file, not what is injected into it
+	modTime := info.ModTime()
+	if opts.Variant != "" {
+		modTime = time.Time{}
+	}
+
+	if data, ok := opts.Cache.get(fullPath, info); ok {
+		http.ServeContent(w, r, name, modTime, bytes.NewReader(data))
+		return
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	if opts.Cache.admits(info.Size()) {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		opts.Cache.put(fullPath, info, data)
+		http.ServeContent(w, r, name, modTime, bytes.NewReader(data))
+		return
+	}
+	http.ServeContent(w, r, name, modTime, f)
+}
+
+// precompressedEncodings are the extensions of compressed copies of files,
+// by the Content-Encoding they are sent with, in order of preference.
+var precompressedEncodings = []struct{ encoding, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// precompressed looks for a compressed copy of the file at fullPath, such
+// as main.js.br next to main.js, that the client accepts. It returns the
+// copy and its encoding, or "" if there is none. The Content-Type of name
+// is set for the copy, and so is Vary, as the response then depends on
+// Accept-Encoding.
+func precompressed(w http.ResponseWriter, r *http.Request, fullPath, name string) (string, fs.FileInfo, string) {
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		return "", nil, ""
+	}
+	accept := r.Header.Get("Accept-Encoding")
+	found := false
+	for _, p := range precompressedEncodings {
+		info, err := os.Stat(fullPath + p.ext)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if !found {
+			w.Header().Add("Vary", "Accept-Encoding")
+			found = true
+		}
+		if !acceptsEncoding(accept, p.encoding) {
+			continue
+		}
+		w.Header().Set("Content-Type", contentType)
+		return fullPath + p.ext, info, p.encoding
+	}
+	return "", nil, ""
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows the
+// content coding, by name or by "*", with a nonzero quality.
+func acceptsEncoding(acceptEncoding, coding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != coding && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err != nil || v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// fileETag derives a strong ETag from a file's size and modification time,
+// and the variant of the served body if any.
+func fileETag(info fs.FileInfo, variant string) string {
+	tag := strconv.FormatInt(info.Size(), 36) + "-" + strconv.FormatInt(info.ModTime().UnixNano(), 36)
+	if variant != "" {
+		sum := sha256.Sum256([]byte(variant))
+		tag += "-" + hex.EncodeToString(sum[:6])
+	}
+	return `"` + tag + `"`
+}
+
+// header returns the Cache-Control value for a served file name.
+func (p *CachePolicy) header(name string) string {
+	scope := "public"
+	if p.Private {
+		scope = "private"
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	switch {
+	case ext == ".html" || ext == ".htm":
+		if p.HTMLMaxAge <= 0 {
+			return scope + ", no-cache"
+		}
+		return fmt.Sprintf("%s, max-age=%d", scope, int(p.HTMLMaxAge.Seconds()))
+	case IsHashedAsset(name):
+		return fmt.Sprintf("%s, max-age=%d, immutable", scope, int(immutableMaxAge.Seconds()))
+	case p.AssetMaxAge <= 0:
+		return scope + ", no-cache"
+	}
+	return fmt.Sprintf("%s, max-age=%d", scope, int(p.AssetMaxAge.Seconds()))
+}
+
+// IsHashedAsset reports whether a file name carries a content hash as
+// written by bundlers, e.g. main.3f2a9c1b.js or app-BX7kq9Zs.css: a part
+// between the first and the last of at least 8 letters and digits that
+// contains a digit.
+func IsHashedAsset(name string) bool {
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '.' || r == '-' })
+	if len(parts) < 3 {
+		return false
+	}
+	for _, part := range parts[1 : len(parts)-1] {
+		if len(part) >= 8 && isHashLike(part) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHashLike(s string) bool {
+	digit := false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		default:
+			return false
+		}
+	}
+	return digit
 }
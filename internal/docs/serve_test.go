@@ -0,0 +1,173 @@
+package docs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func serveTestFile(t *testing.T, dir, path string, header http.Header, opts ServeOptions) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/docs/"+path, nil)
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	w := httptest.NewRecorder()
+	ServeDocWithOptions(w, req, dir, path, opts)
+	return w
+}
+
+func TestServeDocConditionalRequests(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0644)
+
+	w := serveTestFile(t, dir, "", nil, ServeOptions{})
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Last-Modified") == "" {
+		t.Fatalf("expected 200 with validators, got %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("expected X-Content-Type-Options: nosniff, got %v", w.Header())
+	}
+
+	w = serveTestFile(t, dir, "", http.Header{"If-None-Match": {etag}}, ServeOptions{})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for matching ETag, got %d", w.Code)
+	}
+
+	w = serveTestFile(t, dir, "", http.Header{"If-None-Match": {etag}}, ServeOptions{Variant: "<div>overlay</div>"})
+	if w.Code != http.StatusOK || w.Header().Get("Last-Modified") != "" {
+		t.Errorf("expected a variant to change the ETag and drop Last-Modified, got %d %v", w.Code, w.Header())
+	}
+
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(dir, "index.html"), later, later)
+	w = serveTestFile(t, dir, "", http.Header{"If-None-Match": {etag}}, ServeOptions{})
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 after the file changed, got %d", w.Code)
+	}
+}
+
+func TestServeDocCacheControl(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"index.html", "main.3f2a9c1b.js", "style.css"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644)
+	}
+	policy := &CachePolicy{HTMLMaxAge: time.Minute, AssetMaxAge: time.Hour}
+
+	tests := []struct {
+		path    string
+		private bool
+		want    string
+	}{
+		{"", false, "public, max-age=60"},
+		{"main.3f2a9c1b.js", false, "public, max-age=31536000, immutable"},
+		{"style.css", false, "public, max-age=3600"},
+		{"style.css", true, "private, max-age=3600"},
+	}
+	for _, tt := range tests {
+		p := *policy
+		p.Private = tt.private
+		w := serveTestFile(t, dir, tt.path, nil, ServeOptions{Policy: &p})
+		if got := w.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("%s (private=%v): got %q, want %q", tt.path, tt.private, got, tt.want)
+		}
+	}
+}
+
+func TestServeDocPrecompressed(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(1)"), 0644)
+	os.WriteFile(filepath.Join(dir, "app.js.br"), []byte("brotli"), 0644)
+	os.WriteFile(filepath.Join(dir, "app.js.gz"), []byte("gzip"), 0644)
+	os.WriteFile(filepath.Join(dir, "plain.css"), []byte("body{}"), 0644)
+
+	tests := []struct {
+		path, accept, encoding, body string
+	}{
+		{"app.js", "gzip, deflate, br", "br", "brotli"},
+		{"app.js", "gzip", "gzip", "gzip"},
+		{"app.js", "br;q=0, gzip;q=0.5", "gzip", "gzip"},
+		{"app.js", "", "", "console.log(1)"},
+		{"plain.css", "br", "", "body{}"},
+	}
+	etags := make(map[string]string)
+	for _, tt := range tests {
+		w := serveTestFile(t, dir, tt.path, http.Header{"Accept-Encoding": {tt.accept}}, ServeOptions{})
+		if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != tt.encoding || w.Body.String() != tt.body {
+			t.Errorf("%s with %q: expected %q encoded %q, got %d %q encoded %q", tt.path, tt.accept, tt.body, tt.encoding, w.Code, w.Body.String(), w.Header().Get("Content-Encoding"))
+		}
+		if tt.path == "app.js" {
+			if ct := w.Header().Get("Content-Type"); ct != "text/javascript; charset=utf-8" {
+				t.Errorf("expected the type of app.js, got %q", ct)
+			}
+			if w.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("expected Vary: Accept-Encoding, got %q", w.Header().Values("Vary"))
+			}
+			etags[tt.encoding] = w.Header().Get("ETag")
+		}
+	}
+	if len(etags) != 3 || etags["br"] == etags["gzip"] || etags["br"] == etags[""] {
+		t.Errorf("expected an ETag per encoding, got %v", etags)
+	}
+
+	// Ranges are ranges of the file
+	w := serveTestFile(t, dir, "app.js", http.Header{"Accept-Encoding": {"br"}, "Range": {"bytes=0-6"}}, ServeOptions{})
+	if w.Code != http.StatusPartialContent || w.Header().Get("Content-Encoding") != "" || w.Body.String() != "console" {
+		t.Errorf("expected a range of the file, got %d %q", w.Code, w.Body.String())
+	}
+
+	// Bodies with injected HTML are built from the file itself
+	w = serveTestFile(t, dir, "app.js", http.Header{"Accept-Encoding": {"br"}}, ServeOptions{Variant: "<div></div>"})
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "console.log(1)" {
+		t.Errorf("expected a variant to be served from the file, got %q", w.Body.String())
+	}
+}
+
+func TestIsHashedAsset(t *testing.T) {
+	tests := map[string]bool{
+		"main.3f2a9c1b.js":         true,
+		"app-BX7kq9Zs.css":         true,
+		"main.3f2a9c1b.chunk.js":   true,
+		"jquery-3.6.0.min.js":      false,
+		"searchindex.js":           false,
+		"documentation.html":       false,
+		"font-awesome-webfont.ttf": false,
+	}
+	for name, want := range tests {
+		if got := IsHashedAsset(name); got != want {
+			t.Errorf("IsHashedAsset(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewFileCache(10, 6)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("12345"), 0644)
+	}
+	os.WriteFile(filepath.Join(dir, "big.txt"), []byte("1234567"), 0644)
+
+	for _, name := range []string{"a.txt", "b.txt", "a.txt", "c.txt", "big.txt"} {
+		if w := serveTestFile(t, dir, name, nil, ServeOptions{Cache: cache}); w.Body.String() == "" {
+			t.Fatalf("%s: empty body", name)
+		}
+	}
+	// b.txt was least recently used when c.txt arrived; big.txt is too large
+	if cache.Len() != 2 || cache.Size() != 10 {
+		t.Fatalf("expected a.txt and c.txt cached, got %d files of %d bytes", cache.Len(), cache.Size())
+	}
+	info, _ := os.Stat(filepath.Join(dir, "b.txt"))
+	if _, ok := cache.get(filepath.Join(dir, "b.txt"), info); ok {
+		t.Error("expected b.txt to be evicted")
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("abc"), 0644)
+	if w := serveTestFile(t, dir, "a.txt", nil, ServeOptions{Cache: cache}); w.Body.String() != "abc" {
+		t.Errorf("expected the changed file to be read again, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,109 @@
+package docs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrNoSigningKeys    = errors.New("no signing keys configured")
+	ErrInvalidSignature = errors.New("signature does not match any signing key")
+)
+
+// ParsePublicKeys parses one or more PEM "PUBLIC KEY" blocks (PKIX, as
+// written by `cosign generate-key-pair` or `openssl pkey -pubout`).
+func ParsePublicKeys(pemText string) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	rest := []byte(pemText)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key: %w", err)
+		}
+		switch key.(type) {
+		case *ecdsa.PublicKey, *rsa.PublicKey:
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+		keys = append(keys, key)
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, errors.New("trailing data after PEM blocks")
+	}
+	return keys, nil
+}
+
+// KeyFingerprint returns the hex SHA-256 of the key's PKIX encoding.
+func KeyFingerprint(key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyDetachedSignature checks sig against the SHA-256 digest of payload
+// using each key in keysPEM and returns the fingerprint of the first key
+// that verifies. The signature may be raw or base64 encoded, so the output
+// of `cosign sign-blob --key` can be used directly.
+func VerifyDetachedSignature(payload io.Reader, sig []byte, keysPEM string) (string, error) {
+	keys, err := ParsePublicKeys(keysPEM)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", ErrNoSigningKeys
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, payload); err != nil {
+		return "", fmt.Errorf("hashing payload: %w", err)
+	}
+	digest := h.Sum(nil)
+
+	candidates := [][]byte{sig}
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig))); err == nil {
+		candidates = append(candidates, decoded)
+	}
+
+	for _, key := range keys {
+		for _, s := range candidates {
+			if verifyDigest(key, digest, s) {
+				return KeyFingerprint(key), nil
+			}
+		}
+	}
+	return "", ErrInvalidSignature
+}
+
+func verifyDigest(key crypto.PublicKey, digest, sig []byte) bool {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest, sig)
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig) == nil {
+			return true
+		}
+		return rsa.VerifyPSS(k, crypto.SHA256, digest, sig, nil) == nil
+	}
+	return false
+}
@@ -1,23 +1,46 @@
 package docs
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 type Storage interface {
 	BasePath() string
 	ProjectPath(slug string) string
 	VersionPath(slug, tag string) string
+	AttachmentPath(slug, tag string) string
 	EnsureProjectDir(slug string) error
 	EnsureVersionDir(slug, tag string) error
 	VersionExists(slug, tag string) bool
 	DeleteVersion(slug, tag string) error
+	ReplaceVersion(slug, tag, dir string) error
+	RenameVersion(slug, from, to string) error
+	PreviewPath(slug, name string) string
+	DeletePreview(slug, name string) error
+
+	WriteManifest(slug, tag string, m Manifest) error
+	ReadManifest(slug, tag string) (Manifest, error)
+	DeduplicateVersion(slug, tag string, m Manifest) (int64, error)
+	PruneBlobs(ctx context.Context) (int, int64, error)
+
+	ListVersionDirs() ([]VersionDir, error)
+	RemoveProjectDir(slug string) error
+	CheckWritable() error
 }
 
 type FilesystemStorage struct {
 	basePath string
+	// Deduplicate makes DeduplicateVersion store files with the same
+	// content once, hard-linked from every version that has them.
+	Deduplicate bool
 }
 
 func NewFilesystemStorage(basePath string) *FilesystemStorage {
@@ -36,6 +59,25 @@ func (s *FilesystemStorage) VersionPath(slug, tag string) string {
 	return filepath.Join(s.basePath, slug, tag)
 }
 
+// attachmentsDir holds version attachments outside the served project trees.
+// Slugs cannot start with a dot, so it never collides with a project.
+const attachmentsDir = ".attachments"
+
+// previewsDir holds the files of previews, which are not versions.
+const previewsDir = ".previews"
+
+// manifestsDir holds the manifest of each version, blobsDir the content
+// addressed files of deduplicated storage.
+const (
+	manifestsDir = ".manifests"
+	blobsDir     = ".blobs"
+)
+
+// AttachmentPath returns the directory holding a version's attachments.
+func (s *FilesystemStorage) AttachmentPath(slug, tag string) string {
+	return filepath.Join(s.basePath, attachmentsDir, slug, tag)
+}
+
 func (s *FilesystemStorage) EnsureProjectDir(slug string) error {
 	path := s.ProjectPath(slug)
 	if err := os.MkdirAll(path, 0755); err != nil {
@@ -63,5 +105,291 @@ func (s *FilesystemStorage) DeleteVersion(slug, tag string) error {
 	if err := os.RemoveAll(path); err != nil {
 		return fmt.Errorf("deleting version directory: %w", err)
 	}
+	if err := os.RemoveAll(s.AttachmentPath(slug, tag)); err != nil {
+		return fmt.Errorf("deleting version attachments: %w", err)
+	}
+	if err := os.Remove(s.manifestPath(slug, tag)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("deleting version manifest: %w", err)
+	}
+	return nil
+}
+
+// ReplaceVersion moves dir into place as the files of a version, removing
+// the files it had before. dir must be on the same file system, such as a
+// temporary directory below ProjectPath whose name starts with a dot.
+func (s *FilesystemStorage) ReplaceVersion(slug, tag, dir string) error {
+	path := s.VersionPath(slug, tag)
+	if err := os.Chmod(dir, 0755); err != nil {
+		return fmt.Errorf("replacing version directory: %w", err)
+	}
+	old := dir + ".old"
+	if err := os.Rename(path, old); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("moving previous version aside: %w", err)
+	}
+	if err := os.Rename(dir, path); err != nil {
+		os.Rename(old, path)
+		return fmt.Errorf("replacing version directory: %w", err)
+	}
+	if err := os.RemoveAll(old); err != nil {
+		return fmt.Errorf("removing previous version files: %w", err)
+	}
+	return nil
+}
+
+// VersionDir is a version directory found in storage.
+type VersionDir struct {
+	Slug    string
+	Tag     string
+	ModTime time.Time
+}
+
+// ListVersionDirs returns the version directories of all projects. The
+// directories of attachments, previews, manifests and blobs are skipped, as
+// are project directories without versions and the directories uploads are
+// unpacked into before they replace a version.
+func (s *FilesystemStorage) ListVersionDirs() ([]VersionDir, error) {
+	projects, err := os.ReadDir(s.basePath)
+	if err != nil {
+		return nil, fmt.Errorf("listing project directories: %w", err)
+	}
+	var dirs []VersionDir
+	for _, p := range projects {
+		if !p.IsDir() || strings.HasPrefix(p.Name(), ".") {
+			continue
+		}
+		versions, err := os.ReadDir(s.ProjectPath(p.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("listing version directories: %w", err)
+		}
+		for _, v := range versions {
+			if !v.IsDir() || strings.HasPrefix(v.Name(), ".") {
+				continue
+			}
+			info, err := v.Info()
+			if err != nil {
+				return nil, fmt.Errorf("listing version directories: %w", err)
+			}
+			dirs = append(dirs, VersionDir{Slug: p.Name(), Tag: v.Name(), ModTime: info.ModTime()})
+		}
+	}
+	return dirs, nil
+}
+
+// RemoveProjectDir removes the directory of a project if it is empty.
+func (s *FilesystemStorage) RemoveProjectDir(slug string) error {
+	err := os.Remove(s.ProjectPath(slug))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		if entries, readErr := os.ReadDir(s.ProjectPath(slug)); readErr == nil && len(entries) > 0 {
+			return nil
+		}
+		return fmt.Errorf("removing project directory: %w", err)
+	}
+	return nil
+}
+
+// CheckWritable creates and removes a file in the base directory to tell
+// whether uploads can be stored.
+func (s *FilesystemStorage) CheckWritable() error {
+	f, err := os.CreateTemp(s.basePath, ".writable-*")
+	if err != nil {
+		return fmt.Errorf("storage is not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// PreviewPath returns the directory holding the files of a preview.
+func (s *FilesystemStorage) PreviewPath(slug, name string) string {
+	return filepath.Join(s.basePath, previewsDir, slug, name)
+}
+
+func (s *FilesystemStorage) DeletePreview(slug, name string) error {
+	if err := os.RemoveAll(s.PreviewPath(slug, name)); err != nil {
+		return fmt.Errorf("deleting preview directory: %w", err)
+	}
 	return nil
 }
+
+// RenameVersion moves the files and attachments of a version to a new tag.
+// The target version must not exist.
+func (s *FilesystemStorage) RenameVersion(slug, from, to string) error {
+	if s.VersionExists(slug, to) {
+		return fmt.Errorf("renaming version directory: %s already exists", to)
+	}
+	if err := os.Rename(s.VersionPath(slug, from), s.VersionPath(slug, to)); err != nil {
+		return fmt.Errorf("renaming version directory: %w", err)
+	}
+	if err := os.Rename(s.manifestPath(slug, from), s.manifestPath(slug, to)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("renaming version manifest: %w", err)
+	}
+	oldAttachments := s.AttachmentPath(slug, from)
+	if _, err := os.Stat(oldAttachments); err != nil {
+		return nil
+	}
+	newAttachments := s.AttachmentPath(slug, to)
+	if err := os.RemoveAll(newAttachments); err != nil {
+		return fmt.Errorf("renaming version attachments: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(newAttachments), 0755); err != nil {
+		return fmt.Errorf("renaming version attachments: %w", err)
+	}
+	if err := os.Rename(oldAttachments, newAttachments); err != nil {
+		return fmt.Errorf("renaming version attachments: %w", err)
+	}
+	return nil
+}
+
+func (s *FilesystemStorage) manifestPath(slug, tag string) string {
+	return filepath.Join(s.basePath, manifestsDir, slug, tag+".json")
+}
+
+// WriteManifest stores the manifest of a version.
+func (s *FilesystemStorage) WriteManifest(slug, tag string, m Manifest) error {
+	path := s.manifestPath(slug, tag)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest returns the stored manifest of a version. The error wraps
+// fs.ErrNotExist for versions stored without one.
+func (s *FilesystemStorage) ReadManifest(slug, tag string) (Manifest, error) {
+	data, err := os.ReadFile(s.manifestPath(slug, tag))
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	return m, nil
+}
+
+func (s *FilesystemStorage) blobPath(sum string) string {
+	return filepath.Join(s.basePath, blobsDir, sum[:2], sum)
+}
+
+// DeduplicateVersion replaces the files of a version listed in its manifest by
+// hard links to blobs of the same content, adding the blobs that are new.
+// It returns the bytes saved, and does nothing unless deduplication is
+// enabled. The storage must be on a file system with hard links.
+func (s *FilesystemStorage) DeduplicateVersion(slug, tag string, m Manifest) (int64, error) {
+	if !s.Deduplicate {
+		return 0, nil
+	}
+	root := s.VersionPath(slug, tag)
+	var saved int64
+	for _, e := range m {
+		if len(e.SHA256) != 64 {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(e.Path))
+		blob := s.blobPath(e.SHA256)
+		info, err := os.Stat(blob)
+		if errors.Is(err, fs.ErrNotExist) {
+			if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+				return saved, fmt.Errorf("deduplicating %s: %w", e.Path, err)
+			}
+			if err := os.Link(path, blob); err != nil && !errors.Is(err, fs.ErrExist) {
+				return saved, fmt.Errorf("deduplicating %s: %w", e.Path, err)
+			}
+			continue
+		}
+		if err != nil {
+			return saved, fmt.Errorf("deduplicating %s: %w", e.Path, err)
+		}
+		if current, err := os.Stat(path); err != nil || os.SameFile(info, current) || info.Size() != e.Size {
+			continue
+		}
+		// Link the blob next to the file and move it over the file, so the
+		// file is never missing.
+		tmp := path + ".dedup"
+		if err := os.Link(blob, tmp); err != nil {
+			return saved, fmt.Errorf("deduplicating %s: %w", e.Path, err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return saved, fmt.Errorf("deduplicating %s: %w", e.Path, err)
+		}
+		saved += e.Size
+	}
+	return saved, nil
+}
+
+// PruneBlobs removes the blobs no manifest refers to any more, and returns
+// how many it removed and their size. Version files are hard links, so a
+// blob pruned while an upload links to it only loses its deduplication.
+func (s *FilesystemStorage) PruneBlobs(ctx context.Context) (int, int64, error) {
+	blobs := filepath.Join(s.basePath, blobsDir)
+	if _, err := os.Stat(blobs); errors.Is(err, fs.ErrNotExist) {
+		return 0, 0, nil
+	}
+
+	used := make(map[string]bool)
+	err := filepath.WalkDir(filepath.Join(s.basePath, manifestsDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var m Manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, e := range m {
+			used[e.SHA256] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading manifests: %w", err)
+	}
+
+	var removed int
+	var size int64
+	err = filepath.WalkDir(blobs, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || used[d.Name()] {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return removed, size, fmt.Errorf("pruning blobs: %w", err)
+	}
+	return removed, size, nil
+}
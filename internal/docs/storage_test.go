@@ -1,6 +1,9 @@
 package docs
 
 import (
+	"context"
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"testing"
@@ -45,6 +48,13 @@ func TestFilesystemStorage(t *testing.T) {
 		t.Error("version should exist now")
 	}
 
+	// Attachments live outside the project directory
+	ap := storage.AttachmentPath("my-project", "v1.0")
+	if isPathSafe(pp, ap) {
+		t.Errorf("attachment path %s should not be inside the project directory", ap)
+	}
+	os.MkdirAll(ap, 0755)
+
 	// DeleteVersion
 	if err := storage.DeleteVersion("my-project", "v1.0"); err != nil {
 		t.Fatal(err)
@@ -53,6 +63,39 @@ func TestFilesystemStorage(t *testing.T) {
 	if storage.VersionExists("my-project", "v1.0") {
 		t.Error("version should be deleted")
 	}
+	if _, err := os.Stat(ap); !os.IsNotExist(err) {
+		t.Error("version attachments should be deleted")
+	}
+}
+
+func TestListVersionDirs(t *testing.T) {
+	storage := NewFilesystemStorage(t.TempDir())
+	storage.EnsureVersionDir("docs", "v1.0")
+	storage.EnsureVersionDir("docs", "v2.0")
+	storage.EnsureProjectDir("empty")
+	os.MkdirAll(storage.AttachmentPath("docs", "v1.0"), 0755)
+	os.MkdirAll(storage.PreviewPath("docs", "pr-1"), 0755)
+
+	dirs, err := storage.ListVersionDirs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 2 || dirs[0].Slug != "docs" || dirs[0].Tag != "v1.0" || dirs[1].Tag != "v2.0" {
+		t.Errorf("unexpected version directories: %+v", dirs)
+	}
+
+	if err := storage.RemoveProjectDir("docs"); err != nil {
+		t.Errorf("expected a project directory with versions to be kept, got %v", err)
+	}
+	if !storage.VersionExists("docs", "v1.0") {
+		t.Error("expected the versions to be kept")
+	}
+	if err := storage.RemoveProjectDir("empty"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(storage.ProjectPath("empty")); !os.IsNotExist(err) {
+		t.Error("expected the empty project directory to be removed")
+	}
 }
 
 func TestServeDoc(t *testing.T) {
@@ -72,3 +115,69 @@ func TestServeDoc(t *testing.T) {
 		t.Error("path outside base should not be safe")
 	}
 }
+
+func TestDeduplicateVersion(t *testing.T) {
+	storage := NewFilesystemStorage(t.TempDir())
+	storage.Deduplicate = true
+	ctx := context.Background()
+
+	var manifests []Manifest
+	for _, tag := range []string{"v1", "v2"} {
+		dir := storage.VersionPath("proj", tag)
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "logo.png"), []byte("same logo"), 0644)
+		os.WriteFile(filepath.Join(dir, "index.html"), []byte("index of "+tag), 0644)
+		m, err := BuildManifest(ctx, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.WriteManifest("proj", tag, m); err != nil {
+			t.Fatal(err)
+		}
+		manifests = append(manifests, m)
+	}
+	if saved, err := storage.DeduplicateVersion("proj", "v1", manifests[0]); err != nil || saved != 0 {
+		t.Fatalf("expected nothing saved on first upload, got %d (%v)", saved, err)
+	}
+	saved, err := storage.DeduplicateVersion("proj", "v2", manifests[1])
+	if err != nil || saved != int64(len("same logo")) {
+		t.Fatalf("expected the logo to be saved, got %d (%v)", saved, err)
+	}
+
+	a, _ := os.Stat(filepath.Join(storage.VersionPath("proj", "v1"), "logo.png"))
+	b, _ := os.Stat(filepath.Join(storage.VersionPath("proj", "v2"), "logo.png"))
+	if !os.SameFile(a, b) {
+		t.Error("expected the logos to share a file")
+	}
+	if m, err := storage.ReadManifest("proj", "v2"); err != nil || m.Digest() != manifests[1].Digest() {
+		t.Errorf("expected the stored manifest back, got %+v (%v)", m, err)
+	}
+
+	if n, _, err := storage.PruneBlobs(ctx); err != nil || n != 0 {
+		t.Errorf("expected no blobs pruned while in use, got %d (%v)", n, err)
+	}
+	storage.DeleteVersion("proj", "v1")
+	storage.DeleteVersion("proj", "v2")
+	if _, err := storage.ReadManifest("proj", "v1"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the manifest deleted with the version, got %v", err)
+	}
+	if n, _, err := storage.PruneBlobs(ctx); err != nil || n != 3 {
+		t.Errorf("expected the 3 blobs pruned, got %d (%v)", n, err)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	storage := NewFilesystemStorage(dir)
+	if err := storage.CheckWritable(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected the check to leave no files, got %d", len(entries))
+	}
+
+	missing := NewFilesystemStorage(filepath.Join(dir, "missing"))
+	if err := missing.CheckWritable(); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
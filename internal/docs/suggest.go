@@ -0,0 +1,33 @@
+package docs
+
+import (
+	"context"
+	"strings"
+)
+
+// MinSuggestPrefix is the shortest last word completions are looked up
+// for.
+const MinSuggestPrefix = 2
+
+// Suggestion is a page whose title or text completes a search as it is
+// typed, with the words of the page that complete the last word.
+type Suggestion struct {
+	SearchResult
+	Terms []string
+}
+
+// Suggest returns the pages matching sq.Query as typed so far: the last
+// word counts as a prefix, of the title or the text, and the words before
+// it must match. Like Search, only the latest versions are looked at
+// unless sq says otherwise. It returns nothing when the last word is
+// shorter than MinSuggestPrefix.
+func (si *SearchIndex) Suggest(ctx context.Context, sq SearchQuery, latestVersionTags map[string]string) ([]Suggestion, error) {
+	words := strings.Fields(strings.ToLower(sq.Query))
+	if len(words) == 0 || len([]rune(words[len(words)-1])) < MinSuggestPrefix {
+		return nil, nil
+	}
+	if sq.Limit <= 0 {
+		sq.Limit = 8
+	}
+	return si.backend.Suggest(ctx, sq, latestVersionTags)
+}
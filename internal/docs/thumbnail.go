@@ -0,0 +1,79 @@
+package docs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ThumbnailFile is the name of the preview image stored with a version.
+const ThumbnailFile = "thumbnail.png"
+
+// RenderThumbnail renders the index.html of a version to a PNG image in
+// dir using an external headless renderer. The command is split on spaces;
+// {url} is replaced with the file URL of the page, {input} with its path
+// and {output} with the path the image must be written to, e.g.
+//
+//	chromium --headless --screenshot={output} --window-size=1280,800 {url}
+func RenderThumbnail(ctx context.Context, command, versionPath, dir string) error {
+	input, err := filepath.Abs(filepath.Join(versionPath, "index.html"))
+	if err != nil {
+		return fmt.Errorf("resolving index page: %w", err)
+	}
+	if _, err := os.Stat(input); err != nil {
+		return fmt.Errorf("no index page: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating thumbnail directory: %w", err)
+	}
+
+	// Render to a temporary name so a failed run never replaces a good image.
+	tmp, err := filepath.Abs(filepath.Join(dir, ".thumbnail.tmp.png"))
+	if err != nil {
+		return fmt.Errorf("resolving thumbnail path: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	if err := runRenderer(ctx, "thumbnail", command, input, tmp); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(tmp)
+	if err != nil || info.Size() == 0 {
+		return fmt.Errorf("thumbnail renderer wrote no image")
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, ThumbnailFile)); err != nil {
+		return fmt.Errorf("storing thumbnail: %w", err)
+	}
+	return nil
+}
+
+// runRenderer runs an external headless renderer on the page at input,
+// writing to output. The command is split on spaces; {url} is replaced
+// with the file URL of the page, {input} with its path and {output} with
+// output. kind names the renderer in errors.
+func runRenderer(ctx context.Context, kind, command, input, output string) error {
+	fileURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(input)}).String()
+	replacer := strings.NewReplacer("{url}", fileURL, "{input}", input, "{output}", output)
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return fmt.Errorf("no %s renderer configured", kind)
+	}
+	for i, arg := range args {
+		args[i] = replacer.Replace(arg)
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = filepath.Dir(output)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s renderer: %w: %s", kind, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package docs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderThumbnail(t *testing.T) {
+	versionPath := t.TempDir()
+	os.WriteFile(filepath.Join(versionPath, "index.html"), []byte("<html></html>"), 0644)
+	dir := filepath.Join(t.TempDir(), "attachments")
+	thumbnail := filepath.Join(dir, ThumbnailFile)
+
+	if err := RenderThumbnail(context.Background(), "cp {input} {output}", versionPath, dir); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(thumbnail); err != nil || string(data) != "<html></html>" {
+		t.Fatalf("expected the renderer output as thumbnail, got %q, %v", data, err)
+	}
+
+	if err := RenderThumbnail(context.Background(), "false {url} {output}", versionPath, dir); err == nil {
+		t.Error("expected a failing renderer to return an error")
+	}
+	if err := RenderThumbnail(context.Background(), "true {url} {output}", versionPath, dir); err == nil {
+		t.Error("expected a renderer writing no image to return an error")
+	}
+	if _, err := os.Stat(thumbnail); err != nil {
+		t.Error("expected a failed rendering to keep the previous thumbnail")
+	}
+
+	if err := RenderThumbnail(context.Background(), "cp {input} {output}", t.TempDir(), dir); err == nil {
+		t.Error("expected an error for a version without index.html")
+	}
+}
@@ -0,0 +1,44 @@
+package docs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile in the root of a version configures how it is served.
+const ConfigFile = "asiakirjat.yaml"
+
+// VersionConfig is the asiakirjat.yaml of a version.
+type VersionConfig struct {
+	// Overlay set to false serves the pages of the version without the
+	// doc overlay.
+	Overlay   *bool          `yaml:"overlay"`
+	Redirects []RedirectRule `yaml:"redirects"`
+}
+
+// ReadVersionConfig reads the asiakirjat.yaml of the version stored in
+// dir. A version without one has an empty config.
+func ReadVersionConfig(dir string) (*VersionConfig, error) {
+	var config VersionConfig
+	data, err := os.ReadFile(filepath.Join(dir, ConfigFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &config, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", ConfigFile, err)
+	}
+	return &config, nil
+}
+
+// HidesOverlay reports whether the config opts the version out of the doc
+// overlay.
+func (c *VersionConfig) HidesOverlay() bool {
+	return c.Overlay != nil && !*c.Overlay
+}
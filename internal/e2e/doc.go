@@ -0,0 +1,12 @@
+// Package e2e holds end-to-end tests of the authentication against real
+// directory and identity provider servers, which the unit tests mock: an
+// OpenLDAP server, and dex as OIDC provider backed by it. The servers run
+// in Docker containers started by the tests and removed after them.
+//
+// The tests are behind the e2e build tag:
+//
+//	go test -mod=vendor -count=1 -tags e2e ./internal/e2e/
+//
+// They are skipped if docker is not available. The images are set by
+// ASIAKIRJAT_E2E_LDAP_IMAGE and ASIAKIRJAT_E2E_DEX_IMAGE.
+package e2e
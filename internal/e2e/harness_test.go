@@ -0,0 +1,308 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/qwc/asiakirjat/internal/database"
+	sqlstore "github.com/qwc/asiakirjat/internal/store/sql"
+	"github.com/qwc/asiakirjat/internal/testutil"
+)
+
+const (
+	baseDN        = "dc=example,dc=org"
+	adminDN       = "cn=admin,dc=example,dc=org"
+	adminPassword = "admin"
+
+	clientID     = "asiakirjat"
+	clientSecret = "asiakirjat-e2e"
+	redirectURL  = "http://asiakirjat.test/callback"
+)
+
+// servers holds the addresses of the containers started by TestMain. skip
+// is set, and the tests skipped, if they could not be started because
+// docker is missing.
+var servers struct {
+	skip    string
+	ldapURL string
+	issuer  string
+}
+
+// containers and network are removed after the tests.
+var (
+	containers []string
+	network    string
+)
+
+func TestMain(m *testing.M) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		servers.skip = "docker is not available"
+		os.Exit(m.Run())
+	}
+	err := start()
+	code := 1
+	if err == nil {
+		code = m.Run()
+	} else {
+		fmt.Fprintln(os.Stderr, "e2e: starting servers:", err)
+	}
+	stop()
+	os.Exit(code)
+}
+
+// requireServers skips the test if the servers are not running.
+func requireServers(t *testing.T) {
+	t.Helper()
+	if servers.skip != "" {
+		t.Skip(servers.skip)
+	}
+}
+
+func start() error {
+	network = fmt.Sprintf("asiakirjat-e2e-%d", os.Getpid())
+	if _, err := docker("network", "create", network); err != nil {
+		return err
+	}
+	if err := startLDAP(); err != nil {
+		return fmt.Errorf("openldap: %w", err)
+	}
+	if err := startDex(); err != nil {
+		return fmt.Errorf("dex: %w", err)
+	}
+	return nil
+}
+
+func stop() {
+	for _, c := range containers {
+		docker("rm", "-f", "-v", c)
+	}
+	if network != "" {
+		docker("network", "rm", network)
+	}
+}
+
+func startLDAP() error {
+	id, err := run(image("ASIAKIRJAT_E2E_LDAP_IMAGE", "osixia/openldap:1.5.0"),
+		[]string{"--network-alias", "openldap", "-p", "127.0.0.1::389",
+			"-e", "LDAP_ORGANISATION=Example", "-e", "LDAP_DOMAIN=example.org", "-e", "LDAP_ADMIN_PASSWORD=" + adminPassword})
+	if err != nil {
+		return err
+	}
+	port, err := docker("port", id, "389/tcp")
+	if err != nil {
+		return err
+	}
+	servers.ldapURL = "ldap://" + strings.TrimSpace(strings.SplitN(port, "\n", 2)[0])
+
+	if err := waitFor(func() error {
+		conn, err := adminConn()
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}); err != nil {
+		return err
+	}
+
+	// -M adds the referral entry as an entry rather than following it
+	ldif, err := os.ReadFile(filepath.Join("testdata", "directory.ldif"))
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("docker", "exec", "-i", id, "ldapadd", "-x", "-M", "-H", "ldap://localhost", "-D", adminDN, "-w", adminPassword)
+	cmd.Stdin = bytes.NewReader(ldif)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("loading directory.ldif: %w: %s", err, out)
+	}
+	return nil
+}
+
+func startDex() error {
+	// dex has to know the address it is reached at, so the port is
+	// picked here rather than by docker.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	servers.issuer = fmt.Sprintf("http://127.0.0.1:%d/dex", port)
+
+	tmpl, err := template.ParseFiles(filepath.Join("testdata", "dex.yaml"))
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "asiakirjat-e2e-dex")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]string{"Issuer": servers.issuer, "RedirectURL": redirectURL}); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	// dex runs as an unprivileged user; it reads the config once at
+	// startup, so the directory can go when dex is up.
+	if err := os.Chmod(dir, 0o755); err != nil {
+		return err
+	}
+
+	if _, err := run(image("ASIAKIRJAT_E2E_DEX_IMAGE", "ghcr.io/dexidp/dex:v2.41.1"),
+		[]string{"-p", fmt.Sprintf("127.0.0.1:%d:5556", port), "-v", dir + ":/etc/dex/e2e:ro"},
+		"dex", "serve", "/etc/dex/e2e/config.yaml"); err != nil {
+		return err
+	}
+	return waitFor(func() error {
+		resp, err := http.Get(servers.issuer + "/.well-known/openid-configuration")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("discovery returned %d", resp.StatusCode)
+		}
+		return nil
+	})
+}
+
+// run starts a detached container on the test network and returns its ID.
+func run(image string, opts []string, args ...string) (string, error) {
+	cmd := append([]string{"run", "-d", "--network", network}, opts...)
+	cmd = append(cmd, image)
+	id, err := docker(append(cmd, args...)...)
+	if err != nil {
+		return "", err
+	}
+	id = strings.TrimSpace(id)
+	containers = append(containers, id)
+	return id, nil
+}
+
+func docker(args ...string) (string, error) {
+	out, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("docker %s: %w: %s", args[0], err, out)
+	}
+	return string(out), nil
+}
+
+func image(env, fallback string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// waitFor retries ready until it succeeds, for up to a minute.
+func waitFor(ready func() error) error {
+	deadline := time.Now().Add(time.Minute)
+	for {
+		err := ready()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func adminConn() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(servers.ldapURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(adminDN, adminPassword); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// userDN and groupDN return the DNs of the entries in directory.ldif.
+func userDN(uid string) string { return "uid=" + uid + ",ou=people," + baseDN }
+func groupDN(cn string) string { return "cn=" + cn + ",ou=groups," + baseDN }
+
+// removeMember takes member out of group in the directory for the rest of
+// the test, as an administrator revoking it would.
+func removeMember(t *testing.T, group, member string) {
+	t.Helper()
+	modify := func(change func(*ldap.ModifyRequest)) error {
+		conn, err := adminConn()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		req := ldap.NewModifyRequest(group, nil)
+		change(req)
+		return conn.Modify(req)
+	}
+	if err := modify(func(req *ldap.ModifyRequest) { req.Delete("uniqueMember", []string{member}) }); err != nil {
+		t.Fatalf("removing %s from %s: %v", member, group, err)
+	}
+	t.Cleanup(func() {
+		if err := modify(func(req *ldap.ModifyRequest) { req.Add("uniqueMember", []string{member}) }); err != nil {
+			t.Errorf("restoring %s to %s: %v", member, group, err)
+		}
+	})
+}
+
+// stores are the stores the authenticators provision users and sync
+// access into, on a fresh database.
+type stores struct {
+	users    *sqlstore.UserStore
+	access   *sqlstore.ProjectAccessStore
+	mappings *sqlstore.AuthGroupMappingStore
+	global   *sqlstore.GlobalAccessStore
+	project  *database.Project
+}
+
+// newStores returns stores with a "handbook" project that members of
+// group get editor access to when logging in with source.
+func newStores(t *testing.T, source, group string) *stores {
+	t.Helper()
+	db := testutil.NewTestDB(t)
+	s := &stores{
+		users:    sqlstore.NewUserStore(db),
+		access:   sqlstore.NewProjectAccessStore(db),
+		mappings: sqlstore.NewAuthGroupMappingStore(db),
+		global:   sqlstore.NewGlobalAccessStore(db),
+		project:  &database.Project{Slug: "handbook", Name: "Handbook", Visibility: database.VisibilityPrivate},
+	}
+	ctx := context.Background()
+	if err := sqlstore.NewProjectStore(db).Create(ctx, s.project); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.mappings.Create(ctx, &database.AuthGroupMapping{AuthSource: source, GroupIdentifier: group, ProjectID: s.project.ID, Role: "editor"}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// projectRole returns the role user has on the handbook project from
+// source, or "" for none.
+func (s *stores) projectRole(t *testing.T, user *database.User, source string) string {
+	t.Helper()
+	access, err := s.access.GetAccessBySource(context.Background(), s.project.ID, user.ID, source)
+	if err != nil || access == nil {
+		return ""
+	}
+	return access.Role
+}
@@ -0,0 +1,124 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/config"
+	"github.com/qwc/asiakirjat/internal/testutil"
+)
+
+// ldapConfig returns the configuration of the LDAP server, with
+// docs-editors as editors and docs-readers, and the groups nested in it,
+// as viewers.
+func ldapConfig() config.LDAPConfig {
+	return config.LDAPConfig{
+		Enabled:      true,
+		URL:          servers.ldapURL,
+		BindDN:       adminDN,
+		BindPassword: adminPassword,
+		// The base includes ou=partners, so searches get a referral
+		// along with the entries.
+		BaseDN:          baseDN,
+		UserFilter:      "(uid={{.Username}})",
+		EditorGroup:     groupDN("docs-editors"),
+		ViewerGroup:     groupDN("docs-readers"),
+		RecursiveGroups: true,
+	}
+}
+
+func newLDAPAuthenticator(t *testing.T, cfg config.LDAPConfig, s *stores) *auth.LDAPAuthenticator {
+	t.Helper()
+	if err := auth.ValidateLDAPConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	a := auth.NewLDAPAuthenticator(cfg, s.users, testutil.TestLogger())
+	a.SetStores(s.access, s.mappings, s.global)
+	return a
+}
+
+func TestLDAPLogin(t *testing.T) {
+	requireServers(t)
+	s := newStores(t, "ldap", groupDN("handbook-team"))
+	a := newLDAPAuthenticator(t, ldapConfig(), s)
+	ctx := context.Background()
+
+	for username, role := range map[string]string{"alice": "editor", "bob": "viewer"} {
+		user, err := a.Authenticate(ctx, username, username+"-secret")
+		if err != nil {
+			t.Fatalf("%s: %v", username, err)
+		}
+		if user.Role != role || user.Email != username+"@example.org" || user.AuthSource != "ldap" {
+			t.Errorf("%s: unexpected user %+v", username, user)
+		}
+	}
+
+	if _, err := a.Authenticate(ctx, "alice", "wrong"); err == nil {
+		t.Error("expected a wrong password to fail")
+	}
+	if _, err := a.Authenticate(ctx, "carol", "carol-secret"); err == nil {
+		t.Error("expected a user outside the allowed groups to be refused")
+	}
+	if _, err := a.Authenticate(ctx, "mallory", "mallory-secret"); err == nil {
+		t.Error("expected an unknown user to fail")
+	}
+
+	for username, want := range map[string]bool{"alice": true, "mallory": false} {
+		exists, err := a.UserExists(ctx, username)
+		if err != nil || exists != want {
+			t.Errorf("UserExists(%s): expected %v, got %v %v", username, want, exists, err)
+		}
+	}
+}
+
+func TestLDAPNestedGroups(t *testing.T) {
+	requireServers(t)
+	ctx := context.Background()
+
+	// alice is in docs-readers only through docs-editors
+	cfg := ldapConfig()
+	cfg.EditorGroup = ""
+	user, err := newLDAPAuthenticator(t, cfg, newStores(t, "ldap", groupDN("handbook-team"))).Authenticate(ctx, "alice", "alice-secret")
+	if err != nil {
+		t.Fatalf("expected the nested membership to allow alice: %v", err)
+	}
+	if user.Role != "viewer" {
+		t.Errorf("expected viewer, got %s", user.Role)
+	}
+
+	cfg.RecursiveGroups = false
+	if _, err := newLDAPAuthenticator(t, cfg, newStores(t, "ldap", groupDN("handbook-team"))).Authenticate(ctx, "alice", "alice-secret"); err == nil {
+		t.Error("expected alice to be refused without recursive groups")
+	}
+}
+
+func TestLDAPGroupSync(t *testing.T) {
+	requireServers(t)
+	s := newStores(t, "ldap", groupDN("handbook-team"))
+	a := newLDAPAuthenticator(t, ldapConfig(), s)
+	ctx := context.Background()
+
+	user, err := a.Authenticate(ctx, "alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role := s.projectRole(t, user, "ldap"); role != "editor" {
+		t.Fatalf("expected the handbook-team mapping to grant editor, got %q", role)
+	}
+
+	removeMember(t, groupDN("handbook-team"), userDN("alice"))
+	if _, err := a.Authenticate(ctx, "alice", "alice-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if role := s.projectRole(t, user, "ldap"); role != "" {
+		t.Errorf("expected the access to be revoked with the membership, got %q", role)
+	}
+
+	removeMember(t, groupDN("docs-editors"), userDN("alice"))
+	if _, err := a.Authenticate(ctx, "alice", "alice-secret"); err == nil {
+		t.Error("expected alice to be refused without any allowed group")
+	}
+}
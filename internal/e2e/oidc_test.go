@@ -0,0 +1,131 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/config"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/testutil"
+)
+
+func newOAuth2Authenticator(t *testing.T, s *stores) *auth.OAuth2Authenticator {
+	t.Helper()
+	cfg := config.OAuth2Config{
+		Enabled:      true,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AuthURL:      servers.issuer + "/auth",
+		TokenURL:     servers.issuer + "/token",
+		UserInfoURL:  servers.issuer + "/userinfo",
+		RedirectURL:  redirectURL,
+		Scopes:       "openid profile email groups",
+		GroupsClaim:  "groups",
+		ViewerGroup:  "docs-readers",
+	}
+	if err := auth.ValidateOAuth2Config(cfg); err != nil {
+		t.Fatal(err)
+	}
+	a := auth.NewOAuth2Authenticator(cfg, s.users, testutil.TestLogger())
+	a.SetStores(s.access, s.mappings, s.global)
+	return a
+}
+
+// oidcLogin logs in to dex with the LDAP connector's form, as a browser
+// sent there by the login page would, and hands the code dex redirects
+// back with to the authenticator.
+func oidcLogin(t *testing.T, a *auth.OAuth2Authenticator, username, password string) (*database.User, error) {
+	t.Helper()
+	authURL, err := a.GenerateAuthURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Host == "asiakirjat.test" {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+
+	// With a single connector, dex goes straight to its login form
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the login form, got %d", resp.StatusCode)
+	}
+	resp, err = client.PostForm(resp.Request.URL.String(), url.Values{"login": {username}, "password": {password}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		return nil, fmt.Errorf("dex did not redirect back (%d)", resp.StatusCode)
+	}
+	if !a.ValidateState(location.Query().Get("state")) {
+		t.Fatal("expected dex to return the state")
+	}
+	return a.HandleCallback(context.Background(), location.Query().Get("code"))
+}
+
+func TestOIDCLogin(t *testing.T) {
+	requireServers(t)
+	s := newStores(t, "oauth2", "handbook-team")
+	a := newOAuth2Authenticator(t, s)
+
+	user, err := oidcLogin(t, a, "dave", "dave-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "dave" || user.Email != "dave@example.org" || user.Role != "viewer" || user.AuthSource != "oauth2" {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	if _, err := oidcLogin(t, a, "dave", "wrong"); err == nil {
+		t.Error("expected a wrong password to fail")
+	}
+	if _, err := oidcLogin(t, a, "carol", "carol-secret"); err == nil {
+		t.Error("expected a user outside the allowed groups to be refused")
+	}
+}
+
+func TestOIDCGroupSync(t *testing.T) {
+	requireServers(t)
+	s := newStores(t, "oauth2", "handbook-team")
+	a := newOAuth2Authenticator(t, s)
+
+	user, err := oidcLogin(t, a, "dave", "dave-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role := s.projectRole(t, user, "oauth2"); role != "editor" {
+		t.Fatalf("expected the handbook-team mapping to grant editor, got %q", role)
+	}
+
+	removeMember(t, groupDN("handbook-team"), userDN("dave"))
+	if _, err := oidcLogin(t, a, "dave", "dave-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if role := s.projectRole(t, user, "oauth2"); role != "" {
+		t.Errorf("expected the access to be revoked with the membership, got %q", role)
+	}
+
+	removeMember(t, groupDN("docs-readers"), userDN("dave"))
+	if _, err := oidcLogin(t, a, "dave", "dave-secret"); err == nil {
+		t.Error("expected dave to be refused without any allowed group")
+	}
+}
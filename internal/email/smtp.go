@@ -0,0 +1,200 @@
+// Package email sends notification emails through an SMTP server.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Sender sends emails.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// How SMTPSender secures its connection to the server
+const (
+	TLSStartTLS = "starttls" // Upgrade with STARTTLS, refusing servers without it
+	TLSImplicit = "tls"      // Connect with TLS, usually to port 465
+	TLSNone     = "none"     // Plain text, for relays on the same host or network
+)
+
+const smtpDefaultTimeout = 30 * time.Second
+
+// SMTPSender sends each email over a new connection to an SMTP server, so
+// there is no connection state to manage.
+type SMTPSender struct {
+	host     string
+	addr     string
+	tlsMode  string
+	username string
+	password string
+	from     *mail.Address
+}
+
+// NewSMTPSender configures sending through the SMTP server at host. Port 0
+// is 465 with implicit TLS and 587 otherwise; an empty tlsMode is
+// STARTTLS. Without a username, emails are sent without authentication.
+func NewSMTPSender(host string, port int, tlsMode, username, password, from string) (*SMTPSender, error) {
+	if host == "" {
+		return nil, errors.New("SMTP host is empty")
+	}
+	if tlsMode == "" {
+		tlsMode = TLSStartTLS
+	}
+	switch tlsMode {
+	case TLSStartTLS, TLSNone:
+		if port == 0 {
+			port = 587
+		}
+	case TLSImplicit:
+		if port == 0 {
+			port = 465
+		}
+	default:
+		return nil, fmt.Errorf("invalid SMTP TLS mode %q: must be starttls, tls or none", tlsMode)
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", from, err)
+	}
+	return &SMTPSender{
+		host:     host,
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		tlsMode:  tlsMode,
+		username: username,
+		password: password,
+		from:     sender,
+	}, nil
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return errors.New("email has no recipients")
+	}
+	recipients := make([]*mail.Address, len(msg.To))
+	for i, to := range msg.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", to, err)
+		}
+		recipients[i] = addr
+	}
+	data, err := s.compose(recipients, msg)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: smtpDefaultTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("connecting to SMTP server: %w", err)
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpDefaultTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	if s.tlsMode == TLSImplicit {
+		conn = tls.Client(conn, &tls.Config{ServerName: s.host})
+	}
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return fmt.Errorf("greeting SMTP server: %w", err)
+	}
+	defer c.Close()
+
+	if s.tlsMode == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return fmt.Errorf("starting TLS: %w", err)
+		}
+	}
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("authenticating to SMTP server: %w", err)
+		}
+	}
+
+	if err := c.Mail(s.from.Address); err != nil {
+		return fmt.Errorf("sending sender: %w", err)
+	}
+	for _, to := range recipients {
+		if err := c.Rcpt(to.Address); err != nil {
+			return fmt.Errorf("sending recipient %s: %w", to.Address, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("starting message: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("sending message: %w", err)
+	}
+	return c.Quit()
+}
+
+// compose writes the headers and the quoted-printable body of msg.
+func (s *SMTPSender) compose(recipients []*mail.Address, msg Message) ([]byte, error) {
+	to := make([]string, len(recipients))
+	for i, addr := range recipients {
+		to[i] = addr.String()
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	domain := s.from.Address[strings.LastIndex(s.from.Address, "@")+1:]
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		// Values come from the configuration and from users; keep them on
+		// one line so they cannot add headers
+		value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", s.from.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	header("Auto-Submitted", "auto-generated")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	body := strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n")
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return nil, fmt.Errorf("encoding message: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, fmt.Errorf("encoding message: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,122 @@
+package email
+
+import (
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepts one connection and records the envelope and the
+// message. It offers no extensions, so no STARTTLS either.
+func fakeSMTP(t *testing.T) (int, <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	got := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 fake ESMTP")
+		var lines []string
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				got <- lines
+				return
+			}
+			cmd := strings.ToUpper(strings.Fields(line + " x")[0])
+			switch cmd {
+			case "EHLO":
+				tp.PrintfLine("250 fake")
+			case "MAIL", "RCPT":
+				lines = append(lines, line)
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, _ := io.ReadAll(tp.DotReader())
+				lines = append(lines, string(data))
+				tp.PrintfLine("250 OK")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				got <- lines
+				return
+			default:
+				tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, got
+}
+
+func TestSMTPSend(t *testing.T) {
+	port, got := fakeSMTP(t)
+	s, err := NewSMTPSender("127.0.0.1", port, TLSNone, "", "", "Docs <docs@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Send(context.Background(), Message{
+		To:      []string{"Ada <ada@example.com>", "bob@example.com"},
+		Subject: "Zugriff auf Guide\r\nBcc: eve@example.com",
+		Body:    "You can now read Guide.\nhttps://docs.example.com/project/guide",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := <-got
+	if len(lines) != 4 || lines[0] != "MAIL FROM:<docs@example.com>" || lines[1] != "RCPT TO:<ada@example.com>" || lines[2] != "RCPT TO:<bob@example.com>" {
+		t.Fatalf("unexpected envelope %q", lines)
+	}
+
+	header, body, _ := strings.Cut(lines[3], "\n\n")
+	for _, want := range []string{`From: "Docs" <docs@example.com>`, `To: "Ada" <ada@example.com>, <bob@example.com>`, "Content-Type: text/plain; charset=utf-8"} {
+		if !strings.Contains(header, want) {
+			t.Errorf("expected %q in the headers:\n%s", want, header)
+		}
+	}
+	if strings.Contains(header, "\nBcc:") {
+		t.Error("expected the subject to stay on one line")
+	}
+	decoded, _ := io.ReadAll(quotedprintable.NewReader(strings.NewReader(body)))
+	if !strings.Contains(string(decoded), "https://docs.example.com/project/guide") {
+		t.Errorf("unexpected body %q", decoded)
+	}
+}
+
+func TestSMTPRequiresStartTLS(t *testing.T) {
+	port, _ := fakeSMTP(t)
+	s, _ := NewSMTPSender("127.0.0.1", port, "", "", "", "docs@example.com")
+
+	err := s.Send(context.Background(), Message{To: []string{"ada@example.com"}, Subject: "Hi", Body: "Hi"})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("expected a server without STARTTLS to be refused, got %v", err)
+	}
+}
+
+func TestNewSMTPSender(t *testing.T) {
+	s, err := NewSMTPSender("smtp.example.com", 0, TLSImplicit, "", "", "docs@example.com")
+	if err != nil || s.addr != "smtp.example.com:465" {
+		t.Errorf("expected port 465 for implicit TLS, got %v, %v", s, err)
+	}
+	for _, args := range [][3]string{
+		{"", "", "docs@example.com"},
+		{"smtp.example.com", "ssl", "docs@example.com"},
+		{"smtp.example.com", "", "not an address"},
+	} {
+		if _, err := NewSMTPSender(args[0], 0, args[1], "", "", args[2]); err == nil {
+			t.Errorf("expected %q to be invalid", args)
+		}
+	}
+}
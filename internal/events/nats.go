@@ -0,0 +1,125 @@
+// Package events delivers entries of the event feed to message brokers.
+package events
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Publisher sends a message to a broker subject or topic.
+type Publisher interface {
+	Publish(ctx context.Context, subject string, data []byte) error
+}
+
+const natsDefaultTimeout = 10 * time.Second
+
+// NATSPublisher publishes messages using the NATS core text protocol. Each
+// Publish uses a short-lived connection and waits for the server to
+// acknowledge it with PONG, so there is no reconnect state to manage.
+type NATSPublisher struct {
+	addr     string
+	useTLS   bool
+	user     string
+	password string
+	token    string
+}
+
+// NewNATSPublisher parses a nats:// or tls:// URL. Credentials in the URL
+// are sent as user/password, or as an auth token if there is no password.
+func NewNATSPublisher(rawURL string) (*NATSPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing NATS URL: %w", err)
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("unsupported NATS URL scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("NATS URL has no host")
+	}
+	p := &NATSPublisher{addr: u.Host, useTLS: u.Scheme == "tls"}
+	if u.Port() == "" {
+		p.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil {
+		if pw, ok := u.User.Password(); ok {
+			p.user, p.password = u.User.Username(), pw
+		} else {
+			p.token = u.User.Username()
+		}
+	}
+	return p, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, subject string, data []byte) error {
+	if strings.ContainsAny(subject, " \t\r\n") {
+		return fmt.Errorf("invalid NATS subject %q", subject)
+	}
+
+	dialer := &net.Dialer{Timeout: natsDefaultTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return fmt.Errorf("connecting to NATS: %w", err)
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(natsDefaultTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("reading NATS greeting: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected NATS greeting %q", strings.TrimSpace(line))
+	}
+
+	// NATS sends INFO in plain text and upgrades to TLS afterwards
+	if p.useTLS {
+		host, _, _ := net.SplitHostPort(p.addr)
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+		r = bufio.NewReader(conn)
+	}
+
+	opts := map[string]any{"verbose": false, "pedantic": false, "name": "asiakirjat", "lang": "go"}
+	if p.user != "" {
+		opts["user"], opts["pass"] = p.user, p.password
+	}
+	if p.token != "" {
+		opts["auth_token"] = p.token
+	}
+	connect, _ := json.Marshal(opts)
+
+	msg := fmt.Sprintf("CONNECT %s\r\nPUB %s %d\r\n%s\r\nPING\r\n", connect, subject, len(data), data)
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		return fmt.Errorf("publishing to NATS: %w", err)
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("waiting for NATS acknowledgement: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeNATS accepts one connection, records the published subject and
+// payload, and replies to PING with reply.
+func fakeNATS(t *testing.T, reply string) (string, <-chan [2]string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	got := make(chan [2]string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+		r := bufio.NewReader(conn)
+		var subject, payload string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) == 3 && fields[0] == "PUB":
+				n, _ := strconv.Atoi(fields[2])
+				buf := make([]byte, n+2)
+				io.ReadFull(r, buf)
+				subject, payload = fields[1], string(buf[:n])
+			case len(fields) == 1 && fields[0] == "PING":
+				got <- [2]string{subject, payload}
+				conn.Write([]byte(reply + "\r\n"))
+				return
+			}
+		}
+	}()
+	return ln.Addr().String(), got
+}
+
+func TestNATSPublish(t *testing.T) {
+	addr, got := fakeNATS(t, "PONG")
+	p, err := NewNATSPublisher("nats://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Publish(context.Background(), "asiakirjat.version.published", []byte(`{"id":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-got
+	if msg[0] != "asiakirjat.version.published" || msg[1] != `{"id":1}` {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestNATSPublishServerError(t *testing.T) {
+	addr, _ := fakeNATS(t, "-ERR 'Authorization Violation'")
+	p, _ := NewNATSPublisher("nats://" + addr)
+
+	err := p.Publish(context.Background(), "asiakirjat.project.created", []byte("{}"))
+	if err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Errorf("expected server error, got %v", err)
+	}
+}
+
+func TestNewNATSPublisher(t *testing.T) {
+	p, err := NewNATSPublisher("nats://secret@nats.internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.addr != "nats.internal:4222" || p.token != "secret" {
+		t.Errorf("unexpected publisher %+v", p)
+	}
+	if _, err := NewNATSPublisher("kafka://broker:9092"); err == nil {
+		t.Error("expected error for unsupported scheme")
+	}
+}
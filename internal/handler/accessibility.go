@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// checkVersionAccessibility checks the pages of an uploaded version and
+// stores the report next to the version's attachments, so deleting or
+// re-uploading the version drops it.
+func (h *Handler) checkVersionAccessibility(ctx context.Context, slug, tag, storagePath string) {
+	report, err := docs.CheckAccessibility(ctx, storagePath)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "checking accessibility", "error", err, "project", slug, "version", tag)
+		return
+	}
+	if err := docs.WriteAccessibilityReport(h.storage.AttachmentPath(slug, tag), report); err != nil {
+		h.logger.ErrorContext(ctx, "storing accessibility report", "error", err, "project", slug, "version", tag)
+		return
+	}
+	if project, err := h.projects.GetBySlug(ctx, slug); err == nil {
+		h.invalidateVersions(project.ID)
+	}
+	h.logger.InfoContext(ctx, "accessibility check complete", "project", slug, "version", tag, "pages", report.Pages, "issues", report.Total())
+}
+
+// accessibilityReport returns the accessibility report of a version, or
+// nil if the version was not checked.
+func (h *Handler) accessibilityReport(ctx context.Context, slug, tag string) *docs.AccessibilityReport {
+	report, err := docs.ReadAccessibilityReport(h.storage.AttachmentPath(slug, tag))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			h.logger.ErrorContext(ctx, "reading accessibility report", "error", err, "project", slug, "version", tag)
+		}
+		return nil
+	}
+	return report
+}
+
+func (h *Handler) handleAccessibilityReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	tag := r.PathValue("tag")
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canViewProject(ctx, user, project) {
+		if user == nil {
+			h.redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var report *docs.AccessibilityReport
+	if _, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag); err == nil {
+		report = h.accessibilityReport(ctx, project.Slug, tag)
+	}
+	if report == nil {
+		http.Error(w, "No accessibility report for this version", http.StatusNotFound)
+		return
+	}
+
+	h.render(w, "version_accessibility", map[string]any{
+		"User":    user,
+		"Project": project,
+		"Version": tag,
+		"Report":  report,
+	})
+}
+
+func (h *Handler) handleAPIAccessibilityReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var report *docs.AccessibilityReport
+	if version, err := h.versions.GetByProjectAndTag(ctx, project.ID, r.PathValue("tag")); err == nil {
+		report = h.accessibilityReport(ctx, project.Slug, version.Tag)
+	}
+	if report == nil {
+		h.jsonError(w, "No accessibility report for this version", http.StatusNotFound)
+		return
+	}
+	h.jsonResponse(w, report)
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+func TestAccessibilityReport(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+	seedSEOVersion(t, app, project, admin, "2.0.0")
+
+	app.handler.checkVersionAccessibility(context.Background(), "guide", "1.0.0", app.handler.storage.VersionPath("guide", "1.0.0"))
+
+	detail := getBody(t, app.server.URL+"/project/guide")
+	if !strings.Contains(detail, "/project/guide/version/1.0.0/accessibility") || !strings.Contains(detail, "3 a11y issues") {
+		t.Error("expected the project page to link the accessibility report")
+	}
+	if strings.Contains(detail, "/project/guide/version/2.0.0/accessibility") {
+		t.Error("expected no report link for an unchecked version")
+	}
+
+	page := getBody(t, app.server.URL+"/project/guide/version/1.0.0/accessibility")
+	for _, want := range []string{"2 pages checked", "guide/intro.html", "document-title", "html-lang"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected the report page to contain %q", want)
+		}
+	}
+
+	resp, err := http.Get(app.server.URL + "/api/project/guide/version/1.0.0/accessibility")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report docs.AccessibilityReport
+	json.NewDecoder(resp.Body).Decode(&report)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || report.Pages != 2 || report.Total() != 3 {
+		t.Errorf("unexpected API report (%d): %+v", resp.StatusCode, report)
+	}
+
+	for _, path := range []string{"/project/guide/version/2.0.0/accessibility", "/api/project/guide/version/9.9.9/accessibility"} {
+		resp, err := http.Get(app.server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: expected 404, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestOverlayAccessibility(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+
+	page := getBody(t, app.server.URL+"/project/guide/1.0.0/guide/intro.html")
+	for _, want := range []string{
+		`id="asiakirjat-skip-link"`,
+		`role="combobox"`,
+		`<label class="ao-label" for="asiakirjat-version-select">`,
+		`aria-label="Download version 1.0.0 as ZIP"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected the overlay to contain %s", want)
+		}
+	}
+}
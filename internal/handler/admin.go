@@ -1,12 +1,18 @@
 package handler
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/qwc/asiakirjat/internal/auth"
 	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
 	"github.com/qwc/asiakirjat/internal/docs/builtin"
 )
 
@@ -18,7 +24,7 @@ func (h *Handler) handleAdminProjects(w http.ResponseWriter, r *http.Request) {
 
 	allProjects, err := h.projects.List(ctx)
 	if err != nil {
-		h.logger.Error("listing projects", "error", err)
+		h.logger.ErrorContext(ctx, "listing projects", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -31,12 +37,40 @@ func (h *Handler) handleAdminProjects(w http.ResponseWriter, r *http.Request) {
 		projects = h.filterAccessibleProjects(ctx, user, allProjects)
 	}
 
+	usage, err := h.versions.UsageByProject(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "getting storage usage", "error", err)
+	}
+	projectUsage := make(map[int64]storageUsage, len(projects))
+	for i := range projects {
+		projectUsage[projects[i].ID] = storageUsage{Used: usage[projects[i].ID], Quota: h.projectQuota(&projects[i])}
+	}
+	total := storageUsage{Quota: h.config.Storage.QuotaBytes()}
+	for _, n := range usage {
+		total.Used += n
+	}
+
+	reindex := h.reindex.get()
 	data := map[string]any{
 		"User":            user,
 		"IsAdmin":         isAdmin,
 		"Projects":        projects,
-		"ReindexRunning":  h.reindexRunning,
-		"ReindexProgress": h.reindexProgress,
+		"Usage":           projectUsage,
+		"TotalUsage":      total,
+		"ReindexRunning":  reindex.Running,
+		"ReindexProgress": reindex.Progress(),
+	}
+	// A rebuild that failed, or was interrupted and not resumed yet
+	if !reindex.Running && h.searchIndex != nil && h.searchIndex.Incomplete() {
+		data["ReindexIncomplete"] = true
+	}
+	if !reindex.Running && reindex.FinishedAt != nil {
+		data["LastReindex"] = reindex
+	}
+	// Analysis settings changed since the index was built
+	if !reindex.Running && h.searchIndex != nil && h.searchIndex.Outdated() {
+		data["ReindexOutdated"] = true
+		data["AnalysisChange"] = h.searchIndex.AnalysisChange()
 	}
 
 	// Check for flash message from query parameter
@@ -68,7 +102,7 @@ func (h *Handler) handleAdminCreateProject(w http.ResponseWriter, r *http.Reques
 	name := r.FormValue("name")
 	description := r.FormValue("description")
 	visibility := r.FormValue("visibility")
-	if visibility != database.VisibilityPublic && visibility != database.VisibilityPrivate && visibility != database.VisibilityCustom {
+	if !validVisibility(visibility) {
 		visibility = database.VisibilityPrivate
 	}
 
@@ -89,13 +123,13 @@ func (h *Handler) handleAdminCreateProject(w http.ResponseWriter, r *http.Reques
 	}
 
 	if err := h.projects.Create(ctx, project); err != nil {
-		h.logger.Error("creating project", "error", err)
+		h.logger.ErrorContext(ctx, "creating project", "error", err)
 		http.Error(w, "Failed to create project: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	if err := h.storage.EnsureProjectDir(slug); err != nil {
-		h.logger.Error("creating project directory", "error", err)
+		h.logger.ErrorContext(ctx, "creating project directory", "error", err)
 	}
 
 	// Auto-grant editor access to the creator for non-public projects
@@ -107,10 +141,12 @@ func (h *Handler) handleAdminCreateProject(w http.ResponseWriter, r *http.Reques
 			Role:      "editor",
 		}
 		if err := h.access.Grant(ctx, access); err != nil {
-			h.logger.Error("auto-granting creator access", "error", err)
+			h.logger.ErrorContext(ctx, "auto-granting creator access", "error", err)
 		}
 	}
 
+	h.emitEvent(ctx, database.EventProjectCreated, slug, projectEventData(project, creator))
+
 	h.redirect(w, r, "/admin/projects", http.StatusSeeOther)
 }
 
@@ -157,6 +193,14 @@ func (h *Handler) handleAdminEditProject(w http.ResponseWriter, r *http.Request)
 		globalRetentionLabel = strconv.Itoa(globalDefault) + " days"
 	}
 
+	metadata, _ := h.metadata.GetProject(ctx, project.ID)
+	tags, _ := h.tags.Get(ctx, project.ID)
+	translations, _ := h.translations.Get(ctx, project.ID)
+	usage, err := h.projectUsage(ctx, project)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "getting storage usage", "error", err)
+	}
+
 	h.render(w, "admin_project_edit", map[string]any{
 		"User":                  user,
 		"Project":               project,
@@ -164,6 +208,15 @@ func (h *Handler) handleAdminEditProject(w http.ResponseWriter, r *http.Request)
 		"Users":                 users,
 		"RetentionDisplay":      retentionDisplay,
 		"GlobalRetentionDefault": globalRetentionLabel,
+		"Metadata":              formatMetadataText(metadata),
+		"Tags":                  strings.Join(tags, ", "),
+		"Translations":          translations,
+		"FeatureFlags":          h.featureFlagViews(ctx, project),
+		"StorageQuota":          sizeInput(project.StorageQuota),
+		"MaxUploadSize":         sizeInput(project.MaxUploadSize),
+		"DefaultStorageQuota":   storageUsage{Quota: h.config.Storage.ProjectQuotaBytes()}.QuotaText(),
+		"DefaultMaxUploadSize":  docs.FormatSize(h.config.Upload.MaxSizeBytes()),
+		"StorageUsage":          usage,
 	})
 }
 
@@ -181,7 +234,7 @@ func (h *Handler) handleAdminUpdateProject(w http.ResponseWriter, r *http.Reques
 	project.Name = r.FormValue("name")
 	project.Description = r.FormValue("description")
 	visibility := r.FormValue("visibility")
-	if visibility != database.VisibilityPublic && visibility != database.VisibilityPrivate && visibility != database.VisibilityCustom {
+	if !validVisibility(visibility) {
 		visibility = database.VisibilityCustom
 	}
 	project.Visibility = visibility
@@ -195,12 +248,150 @@ func (h *Handler) handleAdminUpdateProject(w http.ResponseWriter, r *http.Reques
 		project.RetentionDays = nil
 	}
 
+	signingKeys := strings.TrimSpace(r.FormValue("signing_keys"))
+	if _, err := docs.ParsePublicKeys(signingKeys); err != nil {
+		http.Error(w, "Invalid signing keys: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	project.SigningKeys = signingKeys
+	project.RequireSignature = r.FormValue("require_signature") == "true"
+	project.VersionPattern = strings.TrimSpace(r.FormValue("version_pattern"))
+	if err := validateVersionPattern(project.VersionPattern); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	project.VersionSemverOnly = r.FormValue("version_semver_only") == "true"
+	project.NormalizeVersions = r.FormValue("normalize_versions") == "true"
+	project.ImmutableVersions = r.FormValue("immutable_versions") == "true"
+	project.LandingPath = strings.TrimSpace(r.FormValue("landing_path"))
+	if err := validateLandingPath(project.LandingPath); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	project.DetectLanding = r.FormValue("detect_landing") == "true"
+	project.SanitizeHTML = r.FormValue("sanitize_html") == "true"
+	if project.StorageQuota, err = parseOptionalSize(r.FormValue("storage_quota")); err != nil {
+		http.Error(w, "Invalid storage quota: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if project.MaxUploadSize, err = parseOptionalSize(r.FormValue("max_upload_size")); err != nil {
+		http.Error(w, "Invalid upload limit: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	project.HideFromSitemap = r.FormValue("hide_from_sitemap") == "true"
+	project.IndexOldVersions = r.FormValue("index_old_versions") == "true"
+
+	previousLifecycle := project.Lifecycle
+	project.LifecycleMessage = strings.TrimSpace(r.FormValue("lifecycle_message"))
+	project.Lifecycle, err = validateLifecycle(r.FormValue("lifecycle"), project.LifecycleMessage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	project.Owner = strings.TrimSpace(r.FormValue("owner"))
+	project.OwnerTeam = strings.TrimSpace(r.FormValue("owner_team"))
+	project.OwnerContact = strings.TrimSpace(r.FormValue("owner_contact"))
+	if err := validateOwnerContact(project.OwnerContact); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	project.FeedbackMode = r.FormValue("feedback_mode")
+	project.FeedbackURL = strings.TrimSpace(r.FormValue("feedback_url"))
+	if err := validateFeedbackSettings(project.FeedbackMode, project.FeedbackURL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	project.OverlayInclude = strings.TrimSpace(r.FormValue("overlay_include"))
+	project.OverlayExclude = strings.TrimSpace(r.FormValue("overlay_exclude"))
+	for _, paths := range []string{project.OverlayInclude, project.OverlayExclude} {
+		if err := validateOverlayPaths(paths); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	project.OverlayPosition = r.FormValue("overlay_position")
+	project.OverlayTheme = r.FormValue("overlay_theme")
+	project.OverlayColor = strings.TrimSpace(r.FormValue("overlay_color"))
+	project.OverlayVisibility = r.FormValue("overlay_visibility")
+	if err := validateOverlayStyle(project.OverlayPosition, project.OverlayTheme, project.OverlayColor, project.OverlayVisibility); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := parseMetadataText(r.FormValue("metadata"))
+	if err != nil {
+		http.Error(w, "Invalid metadata: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tags, err := parseTagText(r.FormValue("tags"))
+	if err != nil {
+		http.Error(w, "Invalid tags: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	translations, err := parseTranslationForm(r)
+	if err != nil {
+		http.Error(w, "Invalid translations: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if err := h.projects.Update(ctx, project); err != nil {
-		h.logger.Error("updating project", "error", err)
+		h.logger.ErrorContext(ctx, "updating project", "error", err)
 		http.Error(w, "Failed to update project", http.StatusInternalServerError)
 		return
 	}
 
+	if err := h.checkOwner(ctx, project, auth.UserFromContext(ctx).Username); err != nil {
+		h.logger.ErrorContext(ctx, "checking project owner", "error", err, "project", project.Slug)
+	}
+
+	if previousLifecycle != project.Lifecycle {
+		h.recordLifecycleChange(ctx, project, "", previousLifecycle, project.Lifecycle, project.LifecycleMessage, auth.UserFromContext(ctx))
+	}
+
+	current, err := h.metadata.GetProject(ctx, project.ID)
+	if err == nil && !maps.Equal(current, metadata) {
+		if err := h.metadata.SetProject(ctx, project.ID, metadata); err != nil {
+			h.logger.ErrorContext(ctx, "setting project metadata", "error", err)
+			http.Error(w, "Failed to update project metadata", http.StatusInternalServerError)
+			return
+		}
+		h.reindexProjectMetadata(project)
+	}
+
+	if current, err := h.tags.Get(ctx, project.ID); err == nil && !slices.Equal(current, tags) {
+		if err := h.tags.Set(ctx, project.ID, tags); err != nil {
+			h.logger.ErrorContext(ctx, "setting project tags", "error", err)
+			http.Error(w, "Failed to update project tags", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if current, err := h.translations.Get(ctx, project.ID); err == nil && !translationsEqual(current, translations) {
+		if err := h.translations.Set(ctx, project.ID, translations); err != nil {
+			h.logger.ErrorContext(ctx, "setting project translations", "error", err)
+			http.Error(w, "Failed to update project translations", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	for _, f := range h.featureFlagViews(ctx, project) {
+		state, ok := r.Form["feature_"+f.Name]
+		if !ok || state[0] == f.Override {
+			continue
+		}
+		if err := h.setFeatureFlag(ctx, project.ID, f.Name, state[0]); err != nil {
+			h.logger.ErrorContext(ctx, "setting project feature flag", "error", err, "flag", f.Name)
+			http.Error(w, "Failed to update project feature flags", http.StatusInternalServerError)
+			return
+		}
+		h.audit(ctx, "feature.set", auth.UserFromContext(ctx).Username, project.Slug+": "+f.Name+": "+cmp.Or(state[0], "default"))
+	}
+
+	h.emitEvent(ctx, database.EventProjectUpdated, project.Slug, projectEventData(project, auth.UserFromContext(ctx)))
+
 	h.redirect(w, r, "/admin/projects", http.StatusSeeOther)
 }
 
@@ -214,28 +405,39 @@ func (h *Handler) handleAdminDeleteProject(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if err := h.deleteProject(ctx, project, auth.UserFromContext(ctx)); err != nil {
+		h.logger.ErrorContext(ctx, "deleting project", "error", err)
+		http.Error(w, "Failed to delete project", http.StatusInternalServerError)
+		return
+	}
+
+	h.redirect(w, r, "/admin/projects", http.StatusSeeOther)
+}
+
+// deleteProject deletes a project with its versions and their search
+// index entries.
+func (h *Handler) deleteProject(ctx context.Context, project *database.Project, user *database.User) error {
 	// Delete search index entries for all versions before deleting project
 	if h.searchIndex != nil {
 		versions, err := h.versions.ListByProject(ctx, project.ID)
 		if err == nil {
 			for _, v := range versions {
 				if err := h.searchIndex.DeleteVersion(project.ID, v.ID); err != nil {
-					h.logger.Error("deleting version from search index", "error", err, "project", slug, "version", v.Tag)
+					h.logger.ErrorContext(ctx, "deleting version from search index", "error", err, "project", project.Slug, "version", v.Tag)
 				}
 			}
 		}
 	}
 
 	if err := h.projects.Delete(ctx, project.ID); err != nil {
-		h.logger.Error("deleting project", "error", err)
-		http.Error(w, "Failed to delete project", http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	// Invalidate latest tags cache
-	h.invalidateLatestTagsCache()
+	h.emitEvent(ctx, database.EventProjectDeleted, project.Slug, map[string]any{"actor": eventActor(user)})
 
-	h.redirect(w, r, "/admin/projects", http.StatusSeeOther)
+	// Invalidate cached versions
+	h.invalidateVersions(project.ID)
+	return nil
 }
 
 func (h *Handler) handleAdminGrantAccess(w http.ResponseWriter, r *http.Request) {
@@ -266,11 +468,13 @@ func (h *Handler) handleAdminGrantAccess(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := h.access.Grant(ctx, access); err != nil {
-		h.logger.Error("granting access", "error", err)
+		h.logger.ErrorContext(ctx, "granting access", "error", err)
 		http.Error(w, "Failed to grant access", http.StatusInternalServerError)
 		return
 	}
 
+	h.emitAccessEvent(ctx, database.EventAccessGranted, project, auth.UserFromContext(ctx), userID, role)
+
 	h.redirect(w, r, fmt.Sprintf("/admin/projects/%s/edit", slug), http.StatusSeeOther)
 }
 
@@ -291,11 +495,13 @@ func (h *Handler) handleAdminRevokeAccess(w http.ResponseWriter, r *http.Request
 	}
 
 	if err := h.access.Revoke(ctx, project.ID, userID); err != nil {
-		h.logger.Error("revoking access", "error", err)
+		h.logger.ErrorContext(ctx, "revoking access", "error", err)
 		http.Error(w, "Failed to revoke access", http.StatusInternalServerError)
 		return
 	}
 
+	h.emitAccessEvent(ctx, database.EventAccessRevoked, project, auth.UserFromContext(ctx), userID, "")
+
 	h.redirect(w, r, fmt.Sprintf("/admin/projects/%s/edit", slug), http.StatusSeeOther)
 }
 
@@ -305,7 +511,7 @@ func (h *Handler) handleAdminUsers(w http.ResponseWriter, r *http.Request) {
 
 	users, err := h.users.List(ctx)
 	if err != nil {
-		h.logger.Error("listing users", "error", err)
+		h.logger.ErrorContext(ctx, "listing users", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -335,7 +541,7 @@ func (h *Handler) handleAdminCreateUser(w http.ResponseWriter, r *http.Request)
 
 	hash, err := auth.HashPassword(password)
 	if err != nil {
-		h.logger.Error("hashing password", "error", err)
+		h.logger.ErrorContext(ctx, "hashing password", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -349,7 +555,7 @@ func (h *Handler) handleAdminCreateUser(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := h.users.Create(ctx, user); err != nil {
-		h.logger.Error("creating user", "error", err)
+		h.logger.ErrorContext(ctx, "creating user", "error", err)
 		http.Error(w, "Failed to create user: "+err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -367,7 +573,7 @@ func (h *Handler) handleAdminDeleteUser(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := h.users.Delete(ctx, id); err != nil {
-		h.logger.Error("deleting user", "error", err)
+		h.logger.ErrorContext(ctx, "deleting user", "error", err)
 		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
 		return
 	}
@@ -398,7 +604,7 @@ func (h *Handler) handleAdminUpdateUserRole(w http.ResponseWriter, r *http.Reque
 
 	user.Role = role
 	if err := h.users.Update(ctx, user); err != nil {
-		h.logger.Error("updating user role", "error", err)
+		h.logger.ErrorContext(ctx, "updating user role", "error", err)
 		http.Error(w, "Failed to update role", http.StatusInternalServerError)
 		return
 	}
@@ -412,14 +618,14 @@ func (h *Handler) handleAdminRobots(w http.ResponseWriter, r *http.Request) {
 
 	robots, err := h.users.ListRobots(ctx)
 	if err != nil {
-		h.logger.Error("listing robots", "error", err)
+		h.logger.ErrorContext(ctx, "listing robots", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	projects, err := h.projects.List(ctx)
 	if err != nil {
-		h.logger.Error("listing projects", "error", err)
+		h.logger.ErrorContext(ctx, "listing projects", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -463,6 +669,7 @@ func (h *Handler) handleAdminRobots(w http.ResponseWriter, r *http.Request) {
 		"User":     user,
 		"Robots":   robotViews,
 		"Projects": projects,
+		"Scopes":   auth.AllScopes,
 	})
 }
 
@@ -483,7 +690,7 @@ func (h *Handler) handleAdminCreateRobot(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := h.users.Create(ctx, user); err != nil {
-		h.logger.Error("creating robot", "error", err)
+		h.logger.ErrorContext(ctx, "creating robot", "error", err)
 		http.Error(w, "Failed to create robot: "+err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -517,10 +724,16 @@ func (h *Handler) handleAdminGenerateToken(w http.ResponseWriter, r *http.Reques
 		projectID = &pid
 	}
 
+	scopes, err := tokenScopesFromForm(r)
+	if err != nil {
+		http.Error(w, "Invalid scopes: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Generate raw token
 	rawToken, err := auth.GenerateToken(32)
 	if err != nil {
-		h.logger.Error("generating token", "error", err)
+		h.logger.ErrorContext(ctx, "generating token", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -532,11 +745,11 @@ func (h *Handler) handleAdminGenerateToken(w http.ResponseWriter, r *http.Reques
 		ProjectID: projectID,
 		TokenHash: tokenHash,
 		Name:      name,
-		Scopes:    "upload",
+		Scopes:    scopes,
 	}
 
 	if err := h.tokens.Create(ctx, token); err != nil {
-		h.logger.Error("creating token", "error", err)
+		h.logger.ErrorContext(ctx, "creating token", "error", err)
 		http.Error(w, "Failed to create token", http.StatusInternalServerError)
 		return
 	}
@@ -584,10 +797,24 @@ func (h *Handler) handleAdminGenerateToken(w http.ResponseWriter, r *http.Reques
 		"User":     user,
 		"Robots":   robotViews,
 		"Projects": projects,
+		"Scopes":   auth.AllScopes,
 		"NewToken": rawToken,
 	})
 }
 
+// tokenScopesFromForm returns the normalized scopes selected in a token form.
+// Tokens default to the upload scope when nothing is selected.
+func tokenScopesFromForm(r *http.Request) (string, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", err
+	}
+	selected := r.Form["scopes"]
+	if len(selected) == 0 {
+		return auth.ScopeUpload, nil
+	}
+	return auth.NormalizeScopes(selected)
+}
+
 func (h *Handler) handleAdminRevokeToken(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -598,7 +825,7 @@ func (h *Handler) handleAdminRevokeToken(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := h.tokens.Delete(ctx, tokenID); err != nil {
-		h.logger.Error("revoking token", "error", err)
+		h.logger.ErrorContext(ctx, "revoking token", "error", err)
 		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
 		return
 	}
@@ -634,14 +861,14 @@ func (h *Handler) handleAdminResetPassword(w http.ResponseWriter, r *http.Reques
 
 	hash, err := auth.HashPassword(newPassword)
 	if err != nil {
-		h.logger.Error("hashing password", "error", err)
+		h.logger.ErrorContext(ctx, "hashing password", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	user.Password = &hash
 	if err := h.users.Update(ctx, user); err != nil {
-		h.logger.Error("updating user password", "error", err)
+		h.logger.ErrorContext(ctx, "updating user password", "error", err)
 		http.Error(w, "Failed to update password", http.StatusInternalServerError)
 		return
 	}
@@ -659,7 +886,7 @@ func (h *Handler) handleAdminDeleteRobot(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := h.users.Delete(ctx, id); err != nil {
-		h.logger.Error("deleting robot", "error", err)
+		h.logger.ErrorContext(ctx, "deleting robot", "error", err)
 		http.Error(w, "Failed to delete robot", http.StatusInternalServerError)
 		return
 	}
@@ -700,7 +927,7 @@ func (h *Handler) handleAdminGroups(w http.ResponseWriter, r *http.Request) {
 	// Get all group mappings
 	mappings, err := h.groupMappings.List(ctx)
 	if err != nil {
-		h.logger.Error("listing group mappings", "error", err)
+		h.logger.ErrorContext(ctx, "listing group mappings", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -708,7 +935,7 @@ func (h *Handler) handleAdminGroups(w http.ResponseWriter, r *http.Request) {
 	// Get all projects for the dropdown and for mapping display
 	projects, err := h.projects.List(ctx)
 	if err != nil {
-		h.logger.Error("listing projects", "error", err)
+		h.logger.ErrorContext(ctx, "listing projects", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -753,6 +980,7 @@ func (h *Handler) handleAdminGroups(w http.ResponseWriter, r *http.Request) {
 		"User":     user,
 		"Mappings": grouped,
 		"Projects": projects,
+		"LDAPSync": h.ldapAuth != nil && h.scheduler != nil,
 	}
 
 	// Check for flash message from query parameter
@@ -767,6 +995,16 @@ func (h *Handler) handleAdminGroups(w http.ResponseWriter, r *http.Request) {
 			Type:    "success",
 			Message: "Group mapping deleted successfully",
 		}
+	case "ldap_sync_started":
+		data["Flash"] = &Flash{
+			Type:    "success",
+			Message: "LDAP sync started. Its result is shown under Admin > Maintenance.",
+		}
+	case "ldap_sync_running":
+		data["Flash"] = &Flash{
+			Type:    "warning",
+			Message: "LDAP sync is already running.",
+		}
 	case "error":
 		data["Flash"] = &Flash{
 			Type:    "error",
@@ -785,7 +1023,7 @@ func (h *Handler) handleAdminCreateGroupMapping(w http.ResponseWriter, r *http.R
 	projectIDs := r.Form["project_ids[]"] // Multiple project IDs
 	role := r.FormValue("role")
 
-	if authSource != "ldap" && authSource != "oauth2" {
+	if !isGroupMappingSource(authSource) {
 		h.redirect(w, r, "/admin/groups?msg=error&error=Invalid+auth+source", http.StatusSeeOther)
 		return
 	}
@@ -822,7 +1060,7 @@ func (h *Handler) handleAdminCreateGroupMapping(w http.ResponseWriter, r *http.R
 
 		if err := h.groupMappings.Create(ctx, mapping); err != nil {
 			// Log but continue - might be duplicate
-			h.logger.Warn("creating group mapping", "error", err, "project_id", projectID)
+			h.logger.WarnContext(ctx, "creating group mapping", "error", err, "project_id", projectID)
 			continue
 		}
 		created++
@@ -833,6 +1071,9 @@ func (h *Handler) handleAdminCreateGroupMapping(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if authSource == scimSource {
+		h.syncSCIMMembers(ctx)
+	}
 	h.redirect(w, r, "/admin/groups?msg=created", http.StatusSeeOther)
 }
 
@@ -858,11 +1099,14 @@ func (h *Handler) handleAdminDeleteGroupMapping(w http.ResponseWriter, r *http.R
 	}
 
 	if err := h.groupMappings.Delete(ctx, id); err != nil {
-		h.logger.Error("deleting group mapping", "error", err)
+		h.logger.ErrorContext(ctx, "deleting group mapping", "error", err)
 		h.redirect(w, r, "/admin/groups?msg=error&error=Failed+to+delete+mapping", http.StatusSeeOther)
 		return
 	}
 
+	if mapping.AuthSource == scimSource {
+		h.syncSCIMMembers(ctx)
+	}
 	h.redirect(w, r, "/admin/groups?msg=deleted", http.StatusSeeOther)
 }
 
@@ -872,7 +1116,7 @@ func (h *Handler) handleAdminGlobalAccess(w http.ResponseWriter, r *http.Request
 
 	rules, err := h.globalAccess.ListRules(ctx)
 	if err != nil {
-		h.logger.Error("listing global access rules", "error", err)
+		h.logger.ErrorContext(ctx, "listing global access rules", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -910,7 +1154,7 @@ func (h *Handler) handleAdminCreateGlobalAccessRule(w http.ResponseWriter, r *ht
 	subjectIdentifier := r.FormValue("subject_identifier")
 	role := r.FormValue("role")
 
-	if subjectType != "user" && subjectType != "ldap_group" && subjectType != "oauth2_group" {
+	if subjectType != "user" && subjectType != "ldap_group" && subjectType != "oauth2_group" && subjectType != "proxy_group" && subjectType != "scim_group" {
 		h.redirect(w, r, "/admin/global-access?msg=error&error=Invalid+subject+type", http.StatusSeeOther)
 		return
 	}
@@ -932,11 +1176,14 @@ func (h *Handler) handleAdminCreateGlobalAccessRule(w http.ResponseWriter, r *ht
 	}
 
 	if err := h.globalAccess.CreateRule(ctx, rule); err != nil {
-		h.logger.Error("creating global access rule", "error", err)
+		h.logger.ErrorContext(ctx, "creating global access rule", "error", err)
 		h.redirect(w, r, "/admin/global-access?msg=error&error=Failed+to+create+rule", http.StatusSeeOther)
 		return
 	}
 
+	if subjectType == scimGroupSubject {
+		h.syncSCIMMembers(ctx)
+	}
 	h.redirect(w, r, "/admin/global-access?msg=created", http.StatusSeeOther)
 }
 
@@ -950,11 +1197,12 @@ func (h *Handler) handleAdminDeleteGlobalAccessRule(w http.ResponseWriter, r *ht
 	}
 
 	if err := h.globalAccess.DeleteRule(ctx, id); err != nil {
-		h.logger.Error("deleting global access rule", "error", err)
+		h.logger.ErrorContext(ctx, "deleting global access rule", "error", err)
 		h.redirect(w, r, "/admin/global-access?msg=error&error=Failed+to+delete+rule", http.StatusSeeOther)
 		return
 	}
 
+	h.syncSCIMMembers(ctx)
 	h.redirect(w, r, "/admin/global-access?msg=deleted", http.StatusSeeOther)
 }
 
@@ -972,11 +1220,11 @@ func (h *Handler) handleAdminDeployBuiltinDocs(w http.ResponseWriter, r *http.Re
 	}
 
 	if err := deployer.Deploy(ctx, user.ID); err != nil {
-		h.logger.Error("deploying builtin docs", "error", err)
+		h.logger.ErrorContext(ctx, "deploying builtin docs", "error", err)
 		http.Error(w, "Failed to deploy documentation: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	h.invalidateLatestTagsCache()
+	h.invalidateAllVersions()
 	h.redirect(w, r, "/admin/projects?msg=docs_deployed", http.StatusSeeOther)
 }
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+const (
+	analyticsListLimit   = 25
+	analyticsDefaultDays = 30
+	analyticsMaxDays     = 365
+)
+
+// analyticsReport is the view analytics of a project over a period.
+type analyticsReport struct {
+	Days          int            `json:"days"`
+	Since         time.Time      `json:"since"`
+	SamplePercent int            `json:"sample_percent"`
+	TopPages      []pageCount    `json:"top_pages"`
+	NotFound      []pageCount    `json:"not_found"`
+	Versions      []versionCount `json:"versions"`
+}
+
+// pageCount is the number of hits of a path; top pages count the path
+// across versions and leave out the version.
+type pageCount struct {
+	Version string `json:"version,omitempty"`
+	Path    string `json:"path"`
+	Hits    int    `json:"hits"`
+	Readers int    `json:"readers"`
+}
+
+type versionCount struct {
+	Version string `json:"version"`
+	Hits    int    `json:"hits"`
+	Readers int    `json:"readers"`
+}
+
+// analyticsEnabled reports whether page hits are recorded.
+func (h *Handler) analyticsEnabled() bool {
+	return h.config.Analytics.Enabled && h.analytics != nil
+}
+
+// recordPageHit records a sample of the requests for documentation pages
+// and of the requests that found no file, in the background. Other files,
+// such as stylesheets and images, are only recorded when they are missing.
+func (h *Handler) recordPageHit(r *http.Request, user *database.User, project *database.Project, ver *database.Version, filePath string, page bool, status int) {
+	if r.Method != http.MethodGet {
+		return
+	}
+	ok := status == http.StatusOK || status == http.StatusNotModified
+	if !(ok && page) && status != http.StatusNotFound {
+		return
+	}
+	if rand.IntN(100) >= h.config.Analytics.Sample() {
+		return
+	}
+
+	// index.html redirects to its directory; count the page once.
+	if path.Base(filePath) == "index.html" {
+		filePath = strings.TrimSuffix(filePath, "index.html")
+	}
+
+	hit := &database.PageHit{ProjectID: project.ID, Version: ver.Tag, Path: filePath, Status: status}
+	if user != nil {
+		hit.UserID = &user.ID
+	}
+	h.goJob(r.Context(), func(ctx context.Context) {
+		if err := h.analytics.Record(ctx, hit); err != nil {
+			h.logger.ErrorContext(ctx, "recording page hit", "error", err)
+		}
+	})
+}
+
+// projectAnalytics collects the analytics of a project for the last days.
+func (h *Handler) projectAnalytics(ctx context.Context, project *database.Project, days int) (*analyticsReport, error) {
+	since := time.Now().AddDate(0, 0, -days)
+	report := &analyticsReport{Days: days, Since: since, SamplePercent: h.config.Analytics.Sample()}
+
+	top, err := h.analytics.TopPages(ctx, project.ID, since, analyticsListLimit)
+	if err != nil {
+		return nil, err
+	}
+	missing, err := h.analytics.NotFound(ctx, project.ID, since, analyticsListLimit)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := h.analytics.Versions(ctx, project.ID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	report.TopPages = pageCounts(top)
+	report.NotFound = pageCounts(missing)
+	report.Versions = make([]versionCount, 0, len(versions))
+	for _, c := range versions {
+		report.Versions = append(report.Versions, versionCount{Version: c.Version, Hits: c.Hits, Readers: c.Readers})
+	}
+	return report, nil
+}
+
+func pageCounts(counts []database.HitCount) []pageCount {
+	pages := make([]pageCount, 0, len(counts))
+	for _, c := range counts {
+		pages = append(pages, pageCount{Version: c.Version, Path: c.Path, Hits: c.Hits, Readers: c.Readers})
+	}
+	return pages
+}
+
+// analyticsDays reads the period of a report from the days query parameter.
+func analyticsDays(r *http.Request) int {
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days <= 0 {
+		return analyticsDefaultDays
+	}
+	return min(days, analyticsMaxDays)
+}
+
+// runAnalyticsPrune deletes the page hits older than the retention period.
+func (h *Handler) runAnalyticsPrune(ctx context.Context) error {
+	days := h.config.Analytics.RetentionDays
+	if h.analytics == nil || days <= 0 {
+		return nil
+	}
+	deleted, err := h.analytics.DeleteBefore(ctx, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		h.logger.InfoContext(ctx, "pruned page hits", "deleted", deleted)
+	}
+	return nil
+}
+
+// handleProjectAnalytics shows the view analytics of a project to its
+// editors.
+func (h *Handler) handleProjectAnalytics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canUpload(ctx, user, project) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	data := map[string]any{
+		"User":    user,
+		"Project": project,
+		"Enabled": h.analyticsEnabled(),
+		"Periods": []int{7, 30, 90},
+	}
+	if h.analytics != nil {
+		report, err := h.projectAnalytics(ctx, project, analyticsDays(r))
+		if err != nil {
+			h.logger.ErrorContext(ctx, "collecting analytics", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		data["Report"] = report
+	}
+	h.render(w, "project_analytics", data)
+}
+
+// handleAPIProjectAnalytics returns the view analytics of a project.
+func (h *Handler) handleAPIProjectAnalytics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	if !h.analyticsEnabled() {
+		h.jsonError(w, "Analytics are disabled", http.StatusNotFound)
+		return
+	}
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if user == nil || !h.canUpload(ctx, user, project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	report, err := h.projectAnalytics(ctx, project, analyticsDays(r))
+	if err != nil {
+		h.logger.ErrorContext(ctx, "collecting analytics", "error", err)
+		h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	h.jsonResponse(w, report)
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProjectAnalytics(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.Analytics.Enabled = true
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+	seedSEOVersion(t, app, project, admin, "2.0.0")
+	token := adminAPIToken(t, app)
+
+	for _, path := range []string{
+		"/project/guide/2.0.0/",
+		"/project/guide/2.0.0/guide/intro.html",
+		"/project/guide/1.0.0/guide/intro.html",
+		"/project/guide/2.0.0/style.css",
+		"/project/guide/2.0.0/missing.html",
+	} {
+		resp, err := http.Get(app.server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if err := app.handler.WaitForJobs(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := apiRequest(t, app, "GET", "/api/project/guide/analytics?days=7", token, "", nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var report analyticsReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Days != 7 || report.SamplePercent != 100 {
+		t.Errorf("unexpected report period %+v", report)
+	}
+	if len(report.TopPages) != 2 || report.TopPages[0].Path != "guide/intro.html" || report.TopPages[0].Hits != 2 {
+		t.Errorf("expected the HTML pages only, got %+v", report.TopPages)
+	}
+	if len(report.Versions) != 2 || report.Versions[0].Version != "2.0.0" || report.Versions[0].Hits != 2 {
+		t.Errorf("unexpected version popularity %+v", report.Versions)
+	}
+	if len(report.NotFound) != 1 || report.NotFound[0].Path != "missing.html" || report.NotFound[0].Version != "2.0.0" {
+		t.Errorf("expected the missing page, got %+v", report.NotFound)
+	}
+
+	// The page is for editors only.
+	cookies := loginUser(t, app, "admin", "admin123")
+	req, _ := http.NewRequest("GET", app.server.URL+"/project/guide/analytics", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "missing.html") {
+		t.Errorf("expected the analytics page, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Get(app.server.URL + "/api/project/guide/analytics")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for anonymous readers, got %d", resp.StatusCode)
+	}
+
+	app.handler.config.Analytics.Enabled = false
+	resp = apiRequest(t, app, "GET", "/api/project/guide/analytics", token, "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 while analytics are disabled, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestDisallowAnonymous(t *testing.T) {
+	app := setupTestApp(t)
+	seedAdmin(t, app)
+	seedProject(t, app, "public-docs", "Public Docs", true)
+	app.handler.config.Access.AllowAnonymous = false
+
+	rawKey := apiKeyPrefix + "testkey"
+	app.handler.apiKeys.Create(context.Background(), &database.APIKey{Name: "dashboard", KeyHash: auth.HashToken(rawKey)})
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	get := func(path string, cookies []*http.Cookie, header map[string]string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", app.server.URL+path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for _, path := range []string{"/", "/project/public-docs", "/search?q=docs"} {
+		resp := get(path, nil, nil)
+		if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/login" {
+			t.Errorf("GET %s: expected a redirect to /login, got %d %q", path, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+	if resp := get("/api/projects", nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected anonymous API requests to get 401, got %d", resp.StatusCode)
+	}
+	if resp := get("/login", nil, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the login page to stay reachable, got %d", resp.StatusCode)
+	}
+	if resp := get("/sitemap.xml", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected no sitemap, got %d", resp.StatusCode)
+	}
+	if robots := getBody(t, app.server.URL+"/robots.txt"); !strings.Contains(robots, "Disallow: /\n") || strings.Contains(robots, "Sitemap:") {
+		t.Errorf("expected robots.txt to disallow everything, got:\n%s", robots)
+	}
+
+	// API keys are credentials of their own and keep working
+	if resp := get("/api/projects", nil, map[string]string{apiKeyHeader: rawKey}); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected API keys to read public projects, got %d", resp.StatusCode)
+	}
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	if resp := get("/project/public-docs", cookies, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected logged-in users to see public projects, got %d", resp.StatusCode)
+	}
+}
+
+func TestDisallowAnonymousPasswordReset(t *testing.T) {
+	app := setupTestApp(t)
+	mailer := &fakeMailer{}
+	app.handler.mailer = mailer
+	app.handler.config.Server.PublicURL = "https://docs.example.com"
+	app.handler.config.Access.AllowAnonymous = false
+	ctx := context.Background()
+
+	hash, _ := auth.HashPassword("oldpass")
+	app.handler.users.Create(ctx, &database.User{Username: "ada", Email: "ada@example.com", Password: &hash, AuthSource: "builtin", Role: "viewer"})
+
+	if body := getBody(t, app.server.URL+"/forgot-password"); !strings.Contains(body, "Send Reset Link") {
+		t.Error("expected the forgot password page without a login")
+	}
+	if body := getBody(t, app.server.URL+"/reset-password?token=unknown"); !strings.Contains(body, "invalid or has expired") {
+		t.Error("expected the reset password page without a login")
+	}
+
+	status, _ := postPasswordForm(t, app, "/forgot-password", url.Values{"username": {"ada"}})
+	sent := mailer.take(t, app)
+	if status != http.StatusOK || len(sent) != 1 {
+		t.Fatalf("expected a reset email to be sent without a login, got %d %+v", status, sent)
+	}
+	link := "https://docs.example.com/reset-password?token="
+	i := strings.Index(sent[0].Body, link)
+	if i < 0 {
+		t.Fatalf("expected a reset link in %q", sent[0].Body)
+	}
+	token, _, _ := strings.Cut(sent[0].Body[i+len(link):], "\n")
+
+	_, body := postPasswordForm(t, app, "/reset-password", url.Values{"token": {token}, "new_password": {"newpass"}, "confirm_password": {"newpass"}})
+	if !strings.Contains(body, "Your password was changed") {
+		t.Fatalf("expected the password to be reset without a login, got %s", body)
+	}
+	if cookies := loginUser(t, app, "ada", "newpass"); len(cookies) == 0 {
+		t.Error("expected the new password to work")
+	}
+}
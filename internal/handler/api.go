@@ -3,56 +3,143 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"os"
+	"slices"
 	"strings"
 
 	"github.com/qwc/asiakirjat/internal/auth"
 	"github.com/qwc/asiakirjat/internal/database"
 	"github.com/qwc/asiakirjat/internal/docs"
+	"github.com/qwc/asiakirjat/internal/hooks"
+	"github.com/qwc/asiakirjat/internal/store"
 )
 
 func (h *Handler) handleAPIProjects(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user := auth.UserFromContext(ctx)
-	query := r.URL.Query().Get("q")
+	params := r.URL.Query()
 
-	var projects []database.Project
-	var err error
-
-	if query != "" {
-		projects, err = h.projects.Search(ctx, query)
-	} else {
-		projects, err = h.projects.List(ctx)
+	page, err := parseListPage(params)
+	if err != nil {
+		h.jsonError(w, queryError(err), http.StatusBadRequest)
+		return
+	}
+	sort, desc, err := parseSort(params.Get("sort"), store.SortName, store.SortCreated, store.SortUpdated)
+	if err != nil {
+		h.jsonError(w, queryError(err), http.StatusBadRequest)
+		return
+	}
+	visibility := params.Get("visibility")
+	if visibility != "" && !validVisibility(visibility) {
+		h.jsonError(w, "Invalid visibility", http.StatusBadRequest)
+		return
+	}
+	q := store.ProjectQuery{
+		Search:     params.Get("q"),
+		Visibility: visibility,
+		Lifecycle:  params.Get("lifecycle"),
+		Tag:        params.Get("tag"),
+		Metadata:   metadataFilter(params),
+		Sort:       sort,
+		Desc:       desc,
+	}
+	q.Limit, q.Offset = page.limitOffset()
+
+	// Filter based on access, which depends on grants the store does not
+	// know of
+	if user == nil || user.Role != "admin" {
+		all, err := h.projects.List(ctx)
+		if err != nil {
+			h.jsonError(w, "Failed to list projects", http.StatusInternalServerError)
+			return
+		}
+		q.IDs = []int64{}
+		for _, p := range all {
+			if h.canListProject(ctx, user, &p) {
+				q.IDs = append(q.IDs, p.ID)
+			}
+		}
 	}
 
+	projects, total, err := h.projects.ListPage(ctx, q)
 	if err != nil {
 		h.jsonError(w, "Failed to list projects", http.StatusInternalServerError)
 		return
 	}
-
-	// Filter based on access
-	var filtered []database.Project
-	for _, p := range projects {
-		if h.canViewProject(ctx, user, &p) {
-			filtered = append(filtered, p)
-		}
+	metadata, err := h.metadata.ListProjects(ctx)
+	if err != nil {
+		h.jsonError(w, "Failed to list projects", http.StatusInternalServerError)
+		return
 	}
+	projectTags, err := h.tags.List(ctx)
+	if err != nil {
+		h.jsonError(w, "Failed to list projects", http.StatusInternalServerError)
+		return
+	}
+	h.localizeProjects(w, r, projects)
 
 	type projectJSON struct {
-		Slug        string `json:"slug"`
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Visibility  string `json:"visibility"`
+		Slug             string            `json:"slug"`
+		Name             string            `json:"name"`
+		Description      string            `json:"description"`
+		Visibility       string            `json:"visibility"`
+		Lifecycle        string            `json:"lifecycle"`
+		LifecycleMessage string            `json:"lifecycle_message,omitempty"`
+		Owner            string            `json:"owner,omitempty"`
+		OwnerTeam        string            `json:"owner_team,omitempty"`
+		OwnerContact     string            `json:"owner_contact,omitempty"`
+		OwnerOrphaned    bool              `json:"owner_orphaned,omitempty"`
+		Metadata         map[string]string `json:"metadata"`
+		Tags             []string          `json:"tags"`
+		CreatedAt        string            `json:"created_at"`
+		UpdatedAt        string            `json:"updated_at"`
+	}
+
+	result := make([]projectJSON, 0, len(projects))
+	for _, p := range projects {
+		meta := metadata[p.ID]
+		if meta == nil {
+			meta = map[string]string{}
+		}
+		tags := projectTags[p.ID]
+		if tags == nil {
+			tags = []string{}
+		}
+		result = append(result, projectJSON{
+			Slug:             p.Slug,
+			Name:             p.Name,
+			Description:      p.Description,
+			Visibility:       p.Visibility,
+			Lifecycle:        p.Lifecycle,
+			LifecycleMessage: p.LifecycleMessage,
+			Owner:            p.Owner,
+			OwnerTeam:        p.OwnerTeam,
+			OwnerContact:     p.OwnerContact,
+			OwnerOrphaned:    p.OwnerOrphaned,
+			Metadata:         meta,
+			Tags:             tags,
+			CreatedAt:        p.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			UpdatedAt:        p.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		})
 	}
+	h.setPageHeaders(w, r, "/api/projects", page, total)
 
-	result := make([]projectJSON, 0, len(filtered))
-	for _, p := range filtered {
-		result = append(result, projectJSON{
-			Slug:        p.Slug,
-			Name:        p.Name,
-			Description: p.Description,
-			Visibility:  p.Visibility,
+	// The tags facet counts the projects matching all other filters, so
+	// that it shows where a tag filter would lead.
+	if params.Get("facets") == "tags" {
+		q.Tag, q.Limit, q.Offset = "", 0, 0
+		matched, _, err := h.projects.ListPage(ctx, q)
+		if err != nil {
+			h.jsonError(w, "Failed to list projects", http.StatusInternalServerError)
+			return
+		}
+		h.jsonResponse(w, map[string]any{
+			"projects": result,
+			"facets":   map[string]any{"tags": tagCounts(matched, projectTags)},
 		})
+		return
 	}
 
 	h.jsonResponse(w, result)
@@ -67,50 +154,161 @@ func (h *Handler) handleAPIVersions(w http.ResponseWriter, r *http.Request) {
 		h.jsonError(w, "Project not found", http.StatusNotFound)
 		return
 	}
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 
-	versions, err := h.versions.ListByProject(ctx, project.ID)
+	params := r.URL.Query()
+	page, err := parseListPage(params)
 	if err != nil {
-		h.jsonError(w, "Failed to list versions", http.StatusInternalServerError)
+		h.jsonError(w, queryError(err), http.StatusBadRequest)
+		return
+	}
+	sort, desc, err := parseSort(params.Get("sort"), store.SortName, store.SortCreated, store.SortUpdated)
+	if err != nil {
+		h.jsonError(w, queryError(err), http.StatusBadRequest)
 		return
 	}
 
-	// Sort versions by semver (descending)
-	tags := make([]string, len(versions))
-	versionMap := make(map[string]database.Version)
-	for i, v := range versions {
-		tags[i] = v.Tag
-		versionMap[v.Tag] = v
+	var versions []database.Version
+	var total int
+	if sort == store.SortCreated || sort == store.SortUpdated {
+		// A re-upload sets the creation time, so that both are the
+		// time of the last upload
+		limit, offset := page.limitOffset()
+		versions, total, err = h.versions.ListPageByProject(ctx, project.ID, store.VersionQuery{Desc: desc, Limit: limit, Offset: offset})
+		if err != nil {
+			h.jsonError(w, "Failed to list versions", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		// Version numbers are ordered as semantic versions, which the
+		// database cannot do: newest first by default, oldest first for
+		// sort=name
+		versions, err = h.versions.ListByProject(ctx, project.ID)
+		if err != nil {
+			h.jsonError(w, "Failed to list versions", http.StatusInternalServerError)
+			return
+		}
+		tags := make([]string, len(versions))
+		versionMap := make(map[string]database.Version)
+		for i, v := range versions {
+			tags[i] = v.Tag
+			versionMap[v.Tag] = v
+		}
+		docs.SortVersionTags(tags)
+		if sort == store.SortName && !desc {
+			slices.Reverse(tags)
+		}
+		total = len(tags)
+		if limit, offset := page.limitOffset(); limit > 0 {
+			tags = tags[min(offset, total):min(offset+limit, total)]
+		}
+		versions = versions[:0]
+		for _, tag := range tags {
+			versions = append(versions, versionMap[tag])
+		}
 	}
-	docs.SortVersionTags(tags)
 
 	type versionJSON struct {
 		Tag         string `json:"tag"`
 		ContentType string `json:"content_type"`
 		CreatedAt   string `json:"created_at"`
+
+		SignatureStatus string `json:"signature_status"`
+		SignatureKey    string `json:"signature_key,omitempty"`
+		Protected       bool   `json:"protected"`
+
+		Lifecycle        string `json:"lifecycle"`
+		LifecycleMessage string `json:"lifecycle_message,omitempty"`
+
+		ReleaseNotes string            `json:"release_notes,omitempty"`
+		Metadata     map[string]string `json:"metadata,omitempty"`
+		Attachments  []attachmentJSON  `json:"attachments,omitempty"`
 	}
 
-	result := make([]versionJSON, 0, len(tags))
-	for _, tag := range tags {
-		v := versionMap[tag]
+	attachments := h.versionAttachments(ctx, project.ID)
+	metadata, err := h.metadata.ListVersionsByProject(ctx, project.ID)
+	if err != nil {
+		h.jsonError(w, "Failed to list versions", http.StatusInternalServerError)
+		return
+	}
+	bp := h.config.Server.BasePath
+
+	result := make([]versionJSON, 0, len(versions))
+	for _, v := range versions {
 		result = append(result, versionJSON{
 			Tag:         v.Tag,
 			ContentType: v.ContentType,
 			CreatedAt:   v.CreatedAt.Format("2006-01-02T15:04:05Z"),
+
+			SignatureStatus: v.SignatureStatus,
+			SignatureKey:    v.SignatureKey,
+			Protected:       v.Protected,
+
+			Lifecycle:        v.Lifecycle,
+			LifecycleMessage: v.LifecycleMessage,
+
+			ReleaseNotes: v.ReleaseNotes,
+			Metadata:     metadata[v.ID],
 		})
+		for _, a := range attachments[v.ID] {
+			result[len(result)-1].Attachments = append(result[len(result)-1].Attachments, attachmentJSON{
+				Kind:     a.Kind,
+				Filename: a.Filename,
+				Size:     a.Size,
+				SHA256:   a.SHA256,
+				URL:      bp + "/api/project/" + slug + "/version/" + v.Tag + "/attachments/" + a.Kind,
+			})
+		}
 	}
 
+	h.setPageHeaders(w, r, "/api/project/"+slug+"/versions", page, total)
 	h.jsonResponse(w, result)
 }
 
+// handleAPIDownloadVersion streams a version as a zip archive.
+func (h *Handler) handleAPIDownloadVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	ver, err := h.versions.GetByProjectAndTag(ctx, project.ID, r.PathValue("tag"))
+	if err != nil || !h.storage.VersionExists(slug, ver.Tag) {
+		h.jsonError(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	h.streamVersionZip(w, slug, ver.Tag, h.storage.VersionPath(slug, ver.Tag))
+}
+
 func (h *Handler) handleAPIUpload(w http.ResponseWriter, r *http.Request) {
 	slug := r.PathValue("slug")
 	h.handleAPIUploadWithSlug(w, r, slug)
 }
 
 func (h *Handler) handleAPIUploadGeneral(w http.ResponseWriter, r *http.Request) {
+	if h.refuseDuringShutdown(w, true) {
+		return
+	}
+
+	// Turn away requests without an upload token before reading the
+	// upload; the token is checked against the project below
+	if h.authenticateToken(w, r, auth.AnyProject, auth.ScopeUpload) == nil {
+		return
+	}
+
 	// Parse form first to get the project slug
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
-	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+	if err := h.parseUploadForm(w, r); err != nil {
 		h.jsonError(w, "File too large", http.StatusRequestEntityTooLarge)
 		return
 	}
@@ -125,18 +323,20 @@ func (h *Handler) handleAPIUploadGeneral(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *Handler) handleAPIUploadWithSlug(w http.ResponseWriter, r *http.Request, slug string) {
+	done, ok := h.startUpload(w, true)
+	if !ok {
+		return
+	}
+	defer done()
 	ctx := r.Context()
-	tokenAuth := auth.NewTokenAuthenticator(h.tokens, h.users)
-
 	project, err := h.projects.GetBySlug(ctx, slug)
 	var user *database.User
 	if err != nil {
 		// Project doesn't exist — try auto-create path
 		if h.config.Projects.AutoCreate && isValidSlug(slug) {
 			// No project to scope to, so use unscoped auth
-			user = tokenAuth.AuthenticateRequest(r)
+			user = h.authenticateToken(w, r, 0, auth.ScopeUpload)
 			if user == nil {
-				h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 			if !canAutoCreate(user) {
@@ -145,7 +345,7 @@ func (h *Handler) handleAPIUploadWithSlug(w http.ResponseWriter, r *http.Request
 			}
 			project, err = h.autoCreateProject(ctx, slug, user)
 			if err != nil {
-				h.logger.Error("auto-creating project", "error", err)
+				h.logger.ErrorContext(ctx, "auto-creating project", "error", err)
 				h.jsonError(w, "Failed to create project", http.StatusInternalServerError)
 				return
 			}
@@ -155,9 +355,8 @@ func (h *Handler) handleAPIUploadWithSlug(w http.ResponseWriter, r *http.Request
 		}
 	} else {
 		// Project exists — use project-scoped auth
-		user = tokenAuth.AuthenticateRequestForProject(r, project.ID)
+		user = h.authenticateToken(w, r, project.ID, auth.ScopeUpload)
 		if user == nil {
-			h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 	}
@@ -168,12 +367,9 @@ func (h *Handler) handleAPIUploadWithSlug(w http.ResponseWriter, r *http.Request
 	}
 
 	// Parse form if not already parsed (for path-based endpoint)
-	if r.MultipartForm == nil {
-		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
-		if err := r.ParseMultipartForm(maxUploadSize); err != nil {
-			h.jsonError(w, "File too large", http.StatusRequestEntityTooLarge)
-			return
-		}
+	if err := h.parseUploadForm(w, r); err != nil {
+		h.jsonError(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
 	}
 
 	versionTag := r.FormValue("version")
@@ -181,6 +377,15 @@ func (h *Handler) handleAPIUploadWithSlug(w http.ResponseWriter, r *http.Request
 		h.jsonError(w, "Version tag is required", http.StatusBadRequest)
 		return
 	}
+	versionTag, err = normalizeVersionTag(project, versionTag)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.checkOverwrite(ctx, project, versionTag, user, r.URL.Query().Get("force") == "true"); err != nil {
+		h.jsonError(w, err.Error(), http.StatusConflict)
+		return
+	}
 
 	file, header, err := r.FormFile("archive")
 	if err != nil {
@@ -188,31 +393,86 @@ func (h *Handler) handleAPIUploadWithSlug(w http.ResponseWriter, r *http.Request
 		return
 	}
 	defer file.Close()
+	if err := h.checkUploadSize(project, header.Size); err != nil {
+		h.jsonError(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	sigStatus, sigKey, err := h.verifyUploadSignature(r, project, file)
+	if err != nil {
+		h.jsonError(w, "Signature rejected: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	attachmentFiles, err := h.uploadAttachments(r)
+	if err != nil {
+		h.jsonError(w, "The "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	versionMeta, err := uploadMetadata(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	releaseNotes, err := uploadReleaseNotes(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	isPDF := strings.HasSuffix(strings.ToLower(header.Filename), ".pdf")
 
-	if err := h.storage.EnsureVersionDir(slug, versionTag); err != nil {
-		h.logger.Error("creating version directory", "error", err)
+	// Unpacked next to the version and swapped in once the upload is accepted
+	stagePath, err := h.stageVersion(slug, versionTag)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "creating version directory", "error", err)
 		h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	defer os.RemoveAll(stagePath)
 
 	destPath := h.storage.VersionPath(slug, versionTag)
 	contentType := "archive"
 
+	var manifest docs.Manifest
 	if isPDF {
 		contentType = "pdf"
-		if err := storePDF(file, destPath); err != nil {
-			h.storage.DeleteVersion(slug, versionTag)
+		if manifest, err = storePDF(file, stagePath); err != nil {
 			h.jsonError(w, "Failed to store PDF: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 	} else {
-		if err := docs.ExtractArchive(file, header.Filename, destPath); err != nil {
-			h.storage.DeleteVersion(slug, versionTag)
-			h.jsonError(w, "Failed to extract archive: "+err.Error(), http.StatusBadRequest)
+		opts := h.extractOptions(project)
+		opts.Manifest = &manifest
+		if err := docs.ExtractArchiveWithOptions(file, header.Filename, stagePath, opts); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, docs.ErrExtractLimit) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			h.jsonError(w, "Failed to extract archive: "+err.Error(), status)
+			return
+		}
+	}
+
+	if reason := h.checkUpload(ctx, hooks.Event{Project: slug, Version: versionTag, User: user.Username, Dir: stagePath, Filename: header.Filename}); reason != "" {
+		h.jsonError(w, reason, http.StatusUnprocessableEntity)
+		return
+	}
+	if err := h.checkQuota(ctx, project, versionTag, manifest.Size()); err != nil {
+		if !errors.Is(err, errQuotaExceeded) {
+			h.logger.ErrorContext(ctx, "checking storage quota", "error", err)
+			h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+		h.jsonError(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := h.storage.ReplaceVersion(slug, versionTag, stagePath); err != nil {
+		h.logger.ErrorContext(ctx, "storing version files", "error", err)
+		h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
 
 	// Check if version already exists (for re-upload)
@@ -224,7 +484,14 @@ func (h *Handler) handleAPIUploadWithSlug(w http.ResponseWriter, r *http.Request
 		// Update existing version
 		existingVersion.StoragePath = destPath
 		existingVersion.ContentType = contentType
+		existingVersion.LandingPath = h.detectLandingPage(project, contentType, destPath)
 		existingVersion.UploadedBy = user.ID
+		existingVersion.SignatureStatus = sigStatus
+		existingVersion.SignatureKey = sigKey
+		existingVersion.SizeBytes = manifest.Size()
+		if releaseNotes != "" {
+			existingVersion.ReleaseNotes = releaseNotes
+		}
 		if err := h.versions.Update(ctx, existingVersion); err != nil {
 			h.storage.DeleteVersion(slug, versionTag)
 			h.jsonError(w, "Failed to update version", http.StatusInternalServerError)
@@ -244,6 +511,12 @@ func (h *Handler) handleAPIUploadWithSlug(w http.ResponseWriter, r *http.Request
 			StoragePath: destPath,
 			ContentType: contentType,
 			UploadedBy:  user.ID,
+			LandingPath: h.detectLandingPage(project, contentType, destPath),
+			SizeBytes:   manifest.Size(),
+
+			SignatureStatus: sigStatus,
+			SignatureKey:    sigKey,
+			ReleaseNotes:    releaseNotes,
 		}
 		if err := h.versions.Create(ctx, version); err != nil {
 			h.storage.DeleteVersion(slug, versionTag)
@@ -252,6 +525,17 @@ func (h *Handler) handleAPIUploadWithSlug(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	if err := h.saveAttachments(ctx, slug, version, attachmentFiles, isReupload); err != nil {
+		h.logger.ErrorContext(ctx, "storing attachments", "error", err, "project", slug, "version", versionTag)
+	}
+	h.storeManifest(ctx, slug, versionTag, manifest)
+
+	if versionMeta != nil {
+		if err := h.metadata.SetVersion(ctx, version.ID, versionMeta); err != nil {
+			h.logger.ErrorContext(ctx, "setting version metadata", "error", err, "project", slug, "version", versionTag)
+		}
+	}
+
 	// Log the upload
 	if h.uploadLogs != nil {
 		uploadLog := &database.UploadLog{
@@ -263,7 +547,7 @@ func (h *Handler) handleAPIUploadWithSlug(w http.ResponseWriter, r *http.Request
 			Filename:    header.Filename,
 		}
 		if err := h.uploadLogs.Create(ctx, uploadLog); err != nil {
-			h.logger.Error("creating upload log", "error", err)
+			h.logger.ErrorContext(ctx, "creating upload log", "error", err)
 		}
 	}
 
@@ -271,41 +555,68 @@ func (h *Handler) handleAPIUploadWithSlug(w http.ResponseWriter, r *http.Request
 	if !isReupload && project.PinnedVersion != nil && !project.PinPermanent {
 		project.PinnedVersion = nil
 		if err := h.projects.Update(ctx, project); err != nil {
-			h.logger.Error("clearing temporary pin", "error", err)
+			h.logger.ErrorContext(ctx, "clearing temporary pin", "error", err)
 		}
 	}
 
-	// Invalidate latest tags cache
-	h.invalidateLatestTagsCache()
+	// Invalidate cached versions
+	h.invalidateVersions(project.ID)
+
+	h.emitEvent(ctx, database.EventVersionPublished, slug, map[string]any{
+		"version":      versionTag,
+		"content_type": contentType,
+		"reupload":     isReupload,
+		"actor":        user.Username,
+	})
+	if !isReupload {
+		h.notifyWatchers(ctx, project, version, user)
+	}
+	h.runHooksAsync(ctx, hooks.Event{Point: hooks.PostPublish, Project: slug, Version: versionTag, User: user.Username, Dir: destPath})
 
 	// Async index for full-text search
 	if h.searchIndex != nil {
-		go func() {
-			if err := h.searchIndex.IndexVersion(project.ID, version.ID, slug, project.Name, versionTag, destPath); err != nil {
-				h.logger.Error("indexing version", "error", err, "project", slug, "version", versionTag)
+		indexMeta := h.searchMetadata(ctx, project.ID, version.ID)
+		h.goJob(ctx, func(ctx context.Context) {
+			if err := h.searchIndex.IndexVersionWithMetadata(ctx, project.ID, version.ID, slug, project.Name, versionTag, destPath, indexMeta); err != nil {
+				h.logger.ErrorContext(ctx, "indexing version", "error", err, "project", slug, "version", versionTag)
 			}
-		}()
+		})
+	}
+
+	if h.config.Accessibility.CheckUploads && contentType == "archive" {
+		h.goJob(ctx, func(ctx context.Context) { h.checkVersionAccessibility(ctx, slug, versionTag, destPath) })
+	}
+
+	if h.config.Thumbnails.Command != "" && contentType == "archive" {
+		h.goJob(ctx, func(context.Context) { h.rerenderThumbnail(slug, versionTag) })
 	}
 
 	// Enforce retention after new non-semver upload
 	if !isReupload && !docs.IsSemver(versionTag) {
-		go h.enforceRetentionPolicy(context.Background(), project)
+		h.goJob(ctx, func(ctx context.Context) { h.enforceRetentionPolicy(ctx, project) })
 	}
 
-	h.jsonResponse(w, map[string]string{
+	resp := map[string]any{
 		"status":  "ok",
 		"version": versionTag,
 		"project": slug,
-	})
+	}
+	// The link check runs before answering, so CI sees broken links in
+	// the response of the upload that introduced them.
+	if h.config.Upload.CheckLinks && contentType == "archive" {
+		resp["warnings"] = linkWarnings(h.checkVersionLinks(ctx, slug, versionTag, destPath))
+	}
+	h.jsonResponse(w, resp)
 }
 
 func (h *Handler) handleAPICreateProject(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	tokenAuth := auth.NewTokenAuthenticator(h.tokens, h.users)
-	user := tokenAuth.AuthenticateRequest(r)
+	// Creating a project takes the upload scope, as auto-creating one on
+	// upload does, so that tokens issued before scopes existed, which
+	// carry only upload, keep working; admin:project implies it
+	user := h.authenticateToken(w, r, 0, auth.ScopeUpload)
 	if user == nil {
-		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -336,8 +647,8 @@ func (h *Handler) handleAPICreateProject(w http.ResponseWriter, r *http.Request)
 	if req.Visibility == "" {
 		req.Visibility = database.VisibilityPrivate
 	}
-	if req.Visibility != database.VisibilityPublic && req.Visibility != database.VisibilityPrivate && req.Visibility != database.VisibilityCustom {
-		h.jsonError(w, "Invalid visibility: must be public, private, or custom", http.StatusBadRequest)
+	if !validVisibility(req.Visibility) {
+		h.jsonError(w, "Invalid visibility: must be public, unlisted, private, or custom", http.StatusBadRequest)
 		return
 	}
 
@@ -355,13 +666,13 @@ func (h *Handler) handleAPICreateProject(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := h.projects.Create(ctx, project); err != nil {
-		h.logger.Error("creating project via API", "error", err)
+		h.logger.ErrorContext(ctx, "creating project via API", "error", err)
 		h.jsonError(w, "Failed to create project", http.StatusInternalServerError)
 		return
 	}
 
 	if err := h.storage.EnsureProjectDir(req.Slug); err != nil {
-		h.logger.Error("creating project directory", "error", err)
+		h.logger.ErrorContext(ctx, "creating project directory", "error", err)
 	}
 
 	// Auto-grant editor access to the creator for non-admin, non-public projects
@@ -372,10 +683,12 @@ func (h *Handler) handleAPICreateProject(w http.ResponseWriter, r *http.Request)
 			Role:      "editor",
 		}
 		if err := h.access.Grant(ctx, access); err != nil {
-			h.logger.Error("auto-granting creator access", "error", err)
+			h.logger.ErrorContext(ctx, "auto-granting creator access", "error", err)
 		}
 	}
 
+	h.emitEvent(ctx, database.EventProjectCreated, project.Slug, projectEventData(project, user))
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]any{
@@ -386,8 +699,21 @@ func (h *Handler) handleAPICreateProject(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-func (h *Handler) handleHealthz(w http.ResponseWriter, r *http.Request) {
-	h.jsonResponse(w, map[string]string{"status": "ok"})
+// authenticateToken authenticates a bearer token that must grant scope and,
+// when projectID is non-zero, be valid for that project. On failure it writes
+// the JSON error response and returns nil.
+func (h *Handler) authenticateToken(w http.ResponseWriter, r *http.Request, projectID int64, scope string) *database.User {
+	tokenAuth := auth.NewTokenAuthenticator(h.tokens, h.users)
+	user, err := tokenAuth.AuthenticateScoped(r, projectID, scope)
+	if errors.Is(err, auth.ErrMissingScope) {
+		h.jsonError(w, "Forbidden: token lacks the "+scope+" scope", http.StatusForbidden)
+		return nil
+	}
+	if err != nil {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+	return user
 }
 
 func (h *Handler) jsonResponse(w http.ResponseWriter, data any) {
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// apiKeyHeader carries an anonymous API key. Keys are separate from API
+// tokens: they belong to no user and only read public projects and search.
+const apiKeyHeader = "X-API-Key"
+
+// apiKeyPrefix makes keys recognizable, e.g. in secret scanners.
+const apiKeyPrefix = "ak_"
+
+// apiKeyQuota counts the requests of each key in the current hour.
+type apiKeyQuota struct {
+	mu     sync.Mutex
+	window time.Time
+	counts map[int64]int
+}
+
+func newAPIKeyQuota() *apiKeyQuota {
+	return &apiKeyQuota{counts: make(map[int64]int)}
+}
+
+// take counts a request of a key and reports whether it is within limit.
+// It returns the requests left and when the quota resets.
+func (q *apiKeyQuota) take(id int64, limit int, now time.Time) (remaining int, reset time.Time, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	window := now.Truncate(time.Hour)
+	if !window.Equal(q.window) {
+		q.window = window
+		clear(q.counts)
+	}
+	reset = window.Add(time.Hour)
+	if q.counts[id] >= limit {
+		return 0, reset, false
+	}
+	q.counts[id]++
+	return limit - q.counts[id], reset, true
+}
+
+// used returns the requests of a key in the current hour.
+func (q *apiKeyQuota) used(id int64, now time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !now.Truncate(time.Hour).Equal(q.window) {
+		return 0
+	}
+	return q.counts[id]
+}
+
+// apiKeyLimit returns the hourly quota of a key.
+func (h *Handler) apiKeyLimit(key *database.APIKey) int {
+	if key.Quota > 0 {
+		return key.Quota
+	}
+	return h.config.APIKeys.DefaultQuota
+}
+
+// checkAPIKey validates the API key of a request and counts it against the
+// key's quota. It writes an error response and returns false if the key is
+// unknown or over its quota.
+func (h *Handler) checkAPIKey(w http.ResponseWriter, r *http.Request) bool {
+	key, err := h.apiKeys.GetByHash(r.Context(), auth.HashToken(r.Header.Get(apiKeyHeader)))
+	if err != nil {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	limit := h.apiKeyLimit(key)
+	remaining, reset, ok := h.apiKeyQuota.take(key.ID, limit, time.Now())
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+		h.jsonError(w, "API key quota exceeded", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) handleAdminAPIKeys(w http.ResponseWriter, r *http.Request) {
+	h.renderAPIKeys(w, r, "")
+}
+
+// renderAPIKeys shows the API keys with their usage in the current hour,
+// and a newly created key once.
+func (h *Handler) renderAPIKeys(w http.ResponseWriter, r *http.Request, newKey string) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	keys, err := h.apiKeys.List(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing api keys", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	type keyView struct {
+		database.APIKey
+		Limit int
+		Used  int
+	}
+	now := time.Now()
+	var views []keyView
+	for _, key := range keys {
+		views = append(views, keyView{APIKey: key, Limit: h.apiKeyLimit(&key), Used: h.apiKeyQuota.used(key.ID, now)})
+	}
+
+	h.render(w, "admin_api_keys", map[string]any{
+		"User":         user,
+		"Keys":         views,
+		"DefaultQuota": h.config.APIKeys.DefaultQuota,
+		"NewKey":       newKey,
+	})
+}
+
+func (h *Handler) handleAdminCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	name := r.FormValue("name")
+	if name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	var quota int
+	if v := r.FormValue("quota"); v != "" {
+		var err error
+		if quota, err = strconv.Atoi(v); err != nil || quota < 0 {
+			http.Error(w, "Invalid quota: must be a number of requests per hour", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rawKey, err := auth.GenerateToken(32)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "generating api key", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	rawKey = apiKeyPrefix + rawKey
+
+	key := &database.APIKey{
+		Name:      name,
+		KeyHash:   auth.HashToken(rawKey),
+		Quota:     quota,
+		CreatedBy: user.Username,
+	}
+	if err := h.apiKeys.Create(ctx, key); err != nil {
+		h.logger.ErrorContext(ctx, "creating api key", "error", err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	h.audit(ctx, "apikey.create", user.Username, name)
+
+	h.renderAPIKeys(w, r, rawKey)
+}
+
+func (h *Handler) handleAdminDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.apiKeys.Delete(ctx, id); err != nil {
+		h.logger.ErrorContext(ctx, "deleting api key", "error", err)
+		http.Error(w, "Failed to delete API key", http.StatusInternalServerError)
+		return
+	}
+	h.audit(ctx, "apikey.delete", user.Username, strconv.FormatInt(id, 10))
+
+	h.redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+}
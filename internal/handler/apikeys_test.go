@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestAPIKeyQuota(t *testing.T) {
+	q := newAPIKeyQuota()
+	now := time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if _, _, ok := q.take(1, 2, now); !ok {
+			t.Fatalf("request %d: expected to be within the quota", i+1)
+		}
+	}
+	remaining, reset, ok := q.take(1, 2, now)
+	if ok || remaining != 0 || !reset.Equal(now.Truncate(time.Hour).Add(time.Hour)) {
+		t.Errorf("expected the quota to be exhausted until the next hour, got %v %v %v", remaining, reset, ok)
+	}
+	if _, _, ok := q.take(2, 2, now); !ok {
+		t.Error("expected keys to have separate quotas")
+	}
+	if _, _, ok := q.take(1, 2, now.Add(time.Hour)); !ok {
+		t.Error("expected the quota to reset in the next hour")
+	}
+	if used := q.used(2, now.Add(time.Hour)); used != 0 {
+		t.Errorf("expected no usage in the new hour, got %d", used)
+	}
+}
+
+func TestAPIKeyAccess(t *testing.T) {
+	app := setupTestApp(t)
+	seedAdmin(t, app)
+	ctx := context.Background()
+
+	seedProject(t, app, "public-docs", "Public Docs", true)
+	seedProject(t, app, "secret-docs", "Secret Docs", false)
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	req, _ := http.NewRequest("POST", app.server.URL+"/admin/api-keys", strings.NewReader(url.Values{"name": {"dashboard"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	rawKey := regexp.MustCompile(`ak_[0-9a-f]+`).FindString(string(body))
+	if rawKey == "" {
+		t.Fatalf("expected the new key on the page (%d)", resp.StatusCode)
+	}
+
+	get := func(path, key string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", app.server.URL+path, nil)
+		req.Header.Set(apiKeyHeader, key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp = get("/api/projects", rawKey)
+	var projects []map[string]any
+	json.NewDecoder(resp.Body).Decode(&projects)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(projects) != 1 || projects[0]["slug"] != "public-docs" {
+		t.Fatalf("expected only the public project (%d): %v", resp.StatusCode, projects)
+	}
+	if resp.Header.Get("X-RateLimit-Limit") != "1000" || resp.Header.Get("X-RateLimit-Remaining") != "999" {
+		t.Errorf("expected quota headers, got %v", resp.Header)
+	}
+
+	if resp = get("/api/projects", "ak_unknown"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown key, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	// A key with a quota of its own
+	limited := "ak_limited"
+	app.handler.apiKeys.Create(ctx, &database.APIKey{Name: "limited", KeyHash: auth.HashToken(limited), Quota: 1})
+	resp = get("/api/project/public-docs", limited)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 within the quota, got %d", resp.StatusCode)
+	}
+	resp = get("/api/project/public-docs", limited)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After over the quota, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+const maxAttachmentSize = 10 << 20 // 10 MB
+
+// uploadAttachments returns the provenance/SBOM files sent with an upload,
+// keyed by kind. It is called before the archive is processed so oversized
+// attachments reject the upload up front.
+func (h *Handler) uploadAttachments(r *http.Request) (map[string]*multipart.FileHeader, error) {
+	files := make(map[string]*multipart.FileHeader)
+	if r.MultipartForm == nil {
+		return files, nil
+	}
+	for _, kind := range database.AttachmentKinds {
+		headers := r.MultipartForm.File[kind]
+		if len(headers) == 0 {
+			continue
+		}
+		if headers[0].Size > maxAttachmentSize {
+			return nil, fmt.Errorf("%s file is too large (max %d MB)", kind, maxAttachmentSize>>20)
+		}
+		files[kind] = headers[0]
+	}
+	return files, nil
+}
+
+// saveAttachments stores the attachment files for a version. A re-upload
+// drops the previous upload's attachments, since they describe other bytes.
+func (h *Handler) saveAttachments(ctx context.Context, slug string, version *database.Version, files map[string]*multipart.FileHeader, isReupload bool) error {
+	if h.attachments == nil {
+		return nil
+	}
+
+	dir := h.storage.AttachmentPath(slug, version.Tag)
+	if isReupload {
+		if err := h.attachments.DeleteByVersion(ctx, version.ID); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("removing old attachments: %w", err)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating attachment directory: %w", err)
+	}
+	for kind, header := range files {
+		size, sum, err := copyAttachment(header, filepath.Join(dir, kind))
+		if err != nil {
+			return err
+		}
+		attachment := &database.VersionAttachment{
+			VersionID: version.ID,
+			Kind:      kind,
+			Filename:  filepath.Base(header.Filename),
+			Size:      size,
+			SHA256:    sum,
+		}
+		if err := h.attachments.Upsert(ctx, attachment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyAttachment writes an uploaded file to dest and returns its size and
+// hex SHA-256.
+func copyAttachment(header *multipart.FileHeader, dest string) (int64, string, error) {
+	src, err := header.Open()
+	if err != nil {
+		return 0, "", fmt.Errorf("opening attachment: %w", err)
+	}
+	defer src.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return 0, "", fmt.Errorf("creating attachment: %w", err)
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, h), io.LimitReader(src, maxAttachmentSize))
+	if err != nil {
+		return 0, "", fmt.Errorf("writing attachment: %w", err)
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// versionAttachments maps version IDs to their attachments for a project.
+func (h *Handler) versionAttachments(ctx context.Context, projectID int64) map[int64][]database.VersionAttachment {
+	result := make(map[int64][]database.VersionAttachment)
+	if h.attachments == nil {
+		return result
+	}
+	attachments, err := h.attachments.ListByProject(ctx, projectID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing attachments", "error", err)
+		return result
+	}
+	for _, a := range attachments {
+		result[a.VersionID] = append(result[a.VersionID], a)
+	}
+	return result
+}
+
+// findAttachment resolves an attachment of a project version and the path
+// of its file.
+func (h *Handler) findAttachment(ctx context.Context, project *database.Project, tag, kind string) (*database.VersionAttachment, string, error) {
+	if h.attachments == nil || !slices.Contains(database.AttachmentKinds, kind) {
+		return nil, "", fmt.Errorf("unknown attachment kind %q", kind)
+	}
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag)
+	if err != nil {
+		return nil, "", err
+	}
+	attachment, err := h.attachments.GetByVersionAndKind(ctx, version.ID, kind)
+	if err != nil {
+		return nil, "", err
+	}
+	return attachment, filepath.Join(h.storage.AttachmentPath(project.Slug, tag), kind), nil
+}
+
+func serveAttachment(w http.ResponseWriter, r *http.Request, attachment *database.VersionAttachment, path string) {
+	contentType := mime.TypeByExtension(filepath.Ext(attachment.Filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Checksum-Sha256", attachment.SHA256)
+	http.ServeFile(w, r, path)
+}
+
+func (h *Handler) handleDownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canViewProject(ctx, user, project) {
+		if user == nil {
+			h.redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	attachment, path, err := h.findAttachment(ctx, project, r.PathValue("tag"), r.PathValue("kind"))
+	if err != nil {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	serveAttachment(w, r, attachment, path)
+}
+
+func (h *Handler) handleAPIDownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	attachment, path, err := h.findAttachment(ctx, project, r.PathValue("tag"), r.PathValue("kind"))
+	if err != nil {
+		h.jsonError(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	serveAttachment(w, r, attachment, path)
+}
+
+type attachmentJSON struct {
+	Kind     string `json:"kind"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	URL      string `json:"url"`
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+func uploadWithAttachments(t *testing.T, app *testApp, slug, token, version string, attachments map[string]string) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("version", version)
+	part, _ := writer.CreateFormFile("archive", "docs.zip")
+	io.Copy(part, createTestZip(t, map[string]string{"index.html": "<html>docs</html>"}))
+	for kind, content := range attachments {
+		part, _ = writer.CreateFormFile(kind, kind+".json")
+		part.Write([]byte(content))
+	}
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", app.server.URL+"/api/project/"+slug+"/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestUploadWithAttachments(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "attached")
+
+	resp := uploadWithAttachments(t, app, "attached", token, "1.0.0", map[string]string{
+		"provenance": `{"_type":"https://in-toto.io/Statement/v1"}`,
+		"sbom":       `{"spdxVersion":"SPDX-2.3"}`,
+	})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	// Listed in the versions API
+	req, _ := http.NewRequest("GET", app.server.URL+"/api/project/attached/versions", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []struct {
+		Attachments []struct {
+			Kind   string `json:"kind"`
+			SHA256 string `json:"sha256"`
+		} `json:"attachments"`
+	}
+	json.NewDecoder(resp.Body).Decode(&versions)
+	resp.Body.Close()
+	if len(versions) != 1 || len(versions[0].Attachments) != 2 {
+		t.Fatalf("expected one version with 2 attachments, got %+v", versions)
+	}
+
+	// Downloadable via the API
+	req, _ = http.NewRequest("GET", app.server.URL+"/api/project/attached/version/1.0.0/attachments/sbom", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for sbom download, got %d", resp.StatusCode)
+	}
+	if string(body) != `{"spdxVersion":"SPDX-2.3"}` {
+		t.Errorf("unexpected sbom content: %s", body)
+	}
+	if resp.Header.Get("X-Checksum-Sha256") == "" {
+		t.Error("expected checksum header")
+	}
+
+	// Unknown kinds are not served
+	req, _ = http.NewRequest("GET", app.server.URL+"/api/project/attached/version/1.0.0/attachments/secrets", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown kind, got %d", resp.StatusCode)
+	}
+}
+
+func TestReuploadReplacesAttachments(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "attached")
+
+	resp := uploadWithAttachments(t, app, "attached", token, "1.0.0", map[string]string{"sbom": "old"})
+	resp.Body.Close()
+	resp = uploadWithAttachments(t, app, "attached", token, "1.0.0", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for re-upload, got %d", resp.StatusCode)
+	}
+
+	project, _ := app.handler.projects.GetBySlug(context.Background(), "attached")
+	version, _ := app.handler.versions.GetByProjectAndTag(context.Background(), project.ID, "1.0.0")
+	attachments, err := app.handler.attachments.ListByVersion(context.Background(), version.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments) != 0 {
+		t.Errorf("expected re-upload without attachments to drop old ones, got %d", len(attachments))
+	}
+}
@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// auditListLimit is the number of audit entries shown in the admin UI.
+const auditListLimit = 50
+
+// audit records an entry in the audit log. Failures are logged and
+// otherwise ignored so auditing never blocks the action itself.
+func (h *Handler) audit(ctx context.Context, action, actor, details string) {
+	if h.auditLog == nil {
+		return
+	}
+	entry := &database.AuditEntry{Action: action, Actor: actor, Details: details}
+	if err := h.auditLog.Create(ctx, entry); err != nil {
+		h.logger.ErrorContext(ctx, "writing audit log", "error", err, "action", action)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/hooks"
 )
 
 func (h *Handler) handleLoginPage(w http.ResponseWriter, r *http.Request) {
@@ -14,8 +15,10 @@ func (h *Handler) handleLoginPage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.render(w, "login", map[string]any{
-		"User":          nil,
-		"OAuth2Enabled": h.config.Auth.OAuth2.Enabled,
+		"User":                 nil,
+		"OAuth2Enabled":        h.config.Auth.OAuth2.Enabled,
+		"PasswordResetEnabled": h.passwordResetEnabled(),
+		"RememberEnabled":      h.sessionMgr.RememberEnabled(),
 	})
 }
 
@@ -25,8 +28,10 @@ func (h *Handler) handleLoginSubmit(w http.ResponseWriter, r *http.Request) {
 
 	if username == "" || password == "" {
 		h.render(w, "login", map[string]any{
-			"Error":         "Username and password are required",
-			"OAuth2Enabled": h.config.Auth.OAuth2.Enabled,
+			"Error":                "Username and password are required",
+			"OAuth2Enabled":        h.config.Auth.OAuth2.Enabled,
+			"PasswordResetEnabled": h.passwordResetEnabled(),
+			"RememberEnabled":      h.sessionMgr.RememberEnabled(),
 		})
 		return
 	}
@@ -34,19 +39,25 @@ func (h *Handler) handleLoginSubmit(w http.ResponseWriter, r *http.Request) {
 	for _, a := range h.authenticators {
 		user, err := a.Authenticate(r.Context(), username, password)
 		if err == nil && user != nil {
-			if err := h.sessionMgr.CreateSession(r.Context(), w, user.ID); err != nil {
-				h.logger.Error("creating session", "error", err)
+			if user.Deactivated {
+				break
+			}
+			if err := h.sessionMgr.CreateSession(w, r, user.ID, r.FormValue("remember") != ""); err != nil {
+				h.logger.ErrorContext(r.Context(), "creating session", "error", err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
+			h.runHooksAsync(r.Context(), hooks.Event{Point: hooks.PostLogin, User: user.Username, Method: "password"})
 			h.redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
 	}
 
 	h.render(w, "login", map[string]any{
-		"Error":         "Invalid username or password",
-		"OAuth2Enabled": h.config.Auth.OAuth2.Enabled,
+		"Error":                "Invalid username or password",
+		"OAuth2Enabled":        h.config.Auth.OAuth2.Enabled,
+		"PasswordResetEnabled": h.passwordResetEnabled(),
+		"RememberEnabled":      h.sessionMgr.RememberEnabled(),
 	})
 }
 
@@ -58,7 +69,7 @@ func (h *Handler) handleOAuth2Login(w http.ResponseWriter, r *http.Request) {
 
 	authURL, err := h.oauth2Auth.GenerateAuthURL()
 	if err != nil {
-		h.logger.Error("generating OAuth2 auth URL", "error", err)
+		h.logger.ErrorContext(r.Context(), "generating OAuth2 auth URL", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -68,6 +79,11 @@ func (h *Handler) handleOAuth2Login(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
 	h.sessionMgr.DestroySession(w, r)
+	// The proxy would log the user straight back in
+	if h.proxyAuth != nil && h.proxyAuth.LogoutURL() != "" {
+		http.Redirect(w, r, h.proxyAuth.LogoutURL(), http.StatusSeeOther)
+		return
+	}
 	h.redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -81,8 +97,10 @@ func (h *Handler) handleOAuth2Callback(w http.ResponseWriter, r *http.Request) {
 	state := r.URL.Query().Get("state")
 	if !h.oauth2Auth.ValidateState(state) {
 		h.render(w, "login", map[string]any{
-			"Error":         "Invalid OAuth2 state (CSRF check failed)",
-			"OAuth2Enabled": true,
+			"Error":                "Invalid OAuth2 state (CSRF check failed)",
+			"OAuth2Enabled":        true,
+			"PasswordResetEnabled": h.passwordResetEnabled(),
+			"RememberEnabled":      h.sessionMgr.RememberEnabled(),
 		})
 		return
 	}
@@ -91,27 +109,35 @@ func (h *Handler) handleOAuth2Callback(w http.ResponseWriter, r *http.Request) {
 	code := r.URL.Query().Get("code")
 	if code == "" {
 		h.render(w, "login", map[string]any{
-			"Error":         "Missing authorization code",
-			"OAuth2Enabled": true,
+			"Error":                "Missing authorization code",
+			"OAuth2Enabled":        true,
+			"PasswordResetEnabled": h.passwordResetEnabled(),
+			"RememberEnabled":      h.sessionMgr.RememberEnabled(),
 		})
 		return
 	}
 
 	user, err := h.oauth2Auth.HandleCallback(r.Context(), code)
+	if err == nil && user.Deactivated {
+		err = errUserDeactivated
+	}
 	if err != nil {
-		h.logger.Error("OAuth2 callback failed", "error", err)
+		h.logger.ErrorContext(r.Context(), "OAuth2 callback failed", "error", err)
 		h.render(w, "login", map[string]any{
-			"Error":         "OAuth2 authentication failed",
-			"OAuth2Enabled": true,
+			"Error":                "OAuth2 authentication failed",
+			"OAuth2Enabled":        true,
+			"PasswordResetEnabled": h.passwordResetEnabled(),
+			"RememberEnabled":      h.sessionMgr.RememberEnabled(),
 		})
 		return
 	}
 
-	if err := h.sessionMgr.CreateSession(r.Context(), w, user.ID); err != nil {
-		h.logger.Error("creating session after OAuth2", "error", err)
+	if err := h.sessionMgr.CreateSession(w, r, user.ID, false); err != nil {
+		h.logger.ErrorContext(r.Context(), "creating session after OAuth2", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	h.runHooksAsync(r.Context(), hooks.Event{Point: hooks.PostLogin, User: user.Username, Method: "oauth2"})
 
 	h.redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -41,7 +41,7 @@ func (h *Handler) autoCreateProject(ctx context.Context, slug string, creator *d
 	}
 
 	if err := h.storage.EnsureProjectDir(slug); err != nil {
-		h.logger.Error("creating project directory for auto-created project", "error", err)
+		h.logger.ErrorContext(ctx, "creating project directory for auto-created project", "error", err)
 	}
 
 	// Auto-grant editor access to the creator for non-admin users
@@ -52,10 +52,11 @@ func (h *Handler) autoCreateProject(ctx context.Context, slug string, creator *d
 			Role:      "editor",
 		}
 		if err := h.access.Grant(ctx, access); err != nil {
-			h.logger.Error("auto-granting creator access", "error", err)
+			h.logger.ErrorContext(ctx, "auto-granting creator access", "error", err)
 		}
 	}
 
-	h.logger.Info("auto-created project", "slug", slug, "creator", creator.Username)
+	h.emitEvent(ctx, database.EventProjectCreated, slug, projectEventData(project, creator))
+	h.logger.InfoContext(ctx, "auto-created project", "slug", slug, "creator", creator.Username)
 	return project, nil
 }
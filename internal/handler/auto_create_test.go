@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -401,6 +402,54 @@ func TestAPICreateProjectViewerDenied(t *testing.T) {
 	}
 }
 
+func TestAPICreateProjectScopes(t *testing.T) {
+	app := setupTestApp(t)
+
+	ctx := context.Background()
+
+	robot := &database.User{
+		Username:   "ci-bot",
+		AuthSource: "robot",
+		Role:       "editor",
+		IsRobot:    true,
+	}
+	app.handler.users.Create(ctx, robot)
+
+	// Tokens issued before scopes existed carry only upload
+	tests := []struct {
+		scopes string
+		want   int
+	}{
+		{"upload", http.StatusCreated},
+		{"admin:project", http.StatusCreated},
+		{"read,delete", http.StatusForbidden},
+	}
+	for i, tt := range tests {
+		rawToken, _ := auth.GenerateToken(32)
+		app.handler.tokens.Create(ctx, &database.APIToken{
+			UserID:    robot.ID,
+			TokenHash: auth.HashToken(rawToken),
+			Name:      "ci-token",
+			Scopes:    tt.scopes,
+		})
+
+		payload := fmt.Sprintf(`{"slug":"scoped-%d"}`, i)
+		req, _ := http.NewRequest("POST", app.server.URL+"/api/projects", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+rawToken)
+
+		resp, err := (&http.Client{}).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.want {
+			t.Errorf("scopes %q: expected %d, got %d", tt.scopes, tt.want, resp.StatusCode)
+		}
+	}
+}
+
 func TestAPICreateProjectInvalidSlug(t *testing.T) {
 	app := setupTestApp(t)
 
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+)
+
+// startUpload refuses an upload during shutdown or a backup, answering 503,
+// and otherwise returns the function that ends it.
+func (h *Handler) startUpload(w http.ResponseWriter, api bool) (func(), bool) {
+	if h.refuseDuringShutdown(w, api) {
+		return nil, false
+	}
+	if !h.uploads.TryRLock() {
+		w.Header().Set("Retry-After", shutdownRetryAfter)
+		if api {
+			h.jsonError(w, "Uploads are paused while a backup runs", http.StatusServiceUnavailable)
+		} else {
+			http.Error(w, "Uploads are paused while a backup runs", http.StatusServiceUnavailable)
+		}
+		return nil, false
+	}
+	return h.uploads.RUnlock, true
+}
+
+// handleAPIBackup streams a backup of the database, the storage, the search
+// index and the configuration. Uploads running when it starts are waited
+// for, and new ones are refused until it is done.
+func (h *Handler) handleAPIBackup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if h.backup == nil {
+		h.jsonError(w, "Backups are not available", http.StatusNotFound)
+		return
+	}
+
+	h.uploads.Lock()
+	defer h.uploads.Unlock()
+
+	// A backup of the whole storage may take longer than server.write_timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	filename := "asiakirjat-backup-" + time.Now().UTC().Format("20060102-150405") + ".tar.gz"
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	actor := "api"
+	if user := auth.UserFromContext(ctx); user != nil {
+		actor = user.Username
+	}
+	if err := h.backup(ctx, w); err != nil {
+		// The archive is cut short, which its reader notices
+		h.logger.ErrorContext(ctx, "writing backup", "error", err)
+		h.audit(ctx, "backup.failed", actor, err.Error())
+		return
+	}
+	h.audit(ctx, "backup.create", actor, filename)
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAPIBackupPausesUploads(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "docs")
+
+	var status int
+	app.handler.backup = func(ctx context.Context, w io.Writer) error {
+		status = postArchive(t, app, "docs", token, "1.0.0", quotaArchive(t)).StatusCode
+		_, err := io.WriteString(w, "backup")
+		return err
+	}
+
+	resp := apiRequest(t, app, "GET", "/api/admin/backup", adminAPIToken(t, app), "", nil)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "backup" {
+		t.Fatalf("expected the backup, got %d %q", resp.StatusCode, body)
+	}
+	if !strings.Contains(resp.Header.Get("Content-Disposition"), "asiakirjat-backup-") {
+		t.Errorf("unexpected Content-Disposition %q", resp.Header.Get("Content-Disposition"))
+	}
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("expected uploads to be refused during the backup, got %d", status)
+	}
+
+	// Uploads resume afterwards
+	if resp := postArchive(t, app, "docs", token, "1.0.0", quotaArchive(t)); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the upload to succeed after the backup, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIBackupRequiresAdmin(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "docs")
+	app.handler.backup = func(ctx context.Context, w io.Writer) error { return nil }
+
+	resp := apiRequest(t, app, "GET", "/api/admin/backup", token, "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an upload token to be refused, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// Benchmarks of the request paths whose speed readers and CI notice most.
+// Run with: go test ./internal/handler -run '^$' -bench . -benchmem
+
+func benchRequest(b *testing.B, app *testApp, newRequest func() *http.Request, want int) {
+	b.Helper()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		app.mux.ServeHTTP(rec, newRequest())
+		if rec.Code != want {
+			b.Fatalf("expected %d, got %d: %s", want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func benchApp(b *testing.B) (*testApp, *database.User, *database.Project) {
+	app := setupTestApp(b)
+	admin := seedAdmin(b, app)
+	project := seedProject(b, app, "bench", "Bench Docs", true)
+	seedSEOVersion(b, app, project, admin, "1.0.0")
+	return app, admin, project
+}
+
+func BenchmarkServeDocWithOverlay(b *testing.B) {
+	app, _, _ := benchApp(b)
+	benchRequest(b, app, func() *http.Request {
+		return httptest.NewRequest("GET", "/project/bench/1.0.0/guide/intro.html", nil)
+	}, http.StatusOK)
+}
+
+func BenchmarkServeDocAsset(b *testing.B) {
+	app, _, _ := benchApp(b)
+	benchRequest(b, app, func() *http.Request {
+		return httptest.NewRequest("GET", "/project/bench/1.0.0/style.css", nil)
+	}, http.StatusOK)
+}
+
+func BenchmarkSearch(b *testing.B) {
+	app, _, project := benchApp(b)
+	ctx := context.Background()
+	version, _ := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "1.0.0")
+	if err := app.handler.searchIndex.IndexVersion(context.Background(), project.ID, version.ID, project.Slug, project.Name, "1.0.0", version.StoragePath); err != nil {
+		b.Fatal(err)
+	}
+	benchRequest(b, app, func() *http.Request {
+		return httptest.NewRequest("GET", "/api/search?q=intro", nil)
+	}, http.StatusOK)
+}
+
+func BenchmarkUpload(b *testing.B) {
+	app, admin, project := benchApp(b)
+	rawToken, _ := auth.GenerateToken(32)
+	app.handler.tokens.Create(context.Background(), &database.APIToken{
+		UserID:    admin.ID,
+		ProjectID: &project.ID,
+		TokenHash: auth.HashToken(rawToken),
+		Name:      "bench",
+		Scopes:    auth.ScopeUpload,
+	})
+
+	files := map[string]string{"index.html": "<html><body><h1>Bench</h1></body></html>"}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("guide/page%d.html", i)] = "<html><body>" + strings.Repeat("Lorem ipsum dolor sit amet. ", 200) + "</body></html>"
+	}
+	archive := createTestZip(b, files).Bytes()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("version", "2.0.0")
+	part, _ := writer.CreateFormFile("archive", "docs.zip")
+	part.Write(archive)
+	writer.Close()
+	payload := body.Bytes()
+
+	benchRequest(b, app, func() *http.Request {
+		req := httptest.NewRequest("POST", "/api/project/bench/upload", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+rawToken)
+		return req
+	}, http.StatusOK)
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/templates"
+)
+
+func TestBrandingBlocks(t *testing.T) {
+	previous := templates.GetBranding()
+	t.Cleanup(func() { templates.SetBranding(previous) })
+	templates.SetBranding(templates.Branding{
+		Announcement:   "Maintenance on **Saturday**",
+		FooterHTML:     `<a href="/imprint">Imprint</a>`,
+		ProjectHeaders: map[string]string{"guide": `<p class="moving">Moving in June</p>`},
+	})
+
+	app := setupTestApp(t)
+	seedProject(t, app, "guide", "Guide", true)
+	seedProject(t, app, "other", "Other", true)
+
+	body := getBody(t, app.server.URL+"/")
+	for _, want := range []string{`id="announcement"`, "Maintenance on <strong>Saturday</strong>", `<div class="footer-custom"><a href="/imprint">Imprint</a></div>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s on the front page", want)
+		}
+	}
+	if strings.Contains(body, "Moving in June") {
+		t.Error("expected the project header only on its project's page")
+	}
+
+	if body := getBody(t, app.server.URL+"/project/guide"); !strings.Contains(body, `<p class="moving">Moving in June</p>`) {
+		t.Error("expected the project header on the project's page")
+	}
+	if body := getBody(t, app.server.URL+"/project/other"); strings.Contains(body, "project-header-snippet") {
+		t.Error("expected no header on other projects' pages")
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+func TestCancelledRequestsStopWork(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+	version, err := app.handler.versions.GetByProjectAndTag(context.Background(), project.ID, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = app.handler.searchIndex.IndexVersion(ctx, project.ID, version.ID, project.Slug, project.Name, version.Tag, version.StoragePath)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected indexing to be cancelled, got %v", err)
+	}
+	indexed, err := app.handler.searchIndex.IndexedVersionIDs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed[version.ID] {
+		t.Error("expected a cancelled indexing to index nothing")
+	}
+
+	if _, err := app.handler.searchIndex.Search(ctx, docs.SearchQuery{Query: "guide"}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the search to be cancelled, got %v", err)
+	}
+
+	// An abandoned search request gets no response instead of an error page.
+	req := httptest.NewRequest("GET", "/api/search?q=guide", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	app.handler.handleAPISearch(rec, req)
+	if rec.Body.Len() != 0 {
+		t.Errorf("expected no response body, got %q", rec.Body.String())
+	}
+}
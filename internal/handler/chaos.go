@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// chaosStatuses are the statuses of requests failed by ChaosMiddleware.
+var chaosStatuses = []int{
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// ChaosMiddleware injects faults into the share of requests set by the
+// chaos config: it delays them, answers them with a 5xx status, or makes
+// their database operations fail, which needs a database opened by
+// database.OpenWithFaults. Affected responses name the faults in the
+// X-Chaos-Fault header. The health check is left alone, so orchestrators
+// keep the server running.
+func (h *Handler) ChaosMiddleware(next http.Handler) http.Handler {
+	cfg := h.config.Chaos
+	chance := func(percent int) bool {
+		return percent > 0 && rand.IntN(100) < percent
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, h.config.RoutePrefix())
+		if isHealthPath(path) || !chaosPath(cfg.Paths, path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var faults []string
+		if chance(cfg.LatencyPercent) && cfg.Latency > 0 {
+			faults = append(faults, "latency")
+			delay := time.Duration(1+rand.IntN(cfg.Latency)) * time.Millisecond
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if chance(cfg.ErrorPercent) {
+			faults = append(faults, "error")
+			w.Header().Set("X-Chaos-Fault", strings.Join(faults, ", "))
+			status := chaosStatuses[rand.IntN(len(chaosStatuses))]
+			if status == http.StatusServiceUnavailable {
+				w.Header().Set("Retry-After", "1")
+			}
+			if strings.HasPrefix(path, "/api/") {
+				h.jsonError(w, "Injected fault", status)
+				return
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		if chance(cfg.DatabaseErrorPercent) {
+			faults = append(faults, "database")
+			r = r.WithContext(database.WithInjectedFault(r.Context()))
+		}
+		if len(faults) > 0 {
+			w.Header().Set("X-Chaos-Fault", strings.Join(faults, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// chaosPath reports whether faults are injected into path, which is below
+// one of prefixes or any path if there are none.
+func chaosPath(prefixes []string, path string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/config"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestChaosMiddleware(t *testing.T) {
+	app := setupTestApp(t)
+	db, _, err := database.OpenWithFaults("sqlite", ":memory:", database.Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var dbErr error
+	var chaos http.Handler
+	configure := func(cfg config.ChaosConfig) {
+		app.handler.config.Chaos = cfg
+		chaos = app.handler.ChaosMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, dbErr = db.ExecContext(r.Context(), "SELECT 1")
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	serve := func(path string) *httptest.ResponseRecorder {
+		dbErr = nil
+		rec := httptest.NewRecorder()
+		chaos.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	configure(config.ChaosConfig{Enabled: true, ErrorPercent: 100, Paths: []string{"/api/"}})
+	rec := serve("/api/projects")
+	if rec.Code < 500 || rec.Header().Get("X-Chaos-Fault") != "error" || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected an injected JSON error, got %d %v", rec.Code, rec.Header())
+	}
+	for _, path := range []string{"/project/guide/", "/healthz"} {
+		if rec := serve(path); rec.Code != http.StatusOK || rec.Header().Get("X-Chaos-Fault") != "" {
+			t.Errorf("%s: expected no fault outside the paths, got %d", path, rec.Code)
+		}
+	}
+
+	configure(config.ChaosConfig{Enabled: true, LatencyPercent: 100, Latency: 1, DatabaseErrorPercent: 100})
+	rec = serve("/project/guide/")
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Chaos-Fault") != "latency, database" {
+		t.Errorf("expected the request to be delayed and served, got %d %v", rec.Code, rec.Header())
+	}
+	if !errors.Is(dbErr, database.ErrInjectedFault) {
+		t.Errorf("expected the database operation to fail, got %v", dbErr)
+	}
+}
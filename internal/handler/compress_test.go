@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                   "",
+		"gzip, deflate":      "gzip",
+		"gzip, deflate, br":  "br",
+		"br;q=0, gzip;q=0.5": "gzip",
+		"identity":           "",
+		"*":                  "br",
+		"GZIP":               "gzip",
+		"identity, *;q=0":    "",
+	}
+	for header, want := range tests {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	page := "<html><body>" + strings.Repeat("<p>Asiakirjat</p>", 200) + "</body></html>"
+	handler := CompressionMiddleware(1024, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("ETag", `"abc"`)
+			io.WriteString(w, page)
+		case "/small":
+			io.WriteString(w, "<html></html>")
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, page)
+		case "/precompressed":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, page)
+		}
+	}))
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/page", "gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("ETag") != `W/"abc"` || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("expected a gzip response with a weak ETag, got %v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != page {
+		t.Error("gzip body does not match the page")
+	}
+
+	w = get("/page", "gzip, br")
+	if w.Header().Get("Content-Encoding") != "br" {
+		t.Fatalf("expected brotli, got %v", w.Header())
+	}
+	if body, _ := io.ReadAll(brotli.NewReader(w.Body)); string(body) != page {
+		t.Error("brotli body does not match the page")
+	}
+
+	for _, path := range []string{"/small", "/image"} {
+		if w := get(path, "gzip"); w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s: expected no compression, got %q", path, w.Header().Get("Content-Encoding"))
+		}
+	}
+	if w := get("/precompressed", "br"); w.Header().Get("Content-Encoding") != "gzip" || w.Body.String() != page {
+		t.Error("expected an already encoded response to pass through")
+	}
+	if w := get("/page", ""); w.Header().Get("Content-Encoding") != "" || w.Body.String() != page {
+		t.Error("expected no compression without Accept-Encoding")
+	}
+}
@@ -0,0 +1,685 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// The declarative API manages configuration by natural key: PUT creates or
+// replaces a resource, DELETE removes it, and both may be repeated safely.
+// Responses carry an ETag that clients can send back in If-Match to guard
+// against concurrent changes.
+
+type projectResource struct {
+	ID                int64    `json:"id"`
+	Slug              string   `json:"slug"`
+	Name              string   `json:"name"`
+	Description       string   `json:"description"`
+	Visibility        string   `json:"visibility"`
+	RetentionDays     *int     `json:"retention_days"`
+	StorageQuota      *int64   `json:"storage_quota"`
+	MaxUploadSize     *int64   `json:"max_upload_size"`
+	Lifecycle         string   `json:"lifecycle"`
+	LifecycleMessage  string   `json:"lifecycle_message"`
+	Owner             string   `json:"owner"`
+	OwnerTeam         string   `json:"owner_team"`
+	OwnerContact      string   `json:"owner_contact"`
+	OwnerOrphaned     bool     `json:"owner_orphaned"`
+	FeedbackMode      string   `json:"feedback_mode"`
+	FeedbackURL       string   `json:"feedback_url"`
+	OverlayInclude    []string `json:"overlay_include"`
+	OverlayExclude    []string `json:"overlay_exclude"`
+	OverlayPosition   string   `json:"overlay_position"`
+	OverlayTheme      string   `json:"overlay_theme"`
+	OverlayColor      string   `json:"overlay_color"`
+	OverlayVisibility string   `json:"overlay_visibility"`
+	Redirects         []string `json:"redirects"`
+	VersionPattern    string   `json:"version_pattern"`
+	VersionSemverOnly bool     `json:"version_semver_only"`
+	NormalizeVersions bool     `json:"normalize_versions"`
+	ImmutableVersions bool     `json:"immutable_versions"`
+	LandingPath       string   `json:"landing_path"`
+	DetectLanding     bool     `json:"detect_landing"`
+	SanitizeHTML      bool     `json:"sanitize_html"`
+}
+
+type accessResource struct {
+	ID       int64  `json:"id"`
+	Project  string `json:"project"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type groupMappingResource struct {
+	ID              int64  `json:"id"`
+	Project         string `json:"project"`
+	AuthSource      string `json:"auth_source"`
+	GroupIdentifier string `json:"group_identifier"`
+	Role            string `json:"role"`
+	FromConfig      bool   `json:"from_config"`
+}
+
+func newProjectResource(p *database.Project) projectResource {
+	return projectResource{
+		ID:            p.ID,
+		Slug:          p.Slug,
+		Name:          p.Name,
+		Description:   p.Description,
+		Visibility:    p.Visibility,
+		RetentionDays: p.RetentionDays,
+		StorageQuota:  p.StorageQuota,
+		MaxUploadSize: p.MaxUploadSize,
+
+		Lifecycle:        p.Lifecycle,
+		LifecycleMessage: p.LifecycleMessage,
+		Owner:            p.Owner,
+		OwnerTeam:        p.OwnerTeam,
+		OwnerContact:     p.OwnerContact,
+		OwnerOrphaned:    p.OwnerOrphaned,
+		FeedbackMode:     p.FeedbackMode,
+		FeedbackURL:      p.FeedbackURL,
+		OverlayInclude:   overlayPathPatterns(p.OverlayInclude),
+		OverlayExclude:   overlayPathPatterns(p.OverlayExclude),
+		Redirects:        redirectLines(p.Redirects),
+
+		OverlayPosition:   p.OverlayPosition,
+		OverlayTheme:      p.OverlayTheme,
+		OverlayColor:      p.OverlayColor,
+		OverlayVisibility: p.OverlayVisibility,
+
+		VersionPattern:    p.VersionPattern,
+		VersionSemverOnly: p.VersionSemverOnly,
+		NormalizeVersions: p.NormalizeVersions,
+		ImmutableVersions: p.ImmutableVersions,
+		LandingPath:       p.LandingPath,
+		DetectLanding:     p.DetectLanding,
+		SanitizeHTML:      p.SanitizeHTML,
+	}
+}
+
+func newGroupMappingResource(slug string, m *database.AuthGroupMapping) groupMappingResource {
+	return groupMappingResource{
+		ID:              m.ID,
+		Project:         slug,
+		AuthSource:      m.AuthSource,
+		GroupIdentifier: m.GroupIdentifier,
+		Role:            m.Role,
+		FromConfig:      m.FromConfig,
+	}
+}
+
+// resourceETag returns a strong ETag derived from a resource's JSON form.
+func resourceETag(v any) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPreconditions evaluates If-Match and If-None-Match against the
+// current ETag of a resource, which is empty if it does not exist. It writes
+// 412 and returns false when a precondition fails.
+func (h *Handler) checkPreconditions(w http.ResponseWriter, r *http.Request, current string) bool {
+	if match := r.Header.Get("If-Match"); match != "" && (current == "" || !etagMatches(match, current)) {
+		h.jsonError(w, "Precondition failed: resource has changed", http.StatusPreconditionFailed)
+		return false
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" && current != "" && etagMatches(match, current) {
+		h.jsonError(w, "Precondition failed: resource already exists", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) writeResource(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", resourceETag(v))
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// authenticateAdminToken requires an admin:project token belonging to an
+// admin user.
+func (h *Handler) authenticateAdminToken(w http.ResponseWriter, r *http.Request, projectID int64) *database.User {
+	user := h.authenticateToken(w, r, projectID, auth.ScopeAdminProject)
+	if user == nil {
+		return nil
+	}
+	if user.Role != "admin" {
+		h.jsonError(w, "Forbidden: admin role required", http.StatusForbidden)
+		return nil
+	}
+	return user
+}
+
+func isGrantableRole(role string) bool {
+	return role == "viewer" || role == "editor"
+}
+
+func (h *Handler) handleAPIGetProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	h.writeResource(w, http.StatusOK, newProjectResource(project))
+}
+
+// handleAPIPutProject creates the project named by the path or replaces its
+// settings. Editors may create projects; changing one requires an admin.
+func (h *Handler) handleAPIPutProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	slug := r.PathValue("slug")
+
+	if !isValidSlug(slug) {
+		h.jsonError(w, "Invalid slug: must be 1-128 lowercase alphanumeric characters with hyphens", http.StatusBadRequest)
+		return
+	}
+
+	project, _ := h.projects.GetBySlug(ctx, slug)
+	var projectID int64
+	if project != nil {
+		projectID = project.ID
+	}
+
+	user := h.authenticateToken(w, r, projectID, auth.ScopeAdminProject)
+	if user == nil {
+		return
+	}
+	if user.Role != "admin" && (project != nil || user.Role != "editor") {
+		h.jsonError(w, "Forbidden: insufficient role", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Name              string   `json:"name"`
+		Description       string   `json:"description"`
+		Visibility        string   `json:"visibility"`
+		RetentionDays     *int     `json:"retention_days"`
+		StorageQuota      *int64   `json:"storage_quota"`
+		MaxUploadSize     *int64   `json:"max_upload_size"`
+		Lifecycle         string   `json:"lifecycle"`
+		LifecycleMessage  string   `json:"lifecycle_message"`
+		Owner             string   `json:"owner"`
+		OwnerTeam         string   `json:"owner_team"`
+		OwnerContact      string   `json:"owner_contact"`
+		FeedbackMode      string   `json:"feedback_mode"`
+		FeedbackURL       string   `json:"feedback_url"`
+		OverlayInclude    []string `json:"overlay_include"`
+		OverlayExclude    []string `json:"overlay_exclude"`
+		OverlayPosition   string   `json:"overlay_position"`
+		OverlayTheme      string   `json:"overlay_theme"`
+		OverlayColor      string   `json:"overlay_color"`
+		OverlayVisibility string   `json:"overlay_visibility"`
+		Redirects         []string `json:"redirects"`
+		VersionPattern    string   `json:"version_pattern"`
+		VersionSemverOnly bool     `json:"version_semver_only"`
+		NormalizeVersions bool     `json:"normalize_versions"`
+		ImmutableVersions bool     `json:"immutable_versions"`
+		LandingPath       string   `json:"landing_path"`
+		DetectLanding     bool     `json:"detect_landing"`
+		SanitizeHTML      bool     `json:"sanitize_html"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		req.Name = slug
+	}
+	if req.Visibility == "" {
+		req.Visibility = database.VisibilityPrivate
+	}
+	if !validVisibility(req.Visibility) {
+		h.jsonError(w, "Invalid visibility: must be public, unlisted, private, or custom", http.StatusBadRequest)
+		return
+	}
+	if req.RetentionDays != nil && *req.RetentionDays < 0 {
+		h.jsonError(w, "Invalid retention_days: must be zero or positive", http.StatusBadRequest)
+		return
+	}
+	if (req.StorageQuota != nil && *req.StorageQuota < 0) || (req.MaxUploadSize != nil && *req.MaxUploadSize < 0) {
+		h.jsonError(w, "Invalid storage_quota or max_upload_size: must be zero or positive", http.StatusBadRequest)
+		return
+	}
+	lifecycle, err := validateLifecycle(req.Lifecycle, req.LifecycleMessage)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateOwnerContact(req.OwnerContact); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateFeedbackSettings(req.FeedbackMode, req.FeedbackURL); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	overlayInclude := strings.Join(req.OverlayInclude, "\n")
+	overlayExclude := strings.Join(req.OverlayExclude, "\n")
+	for _, paths := range []string{overlayInclude, overlayExclude} {
+		if err := validateOverlayPaths(paths); err != nil {
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := validateOverlayStyle(req.OverlayPosition, req.OverlayTheme, req.OverlayColor, req.OverlayVisibility); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	redirects := strings.Join(req.Redirects, "\n")
+	if err := validateRedirects(redirects); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateVersionPattern(req.VersionPattern); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateLandingPath(req.LandingPath); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	current := ""
+	if project != nil {
+		current = resourceETag(newProjectResource(project))
+	}
+	if !h.checkPreconditions(w, r, current) {
+		return
+	}
+
+	if project == nil {
+		project = &database.Project{
+			Slug:          slug,
+			Name:          req.Name,
+			Description:   req.Description,
+			Visibility:    req.Visibility,
+			RetentionDays: req.RetentionDays,
+			StorageQuota:  req.StorageQuota,
+			MaxUploadSize: req.MaxUploadSize,
+
+			Lifecycle:        lifecycle,
+			LifecycleMessage: req.LifecycleMessage,
+			Owner:            req.Owner,
+			OwnerTeam:        req.OwnerTeam,
+			OwnerContact:     req.OwnerContact,
+			FeedbackMode:     req.FeedbackMode,
+			FeedbackURL:      req.FeedbackURL,
+			OverlayInclude:   overlayInclude,
+			OverlayExclude:   overlayExclude,
+			Redirects:        redirects,
+
+			OverlayPosition:   req.OverlayPosition,
+			OverlayTheme:      req.OverlayTheme,
+			OverlayColor:      req.OverlayColor,
+			OverlayVisibility: req.OverlayVisibility,
+
+			VersionPattern:    req.VersionPattern,
+			VersionSemverOnly: req.VersionSemverOnly,
+			NormalizeVersions: req.NormalizeVersions,
+			ImmutableVersions: req.ImmutableVersions,
+			LandingPath:       req.LandingPath,
+			DetectLanding:     req.DetectLanding,
+			SanitizeHTML:      req.SanitizeHTML,
+		}
+		if err := h.projects.Create(ctx, project); err != nil {
+			h.logger.ErrorContext(ctx, "creating project via API", "error", err)
+			h.jsonError(w, "Failed to create project", http.StatusInternalServerError)
+			return
+		}
+		if err := h.checkOwner(ctx, project, user.Username); err != nil {
+			h.logger.ErrorContext(ctx, "checking project owner", "error", err, "project", slug)
+		}
+		if err := h.storage.EnsureProjectDir(slug); err != nil {
+			h.logger.ErrorContext(ctx, "creating project directory", "error", err)
+		}
+		if user.Role != "admin" && req.Visibility != database.VisibilityPublic {
+			access := &database.ProjectAccess{ProjectID: project.ID, UserID: user.ID, Role: "editor"}
+			if err := h.access.Grant(ctx, access); err != nil {
+				h.logger.ErrorContext(ctx, "auto-granting creator access", "error", err)
+			}
+		}
+		h.emitEvent(ctx, database.EventProjectCreated, slug, projectEventData(project, user))
+		h.writeResource(w, http.StatusCreated, newProjectResource(project))
+		return
+	}
+
+	project.Name = req.Name
+	project.Description = req.Description
+	project.Visibility = req.Visibility
+	project.RetentionDays = req.RetentionDays
+	project.StorageQuota = req.StorageQuota
+	project.MaxUploadSize = req.MaxUploadSize
+	previousLifecycle := project.Lifecycle
+	project.Lifecycle = lifecycle
+	project.LifecycleMessage = req.LifecycleMessage
+	project.Owner = req.Owner
+	project.OwnerTeam = req.OwnerTeam
+	project.OwnerContact = req.OwnerContact
+	project.FeedbackMode = req.FeedbackMode
+	project.FeedbackURL = req.FeedbackURL
+	project.OverlayInclude = overlayInclude
+	project.OverlayExclude = overlayExclude
+	project.OverlayPosition = req.OverlayPosition
+	project.OverlayTheme = req.OverlayTheme
+	project.OverlayColor = req.OverlayColor
+	project.OverlayVisibility = req.OverlayVisibility
+	project.Redirects = redirects
+	project.VersionPattern = req.VersionPattern
+	project.VersionSemverOnly = req.VersionSemverOnly
+	project.NormalizeVersions = req.NormalizeVersions
+	project.ImmutableVersions = req.ImmutableVersions
+	project.LandingPath = req.LandingPath
+	project.DetectLanding = req.DetectLanding
+	project.SanitizeHTML = req.SanitizeHTML
+	if resourceETag(newProjectResource(project)) != current {
+		if err := h.projects.Update(ctx, project); err != nil {
+			h.logger.ErrorContext(ctx, "updating project via API", "error", err)
+			h.jsonError(w, "Failed to update project", http.StatusInternalServerError)
+			return
+		}
+		h.emitEvent(ctx, database.EventProjectUpdated, slug, projectEventData(project, user))
+		if previousLifecycle != lifecycle {
+			h.recordLifecycleChange(ctx, project, "", previousLifecycle, lifecycle, req.LifecycleMessage, user)
+		}
+		if err := h.checkOwner(ctx, project, user.Username); err != nil {
+			h.logger.ErrorContext(ctx, "checking project owner", "error", err, "project", slug)
+		}
+	}
+	h.writeResource(w, http.StatusOK, newProjectResource(project))
+}
+
+// handleAPIDeleteProject deletes the project named by the path with all
+// its versions. It requires an admin.
+func (h *Handler) handleAPIDeleteProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	project, _ := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	var projectID int64
+	if project != nil {
+		projectID = project.ID
+	}
+	user := h.authenticateAdminToken(w, r, projectID)
+	if user == nil {
+		return
+	}
+
+	current := ""
+	if project != nil {
+		current = resourceETag(newProjectResource(project))
+	}
+	if !h.checkPreconditions(w, r, current) {
+		return
+	}
+	if project != nil {
+		if err := h.deleteProject(ctx, project, user); err != nil {
+			h.logger.ErrorContext(ctx, "deleting project via API", "error", err)
+			h.jsonError(w, "Failed to delete project", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// accessTarget resolves the project and user of an access grant path and
+// authenticates the caller, who is returned as well.
+func (h *Handler) accessTarget(w http.ResponseWriter, r *http.Request) (*database.Project, *database.User, *database.User, bool) {
+	ctx := r.Context()
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return nil, nil, nil, false
+	}
+	caller := h.authenticateAdminToken(w, r, project.ID)
+	if caller == nil {
+		return nil, nil, nil, false
+	}
+	user, err := h.users.GetByUsername(ctx, r.PathValue("username"))
+	if err != nil {
+		h.jsonError(w, "User not found", http.StatusNotFound)
+		return nil, nil, nil, false
+	}
+	return project, user, caller, true
+}
+
+// manualAccess returns the manually granted access of a user, if any.
+// Grants synced from LDAP or OAuth2 are not managed through the API.
+func (h *Handler) manualAccess(ctx context.Context, project *database.Project, user *database.User) (*accessResource, string) {
+	access, err := h.access.GetAccessBySource(ctx, project.ID, user.ID, "manual")
+	if err != nil || access == nil {
+		return nil, ""
+	}
+	res := &accessResource{ID: access.ID, Project: project.Slug, Username: user.Username, Role: access.Role}
+	return res, resourceETag(res)
+}
+
+func (h *Handler) handleAPIGetAccess(w http.ResponseWriter, r *http.Request) {
+	project, user, _, ok := h.accessTarget(w, r)
+	if !ok {
+		return
+	}
+	res, _ := h.manualAccess(r.Context(), project, user)
+	if res == nil {
+		h.jsonError(w, "Access grant not found", http.StatusNotFound)
+		return
+	}
+	h.writeResource(w, http.StatusOK, res)
+}
+
+func (h *Handler) handleAPIPutAccess(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, user, caller, ok := h.accessTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !isGrantableRole(req.Role) {
+		h.jsonError(w, "Invalid body: role must be viewer or editor", http.StatusBadRequest)
+		return
+	}
+
+	existing, current := h.manualAccess(ctx, project, user)
+	if !h.checkPreconditions(w, r, current) {
+		return
+	}
+	if existing == nil || existing.Role != req.Role {
+		access := &database.ProjectAccess{ProjectID: project.ID, UserID: user.ID, Role: req.Role, Source: "manual"}
+		if err := h.access.Grant(ctx, access); err != nil {
+			h.logger.ErrorContext(ctx, "granting access via API", "error", err)
+			h.jsonError(w, "Failed to grant access", http.StatusInternalServerError)
+			return
+		}
+		h.emitAccessEvent(ctx, database.EventAccessGranted, project, caller, user.ID, req.Role)
+	}
+
+	res, _ := h.manualAccess(ctx, project, user)
+	if res == nil {
+		h.jsonError(w, "Failed to grant access", http.StatusInternalServerError)
+		return
+	}
+	code := http.StatusOK
+	if existing == nil {
+		code = http.StatusCreated
+	}
+	h.writeResource(w, code, res)
+}
+
+func (h *Handler) handleAPIDeleteAccess(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, user, caller, ok := h.accessTarget(w, r)
+	if !ok {
+		return
+	}
+
+	existing, current := h.manualAccess(ctx, project, user)
+	if !h.checkPreconditions(w, r, current) {
+		return
+	}
+	if existing != nil {
+		if err := h.access.RevokeBySource(ctx, project.ID, user.ID, "manual"); err != nil {
+			h.logger.ErrorContext(ctx, "revoking access via API", "error", err)
+			h.jsonError(w, "Failed to revoke access", http.StatusInternalServerError)
+			return
+		}
+		h.emitAccessEvent(ctx, database.EventAccessRevoked, project, caller, user.ID, "")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// groupMappingTarget resolves the project, auth source and group of a group
+// mapping path, authenticates the caller, and returns the mapping if it
+// exists.
+func (h *Handler) groupMappingTarget(w http.ResponseWriter, r *http.Request) (*database.Project, *database.AuthGroupMapping, bool) {
+	ctx := r.Context()
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if h.authenticateAdminToken(w, r, project.ID) == nil {
+		return nil, nil, false
+	}
+
+	source := r.PathValue("source")
+	group := r.PathValue("group")
+	if !isGroupMappingSource(source) {
+		h.jsonError(w, "Invalid auth source: must be ldap, oauth2, proxy or scim", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	if group == "" {
+		h.jsonError(w, "Group identifier is required", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	mappings, err := h.groupMappings.ListBySource(ctx, source)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing group mappings", "error", err)
+		h.jsonError(w, "Failed to list group mappings", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	for i := range mappings {
+		if mappings[i].ProjectID == project.ID && mappings[i].GroupIdentifier == group {
+			return project, &mappings[i], true
+		}
+	}
+	return project, &database.AuthGroupMapping{AuthSource: source, GroupIdentifier: group, ProjectID: project.ID}, true
+}
+
+func (h *Handler) handleAPIGetGroupMapping(w http.ResponseWriter, r *http.Request) {
+	project, mapping, ok := h.groupMappingTarget(w, r)
+	if !ok {
+		return
+	}
+	if mapping.ID == 0 {
+		h.jsonError(w, "Group mapping not found", http.StatusNotFound)
+		return
+	}
+	h.writeResource(w, http.StatusOK, newGroupMappingResource(project.Slug, mapping))
+}
+
+func (h *Handler) handleAPIPutGroupMapping(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, mapping, ok := h.groupMappingTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !isGrantableRole(req.Role) {
+		h.jsonError(w, "Invalid body: role must be viewer or editor", http.StatusBadRequest)
+		return
+	}
+
+	current := ""
+	if mapping.ID != 0 {
+		current = resourceETag(newGroupMappingResource(project.Slug, mapping))
+	}
+	if !h.checkPreconditions(w, r, current) {
+		return
+	}
+	if mapping.FromConfig {
+		h.jsonError(w, "Group mapping is defined in the configuration file", http.StatusConflict)
+		return
+	}
+
+	code := http.StatusOK
+	switch {
+	case mapping.ID == 0:
+		mapping.Role = req.Role
+		if err := h.groupMappings.Create(ctx, mapping); err != nil {
+			h.logger.ErrorContext(ctx, "creating group mapping via API", "error", err)
+			h.jsonError(w, "Failed to create group mapping", http.StatusInternalServerError)
+			return
+		}
+		code = http.StatusCreated
+	case mapping.Role != req.Role:
+		mapping.Role = req.Role
+		if err := h.groupMappings.Update(ctx, mapping); err != nil {
+			h.logger.ErrorContext(ctx, "updating group mapping via API", "error", err)
+			h.jsonError(w, "Failed to update group mapping", http.StatusInternalServerError)
+			return
+		}
+	}
+	if mapping.AuthSource == scimSource {
+		h.syncSCIMMembers(ctx)
+	}
+	h.writeResource(w, code, newGroupMappingResource(project.Slug, mapping))
+}
+
+func (h *Handler) handleAPIDeleteGroupMapping(w http.ResponseWriter, r *http.Request) {
+	project, mapping, ok := h.groupMappingTarget(w, r)
+	if !ok {
+		return
+	}
+
+	current := ""
+	if mapping.ID != 0 {
+		current = resourceETag(newGroupMappingResource(project.Slug, mapping))
+	}
+	if !h.checkPreconditions(w, r, current) {
+		return
+	}
+	if mapping.FromConfig {
+		h.jsonError(w, "Group mapping is defined in the configuration file", http.StatusConflict)
+		return
+	}
+	if mapping.ID != 0 {
+		if err := h.groupMappings.Delete(r.Context(), mapping.ID); err != nil {
+			h.logger.ErrorContext(r.Context(), "deleting group mapping via API", "error", err)
+			h.jsonError(w, "Failed to delete group mapping", http.StatusInternalServerError)
+			return
+		}
+		if mapping.AuthSource == scimSource {
+			h.syncSCIMMembers(r.Context())
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
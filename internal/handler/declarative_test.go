@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// adminAPIToken creates a global admin:project token for an admin robot.
+func adminAPIToken(t *testing.T, app *testApp) string {
+	t.Helper()
+	ctx := context.Background()
+	robot := &database.User{Username: "terraform", AuthSource: "robot", Role: "admin", IsRobot: true}
+	if err := app.handler.users.Create(ctx, robot); err != nil {
+		t.Fatal(err)
+	}
+	rawToken, _ := auth.GenerateToken(32)
+	app.handler.tokens.Create(ctx, &database.APIToken{
+		UserID:    robot.ID,
+		TokenHash: auth.HashToken(rawToken),
+		Name:      "terraform",
+		Scopes:    "admin:project,read",
+	})
+	return rawToken
+}
+
+func apiRequest(t *testing.T, app *testApp, method, path, token, body string, header map[string]string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, app.server.URL+path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestAPIPutProjectIsIdempotent(t *testing.T) {
+	app := setupTestApp(t)
+	token := adminAPIToken(t, app)
+	body := `{"name": "Handbook", "visibility": "public", "retention_days": 30}`
+
+	resp := apiRequest(t, app, "PUT", "/api/project/handbook", token, body, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 on create, got %d", resp.StatusCode)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("expected ETag header")
+	}
+
+	resp = apiRequest(t, app, "PUT", "/api/project/handbook", token, body, map[string]string{"If-Match": etag})
+	var res projectResource
+	json.NewDecoder(resp.Body).Decode(&res)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 on repeat, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("ETag") != etag {
+		t.Error("expected unchanged ETag for identical PUT")
+	}
+	if res.RetentionDays == nil || *res.RetentionDays != 30 {
+		t.Errorf("expected retention_days 30, got %v", res.RetentionDays)
+	}
+
+	// Change the project, then retry with the stale ETag
+	resp = apiRequest(t, app, "PUT", "/api/project/handbook", token, `{"name": "Renamed", "visibility": "public"}`, nil)
+	resp.Body.Close()
+	resp = apiRequest(t, app, "PUT", "/api/project/handbook", token, body, map[string]string{"If-Match": etag})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for stale If-Match, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "GET", "/api/project/handbook", token, "", nil)
+	json.NewDecoder(resp.Body).Decode(&res)
+	resp.Body.Close()
+	if res.Name != "Renamed" || res.RetentionDays != nil {
+		t.Errorf("expected replaced settings, got %+v", res)
+	}
+}
+
+func TestAPIPutAccessGrant(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := adminAPIToken(t, app)
+	project := seedProject(t, app, "team-docs", "Team Docs", false)
+	viewer := &database.User{Username: "alice", AuthSource: "builtin", Role: "viewer"}
+	app.handler.users.Create(ctx, viewer)
+
+	path := "/api/project/team-docs/access/alice"
+	resp := apiRequest(t, app, "PUT", path, token, `{"role": "editor"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	resp = apiRequest(t, app, "PUT", path, token, `{"role": "editor"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 on repeat, got %d", resp.StatusCode)
+	}
+	if role, _ := app.handler.access.GetEffectiveRole(ctx, project.ID, viewer.ID); role != "editor" {
+		t.Errorf("expected editor role, got %q", role)
+	}
+
+	resp = apiRequest(t, app, "PUT", path, token, `{"role": "admin"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid role, got %d", resp.StatusCode)
+	}
+
+	for range 2 {
+		resp = apiRequest(t, app, "DELETE", path, token, "", nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("expected 204 on delete, got %d", resp.StatusCode)
+		}
+	}
+	if _, err := app.handler.access.GetAccess(ctx, project.ID, viewer.ID); err == nil {
+		t.Error("expected grant to be revoked")
+	}
+}
+
+func TestAPIPutGroupMapping(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := adminAPIToken(t, app)
+	project := seedProject(t, app, "team-docs", "Team Docs", false)
+
+	path := "/api/project/team-docs/group-mappings/ldap/cn=docs,ou=groups,dc=example,dc=com"
+	resp := apiRequest(t, app, "PUT", path, token, `{"role": "viewer"}`, map[string]string{"If-None-Match": "*"})
+	var created groupMappingResource
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+
+	// If-None-Match: * only creates
+	resp = apiRequest(t, app, "PUT", path, token, `{"role": "editor"}`, map[string]string{"If-None-Match": "*"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for existing mapping, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "PUT", path, token, `{"role": "editor"}`, nil)
+	var updated groupMappingResource
+	json.NewDecoder(resp.Body).Decode(&updated)
+	resp.Body.Close()
+	if updated.ID != created.ID || updated.Role != "editor" {
+		t.Errorf("expected same mapping with editor role, got %+v", updated)
+	}
+
+	mappings, _ := app.handler.groupMappings.ListBySource(ctx, "ldap")
+	if len(mappings) != 1 || mappings[0].ProjectID != project.ID {
+		t.Errorf("expected a single mapping, got %+v", mappings)
+	}
+}
+
+func TestAPIDeclarativeRequiresAdmin(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := uploadTokenForProject(t, app, "team-docs")
+	app.handler.users.Create(ctx, &database.User{Username: "alice", AuthSource: "builtin", Role: "viewer"})
+
+	resp := apiRequest(t, app, "PUT", "/api/project/team-docs/access/alice", token, `{"role": "editor"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 without admin:project scope, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIDeleteProject(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	token := adminAPIToken(t, app)
+	project := seedProject(t, app, "handbook", "Handbook", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+
+	resp := apiRequest(t, app, "GET", "/api/project/handbook", token, "", nil)
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+
+	resp = apiRequest(t, app, "DELETE", "/api/project/handbook", token, "", map[string]string{"If-Match": `"stale"`})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for stale If-Match, got %d", resp.StatusCode)
+	}
+
+	for range 2 {
+		resp = apiRequest(t, app, "DELETE", "/api/project/handbook", token, "", map[string]string{"If-Match": etag})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("expected 204, got %d", resp.StatusCode)
+		}
+		etag = ""
+	}
+	if _, err := app.handler.projects.GetBySlug(context.Background(), "handbook"); err == nil {
+		t.Error("expected the project to be deleted")
+	}
+
+	seedProject(t, app, "team-docs", "Team Docs", false)
+	resp = apiRequest(t, app, "DELETE", "/api/project/team-docs", uploadTokenForProject(t, app, "uploads"), "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 without admin:project scope, got %d", resp.StatusCode)
+	}
+}
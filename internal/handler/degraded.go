@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// degradedPingTimeout is how long a database check may take before the
+// database counts as unreachable.
+const degradedPingTimeout = 5 * time.Second
+
+// degradedRetryAfter is the Retry-After value, in seconds, of requests
+// refused while the database is unreachable.
+const degradedRetryAfter = "30"
+
+// degradedBanner is shown on documentation pages served in degraded mode.
+const degradedBanner = `<div role="status" style="position:fixed;top:0;left:0;right:0;z-index:2147483647;padding:.5em 1em;background:#fff3cd;color:#664d03;border-bottom:1px solid #ffe69c;font:14px/1.4 system-ui,sans-serif;text-align:center">` +
+	`The documentation server is running in degraded mode. Search, logins and private projects are unavailable until it recovers.</div>`
+
+// MonitorDatabase checks the database every degraded.check_interval
+// seconds until ctx is cancelled. While the database is unreachable the
+// handler is in degraded mode, see DegradedMiddleware.
+func (h *Handler) MonitorDatabase(ctx context.Context) {
+	interval := time.Duration(h.config.Degraded.CheckInterval) * time.Second
+	if h.dbPing == nil || interval <= 0 {
+		return
+	}
+	h.checkDatabase(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.checkDatabase(ctx)
+		}
+	}
+}
+
+// checkDatabase pings the database and enters or leaves degraded mode.
+// While the database is reachable it also records the projects anonymous
+// readers can view, whose documentation stays readable in degraded mode.
+func (h *Handler) checkDatabase(ctx context.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx, degradedPingTimeout)
+	err := h.dbPing(pingCtx)
+	cancel()
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		if !h.dbDown.Swap(true) {
+			h.logger.ErrorContext(ctx, "database unreachable, entering degraded mode", "error", err)
+		}
+		return
+	}
+	if h.dbDown.Swap(false) {
+		h.logger.InfoContext(ctx, "database reachable again, leaving degraded mode")
+	}
+
+	if !h.config.Degraded.ServeDocs || !h.config.Access.AllowAnonymous {
+		return
+	}
+	projects, err := h.projects.List(ctx)
+	if err != nil {
+		h.logger.WarnContext(ctx, "listing projects for degraded mode", "error", err)
+		return
+	}
+	public := make(map[string]*database.Project)
+	for i := range projects {
+		if h.canViewProject(ctx, nil, &projects[i]) {
+			public[projects[i].Slug] = &projects[i]
+		}
+	}
+	h.degradedProjects.Store(&public)
+}
+
+// DegradedMiddleware answers the requests that need the database with a
+// 503 while it is unreachable. Static files and the health check are
+// still served, and with degraded.serve_docs so is the documentation of
+// the projects anonymous readers could view when the database was last
+// reachable.
+func (h *Handler) DegradedMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.dbDown.Load() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, h.config.RoutePrefix())
+		if strings.HasPrefix(path, "/static/") || isHealthPath(path) || isHealthPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && h.serveDegradedDoc(w, r, path) {
+			return
+		}
+
+		w.Header().Set("Retry-After", degradedRetryAfter)
+		if strings.HasPrefix(path, "/api/") {
+			h.jsonError(w, "Service unavailable: the database is unreachable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		// Feature flags are in the database, so the defaults are used
+		h.render(w, "degraded", map[string]any{"Features": map[string]bool{}})
+	})
+}
+
+// serveDegradedDoc serves a documentation file from disk without the
+// database, if path is one of a project anonymous readers can view. Pages
+// get a banner instead of the overlay, whose links need the database.
+func (h *Handler) serveDegradedDoc(w http.ResponseWriter, r *http.Request, path string) bool {
+	projects := h.degradedProjects.Load()
+	rest, ok := strings.CutPrefix(path, "/project/")
+	parts := strings.SplitN(rest, "/", 3)
+	if projects == nil || !ok || len(parts) < 3 {
+		return false
+	}
+	slug, tag, filePath := parts[0], parts[1], parts[2]
+	project := (*projects)[slug]
+	if project == nil || tag == "" || tag == "." || tag == ".." {
+		return false
+	}
+	storagePath := h.storage.VersionPath(slug, tag)
+	if info, err := os.Stat(storagePath); err != nil || !info.IsDir() {
+		return false
+	}
+
+	inject, sniff := overlayInjection(project, filePath)
+	if !inject {
+		docs.ServeDocWithOptions(w, r, storagePath, filePath, h.docServeOptions(project, ""))
+		return true
+	}
+	// Revalidated, so the banner goes away once the database is back
+	w.Header().Set("Cache-Control", "no-cache")
+	opts := docs.ServeOptions{Variant: degradedBanner, Cache: h.fileCache}
+	docs.InjectOverlayWithOptions(w, r, docs.OverlayOptions{
+		OverlayHTML: degradedBanner,
+		MaxSize:     h.config.Overlay.MaxSizeBytes(),
+		Sniff:       sniff,
+	}, func(rw http.ResponseWriter, req *http.Request) {
+		docs.ServeDocWithOptions(rw, req, storagePath, filePath, opts)
+	})
+	return true
+}
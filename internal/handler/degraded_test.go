@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDegradedMode(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	public := seedProject(t, app, "public-docs", "Public Docs", true)
+	private := seedProject(t, app, "private-docs", "Private Docs", false)
+	seedSEOVersion(t, app, public, admin, "1.0.0")
+	seedSEOVersion(t, app, private, admin, "1.0.0")
+	os.WriteFile(filepath.Join(app.handler.storage.VersionPath("public-docs", "1.0.0"), "index.html"),
+		[]byte("<html><body><h1>Public page</h1></body></html>"), 0644)
+
+	var pingErr error
+	app.handler.dbPing = func(context.Context) error { return pingErr }
+	server := httptest.NewServer(app.handler.DegradedMiddleware(app.mux))
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	ctx := context.Background()
+	app.handler.checkDatabase(ctx)
+	if status, body := get("/project/public-docs/1.0.0/"); status != http.StatusOK || strings.Contains(body, "degraded mode") {
+		t.Fatalf("expected the normal page while the database is up, got %d", status)
+	}
+
+	pingErr = errors.New("connection refused")
+	app.handler.checkDatabase(ctx)
+
+	status, body := get("/project/public-docs/1.0.0/")
+	if status != http.StatusOK || !strings.Contains(body, "Public page") || !strings.Contains(body, "degraded mode") {
+		t.Errorf("expected the public page with the banner, got %d %q", status, body)
+	}
+	if status, body := get("/project/public-docs/1.0.0/style.css"); status != http.StatusOK || strings.Contains(body, "degraded mode") {
+		t.Errorf("expected assets without the banner, got %d", status)
+	}
+	if status, _ := get("/project/private-docs/1.0.0/"); status != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for a private project, got %d", status)
+	}
+	if status, _ := get("/project/public-docs/2.0.0/"); status != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for a version that is not on disk, got %d", status)
+	}
+	if status, body := get("/"); status != http.StatusServiceUnavailable || !strings.Contains(body, "Temporarily Unavailable") {
+		t.Errorf("expected the status page, got %d", status)
+	}
+	if status, body := get("/api/projects"); status != http.StatusServiceUnavailable || !strings.Contains(body, "database is unreachable") {
+		t.Errorf("expected a JSON 503, got %d %q", status, body)
+	}
+	if status, body := get("/healthz"); status != http.StatusOK || !strings.Contains(body, "degraded") {
+		t.Errorf("expected a degraded health check, got %d %q", status, body)
+	}
+
+	pingErr = nil
+	app.handler.checkDatabase(ctx)
+	if status, _ := get("/"); status != http.StatusOK {
+		t.Errorf("expected the front page once the database is back, got %d", status)
+	}
+}
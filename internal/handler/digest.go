@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// digestPeriods are how long a digest covers, by frequency.
+var digestPeriods = map[string]time.Duration{
+	database.DigestDaily:  24 * time.Hour,
+	database.DigestWeekly: 7 * 24 * time.Hour,
+}
+
+// digestSlack lets a digest go out on its scheduled run even if the last
+// one went out a little later than scheduled.
+const digestSlack = time.Hour
+
+// watchDigest returns how often a user gets the digest. Users who never
+// chose get a weekly digest, counted from since.
+func (h *Handler) watchDigest(ctx context.Context, userID int64, since time.Time) (*database.Digest, error) {
+	digest, err := h.watchers.GetDigest(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &database.Digest{UserID: userID, Frequency: database.DigestWeekly, SentAt: since}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if digestPeriods[digest.Frequency] == 0 {
+		digest.Frequency = database.DigestWeekly
+	}
+	return digest, nil
+}
+
+// runWatchDigests emails the users whose digest is due the versions of the
+// projects they watch with the digest that were uploaded since their last
+// digest. Users without new versions get no email, but their period starts
+// over all the same.
+func (h *Handler) runWatchDigests(ctx context.Context) error {
+	watchers, err := h.watchers.ListByChannel(ctx, database.WatchDigest)
+	if err != nil {
+		return fmt.Errorf("listing digest watchers: %w", err)
+	}
+	byUser := make(map[int64][]database.Watcher)
+	var users []int64
+	for _, wt := range watchers {
+		if _, ok := byUser[wt.UserID]; !ok {
+			users = append(users, wt.UserID)
+		}
+		byUser[wt.UserID] = append(byUser[wt.UserID], wt)
+	}
+
+	now := time.Now().UTC()
+	sent := 0
+	for _, userID := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		ok, err := h.sendWatchDigest(ctx, userID, byUser[userID], now)
+		if err != nil {
+			return err
+		}
+		if ok {
+			sent++
+		}
+	}
+	if sent > 0 {
+		h.logger.InfoContext(ctx, "sent watch digests", "users", sent)
+	}
+	return nil
+}
+
+// digestVersion is a version listed in a digest.
+type digestVersion struct {
+	project *database.Project
+	version database.Version
+}
+
+// sendWatchDigest emails a user their digest if it is due and lists any
+// version, and reports whether it was sent.
+func (h *Handler) sendWatchDigest(ctx context.Context, userID int64, watchers []database.Watcher, now time.Time) (bool, error) {
+	user, err := h.users.GetByID(ctx, userID)
+	if err != nil || user.Deactivated || user.Email == "" {
+		return false, nil
+	}
+	since := watchers[0].CreatedAt
+	for _, wt := range watchers {
+		if wt.CreatedAt.Before(since) {
+			since = wt.CreatedAt
+		}
+	}
+	digest, err := h.watchDigest(ctx, userID, since)
+	if err != nil {
+		return false, fmt.Errorf("getting digest of %s: %w", user.Username, err)
+	}
+	period := digestPeriods[digest.Frequency]
+	if now.Before(digest.SentAt.Add(period - digestSlack)) {
+		return false, nil
+	}
+
+	var listed []digestVersion
+	for _, wt := range watchers {
+		project, err := h.projects.GetByID(ctx, wt.ProjectID)
+		if err != nil || !h.canViewProject(ctx, user, project) {
+			continue
+		}
+		versions, err := h.versions.ListByProject(ctx, project.ID)
+		if err != nil {
+			return false, fmt.Errorf("listing versions of %s: %w", project.Slug, err)
+		}
+		for _, v := range versions {
+			if v.CreatedAt.After(digest.SentAt) && !v.CreatedAt.After(now) {
+				listed = append(listed, digestVersion{project: project, version: v})
+			}
+		}
+	}
+
+	if len(listed) > 0 {
+		subject := fmt.Sprintf("Your %s digest: %d new versions", digest.Frequency, len(listed))
+		if len(listed) == 1 {
+			subject = fmt.Sprintf("Your %s digest: 1 new version", digest.Frequency)
+		}
+		h.sendEmail(ctx, []string{user.Email}, subject, h.digestBody(digest, listed))
+	}
+
+	digest.SentAt = now
+	if err := h.watchers.SetDigest(ctx, digest); err != nil {
+		return false, fmt.Errorf("saving digest of %s: %w", user.Username, err)
+	}
+	return len(listed) > 0, nil
+}
+
+// digestBody lists the versions of a digest by project, newest first.
+func (h *Handler) digestBody(digest *database.Digest, listed []digestVersion) string {
+	slices.SortStableFunc(listed, func(a, b digestVersion) int {
+		if c := strings.Compare(a.project.Name, b.project.Name); c != 0 {
+			return c
+		}
+		if c := b.version.CreatedAt.Compare(a.version.CreatedAt); c != 0 {
+			return c
+		}
+		return int(b.version.ID - a.version.ID)
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "New versions of the projects you watch since %s:\n", digest.SentAt.Format("2 Jan 2006 15:04 MST"))
+	for i, dv := range listed {
+		if i == 0 || dv.project.ID != listed[i-1].project.ID {
+			fmt.Fprintf(&b, "\n%s\n", dv.project.Name)
+		}
+		fmt.Fprintf(&b, "- %s", dv.version.Tag)
+		if link := h.emailLink("/project/" + dv.project.Slug + "/" + dv.version.Tag + "/"); link != "" {
+			b.WriteString(": " + strings.TrimSpace(link))
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "\n-- \nYou get this email because you watch these projects with the %s digest. Change how often on your profile.\n", digest.Frequency)
+	return b.String()
+}
+
+// handleSetDigest sets how often the user gets the digest. The period of
+// the next digest keeps its start.
+func (h *Handler) handleSetDigest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	frequency := r.FormValue("frequency")
+	if digestPeriods[frequency] == 0 {
+		h.renderProfile(w, r, map[string]any{
+			"Error": "Invalid digest frequency: must be daily or weekly",
+		})
+		return
+	}
+
+	digest, err := h.watchDigest(ctx, user.ID, time.Now().UTC())
+	if err != nil {
+		h.logger.ErrorContext(ctx, "getting watch digest", "error", err)
+		http.Error(w, "Failed to save digest frequency", http.StatusInternalServerError)
+		return
+	}
+	digest.Frequency = frequency
+	if err := h.watchers.SetDigest(ctx, digest); err != nil {
+		h.logger.ErrorContext(ctx, "setting watch digest", "error", err)
+		http.Error(w, "Failed to save digest frequency", http.StatusInternalServerError)
+		return
+	}
+	h.renderProfile(w, r, map[string]any{
+		"Success": "Digest frequency saved.",
+	})
+}
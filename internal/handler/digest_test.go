@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/store"
+)
+
+func TestWatchDigest(t *testing.T) {
+	app := setupTestApp(t)
+	mailer := &fakeMailer{}
+	app.handler.mailer = mailer
+	app.handler.config.Server.PublicURL = "https://docs.example.com"
+	ctx := context.Background()
+	admin := seedAdmin(t, app)
+	guide := seedProject(t, app, "guide", "Guide", true)
+	secret := seedProject(t, app, "secret", "Secret", false)
+
+	hash, _ := auth.HashPassword("secret")
+	reader := &database.User{Username: "ada", Email: "ada@example.com", Password: &hash, AuthSource: "builtin", Role: "viewer"}
+	app.handler.users.Create(ctx, reader)
+	cookies := loginUser(t, app, "ada", "secret")
+	postWithCookies(t, app, "/project/guide/watch", cookies, url.Values{"channel": {"digest"}})
+	app.handler.watchers.Set(ctx, reader.ID, secret.ID, []database.Watcher{{Channel: database.WatchDigest}})
+
+	if body := getWithCookies(t, app, "/profile", cookies); !strings.Contains(body, `<option value="weekly" selected>`) {
+		t.Error("expected the profile to offer the digest, weekly by default")
+	}
+
+	// Nothing is due within a week of watching
+	if err := app.handler.runWatchDigests(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := mailer.take(t, app); len(sent) != 0 {
+		t.Fatalf("expected no digest before a week passed, got %+v", sent)
+	}
+
+	weekAgo := time.Now().UTC().Add(-8 * 24 * time.Hour)
+	app.handler.watchers.SetDigest(ctx, &database.Digest{UserID: reader.ID, Frequency: database.DigestWeekly, SentAt: weekAgo})
+	for _, tag := range []string{"1.0.0", "1.1.0"} {
+		app.handler.versions.Create(ctx, &database.Version{ProjectID: guide.ID, Tag: tag, ContentType: "archive", StoragePath: "guide/" + tag, UploadedBy: admin.ID})
+	}
+	app.handler.versions.Create(ctx, &database.Version{ProjectID: secret.ID, Tag: "9.9.9", ContentType: "archive", StoragePath: "secret/9.9.9", UploadedBy: admin.ID})
+
+	if err := app.handler.runWatchDigests(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sent := mailer.take(t, app)
+	if len(sent) != 1 || sent[0].To[0] != "ada@example.com" || !strings.Contains(sent[0].Subject, "weekly digest: 2 new versions") {
+		t.Fatalf("expected a weekly digest of two versions to ada, got %+v", sent)
+	}
+	body := sent[0].Body
+	if !strings.Contains(body, "Guide\n- 1.1.0: https://docs.example.com/project/guide/1.1.0/\n- 1.0.0") {
+		t.Errorf("expected the versions of the project, newest first:\n%s", body)
+	}
+	if strings.Contains(body, "Secret") {
+		t.Errorf("expected no project the user cannot read:\n%s", body)
+	}
+
+	// The next digest covers the next week
+	if err := app.handler.runWatchDigests(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := mailer.take(t, app); len(sent) != 0 {
+		t.Fatalf("expected no second digest in the same week, got %+v", sent)
+	}
+
+	postWithCookies(t, app, "/profile/digest", cookies, url.Values{"frequency": {"daily"}})
+	digest, err := app.handler.watchers.GetDigest(ctx, reader.ID)
+	if err != nil || digest.Frequency != database.DigestDaily {
+		t.Fatalf("expected a daily digest, got %+v %v", digest, err)
+	}
+	if body := postWithCookies(t, app, "/profile/digest", cookies, url.Values{"frequency": {"hourly"}}); !strings.Contains(body, "Invalid digest frequency") {
+		t.Error("expected an unknown frequency to be refused")
+	}
+
+	// Without new versions no email is sent, but the period starts over
+	dayAgo := time.Now().UTC().Add(-25 * time.Hour)
+	app.handler.watchers.SetDigest(ctx, &database.Digest{UserID: reader.ID, Frequency: database.DigestDaily, SentAt: dayAgo})
+	app.handler.versions.Delete(ctx, mustVersion(t, app, guide.ID, "1.0.0").ID)
+	app.handler.versions.Delete(ctx, mustVersion(t, app, guide.ID, "1.1.0").ID)
+	if err := app.handler.runWatchDigests(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := mailer.take(t, app); len(sent) != 0 {
+		t.Fatalf("expected no empty digest, got %+v", sent)
+	}
+	if digest, _ := app.handler.watchers.GetDigest(ctx, reader.ID); !digest.SentAt.After(dayAgo) {
+		t.Errorf("expected the period to start over, got %v", digest.SentAt)
+	}
+}
+
+// failingDigests is a watcher store whose digests cannot be read.
+type failingDigests struct {
+	store.WatcherStore
+}
+
+func (failingDigests) GetDigest(context.Context, int64) (*database.Digest, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestWatchDigestReadError(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.mailer = &fakeMailer{}
+	ctx := context.Background()
+	seedProject(t, app, "guide", "Guide", true)
+	project, _ := app.handler.projects.GetBySlug(ctx, "guide")
+
+	hash, _ := auth.HashPassword("secret")
+	reader := &database.User{Username: "ada", Email: "ada@example.com", Password: &hash, AuthSource: "builtin", Role: "viewer"}
+	app.handler.users.Create(ctx, reader)
+	app.handler.watchers.Set(ctx, reader.ID, project.ID, []database.Watcher{{Channel: database.WatchDigest}})
+	dayAgo := time.Now().UTC().Add(-25 * time.Hour)
+	app.handler.watchers.SetDigest(ctx, &database.Digest{UserID: reader.ID, Frequency: database.DigestDaily, SentAt: dayAgo})
+
+	watchers := app.handler.watchers
+	app.handler.watchers = failingDigests{watchers}
+	if err := app.handler.runWatchDigests(ctx); err == nil {
+		t.Error("expected the read error to be returned")
+	}
+	app.handler.watchers = watchers
+
+	digest, err := watchers.GetDigest(ctx, reader.ID)
+	if err != nil || digest.Frequency != database.DigestDaily || digest.SentAt.Sub(dayAgo).Abs() > time.Second {
+		t.Errorf("expected the daily digest to be kept, got %+v %v", digest, err)
+	}
+}
+
+func mustVersion(t *testing.T, app *testApp, projectID int64, tag string) *database.Version {
+	t.Helper()
+	v, err := app.handler.versions.GetByProjectAndTag(context.Background(), projectID, tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
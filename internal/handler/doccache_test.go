@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestDocCachingHeaders(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	ctx := context.Background()
+
+	public := seedProject(t, app, "open", "Open", true)
+	seedSEOVersion(t, app, public, admin, "1.0.0")
+	custom := seedProject(t, app, "closed", "Closed", false)
+	seedSEOVersion(t, app, custom, admin, "1.0.0")
+	cookies := loginUser(t, app, "admin", "admin123")
+
+	get := func(path string, header http.Header) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", app.server.URL+path, nil)
+		for k, vs := range header {
+			req.Header[k] = vs
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get("/project/open/1.0.0/guide/intro.html", nil)
+	etag := resp.Header.Get("ETag")
+	if etag == "" || resp.Header.Get("Cache-Control") != "public, max-age=60" {
+		t.Fatalf("expected an ETag and a short public max-age, got %v", resp.Header)
+	}
+	if resp = get("/project/open/1.0.0/guide/intro.html", http.Header{"If-None-Match": {etag}}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304 for an unchanged page, got %d", resp.StatusCode)
+	}
+
+	// A changed overlay changes the page, so the old ETag no longer matches
+	public.OwnerTeam = "Docs Team"
+	app.handler.projects.Update(ctx, public)
+	if resp = get("/project/open/1.0.0/guide/intro.html", http.Header{"If-None-Match": {etag}}); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 after the overlay changed, got %d", resp.StatusCode)
+	}
+
+	if resp = get("/project/closed/1.0.0/style.css", nil); resp.Header.Get("Cache-Control") != "private, max-age=3600" {
+		t.Errorf("expected private caching for a restricted project, got %q", resp.Header.Get("Cache-Control"))
+	}
+}
@@ -230,3 +230,76 @@ func TestDownloadVersionNotFoundVersion(t *testing.T) {
 		t.Errorf("expected 404 for nonexistent version, got %d", resp.StatusCode)
 	}
 }
+
+func TestDownloadZipAtVersionURL(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "dl-zip", "Download Zip", true)
+
+	storage := app.handler.storage
+	storage.EnsureVersionDir("dl-zip", "v1.0.0")
+	versionPath := storage.VersionPath("dl-zip", "v1.0.0")
+	os.WriteFile(filepath.Join(versionPath, "index.html"), []byte("<html>offline</html>"), 0644)
+	app.handler.versions.Create(context.Background(), &database.Version{
+		ProjectID:   project.ID,
+		Tag:         "v1.0.0",
+		StoragePath: versionPath,
+		UploadedBy:  admin.ID,
+	})
+
+	resp, err := http.Get(app.server.URL + "/project/dl-zip/v1.0.0/download.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "index.html" {
+		t.Errorf("unexpected zip entries %v", zr.File)
+	}
+
+	// A download.zip that is part of the documentation is served as is
+	os.WriteFile(filepath.Join(versionPath, "download.zip"), []byte("shipped"), 0644)
+	resp2, err := http.Get(app.server.URL + "/project/dl-zip/v1.0.0/download.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+	if body, _ := io.ReadAll(resp2.Body); string(body) != "shipped" {
+		t.Errorf("expected the shipped download.zip, got %q", body)
+	}
+}
+
+func TestAPIDownloadVersionZip(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "dl-api")
+	resp := postArchive(t, app, "dl-api", token, "1.0.0", createTestZip(t, map[string]string{"index.html": "<html>api</html>"}))
+	resp.Body.Close()
+
+	// The project is private, so anonymous callers are rejected
+	resp, err := http.Get(app.server.URL + "/api/project/dl-api/version/1.0.0/download.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for anonymous caller, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", app.server.URL+"/api/project/dl-api/version/1.0.0/download.zip", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("expected zip download, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/email"
+	"github.com/qwc/asiakirjat/internal/templates"
+)
+
+const emailSendWait = 30 * time.Second
+
+// sendEmail sends a notification email in the background if email is
+// configured. Like events, failures are only logged.
+func (h *Handler) sendEmail(ctx context.Context, to []string, subject, body string) {
+	if h.mailer == nil || len(to) == 0 {
+		return
+	}
+	msg := email.Message{
+		To:      to,
+		Subject: "[" + templates.GetBranding().AppName + "] " + subject,
+		Body:    body,
+	}
+	h.goJob(ctx, func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, emailSendWait)
+		defer cancel()
+		if err := h.mailer.Send(ctx, msg); err != nil {
+			h.logger.ErrorContext(ctx, "sending email", "error", err, "subject", subject, "recipients", len(to))
+		}
+	})
+}
+
+// emailLink returns the URL of path for emails, followed by a blank line,
+// or "" if the public URL of the server is not configured: emails are sent
+// without a request to derive it from.
+func (h *Handler) emailLink(path string) string {
+	if h.config.Server.PublicURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(h.config.Server.PublicURL, "/") + path + "\n\n"
+}
+
+// notifyAccessGranted tells a user that they were given access to a
+// project.
+func (h *Handler) notifyAccessGranted(ctx context.Context, project *database.Project, actor, grantee *database.User, role string) {
+	if grantee.Email == "" || grantee.IsRobot {
+		return
+	}
+	body := fmt.Sprintf("%s gave you %s access to %s.\n\n%s-- \nYou get this email because your access to a project changed.\n",
+		eventActor(actor), role, project.Name, h.emailLink("/project/"+project.Slug))
+	h.sendEmail(ctx, []string{grantee.Email}, "You can now read "+project.Name, body)
+}
+
+// alertAdmins emails the configured admin addresses, or all admins with an
+// email address, about a problem that needs their attention. Body ends in
+// a blank line.
+func (h *Handler) alertAdmins(ctx context.Context, subject, body string) {
+	if h.mailer == nil {
+		return
+	}
+	to := h.config.Email.AdminAlerts
+	if len(to) == 0 {
+		users, err := h.users.List(ctx)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "listing admins to alert", "error", err)
+			return
+		}
+		for _, u := range users {
+			if u.Role == "admin" && u.Email != "" {
+				to = append(to, u.Email)
+			}
+		}
+	}
+	h.sendEmail(ctx, to, subject, body+"-- \nYou get this email as an administrator.\n")
+}
+
+// alertReindexFailed alerts admins to a reindex that failed, so that
+// search does not stay outdated unnoticed.
+func (h *Handler) alertReindexFailed(ctx context.Context, scope, target string, err error) {
+	what := "the search index"
+	switch scope {
+	case reindexChanged:
+		what = "the changed versions"
+	case reindexProject, reindexVersion:
+		what = scope + " " + target
+	}
+	body := fmt.Sprintf("Reindexing %s failed: %v\n\nSearch results may be outdated until a reindex succeeds.\n\n%s",
+		what, err, h.emailLink("/admin/maintenance"))
+	h.alertAdmins(ctx, "Search reindex failed", body)
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/email"
+)
+
+// fakeMailer records the emails sent.
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []email.Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg email.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// take waits for the background jobs and returns the emails sent since
+// the last call.
+func (m *fakeMailer) take(t *testing.T, app *testApp) []email.Message {
+	t.Helper()
+	if err := app.handler.WaitForJobs(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sent := m.sent
+	m.sent = nil
+	return sent
+}
+
+func TestAccessGrantedEmail(t *testing.T) {
+	app := setupTestApp(t)
+	mailer := &fakeMailer{}
+	app.handler.mailer = mailer
+	app.handler.config.Server.PublicURL = "https://docs.example.com"
+	ctx := context.Background()
+	seedAdmin(t, app)
+	seedProject(t, app, "guide", "Guide", false)
+
+	hash, _ := auth.HashPassword("pass123")
+	withEmail := &database.User{Username: "ada", Email: "ada@example.com", Password: &hash, AuthSource: "builtin", Role: "viewer"}
+	withoutEmail := &database.User{Username: "bob", Password: &hash, AuthSource: "builtin", Role: "viewer"}
+	app.handler.users.Create(ctx, withEmail)
+	app.handler.users.Create(ctx, withoutEmail)
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	grant := func(user *database.User) {
+		t.Helper()
+		form := url.Values{"grant_user_id": {fmt.Sprint(user.ID)}, "grant_role": {"editor"}}
+		req, _ := http.NewRequest("POST", app.server.URL+"/admin/projects/guide/access/grant", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Fatalf("expected access to be granted, got %d", resp.StatusCode)
+		}
+	}
+
+	grant(withEmail)
+	sent := mailer.take(t, app)
+	if len(sent) != 1 || sent[0].To[0] != "ada@example.com" || !strings.Contains(sent[0].Subject, "You can now read Guide") {
+		t.Fatalf("expected an email to the grantee, got %+v", sent)
+	}
+	if !strings.Contains(sent[0].Body, "admin gave you editor access to Guide") || !strings.Contains(sent[0].Body, "https://docs.example.com/project/guide") {
+		t.Errorf("unexpected body %q", sent[0].Body)
+	}
+
+	grant(withoutEmail)
+	if sent := mailer.take(t, app); len(sent) != 0 {
+		t.Errorf("expected no email to a user without an address, got %+v", sent)
+	}
+}
+
+func TestReindexFailedAlert(t *testing.T) {
+	app := setupTestApp(t)
+	mailer := &fakeMailer{}
+	app.handler.mailer = mailer
+	ctx := context.Background()
+	seedAdmin(t, app)
+
+	app.handler.alertReindexFailed(ctx, reindexProject, "guide", errors.New("disk full"))
+	sent := mailer.take(t, app)
+	if len(sent) != 1 || len(sent[0].To) != 1 || sent[0].To[0] != "admin@example.com" {
+		t.Fatalf("expected an alert to the admin, got %+v", sent)
+	}
+	if !strings.Contains(sent[0].Body, "Reindexing project guide failed: disk full") {
+		t.Errorf("unexpected body %q", sent[0].Body)
+	}
+
+	app.handler.config.Email.AdminAlerts = []string{"ops@example.com"}
+	app.handler.alertReindexFailed(ctx, reindexRebuild, "", errors.New("disk full"))
+	if sent := mailer.take(t, app); len(sent) != 1 || sent[0].To[0] != "ops@example.com" {
+		t.Errorf("expected the alert to go to the configured addresses, got %+v", sent)
+	}
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+const (
+	eventPageDefault = 100
+	eventPageMax     = 1000
+	eventPublishWait = 10 * time.Second
+)
+
+type eventJSON struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Project   string          `json:"project"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt string          `json:"created_at"`
+}
+
+func newEventJSON(e *database.Event) eventJSON {
+	return eventJSON{
+		ID:        e.ID,
+		Type:      e.Type,
+		Project:   e.Project,
+		Data:      json.RawMessage(e.Payload),
+		CreatedAt: e.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+// emitEvent appends an event to the feed and, if configured, publishes it
+// to NATS in the background. Like auditing, failures are only logged.
+func (h *Handler) emitEvent(ctx context.Context, eventType, project string, data map[string]any) {
+	if h.events == nil {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "encoding event", "error", err, "type", eventType)
+		return
+	}
+	event := &database.Event{Type: eventType, Project: project, Payload: string(payload), CreatedAt: time.Now()}
+	if err := h.events.Create(ctx, event); err != nil {
+		h.logger.ErrorContext(ctx, "writing event", "error", err, "type", eventType)
+		return
+	}
+
+	if h.eventPublisher != nil {
+		h.goJob(ctx, func(context.Context) { h.publishEvent(event) })
+	}
+}
+
+// projectEventData describes a project in project.* events.
+func projectEventData(project *database.Project, actor *database.User) map[string]any {
+	return map[string]any{
+		"name":       project.Name,
+		"visibility": project.Visibility,
+		"actor":      eventActor(actor),
+	}
+}
+
+// emitAccessEvent records a manual access grant or revocation, and tells
+// the user about grants by email. Role is empty for revocations.
+func (h *Handler) emitAccessEvent(ctx context.Context, eventType string, project *database.Project, actor *database.User, userID int64, role string) {
+	data := map[string]any{"actor": eventActor(actor)}
+	if grantee, err := h.users.GetByID(ctx, userID); err == nil {
+		data["username"] = grantee.Username
+		if role != "" {
+			h.notifyAccessGranted(ctx, project, actor, grantee, role)
+		}
+	}
+	if role != "" {
+		data["role"] = role
+	}
+	h.emitEvent(ctx, eventType, project.Slug, data)
+}
+
+func eventActor(user *database.User) string {
+	if user == nil {
+		return "system"
+	}
+	return user.Username
+}
+
+func (h *Handler) publishEvent(event *database.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventPublishWait)
+	defer cancel()
+
+	data, _ := json.Marshal(newEventJSON(event))
+	subject := h.config.Events.NATSSubject + "." + event.Type
+	if err := h.eventPublisher.Publish(ctx, subject, data); err != nil {
+		h.logger.ErrorContext(ctx, "publishing event", "error", err, "type", event.Type, "id", event.ID)
+	}
+}
+
+// handleAPIEvents returns events after the ?after= cursor, oldest first.
+// Callers only see events of projects they can view; events of deleted
+// projects are visible to admins only.
+func (h *Handler) handleAPIEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	if h.events == nil {
+		h.jsonError(w, "Event feed not available", http.StatusNotFound)
+		return
+	}
+
+	var after int64
+	if v := r.URL.Query().Get("after"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			h.jsonError(w, "Invalid after cursor", http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+	limit := eventPageDefault
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			h.jsonError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, eventPageMax)
+	}
+
+	events, err := h.events.ListAfter(ctx, after, limit)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing events", "error", err)
+		h.jsonError(w, "Failed to list events", http.StatusInternalServerError)
+		return
+	}
+
+	isAdmin := user != nil && user.Role == "admin"
+	visible := make(map[string]bool)
+	result := make([]eventJSON, 0, len(events))
+	for i := range events {
+		e := &events[i]
+		after = e.ID
+		if !isAdmin && e.Project != "" {
+			ok, seen := visible[e.Project]
+			if !seen {
+				project, err := h.projects.GetBySlug(ctx, e.Project)
+				ok = err == nil && h.canListProject(ctx, user, project)
+				visible[e.Project] = ok
+			}
+			if !ok {
+				continue
+			}
+		}
+		result = append(result, newEventJSON(e))
+	}
+
+	h.jsonResponse(w, map[string]any{
+		"events":      result,
+		"next_cursor": after,
+	})
+}
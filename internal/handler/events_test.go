@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type eventPage struct {
+	Events     []eventJSON `json:"events"`
+	NextCursor int64       `json:"next_cursor"`
+}
+
+func fetchEvents(t *testing.T, app *testApp, token string, after int64) eventPage {
+	t.Helper()
+	resp := apiRequest(t, app, "GET", "/api/events?after="+strconv.FormatInt(after, 10), token, "", nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var page eventPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+type recordingPublisher struct {
+	subjects chan string
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, subject string, data []byte) error {
+	p.subjects <- subject
+	return nil
+}
+
+func TestEventFeedCursor(t *testing.T) {
+	app := setupTestApp(t)
+	token := adminAPIToken(t, app)
+
+	resp := apiRequest(t, app, "PUT", "/api/project/handbook", token, `{"visibility": "public"}`, nil)
+	resp.Body.Close()
+	uploadToken := uploadTokenForProject(t, app, "private-docs")
+	resp = postArchive(t, app, "private-docs", uploadToken, "1.0.0", createTestZip(t, map[string]string{"index.html": "<html></html>"}))
+	resp.Body.Close()
+
+	page := fetchEvents(t, app, token, 0)
+	var types []string
+	for _, e := range page.Events {
+		types = append(types, e.Project+":"+e.Type)
+	}
+	if len(types) != 2 || types[0] != "handbook:project.created" || types[1] != "private-docs:version.published" {
+		t.Fatalf("unexpected events %v", types)
+	}
+	var data map[string]any
+	json.Unmarshal(page.Events[1].Data, &data)
+	if data["version"] != "1.0.0" || data["actor"] != "limits-bot" {
+		t.Errorf("unexpected event data %v", data)
+	}
+
+	if next := fetchEvents(t, app, token, page.NextCursor); len(next.Events) != 0 || next.NextCursor != page.NextCursor {
+		t.Errorf("expected no events after cursor, got %+v", next)
+	}
+}
+
+func TestEventFeedHidesInvisibleProjects(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	public := seedProject(t, app, "open", "Open", true)
+	hidden := seedProject(t, app, "hidden", "Hidden", false)
+	app.handler.emitEvent(ctx, database.EventProjectCreated, hidden.Slug, projectEventData(hidden, nil))
+	app.handler.emitEvent(ctx, database.EventProjectCreated, public.Slug, projectEventData(public, nil))
+
+	// Anonymous callers only see public projects, but the cursor advances
+	// past hidden events
+	resp, err := http.Get(app.server.URL + "/api/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var page eventPage
+	json.NewDecoder(resp.Body).Decode(&page)
+	if len(page.Events) != 1 || page.Events[0].Project != "open" {
+		t.Errorf("expected only the public project's event, got %+v", page.Events)
+	}
+	if page.NextCursor != page.Events[0].ID {
+		t.Errorf("expected cursor %d, got %d", page.Events[0].ID, page.NextCursor)
+	}
+}
+
+func TestEventPublishing(t *testing.T) {
+	app := setupTestApp(t)
+	publisher := &recordingPublisher{subjects: make(chan string, 1)}
+	app.handler.eventPublisher = publisher
+
+	project := seedProject(t, app, "open", "Open", true)
+	app.handler.emitEvent(context.Background(), database.EventProjectCreated, project.Slug, projectEventData(project, nil))
+
+	select {
+	case subject := <-publisher.subjects:
+		if subject != "asiakirjat.project.created" {
+			t.Errorf("unexpected subject %q", subject)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not published")
+	}
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// handleExportVersion serves a version as one self-contained HTML file or
+// as a PDF printed from it. Exports are made on the first request and kept
+// with the version's attachments until it is uploaded again.
+func (h *Handler) handleExportVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	slug := r.PathValue("slug")
+	tag := r.PathValue("tag")
+	format := r.PathValue("format")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canViewProject(ctx, user, project) {
+		if user == nil {
+			h.redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !h.featureEnabled(ctx, featureExport, project) {
+		http.Error(w, "Exports are not enabled for this project", http.StatusNotFound)
+		return
+	}
+
+	ver, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag)
+	if err != nil {
+		if h.redirectRenamedVersion(w, r, project, tag, "/project/"+slug+"/version/", "/export/"+format) {
+			return
+		}
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	if ver.ContentType == "pdf" {
+		http.Error(w, "PDF versions cannot be exported; download the PDF instead", http.StatusNotFound)
+		return
+	}
+
+	var file, contentType string
+	switch format {
+	case "html":
+		file, contentType = docs.ExportHTMLFile, "text/html; charset=utf-8"
+	case "pdf":
+		if h.config.Export.PDFCommand == "" {
+			http.Error(w, "PDF exports are not enabled", http.StatusNotFound)
+			return
+		}
+		file, contentType = docs.ExportPDFFile, "application/pdf"
+	default:
+		http.Error(w, "Unknown export format", http.StatusNotFound)
+		return
+	}
+
+	path, err := h.exportVersion(ctx, slug, ver.Tag, project.Name+" "+ver.Tag, file)
+	if err != nil {
+		if errors.Is(err, docs.ErrExportTooLarge) {
+			http.Error(w, "This version is too large to export as a single file", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if ctx.Err() != nil {
+			return // client went away
+		}
+		h.logger.ErrorContext(ctx, "exporting version", "error", err, "project", slug, "version", ver.Tag, "format", format)
+		http.Error(w, "Failed to export version", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, slug, ver.Tag, format))
+	http.ServeFile(w, r, path)
+}
+
+// exportVersion returns the path of an export of a version, making it
+// first if needed. Requests for the same export wait for one another.
+func (h *Handler) exportVersion(ctx context.Context, slug, tag, title, file string) (string, error) {
+	dir := h.storage.AttachmentPath(slug, tag)
+	path := filepath.Join(dir, file)
+
+	lock, _ := h.exportLocks.LoadOrStore(path, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	timeout := time.Duration(h.config.Export.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 120 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating export directory: %w", err)
+	}
+	htmlPath := filepath.Join(dir, docs.ExportHTMLFile)
+	if _, err := os.Stat(htmlPath); err != nil {
+		if err := h.exportHTML(ctx, slug, tag, title, htmlPath); err != nil {
+			return "", err
+		}
+	}
+	if file == docs.ExportPDFFile {
+		if err := docs.ExportPDF(ctx, h.config.Export.PDFCommand, htmlPath, path); err != nil {
+			return "", err
+		}
+		h.logger.InfoContext(ctx, "PDF export rendered", "project", slug, "version", tag)
+	}
+	return path, nil
+}
+
+// exportHTML writes the single-file export of a version to path. It is
+// written to a temporary file first, so a failed export leaves nothing
+// behind.
+func (h *Handler) exportHTML(ctx context.Context, slug, tag, title, path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".export-*.html")
+	if err != nil {
+		return fmt.Errorf("creating export: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = docs.ExportSingleHTML(ctx, tmp, h.storage.VersionPath(slug, tag), title, h.config.Export.MaxSizeBytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExportVersion(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	public := seedProject(t, app, "guide", "Guide", true)
+	private := seedProject(t, app, "internal", "Internal", false)
+	seedSEOVersion(t, app, public, admin, "1.0.0")
+	seedSEOVersion(t, app, private, admin, "1.0.0")
+
+	body := getBody(t, app.server.URL+"/project/guide")
+	if !strings.Contains(body, "/project/guide/version/1.0.0/export/html") || strings.Contains(body, "/export/pdf") {
+		t.Error("expected only the HTML export on the project page without a PDF renderer")
+	}
+
+	resp, err := http.Get(app.server.URL + "/project/guide/version/1.0.0/export/html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Disposition") != `attachment; filename="guide-1.0.0.html"` {
+		t.Fatalf("expected the HTML export as download, got %d %q", resp.StatusCode, resp.Header.Get("Content-Disposition"))
+	}
+	export := getBody(t, app.server.URL+"/project/guide/version/1.0.0/export/html")
+	if !strings.Contains(export, "<title>Guide 1.0.0</title>") || !strings.Contains(export, `id="page-guide-intro"`) {
+		t.Errorf("unexpected export: %s", export)
+	}
+
+	app.handler.config.Export.PDFCommand = "cp {input} {output}"
+	if pdf := getBody(t, app.server.URL+"/project/guide/version/1.0.0/export/pdf"); pdf != export {
+		t.Error("expected the PDF to be printed from the HTML export")
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for path, want := range map[string]int{
+		"/project/internal/version/1.0.0/export/html": http.StatusSeeOther,
+		"/project/guide/version/1.0.0/export/epub":    http.StatusNotFound,
+		"/project/guide/version/9.9.9/export/html":    http.StatusNotFound,
+	} {
+		resp, err := client.Get(app.server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s: expected %d, got %d", path, want, resp.StatusCode)
+		}
+	}
+
+	app.handler.config.Export.MaxSize = "10B"
+	seedSEOVersion(t, app, public, admin, "2.0.0")
+	resp, err = http.Get(app.server.URL + "/project/guide/version/2.0.0/export/html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a version over the size limit, got %d", resp.StatusCode)
+	}
+}
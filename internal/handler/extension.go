@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Extension adds handlers to the server without changes to this package,
+// e.g. for the integrations of a fork. Its handlers get the services of
+// the core handlers; stores of its own it brings along.
+type Extension interface {
+	// Name identifies the extension in logs and errors.
+	Name() string
+	// Routes returns the routes of the extension. They are registered
+	// after the core routes, below the base path, and must not overlap
+	// with them.
+	Routes(s Services) []ExtensionRoute
+}
+
+// ExtensionRoute is a route of an extension.
+type ExtensionRoute struct {
+	// Pattern is the method and path below the base path, e.g.
+	// "GET /api/acme/status".
+	Pattern string
+	// Policy is who may use the route, written like the core routes'
+	// policies: "public", "session", "user", "editor", "admin",
+	// "api:<scope>" or "api-admin:<scope>". The logged-in user is
+	// available through auth.UserFromContext.
+	Policy  string
+	Handler http.HandlerFunc
+}
+
+// parsePolicy returns the policy a String of it describes. Token policies
+// are left out, as their handlers authenticate themselves.
+func parsePolicy(s string) (policy, error) {
+	name, scope, _ := strings.Cut(s, ":")
+	switch name {
+	case "public", "session", "user", "editor", "admin":
+		if scope != "" {
+			break
+		}
+		return map[string]policy{
+			"public":  policyPublic,
+			"session": policySession,
+			"user":    policyUser,
+			"editor":  policyEditor,
+			"admin":   policyAdmin,
+		}[name], nil
+	case "api":
+		if scope != "" {
+			return apiPolicy(scope), nil
+		}
+	case "api-admin":
+		if scope != "" {
+			return apiAdminPolicy(scope), nil
+		}
+	}
+	return policy{}, fmt.Errorf("unknown policy %q", s)
+}
+
+// extensionRoutes returns the routes of the extensions with their
+// policies.
+func (h *Handler) extensionRoutes() ([]route, error) {
+	var routes []route
+	for _, ext := range h.extensions {
+		for _, er := range ext.Routes(h.services) {
+			p, err := parsePolicy(er.Policy)
+			if err != nil {
+				return nil, fmt.Errorf("extension %s: route %q: %w", ext.Name(), er.Pattern, err)
+			}
+			routes = append(routes, route{pattern: er.Pattern, policy: p, handler: er.Handler})
+		}
+	}
+	return routes, nil
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+)
+
+// greeter is an extension greeting the logged-in user with the number of
+// projects.
+type greeter struct {
+	policy string
+}
+
+func (g greeter) Name() string { return "greeter" }
+
+func (g greeter) Routes(s Services) []ExtensionRoute {
+	return []ExtensionRoute{{
+		Pattern: "GET /greet",
+		Policy:  g.policy,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			projects, _ := s.Projects.Projects.List(r.Context())
+			io.WriteString(w, "hello "+auth.UserFromContext(r.Context()).Username+", projects: "+strconv.Itoa(len(projects)))
+		},
+	}}
+}
+
+func TestExtensionRoutes(t *testing.T) {
+	app := setupTestApp(t)
+	seedAdmin(t, app)
+	seedProject(t, app, "guide", "Guide", true)
+	app.handler.extensions = []Extension{greeter{policy: "user"}}
+	mux := http.NewServeMux()
+	app.handler.RegisterRoutes(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(srv.URL + "/greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || !strings.HasSuffix(resp.Header.Get("Location"), "/login") {
+		t.Errorf("expected the policy to redirect anonymous users to the login, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL+"/greet", nil)
+	for _, c := range loginUser(t, app, "admin", "admin123") {
+		req.AddCookie(c)
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello admin, projects: 1" {
+		t.Errorf("expected the extension to use the services, got %d %q", resp.StatusCode, body)
+	}
+
+	app.handler.extensions = []Extension{greeter{policy: "token:upload"}}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a route with an unknown policy to be refused")
+		}
+	}()
+	app.handler.RegisterRoutes(http.NewServeMux())
+}
+
+func TestParsePolicy(t *testing.T) {
+	for pattern, want := range routePolicies {
+		if strings.HasPrefix(want, "token:") {
+			continue
+		}
+		p, err := parsePolicy(want)
+		if err != nil || p.String() != want {
+			t.Errorf("%s: expected policy %s, got %v, %v", pattern, want, p, err)
+		}
+	}
+	for _, s := range []string{"", "unset", "token:upload", "admin:read", "api", "api-admin:"} {
+		if _, err := parsePolicy(s); err == nil {
+			t.Errorf("expected %q to be refused", s)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// Feature flags. New experimental capabilities register a flag here and
+// check it with featureEnabled.
+const (
+	featureSearchSuggest = "search_suggest"
+	featureExport        = "export"
+)
+
+// featureFlagsCacheTTL is how long the flags switched by admins are
+// cached. Changes made on this instance apply at once, those made on
+// other instances sharing the database within this time.
+const featureFlagsCacheTTL = 30 * time.Second
+
+// featureFlag is a capability that can be switched on or off without code
+// changes: in the features section of the config file and by admins, for
+// the whole instance or, if PerProject is set, for single projects.
+type featureFlag struct {
+	Name        string
+	Description string
+	PerProject  bool
+	Default     bool // Unless the config file says otherwise
+}
+
+var featureFlags = []featureFlag{
+	{
+		Name:        featureSearchSuggest,
+		Description: "Suggest completions, projects and pages while typing in the navbar search. When off, the navbar runs the full search.",
+		Default:     true,
+	},
+	{
+		Name:        featureExport,
+		Description: "Offer versions for download as a single HTML file or PDF.",
+		PerProject:  true,
+		Default:     true,
+	},
+}
+
+func lookupFeatureFlag(name string) (featureFlag, bool) {
+	i := slices.IndexFunc(featureFlags, func(f featureFlag) bool { return f.Name == name })
+	if i < 0 {
+		return featureFlag{}, false
+	}
+	return featureFlags[i], true
+}
+
+// featureFlagCache caches the flags switched by admins.
+type featureFlagCache struct {
+	mu     sync.Mutex
+	flags  []database.FeatureFlag
+	loaded time.Time
+}
+
+// warnUnknownFeatures logs the flags in the config file that do not exist,
+// most likely typos.
+func (h *Handler) warnUnknownFeatures() {
+	for name := range h.config.Features {
+		if _, ok := lookupFeatureFlag(name); !ok {
+			h.logger.Warn("unknown feature flag in config", "flag", name)
+		}
+	}
+}
+
+// featureOverrides returns the flags switched by admins. If they cannot be
+// read, e.g. while the database is down, the last ones read are used.
+func (h *Handler) featureOverrides(ctx context.Context) []database.FeatureFlag {
+	if h.flags == nil {
+		return nil
+	}
+	c := &h.featureFlagCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.loaded) < featureFlagsCacheTTL {
+		return c.flags
+	}
+	flags, err := h.flags.List(ctx)
+	if err != nil {
+		// Tried again when the cache expires, not on every request
+		h.logger.WarnContext(ctx, "listing feature flags", "error", err)
+		c.loaded = time.Now()
+		return c.flags
+	}
+	c.flags, c.loaded = flags, time.Now()
+	return flags
+}
+
+func (h *Handler) invalidateFeatureFlags() {
+	c := &h.featureFlagCache
+	c.mu.Lock()
+	c.loaded = time.Time{}
+	c.mu.Unlock()
+}
+
+// featureState returns whether a flag is on for a project, or for the
+// instance if project is nil, and where that was decided: "default",
+// "config", "instance" or "project".
+func (h *Handler) featureState(ctx context.Context, f featureFlag, project *database.Project) (enabled bool, source string) {
+	enabled, source = f.Default, "default"
+	if v, ok := h.config.Features[f.Name]; ok {
+		enabled, source = v, "config"
+	}
+	overrides := h.featureOverrides(ctx)
+	for _, o := range overrides {
+		if o.ProjectID == 0 && o.Name == f.Name {
+			enabled, source = o.Enabled, "instance"
+		}
+	}
+	if project != nil && f.PerProject {
+		for _, o := range overrides {
+			if o.ProjectID == project.ID && o.Name == f.Name {
+				enabled, source = o.Enabled, "project"
+			}
+		}
+	}
+	return enabled, source
+}
+
+// featureEnabled reports whether a feature is on for a project, or for the
+// instance if project is nil.
+func (h *Handler) featureEnabled(ctx context.Context, name string, project *database.Project) bool {
+	f, ok := lookupFeatureFlag(name)
+	if !ok {
+		return false
+	}
+	enabled, _ := h.featureState(ctx, f, project)
+	return enabled
+}
+
+// enabledFeatures returns the state of every feature for a project, or
+// for the instance if project is nil. Templates get it as .Features.
+func (h *Handler) enabledFeatures(ctx context.Context, project *database.Project) map[string]bool {
+	features := make(map[string]bool, len(featureFlags))
+	for _, f := range featureFlags {
+		features[f.Name], _ = h.featureState(ctx, f, project)
+	}
+	return features
+}
+
+// featureFlagView is a feature flag as shown to admins.
+type featureFlagView struct {
+	featureFlag
+	Enabled bool
+	Source  string
+	// Override is "on" or "off" if admins switched the flag, else ""
+	Override string
+}
+
+// featureFlagViews describes the flags of the instance, or the per-project
+// flags of a project.
+func (h *Handler) featureFlagViews(ctx context.Context, project *database.Project) []featureFlagView {
+	var projectID int64
+	if project != nil {
+		projectID = project.ID
+	}
+	overrides := h.featureOverrides(ctx)
+	var views []featureFlagView
+	for _, f := range featureFlags {
+		if project != nil && !f.PerProject {
+			continue
+		}
+		view := featureFlagView{featureFlag: f}
+		view.Enabled, view.Source = h.featureState(ctx, f, project)
+		for _, o := range overrides {
+			if o.ProjectID == projectID && o.Name == f.Name {
+				view.Override = map[bool]string{true: "on", false: "off"}[o.Enabled]
+			}
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// setFeatureFlag applies a flag state from the admin forms: "on", "off",
+// or "" to fall back to the config file and, for projects, the instance.
+func (h *Handler) setFeatureFlag(ctx context.Context, projectID int64, name, state string) error {
+	var err error
+	switch state {
+	case "on", "off":
+		err = h.flags.Set(ctx, database.FeatureFlag{ProjectID: projectID, Name: name, Enabled: state == "on"})
+	default:
+		err = h.flags.Delete(ctx, projectID, name)
+	}
+	h.invalidateFeatureFlags()
+	return err
+}
+
+// handleAdminSetFeatureFlag switches a feature flag for the instance.
+func (h *Handler) handleAdminSetFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	name := r.PathValue("name")
+	if _, ok := lookupFeatureFlag(name); !ok {
+		http.Error(w, "Feature flag not found", http.StatusNotFound)
+		return
+	}
+	state := r.FormValue("state")
+	if err := h.setFeatureFlag(ctx, 0, name, state); err != nil {
+		h.logger.ErrorContext(ctx, "setting feature flag", "error", err, "flag", name)
+		h.redirect(w, r, "/admin/maintenance?msg=feature_failed", http.StatusSeeOther)
+		return
+	}
+	h.audit(ctx, "feature.set", user.Username, name+": "+cmp.Or(state, "default"))
+	h.redirect(w, r, "/admin/maintenance?msg=feature_saved", http.StatusSeeOther)
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	guide := seedProject(t, app, "guide", "Guide", true)
+	other := seedProject(t, app, "other", "Other", true)
+	seedSEOVersion(t, app, guide, admin, "1.0.0")
+	seedSEOVersion(t, app, other, admin, "1.0.0")
+	ctx := context.Background()
+	cookies := loginUser(t, app, "admin", "admin123")
+
+	status := func(path string) int {
+		t.Helper()
+		resp, err := http.Get(app.server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	setInstance := func(name, state string) int {
+		t.Helper()
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		req, _ := http.NewRequest("POST", app.server.URL+"/admin/features/"+name, strings.NewReader(url.Values{"state": {state}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status("/api/search/suggest?q=gu") != http.StatusOK || status("/project/guide/version/1.0.0/export/html") != http.StatusOK {
+		t.Fatal("expected the features to be on by default")
+	}
+
+	app.handler.config.Features = map[string]bool{featureSearchSuggest: false}
+	if status("/api/search/suggest?q=gu") != http.StatusNotFound {
+		t.Error("expected the config file to switch suggestions off")
+	}
+	if body := getBody(t, app.server.URL+"/"); !strings.Contains(body, "window.SEARCH_SUGGEST = false") {
+		t.Error("expected the navbar search to be told suggestions are off")
+	}
+
+	if code := setInstance(featureSearchSuggest, "on"); code != http.StatusSeeOther {
+		t.Fatalf("expected redirect after switching a flag, got %d", code)
+	}
+	if status("/api/search/suggest?q=gu") != http.StatusOK {
+		t.Error("expected admins to override the config file")
+	}
+	if enabled, source := app.handler.featureState(ctx, featureFlags[0], nil); !enabled || source != "instance" {
+		t.Errorf("expected the instance override, got %t from %s", enabled, source)
+	}
+	setInstance(featureSearchSuggest, "")
+	if status("/api/search/suggest?q=gu") != http.StatusNotFound {
+		t.Error("expected resetting the flag to fall back to the config file")
+	}
+	if code := setInstance("no_such_feature", "on"); code != http.StatusNotFound {
+		t.Errorf("expected unknown flags to be rejected, got %d", code)
+	}
+
+	// Per-project flags override the instance
+	if err := app.handler.setFeatureFlag(ctx, guide.ID, featureExport, "off"); err != nil {
+		t.Fatal(err)
+	}
+	if status("/project/guide/version/1.0.0/export/html") != http.StatusNotFound || status("/project/other/version/1.0.0/export/html") != http.StatusOK {
+		t.Error("expected exports to be off for the guide only")
+	}
+	if body := getBody(t, app.server.URL+"/project/guide"); strings.Contains(body, "/export/html") {
+		t.Error("expected no export link on the project page")
+	}
+	setInstance(featureExport, "off")
+	app.handler.setFeatureFlag(ctx, guide.ID, featureExport, "on")
+	if status("/project/guide/version/1.0.0/export/html") != http.StatusOK || status("/project/other/version/1.0.0/export/html") != http.StatusNotFound {
+		t.Error("expected exports to be on for the guide only")
+	}
+	if body := getBody(t, app.server.URL+"/project/guide"); !strings.Contains(body, "/export/html") {
+		t.Error("expected the export link on the project page again")
+	}
+
+	if app.handler.featureEnabled(ctx, "no_such_feature", nil) {
+		t.Error("expected unknown flags to be off")
+	}
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"context"
+	"encoding/xml"
+	"html"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+	"github.com/qwc/asiakirjat/internal/store"
+	"github.com/qwc/asiakirjat/internal/templates"
+)
+
+// feedEntries is how many of the latest versions a feed lists.
+const feedEntries = 50
+
+// atomFeed is an Atom feed (RFC 4287) of versions.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string    `xml:"title"`
+	ID      string    `xml:"id"`
+	Updated string    `xml:"updated"`
+	Link    atomLink  `xml:"link"`
+	Content *atomText `xml:"content,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// feedVersion is a version in a feed, with its project.
+type feedVersion struct {
+	project *database.Project
+	version database.Version
+}
+
+// latestVersions returns the latest uploads of projects, newest first.
+func (h *Handler) latestVersions(ctx context.Context, projects []*database.Project) []feedVersion {
+	var latest []feedVersion
+	for _, project := range projects {
+		versions, _, err := h.versions.ListPageByProject(ctx, project.ID, store.VersionQuery{Desc: true, Limit: feedEntries})
+		if err != nil {
+			h.logger.ErrorContext(ctx, "listing versions for feed", "error", err, "project", project.Slug)
+			continue
+		}
+		for _, v := range versions {
+			latest = append(latest, feedVersion{project: project, version: v})
+		}
+	}
+	slices.SortStableFunc(latest, func(a, b feedVersion) int {
+		return b.version.CreatedAt.Compare(a.version.CreatedAt)
+	})
+	if len(latest) > feedEntries {
+		latest = latest[:feedEntries]
+	}
+	return latest
+}
+
+// writeAtomFeed writes the versions as an Atom feed. Base is the public URL
+// of the server and self the path of the feed.
+func (h *Handler) writeAtomFeed(w http.ResponseWriter, base, self, title string, versions []feedVersion) {
+	feed := atomFeed{
+		Title:  title,
+		ID:     base + self,
+		Author: atomAuthor{Name: templates.GetBranding().AppName},
+		Links: []atomLink{
+			{Href: base + self, Rel: "self"},
+			{Href: base + "/"},
+		},
+	}
+	updated := time.Unix(0, 0)
+	for _, fv := range versions {
+		url := base + "/project/" + escapePath(fv.project.Slug) + "/" + escapePath(fv.version.Tag) + "/"
+		entry := atomEntry{
+			Title:   fv.project.Name + " " + fv.version.Tag,
+			ID:      url,
+			Updated: fv.version.CreatedAt.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: url},
+		}
+		if fv.version.ReleaseNotes != "" {
+			if notes, err := docs.RenderMarkdown([]byte(fv.version.ReleaseNotes)); err == nil {
+				entry.Content = &atomText{Type: "html", Body: string(notes)}
+			} else {
+				entry.Content = &atomText{Type: "text", Body: fv.version.ReleaseNotes}
+			}
+		}
+		feed.Entries = append(feed.Entries, entry)
+		if fv.version.CreatedAt.After(updated) {
+			updated = fv.version.CreatedAt
+		}
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		h.logger.Error("encoding feed", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(out)
+}
+
+// feedTokenUser returns the user a feed token belongs to, or nil.
+func (h *Handler) feedTokenUser(ctx context.Context, token string) *database.User {
+	if token == "" || h.watchers == nil {
+		return nil
+	}
+	userID, err := h.watchers.GetFeedTokenUser(ctx, auth.HashToken(token))
+	if err != nil {
+		return nil
+	}
+	user, err := h.users.GetByID(ctx, userID)
+	if err != nil || user.Deactivated {
+		return nil
+	}
+	return user
+}
+
+// projectFeedLink announces the feed of a project to browsers and feed
+// readers.
+func (h *Handler) projectFeedLink(slug, name string) string {
+	href := h.config.Server.BasePath + "/project/" + slug + "/feed.atom"
+	return `<link rel="alternate" type="application/atom+xml" title="` + html.EscapeString(name+" releases") + `" href="` + html.EscapeString(href) + `">`
+}
+
+// feedUser returns the user a feed is read as: the owner of the token in
+// the URL, or else the logged-in user. Ok is false for an unknown token,
+// and for anonymous readers when anonymous access is off. Feed routes are
+// public so that a token works without a session.
+func (h *Handler) feedUser(w http.ResponseWriter, r *http.Request) (user *database.User, ok bool) {
+	if token := r.URL.Query().Get("token"); token != "" {
+		user = h.feedTokenUser(r.Context(), token)
+		return user, user != nil
+	}
+	user = h.sessionUser(w, r)
+	return user, user != nil || h.config.Access.AllowAnonymous
+}
+
+// setFeedCaching lets shared caches keep only feeds read anonymously, and
+// only when server.public_url is set: otherwise their links are built from
+// the Host header, which one request could spoof for every reader.
+func (h *Handler) setFeedCaching(w http.ResponseWriter, user *database.User) {
+	if user != nil || h.config.Server.PublicURL == "" {
+		w.Header().Set("Cache-Control", "private, no-cache")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+}
+
+// handleProjectFeed lists the latest versions of a project. Private
+// projects need the feed token of a user who can read them.
+func (h *Handler) handleProjectFeed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.feedUser(w, r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil || !h.canViewProject(ctx, user, project) {
+		// Feed readers cannot log in, so do not tell them the project exists
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	h.setFeedCaching(w, user)
+	h.writeAtomFeed(w, h.publicURL(r), "/project/"+escapePath(project.Slug)+"/feed.atom", project.Name+" releases",
+		h.latestVersions(ctx, []*database.Project{project}))
+}
+
+// handleReleasesFeed lists the latest versions of all projects listed for
+// the reader: the public ones, and with a feed token those its owner can
+// read.
+func (h *Handler) handleReleasesFeed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.feedUser(w, r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	all, err := h.projects.List(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing projects for feed", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	var projects []*database.Project
+	for i := range all {
+		if h.canListProject(ctx, user, &all[i]) {
+			projects = append(projects, &all[i])
+		}
+	}
+
+	h.setFeedCaching(w, user)
+	h.writeAtomFeed(w, h.publicURL(r), "/feed.atom", templates.GetBranding().AppName+" releases", h.latestVersions(ctx, projects))
+}
+
+// handleWatchingFeed lists the new versions of the projects the owner of
+// the feed token watches in their feed. Feed readers cannot log in, so the
+// token in the URL stands in for the session.
+func (h *Handler) handleWatchingFeed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := h.feedTokenUser(ctx, r.URL.Query().Get("token"))
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	watchers, err := h.watchers.ListByUser(ctx, user.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing watched projects", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	var projects []*database.Project
+	for _, wt := range watchers {
+		if wt.Channel != database.WatchFeed {
+			continue
+		}
+		project, err := h.projects.GetByID(ctx, wt.ProjectID)
+		if err == nil && h.canViewProject(ctx, user, project) {
+			projects = append(projects, project)
+		}
+	}
+
+	title := templates.GetBranding().AppName + ": projects watched by " + user.Username
+	h.setFeedCaching(w, user)
+	h.writeAtomFeed(w, h.publicURL(r), "/watching.atom", title, h.latestVersions(ctx, projects))
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestReleaseFeeds(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	admin := seedAdmin(t, app)
+	public := seedProject(t, app, "guide", "Guide", true)
+	private := seedProject(t, app, "secret", "Secret", false)
+	seedSEOVersion(t, app, public, admin, "1.0.0")
+	seedSEOVersion(t, app, private, admin, "1.0.0")
+	app.handler.versions.Create(ctx, &database.Version{ProjectID: public.ID, Tag: "2.0.0", ContentType: "archive", StoragePath: "guide/2.0.0", UploadedBy: admin.ID, ReleaseNotes: "Adds a *new* chapter."})
+
+	feed := getBody(t, app.server.URL+"/feed.atom")
+	if !strings.Contains(feed, "<title>Guide 1.0.0</title>") || strings.Contains(feed, "Secret") {
+		t.Errorf("expected only public projects in the anonymous feed:\n%s", feed)
+	}
+	if !strings.Contains(feed, "&lt;em&gt;new&lt;/em&gt;") {
+		t.Errorf("expected the release notes as HTML:\n%s", feed)
+	}
+
+	feed = getBody(t, app.server.URL+"/project/guide/feed.atom")
+	if !strings.Contains(feed, "<title>Guide releases</title>") || !strings.Contains(feed, "<title>Guide 2.0.0</title>") {
+		t.Errorf("unexpected project feed:\n%s", feed)
+	}
+	if body := getBody(t, app.server.URL+"/project/guide"); !strings.Contains(body, `type="application/atom+xml"`) {
+		t.Error("expected the project page to link its feed")
+	}
+
+	status := func(path string) int {
+		resp, err := http.Get(app.server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := status("/project/secret/feed.atom"); got != http.StatusNotFound {
+		t.Errorf("expected 404 for a private project without a token, got %d", got)
+	}
+	if got := status("/feed.atom?token=wrong"); got != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown token, got %d", got)
+	}
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	body := postWithCookies(t, app, "/profile/feed-token", cookies, nil)
+	_, rest, ok := strings.Cut(body, "/watching.atom?token=")
+	if !ok {
+		t.Fatal("expected the feed URL on the profile page")
+	}
+	token, _, _ := strings.Cut(rest, `"`)
+
+	if feed := getBody(t, app.server.URL+"/project/secret/feed.atom?token="+token); !strings.Contains(feed, "<title>Secret 1.0.0</title>") {
+		t.Errorf("expected the private project feed with a token:\n%s", feed)
+	}
+	if feed := getBody(t, app.server.URL+"/feed.atom?token="+token); !strings.Contains(feed, "<title>Secret 1.0.0</title>") {
+		t.Errorf("expected private projects in the feed of the token owner:\n%s", feed)
+	}
+}
+
+func TestReleaseFeedsWithoutAnonymousAccess(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	private := seedProject(t, app, "secret", "Secret", false)
+	seedSEOVersion(t, app, private, admin, "1.0.0")
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	body := postWithCookies(t, app, "/profile/feed-token", cookies, nil)
+	_, rest, ok := strings.Cut(body, "/watching.atom?token=")
+	if !ok {
+		t.Fatal("expected the feed URL on the profile page")
+	}
+	token, _, _ := strings.Cut(rest, `"`)
+	app.handler.config.Access.AllowAnonymous = false
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	status := func(path string) int {
+		resp, err := client.Get(app.server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, path := range []string{"/feed.atom", "/project/secret/feed.atom"} {
+		if got := status(path); got != http.StatusUnauthorized {
+			t.Errorf("GET %s: expected 401 without a token, got %d", path, got)
+		}
+		if got := status(path + "?token=" + token); got != http.StatusOK {
+			t.Errorf("GET %s: expected the feed with a token, got %d", path, got)
+		}
+	}
+	if feed := getWithCookies(t, app, "/feed.atom", cookies); !strings.Contains(feed, "<title>Secret 1.0.0</title>") {
+		t.Errorf("expected the feed of the logged-in user:\n%s", feed)
+	}
+}
+
+func TestReleaseFeedsCaching(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	seedSEOVersion(t, app, seedProject(t, app, "guide", "Guide", true), admin, "1.0.0")
+
+	get := func() *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", app.server.URL+"/feed.atom", nil)
+		req.Host = "evil.example.com"
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// Links built from the Host header must not reach shared caches
+	if got := get().Header.Get("Cache-Control"); got != "private, no-cache" {
+		t.Errorf("expected a private feed without server.public_url, got %q", got)
+	}
+	app.handler.config.Server.PublicURL = "https://docs.example.com"
+	if got := get().Header.Get("Cache-Control"); got != "public, max-age=300" {
+		t.Errorf("expected a cacheable feed with server.public_url, got %q", got)
+	}
+}
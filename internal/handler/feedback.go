@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+const (
+	maxFeedbackMessageLen   = 4000
+	maxFeedbackSelectionLen = 2000
+	maxFeedbackPageURLLen   = 2048
+	maxFeedbackTrackerLen   = 1024
+	maxFeedbackBodySize     = 64 << 10
+	feedbackListLimit       = 200
+)
+
+// validateFeedbackSettings checks a project's feedback mode and issue
+// tracker URL. The URL may contain {url}, {title}, {project}, {version} and
+// {selection} placeholders, which the overlay fills in for the current page.
+func validateFeedbackSettings(mode, trackerURL string) error {
+	switch mode {
+	case database.FeedbackOff, database.FeedbackInternal:
+		return nil
+	case database.FeedbackIssueTracker:
+		u, err := url.Parse(trackerURL)
+		if err != nil || len(trackerURL) > maxFeedbackTrackerLen || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid feedback URL: use an http(s) URL")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid feedback mode: must be empty, issue_tracker, or internal")
+}
+
+// truncateText shortens s to at most n bytes without splitting a character.
+func truncateText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// handleSubmitFeedback stores a report sent from the doc overlay of a
+// project that collects feedback in asiakirjat. The JSON body carries the
+// page context: {"version", "page_url", "selection", "message"}.
+func (h *Handler) handleSubmitFeedback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil || !h.canViewProject(ctx, user, project) || project.FeedbackMode != database.FeedbackInternal {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	// Cross-site forms cannot send JSON, so other sites cannot post reports
+	// in the name of a logged-in reader
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		h.jsonError(w, "Expected a JSON body", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var req struct {
+		Version   string `json:"version"`
+		PageURL   string `json:"page_url"`
+		Selection string `json:"selection"`
+		Message   string `json:"message"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFeedbackBodySize)).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" {
+		h.jsonError(w, "Message is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Message) > maxFeedbackMessageLen {
+		h.jsonError(w, fmt.Sprintf("Message is longer than %d characters", maxFeedbackMessageLen), http.StatusBadRequest)
+		return
+	}
+	if _, err := h.versions.GetByProjectAndTag(ctx, project.ID, req.Version); err != nil {
+		h.jsonError(w, "Version not found", http.StatusBadRequest)
+		return
+	}
+
+	// Only pages of the project are kept, as the list of reports links to them
+	pageURL := truncateText(req.PageURL, maxFeedbackPageURLLen)
+	if !strings.HasPrefix(pageURL, h.config.Server.BasePath+"/project/"+project.Slug+"/") {
+		pageURL = ""
+	}
+
+	feedback := &database.Feedback{
+		ProjectID:  project.ID,
+		VersionTag: req.Version,
+		PageURL:    pageURL,
+		Selection:  truncateText(strings.TrimSpace(req.Selection), maxFeedbackSelectionLen),
+		Message:    req.Message,
+	}
+	if user != nil {
+		feedback.Author = user.Username
+	}
+	if err := h.feedback.Create(ctx, feedback); err != nil {
+		h.logger.ErrorContext(ctx, "creating feedback", "error", err)
+		h.jsonError(w, "Failed to save feedback", http.StatusInternalServerError)
+		return
+	}
+
+	h.emitEvent(ctx, database.EventFeedbackReceived, project.Slug, map[string]any{
+		"id":       feedback.ID,
+		"version":  feedback.VersionTag,
+		"page_url": feedback.PageURL,
+		"author":   feedback.Author,
+	})
+
+	h.jsonResponse(w, map[string]any{"id": feedback.ID})
+}
+
+// handleProjectFeedback lists the reports of a project for its editors.
+func (h *Handler) handleProjectFeedback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canUpload(ctx, user, project) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	feedback, err := h.feedback.ListByProject(ctx, project.ID, feedbackListLimit)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing feedback", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.render(w, "project_feedback", map[string]any{
+		"User":     user,
+		"Project":  project,
+		"Feedback": feedback,
+	})
+}
+
+// handleDeleteFeedback removes a report once it has been dealt with.
+func (h *Handler) handleDeleteFeedback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canUpload(ctx, user, project) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid feedback ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.feedback.Delete(ctx, project.ID, id); err != nil {
+		h.logger.ErrorContext(ctx, "deleting feedback", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.redirect(w, r, "/project/"+slug+"/feedback", http.StatusSeeOther)
+}
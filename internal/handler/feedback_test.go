@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestValidateFeedbackSettings(t *testing.T) {
+	tests := []struct {
+		mode    string
+		url     string
+		wantErr bool
+	}{
+		{"", "", false},
+		{database.FeedbackInternal, "", false},
+		{database.FeedbackIssueTracker, "https://github.com/org/repo/issues/new?title={title}&body={url}", false},
+		{database.FeedbackIssueTracker, "", true},
+		{database.FeedbackIssueTracker, "javascript:alert(1)", true},
+		{"email", "", true},
+	}
+	for _, tt := range tests {
+		if err := validateFeedbackSettings(tt.mode, tt.url); (err != nil) != tt.wantErr {
+			t.Errorf("validateFeedbackSettings(%q, %q) = %v, want error %v", tt.mode, tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSubmitFeedback(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	ctx := context.Background()
+
+	project := seedProject(t, app, "fb", "Feedback", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+
+	post := func(contentType, body string) int {
+		t.Helper()
+		resp, err := http.Post(app.server.URL+"/project/fb/feedback", contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	report := `{"version": "1.0.0", "page_url": "/project/fb/1.0.0/guide/intro.html", "selection": "teh", "message": "Typo in the intro"}`
+
+	if code := post("application/json", report); code != http.StatusNotFound {
+		t.Errorf("expected 404 while feedback is off, got %d", code)
+	}
+
+	project.FeedbackMode = database.FeedbackInternal
+	app.handler.projects.Update(ctx, project)
+
+	if code := post("application/x-www-form-urlencoded", report); code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 for a form post, got %d", code)
+	}
+	if code := post("application/json", `{"version": "1.0.0", "message": " "}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a message, got %d", code)
+	}
+	if code := post("application/json", report); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := post("application/json", `{"version": "1.0.0", "page_url": "https://evil.example/", "message": "Spam"}`); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	list, _ := app.handler.feedback.ListByProject(ctx, project.ID, 10)
+	if len(list) != 2 || list[1].Selection != "teh" || list[1].Author != "" || list[1].PageURL != "/project/fb/1.0.0/guide/intro.html" {
+		t.Fatalf("unexpected feedback %+v", list)
+	}
+	if list[0].PageURL != "" {
+		t.Errorf("expected a page outside the project to be dropped, got %q", list[0].PageURL)
+	}
+
+	page := fetchEvents(t, app, adminAPIToken(t, app), 0)
+	if last := page.Events[len(page.Events)-1]; last.Type != database.EventFeedbackReceived {
+		t.Errorf("expected feedback.received event, got %s", last.Type)
+	}
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	req, _ := http.NewRequest("GET", app.server.URL+"/project/fb/feedback", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the feedback list for the admin, got %d", resp.StatusCode)
+	}
+}
+
+func TestOverlayFeedbackButton(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	ctx := context.Background()
+
+	project := seedProject(t, app, "tracked", "Tracked", true)
+	project.FeedbackMode = database.FeedbackIssueTracker
+	project.FeedbackURL = "https://issues.example.com/new?body={url}"
+	app.handler.projects.Update(ctx, project)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+
+	body := getBody(t, app.server.URL+"/project/tracked/1.0.0/guide/intro.html")
+	if !strings.Contains(body, `data-template="https://issues.example.com/new?body={url}"`) {
+		t.Error("expected the issue tracker URL template in the overlay")
+	}
+
+	project.FeedbackMode = database.FeedbackOff
+	app.handler.projects.Update(ctx, project)
+	if body := getBody(t, app.server.URL+"/project/tracked/1.0.0/guide/intro.html"); strings.Contains(body, `id="asiakirjat-feedback"`) {
+		t.Error("expected no feedback button while feedback is off")
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestVersionListFragmentCache(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+
+	if body := getBody(t, app.server.URL+"/project/guide"); !strings.Contains(body, ">1.0.0</a>") {
+		t.Fatal("expected version 1.0.0 in the version list")
+	}
+
+	// A version added behind the handler's back stays hidden until the
+	// project's versions are invalidated, as uploads do.
+	if err := app.handler.versions.Create(context.Background(), &database.Version{ProjectID: project.ID, Tag: "2.0.0", StoragePath: t.TempDir(), UploadedBy: admin.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if body := getBody(t, app.server.URL+"/project/guide"); strings.Contains(body, ">2.0.0</a>") {
+		t.Error("expected the cached version list")
+	}
+	app.handler.invalidateVersions(project.ID)
+	if body := getBody(t, app.server.URL+"/project/guide"); !strings.Contains(body, ">2.0.0</a>") {
+		t.Error("expected version 2.0.0 after invalidation")
+	}
+
+	// Editors get their own rendering with the version actions.
+	cookies := loginUser(t, app, "admin", "admin123")
+	req, _ := http.NewRequest("GET", app.server.URL+"/project/guide", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(buf.String(), "/version/2.0.0/delete") {
+		t.Error("expected delete buttons for the admin")
+	}
+	if strings.Contains(getBody(t, app.server.URL+"/project/guide"), "/version/2.0.0/delete") {
+		t.Error("expected no delete buttons for anonymous users")
+	}
+}
+
+func TestRenderErrorWritesNothing(t *testing.T) {
+	app := setupTestApp(t)
+
+	var buf bytes.Buffer
+	err := app.handler.templates.Render(&buf, "project_detail", map[string]any{"Project": 42})
+	if err == nil {
+		t.Fatal("expected an error for invalid data")
+	}
+	if !strings.Contains(err.Error(), "project_detail") {
+		t.Errorf("expected the page name in the error, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing written, got %d bytes", buf.Len())
+	}
+}
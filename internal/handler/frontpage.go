@@ -2,7 +2,11 @@ package handler
 
 import (
 	"context"
+	"fmt"
+	"html/template"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/qwc/asiakirjat/internal/auth"
 	"github.com/qwc/asiakirjat/internal/database"
@@ -15,6 +19,31 @@ type projectCardData struct {
 	Description   string
 	Visibility    string
 	LatestVersion string
+	Lifecycle     string
+	Thumbnail     bool
+	Tags          []string
+}
+
+// tagCount is a tag of the front page filter.
+type tagCount struct {
+	Tag   string
+	Count int
+}
+
+// sortedTagCounts orders tags by the number of projects carrying them,
+// then by name.
+func sortedTagCounts(counts map[string]int) []tagCount {
+	result := make([]tagCount, 0, len(counts))
+	for tag, count := range counts {
+		result = append(result, tagCount{Tag: tag, Count: count})
+	}
+	slices.SortFunc(result, func(a, b tagCount) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Tag, b.Tag)
+	})
+	return result
 }
 
 // latestVersionTag returns the "latest" version tag.
@@ -58,7 +87,7 @@ func (h *Handler) filterAccessibleProjects(ctx context.Context, user *database.U
 	var filtered []database.Project
 	for _, p := range all {
 		switch p.Visibility {
-		case database.VisibilityPublic:
+		case database.VisibilityPublic, database.VisibilityUnlisted:
 			filtered = append(filtered, p)
 		case database.VisibilityPrivate:
 			if hasGlobalAccess {
@@ -82,7 +111,7 @@ func (h *Handler) handleFrontpage(w http.ResponseWriter, r *http.Request) {
 	if user != nil && user.Role == "admin" {
 		all, err := h.projects.List(ctx)
 		if err != nil {
-			h.logger.Error("listing projects", "error", err)
+			h.logger.ErrorContext(ctx, "listing projects", "error", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
@@ -90,7 +119,7 @@ func (h *Handler) handleFrontpage(w http.ResponseWriter, r *http.Request) {
 	} else if user != nil {
 		all, err := h.projects.List(ctx)
 		if err != nil {
-			h.logger.Error("listing projects", "error", err)
+			h.logger.ErrorContext(ctx, "listing projects", "error", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
@@ -98,28 +127,56 @@ func (h *Handler) handleFrontpage(w http.ResponseWriter, r *http.Request) {
 	} else {
 		public, err := h.projects.ListByVisibility(ctx, database.VisibilityPublic)
 		if err != nil {
-			h.logger.Error("listing public projects", "error", err)
+			h.logger.ErrorContext(ctx, "listing public projects", "error", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 		dbProjects = public
 	}
 
-	var projects []projectCardData
+	sortByLifecycle(dbProjects)
+	h.localizeProjects(w, r, dbProjects)
+
+	projectTags, err := h.tags.List(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing project tags", "error", err)
+	}
+	counts := tagCounts(dbProjects, projectTags)
+	tag := r.URL.Query().Get("tag")
+	if tag != "" {
+		dbProjects = slices.DeleteFunc(dbProjects, func(p database.Project) bool {
+			return !slices.Contains(projectTags[p.ID], tag)
+		})
+	}
+
+	// Cards are cached by their content, which is all they show.
+	var cards []template.HTML
 	for _, p := range dbProjects {
 		card := projectCardData{
 			Name:        p.Name,
 			Slug:        p.Slug,
 			Description: p.Description,
 			Visibility:  p.Visibility,
+			Lifecycle:   p.Lifecycle,
+			Tags:        projectTags[p.ID],
 		}
-		versions, _ := h.versions.ListByProject(ctx, p.ID)
+		versions, _ := h.sortedVersions(ctx, p.ID)
 		card.LatestVersion = latestVersionTag(versions, p.PinnedVersion)
-		projects = append(projects, card)
+		card.Thumbnail = h.hasThumbnail(p.Slug, card.LatestVersion)
+		html, err := h.templates.RenderFragment("project_card", fmt.Sprintf("%#v", card), func() any { return card })
+		if err != nil {
+			h.logger.ErrorContext(ctx, "rendering project card", "error", err, "project", p.Slug)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		cards = append(cards, html)
 	}
 
 	h.render(w, "frontpage", map[string]any{
-		"User":     user,
-		"Projects": projects,
+		"User":      user,
+		"Cards":     cards,
+		"Tag":       tag,
+		"TagCounts": sortedTagCounts(counts),
+		"Recent":    h.recentPages(ctx, user),
 	})
 }
@@ -1,15 +1,27 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
+	"io"
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/qwc/asiakirjat/internal/auth"
 	"github.com/qwc/asiakirjat/internal/config"
+	"github.com/qwc/asiakirjat/internal/database"
 	"github.com/qwc/asiakirjat/internal/docs"
+	"github.com/qwc/asiakirjat/internal/email"
+	"github.com/qwc/asiakirjat/internal/events"
+	"github.com/qwc/asiakirjat/internal/hooks"
+	"github.com/qwc/asiakirjat/internal/scheduler"
 	"github.com/qwc/asiakirjat/internal/store"
+	storecache "github.com/qwc/asiakirjat/internal/store/cache"
 	"github.com/qwc/asiakirjat/internal/templates"
 )
 
@@ -22,157 +34,399 @@ type Handler struct {
 	versions       store.VersionStore
 	users          store.UserStore
 	sessions       store.SessionStore
+	passwordResets store.PasswordResetStore
 	access         store.ProjectAccessStore
 	tokens         store.TokenStore
 	groupMappings  store.AuthGroupMappingStore
+	scimGroups     store.SCIMGroupStore
 	globalAccess   store.GlobalAccessStore
 	uploadLogs     store.UploadLogStore
+	previews       store.PreviewStore
+	attachments    store.AttachmentStore
+	auditLog       store.AuditLogStore
+	feedback       store.FeedbackStore
+	apiKeys        store.APIKeyStore
+	events         store.EventStore
+	eventPublisher events.Publisher
+	watchers       store.WatcherStore
+	mailer         email.Sender
+	metadata       store.MetadataStore
+	tags           store.TagStore
+	translations   store.TranslationStore
+	redirects      store.VersionRedirectStore
+	history        store.HistoryStore
+	analytics      store.AnalyticsStore
+	flags          store.FeatureFlagStore
 	authenticators []auth.Authenticator
+	ldapAuth       *auth.LDAPAuthenticator
 	oauth2Auth     *auth.OAuth2Authenticator
+	proxyAuth      *auth.ProxyAuthenticator
 	sessionMgr     *auth.SessionManager
 	loginLimiter   *RateLimiter
+	feedbackLimit  *RateLimiter
+	apiKeyQuota    *apiKeyQuota
+	fileCache      *docs.FileCache
 	searchIndex    *docs.SearchIndex
+	scheduler      *scheduler.Scheduler
 	logger         *slog.Logger
+	dbPing         func(context.Context) error
+	dbStats        func() sql.DBStats
+	services       Services
+	extensions     []Extension
+	hooks          *hooks.Registry
 
-	// Cache for latest version tags (invalidated on upload/delete)
-	latestTagsCache     map[string]string
-	latestTagsCacheTime time.Time
+	// Database reachability, and the projects whose documentation is
+	// served while it is down (see MonitorDatabase)
+	dbDown           atomic.Bool
+	degradedProjects atomic.Pointer[map[string]*database.Project]
+
+	// Feature flags switched by admins
+	featureFlagCache featureFlagCache
+
+	// Sorted version lists and latest version tags (invalidated on
+	// upload/change/delete)
+	versionCache versionCache
+	// Parsed redirect rules of versions, by storage path (invalidated with
+	// the versions), and of projects, by their text
+	versionRedirects *storecache.TTL[string, []docs.RedirectRule]
+	projectRedirects *storecache.TTL[string, []docs.RedirectRule]
+
+	// Thumbnails being rendered, or whose rendering failed, by "slug/tag"
+	thumbnailRenders sync.Map
+	// Locks of the exports being made, by file path
+	exportLocks sync.Map
 
 	// Reindex state tracking
-	reindexRunning  bool
-	reindexProgress string
-}
+	reindex reindexState
 
-type Deps struct {
-	Config         *config.Config
-	Templates      *templates.Engine
-	Storage        docs.Storage
-	StaticFS       fs.FS
-	Projects       store.ProjectStore
-	Versions       store.VersionStore
-	Users          store.UserStore
-	Sessions       store.SessionStore
-	Access         store.ProjectAccessStore
-	Tokens         store.TokenStore
-	GroupMappings  store.AuthGroupMappingStore
-	GlobalAccess   store.GlobalAccessStore
-	UploadLogs     store.UploadLogStore
-	Authenticators []auth.Authenticator
-	OAuth2Auth     *auth.OAuth2Authenticator
-	SessionMgr     *auth.SessionManager
-	SearchIndex    *docs.SearchIndex
-	Logger         *slog.Logger
+	// Background jobs, waited for on shutdown; jobsCtx is cancelled when
+	// the shutdown timeout is reached
+	jobs         sync.WaitGroup
+	jobsCtx      context.Context
+	cancelJobs   context.CancelFunc
+	shuttingDown atomic.Bool
+	// Expensive jobs, see limitJob, and maintenance tasks shared with
+	// other servers, see lockJob
+	jobLimit   *jobLimiter
+	jobLocks   store.JobLockStore
+	instanceID string
+
+	// Uploads hold uploads for reading while they run; a backup holds it
+	// for writing, so that it waits for them and new ones are refused
+	uploads sync.RWMutex
+	backup  func(context.Context, io.Writer) error
 }
 
 func New(deps Deps) *Handler {
-	return &Handler{
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	h := &Handler{
 		config:         deps.Config,
 		templates:      deps.Templates,
-		storage:        deps.Storage,
+		storage:        deps.Versions.Storage,
 		staticFS:       deps.StaticFS,
-		projects:       deps.Projects,
-		versions:       deps.Versions,
-		users:          deps.Users,
-		sessions:       deps.Sessions,
-		access:         deps.Access,
-		tokens:         deps.Tokens,
-		groupMappings:  deps.GroupMappings,
-		globalAccess:   deps.GlobalAccess,
-		uploadLogs:     deps.UploadLogs,
-		authenticators: deps.Authenticators,
-		oauth2Auth:     deps.OAuth2Auth,
-		sessionMgr:     deps.SessionMgr,
+		projects:       deps.Projects.Projects,
+		versions:       deps.Versions.Versions,
+		users:          deps.Access.Users,
+		sessions:       deps.Access.Sessions,
+		passwordResets: deps.Access.PasswordResets,
+		access:         deps.Access.Access,
+		tokens:         deps.Access.Tokens,
+		groupMappings:  deps.Access.GroupMappings,
+		scimGroups:     deps.Access.SCIMGroups,
+		globalAccess:   deps.Access.GlobalAccess,
+		uploadLogs:     deps.Versions.UploadLogs,
+		previews:       deps.Versions.Previews,
+		attachments:    deps.Versions.Attachments,
+		auditLog:       deps.Activity.AuditLog,
+		feedback:       deps.Activity.Feedback,
+		apiKeys:        deps.Access.APIKeys,
+		events:         deps.Activity.Events,
+		eventPublisher: deps.Activity.EventPublisher,
+		watchers:       deps.Activity.Watchers,
+		mailer:         deps.Activity.Mailer,
+		metadata:       deps.Projects.Metadata,
+		tags:           deps.Projects.Tags,
+		translations:   deps.Projects.Translations,
+		redirects:      deps.Versions.Redirects,
+		history:        deps.Versions.History,
+		analytics:      deps.Activity.Analytics,
+		flags:          deps.FeatureFlags,
+		authenticators: deps.Access.Authenticators,
+		ldapAuth:       deps.Access.LDAPAuth,
+		oauth2Auth:     deps.Access.OAuth2Auth,
+		proxyAuth:      deps.Access.ProxyAuth,
+		sessionMgr:     deps.Access.SessionMgr,
 		loginLimiter:   NewRateLimiter(10, 60*time.Second),
-		searchIndex:    deps.SearchIndex,
+		feedbackLimit:  NewRateLimiter(20, time.Hour),
+		apiKeyQuota:    newAPIKeyQuota(),
+		fileCache:      docs.NewFileCache(deps.Config.Cache.MemorySizeBytes(), deps.Config.Cache.MemoryMaxFileBytes()),
+		searchIndex:    deps.Versions.SearchIndex,
+		scheduler:      deps.Scheduler,
 		logger:         deps.Logger,
+		dbPing:         deps.DBPing,
+		dbStats:        deps.DBStats,
+		backup:         deps.Backup,
+		services:       deps.Services,
+		extensions:     deps.Extensions,
+		hooks:          deps.Hooks,
+		jobsCtx:        jobsCtx,
+		cancelJobs:     cancelJobs,
+		jobLimit:       newJobLimiter(deps.Config.Maintenance.MaxParallelJobs),
+		jobLocks:       deps.JobLocks,
+		instanceID:     newInstanceID(),
+
+		versionRedirects: storecache.NewTTL[string, []docs.RedirectRule](time.Duration(deps.Config.Cache.StoreTTL) * time.Second),
+		projectRedirects: storecache.NewTTL[string, []docs.RedirectRule](time.Duration(deps.Config.Cache.StoreTTL) * time.Second),
 	}
+	h.warnUnknownFeatures()
+	return h
 }
 
+// RegisterRoutes registers the routes of routes, and then those of the
+// extensions, with their authorization policies.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	// Use RoutePrefix for route registration (empty when proxy strips path)
 	bp := h.config.RoutePrefix()
+	for _, rt := range h.routes() {
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		mux.HandleFunc(method+" "+bp+path, h.authorize(rt.policy, rt.handler))
+	}
+	extRoutes, err := h.extensionRoutes()
+	if err != nil {
+		panic(err)
+	}
+	for _, rt := range extRoutes {
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		mux.HandleFunc(method+" "+bp+path, h.authorize(rt.policy, rt.handler))
+	}
 
-	// Static files
-	mux.Handle("GET "+bp+"/static/", http.StripPrefix(bp+"/static/", http.FileServerFS(h.staticFS)))
-
-	// Public pages
-	mux.HandleFunc("GET "+bp+"/{$}", h.withSession(h.handleFrontpage))
-	mux.HandleFunc("GET "+bp+"/login", h.withSession(h.handleLoginPage))
-	mux.HandleFunc("POST "+bp+"/login", withRateLimit(h.loginLimiter, h.withSession(h.handleLoginSubmit)))
-	mux.HandleFunc("GET "+bp+"/logout", h.withSession(h.handleLogout))
-	mux.HandleFunc("GET "+bp+"/licenses", h.withSession(h.handleLicenses))
-	mux.HandleFunc("GET "+bp+"/auth/oauth2", h.handleOAuth2Login)
-	mux.HandleFunc("GET "+bp+"/auth/callback", h.withSession(h.handleOAuth2Callback))
-
-	// Project pages
-	mux.HandleFunc("GET "+bp+"/project/{slug}", h.withSession(h.handleProjectDetail))
-	mux.HandleFunc("GET "+bp+"/project/{slug}/{version}/{path...}", h.withSession(h.handleServeDoc))
-	mux.HandleFunc("GET "+bp+"/project/{slug}/upload", h.withSession(h.requireAuth(h.handleUploadForm)))
-	mux.HandleFunc("POST "+bp+"/project/{slug}/upload", h.withSession(h.requireAuth(h.handleUploadSubmit)))
-	mux.HandleFunc("POST "+bp+"/project/{slug}/version/{tag}/delete", h.withSession(h.requireAuth(h.handleDeleteVersion)))
-	mux.HandleFunc("POST "+bp+"/project/{slug}/version/{tag}/pin", h.withSession(h.requireAuth(h.handlePinVersion)))
-	mux.HandleFunc("POST "+bp+"/project/{slug}/unpin", h.withSession(h.requireAuth(h.handleUnpinVersion)))
-	mux.HandleFunc("GET "+bp+"/project/{slug}/version/{tag}/download", h.withSession(h.handleDownloadVersion))
-
-	// Project token management (for editors)
-	mux.HandleFunc("GET "+bp+"/project/{slug}/tokens", h.withSession(h.requireAuth(h.handleProjectTokens)))
-	mux.HandleFunc("POST "+bp+"/project/{slug}/tokens", h.withSession(h.requireAuth(h.handleProjectCreateToken)))
-	mux.HandleFunc("POST "+bp+"/project/{slug}/tokens/{id}/revoke", h.withSession(h.requireAuth(h.handleProjectRevokeToken)))
-
-	// Search
-	mux.HandleFunc("GET "+bp+"/search", h.withSession(h.handleSearchPage))
-	mux.HandleFunc("GET "+bp+"/api/search", h.withSession(h.handleAPISearch))
-
-	// API endpoints
-	mux.HandleFunc("GET "+bp+"/api/projects", h.withSession(h.handleAPIProjects))
-	mux.HandleFunc("POST "+bp+"/api/projects", h.handleAPICreateProject)
-	mux.HandleFunc("GET "+bp+"/api/project/{slug}/versions", h.withSession(h.handleAPIVersions))
-	mux.HandleFunc("POST "+bp+"/api/project/{slug}/upload", h.handleAPIUpload)
-	mux.HandleFunc("POST "+bp+"/api/upload", h.handleAPIUploadGeneral)
-
-	// Profile routes
-	mux.HandleFunc("GET "+bp+"/profile", h.withSession(h.requireAuth(h.handleProfilePage)))
-	mux.HandleFunc("POST "+bp+"/profile/password", h.withSession(h.requireAuth(h.handleChangePassword)))
-
-	// Admin routes (project list + create accessible to editors)
-	mux.HandleFunc("GET "+bp+"/admin/projects", h.withSession(h.requireEditorOrAdmin(h.handleAdminProjects)))
-	mux.HandleFunc("POST "+bp+"/admin/projects", h.withSession(h.requireEditorOrAdmin(h.handleAdminCreateProject)))
-	mux.HandleFunc("GET "+bp+"/admin/projects/{slug}/edit", h.withSession(h.requireAdmin(h.handleAdminEditProject)))
-	mux.HandleFunc("POST "+bp+"/admin/projects/{slug}/edit", h.withSession(h.requireAdmin(h.handleAdminUpdateProject)))
-	mux.HandleFunc("POST "+bp+"/admin/projects/{slug}/delete", h.withSession(h.requireAdmin(h.handleAdminDeleteProject)))
-	mux.HandleFunc("POST "+bp+"/admin/projects/{slug}/access/grant", h.withSession(h.requireAdmin(h.handleAdminGrantAccess)))
-	mux.HandleFunc("POST "+bp+"/admin/projects/{slug}/access/revoke", h.withSession(h.requireAdmin(h.handleAdminRevokeAccess)))
-	mux.HandleFunc("GET "+bp+"/admin/users", h.withSession(h.requireAdmin(h.handleAdminUsers)))
-	mux.HandleFunc("POST "+bp+"/admin/users", h.withSession(h.requireAdmin(h.handleAdminCreateUser)))
-	mux.HandleFunc("POST "+bp+"/admin/users/{id}/delete", h.withSession(h.requireAdmin(h.handleAdminDeleteUser)))
-	mux.HandleFunc("POST "+bp+"/admin/users/{id}/role", h.withSession(h.requireAdmin(h.handleAdminUpdateUserRole)))
-	mux.HandleFunc("POST "+bp+"/admin/users/{id}/password", h.withSession(h.requireAdmin(h.handleAdminResetPassword)))
-	mux.HandleFunc("GET "+bp+"/admin/robots", h.withSession(h.requireAdmin(h.handleAdminRobots)))
-	mux.HandleFunc("POST "+bp+"/admin/robots", h.withSession(h.requireAdmin(h.handleAdminCreateRobot)))
-	mux.HandleFunc("POST "+bp+"/admin/robots/{id}/tokens", h.withSession(h.requireAdmin(h.handleAdminGenerateToken)))
-	mux.HandleFunc("POST "+bp+"/admin/robots/{id}/tokens/{tid}/revoke", h.withSession(h.requireAdmin(h.handleAdminRevokeToken)))
-	mux.HandleFunc("POST "+bp+"/admin/robots/{id}/delete", h.withSession(h.requireAdmin(h.handleAdminDeleteRobot)))
-	mux.HandleFunc("POST "+bp+"/admin/reindex", h.withSession(h.requireAdmin(h.handleAdminReindex)))
-	mux.HandleFunc("GET "+bp+"/admin/groups", h.withSession(h.requireAdmin(h.handleAdminGroups)))
-	mux.HandleFunc("POST "+bp+"/admin/groups", h.withSession(h.requireAdmin(h.handleAdminCreateGroupMapping)))
-	mux.HandleFunc("POST "+bp+"/admin/groups/{id}/delete", h.withSession(h.requireAdmin(h.handleAdminDeleteGroupMapping)))
-	mux.HandleFunc("GET "+bp+"/admin/global-access", h.withSession(h.requireAdmin(h.handleAdminGlobalAccess)))
-	mux.HandleFunc("POST "+bp+"/admin/global-access", h.withSession(h.requireAdmin(h.handleAdminCreateGlobalAccessRule)))
-	mux.HandleFunc("POST "+bp+"/admin/global-access/{id}/delete", h.withSession(h.requireAdmin(h.handleAdminDeleteGlobalAccessRule)))
-	mux.HandleFunc("POST "+bp+"/admin/deploy-docs", h.withSession(h.requireAdmin(h.handleAdminDeployBuiltinDocs)))
-
-	// Health check (keep at root for load balancer compatibility, but also at base path)
-	mux.HandleFunc("GET "+bp+"/healthz", h.handleHealthz)
+	// Keep the health check at root for load balancer compatibility
 	if bp != "" {
-		mux.HandleFunc("GET /healthz", h.handleHealthz)
+		mux.HandleFunc("GET /healthz", h.authorize(policyPublic, h.handleHealthz))
+		mux.HandleFunc("GET /readyz", h.authorize(policyPublic, h.handleReadyz))
 		// Redirect root to base path for convenience when routes are prefixed
-		mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		mux.HandleFunc("GET /{$}", h.authorize(policyPublic, func(w http.ResponseWriter, r *http.Request) {
 			http.Redirect(w, r, h.config.Server.BasePath+"/", http.StatusFound)
-		})
+		}))
+	}
+}
+
+// routes lists the routes below the base path. Every route states the
+// policy that authorizes its requests, so that none is served without
+// access checks by mistake; TestRoutePolicies lists them all.
+func (h *Handler) routes() []route {
+	bp := h.config.RoutePrefix()
+	return []route{
+		// Static files
+		{"GET /static/", policyPublic, http.StripPrefix(bp+"/static/", http.FileServerFS(h.staticFS)).ServeHTTP},
+
+		// Public pages
+		{"GET /{$}", policySession, h.handleFrontpage},
+		{"GET /login", policySession, h.handleLoginPage},
+		{"POST /login", policySession, withRateLimit(h.loginLimiter, h.handleLoginSubmit)},
+		{"GET /logout", policySession, h.handleLogout},
+		{"GET /forgot-password", policySession, h.handleForgotPasswordPage},
+		{"POST /forgot-password", policySession, withRateLimit(h.loginLimiter, h.handleForgotPasswordSubmit)},
+		{"GET /reset-password", policySession, h.handleResetPasswordPage},
+		{"POST /reset-password", policySession, withRateLimit(h.loginLimiter, h.handleResetPasswordSubmit)},
+		{"GET /licenses", policySession, h.handleLicenses},
+		{"GET /auth/oauth2", policyPublic, h.handleOAuth2Login},
+		{"GET /auth/callback", policySession, h.handleOAuth2Callback},
+
+		// Search engines
+		{"GET /robots.txt", policyPublic, h.handleRobots},
+		{"GET /offline-sw.js", policyPublic, h.handleOfflineServiceWorker},
+		{"GET /sitemap.xml", policyPublic, h.handleSitemap},
+		{"GET /opensearch.xml", policyPublic, h.handleOpenSearch},
+
+		// Feeds; feed readers cannot log in and send a feed token instead,
+		// checked by the handlers
+		{"GET /feed.atom", policyPublic, h.handleReleasesFeed},
+		{"GET /project/{slug}/feed.atom", policyPublic, h.handleProjectFeed},
+		{"GET /watching.atom", policyPublic, h.handleWatchingFeed},
+
+		// Project pages
+		{"GET /project/{slug}", policySession, h.handleProjectDetail},
+		{"POST /project/{slug}/watch", policyUser, h.handleWatchProject},
+		{"GET /project/{slug}/{version}/{path...}", policySession, h.handleServeDoc},
+		{"GET /project/{slug}/{version}/download.zip", policySession, h.handleDownloadVersionZip},
+		{"GET /project/{slug}/preview/{id}/{path...}", policySession, h.handleServePreview},
+		{"GET /project/{slug}/opensearch.xml", policySession, h.handleProjectOpenSearch},
+		{"GET /project/{slug}/versions.json", policySession, h.handleVersionSwitcher},
+		{"GET /project/{slug}/upload", policyUser, h.handleUploadForm},
+		{"POST /project/{slug}/upload", policyUser, h.handleUploadSubmit},
+		{"POST /project/{slug}/version/{tag}/delete", policyUser, h.handleDeleteVersion},
+		{"POST /project/{slug}/version/{tag}/pin", policyUser, h.handlePinVersion},
+		{"POST /project/{slug}/version/{tag}/protect", policyUser, h.handleProtectVersion},
+		{"POST /project/{slug}/version/{tag}/lifecycle", policyUser, h.handleVersionLifecycle},
+		{"POST /project/{slug}/version/{tag}/rename", policyUser, h.handleRenameVersion},
+		{"POST /project/{slug}/unpin", policyUser, h.handleUnpinVersion},
+		{"GET /project/{slug}/version/{tag}/download", policySession, h.handleDownloadVersion},
+		{"GET /project/{slug}/version/{tag}/offline.json", policySession, h.handleOfflineManifest},
+		{"GET /project/{slug}/version/{tag}/attachments/{kind}", policySession, h.handleDownloadAttachment},
+		{"GET /project/{slug}/version/{tag}/accessibility", policySession, h.handleAccessibilityReport},
+		{"GET /project/{slug}/version/{tag}/links", policySession, h.handleLinkReport},
+		{"GET /project/{slug}/version/{tag}/thumbnail.png", policySession, h.handleThumbnail},
+		{"GET /project/{slug}/version/{tag}/export/{format}", policySession, h.handleExportVersion},
+
+		// Project token management (for editors)
+		{"GET /project/{slug}/tokens", policyUser, h.handleProjectTokens},
+		{"POST /project/{slug}/tokens", policyUser, h.handleProjectCreateToken},
+		{"POST /project/{slug}/tokens/{id}/revoke", policyUser, h.handleProjectRevokeToken},
+		{"GET /project/{slug}/redirects", policyUser, h.handleProjectRedirects},
+		{"POST /project/{slug}/redirects", policyUser, h.handleProjectSaveRedirects},
+		{"GET /project/{slug}/feedback", policyUser, h.handleProjectFeedback},
+		{"POST /project/{slug}/feedback", policySession, withRateLimit(h.feedbackLimit, h.handleSubmitFeedback)},
+		{"POST /project/{slug}/feedback/{id}/delete", policyUser, h.handleDeleteFeedback},
+		{"GET /project/{slug}/analytics", policyUser, h.handleProjectAnalytics},
+
+		// Search
+		{"GET /search", policySession, h.handleSearchPage},
+		{"GET /api/search", apiPolicy(auth.ScopeRead), h.handleAPISearch},
+		{"GET /api/search/suggest", apiPolicy(auth.ScopeRead), h.handleAPISearchSuggest},
+
+		// API endpoints
+		{"GET /api/projects", apiPolicy(auth.ScopeRead), h.handleAPIProjects},
+		{"GET /api/events", apiPolicy(auth.ScopeRead), h.handleAPIEvents},
+		{"GET /api/history", apiPolicy(auth.ScopeRead), h.handleAPIHistory},
+		{"GET /api/project/{slug}/analytics", apiPolicy(auth.ScopeRead), h.handleAPIProjectAnalytics},
+
+		// Backstage TechDocs compatible API
+		{"GET /api/techdocs/static/docs/{namespace}/{kind}/{name}/{path...}", apiPolicy(auth.ScopeRead), h.handleTechDocsStatic},
+		{"GET /api/techdocs/metadata/techdocs/{namespace}/{kind}/{name}", apiPolicy(auth.ScopeRead), h.handleTechDocsMetadata},
+		{"GET /api/techdocs/metadata/entity/{namespace}/{kind}/{name}", apiPolicy(auth.ScopeRead), h.handleTechDocsEntityMetadata},
+		{"GET /api/techdocs/sync/{namespace}/{kind}/{name}", apiPolicy(auth.ScopeRead), h.handleTechDocsSync},
+		{"POST /api/projects", tokenPolicy(auth.ScopeUpload), h.handleAPICreateProject},
+		{"GET /api/search-index/export", tokenPolicy(auth.ScopeAdminProject), h.handleAPIExportSearchIndex},
+		{"GET /api/admin/reindex/status", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPIReindexStatus},
+		{"POST /api/admin/reindex", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPIReindex},
+		{"POST /api/admin/reindex/projects/{slug}", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPIReindexProject},
+		{"POST /api/admin/reindex/projects/{slug}/versions/{tag}", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPIReindexVersion},
+		{"GET /api/admin/storage", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPIStorageUsage},
+		{"GET /api/admin/backup", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPIBackup},
+		{"GET /api/admin/users", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPIListUsers},
+		{"GET /api/admin/users/{username}", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPIGetUser},
+		{"PUT /api/admin/users/{username}", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPIPutUser},
+		{"DELETE /api/admin/users/{username}", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPIDeleteUser},
+		{"POST /api/admin/users/{username}/tokens", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPICreateRobotToken},
+		{"GET /api/admin/projects/{slug}/access", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPIGetProjectAccess},
+		{"PUT /api/admin/projects/{slug}/access", apiAdminPolicy(auth.ScopeAdminProject), h.handleAPIPutProjectAccess},
+		{"GET /api/project/{slug}/versions", apiPolicy(auth.ScopeRead), h.handleAPIVersions},
+		{"GET /api/project/{slug}/version/{tag}", apiPolicy(auth.ScopeRead), h.handleAPIGetVersion},
+		{"DELETE /api/project/{slug}/version/{tag}", tokenPolicy(auth.ScopeDelete), h.handleAPIDeleteVersion},
+		{"GET /api/project/{slug}/version/{tag}/download.zip", apiPolicy(auth.ScopeRead), h.handleAPIDownloadVersion},
+		{"GET /api/project/{slug}/version/{tag}/manifest", apiPolicy(auth.ScopeRead), h.handleAPIVersionManifest},
+		{"GET /api/project/{slug}/version/{tag}/attachments/{kind}", apiPolicy(auth.ScopeRead), h.handleAPIDownloadAttachment},
+		{"GET /api/project/{slug}/version/{tag}/accessibility", apiPolicy(auth.ScopeRead), h.handleAPIAccessibilityReport},
+		{"GET /api/project/{slug}/version/{tag}/links", apiPolicy(auth.ScopeRead), h.handleAPILinkReport},
+		{"PUT /api/project/{slug}/version/{tag}/protected", tokenPolicy(auth.ScopeUpload), h.handleAPIProtectVersion},
+		{"PUT /api/project/{slug}/version/{tag}/lifecycle", tokenPolicy(auth.ScopeUpload), h.handleAPIVersionLifecycle},
+		{"POST /api/project/{slug}/version/{tag}/rename", tokenPolicy(auth.ScopeUpload), h.handleAPIRenameVersion},
+		{"GET /api/project/{slug}/version/{tag}/metadata", apiPolicy(auth.ScopeRead), h.handleAPIGetVersionMetadata},
+		{"PUT /api/project/{slug}/version/{tag}/metadata", tokenPolicy(auth.ScopeUpload), h.handleAPIPutVersionMetadata},
+		{"GET /api/project/{slug}/metadata", apiPolicy(auth.ScopeRead), h.handleAPIGetProjectMetadata},
+		{"PUT /api/project/{slug}/metadata", tokenPolicy(auth.ScopeAdminProject), h.handleAPIPutProjectMetadata},
+		{"GET /api/project/{slug}/tags", apiPolicy(auth.ScopeRead), h.handleAPIGetProjectTags},
+		{"PUT /api/project/{slug}/tags", tokenPolicy(auth.ScopeAdminProject), h.handleAPIPutProjectTags},
+		{"GET /api/project/{slug}/translations", apiPolicy(auth.ScopeRead), h.handleAPIGetProjectTranslations},
+		{"PUT /api/project/{slug}/translations", tokenPolicy(auth.ScopeAdminProject), h.handleAPIPutProjectTranslations},
+		{"POST /api/project/{slug}/upload", tokenPolicy(auth.ScopeUpload), h.handleAPIUpload},
+		{"POST /api/upload", tokenPolicy(auth.ScopeUpload), h.handleAPIUploadGeneral},
+		{"GET /api/project/{slug}/previews", apiPolicy(auth.ScopeRead), h.handleAPIListPreviews},
+		{"POST /api/project/{slug}/preview/{id}/upload", tokenPolicy(auth.ScopeUpload), h.handleAPIUploadPreview},
+		{"DELETE /api/project/{slug}/preview/{id}", tokenPolicy(auth.ScopeUpload), h.handleAPIDeletePreview},
+
+		// Declarative API (create-or-update by natural key)
+		{"GET /api/project/{slug}", apiPolicy(auth.ScopeRead), h.handleAPIGetProject},
+		{"PUT /api/project/{slug}", tokenPolicy(auth.ScopeAdminProject), h.handleAPIPutProject},
+		{"DELETE /api/project/{slug}", tokenPolicy(auth.ScopeAdminProject), h.handleAPIDeleteProject},
+		{"GET /api/project/{slug}/access/{username}", tokenPolicy(auth.ScopeAdminProject), h.handleAPIGetAccess},
+		{"PUT /api/project/{slug}/access/{username}", tokenPolicy(auth.ScopeAdminProject), h.handleAPIPutAccess},
+		{"DELETE /api/project/{slug}/access/{username}", tokenPolicy(auth.ScopeAdminProject), h.handleAPIDeleteAccess},
+		{"GET /api/project/{slug}/group-mappings/{source}/{group...}", tokenPolicy(auth.ScopeAdminProject), h.handleAPIGetGroupMapping},
+		{"PUT /api/project/{slug}/group-mappings/{source}/{group...}", tokenPolicy(auth.ScopeAdminProject), h.handleAPIPutGroupMapping},
+		{"DELETE /api/project/{slug}/group-mappings/{source}/{group...}", tokenPolicy(auth.ScopeAdminProject), h.handleAPIDeleteGroupMapping},
+
+		// SCIM provisioning by identity providers
+		{"GET /scim/v2/ServiceProviderConfig", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMServiceProviderConfig)},
+		{"GET /scim/v2/Users", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMListUsers)},
+		{"POST /scim/v2/Users", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMCreateUser)},
+		{"GET /scim/v2/Users/{id}", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMGetUser)},
+		{"PUT /scim/v2/Users/{id}", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMReplaceUser)},
+		{"PATCH /scim/v2/Users/{id}", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMPatchUser)},
+		{"DELETE /scim/v2/Users/{id}", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMDeleteUser)},
+		{"GET /scim/v2/Groups", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMListGroups)},
+		{"POST /scim/v2/Groups", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMCreateGroup)},
+		{"GET /scim/v2/Groups/{id}", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMGetGroup)},
+		{"PUT /scim/v2/Groups/{id}", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMReplaceGroup)},
+		{"PATCH /scim/v2/Groups/{id}", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMPatchGroup)},
+		{"DELETE /scim/v2/Groups/{id}", apiAdminPolicy(auth.ScopeSCIM), h.scimOnly(h.handleSCIMDeleteGroup)},
+
+		// Profile routes
+		{"GET /profile", policyUser, h.handleProfilePage},
+		{"POST /profile/password", policyUser, h.handleChangePassword},
+		{"POST /profile/theme", policyUser, h.handleSetTheme},
+		{"POST /profile/history/clear", policyUser, h.handleClearHistory},
+		{"POST /profile/feed-token", policyUser, h.handleCreateFeedToken},
+		{"POST /profile/digest", policyUser, h.handleSetDigest},
+		{"POST /profile/sessions/{id}/revoke", policyUser, h.handleRevokeSession},
+		{"POST /profile/sessions/revoke-others", policyUser, h.handleRevokeOtherSessions},
+
+		// Admin routes (project list + create accessible to editors)
+		{"GET /admin/projects", policyEditor, h.handleAdminProjects},
+		{"POST /admin/projects", policyEditor, h.handleAdminCreateProject},
+		{"GET /admin/projects/{slug}/edit", policyAdmin, h.handleAdminEditProject},
+		{"POST /admin/projects/{slug}/edit", policyAdmin, h.handleAdminUpdateProject},
+		{"POST /admin/projects/{slug}/delete", policyAdmin, h.handleAdminDeleteProject},
+		{"POST /admin/projects/{slug}/access/grant", policyAdmin, h.handleAdminGrantAccess},
+		{"POST /admin/projects/{slug}/access/revoke", policyAdmin, h.handleAdminRevokeAccess},
+		{"GET /admin/users", policyAdmin, h.handleAdminUsers},
+		{"POST /admin/users", policyAdmin, h.handleAdminCreateUser},
+		{"POST /admin/users/{id}/delete", policyAdmin, h.handleAdminDeleteUser},
+		{"POST /admin/users/{id}/role", policyAdmin, h.handleAdminUpdateUserRole},
+		{"POST /admin/users/{id}/password", policyAdmin, h.handleAdminResetPassword},
+		{"GET /admin/robots", policyAdmin, h.handleAdminRobots},
+		{"POST /admin/robots", policyAdmin, h.handleAdminCreateRobot},
+		{"POST /admin/robots/{id}/tokens", policyAdmin, h.handleAdminGenerateToken},
+		{"POST /admin/robots/{id}/tokens/{tid}/revoke", policyAdmin, h.handleAdminRevokeToken},
+		{"POST /admin/robots/{id}/delete", policyAdmin, h.handleAdminDeleteRobot},
+		{"GET /admin/api-keys", policyAdmin, h.handleAdminAPIKeys},
+		{"POST /admin/api-keys", policyAdmin, h.handleAdminCreateAPIKey},
+		{"POST /admin/api-keys/{id}/delete", policyAdmin, h.handleAdminDeleteAPIKey},
+		{"GET /admin/tokens/rotation", policyAdmin, h.handleAdminTokenRotation},
+		{"GET /admin/tokens/rotation.csv", policyAdmin, h.handleAdminTokenRotationCSV},
+		{"POST /admin/tokens/rotation", policyAdmin, h.handleAdminRunTokenRotation},
+		{"POST /admin/reindex", policyAdmin, h.handleAdminReindex},
+		{"POST /admin/projects/{slug}/reindex", policyAdmin, h.handleAdminReindexProject},
+		{"GET /admin/search-index/export", policyAdmin, h.handleAdminExportSearchIndex},
+		{"GET /admin/groups", policyAdmin, h.handleAdminGroups},
+		{"POST /admin/groups", policyAdmin, h.handleAdminCreateGroupMapping},
+		{"POST /admin/groups/{id}/delete", policyAdmin, h.handleAdminDeleteGroupMapping},
+		{"POST /admin/groups/ldap-sync", policyAdmin, h.handleAdminSyncLDAP},
+		{"GET /admin/sessions", policyAdmin, h.handleAdminSessions},
+		{"POST /admin/sessions/{id}/revoke", policyAdmin, h.handleAdminRevokeSession},
+		{"GET /admin/global-access", policyAdmin, h.handleAdminGlobalAccess},
+		{"POST /admin/global-access", policyAdmin, h.handleAdminCreateGlobalAccessRule},
+		{"POST /admin/global-access/{id}/delete", policyAdmin, h.handleAdminDeleteGlobalAccessRule},
+		{"POST /admin/deploy-docs", policyAdmin, h.handleAdminDeployBuiltinDocs},
+		{"GET /admin/maintenance", policyAdmin, h.handleAdminMaintenance},
+		{"POST /admin/maintenance/{task}/run", policyAdmin, h.handleAdminRunMaintenanceTask},
+		{"POST /admin/features/{name}", policyAdmin, h.handleAdminSetFeatureFlag},
+		{"GET /admin/loadtest/k6.js", policyAdmin, h.handleAdminLoadTestScript},
+
+		// Health check, also at the root when routes are prefixed, see RegisterRoutes
+		{"GET /healthz", policyPublic, h.handleHealthz},
+		{"GET /readyz", policyPublic, h.handleReadyz},
 	}
 }
 
 func (h *Handler) render(w http.ResponseWriter, name string, data map[string]any) {
+	if data == nil {
+		data = map[string]any{}
+	}
+	if _, ok := data["Features"]; !ok {
+		data["Features"] = h.enabledFeatures(context.Background(), nil)
+	}
 	if err := h.templates.Render(w, name, data); err != nil {
 		h.logger.Error("template render error", "template", name, "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -34,7 +34,7 @@ type testApp struct {
 	db      interface{}
 }
 
-func setupTestApp(t *testing.T) *testApp {
+func setupTestApp(t testing.TB) *testApp {
 	t.Helper()
 
 	db := testutil.NewTestDB(t)
@@ -47,13 +47,30 @@ func setupTestApp(t *testing.T) *testApp {
 	versionStore := sqlstore.NewVersionStore(db)
 	userStore := sqlstore.NewUserStore(db)
 	sessionStore := sqlstore.NewSessionStore(db)
+	passwordResetStore := sqlstore.NewPasswordResetStore(db)
+	scimGroupStore := sqlstore.NewSCIMGroupStore(db)
 	accessStore := sqlstore.NewProjectAccessStore(db)
 	tokenStore := sqlstore.NewTokenStore(db)
 	uploadLogStore := sqlstore.NewUploadLogStore(db)
+	attachmentStore := sqlstore.NewAttachmentStore(db)
+	auditLogStore := sqlstore.NewAuditLogStore(db)
+	feedbackStore := sqlstore.NewFeedbackStore(db)
+	apiKeyStore := sqlstore.NewAPIKeyStore(db)
+	groupMappingStore := sqlstore.NewAuthGroupMappingStore(db)
+	eventStore := sqlstore.NewEventStore(db)
+	watcherStore := sqlstore.NewWatcherStore(db)
+	metadataStore := sqlstore.NewMetadataStore(db)
+	tagStore := sqlstore.NewTagStore(db)
+	translationStore := sqlstore.NewTranslationStore(db)
+	versionRedirectStore := sqlstore.NewVersionRedirectStore(db)
+	historyStore := sqlstore.NewHistoryStore(db)
+	previewStore := sqlstore.NewPreviewStore(db)
+	analyticsStore := sqlstore.NewAnalyticsStore(db)
+	featureFlagStore := sqlstore.NewFeatureFlagStore(db)
 
 	storage := docs.NewFilesystemStorage(storageDir)
 
-	searchIndex, err := docs.NewSearchIndex(storageDir)
+	searchIndex, err := docs.NewSearchIndex(filepath.Join(t.TempDir(), "search-index"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -75,26 +92,55 @@ func setupTestApp(t *testing.T) *testApp {
 	os.WriteFile(filepath.Join(staticDir, "js", "search.js"), []byte("// test"), 0644)
 	os.WriteFile(filepath.Join(staticDir, "js", "overlay.js"), []byte("// test"), 0644)
 	os.WriteFile(filepath.Join(staticDir, "js", "navbar-search.js"), []byte("// test"), 0644)
+	os.WriteFile(filepath.Join(staticDir, "js", "offline-sw.js"), []byte("// test"), 0644)
 	staticFS := os.DirFS(staticDir)
 
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
 
 	h := New(Deps{
-		Config:         &cfg,
-		Templates:      tmpl,
-		Storage:        storage,
-		StaticFS:       staticFS,
-		Projects:       projectStore,
-		Versions:       versionStore,
-		Users:          userStore,
-		Sessions:       sessionStore,
-		Access:         accessStore,
-		Tokens:         tokenStore,
-		UploadLogs:     uploadLogStore,
-		Authenticators: []auth.Authenticator{builtinAuth},
-		SessionMgr:     sessionMgr,
-		SearchIndex:    searchIndex,
-		Logger:         logger,
+		Services: Services{
+			Config: &cfg,
+			Logger: logger,
+			Projects: ProjectService{
+				Projects:     projectStore,
+				Metadata:     metadataStore,
+				Tags:         tagStore,
+				Translations: translationStore,
+			},
+			Versions: VersionService{
+				Versions:    versionStore,
+				Storage:     storage,
+				SearchIndex: searchIndex,
+				Attachments: attachmentStore,
+				UploadLogs:  uploadLogStore,
+				Redirects:   versionRedirectStore,
+				History:     historyStore,
+				Previews:    previewStore,
+			},
+			Access: AccessService{
+				Users:          userStore,
+				Sessions:       sessionStore,
+				PasswordResets: passwordResetStore,
+				Access:         accessStore,
+				GroupMappings:  groupMappingStore,
+				SCIMGroups:     scimGroupStore,
+				Tokens:         tokenStore,
+				APIKeys:        apiKeyStore,
+				Authenticators: []auth.Authenticator{builtinAuth},
+				SessionMgr:     sessionMgr,
+			},
+			Activity: ActivityService{
+				AuditLog:  auditLogStore,
+				Events:    eventStore,
+				Watchers:  watcherStore,
+				Feedback:  feedbackStore,
+				Analytics: analyticsStore,
+			},
+			FeatureFlags: featureFlagStore,
+			JobLocks:     sqlstore.NewJobLockStore(db),
+		},
+		Templates: tmpl,
+		StaticFS:  staticFS,
 	})
 
 	mux := http.NewServeMux()
@@ -106,7 +152,7 @@ func setupTestApp(t *testing.T) *testApp {
 	return &testApp{handler: h, mux: mux, server: server, db: db}
 }
 
-func seedAdmin(t *testing.T, app *testApp) *database.User {
+func seedAdmin(t testing.TB, app *testApp) *database.User {
 	t.Helper()
 	ctx := context.Background()
 	hash, _ := auth.HashPassword("admin123")
@@ -123,7 +169,7 @@ func seedAdmin(t *testing.T, app *testApp) *database.User {
 	return user
 }
 
-func seedProject(t *testing.T, app *testApp, slug, name string, isPublic bool) *database.Project {
+func seedProject(t testing.TB, app *testApp, slug, name string, isPublic bool) *database.Project {
 	t.Helper()
 	ctx := context.Background()
 	visibility := database.VisibilityCustom
@@ -669,7 +715,7 @@ func TestLoginPageRedirectsAuthenticatedUser(t *testing.T) {
 	}
 }
 
-func createTestZip(t *testing.T, files map[string]string) *bytes.Buffer {
+func createTestZip(t testing.TB, files map[string]string) *bytes.Buffer {
 	t.Helper()
 	buf := new(bytes.Buffer)
 	w := zip.NewWriter(buf)
@@ -1335,7 +1381,10 @@ func TestAPIUploadWithBearerToken(t *testing.T) {
 	}
 
 	// Verify docs are served
-	docResp, _ := http.Get(app.server.URL + "/project/api-proj/v2.0.0/index.html")
+	docResp, err := http.Get(app.server.URL + "/project/api-proj/v2.0.0/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer docResp.Body.Close()
 
 	if docResp.StatusCode != http.StatusOK {
@@ -2260,7 +2309,7 @@ func TestSearchAPIReturnsResultsAfterIndexing(t *testing.T) {
 	app.handler.versions.Create(ctx, version)
 
 	// Index synchronously for the test
-	err := app.handler.searchIndex.IndexVersion(project.ID, version.ID, "searchable", "Searchable Docs", "v1.0.0", versionPath)
+	err := app.handler.searchIndex.IndexVersion(context.Background(), project.ID, version.ID, "searchable", "Searchable Docs", "v1.0.0", versionPath)
 	if err != nil {
 		t.Fatal("indexing failed:", err)
 	}
@@ -2309,7 +2358,7 @@ func TestSearchAPIAccessControlFiltersPrivateProjects(t *testing.T) {
 		StoragePath: pubPath, UploadedBy: admin.ID,
 	}
 	app.handler.versions.Create(ctx, pubVersion)
-	app.handler.searchIndex.IndexVersion(pubProject.ID, pubVersion.ID, "public-search", "Public Search", "v1.0.0", pubPath)
+	app.handler.searchIndex.IndexVersion(context.Background(), pubProject.ID, pubVersion.ID, "public-search", "Public Search", "v1.0.0", pubPath)
 
 	// Set up private project docs
 	storage.EnsureVersionDir("private-search", "v1.0.0")
@@ -2322,7 +2371,7 @@ func TestSearchAPIAccessControlFiltersPrivateProjects(t *testing.T) {
 		StoragePath: privPath, UploadedBy: admin.ID,
 	}
 	app.handler.versions.Create(ctx, privVersion)
-	app.handler.searchIndex.IndexVersion(privProject.ID, privVersion.ID, "private-search", "Private Search", "v1.0.0", privPath)
+	app.handler.searchIndex.IndexVersion(context.Background(), privProject.ID, privVersion.ID, "private-search", "Private Search", "v1.0.0", privPath)
 
 	// Anonymous search should only see public results
 	resp, err := http.Get(app.server.URL + "/api/search?q=widgets&all_versions=1")
@@ -2445,7 +2494,7 @@ func TestSearchPageWithQuery(t *testing.T) {
 		StoragePath: versionPath, UploadedBy: admin.ID,
 	}
 	app.handler.versions.Create(ctx, version)
-	app.handler.searchIndex.IndexVersion(project.ID, version.ID, "page-search", "Page Search", "v1.0.0", versionPath)
+	app.handler.searchIndex.IndexVersion(context.Background(), project.ID, version.ID, "page-search", "Page Search", "v1.0.0", versionPath)
 
 	resp, err := http.Get(app.server.URL + "/search?q=foobar&all_versions=1")
 	if err != nil {
@@ -2485,7 +2534,7 @@ func TestSearchPageAccessControlAnonymousSeesPublicOnly(t *testing.T) {
 		StoragePath: pubPath, UploadedBy: admin.ID,
 	}
 	app.handler.versions.Create(ctx, pubVersion)
-	app.handler.searchIndex.IndexVersion(pubProject.ID, pubVersion.ID, "pub-page-search", "Public Page Search", "v1.0.0", pubPath)
+	app.handler.searchIndex.IndexVersion(context.Background(), pubProject.ID, pubVersion.ID, "pub-page-search", "Public Page Search", "v1.0.0", pubPath)
 
 	// Set up private project docs
 	storage.EnsureVersionDir("priv-page-search", "v1.0.0")
@@ -2497,7 +2546,7 @@ func TestSearchPageAccessControlAnonymousSeesPublicOnly(t *testing.T) {
 		StoragePath: privPath, UploadedBy: admin.ID,
 	}
 	app.handler.versions.Create(ctx, privVersion)
-	app.handler.searchIndex.IndexVersion(privProject.ID, privVersion.ID, "priv-page-search", "Private Page Search", "v1.0.0", privPath)
+	app.handler.searchIndex.IndexVersion(context.Background(), privProject.ID, privVersion.ID, "priv-page-search", "Private Page Search", "v1.0.0", privPath)
 
 	// Anonymous search via page
 	resp, err := http.Get(app.server.URL + "/search?q=bananas&all_versions=1")
@@ -2537,7 +2586,7 @@ func TestSearchPageAccessControlUserWithAccess(t *testing.T) {
 		StoragePath: privPath, UploadedBy: admin.ID,
 	}
 	app.handler.versions.Create(ctx, privVersion)
-	app.handler.searchIndex.IndexVersion(privProject.ID, privVersion.ID, "priv-page-access", "Private Page Access", "v1.0.0", privPath)
+	app.handler.searchIndex.IndexVersion(context.Background(), privProject.ID, privVersion.ID, "priv-page-access", "Private Page Access", "v1.0.0", privPath)
 
 	// Create user with access
 	hash, _ := auth.HashPassword("user123")
@@ -2594,7 +2643,7 @@ func TestSearchPageAccessControlUserWithoutAccess(t *testing.T) {
 		StoragePath: privPath, UploadedBy: admin.ID,
 	}
 	app.handler.versions.Create(ctx, privVersion)
-	app.handler.searchIndex.IndexVersion(privProject.ID, privVersion.ID, "priv-page-noaccess", "Private Page No Access", "v1.0.0", privPath)
+	app.handler.searchIndex.IndexVersion(context.Background(), privProject.ID, privVersion.ID, "priv-page-noaccess", "Private Page No Access", "v1.0.0", privPath)
 
 	// Create user WITHOUT access
 	hash, _ := auth.HashPassword("user123")
@@ -2646,7 +2695,7 @@ func TestSearchPageAccessControlAdminSeesAll(t *testing.T) {
 		StoragePath: privPath, UploadedBy: admin.ID,
 	}
 	app.handler.versions.Create(ctx, privVersion)
-	app.handler.searchIndex.IndexVersion(privProject.ID, privVersion.ID, "priv-page-admin", "Private Page Admin", "v1.0.0", privPath)
+	app.handler.searchIndex.IndexVersion(context.Background(), privProject.ID, privVersion.ID, "priv-page-admin", "Private Page Admin", "v1.0.0", privPath)
 
 	cookies := loginUser(t, app, "admin", "admin123")
 
@@ -2691,7 +2740,7 @@ func TestSearchAPIAccessControlUserWithoutAccess(t *testing.T) {
 		StoragePath: privPath, UploadedBy: admin.ID,
 	}
 	app.handler.versions.Create(ctx, privVersion)
-	app.handler.searchIndex.IndexVersion(privProject.ID, privVersion.ID, "private-search", "Private Search", "v1.0.0", privPath)
+	app.handler.searchIndex.IndexVersion(context.Background(), privProject.ID, privVersion.ID, "private-search", "Private Search", "v1.0.0", privPath)
 
 	// Create a user WITHOUT access to the private project
 	hash, _ := auth.HashPassword("user123")
@@ -2745,7 +2794,7 @@ func TestSearchAPIAccessControlUserWithAccess(t *testing.T) {
 		StoragePath: privPath, UploadedBy: admin.ID,
 	}
 	app.handler.versions.Create(ctx, privVersion)
-	app.handler.searchIndex.IndexVersion(privProject.ID, privVersion.ID, "private-access", "Private Access", "v1.0.0", privPath)
+	app.handler.searchIndex.IndexVersion(context.Background(), privProject.ID, privVersion.ID, "private-access", "Private Access", "v1.0.0", privPath)
 
 	// Create a user WITH access to the private project
 	hash, _ := auth.HashPassword("user123")
@@ -2806,7 +2855,7 @@ func TestSearchAPIAccessControlAdminSeesAll(t *testing.T) {
 		StoragePath: privPath, UploadedBy: admin.ID,
 	}
 	app.handler.versions.Create(ctx, privVersion)
-	app.handler.searchIndex.IndexVersion(privProject.ID, privVersion.ID, "admin-search-test", "Admin Search Test", "v1.0.0", privPath)
+	app.handler.searchIndex.IndexVersion(context.Background(), privProject.ID, privVersion.ID, "admin-search-test", "Admin Search Test", "v1.0.0", privPath)
 
 	cookies := loginUser(t, app, "admin", "admin123")
 
@@ -4067,3 +4116,160 @@ func TestAdminDeleteRobotRequiresAdmin(t *testing.T) {
 
 // Ensure the interface is satisfied
 var _ fs.FS = (fs.FS)(nil)
+
+func TestAPIUploadRequiresUploadScope(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+
+	project := seedProject(t, app, "scoped-proj", "Scoped Project", false)
+
+	robot := &database.User{
+		Username:   "reader-bot",
+		AuthSource: "robot",
+		Role:       "editor",
+		IsRobot:    true,
+	}
+	app.handler.users.Create(ctx, robot)
+	app.handler.access.Grant(ctx, &database.ProjectAccess{ProjectID: project.ID, UserID: robot.ID, Role: "editor"})
+
+	rawToken, _ := auth.GenerateToken(32)
+	app.handler.tokens.Create(ctx, &database.APIToken{
+		UserID:    robot.ID,
+		TokenHash: auth.HashToken(rawToken),
+		Name:      "read-only",
+		Scopes:    "read",
+	})
+
+	zipBuf := createTestZip(t, map[string]string{"index.html": "<html><body>Docs</body></html>"})
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("version", "1.0.0")
+	part, _ := writer.CreateFormFile("archive", "docs.zip")
+	io.Copy(part, zipBuf)
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", app.server.URL+"/api/project/scoped-proj/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+rawToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for token without upload scope, got %d", resp.StatusCode)
+	}
+
+	// The same token can read the project's versions
+	req, _ = http.NewRequest("GET", app.server.URL+"/api/project/scoped-proj/versions", nil)
+	req.Header.Set("Authorization", "Bearer "+rawToken)
+	resp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+
+	if resp2.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 for read scope, got %d", resp2.StatusCode)
+	}
+}
+
+func TestAPICreateProjectRequiresUploadScope(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+
+	robot := &database.User{
+		Username:   "ci-bot",
+		AuthSource: "robot",
+		Role:       "editor",
+		IsRobot:    true,
+	}
+	app.handler.users.Create(ctx, robot)
+
+	rawToken, _ := auth.GenerateToken(32)
+	app.handler.tokens.Create(ctx, &database.APIToken{
+		UserID:    robot.ID,
+		TokenHash: auth.HashToken(rawToken),
+		Name:      "read-only",
+		Scopes:    "read",
+	})
+
+	req, _ := http.NewRequest("POST", app.server.URL+"/api/projects", strings.NewReader(`{"slug":"new-proj"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+rawToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 without upload scope, got %d", resp.StatusCode)
+	}
+	if _, err := app.handler.projects.GetBySlug(ctx, "new-proj"); err == nil {
+		t.Error("expected project not to be created")
+	}
+}
+
+func TestAdminGenerateTokenWithScopes(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	seedAdmin(t, app)
+	cookies := loginUser(t, app, "admin", "admin123")
+
+	robot := &database.User{
+		Username:   "scope-bot",
+		AuthSource: "robot",
+		Role:       "editor",
+		IsRobot:    true,
+	}
+	app.handler.users.Create(ctx, robot)
+
+	form := url.Values{}
+	form.Set("name", "multi")
+	form.Add("scopes", "read")
+	form.Add("scopes", "delete")
+
+	req, _ := http.NewRequest("POST", app.server.URL+fmt.Sprintf("/admin/robots/%d/tokens", robot.ID), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	tokens, _ := app.handler.tokens.ListByUser(ctx, robot.ID)
+	if len(tokens) != 1 {
+		t.Fatalf("expected 1 token, got %d", len(tokens))
+	}
+	if tokens[0].Scopes != "delete,read" {
+		t.Errorf("expected scopes 'delete,read', got %q", tokens[0].Scopes)
+	}
+
+	// Unknown scopes are rejected
+	form.Set("scopes", "superuser")
+	req, _ = http.NewRequest("POST", app.server.URL+fmt.Sprintf("/admin/robots/%d/tokens", robot.ID), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+	if resp2.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown scope, got %d", resp2.StatusCode)
+	}
+}
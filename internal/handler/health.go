@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/config"
+)
+
+// startupRetryAfter is the Retry-After value, in seconds, of requests
+// answered while the server starts.
+const startupRetryAfter = "5"
+
+func isHealthPath(path string) bool {
+	return path == "/healthz" || path == "/readyz"
+}
+
+// handleHealthz reports that the server is up. In degraded mode it still
+// answers 200, so load balancers keep sending readers to the documentation
+// it can serve, but the status says "degraded". With verbose=1 it also
+// pings the database and reports the connection pool.
+func (h *Handler) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	status := "ok"
+	if h.dbDown.Load() {
+		status = "degraded"
+	}
+	if v := r.URL.Query().Get("verbose"); v == "" || v == "0" || v == "false" {
+		h.jsonResponse(w, map[string]string{"status": status})
+		return
+	}
+
+	resp := map[string]any{"status": status}
+	if h.dbPing != nil {
+		elapsed, err := h.pingDatabase(r.Context())
+		db := map[string]any{"reachable": err == nil}
+		if err == nil {
+			db["ping_ms"] = elapsed.Milliseconds()
+		}
+		resp["database"] = db
+	}
+	if h.dbStats != nil {
+		stats := h.dbStats()
+		resp["pool"] = map[string]any{
+			"max_open":         stats.MaxOpenConnections,
+			"open":             stats.OpenConnections,
+			"in_use":           stats.InUse,
+			"idle":             stats.Idle,
+			"wait_count":       stats.WaitCount,
+			"wait_duration_ms": stats.WaitDuration.Milliseconds(),
+		}
+	}
+	h.jsonResponse(w, resp)
+}
+
+// handleReadyz reports whether the server can take full traffic: unlike
+// /healthz it answers 503 while the server is shutting down or one of the
+// database, the storage and the search index fails its check, so
+// orchestrators stop routing requests to it. Until the server has started,
+// Startup answers instead.
+func (h *Handler) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if h.shuttingDown.Load() {
+		writeNotReady(w, map[string]any{"status": "shutting_down"}, shutdownRetryAfter)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), degradedPingTimeout)
+	defer cancel()
+	checks := map[string]string{}
+	ready := true
+	check := func(name string, err error) {
+		if err != nil {
+			h.logger.WarnContext(ctx, "readiness check failed", "check", name, "error", err)
+			checks[name] = "unavailable"
+			ready = false
+			return
+		}
+		checks[name] = "ok"
+	}
+	if h.dbPing != nil {
+		_, err := h.pingDatabase(ctx)
+		check("database", err)
+	}
+	check("storage", h.storage.CheckWritable())
+	if h.searchIndex != nil {
+		check("search", h.searchIndex.Check(ctx))
+	}
+
+	if !ready {
+		writeNotReady(w, map[string]any{"status": "unavailable", "checks": checks}, degradedRetryAfter)
+		return
+	}
+	h.jsonResponse(w, map[string]any{"status": "ok", "checks": checks})
+}
+
+func writeNotReady(w http.ResponseWriter, body any, retryAfter string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", retryAfter)
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Startup answers requests while the server starts, before its handler
+// exists: /healthz reports "starting" with 200, so that liveness probes do
+// not restart a server running long migrations, while /readyz and all
+// other requests get 503. Ready hands the requests to the handler.
+type Startup struct {
+	prefix string
+	next   atomic.Pointer[http.Handler]
+}
+
+// NewStartup returns a Startup for the routes of cfg.
+func NewStartup(cfg *config.Config) *Startup {
+	return &Startup{prefix: cfg.RoutePrefix()}
+}
+
+// Ready makes s pass all requests to next.
+func (s *Startup) Ready(next http.Handler) {
+	s.next.Store(&next)
+}
+
+func (s *Startup) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if next := s.next.Load(); next != nil {
+		(*next).ServeHTTP(w, r)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, s.prefix)
+	if path == "/healthz" || r.URL.Path == "/healthz" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "starting"})
+		return
+	}
+	writeNotReady(w, map[string]string{"status": "starting"}, startupRetryAfter)
+}
+
+// pingDatabase checks the database like MonitorDatabase does and returns
+// how long it took to answer.
+func (h *Handler) pingDatabase(ctx context.Context) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, degradedPingTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := h.dbPing(ctx); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/config"
+)
+
+func TestHealthzVerbose(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.dbPing = func(context.Context) error { return nil }
+	app.handler.dbStats = func() sql.DBStats { return sql.DBStats{MaxOpenConnections: 10, OpenConnections: 2, InUse: 1, Idle: 1} }
+
+	resp, err := http.Get(app.server.URL + "/healthz?verbose=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var health struct {
+		Status   string `json:"status"`
+		Database struct {
+			Reachable bool `json:"reachable"`
+		} `json:"database"`
+		Pool map[string]int64 `json:"pool"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != "ok" || !health.Database.Reachable {
+		t.Errorf("unexpected health: %+v", health)
+	}
+	if health.Pool["max_open"] != 10 || health.Pool["open"] != 2 || health.Pool["in_use"] != 1 {
+		t.Errorf("unexpected pool stats: %v", health.Pool)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	app := setupTestApp(t)
+	var pingErr error
+	app.handler.dbPing = func(context.Context) error { return pingErr }
+
+	get := func() (int, map[string]any) {
+		t.Helper()
+		resp, err := http.Get(app.server.URL + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body map[string]any
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	if status, body := get(); status != http.StatusOK || body["status"] != "ok" {
+		t.Errorf("expected ready, got %d %v", status, body)
+	}
+	pingErr = errors.New("connection refused")
+	status, body := get()
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while the database is unreachable, got %d", status)
+	}
+	if checks, _ := body["checks"].(map[string]any); checks["database"] != "unavailable" || checks["storage"] != "ok" {
+		t.Errorf("unexpected checks: %v", body)
+	}
+	pingErr = nil
+
+	os.RemoveAll(app.handler.storage.BasePath())
+	if status, _ := get(); status != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while the storage is not writable, got %d", status)
+	}
+	os.MkdirAll(app.handler.storage.BasePath(), 0755)
+
+	app.handler.BeginShutdown()
+	if status, body := get(); status != http.StatusServiceUnavailable || body["status"] != "shutting_down" {
+		t.Errorf("expected 503 while shutting down, got %d %v", status, body)
+	}
+}
+
+func TestStartup(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.Server.BasePath = "/docs"
+	startup := NewStartup(&cfg)
+	server := httptest.NewServer(startup)
+	defer server.Close()
+
+	status := func(path string) int {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for path, want := range map[string]int{"/healthz": 200, "/docs/healthz": 200, "/docs/readyz": 503, "/docs/": 503} {
+		if got := status(path); got != want {
+			t.Errorf("%s while starting: expected %d, got %d", path, want, got)
+		}
+	}
+	startup.Ready(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	if got := status("/docs/readyz"); got != http.StatusTeapot {
+		t.Errorf("expected the handler once ready, got %d", got)
+	}
+}
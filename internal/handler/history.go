@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// historyEntry is a page of a user's history, shown as "Continue reading".
+type historyEntry struct {
+	Project     string    `json:"project"`
+	ProjectName string    `json:"project_name"`
+	Version     string    `json:"version"`
+	Path        string    `json:"path"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	ViewedAt    time.Time `json:"viewed_at"`
+}
+
+// recordPageView adds a documentation page to the history of a logged-in
+// user in the background. Pages that do not exist are not recorded; a PDF
+// version is recorded as its viewer page.
+func (h *Handler) recordPageView(r *http.Request, user *database.User, project *database.Project, ver *database.Version, filePath string) {
+	if !h.config.History.Enabled || h.history == nil || user == nil || r.Method != http.MethodGet {
+		return
+	}
+	if ver.ContentType != "pdf" {
+		file := filepath.Join(h.storage.VersionPath(project.Slug, ver.Tag), filepath.FromSlash(filePath))
+		if info, err := os.Stat(file); err != nil {
+			return
+		} else if info.IsDir() {
+			if _, err := os.Stat(filepath.Join(file, "index.html")); err != nil {
+				return
+			}
+		}
+	}
+
+	// index.html redirects to its directory; keep the page once.
+	if path.Base(filePath) == "index.html" {
+		filePath = strings.TrimSuffix(filePath, "index.html")
+	}
+
+	view := &database.PageView{UserID: user.ID, ProjectID: project.ID, Version: ver.Tag, Path: filePath}
+	h.goJob(r.Context(), func(ctx context.Context) {
+		if err := h.history.Record(ctx, view, h.config.History.Pages()); err != nil {
+			h.logger.ErrorContext(ctx, "recording page view", "error", err)
+		}
+	})
+}
+
+// recentPages returns the history of a user, latest first, leaving out
+// pages of projects the user can no longer view.
+func (h *Handler) recentPages(ctx context.Context, user *database.User) []historyEntry {
+	entries := []historyEntry{}
+	if !h.config.History.Enabled || h.history == nil || user == nil {
+		return entries
+	}
+	views, err := h.history.ListByUser(ctx, user.ID, h.config.History.Pages())
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing page history", "error", err)
+		return entries
+	}
+
+	projects := make(map[int64]*database.Project)
+	for _, v := range views {
+		project, seen := projects[v.ProjectID]
+		if !seen {
+			project, err = h.projects.GetByID(ctx, v.ProjectID)
+			if err != nil || !h.canViewProject(ctx, user, project) {
+				project = nil
+			}
+			projects[v.ProjectID] = project
+		}
+		if project == nil {
+			continue
+		}
+		entries = append(entries, historyEntry{
+			Project:     project.Slug,
+			ProjectName: project.Name,
+			Version:     v.Version,
+			Path:        v.Path,
+			Title:       pageTitle(v.Path),
+			URL:         h.config.Server.BasePath + "/project/" + project.Slug + "/" + escapePath(v.Version) + "/" + escapePath(v.Path),
+			ViewedAt:    v.ViewedAt,
+		})
+	}
+	return entries
+}
+
+// pageTitle makes a readable title from the path of a page, such as
+// "Getting started" for guide/getting-started.html.
+func pageTitle(filePath string) string {
+	p := strings.TrimSuffix(filePath, "/")
+	if path.Base(p) == "index.html" {
+		p = path.Dir(p)
+	}
+	if p == "" || p == "." {
+		return "Home"
+	}
+	name := path.Base(p)
+	name = strings.TrimSuffix(name, path.Ext(name))
+	name = strings.NewReplacer("-", " ", "_", " ").Replace(name)
+	if name == "" {
+		return p
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// handleAPIHistory returns the pages the user viewed last.
+func (h *Handler) handleAPIHistory(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if !h.config.History.Enabled {
+		h.jsonError(w, "History is disabled", http.StatusNotFound)
+		return
+	}
+	if user == nil {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.jsonResponse(w, map[string]any{"pages": h.recentPages(r.Context(), user)})
+}
+
+// handleClearHistory forgets all pages the user viewed.
+func (h *Handler) handleClearHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	if h.history != nil {
+		if err := h.history.DeleteByUser(ctx, user.ID); err != nil {
+			h.logger.ErrorContext(ctx, "clearing page history", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	h.renderProfile(w, r, map[string]any{
+		"Success": "Your reading history was cleared",
+	})
+}
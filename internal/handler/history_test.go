@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReadingHistory(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.History.Enabled = true
+	app.handler.config.History.Size = 2
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+	cookies := loginUser(t, app, "admin", "admin123")
+
+	get := func(path string) *http.Response {
+		req, _ := http.NewRequest("GET", app.server.URL+path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	history := func() []historyEntry {
+		t.Helper()
+		if err := app.handler.WaitForJobs(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		resp := get("/api/history")
+		defer resp.Body.Close()
+		var body struct {
+			Pages []historyEntry `json:"pages"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Pages
+	}
+
+	for _, path := range []string{"/project/guide/1.0.0/index.html", "/project/guide/1.0.0/missing.html", "/project/guide/1.0.0/style.css", "/project/guide/1.0.0/guide/intro.html"} {
+		get(path).Body.Close()
+		if err := app.handler.WaitForJobs(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pages := history()
+	if len(pages) != 2 || pages[0].Path != "guide/intro.html" || pages[1].Path != "" {
+		t.Fatalf("expected the two HTML pages, latest first, got %+v", pages)
+	}
+	if pages[0].Title != "Intro" || pages[0].URL != "/project/guide/1.0.0/guide/intro.html" {
+		t.Errorf("unexpected entry %+v", pages[0])
+	}
+
+	// Viewing a page again moves it to the top; the size limit drops the oldest.
+	get("/project/guide/1.0.0/").Body.Close()
+	pages = history()
+	if len(pages) != 2 || pages[0].Path != "" || pages[1].Path != "guide/intro.html" {
+		t.Fatalf("expected the page to move to the top, got %+v", pages)
+	}
+	app.handler.config.History.Size = 1
+	get("/project/guide/1.0.0/guide/intro.html").Body.Close()
+	pages = history()
+	if len(pages) != 1 || pages[0].Path != "guide/intro.html" {
+		t.Fatalf("expected the size limit to apply, got %+v", pages)
+	}
+
+	resp := get("/")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "Continue reading") {
+		t.Error("expected the front page to offer the history")
+	}
+
+	// Anonymous readers are not recorded and get no list.
+	resp, _ = http.Get(app.server.URL + "/api/history")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for anonymous readers, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("POST", app.server.URL+"/profile/history/clear", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if pages := history(); len(pages) != 0 {
+		t.Errorf("expected the history to be cleared, got %+v", pages)
+	}
+
+	app.handler.config.History.Enabled = false
+	resp = get("/api/history")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 while the history is disabled, got %d", resp.StatusCode)
+	}
+}
+
+func TestPageTitle(t *testing.T) {
+	for path, want := range map[string]string{
+		"":                           "Home",
+		"index.html":                 "Home",
+		"guide/":                     "Guide",
+		"guide/index.html":           "Guide",
+		"guide/getting-started.html": "Getting started",
+		"api/v2_reference.htm":       "V2 reference",
+	} {
+		if got := pageTitle(path); got != want {
+			t.Errorf("pageTitle(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+	"github.com/qwc/asiakirjat/internal/hooks"
+)
+
+// checkUpload checks the redirects of an extracted upload and runs the
+// pre-upload hooks for it, and returns why the upload is refused, or "" if
+// it may be published. Hooks that fail rather than refuse refuse the upload
+// as well, so that uploads are not published unchecked.
+func (h *Handler) checkUpload(ctx context.Context, e hooks.Event) string {
+	if _, err := docs.ReadRedirects(e.Dir); err != nil {
+		return "Invalid redirects: " + err.Error()
+	}
+	e.Point = hooks.PreUpload
+	err := h.hooks.Run(ctx, e)
+	if err == nil {
+		return ""
+	}
+	if reason := hooks.Reason(err); reason != "" {
+		h.logger.InfoContext(ctx, "upload refused by hook", "project", e.Project, "version", e.Version, "reason", reason)
+		return "Upload refused: " + reason
+	}
+	h.logger.ErrorContext(ctx, "running pre-upload hooks", "error", err, "project", e.Project, "version", e.Version)
+	return "Upload check failed"
+}
+
+// checkServe runs the pre-serve hooks for a page of a version and reports
+// whether it may be served; if not, the response is written. user is nil
+// for anonymous readers.
+func (h *Handler) checkServe(w http.ResponseWriter, r *http.Request, user *database.User, e hooks.Event) bool {
+	e.Point = hooks.PreServe
+	if user != nil {
+		e.User = user.Username
+	}
+	err := h.hooks.Run(r.Context(), e)
+	if err == nil {
+		return true
+	}
+	if reason := hooks.Reason(err); reason != "" {
+		http.Error(w, reason, http.StatusForbidden)
+		return false
+	}
+	h.logger.ErrorContext(r.Context(), "running pre-serve hooks", "error", err, "project", e.Project, "version", e.Version)
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	return false
+}
+
+// runHooksAsync runs the hooks at e.Point in the background, logging their
+// errors; the action they run for has already happened.
+func (h *Handler) runHooksAsync(ctx context.Context, e hooks.Event) {
+	if !h.hooks.Has(e.Point) {
+		return
+	}
+	h.goJob(ctx, func(ctx context.Context) {
+		if err := h.hooks.Run(ctx, e); err != nil {
+			h.logger.ErrorContext(ctx, "running hooks", "error", err, "point", e.Point, "project", e.Project, "user", e.User)
+		}
+	})
+}
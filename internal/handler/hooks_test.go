@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/hooks"
+)
+
+func TestHooks(t *testing.T) {
+	app := setupTestApp(t)
+	seedAdmin(t, app)
+	token := uploadTokenForProject(t, app, "hooked")
+
+	published := make(chan hooks.Event, 1)
+	r := hooks.NewRegistry()
+	r.Register(hooks.PreUpload, hooks.HookFunc(func(ctx context.Context, e hooks.Event) error {
+		data, _ := os.ReadFile(filepath.Join(e.Dir, "index.html"))
+		if strings.Contains(string(data), "secret") {
+			return &hooks.Rejection{Reason: "index.html contains a secret"}
+		}
+		return nil
+	}))
+	r.Register(hooks.PostPublish, hooks.HookFunc(func(ctx context.Context, e hooks.Event) error {
+		published <- e
+		return nil
+	}))
+	r.Register(hooks.PreServe, hooks.HookFunc(func(ctx context.Context, e hooks.Event) error {
+		if e.Path == "internal.html" {
+			return &hooks.Rejection{Reason: "internal page"}
+		}
+		return nil
+	}), "hooked")
+	app.handler.hooks = r
+
+	resp := postArchive(t, app, "hooked", token, "1.0.0", createTestZip(t, map[string]string{"index.html": "the secret"}))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(string(body), "Upload refused: index.html contains a secret") {
+		t.Errorf("expected the hook to refuse the upload, got %d %s", resp.StatusCode, body)
+	}
+	project, _ := app.handler.projects.GetBySlug(context.Background(), "hooked")
+	if _, err := app.handler.versions.GetByProjectAndTag(context.Background(), project.ID, "1.0.0"); err == nil {
+		t.Error("expected no version to be created")
+	}
+
+	resp = postArchive(t, app, "hooked", token, "1.0.0", createTestZip(t, map[string]string{"index.html": "public", "internal.html": "internal"}))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected the upload to be accepted, got %d", resp.StatusCode)
+	}
+	select {
+	case e := <-published:
+		if e.Project != "hooked" || e.Version != "1.0.0" || e.User != "limits-bot" {
+			t.Errorf("unexpected post-publish event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected the post-publish hook to run")
+	}
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	for path, want := range map[string]int{"index.html": http.StatusOK, "internal.html": http.StatusForbidden} {
+		req, _ := http.NewRequest("GET", app.server.URL+"/project/hooked/1.0.0/"+path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s: expected %d, got %d", path, want, resp.StatusCode)
+		}
+	}
+}
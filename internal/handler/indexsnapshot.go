@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+)
+
+// exportSearchIndex streams a snapshot of the search index as a zip
+// archive. A snapshot taken during a reindex would miss versions, so it is
+// refused until the reindex finishes.
+func (h *Handler) exportSearchIndex(w http.ResponseWriter, r *http.Request, actor string, api bool) {
+	ctx := r.Context()
+	fail := func(msg string, status int) {
+		if api {
+			h.jsonError(w, msg, status)
+		} else {
+			http.Error(w, msg, status)
+		}
+	}
+	if !h.searchIndex.Embedded() {
+		fail("Search index is kept by an external search engine; use its backups", http.StatusNotImplemented)
+		return
+	}
+	if h.reindex.running() || h.searchIndex.Incomplete() {
+		fail("Search index is being rebuilt; export it when the reindex finishes", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="search-index-%s.zip"`, time.Now().UTC().Format("2006-01-02")))
+	if err := h.searchIndex.Export(w); err != nil {
+		h.logger.ErrorContext(ctx, "exporting search index", "error", err)
+		return
+	}
+	h.audit(ctx, "search_index.export", actor, "")
+}
+
+// handleAdminExportSearchIndex downloads a snapshot of the search index.
+func (h *Handler) handleAdminExportSearchIndex(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	h.exportSearchIndex(w, r, user.Username, false)
+}
+
+// handleAPIExportSearchIndex downloads a snapshot of the search index for
+// an admin's token with the admin:project scope.
+func (h *Handler) handleAPIExportSearchIndex(w http.ResponseWriter, r *http.Request) {
+	user := h.authenticateToken(w, r, 0, auth.ScopeAdminProject)
+	if user == nil {
+		return
+	}
+	if user.Role != "admin" {
+		h.jsonError(w, "Forbidden: admin role required", http.StatusForbidden)
+		return
+	}
+	h.exportSearchIndex(w, r, user.Username, true)
+}
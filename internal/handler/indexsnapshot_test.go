@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAPIExportSearchIndex(t *testing.T) {
+	app := setupTestApp(t)
+	token := adminAPIToken(t, app)
+
+	resp := apiRequest(t, app, "GET", "/api/search-index/export", token, "", nil)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.Contains(cd, "search-index-") {
+		t.Errorf("expected snapshot file name, got %q", cd)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("expected zip archive: %v", err)
+	}
+	if len(zr.File) == 0 {
+		t.Error("expected snapshot to contain the index files")
+	}
+
+	// Tokens of non-admins cannot export
+	editorToken := uploadTokenForProject(t, app, "snapshot")
+	resp = apiRequest(t, app, "GET", "/api/search-index/export", editorToken, "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for non-admin token, got %d", resp.StatusCode)
+	}
+
+	app.handler.reindex.start(reindexRebuild, "", false)
+	resp = apiRequest(t, app, "GET", "/api/search-index/export", token, "", nil)
+	resp.Body.Close()
+	app.handler.reindex.finish(nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 during reindex, got %d", resp.StatusCode)
+	}
+}
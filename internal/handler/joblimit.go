@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/qwc/asiakirjat/internal/scheduler"
+)
+
+// Keys of the expensive background jobs. Jobs with the same key never run
+// at the same time; the later one waits for the earlier to finish.
+const (
+	jobSearchIndex = "search_index" // reindexes and index verification
+	jobRetention   = "retention"    // retention runs and dry runs
+	jobStorage     = "storage"      // storage checks, blob pruning and usage
+)
+
+// jobLimiter runs expensive background jobs one per key, and at most a
+// number of them at once, so that overlapping runs do not compete for the
+// disk and the search index.
+type jobLimiter struct {
+	slots chan struct{}
+	mu    sync.Mutex
+	busy  map[string]chan struct{} // closed when the job of the key ends
+}
+
+func newJobLimiter(parallel int) *jobLimiter {
+	if parallel < 1 {
+		parallel = 1
+	}
+	return &jobLimiter{slots: make(chan struct{}, parallel), busy: make(map[string]chan struct{})}
+}
+
+// acquire waits until no other job of key runs and a slot is free. The
+// returned func ends the job.
+func (l *jobLimiter) acquire(ctx context.Context, key string) (func(), error) {
+	var done chan struct{}
+	for {
+		l.mu.Lock()
+		running, ok := l.busy[key]
+		if !ok {
+			done = make(chan struct{})
+			l.busy[key] = done
+			l.mu.Unlock()
+			break
+		}
+		l.mu.Unlock()
+		select {
+		case <-running:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	unlock := func() {
+		l.mu.Lock()
+		delete(l.busy, key)
+		l.mu.Unlock()
+		close(done)
+	}
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		unlock()
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-l.slots
+		unlock()
+	}, nil
+}
+
+// limitJob makes fn wait for the other jobs of key and a free slot, see
+// jobLimiter.
+func (h *Handler) limitJob(key string, fn scheduler.Func) scheduler.Func {
+	return func(ctx context.Context) error {
+		release, err := h.jobLimit.acquire(ctx, key)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return fn(ctx)
+	}
+}
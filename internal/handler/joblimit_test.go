@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobLimiterKey(t *testing.T) {
+	l := newJobLimiter(2)
+	ctx := context.Background()
+	release, err := l.acquire(ctx, jobRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		r, _ := l.acquire(ctx, jobRetention)
+		acquired <- r
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("expected the second job of the key to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Jobs of other keys run meanwhile
+	other, err := l.acquire(ctx, jobStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other()
+
+	release()
+	select {
+	case r := <-acquired:
+		r()
+	case <-time.After(time.Second):
+		t.Fatal("expected the second job to run once the first ended")
+	}
+}
+
+func TestJobLimiterSlots(t *testing.T) {
+	l := newJobLimiter(1)
+	release, err := l.acquire(context.Background(), jobRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, jobStorage); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the job to wait for a slot until cancelled, got %v", err)
+	}
+
+	// The cancelled job does not keep its key
+	l.mu.Lock()
+	_, busy := l.busy[jobStorage]
+	l.mu.Unlock()
+	if busy {
+		t.Error("expected the key of the cancelled job to be free")
+	}
+}
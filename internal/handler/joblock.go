@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/scheduler"
+)
+
+// jobLockTTL is how long a task keeps its lock without renewing it. A
+// running task renews it every third of that; a server that stops while
+// running one blocks the task on the others until the lock expires.
+const jobLockTTL = 10 * time.Minute
+
+// newInstanceID names this server as the holder of job locks.
+func newInstanceID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), rand.Text()[:8])
+}
+
+// runsOnEveryServer reports whether a task changes what each server keeps
+// of its own rather than what they share: the embedded search index.
+func (h *Handler) runsOnEveryServer(name string) bool {
+	return name == "index_verify" && h.searchIndex != nil && h.searchIndex.Embedded()
+}
+
+// lockJob makes fn run on one of the servers sharing the database for each
+// scheduled run, see store.JobLockStore. On the others it is skipped.
+func (h *Handler) lockJob(name string, fn scheduler.Func) scheduler.Func {
+	if h.jobLocks == nil || h.runsOnEveryServer(name) {
+		return fn
+	}
+	return func(ctx context.Context) error {
+		slot := scheduler.ScheduledAt(ctx)
+		if slot.IsZero() {
+			slot = time.Now()
+		}
+		ok, err := h.jobLocks.Acquire(ctx, name, h.instanceID, slot, time.Now().Add(jobLockTTL))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: another server runs it", scheduler.ErrSkipped)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(jobLockTTL / 3)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if err := h.jobLocks.Extend(ctx, name, h.instanceID, time.Now().Add(jobLockTTL)); err != nil {
+						h.logger.WarnContext(ctx, "extending job lock", "error", err, "task", name)
+					}
+				}
+			}
+		}()
+		defer func() {
+			close(done)
+			if err := h.jobLocks.Release(context.WithoutCancel(ctx), name, h.instanceID); err != nil {
+				h.logger.WarnContext(ctx, "releasing job lock", "error", err, "task", name)
+			}
+		}()
+		return fn(ctx)
+	}
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/scheduler"
+)
+
+func TestLockJob(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	runs := 0
+	fn := app.handler.lockJob("retention", func(context.Context) error {
+		runs++
+		return nil
+	})
+
+	// Another server runs the task
+	if ok, err := app.handler.jobLocks.Acquire(ctx, "retention", "other", time.Now(), time.Now().Add(time.Minute)); err != nil || !ok {
+		t.Fatalf("taking the lock: %v %v", ok, err)
+	}
+	if err := fn(ctx); !errors.Is(err, scheduler.ErrSkipped) || runs != 0 {
+		t.Fatalf("expected the task to be skipped, got %v after %d runs", err, runs)
+	}
+
+	app.handler.jobLocks.Release(ctx, "retention", "other")
+	if err := fn(ctx); err != nil || runs != 1 {
+		t.Fatalf("expected the task to run, got %v after %d runs", err, runs)
+	}
+	if err := fn(ctx); err != nil || runs != 2 {
+		t.Errorf("expected the lock to be released after the run, got %v after %d runs", err, runs)
+	}
+}
+
+func TestLockJobEmbeddedIndex(t *testing.T) {
+	app := setupTestApp(t)
+	if app.handler.searchIndex == nil || !app.handler.searchIndex.Embedded() {
+		t.Skip("test app has no embedded search index")
+	}
+	ctx := context.Background()
+	app.handler.jobLocks.Acquire(ctx, "index_verify", "other", time.Now(), time.Now().Add(time.Minute))
+
+	ran := false
+	fn := app.handler.lockJob("index_verify", func(context.Context) error {
+		ran = true
+		return nil
+	})
+	if err := fn(ctx); err != nil || !ran {
+		t.Errorf("expected every server to verify its own index, got %v", err)
+	}
+}
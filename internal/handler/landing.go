@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+const maxLandingPathLen = 255
+
+// validateLandingPath checks the landing path of a project: a clean path
+// inside the version, such as docs/html/index.html.
+func validateLandingPath(p string) error {
+	if p == "" {
+		return nil
+	}
+	if len(p) > maxLandingPathLen || strings.HasPrefix(p, "/") || strings.Contains(p, `\`) ||
+		path.Clean(p) != strings.TrimSuffix(p, "/") || p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return fmt.Errorf("invalid landing path %q: use a relative path inside the version of at most %d characters", p, maxLandingPathLen)
+	}
+	return nil
+}
+
+// detectLandingPage returns the landing page of an uploaded archive when
+// the project detects them and the archive has no index.html at its root.
+func (h *Handler) detectLandingPage(project *database.Project, contentType, versionPath string) string {
+	if !project.DetectLanding || contentType == "pdf" {
+		return ""
+	}
+	return docs.FindLandingPage(versionPath)
+}
+
+// landingPage returns the page the root of a version redirects to, or ""
+// when the root is served as is. The project's landing path is used if the
+// version has it, otherwise the page detected at upload.
+func (h *Handler) landingPage(project *database.Project, ver *database.Version) string {
+	if ver.ContentType == "pdf" {
+		return ""
+	}
+	if project.LandingPath != "" {
+		if _, err := os.Stat(filepath.Join(h.storage.VersionPath(project.Slug, ver.Tag), filepath.FromSlash(project.LandingPath))); err == nil {
+			return project.LandingPath
+		}
+	}
+	return ver.LandingPath
+}
+
+// redirectToLandingPage redirects the root of a version to its landing
+// page, if it has one, and reports whether it did.
+func (h *Handler) redirectToLandingPage(w http.ResponseWriter, r *http.Request, project *database.Project, ver *database.Version) bool {
+	landing := h.landingPage(project, ver)
+	if landing == "" {
+		return false
+	}
+	// index.html is served at its directory.
+	if path.Base(landing) == "index.html" {
+		landing = strings.TrimSuffix(landing, "index.html")
+	}
+	target := "/project/" + project.Slug + "/" + escapePath(ver.Tag) + "/" + escapePath(landing)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	h.redirect(w, r, target, http.StatusFound)
+	return true
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestLandingPage(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := uploadTokenForProject(t, app, "doxygen")
+	project, _ := app.handler.projects.GetBySlug(ctx, "doxygen")
+	project.Visibility = database.VisibilityPublic
+	project.DetectLanding = true
+	if err := app.handler.projects.Update(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := createTestZip(t, map[string]string{
+		"README.txt":           "Built with Doxygen",
+		"docs/html/index.html": "<html><body>API</body></html>",
+	})
+	resp := postArchive(t, app, "doxygen", token, "1.0.0", archive)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload failed with %d", resp.StatusCode)
+	}
+	version, err := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.LandingPath != "docs/html/index.html" {
+		t.Fatalf("expected the landing page to be detected, got %q", version.LandingPath)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	location := func(path string) string {
+		t.Helper()
+		resp, err := client.Get(app.server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound {
+			return ""
+		}
+		return resp.Header.Get("Location")
+	}
+
+	if loc := location("/project/doxygen/1.0.0/"); loc != "/project/doxygen/1.0.0/docs/html/" {
+		t.Errorf("expected a redirect to the detected landing page, got %q", loc)
+	}
+	if loc := location("/project/doxygen/1.0.0/README.txt"); loc != "" {
+		t.Errorf("expected other files to be served as is, got a redirect to %q", loc)
+	}
+
+	// The project's landing path wins where the version has it.
+	project.LandingPath = "README.txt"
+	app.handler.projects.Update(ctx, project)
+	if loc := location("/project/doxygen/1.0.0/"); loc != "/project/doxygen/1.0.0/README.txt" {
+		t.Errorf("expected a redirect to the project's landing page, got %q", loc)
+	}
+	project.LandingPath = "missing/index.html"
+	app.handler.projects.Update(ctx, project)
+	if loc := location("/project/doxygen/1.0.0/"); loc != "/project/doxygen/1.0.0/docs/html/" {
+		t.Errorf("expected a missing landing page to fall back, got %q", loc)
+	}
+
+	for _, p := range []string{"../secret", "/etc/passwd", "a/../../b", `a\b`} {
+		if validateLandingPath(p) == nil {
+			t.Errorf("expected %q to be rejected", p)
+		}
+	}
+	for _, p := range []string{"", "docs/html/index.html", "docs/html/"} {
+		if err := validateLandingPath(p); err != nil {
+			t.Errorf("expected %q to be accepted, got %v", p, err)
+		}
+	}
+}
+
+func TestIndexFallback(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := uploadTokenForProject(t, app, "bare")
+	project, _ := app.handler.projects.GetBySlug(ctx, "bare")
+	project.Visibility = database.VisibilityPublic
+	app.handler.projects.Update(ctx, project)
+
+	archive := createTestZip(t, map[string]string{
+		"README.html":      "<html><body>Readme</body></html>",
+		"api/module.html":  "<html><body>Module</body></html>",
+		"api/a file.txt":   "notes",
+		"api/.hidden.html": "hidden",
+	})
+	resp := postArchive(t, app, "bare", token, "1.0.0", archive)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload failed with %d", resp.StatusCode)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(app.server.URL + "/project/bare/1.0.0/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if loc := resp.Header.Get("Location"); resp.StatusCode != http.StatusFound || loc != "/project/bare/1.0.0/README.html" {
+		t.Errorf("expected a redirect to README.html, got %d %q", resp.StatusCode, loc)
+	}
+
+	resp, err = client.Get(app.server.URL + "/project/bare/1.0.0/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if loc := resp.Header.Get("Location"); resp.StatusCode != http.StatusMovedPermanently || loc != "/project/bare/1.0.0/api/" {
+		t.Errorf("expected a redirect to the directory with a slash, got %d %q", resp.StatusCode, loc)
+	}
+
+	body := getBody(t, app.server.URL+"/project/bare/1.0.0/api/")
+	if !strings.Contains(body, "Index of /api/") || !strings.Contains(body, `href="./module.html"`) || !strings.Contains(body, `href="./a%20file.txt"`) {
+		t.Errorf("expected a listing of the directory, got %s", body)
+	}
+	if strings.Contains(body, ".hidden.html") {
+		t.Error("expected hidden files to be left out of the listing")
+	}
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+const maxLifecycleMessageLen = 1024
+
+// lifecycleBanner is the notice shown on project pages and in the doc
+// overlay of deprecated and end-of-life documentation.
+type lifecycleBanner struct {
+	State   string
+	Message string
+}
+
+func isValidLifecycle(state string) bool {
+	return state == database.LifecycleActive || state == database.LifecycleDeprecated || state == database.LifecycleEOL
+}
+
+// lifecycleRank orders lifecycle states from active to end of life.
+func lifecycleRank(state string) int {
+	switch state {
+	case database.LifecycleDeprecated:
+		return 1
+	case database.LifecycleEOL:
+		return 2
+	}
+	return 0
+}
+
+// isRetired reports whether a lifecycle state is deprecated or end of life.
+func isRetired(state string) bool {
+	return lifecycleRank(state) > 0
+}
+
+// validateLifecycle checks a lifecycle state and banner message. An empty
+// state means active.
+func validateLifecycle(state, message string) (string, error) {
+	if state == "" {
+		state = database.LifecycleActive
+	}
+	if !isValidLifecycle(state) {
+		return "", fmt.Errorf("invalid lifecycle: must be active, deprecated, or eol")
+	}
+	if len(message) > maxLifecycleMessageLen {
+		return "", fmt.Errorf("lifecycle message is longer than %d characters", maxLifecycleMessageLen)
+	}
+	return state, nil
+}
+
+// sortByLifecycle moves deprecated and end-of-life projects behind active
+// ones, keeping the existing order within each state.
+func sortByLifecycle(projects []database.Project) {
+	slices.SortStableFunc(projects, func(a, b database.Project) int {
+		return cmp.Compare(lifecycleRank(a.Lifecycle), lifecycleRank(b.Lifecycle))
+	})
+}
+
+// lifecycleBanner returns the banner for a project or one of its versions
+// (version may be nil), or nil if both are active. The later state of the
+// two wins; a state without a message uses the configured default text.
+func (h *Handler) lifecycleBanner(project *database.Project, version *database.Version) *lifecycleBanner {
+	state, message := project.Lifecycle, project.LifecycleMessage
+	if version != nil && lifecycleRank(version.Lifecycle) >= lifecycleRank(state) && isRetired(version.Lifecycle) {
+		state, message = version.Lifecycle, version.LifecycleMessage
+	}
+	if !isRetired(state) {
+		return nil
+	}
+	if message == "" {
+		message = h.config.Projects.DeprecatedBanner
+		if state == database.LifecycleEOL {
+			message = h.config.Projects.EOLBanner
+		}
+	}
+	return &lifecycleBanner{State: state, Message: message}
+}
+
+// recordLifecycleChange audits a lifecycle change of a project (tag empty)
+// or version and emits a lifecycle.changed event for subscribers.
+func (h *Handler) recordLifecycleChange(ctx context.Context, project *database.Project, tag, from, to, message string, user *database.User) {
+	target := project.Slug
+	if tag != "" {
+		target += " version " + tag
+	}
+	h.audit(ctx, "lifecycle.change", eventActor(user), fmt.Sprintf("%s: %s -> %s", target, from, to))
+
+	data := map[string]any{
+		"lifecycle": to,
+		"previous":  from,
+		"message":   message,
+		"actor":     eventActor(user),
+	}
+	if tag != "" {
+		data["version"] = tag
+	}
+	h.emitEvent(ctx, database.EventLifecycleChanged, project.Slug, data)
+}
+
+// setVersionLifecycle stores a version's lifecycle and records the change.
+func (h *Handler) setVersionLifecycle(ctx context.Context, project *database.Project, version *database.Version, state, message string, user *database.User) error {
+	if version.Lifecycle == state && version.LifecycleMessage == message {
+		return nil
+	}
+	if err := h.versions.SetLifecycle(ctx, version.ID, state, message); err != nil {
+		return err
+	}
+	h.invalidateVersions(project.ID)
+	from := version.Lifecycle
+	version.Lifecycle, version.LifecycleMessage = state, message
+	if from != state {
+		h.recordLifecycleChange(ctx, project, version.Tag, from, state, message, user)
+	}
+	return nil
+}
+
+// handleVersionLifecycle sets the lifecycle of a version from the project page.
+func (h *Handler) handleVersionLifecycle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	slug := r.PathValue("slug")
+	tag := r.PathValue("tag")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canUpload(ctx, user, project) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag)
+	if err != nil {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	message := strings.TrimSpace(r.FormValue("lifecycle_message"))
+	state, err := validateLifecycle(r.FormValue("lifecycle"), message)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.setVersionLifecycle(ctx, project, version, state, message, user); err != nil {
+		h.logger.ErrorContext(ctx, "setting version lifecycle", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.redirect(w, r, "/project/"+slug, http.StatusSeeOther)
+}
+
+// handleAPIVersionLifecycle sets the lifecycle of a version from a JSON body
+// of the form {"lifecycle": "deprecated", "message": "Use 2.x"}.
+func (h *Handler) handleAPIVersionLifecycle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	slug := r.PathValue("slug")
+	tag := r.PathValue("tag")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	user := h.authenticateToken(w, r, project.ID, auth.ScopeUpload)
+	if user == nil {
+		return
+	}
+
+	if !h.canUpload(ctx, user, project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag)
+	if err != nil {
+		h.jsonError(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Lifecycle string `json:"lifecycle"`
+		Message   string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Lifecycle == "" {
+		h.jsonError(w, `Invalid JSON body: expected {"lifecycle": "active"|"deprecated"|"eol"}`, http.StatusBadRequest)
+		return
+	}
+	state, err := validateLifecycle(req.Lifecycle, req.Message)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.setVersionLifecycle(ctx, project, version, state, req.Message, user); err != nil {
+		h.logger.ErrorContext(ctx, "setting version lifecycle", "error", err)
+		h.jsonError(w, "Failed to update version", http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, map[string]any{
+		"tag":       tag,
+		"lifecycle": state,
+		"message":   req.Message,
+	})
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestAPIVersionLifecycle(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "lifecycle")
+	resp := postArchive(t, app, "lifecycle", token, "1.0.0", createTestZip(t, map[string]string{"index.html": "<html></html>"}))
+	resp.Body.Close()
+
+	resp = apiRequest(t, app, "PUT", "/api/project/lifecycle/version/1.0.0/lifecycle", token, `{"lifecycle": "retired"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown state, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "PUT", "/api/project/lifecycle/version/1.0.0/lifecycle", token, `{"lifecycle": "deprecated", "message": "Use 2.x"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "GET", "/api/project/lifecycle/versions", token, "", nil)
+	defer resp.Body.Close()
+	var versions []struct {
+		Tag              string `json:"tag"`
+		Lifecycle        string `json:"lifecycle"`
+		LifecycleMessage string `json:"lifecycle_message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&versions)
+	if len(versions) != 1 || versions[0].Lifecycle != database.LifecycleDeprecated || versions[0].LifecycleMessage != "Use 2.x" {
+		t.Errorf("unexpected versions %+v", versions)
+	}
+
+	entries, _ := app.handler.auditLog.List(context.Background(), 10)
+	if len(entries) != 1 || entries[0].Action != "lifecycle.change" || entries[0].Actor != "limits-bot" {
+		t.Errorf("expected one lifecycle audit entry, got %+v", entries)
+	}
+
+	page := fetchEvents(t, app, token, 0)
+	last := page.Events[len(page.Events)-1]
+	if last.Type != database.EventLifecycleChanged || !strings.Contains(string(last.Data), `"previous":"active"`) {
+		t.Errorf("expected lifecycle.changed event, got %s %s", last.Type, last.Data)
+	}
+}
+
+func TestSearchLeavesOutDeprecatedDocs(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	ctx := context.Background()
+
+	for _, slug := range []string{"current", "legacy"} {
+		project := seedProject(t, app, slug, slug, true)
+		app.handler.storage.EnsureVersionDir(slug, "v1")
+		versionPath := app.handler.storage.VersionPath(slug, "v1")
+		os.WriteFile(filepath.Join(versionPath, "index.html"),
+			[]byte("<html><head><title>Guide</title></head><body><p>Deployment guide</p></body></html>"), 0644)
+		version := &database.Version{ProjectID: project.ID, Tag: "v1", StoragePath: versionPath, UploadedBy: admin.ID}
+		app.handler.versions.Create(ctx, version)
+		if err := app.handler.searchIndex.IndexVersion(context.Background(), project.ID, version.ID, slug, slug, "v1", versionPath); err != nil {
+			t.Fatal(err)
+		}
+		if slug == "legacy" {
+			project.Lifecycle = database.LifecycleEOL
+			app.handler.projects.Update(ctx, project)
+		}
+	}
+
+	search := func(query string) []string {
+		resp, err := http.Get(app.server.URL + "/api/search?q=deployment" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var results struct {
+			Results []struct {
+				ProjectSlug string `json:"project_slug"`
+			} `json:"results"`
+		}
+		json.NewDecoder(resp.Body).Decode(&results)
+		var slugs []string
+		for _, r := range results.Results {
+			slugs = append(slugs, r.ProjectSlug)
+		}
+		return slugs
+	}
+
+	if got := search(""); len(got) != 1 || got[0] != "current" {
+		t.Errorf("expected only current by default, got %v", got)
+	}
+	if got := search("&include_deprecated=1"); len(got) != 2 {
+		t.Errorf("expected both projects with include_deprecated, got %v", got)
+	}
+	if got := search("&project=legacy"); len(got) != 1 {
+		t.Errorf("expected legacy when searching its project, got %v", got)
+	}
+}
+
+func TestDeprecatedProjectBannerAndOrder(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	ctx := context.Background()
+
+	old := seedProject(t, app, "aardvark", "Aardvark", true)
+	old.Lifecycle = database.LifecycleDeprecated
+	app.handler.projects.Update(ctx, old)
+	seedSEOVersion(t, app, old, admin, "1.0.0")
+	seedProject(t, app, "zebra", "Zebra", true)
+
+	body := getBody(t, app.server.URL+"/project/aardvark/1.0.0/guide/intro.html")
+	if !strings.Contains(body, app.handler.config.Projects.DeprecatedBanner) {
+		t.Error("expected the default deprecation banner in the overlay")
+	}
+
+	body = getBody(t, app.server.URL+"/")
+	if strings.Index(body, "Aardvark") < strings.Index(body, "Zebra") {
+		t.Error("expected the deprecated project after the active one")
+	}
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// maxLinkWarnings caps the broken links listed in an upload response.
+const maxLinkWarnings = 50
+
+// checkVersionLinks checks the internal links of an uploaded version and
+// stores the report next to the version's attachments, so deleting or
+// re-uploading the version drops it. It returns nil if the check failed.
+func (h *Handler) checkVersionLinks(ctx context.Context, slug, tag, storagePath string) *docs.LinkReport {
+	report, err := docs.CheckLinks(ctx, storagePath)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "checking links", "error", err, "project", slug, "version", tag)
+		return nil
+	}
+	if err := docs.WriteLinkReport(h.storage.AttachmentPath(slug, tag), report); err != nil {
+		h.logger.ErrorContext(ctx, "storing link report", "error", err, "project", slug, "version", tag)
+		return nil
+	}
+	if project, err := h.projects.GetBySlug(ctx, slug); err == nil {
+		h.invalidateVersions(project.ID)
+	}
+	h.logger.InfoContext(ctx, "link check complete", "project", slug, "version", tag, "pages", report.Pages, "broken", report.Total())
+	return report
+}
+
+// linkReport returns the link check report of a version, or nil if the
+// version was not checked.
+func (h *Handler) linkReport(ctx context.Context, slug, tag string) *docs.LinkReport {
+	report, err := docs.ReadLinkReport(h.storage.AttachmentPath(slug, tag))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			h.logger.ErrorContext(ctx, "reading link report", "error", err, "project", slug, "version", tag)
+		}
+		return nil
+	}
+	return report
+}
+
+// linkWarnings describes the broken links of a report for an upload
+// response.
+func linkWarnings(report *docs.LinkReport) []string {
+	warnings := []string{}
+	if report == nil {
+		return warnings
+	}
+	for i, link := range report.Broken {
+		if i == maxLinkWarnings {
+			warnings = append(warnings, fmt.Sprintf("%d more pages or targets with broken links", len(report.Broken)-i))
+			break
+		}
+		warnings = append(warnings, fmt.Sprintf("%s: broken link to %s", link.Page, link.Target))
+	}
+	return warnings
+}
+
+func (h *Handler) handleLinkReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	tag := r.PathValue("tag")
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canViewProject(ctx, user, project) {
+		if user == nil {
+			h.redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var report *docs.LinkReport
+	if _, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag); err == nil {
+		report = h.linkReport(ctx, project.Slug, tag)
+	}
+	if report == nil {
+		http.Error(w, "No link report for this version", http.StatusNotFound)
+		return
+	}
+
+	h.render(w, "version_links", map[string]any{
+		"User":    user,
+		"Project": project,
+		"Version": tag,
+		"Report":  report,
+	})
+}
+
+func (h *Handler) handleAPILinkReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var report *docs.LinkReport
+	if version, err := h.versions.GetByProjectAndTag(ctx, project.ID, r.PathValue("tag")); err == nil {
+		report = h.linkReport(ctx, project.Slug, version.Tag)
+	}
+	if report == nil {
+		h.jsonError(w, "No link report for this version", http.StatusNotFound)
+		return
+	}
+	h.jsonResponse(w, report)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestUploadLinkCheck(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := uploadTokenForProject(t, app, "linked")
+	project, _ := app.handler.projects.GetBySlug(ctx, "linked")
+	project.Visibility = database.VisibilityPublic
+	app.handler.projects.Update(ctx, project)
+
+	archive := createTestZip(t, map[string]string{
+		"index.html":       `<a href="guide/">Guide</a><a href="https://example.com/">Elsewhere</a>`,
+		"guide/index.html": `<a href="../index.html">Home</a><img src="img/diagram.png">`,
+	})
+	resp := postArchive(t, app, "linked", token, "1.0.0", archive)
+	var body struct {
+		Warnings []string `json:"warnings"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload failed with %d", resp.StatusCode)
+	}
+	if len(body.Warnings) != 1 || body.Warnings[0] != "guide/index.html: broken link to guide/img/diagram.png" {
+		t.Errorf("expected a warning for the missing image, got %v", body.Warnings)
+	}
+
+	detail := getBody(t, app.server.URL+"/project/linked")
+	if !strings.Contains(detail, "/project/linked/version/1.0.0/links") || !strings.Contains(detail, "1 broken links") {
+		t.Error("expected the project page to link the link report")
+	}
+	page := getBody(t, app.server.URL+"/project/linked/version/1.0.0/links")
+	if !strings.Contains(page, "guide/img/diagram.png") {
+		t.Error("expected the report page to list the missing target")
+	}
+
+	resp, err := http.Get(app.server.URL + "/api/project/linked/version/1.0.0/links")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the API report, got %d", resp.StatusCode)
+	}
+
+	// Without the check, no report is kept and the response has no warnings.
+	app.handler.config.Upload.CheckLinks = false
+	app.handler.storage.DeleteVersion("linked", "1.0.0")
+	resp = postArchive(t, app, "linked", token, "1.0.0", archive)
+	var plain map[string]any
+	json.NewDecoder(resp.Body).Decode(&plain)
+	resp.Body.Close()
+	if _, ok := plain["warnings"]; ok {
+		t.Errorf("expected no warnings without the link check, got %v", plain)
+	}
+}
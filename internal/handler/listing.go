@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// serveIndexFallback answers requests for a directory of a version that
+// has no index.html, and reports whether it did. It redirects to the first
+// of docs.IndexAlternates found in the directory, or lists the directory.
+func (h *Handler) serveIndexFallback(w http.ResponseWriter, r *http.Request, user *database.User, project *database.Project, ver *database.Version, storagePath, filePath string) bool {
+	if ver.ContentType == "pdf" {
+		return false
+	}
+	dir := filepath.Join(storagePath, filepath.FromSlash(path.Clean("/"+filePath)))
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() || docs.HasIndexPage(dir) {
+		return false
+	}
+
+	base := "/project/" + project.Slug + "/" + escapePath(ver.Tag) + "/" + escapePath(filePath)
+	query := ""
+	if r.URL.RawQuery != "" {
+		query = "?" + r.URL.RawQuery
+	}
+	// Relative links of the listing and the alternates need the slash
+	if filePath != "" && !strings.HasSuffix(filePath, "/") {
+		h.redirect(w, r, base+"/"+query, http.StatusMovedPermanently)
+		return true
+	}
+	if alt := docs.FindIndexAlternate(dir); alt != "" {
+		if path.Base(alt) == "index.html" {
+			alt = strings.TrimSuffix(alt, "index.html")
+		}
+		h.redirect(w, r, base+escapePath(alt)+query, http.StatusFound)
+		return true
+	}
+
+	entries, err := docs.ListDir(dir)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "listing version directory", "error", err, "project", project.Slug, "version", ver.Tag)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return true
+	}
+	h.render(w, "version_listing", map[string]any{
+		"User":    user,
+		"Project": project,
+		"Version": ver.Tag,
+		"Dir":     "/" + filePath,
+		"Parent":  filePath != "",
+		"Entries": entries,
+	})
+	return true
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+const (
+	loadTestPagesPerProject = 20
+	loadTestMaxPages        = 500
+	loadTestMaxQueries      = 20
+)
+
+// k6Script is a k6 (https://k6.io) load test scenario. Values are inserted
+// as JSON, which is valid JavaScript.
+var k6Script = template.Must(template.New("k6").Parse(`// k6 load test scenario generated by asiakirjat on {{.Generated}}.
+//
+//   k6 run asiakirjat-k6.js
+//
+// Environment variables:
+//   BASE_URL        server URL including the base path (default: {{.BaseURL}})
+//   TOKEN           API token with the read scope, sent with search requests
+//   UPLOAD_PROJECT  project to upload to; needs TOKEN with the upload scope
+//   UPLOAD_FILE     archive to upload as version "loadtest"
+import http from 'k6/http';
+import { check, sleep } from 'k6';
+
+const BASE_URL = __ENV.BASE_URL || {{.BaseURLJSON}};
+const TOKEN = __ENV.TOKEN || '';
+const UPLOAD_PROJECT = __ENV.UPLOAD_PROJECT || '';
+const uploadFile = __ENV.UPLOAD_FILE ? open(__ENV.UPLOAD_FILE, 'b') : null;
+
+const pages = {{.Pages}};
+const queries = {{.Queries}};
+
+const scenarios = {
+  docs: { executor: 'constant-vus', exec: 'docs', vus: {{.VUs}}, duration: {{.DurationJSON}} },
+  search: { executor: 'constant-vus', exec: 'search', vus: {{.SearchVUs}}, duration: {{.DurationJSON}} },
+};
+if (UPLOAD_PROJECT && uploadFile && TOKEN) {
+  scenarios.upload = { executor: 'constant-vus', exec: 'upload', vus: 1, duration: {{.DurationJSON}} };
+}
+
+export const options = {
+  scenarios: scenarios,
+  thresholds: {
+    'http_req_failed': ['rate<0.01'],
+    'http_req_duration{scenario:docs}': ['p(95)<500'],
+    'http_req_duration{scenario:search}': ['p(95)<1000'],
+  },
+};
+
+function headers() {
+  return TOKEN ? { Authorization: 'Bearer ' + TOKEN } : {};
+}
+
+function pick(list) {
+  return list[Math.floor(Math.random() * list.length)];
+}
+
+export function docs() {
+  if (pages.length === 0) {
+    return;
+  }
+  const res = http.get(BASE_URL + pick(pages), { tags: { name: 'doc page' } });
+  check(res, { 'page served': (r) => r.status === 200 });
+  sleep(1);
+}
+
+export function search() {
+  const q = encodeURIComponent(pick(queries));
+  const res = http.get(BASE_URL + '/api/search?q=' + q, { headers: headers(), tags: { name: 'search' } });
+  check(res, { 'search answered': (r) => r.status === 200 });
+  sleep(1);
+}
+
+export function upload() {
+  const res = http.post(BASE_URL + '/api/project/' + UPLOAD_PROJECT + '/upload', {
+    version: 'loadtest',
+    archive: http.file(uploadFile, __ENV.UPLOAD_FILE.split('/').pop()),
+  }, { headers: headers(), tags: { name: 'upload' } });
+  check(res, { 'upload accepted': (r) => r.status === 200 });
+  sleep(5);
+}
+`))
+
+// handleAdminLoadTestScript generates a k6 load test scenario from the
+// projects of this instance: pages of the latest version of every project
+// readable without login, search queries made from project names, and
+// optionally uploads.
+func (h *Handler) handleAdminLoadTestScript(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	vus := 10
+	if n, err := strconv.Atoi(r.URL.Query().Get("vus")); err == nil && n > 0 && n <= 10000 {
+		vus = n
+	}
+	duration := time.Minute
+	if d, err := time.ParseDuration(r.URL.Query().Get("duration")); err == nil && d > 0 {
+		duration = d
+	}
+
+	pages, queries, err := h.loadTestTargets(ctx)
+	if ctx.Err() != nil {
+		return // client went away
+	}
+	if err != nil {
+		h.logger.ErrorContext(ctx, "building load test scenario", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	baseURL := h.publicURL(r)
+	data := map[string]any{
+		"Generated":    time.Now().UTC().Format(time.RFC3339),
+		"BaseURL":      baseURL,
+		"BaseURLJSON":  mustJSON(baseURL),
+		"Pages":        mustJSON(pages),
+		"Queries":      mustJSON(queries),
+		"VUs":          vus,
+		"SearchVUs":    max(1, vus/5),
+		"DurationJSON": mustJSON(duration.String()),
+	}
+
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="asiakirjat-k6.js"`)
+	if err := k6Script.Execute(w, data); err != nil {
+		h.logger.ErrorContext(ctx, "writing load test scenario", "error", err)
+	}
+}
+
+// loadTestTargets returns the page paths, relative to the public URL, and
+// the search queries of a load test.
+func (h *Handler) loadTestTargets(ctx context.Context) ([]string, []string, error) {
+	projects, err := h.projects.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pages := []string{}
+	seen := make(map[string]bool)
+	queries := []string{}
+	for _, p := range projects {
+		for _, word := range strings.FieldsFunc(p.Name+" "+p.Description, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			word = strings.ToLower(word)
+			if len(word) >= 4 && !seen[word] && len(queries) < loadTestMaxQueries {
+				seen[word] = true
+				queries = append(queries, word)
+			}
+		}
+
+		if !h.canViewProject(ctx, nil, &p) || len(pages) >= loadTestMaxPages {
+			continue
+		}
+		versions, err := h.versions.ListByProject(ctx, p.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		tag := latestVersionTag(versions, p.PinnedVersion)
+		if tag == "" {
+			continue
+		}
+		prefix := "/project/" + p.Slug + "/" + escapePath(tag) + "/"
+		root := h.storage.VersionPath(p.Slug, tag)
+		count := 0
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || ctx.Err() != nil || count >= loadTestPagesPerProject || len(pages) >= loadTestMaxPages {
+				return filepath.SkipAll
+			}
+			if d.IsDir() || !strings.HasSuffix(d.Name(), ".html") {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, path)
+			pages = append(pages, prefix+escapePath(filepath.ToSlash(rel)))
+			count++
+			return nil
+		})
+	}
+	if len(queries) == 0 {
+		queries = append(queries, "documentation")
+	}
+	return pages, queries, nil
+}
+
+func mustJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLoadTestScript(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	public := seedProject(t, app, "guide", "Install Guide", true)
+	private := seedProject(t, app, "secret", "Secret Plans", false)
+	seedSEOVersion(t, app, public, admin, "1.0.0")
+	seedSEOVersion(t, app, private, admin, "1.0.0")
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	req, _ := http.NewRequest("GET", app.server.URL+"/admin/loadtest/k6.js?vus=25&duration=30s", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	script := string(body)
+
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/javascript") {
+		t.Fatalf("expected a script, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for _, want := range []string{
+		`"/project/guide/1.0.0/guide/intro.html"`,
+		`"/project/guide/1.0.0/index.html"`,
+		`"install"`,
+		`vus: 25, duration: "30s"`,
+		"import http from 'k6/http';",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected the script to contain %s", want)
+		}
+	}
+	if strings.Contains(script, "/project/secret/") {
+		t.Error("expected pages that need a login to be left out")
+	}
+
+	resp, err = http.Get(app.server.URL + "/admin/loadtest/k6.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Request.URL.Path != "/login" {
+		t.Errorf("expected anonymous users to be sent to the login page, got %s", resp.Request.URL.Path)
+	}
+}
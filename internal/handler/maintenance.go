@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/scheduler"
+)
+
+// maintenanceTask is a background task registered with the scheduler. An
+// empty spec leaves it to be run by hand.
+type maintenanceTask struct {
+	name        string
+	description string
+	spec        string
+	fn          scheduler.Func
+}
+
+// RegisterMaintenanceTasks registers the background maintenance tasks with
+// the scheduler using the cron expressions from the maintenance config.
+func (h *Handler) RegisterMaintenanceTasks() error {
+	if h.scheduler == nil {
+		return nil
+	}
+
+	cfg := h.config.Maintenance
+	tasks := []maintenanceTask{
+		{"retention", "Delete non-semver versions older than the retention policy", cfg.Retention, h.limitJob(jobRetention, h.runRetentionCleanup)},
+		{"retention_dry_run", "Report which versions the retention policy would delete", "", h.limitJob(jobRetention, h.runRetentionDryRun)},
+		{"session_cleanup", "Remove expired and idle login sessions and password reset links", cfg.SessionCleanup, h.runSessionCleanup},
+		{"index_verify", "Index versions missing from the search index", cfg.IndexVerify, h.limitJob(jobSearchIndex, h.runIndexVerification)},
+		{"owner_check", "Flag projects whose owner account no longer exists", cfg.OwnerCheck, h.runOwnerCheck},
+		{"analytics_prune", "Delete page hits older than the analytics retention", cfg.AnalyticsPrune, h.runAnalyticsPrune},
+		{"blob_prune", "Remove deduplicated files no version uses any more", cfg.BlobPrune, h.limitJob(jobStorage, h.runBlobPrune)},
+		{"preview_cleanup", "Delete expired previews", cfg.PreviewCleanup, h.runPreviewCleanup},
+		{"storage_usage", "Record the storage used by versions uploaded before sizes were kept", cfg.StorageUsage, h.limitJob(jobStorage, h.runStorageUsage)},
+		{"storage_check", "Report version directories without a version and versions whose files are missing", "", h.limitJob(jobStorage, h.runStorageCheck)},
+		{"storage_gc", "Delete version directories without a version and versions whose files are missing", cfg.StorageGC, h.limitJob(jobStorage, h.runStorageGC)},
+	}
+	if h.ldapAuth != nil {
+		tasks = append(tasks, maintenanceTask{"ldap_sync", "Sync the group access of all LDAP users with the directory", cfg.LDAPSync, h.runLDAPSync})
+	}
+	if h.mailer != nil {
+		tasks = append(tasks, maintenanceTask{"watch_digest", "Email the daily and weekly digests of watched projects", cfg.WatchDigest, h.runWatchDigests})
+	}
+
+	for _, t := range tasks {
+		if err := h.scheduler.Register(t.name, t.description, t.spec, h.lockJob(t.name, t.fn)); err != nil {
+			return err
+		}
+	}
+	// Retention also runs at startup, so versions that expired while the
+	// server was down are not served until the next scheduled run.
+	return h.scheduler.RunAtStart("retention")
+}
+
+// runSessionCleanup deletes expired and idle sessions and password resets
+// from the database.
+func (h *Handler) runSessionCleanup(ctx context.Context) error {
+	if err := h.sessions.DeleteExpired(ctx); err != nil {
+		return fmt.Errorf("deleting expired sessions: %w", err)
+	}
+	if idle := h.sessionMgr.IdleTimeout(); idle > 0 {
+		if err := h.sessions.DeleteIdle(ctx, time.Now().Add(-idle)); err != nil {
+			return fmt.Errorf("deleting idle sessions: %w", err)
+		}
+	}
+	if err := h.passwordResets.DeleteExpired(ctx); err != nil {
+		return fmt.Errorf("deleting expired password resets: %w", err)
+	}
+	return nil
+}
+
+// runLDAPSync re-reads the groups of all LDAP users, so that users removed
+// from a group lose its access even if they never log in again.
+func (h *Handler) runLDAPSync(ctx context.Context) error {
+	synced, err := h.ldapAuth.SyncUsers(ctx)
+	if synced > 0 {
+		h.logger.InfoContext(ctx, "synced LDAP group access", "users", synced)
+	}
+	return err
+}
+
+// handleAdminSyncLDAP starts the LDAP sync from the group mappings page.
+func (h *Handler) handleAdminSyncLDAP(w http.ResponseWriter, r *http.Request) {
+	if h.scheduler == nil || h.ldapAuth == nil {
+		http.Error(w, "LDAP is not enabled", http.StatusNotFound)
+		return
+	}
+	if err := h.scheduler.RunNow("ldap_sync"); errors.Is(err, scheduler.ErrTaskRunning) {
+		h.redirect(w, r, "/admin/groups?msg=ldap_sync_running", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	h.redirect(w, r, "/admin/groups?msg=ldap_sync_started", http.StatusSeeOther)
+}
+
+// runBlobPrune removes the blobs of deduplicated storage that no version
+// manifest refers to, which deleted and re-uploaded versions leave behind.
+func (h *Handler) runBlobPrune(ctx context.Context) error {
+	removed, size, err := h.storage.PruneBlobs(ctx)
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		h.logger.InfoContext(ctx, "pruned unused blobs", "blobs", removed, "bytes", size)
+	}
+	return nil
+}
+
+// runIndexVerification indexes every version that has no documents in the
+// search index, e.g. after an interrupted reindex or a failed async index.
+func (h *Handler) runIndexVerification(ctx context.Context) error {
+	if h.searchIndex == nil {
+		return nil
+	}
+
+	indexed, err := h.searchIndex.IndexedVersionIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	projects, err := h.projects.List(ctx)
+	if err != nil {
+		return fmt.Errorf("listing projects: %w", err)
+	}
+
+	repaired := 0
+	for _, p := range projects {
+		versions, err := h.versions.ListByProject(ctx, p.ID)
+		if err != nil {
+			return fmt.Errorf("listing versions: %w", err)
+		}
+		for _, v := range versions {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if indexed[v.ID] {
+				continue
+			}
+			if err := h.searchIndex.IndexVersionWithMetadata(ctx, p.ID, v.ID, p.Slug, p.Name, v.Tag, v.StoragePath, h.searchMetadata(ctx, p.ID, v.ID)); err != nil {
+				h.logger.ErrorContext(ctx, "index verify: indexing version", "error", err, "project", p.Slug, "version", v.Tag)
+				continue
+			}
+			repaired++
+		}
+	}
+
+	if repaired > 0 {
+		h.logger.InfoContext(ctx, "index verify: indexed missing versions", "count", repaired)
+	}
+	if !h.reindex.running() {
+		return h.searchIndex.MarkComplete()
+	}
+	return nil
+}
+
+func (h *Handler) handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+
+	var tasks []scheduler.Status
+	if h.scheduler != nil {
+		tasks = h.scheduler.Status()
+	}
+
+	var auditEntries []database.AuditEntry
+	if h.auditLog != nil {
+		entries, err := h.auditLog.List(r.Context(), auditListLimit)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "listing audit log", "error", err)
+		}
+		auditEntries = entries
+	}
+
+	var flash *Flash
+	switch r.URL.Query().Get("msg") {
+	case "task_started":
+		flash = &Flash{Type: "success", Message: "Task started."}
+	case "task_running":
+		flash = &Flash{Type: "warning", Message: "Task is already running."}
+	case "feature_saved":
+		flash = &Flash{Type: "success", Message: "Feature flag saved."}
+	case "feature_failed":
+		flash = &Flash{Type: "error", Message: "Failed to save the feature flag."}
+	}
+
+	h.render(w, "admin_maintenance", map[string]any{
+		"User":         user,
+		"Tasks":        tasks,
+		"AuditEntries": auditEntries,
+		"FeatureFlags": h.featureFlagViews(r.Context(), nil),
+		"Flash":        flash,
+	})
+}
+
+func (h *Handler) handleAdminRunMaintenanceTask(w http.ResponseWriter, r *http.Request) {
+	if h.scheduler == nil {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	err := h.scheduler.RunNow(r.PathValue("task"))
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownTask):
+		http.Error(w, "Task not found", http.StatusNotFound)
+	case errors.Is(err, scheduler.ErrTaskRunning):
+		h.redirect(w, r, "/admin/maintenance?msg=task_running", http.StatusSeeOther)
+	default:
+		h.redirect(w, r, "/admin/maintenance?msg=task_started", http.StatusSeeOther)
+	}
+}
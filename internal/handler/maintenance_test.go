@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/scheduler"
+	"github.com/qwc/asiakirjat/internal/testutil"
+)
+
+func setupMaintenance(t *testing.T, app *testApp) {
+	t.Helper()
+	app.handler.scheduler = scheduler.New(testutil.TestLogger())
+	if err := app.handler.RegisterMaintenanceTasks(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminMaintenancePageListsTasks(t *testing.T) {
+	app := setupTestApp(t)
+	setupMaintenance(t, app)
+	seedAdmin(t, app)
+	cookies := loginUser(t, app, "admin", "admin123")
+
+	req, _ := http.NewRequest("GET", app.server.URL+"/admin/maintenance", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	body := string(bodyBytes)
+	for _, name := range []string{"retention", "session_cleanup", "index_verify", "owner_check"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("expected task %s on maintenance page", name)
+		}
+	}
+}
+
+func TestAdminMaintenanceRequiresAdmin(t *testing.T) {
+	app := setupTestApp(t)
+	setupMaintenance(t, app)
+
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Post(app.server.URL+"/admin/maintenance/retention/run", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("expected redirect to login, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminRunMaintenanceTask(t *testing.T) {
+	app := setupTestApp(t)
+	setupMaintenance(t, app)
+	seedAdmin(t, app)
+	cookies := loginUser(t, app, "admin", "admin123")
+
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	req, _ := http.NewRequest("POST", app.server.URL+"/admin/maintenance/session_cleanup/run", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", resp.StatusCode)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, st := range app.handler.scheduler.Status() {
+			if st.Name == "session_cleanup" && !st.LastRun.IsZero() && !st.Running {
+				if st.LastError != "" {
+					t.Errorf("unexpected task error: %s", st.LastError)
+				}
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("expected session_cleanup to have run")
+
+	req, _ = http.NewRequest("POST", app.server.URL+"/admin/maintenance/unknown/run", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp2, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+	if resp2.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown task, got %d", resp2.StatusCode)
+	}
+}
+
+func TestIndexVerificationIndexesMissingVersions(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "verify-proj", "Verify Project", true)
+
+	versionDir := app.handler.storage.VersionPath("verify-proj", "1.0.0")
+	os.MkdirAll(versionDir, 0755)
+	os.WriteFile(filepath.Join(versionDir, "index.html"), []byte("<html><head><title>Verify</title></head><body>unindexedterm</body></html>"), 0644)
+
+	version := &database.Version{
+		ProjectID:   project.ID,
+		Tag:         "1.0.0",
+		StoragePath: versionDir,
+		ContentType: "archive",
+		UploadedBy:  admin.ID,
+	}
+	if err := app.handler.versions.Create(ctx, version); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.handler.runIndexVerification(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	indexed, err := app.handler.searchIndex.IndexedVersionIDs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !indexed[version.ID] {
+		t.Error("expected missing version to be indexed")
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// storeManifest keeps the manifest of an uploaded version and deduplicates
+// its files. Failures are logged: the version is served either way.
+func (h *Handler) storeManifest(ctx context.Context, slug, tag string, m docs.Manifest) {
+	if err := h.storage.WriteManifest(slug, tag, m); err != nil {
+		h.logger.ErrorContext(ctx, "storing manifest", "error", err, "project", slug, "version", tag)
+		return
+	}
+	saved, err := h.storage.DeduplicateVersion(slug, tag, m)
+	if err != nil {
+		h.logger.WarnContext(ctx, "deduplicating version files", "error", err, "project", slug, "version", tag)
+	}
+	if saved > 0 {
+		h.logger.InfoContext(ctx, "deduplicated version files", "project", slug, "version", tag, "saved_bytes", saved)
+	}
+}
+
+// versionManifest returns the manifest of a version. Versions stored
+// without one, such as those uploaded before manifests were kept, are
+// hashed and get one.
+func (h *Handler) versionManifest(ctx context.Context, slug, tag string) (docs.Manifest, error) {
+	m, err := h.storage.ReadManifest(slug, tag)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return m, err
+	}
+	if m, err = docs.BuildManifest(ctx, h.storage.VersionPath(slug, tag)); err != nil {
+		return nil, err
+	}
+	if err := h.storage.WriteManifest(slug, tag, m); err != nil {
+		h.logger.ErrorContext(ctx, "storing manifest", "error", err, "project", slug, "version", tag)
+	}
+	return m, nil
+}
+
+// handleAPIVersionManifest lists the files of a version with their sizes
+// and SHA-256 checksums, to verify a download or copy file by file.
+func (h *Handler) handleAPIVersionManifest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, r.PathValue("tag"))
+	if err != nil || !h.storage.VersionExists(slug, version.Tag) {
+		h.jsonError(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	m, err := h.versionManifest(ctx, slug, version.Tag)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.ErrorContext(ctx, "reading version manifest", "error", err, "project", slug, "version", version.Tag)
+		h.jsonError(w, "Failed to read version files", http.StatusInternalServerError)
+		return
+	}
+	if m == nil {
+		m = docs.Manifest{}
+	}
+	h.jsonResponse(w, map[string]any{
+		"tag":    version.Tag,
+		"sha256": m.Digest(),
+		"size":   m.Size(),
+		"files":  m,
+	})
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+	"github.com/qwc/asiakirjat/internal/templates"
+)
+
+// serveMarkdown renders a Markdown file of a version as a page with a
+// navigation of the version's Markdown files and the doc overlay, and
+// reports whether it did. The file itself is served with ?raw=1.
+func (h *Handler) serveMarkdown(w http.ResponseWriter, r *http.Request, project *database.Project, ver *database.Version, storagePath, filePath, headHTML string, overlayData templates.OverlayData) bool {
+	if ver.ContentType == "pdf" || !docs.IsMarkdown(filePath) || r.URL.Query().Has("raw") {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(storagePath, filepath.FromSlash(path.Clean("/"+filePath))))
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	ctx := r.Context()
+	baseURL := h.config.Server.BasePath + "/project/" + project.Slug + "/" + escapePath(ver.Tag) + "/"
+	page, err := docs.RenderMarkdownPage(storagePath, filePath, baseURL)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "rendering markdown", "error", err, "project", project.Slug, "version", ver.Tag, "path", filePath)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return true
+	}
+
+	overlayHTML := ""
+	if !matchOverlayPath(overlayPathPatterns(project.OverlayExclude), filePath) {
+		if overlayHTML, err = h.renderOverlay(ctx, project, storagePath, overlayData); err != nil {
+			h.logger.ErrorContext(ctx, "rendering overlay", "error", err)
+		}
+	}
+	docs.InjectOverlayWithOptions(w, r, docs.OverlayOptions{
+		HeadHTML:    headHTML,
+		OverlayHTML: overlayHTML,
+		MaxSize:     h.config.Overlay.MaxSizeBytes(),
+	}, func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rw.Write(page)
+	})
+	return true
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+func TestServeMarkdown(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := uploadTokenForProject(t, app, "notes")
+	project, _ := app.handler.projects.GetBySlug(ctx, "notes")
+	project.Visibility = database.VisibilityPublic
+	app.handler.projects.Update(ctx, project)
+
+	archive := createTestZip(t, map[string]string{
+		"README.md":       "# Notes\n\nSee the [guide](guide/setup.md).\n",
+		"guide/setup.md":  "# Setup\n\n```sh\nexport TOKEN=secret # keep it\n```\n",
+		"guide/other.txt": "plain",
+	})
+	resp := postArchive(t, app, "notes", token, "1.0.0", archive)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload failed with %d", resp.StatusCode)
+	}
+
+	// The root has no index.html and redirects to README.md
+	body := getBody(t, app.server.URL+"/project/notes/1.0.0/")
+	if !strings.Contains(body, "<title>Notes</title>") {
+		t.Errorf("expected README.md to be rendered at the root, got %s", body)
+	}
+
+	body = getBody(t, app.server.URL+"/project/notes/1.0.0/guide/setup.md")
+	for _, want := range []string{
+		`<h1 id="setup">Setup</h1>`,
+		`<span class="hl-k">export</span>`,
+		`<a href="/project/notes/1.0.0/README.md">README</a>`,
+		`<a href="/project/notes/1.0.0/guide/setup.md" aria-current="page">setup</a>`,
+		`id="asiakirjat-overlay"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in rendered page, got %s", want, body)
+		}
+	}
+
+	resp, err := http.Get(app.server.URL + "/project/notes/1.0.0/guide/setup.md?raw=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(string(raw), "# Setup") {
+		t.Errorf("expected the raw file with ?raw=1, got %s", raw)
+	}
+
+	// Markdown pages are searchable
+	app.handler.WaitForJobs(ctx)
+	results, err := app.handler.searchIndex.Search(ctx, docs.SearchQuery{Query: "secret", AllVersions: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Total == 0 {
+		t.Error("expected the Markdown page to be indexed")
+	}
+}
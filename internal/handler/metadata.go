@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+const (
+	maxMetadataEntries  = 50
+	maxMetadataValueLen = 512
+	metadataQueryPrefix = "meta."
+
+	maxReleaseNotesSize = 64 << 10 // 64 KB
+)
+
+var metadataKeyRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// validateMetadata checks label keys and values.
+func validateMetadata(meta map[string]string) error {
+	if len(meta) > maxMetadataEntries {
+		return fmt.Errorf("at most %d metadata entries are allowed", maxMetadataEntries)
+	}
+	for key, value := range meta {
+		if !metadataKeyRegex.MatchString(key) {
+			return fmt.Errorf("invalid metadata key %q: use 1-64 lowercase letters, digits, hyphens and underscores", key)
+		}
+		if len(value) > maxMetadataValueLen {
+			return fmt.Errorf("metadata value for %q is longer than %d characters", key, maxMetadataValueLen)
+		}
+	}
+	return nil
+}
+
+// parseMetadataText parses "key=value" lines as entered in the web UI or
+// sent as the metadata form field of an upload.
+func parseMetadataText(text string) (map[string]string, error) {
+	meta := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid metadata line %q: expected key=value", line)
+		}
+		meta[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return meta, validateMetadata(meta)
+}
+
+// formatMetadataText is the inverse of parseMetadataText, sorted by key.
+func formatMetadataText(meta map[string]string) string {
+	var b strings.Builder
+	for _, key := range slices.Sorted(maps.Keys(meta)) {
+		b.WriteString(key + "=" + meta[key] + "\n")
+	}
+	return b.String()
+}
+
+// metadataFilter collects meta.<key>=<value> query parameters.
+func metadataFilter(values url.Values) map[string]string {
+	filter := make(map[string]string)
+	for param, v := range values {
+		if key, ok := strings.CutPrefix(param, metadataQueryPrefix); ok && key != "" && len(v) > 0 {
+			filter[key] = v[0]
+		}
+	}
+	return filter
+}
+
+func matchesMetadata(meta, filter map[string]string) bool {
+	for key, value := range filter {
+		if got, ok := meta[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// uploadMetadata returns the version labels sent with an upload, or nil if
+// the metadata field is empty (a re-upload then keeps its labels).
+func uploadMetadata(r *http.Request) (map[string]string, error) {
+	text := r.FormValue("metadata")
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	return parseMetadataText(text)
+}
+
+// uploadReleaseNotes returns the Markdown release notes sent with an
+// upload, or "" if there are none (a re-upload then keeps its notes).
+func uploadReleaseNotes(r *http.Request) (string, error) {
+	notes := strings.TrimSpace(r.FormValue("release_notes"))
+	if len(notes) > maxReleaseNotesSize {
+		return "", fmt.Errorf("release notes are longer than %d KB", maxReleaseNotesSize>>10)
+	}
+	return notes, nil
+}
+
+// searchMetadata returns the labels indexed with a version's documents.
+func (h *Handler) searchMetadata(ctx context.Context, projectID, versionID int64) map[string]string {
+	if h.metadata == nil {
+		return nil
+	}
+	projectMeta, err := h.metadata.GetProject(ctx, projectID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading project metadata", "error", err)
+	}
+	versionMeta, err := h.metadata.GetVersion(ctx, versionID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading version metadata", "error", err)
+	}
+	return docs.MergeMetadata(projectMeta, versionMeta)
+}
+
+// reindexProjectMetadata re-indexes all versions of a project in the
+// background after its labels changed.
+func (h *Handler) reindexProjectMetadata(project *database.Project) {
+	if h.searchIndex == nil {
+		return
+	}
+	h.goJob(h.jobsCtx, func(ctx context.Context) {
+		versions, err := h.versions.ListByProject(ctx, project.ID)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "listing versions for reindex", "error", err, "project", project.Slug)
+			return
+		}
+		for _, v := range versions {
+			if ctx.Err() != nil {
+				return
+			}
+			meta := h.searchMetadata(ctx, project.ID, v.ID)
+			if err := h.searchIndex.IndexVersionWithMetadata(ctx, project.ID, v.ID, project.Slug, project.Name, v.Tag, v.StoragePath, meta); err != nil {
+				h.logger.ErrorContext(ctx, "indexing version", "error", err, "project", project.Slug, "version", v.Tag)
+			}
+		}
+	})
+}
+
+// decodeMetadata reads a JSON object of labels from the request body.
+func decodeMetadata(r *http.Request) (map[string]string, error) {
+	meta := make(map[string]string)
+	if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("invalid JSON body: expected an object of string values")
+	}
+	return meta, validateMetadata(meta)
+}
+
+func (h *Handler) handleAPIGetProjectMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	meta, err := h.metadata.GetProject(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading project metadata", "error", err)
+		h.jsonError(w, "Failed to load metadata", http.StatusInternalServerError)
+		return
+	}
+	h.writeResource(w, http.StatusOK, meta)
+}
+
+// handleAPIPutProjectMetadata replaces a project's labels.
+func (h *Handler) handleAPIPutProjectMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	user := h.authenticateToken(w, r, project.ID, auth.ScopeAdminProject)
+	if user == nil {
+		return
+	}
+	if !h.canUpload(ctx, user, project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	meta, err := decodeMetadata(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	current, err := h.metadata.GetProject(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading project metadata", "error", err)
+		h.jsonError(w, "Failed to load metadata", http.StatusInternalServerError)
+		return
+	}
+	if !h.checkPreconditions(w, r, resourceETag(current)) {
+		return
+	}
+
+	if !maps.Equal(current, meta) {
+		if err := h.metadata.SetProject(ctx, project.ID, meta); err != nil {
+			h.logger.ErrorContext(ctx, "setting project metadata", "error", err)
+			h.jsonError(w, "Failed to save metadata", http.StatusInternalServerError)
+			return
+		}
+		data := projectEventData(project, user)
+		data["metadata"] = meta
+		h.emitEvent(ctx, database.EventProjectUpdated, project.Slug, data)
+		h.reindexProjectMetadata(project)
+	}
+	h.writeResource(w, http.StatusOK, meta)
+}
+
+func (h *Handler) handleAPIGetVersionMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, r.PathValue("tag"))
+	if err != nil {
+		h.jsonError(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	meta, err := h.metadata.GetVersion(ctx, version.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading version metadata", "error", err)
+		h.jsonError(w, "Failed to load metadata", http.StatusInternalServerError)
+		return
+	}
+	h.writeResource(w, http.StatusOK, meta)
+}
+
+// handleAPIPutVersionMetadata replaces a version's labels.
+func (h *Handler) handleAPIPutVersionMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	user := h.authenticateToken(w, r, project.ID, auth.ScopeUpload)
+	if user == nil {
+		return
+	}
+	if !h.canUpload(ctx, user, project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, r.PathValue("tag"))
+	if err != nil {
+		h.jsonError(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	meta, err := decodeMetadata(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	current, err := h.metadata.GetVersion(ctx, version.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading version metadata", "error", err)
+		h.jsonError(w, "Failed to load metadata", http.StatusInternalServerError)
+		return
+	}
+	if !h.checkPreconditions(w, r, resourceETag(current)) {
+		return
+	}
+
+	if !maps.Equal(current, meta) {
+		if err := h.metadata.SetVersion(ctx, version.ID, meta); err != nil {
+			h.logger.ErrorContext(ctx, "setting version metadata", "error", err)
+			h.jsonError(w, "Failed to save metadata", http.StatusInternalServerError)
+			return
+		}
+		h.invalidateVersions(project.ID)
+		if h.searchIndex != nil {
+			indexMeta := h.searchMetadata(ctx, project.ID, version.ID)
+			h.goJob(ctx, func(ctx context.Context) {
+				if err := h.searchIndex.IndexVersionWithMetadata(ctx, project.ID, version.ID, project.Slug, project.Name, version.Tag, version.StoragePath, indexMeta); err != nil {
+					h.logger.ErrorContext(ctx, "indexing version", "error", err, "project", project.Slug, "version", version.Tag)
+				}
+			})
+		}
+	}
+	h.writeResource(w, http.StatusOK, meta)
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestProjectMetadataAPI(t *testing.T) {
+	app := setupTestApp(t)
+	token := adminAPIToken(t, app)
+	resp := apiRequest(t, app, "PUT", "/api/project/handbook", token, `{"visibility": "public"}`, nil)
+	resp.Body.Close()
+	seedProject(t, app, "other", "Other", true)
+
+	resp = apiRequest(t, app, "PUT", "/api/project/handbook/metadata", token, `{"team": "platform", "component-id": "CMP-42"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "PUT", "/api/project/handbook/metadata", token, `{"Team Name": "x"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid key, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "GET", "/api/projects?meta.team=platform", token, "", nil)
+	defer resp.Body.Close()
+	var projects []struct {
+		Slug     string            `json:"slug"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	json.NewDecoder(resp.Body).Decode(&projects)
+	if len(projects) != 1 || projects[0].Slug != "handbook" || projects[0].Metadata["component-id"] != "CMP-42" {
+		t.Errorf("expected only handbook with its labels, got %+v", projects)
+	}
+}
+
+func TestUploadSetsVersionMetadata(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "labelled")
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("version", "1.0.0")
+	writer.WriteField("metadata", "lifecycle=production\nteam=docs\n")
+	part, _ := writer.CreateFormFile("archive", "docs.zip")
+	part.Write(createTestZip(t, map[string]string{"index.html": "<html></html>"}).Bytes())
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", app.server.URL+"/api/project/labelled/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "GET", "/api/project/labelled/version/1.0.0/metadata", token, "", nil)
+	defer resp.Body.Close()
+	var meta map[string]string
+	json.NewDecoder(resp.Body).Decode(&meta)
+	if meta["lifecycle"] != "production" || meta["team"] != "docs" {
+		t.Errorf("unexpected version metadata %v", meta)
+	}
+}
+
+func TestUploadSetsReleaseNotes(t *testing.T) {
+	app := setupTestApp(t)
+	seedAdmin(t, app)
+	token := uploadTokenForProject(t, app, "noted")
+
+	upload := func(notes string) {
+		t.Helper()
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("version", "1.0.0")
+		writer.WriteField("release_notes", notes)
+		part, _ := writer.CreateFormFile("archive", "docs.zip")
+		part.Write(createTestZip(t, map[string]string{"index.html": "<html></html>"}).Bytes())
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", app.server.URL+"/api/project/noted/upload", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+	}
+	upload("## Changes\n\n- Added the **install** guide\n")
+	// A re-upload without notes keeps them
+	upload("")
+
+	resp := apiRequest(t, app, "GET", "/api/project/noted/versions", token, "", nil)
+	var versions []struct {
+		ReleaseNotes string `json:"release_notes"`
+	}
+	json.NewDecoder(resp.Body).Decode(&versions)
+	resp.Body.Close()
+	if len(versions) != 1 || versions[0].ReleaseNotes != "## Changes\n\n- Added the **install** guide" {
+		t.Errorf("unexpected release notes %+v", versions)
+	}
+
+	req, _ := http.NewRequest("GET", app.server.URL+"/project/noted", nil)
+	for _, c := range loginUser(t, app, "admin", "admin123") {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	page, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(page), "<strong>install</strong>") {
+		t.Error("expected the release notes to be rendered on the project page")
+	}
+}
+
+func TestSearchFiltersByMetadata(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	ctx := context.Background()
+
+	for _, team := range []string{"platform", "payments"} {
+		project := seedProject(t, app, team+"-docs", team, true)
+		app.handler.storage.EnsureVersionDir(project.Slug, "v1")
+		versionPath := app.handler.storage.VersionPath(project.Slug, "v1")
+		os.WriteFile(filepath.Join(versionPath, "index.html"),
+			[]byte("<html><head><title>Guide</title></head><body><p>Deployment guide</p></body></html>"), 0644)
+		version := &database.Version{ProjectID: project.ID, Tag: "v1", StoragePath: versionPath, UploadedBy: admin.ID}
+		app.handler.versions.Create(ctx, version)
+		meta := map[string]string{"team": team}
+		if err := app.handler.searchIndex.IndexVersionWithMetadata(context.Background(), project.ID, version.ID, project.Slug, project.Name, "v1", versionPath, meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := http.Get(app.server.URL + "/api/search?q=deployment&meta.team=payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var results struct {
+		Results []struct {
+			ProjectSlug string `json:"project_slug"`
+		} `json:"results"`
+	}
+	json.NewDecoder(resp.Body).Decode(&results)
+	if len(results.Results) != 1 || results.Results[0].ProjectSlug != "payments-docs" {
+		t.Errorf("expected only payments-docs, got %+v", results.Results)
+	}
+}
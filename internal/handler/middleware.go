@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/qwc/asiakirjat/internal/auth"
 	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/logging"
 )
 
 type sessionContext struct {
@@ -19,23 +23,111 @@ type Flash struct {
 	Message string
 }
 
-// withSession loads the user from the session cookie into the request context.
+// withSession loads the user from the session cookie into the request context,
+// renewing the session from a remember-me cookie. With proxy authentication,
+// a user named by a trusted proxy takes precedence.
 func (h *Handler) withSession(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user := h.sessionMgr.GetUserFromRequest(r)
+		user := h.sessionUser(w, r)
 		if user != nil {
 			r = r.WithContext(auth.ContextWithUser(r.Context(), user))
+		} else if !h.config.Access.AllowAnonymous && !h.isLoginPath(r) {
+			h.requireLogin(w, r)
+			return
 		}
 		next(w, r)
 	}
 }
 
-// requireAuth redirects to login if the user is not authenticated.
+// sessionUser returns the user named by a trusted proxy or the session
+// cookie, or nil.
+func (h *Handler) sessionUser(w http.ResponseWriter, r *http.Request) *database.User {
+	if user, ok := h.userFromProxy(r); ok {
+		return user
+	}
+	return h.sessionMgr.Authenticate(w, r)
+}
+
+// loginPaths stay reachable without a login when anonymous access is off,
+// including the pages that reset a forgotten password.
+var loginPaths = []string{"/login", "/logout", "/auth/callback", "/forgot-password", "/reset-password"}
+
+func (h *Handler) isLoginPath(r *http.Request) bool {
+	return slices.Contains(loginPaths, strings.TrimPrefix(r.URL.Path, h.config.RoutePrefix()))
+}
+
+// requireLogin turns away an anonymous request when anonymous access is
+// off: API requests get a 401, pages redirect to the login page.
+func (h *Handler) requireLogin(w http.ResponseWriter, r *http.Request) {
+	if h.isAPIRequest(r) {
+		h.jsonError(w, "Unauthorized: login required", http.StatusUnauthorized)
+		return
+	}
+	h.redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// userFromProxy returns the user named by a trusted reverse proxy. ok is
+// false if the request carries no proxy user, so the session applies. A
+// proxy user that is not allowed in yields a nil user.
+func (h *Handler) userFromProxy(r *http.Request) (user *database.User, ok bool) {
+	if h.proxyAuth == nil {
+		return nil, false
+	}
+	user, err := h.proxyAuth.AuthenticateRequest(r.Context(), r)
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "proxy authentication failed", "error", err)
+		return nil, true
+	}
+	if user != nil && user.Deactivated {
+		return nil, true
+	}
+	return user, user != nil
+}
+
+// withAPIAuth authenticates API requests. Requests carrying an Authorization
+// header must present a token granting scope (and matching the {slug} project
+// for project-scoped tokens). Requests with only an X-API-Key header are
+// served anonymously within the key's quota, so they see public projects
+// only. All other requests fall back to the session.
+func (h *Handler) withAPIAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" && r.Header.Get(apiKeyHeader) != "" {
+			if scope != auth.ScopeRead {
+				h.jsonError(w, "Forbidden: API keys are read-only", http.StatusForbidden)
+				return
+			}
+			if h.checkAPIKey(w, r) {
+				next(w, r)
+			}
+			return
+		}
+
+		if r.Header.Get("Authorization") == "" {
+			h.withSession(next)(w, r)
+			return
+		}
+
+		var projectID int64
+		if slug := r.PathValue("slug"); slug != "" {
+			if project, err := h.projects.GetBySlug(r.Context(), slug); err == nil {
+				projectID = project.ID
+			}
+		}
+
+		user := h.authenticateToken(w, r, projectID, scope)
+		if user == nil {
+			return
+		}
+		next(w, r.WithContext(auth.ContextWithUser(r.Context(), user)))
+	}
+}
+
+// requireAuth turns away anonymous requests, see requireLogin.
 func (h *Handler) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := auth.UserFromContext(r.Context())
 		if user == nil {
-			h.redirect(w, r, "/login", http.StatusSeeOther)
+			h.requireLogin(w, r)
 			return
 		}
 		next(w, r)
@@ -47,11 +139,11 @@ func (h *Handler) requireEditorOrAdmin(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := auth.UserFromContext(r.Context())
 		if user == nil {
-			h.redirect(w, r, "/login", http.StatusSeeOther)
+			h.requireLogin(w, r)
 			return
 		}
 		if user.Role != "admin" && user.Role != "editor" {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			h.forbid(w, r)
 			return
 		}
 		next(w, r)
@@ -63,24 +155,39 @@ func (h *Handler) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := auth.UserFromContext(r.Context())
 		if user == nil {
-			h.redirect(w, r, "/login", http.StatusSeeOther)
+			h.requireLogin(w, r)
 			return
 		}
 		if user.Role != "admin" {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			h.forbid(w, r)
 			return
 		}
 		next(w, r)
 	}
 }
 
-// LoggingMiddleware logs each HTTP request.
+// LoggingMiddleware assigns each request an ID and logs the request. A valid
+// X-Request-ID sent by the client or a proxy is kept, otherwise a new one is
+// generated. The ID is returned in X-Request-ID, carried in the request
+// context for the log lines written while handling the request, and
+// appended to plain-text server error pages.
 func LoggingMiddleware(logger *slog.Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		id := r.Header.Get(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		ctx := logging.WithRequestID(r.Context(), id)
+		r = r.WithContext(ctx)
+		w.Header().Set(logging.RequestIDHeader, id)
+
 		sw := &statusWriter{ResponseWriter: w, status: 200}
 		next.ServeHTTP(sw, r)
-		logger.Info("http request",
+		if sw.status >= 500 && isPlainError(w.Header()) {
+			fmt.Fprintf(w, "Request ID: %s\n", id)
+		}
+		logger.InfoContext(ctx, "http request",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", sw.status,
@@ -94,7 +201,7 @@ func RecoveryMiddleware(logger *slog.Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				logger.Error("panic recovered", "error", err, "path", r.URL.Path)
+				logger.ErrorContext(r.Context(), "panic recovered", "error", err, "path", r.URL.Path)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			}
 		}()
@@ -102,6 +209,13 @@ func RecoveryMiddleware(logger *slog.Logger, next http.Handler) http.Handler {
 	})
 }
 
+// isPlainError reports whether a response was written by http.Error.
+func isPlainError(header http.Header) bool {
+	return header.Get("Content-Type") == "text/plain; charset=utf-8" &&
+		header.Get("X-Content-Type-Options") == "nosniff" &&
+		header.Get("Content-Encoding") == ""
+}
+
 type statusWriter struct {
 	http.ResponseWriter
 	status int
@@ -111,3 +225,7 @@ func (w *statusWriter) WriteHeader(code int) {
 	w.status = code
 	w.ResponseWriter.WriteHeader(code)
 }
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+)
+
+// offlineManifest lists the URLs a browser stores to read a version
+// offline. Revision changes when the version is re-uploaded, so saved
+// copies know they are outdated.
+type offlineManifest struct {
+	Project  string   `json:"project"`
+	Version  string   `json:"version"`
+	Revision string   `json:"revision"`
+	Size     int64    `json:"size"`
+	Files    []string `json:"files"`
+}
+
+// errOfflineTooLarge stops listing a version larger than offline.max_size.
+var errOfflineTooLarge = errors.New("version too large for offline use")
+
+// handleOfflineServiceWorker serves the service worker that answers
+// requests for saved versions from the browser cache while offline. It is
+// served from the root so its scope can cover all projects.
+func (h *Handler) handleOfflineServiceWorker(w http.ResponseWriter, r *http.Request) {
+	if !h.config.Offline.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+	script, err := fs.ReadFile(h.staticFS, "js/offline-sw.js")
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "reading service worker", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/javascript")
+	// Browsers check for a new worker on every navigation
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(script)
+}
+
+// handleOfflineManifest returns the files of a version for saving it in
+// the browser.
+func (h *Handler) handleOfflineManifest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	slug := r.PathValue("slug")
+	tag := r.PathValue("tag")
+
+	if !h.config.Offline.Enabled {
+		h.jsonError(w, "Offline copies are disabled", http.StatusNotFound)
+		return
+	}
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil || !h.canViewProject(ctx, user, project) {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	ver, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag)
+	if err != nil || !h.storage.VersionExists(slug, tag) {
+		h.jsonError(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	prefix := h.config.Server.BasePath + "/project/" + url.PathEscape(slug) + "/" + url.PathEscape(tag) + "/"
+	manifest := offlineManifest{
+		Project:  slug,
+		Version:  tag,
+		Revision: fmt.Sprintf("%d-%d", ver.ID, ver.CreatedAt.Unix()),
+		Files:    []string{prefix},
+	}
+
+	maxSize := h.config.Offline.MaxSizeBytes()
+	root := h.storage.VersionPath(slug, tag)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		manifest.Size += info.Size()
+		if manifest.Size > maxSize {
+			return errOfflineTooLarge
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		var parts []string
+		for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+			parts = append(parts, url.PathEscape(part))
+		}
+		// index.html redirects to its directory, so the directory is saved
+		if parts[len(parts)-1] == "index.html" {
+			parts[len(parts)-1] = ""
+			if len(parts) == 1 {
+				return nil
+			}
+		}
+		manifest.Files = append(manifest.Files, prefix+strings.Join(parts, "/"))
+		return nil
+	})
+	if errors.Is(err, errOfflineTooLarge) {
+		h.jsonError(w, fmt.Sprintf("Version is larger than %s and cannot be saved offline", h.config.Offline.MaxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if ctx.Err() != nil {
+		return // client went away
+	}
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing version files", "error", err)
+		h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	h.jsonResponse(w, manifest)
+}
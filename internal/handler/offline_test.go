@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOfflineManifest(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+
+	project := seedProject(t, app, "field", "Field Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+	os.MkdirAll(filepath.Join(app.handler.storage.VersionPath("field", "1.0.0"), "faq"), 0755)
+	os.WriteFile(filepath.Join(app.handler.storage.VersionPath("field", "1.0.0"), "faq", "index.html"), []byte("<html></html>"), 0644)
+
+	resp, err := http.Get(app.server.URL + "/project/field/version/1.0.0/offline.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 while offline copies are disabled, got %d", resp.StatusCode)
+	}
+	if body := getBody(t, app.server.URL+"/project/field/1.0.0/"); strings.Contains(body, `id="asiakirjat-offline"`) {
+		t.Error("expected no offline button while offline copies are disabled")
+	}
+
+	app.handler.config.Offline.Enabled = true
+
+	var manifest offlineManifest
+	if err := json.Unmarshal([]byte(getBody(t, app.server.URL+"/project/field/version/1.0.0/offline.json")), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/project/field/1.0.0/", "/project/field/1.0.0/faq/", "/project/field/1.0.0/guide/intro.html", "/project/field/1.0.0/style.css"}
+	if strings.Join(manifest.Files, " ") != strings.Join(want, " ") {
+		t.Errorf("expected files %v, got %v", want, manifest.Files)
+	}
+	if manifest.Revision == "" || manifest.Size == 0 {
+		t.Errorf("expected a revision and a size, got %+v", manifest)
+	}
+
+	if body := getBody(t, app.server.URL+"/project/field/1.0.0/"); !strings.Contains(body, `id="asiakirjat-offline"`) {
+		t.Error("expected the offline button in the overlay")
+	}
+
+	resp, err = http.Get(app.server.URL + "/offline-sw.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Cache-Control") != "no-cache" {
+		t.Errorf("expected the service worker without caching, got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	app.handler.config.Offline.MaxSize = "10"
+	resp, err = http.Get(app.server.URL + "/project/field/version/1.0.0/offline.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a version over max_size, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// maxPreviewDescription is the length, in characters, descriptions are cut
+// to in link previews.
+const maxPreviewDescription = 200
+
+// socialPreview describes the link preview of a page.
+type socialPreview struct {
+	SiteName    string
+	Title       string // empty to leave it to the page's <title>
+	Description string // Markdown
+	URL         string
+	Tag         string // version whose thumbnail is the image, if any
+}
+
+// socialMeta returns the OpenGraph and Twitter card tags of a page of a
+// project, or "" if link previews are off or anonymous readers cannot view
+// the project. Chat clients fetch previews without a login, so other
+// projects would only show a login page anyway, and their names and
+// descriptions stay out of the HTML.
+func (h *Handler) socialMeta(r *http.Request, project *database.Project, p socialPreview) string {
+	if !h.config.SEO.SocialPreviews || !h.config.Access.AllowAnonymous || !h.canViewProject(r.Context(), nil, project) {
+		return ""
+	}
+
+	var b strings.Builder
+	meta := func(attr, key, value string) {
+		if value != "" {
+			b.WriteString(`<meta ` + attr + `="` + key + `" content="` + html.EscapeString(value) + `">`)
+		}
+	}
+	meta("property", "og:type", "website")
+	meta("property", "og:site_name", p.SiteName)
+	meta("property", "og:title", p.Title)
+	meta("property", "og:description", previewText(docs.MarkdownText(p.Description)))
+	meta("property", "og:url", p.URL)
+
+	card := "summary"
+	if p.Tag != "" && h.hasThumbnail(project.Slug, p.Tag) {
+		meta("property", "og:image", h.publicURL(r)+"/project/"+project.Slug+"/version/"+escapePath(p.Tag)+"/thumbnail.png")
+		card = "summary_large_image"
+	} else if logo := h.absoluteURL(r, h.config.Branding.LogoURL); logo != "" {
+		meta("property", "og:image", logo)
+	}
+	meta("name", "twitter:card", card)
+	return b.String()
+}
+
+// siteName returns the application name shown in the navbar.
+func (h *Handler) siteName() string {
+	if h.config.Branding.AppName != "" {
+		return h.config.Branding.AppName
+	}
+	return "asiakirjat"
+}
+
+// absoluteURL resolves a link of a page, such as the logo URL, against the
+// external URL of the server.
+func (h *Handler) absoluteURL(r *http.Request, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	base, err := url.Parse(h.publicURL(r) + "/")
+	if err != nil {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// previewText cuts text to maxPreviewDescription characters at a word
+// boundary.
+func previewText(text string) string {
+	if utf8.RuneCountInString(text) <= maxPreviewDescription {
+		return text
+	}
+	cut := string([]rune(text)[:maxPreviewDescription])
+	if i := strings.LastIndexByte(cut, ' '); i > maxPreviewDescription/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/xml"
+	"html"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+)
+
+// openSearchShortNameMax is the longest ShortName the OpenSearch
+// specification allows.
+const openSearchShortNameMax = 16
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Method   string `xml:"method,attr,omitempty"`
+	Rel      string `xml:"rel,attr,omitempty"`
+	Template string `xml:"template,attr"`
+}
+
+type openSearchDescription struct {
+	XMLName       xml.Name        `xml:"OpenSearchDescription"`
+	XMLNS         string          `xml:"xmlns,attr"`
+	ShortName     string          `xml:"ShortName"`
+	Description   string          `xml:"Description"`
+	InputEncoding string          `xml:"InputEncoding"`
+	Image         string          `xml:"Image,omitempty"`
+	URLs          []openSearchURL `xml:"Url"`
+}
+
+// handleOpenSearch serves the OpenSearch description that lets browsers
+// add the site search as a search engine.
+func (h *Handler) handleOpenSearch(w http.ResponseWriter, r *http.Request) {
+	name := h.siteName()
+	h.writeOpenSearch(w, r, name, "Search the documentation on "+name, "?q={searchTerms}", "/opensearch.xml")
+}
+
+// handleProjectOpenSearch serves the OpenSearch description of the search
+// within one project. Projects the user cannot view are not found, so
+// the description does not reveal them.
+func (h *Handler) handleProjectOpenSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil || !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		http.NotFound(w, r)
+		return
+	}
+	h.writeOpenSearch(w, r, project.Name, "Search the "+project.Name+" documentation",
+		"?q={searchTerms}&project="+url.QueryEscape(project.Slug), "/project/"+project.Slug+"/opensearch.xml")
+}
+
+// writeOpenSearch writes an OpenSearch description. query is the query
+// string of the search page and of the suggestions as typed.
+func (h *Handler) writeOpenSearch(w http.ResponseWriter, r *http.Request, name, description, query, self string) {
+	base := h.publicURL(r)
+	if utf8.RuneCountInString(name) > openSearchShortNameMax {
+		name = string([]rune(name)[:openSearchShortNameMax])
+	}
+	desc := openSearchDescription{
+		XMLNS:         "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:     name,
+		Description:   description,
+		InputEncoding: "UTF-8",
+		Image:         h.absoluteURL(r, h.config.Branding.LogoURL),
+		URLs: []openSearchURL{
+			{Type: "text/html", Method: "get", Template: base + "/search" + query},
+			{Type: "application/x-suggestions+json", Method: "get", Template: base + "/api/search/suggest" + query + "&format=opensearch"},
+			{Type: "application/opensearchdescription+xml", Rel: "self", Template: base + self},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(desc); err != nil {
+		h.logger.ErrorContext(r.Context(), "writing OpenSearch description", "error", err)
+	}
+}
+
+// projectSearchLink returns the <link rel="search"> of a project's
+// OpenSearch description, for the head of its pages.
+func (h *Handler) projectSearchLink(slug, name string) string {
+	href := h.config.Server.BasePath + "/project/" + slug + "/opensearch.xml"
+	return `<link rel="search" type="application/opensearchdescription+xml" title="` + html.EscapeString(name) + `" href="` + html.EscapeString(href) + `">`
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+	"github.com/qwc/asiakirjat/internal/templates"
+)
+
+// maxOverlayPathsLen limits the include and exclude lists of a project.
+const maxOverlayPathsLen = 4096
+
+// overlayPathPatterns splits a list of path patterns, one per line.
+// Blank lines and lines starting with # are skipped.
+func overlayPathPatterns(text string) []string {
+	patterns := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, strings.TrimPrefix(line, "/"))
+	}
+	return patterns
+}
+
+// validateOverlayPaths checks an include or exclude list of a project.
+func validateOverlayPaths(text string) error {
+	if len(text) > maxOverlayPathsLen {
+		return fmt.Errorf("overlay path list too long: at most %d bytes", maxOverlayPathsLen)
+	}
+	for _, p := range overlayPathPatterns(text) {
+		if _, err := path.Match(strings.TrimSuffix(p, "/"), ""); err != nil {
+			return fmt.Errorf("invalid overlay path pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// overlayColorPattern matches the accent color of an overlay.
+var overlayColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// validateOverlayStyle checks the overlay position, theme, accent color and
+// visibility of a project.
+func validateOverlayStyle(position, theme, color, visibility string) error {
+	switch position {
+	case database.OverlayTop, database.OverlayBottom:
+	default:
+		return fmt.Errorf("invalid overlay position: must be empty or bottom")
+	}
+	switch theme {
+	case database.OverlayDark, database.OverlayLight, database.OverlayAuto:
+	default:
+		return fmt.Errorf("invalid overlay theme: must be empty, light, or auto")
+	}
+	if color != "" && !overlayColorPattern.MatchString(color) {
+		return fmt.Errorf("invalid overlay color: use a hex color such as #3b82f6")
+	}
+	switch visibility {
+	case database.OverlayShown, database.OverlayCollapsed, database.OverlayHidden:
+	default:
+		return fmt.Errorf("invalid overlay visibility: must be empty, collapsed, or hidden")
+	}
+	return nil
+}
+
+// renderOverlay renders the doc overlay for the pages of a version in the
+// project's style, or returns "" if the project hides the overlay or the
+// version opts out of it in its asiakirjat.yaml.
+func (h *Handler) renderOverlay(ctx context.Context, project *database.Project, storagePath string, data templates.OverlayData) (string, error) {
+	if project.OverlayVisibility == database.OverlayHidden {
+		return "", nil
+	}
+	if config, err := docs.ReadVersionConfig(storagePath); err != nil {
+		h.logger.WarnContext(ctx, "reading version config", "error", err, "project", project.Slug, "version", data.Version)
+	} else if config.HidesOverlay() {
+		return "", nil
+	}
+	data.Position = project.OverlayPosition
+	data.Theme = project.OverlayTheme
+	if data.Theme == database.OverlayAuto {
+		// Follow the theme the reader chose; readers who did not choose
+		// one get the color scheme of their browser in the browser
+		if user := auth.UserFromContext(ctx); user != nil && user.Theme != database.ThemeSystem {
+			data.Theme = user.Theme
+		}
+	}
+	data.Color = project.OverlayColor
+	data.Collapsed = project.OverlayVisibility == database.OverlayCollapsed
+	return h.templates.RenderOverlay(data)
+}
+
+// matchOverlayPath reports whether name, a path within a version, matches
+// one of patterns. Patterns use path.Match syntax; a pattern ending in /
+// matches everything in the directories it matches.
+func matchOverlayPath(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if dir, ok := strings.CutSuffix(p, "/"); ok {
+			for i := range len(name) {
+				if name[i] != '/' {
+					continue
+				}
+				if ok, _ := path.Match(dir, name[:i]); ok {
+					return true
+				}
+			}
+			continue
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// overlayInjection reports whether filePath may be an HTML page that gets
+// the doc overlay. Pages and extensionless files qualify unless they are
+// on the project's exclude list; the response itself is still checked to
+// be HTML. Paths on the include list qualify whatever their extension,
+// and sniff reports that their content decides whether they are HTML.
+func overlayInjection(project *database.Project, filePath string) (inject, sniff bool) {
+	name := filePath
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+	if matchOverlayPath(overlayPathPatterns(project.OverlayExclude), name) {
+		return false, false
+	}
+	if matchOverlayPath(overlayPathPatterns(project.OverlayInclude), name) {
+		return true, true
+	}
+	switch path.Ext(name) {
+	case "", ".html", ".htm":
+		return true, false
+	}
+	return false, false
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestOverlayInjectionPaths(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+
+	versionPath := app.handler.storage.VersionPath("guide", "1.0.0")
+	page := []byte("<html><body>Page</body></html>")
+	os.MkdirAll(filepath.Join(versionPath, "api"), 0755)
+	os.MkdirAll(filepath.Join(versionPath, "v1.2"), 0755)
+	os.WriteFile(filepath.Join(versionPath, "v1.2", "page"), page, 0644)
+	os.WriteFile(filepath.Join(versionPath, "app.php"), page, 0644)
+	os.WriteFile(filepath.Join(versionPath, "api", "embed.html"), page, 0644)
+	os.WriteFile(filepath.Join(versionPath, "config"), []byte(`{"html": "</body>"}`), 0644)
+
+	project.OverlayInclude = "*.php"
+	project.OverlayExclude = "# served inside other pages\n/api/"
+	if err := app.handler.projects.Update(context.Background(), project); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]bool{
+		"":                 true,
+		"guide/intro.html": true,
+		"v1.2/page":        true,
+		"app.php":          true,
+		"api/embed.html":   false,
+		"config":           false,
+		"style.css":        false,
+	} {
+		body := getBody(t, app.server.URL+"/project/guide/1.0.0/"+path)
+		if got := strings.Contains(body, "asiakirjat-overlay"); got != want {
+			t.Errorf("%q: overlay injected = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestValidateOverlayPaths(t *testing.T) {
+	if err := validateOverlayPaths("*.php\n\n# comment\napi/"); err != nil {
+		t.Errorf("expected valid patterns, got %v", err)
+	}
+	if err := validateOverlayPaths("[a-"); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+	if err := validateOverlayPaths(strings.Repeat("a", maxOverlayPathsLen+1)); err == nil {
+		t.Error("expected an error for a long list")
+	}
+}
+
+func TestOverlayStyle(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	ctx := context.Background()
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+
+	project.OverlayPosition = database.OverlayBottom
+	project.OverlayTheme = database.OverlayLight
+	project.OverlayColor = "#ff6600"
+	project.OverlayVisibility = database.OverlayCollapsed
+	app.handler.projects.Update(ctx, project)
+	body := getBody(t, app.server.URL+"/project/guide/1.0.0/")
+	for _, want := range []string{`class="ao-bottom ao-theme-light"`, `style="--ao-accent: #ff6600"`, "data-collapsed", `id="asiakirjat-collapse"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in the overlay", want)
+		}
+	}
+
+	// A version opts out in its asiakirjat.yaml
+	versionPath := app.handler.storage.VersionPath("guide", "1.0.0")
+	os.WriteFile(filepath.Join(versionPath, "asiakirjat.yaml"), []byte("overlay: false\n"), 0644)
+	if body := getBody(t, app.server.URL+"/project/guide/1.0.0/"); strings.Contains(body, "asiakirjat-overlay") {
+		t.Error("expected no overlay in a version that opts out")
+	}
+	os.Remove(filepath.Join(versionPath, "asiakirjat.yaml"))
+
+	project.OverlayVisibility = database.OverlayHidden
+	app.handler.projects.Update(ctx, project)
+	if body := getBody(t, app.server.URL+"/project/guide/1.0.0/"); strings.Contains(body, "asiakirjat-overlay") {
+		t.Error("expected no overlay in a project that hides it")
+	}
+}
+
+func TestValidateOverlayStyle(t *testing.T) {
+	if err := validateOverlayStyle("bottom", "light", "#3B82F6", "collapsed"); err != nil {
+		t.Errorf("expected a valid style, got %v", err)
+	}
+	for _, style := range [][4]string{
+		{"left", "", "", ""},
+		{"", "neon", "", ""},
+		{"", "", "red; background: url(x)", ""},
+		{"", "", "", "sometimes"},
+	} {
+		if err := validateOverlayStyle(style[0], style[1], style[2], style[3]); err == nil {
+			t.Errorf("expected %q to be invalid", style)
+		}
+	}
+}
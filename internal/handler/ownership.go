@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// maintainer is the "maintained by" line of a project page and the overlay.
+type maintainer struct {
+	Name       string
+	ContactURL string
+}
+
+// validateOwnerContact accepts an empty contact, an email address or an
+// http(s) URL, e.g. of a chat channel or issue tracker.
+func validateOwnerContact(contact string) error {
+	if contact == "" || ownerContactURL(contact) != "" {
+		return nil
+	}
+	return fmt.Errorf("invalid owner contact: use an email address or an http(s) URL")
+}
+
+// ownerContactURL turns a project's contact into a link: URLs are used as
+// they are, email addresses become mailto: links. Anything else yields "".
+func ownerContactURL(contact string) string {
+	if u, err := url.Parse(contact); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return contact
+	}
+	if addr, err := mail.ParseAddress(contact); err == nil && addr.Name == "" {
+		return "mailto:" + addr.Address
+	}
+	return ""
+}
+
+// projectMaintainer returns who maintains a project, or nil if neither an
+// owner nor a team is recorded.
+func projectMaintainer(project *database.Project) *maintainer {
+	name := project.OwnerTeam
+	if name == "" {
+		name = project.Owner
+	}
+	if name == "" {
+		return nil
+	}
+	return &maintainer{Name: name, ContactURL: ownerContactURL(project.OwnerContact)}
+}
+
+// ownerExists reports whether an owner account still exists. Accounts from
+// a directory such as LDAP are looked up there, so owners who left are
+// found before their local account is removed. Owners that never logged in
+// are looked up in every directory.
+func (h *Handler) ownerExists(ctx context.Context, username string) (bool, error) {
+	user, err := h.users.GetByUsername(ctx, username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	for _, a := range h.authenticators {
+		lookup, ok := a.(auth.DirectoryLookup)
+		if !ok || (user != nil && a.Name() != user.AuthSource) {
+			continue
+		}
+		exists, err := lookup.UserExists(ctx, username)
+		if err != nil || user != nil || exists {
+			return exists, err
+		}
+	}
+	return user != nil, nil
+}
+
+// checkOwner updates the orphaned flag of a project after its owner was
+// looked up, and audits projects that lost their owner.
+func (h *Handler) checkOwner(ctx context.Context, project *database.Project, actor string) error {
+	orphaned := false
+	if project.Owner != "" {
+		exists, err := h.ownerExists(ctx, project.Owner)
+		if err != nil {
+			return fmt.Errorf("looking up owner %s: %w", project.Owner, err)
+		}
+		orphaned = !exists
+	}
+	if orphaned == project.OwnerOrphaned {
+		return nil
+	}
+	if err := h.projects.SetOwnerOrphaned(ctx, project.ID, orphaned); err != nil {
+		return err
+	}
+	project.OwnerOrphaned = orphaned
+	if orphaned {
+		h.audit(ctx, "owner.orphaned", actor, fmt.Sprintf("%s: owner %s no longer exists", project.Slug, project.Owner))
+	}
+	return nil
+}
+
+// runOwnerCheck flags projects whose owner account no longer exists, and
+// clears the flag once an owner is back or replaced.
+func (h *Handler) runOwnerCheck(ctx context.Context) error {
+	projects, err := h.projects.List(ctx)
+	if err != nil {
+		return fmt.Errorf("listing projects: %w", err)
+	}
+
+	var failed []string
+	for i := range projects {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := h.checkOwner(ctx, &projects[i], "system"); err != nil {
+			h.logger.ErrorContext(ctx, "owner check", "error", err, "project", projects[i].Slug)
+			failed = append(failed, projects[i].Slug)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not check the owner of %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
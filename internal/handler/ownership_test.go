@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// fakeDirectory is an authenticator backed by a fixed set of accounts.
+type fakeDirectory struct {
+	users map[string]bool
+}
+
+func (d *fakeDirectory) Name() string { return "ldap" }
+
+func (d *fakeDirectory) Authenticate(ctx context.Context, username, password string) (*database.User, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (d *fakeDirectory) UserExists(ctx context.Context, username string) (bool, error) {
+	return d.users[username], nil
+}
+
+func TestOwnerContactURL(t *testing.T) {
+	tests := []struct {
+		contact string
+		want    string
+	}{
+		{"docs-team@example.com", "mailto:docs-team@example.com"},
+		{"https://chat.example.com/channel/docs", "https://chat.example.com/channel/docs"},
+		{"javascript:alert(1)", ""},
+		{"Platform Team", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ownerContactURL(tt.contact); got != tt.want {
+			t.Errorf("ownerContactURL(%q) = %q, want %q", tt.contact, got, tt.want)
+		}
+	}
+}
+
+func TestOwnerCheckFlagsOrphanedProjects(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	app.handler.authenticators = append(app.handler.authenticators, &fakeDirectory{users: map[string]bool{"carol": true}})
+
+	app.handler.users.Create(ctx, &database.User{Username: "alice", AuthSource: "builtin", Role: "editor"})
+	app.handler.users.Create(ctx, &database.User{Username: "bob", AuthSource: "ldap", Role: "editor"})
+
+	owners := map[string]string{"kept": "alice", "left": "bob", "never-logged-in": "carol", "ghost": "dave", "unowned": ""}
+	for slug, owner := range owners {
+		project := seedProject(t, app, slug, slug, true)
+		project.Owner = owner
+		app.handler.projects.Update(ctx, project)
+	}
+
+	if err := app.handler.runOwnerCheck(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for slug, wantOrphaned := range map[string]bool{"kept": false, "left": true, "never-logged-in": false, "ghost": true, "unowned": false} {
+		project, _ := app.handler.projects.GetBySlug(ctx, slug)
+		if project.OwnerOrphaned != wantOrphaned {
+			t.Errorf("%s: expected orphaned=%v", slug, wantOrphaned)
+		}
+	}
+	entries, _ := app.handler.auditLog.List(ctx, 10)
+	if len(entries) != 2 || entries[0].Action != "owner.orphaned" {
+		t.Errorf("expected two owner.orphaned audit entries, got %+v", entries)
+	}
+
+	app.handler.users.Create(ctx, &database.User{Username: "dave", AuthSource: "builtin", Role: "viewer"})
+	app.handler.runOwnerCheck(ctx)
+	if project, _ := app.handler.projects.GetBySlug(ctx, "ghost"); project.OwnerOrphaned {
+		t.Error("expected the flag to clear once the owner exists")
+	}
+}
+
+func TestMaintainedByOnProjectPageAndOverlay(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	ctx := context.Background()
+
+	project := seedProject(t, app, "owned", "Owned", true)
+	project.OwnerTeam = "Platform Team"
+	project.OwnerContact = "platform@example.com"
+	app.handler.projects.Update(ctx, project)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+
+	for _, path := range []string{"/project/owned", "/project/owned/1.0.0/guide/intro.html"} {
+		body := getBody(t, app.server.URL+path)
+		if !strings.Contains(body, `href="mailto:platform@example.com"`) || !strings.Contains(body, "Platform Team") {
+			t.Errorf("%s: expected a maintained-by link", path)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Page sizes of the API listings
+const (
+	listPageDefault = 30
+	listPageMax     = 100
+)
+
+// listPage is the page of an API listing asked for with ?page and
+// ?per_page. Without either, listings return everything, as before they
+// were paged.
+type listPage struct {
+	Page    int
+	PerPage int // 0 for everything
+}
+
+func parseListPage(params url.Values) (listPage, error) {
+	pageParam, perPageParam := params.Get("page"), params.Get("per_page")
+	if pageParam == "" && perPageParam == "" {
+		return listPage{}, nil
+	}
+	p := listPage{Page: 1, PerPage: listPageDefault}
+	if pageParam != "" {
+		n, err := strconv.Atoi(pageParam)
+		if err != nil || n < 1 {
+			return listPage{}, errors.New("invalid page")
+		}
+		p.Page = n
+	}
+	if perPageParam != "" {
+		n, err := strconv.Atoi(perPageParam)
+		if err != nil || n < 1 {
+			return listPage{}, errors.New("invalid per_page")
+		}
+		p.PerPage = min(n, listPageMax)
+	}
+	return p, nil
+}
+
+// queryError returns the error of parseListPage or parseSort as the text of
+// a 400 response.
+func queryError(err error) string {
+	msg := err.Error()
+	return strings.ToUpper(msg[:1]) + msg[1:]
+}
+
+// limitOffset returns the page as a limit and offset, with a limit of 0
+// for everything.
+func (p listPage) limitOffset() (int, int) {
+	if p.PerPage == 0 {
+		return 0, 0
+	}
+	return p.PerPage, (p.Page - 1) * p.PerPage
+}
+
+// parseSort returns the field and direction of ?sort, which is one of
+// fields, prefixed with "-" for descending order. An empty sort returns
+// "", for the listing's own order.
+func parseSort(sort string, fields ...string) (string, bool, error) {
+	field, desc := strings.CutPrefix(sort, "-")
+	if field == "" && !desc {
+		return "", false, nil
+	}
+	if !slices.Contains(fields, field) {
+		return "", false, fmt.Errorf("invalid sort; use %s", strings.Join(fields, ", "))
+	}
+	return field, desc, nil
+}
+
+// setPageHeaders tells API clients how many items a listing has in
+// X-Total-Count and, for paged listings, links the first, previous, next
+// and last pages in Link. path is the listing's path below the base path.
+func (h *Handler) setPageHeaders(w http.ResponseWriter, r *http.Request, path string, p listPage, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if p.PerPage == 0 {
+		return
+	}
+	last := max(1, (total+p.PerPage-1)/p.PerPage)
+	link := func(page int, rel string) string {
+		params := r.URL.Query()
+		params.Set("page", strconv.Itoa(page))
+		params.Set("per_page", strconv.Itoa(p.PerPage))
+		return "<" + h.publicURL(r) + path + "?" + params.Encode() + `>; rel="` + rel + `"`
+	}
+	links := []string{link(1, "first")}
+	if p.Page > 1 {
+		links = append(links, link(min(p.Page-1, last), "prev"))
+	}
+	if p.Page < last {
+		links = append(links, link(p.Page+1, "next"))
+	}
+	links = append(links, link(last, "last"))
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
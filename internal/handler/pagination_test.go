@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIProjectsPagination(t *testing.T) {
+	app := setupTestApp(t)
+	token := adminAPIToken(t, app)
+	for _, slug := range []string{"echo", "alpha", "delta", "bravo"} {
+		seedProject(t, app, slug, strings.ToUpper(slug[:1])+slug[1:], true)
+	}
+	seedProject(t, app, "charlie", "Charlie", false)
+
+	list := func(query string) ([]string, *http.Response) {
+		t.Helper()
+		resp := apiRequest(t, app, "GET", "/api/projects"+query, token, "", nil)
+		defer resp.Body.Close()
+		var projects []struct {
+			Slug string `json:"slug"`
+		}
+		json.NewDecoder(resp.Body).Decode(&projects)
+		var slugs []string
+		for _, p := range projects {
+			slugs = append(slugs, p.Slug)
+		}
+		return slugs, resp
+	}
+
+	slugs, resp := list("?per_page=2&page=2")
+	if !slices.Equal(slugs, []string{"charlie", "delta"}) {
+		t.Errorf("expected the second page, got %v", slugs)
+	}
+	if resp.Header.Get("X-Total-Count") != "5" {
+		t.Errorf("expected a total of 5, got %q", resp.Header.Get("X-Total-Count"))
+	}
+	link := resp.Header.Get("Link")
+	for _, want := range []string{`page=1&per_page=2>; rel="first"`, `page=1&per_page=2>; rel="prev"`, `page=3&per_page=2>; rel="next"`, `page=3&per_page=2>; rel="last"`} {
+		if !strings.Contains(link, want) {
+			t.Errorf("expected Link to contain %s, got %s", want, link)
+		}
+	}
+
+	slugs, resp = list("?sort=-name&visibility=public&per_page=3")
+	if !slices.Equal(slugs, []string{"echo", "delta", "bravo"}) || resp.Header.Get("X-Total-Count") != "4" {
+		t.Errorf("expected public projects by name descending, got %v of %s", slugs, resp.Header.Get("X-Total-Count"))
+	}
+	if strings.Contains(resp.Header.Get("Link"), `rel="prev"`) {
+		t.Error("expected no previous page on the first page")
+	}
+
+	slugs, resp = list("")
+	if len(slugs) != 5 || resp.Header.Get("Link") != "" {
+		t.Errorf("expected all projects without paging, got %v", slugs)
+	}
+
+	for _, query := range []string{"?page=0", "?per_page=x", "?sort=size", "?visibility=secret"} {
+		_, resp := list(query)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPIVersionsPagination(t *testing.T) {
+	app := setupTestApp(t)
+	seedAdmin(t, app)
+	token := adminAPIToken(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedAgedVersion(t, app, project, "1.10.0", 3*time.Hour)
+	seedAgedVersion(t, app, project, "1.2.0", 1*time.Hour)
+	seedAgedVersion(t, app, project, "1.9.0", 2*time.Hour)
+
+	list := func(query string) ([]string, *http.Response) {
+		t.Helper()
+		resp := apiRequest(t, app, "GET", "/api/project/guide/versions"+query, token, "", nil)
+		defer resp.Body.Close()
+		var versions []struct {
+			Tag string `json:"tag"`
+		}
+		json.NewDecoder(resp.Body).Decode(&versions)
+		var tags []string
+		for _, v := range versions {
+			tags = append(tags, v.Tag)
+		}
+		return tags, resp
+	}
+
+	for query, want := range map[string][]string{
+		"":                                {"1.10.0", "1.9.0", "1.2.0"},
+		"?sort=name":                      {"1.2.0", "1.9.0", "1.10.0"},
+		"?per_page=2&page=2":              {"1.2.0"},
+		"?sort=-created&per_page=2":       {"1.2.0", "1.9.0"},
+		"?sort=updated&page=2&per_page=2": {"1.2.0"},
+	} {
+		tags, resp := list(query)
+		if !slices.Equal(tags, want) {
+			t.Errorf("%q: expected %v, got %v", query, want, tags)
+		}
+		if resp.Header.Get("X-Total-Count") != "3" {
+			t.Errorf("%q: expected a total of 3, got %q", query, resp.Header.Get("X-Total-Count"))
+		}
+	}
+}
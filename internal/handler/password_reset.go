@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+const passwordResetTTL = time.Hour
+
+// passwordResetSent is shown whether or not the account exists, so the
+// form does not tell which usernames do.
+const passwordResetSent = "If the account exists and has an email address, a link to reset its password is on its way. The link is valid for one hour."
+
+// passwordResetEnabled reports whether built-in users can reset a
+// forgotten password. The link is emailed, and its URL must come from the
+// configuration: one derived from the Host header of the request would let
+// anyone send a user a link to their own server.
+func (h *Handler) passwordResetEnabled() bool {
+	return h.mailer != nil && h.config.Server.PublicURL != ""
+}
+
+func (h *Handler) handleForgotPasswordPage(w http.ResponseWriter, r *http.Request) {
+	if !h.passwordResetEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	h.render(w, "forgot_password", map[string]any{"User": nil})
+}
+
+func (h *Handler) handleForgotPasswordSubmit(w http.ResponseWriter, r *http.Request) {
+	if !h.passwordResetEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	ctx := r.Context()
+
+	username := r.FormValue("username")
+	if username == "" {
+		h.render(w, "forgot_password", map[string]any{
+			"User":  nil,
+			"Error": "Username is required",
+		})
+		return
+	}
+
+	if user, err := h.users.GetByUsername(ctx, username); err == nil {
+		if err := h.sendPasswordReset(ctx, user); err != nil {
+			h.logger.ErrorContext(ctx, "creating password reset", "error", err, "user", username)
+		}
+	}
+
+	h.render(w, "forgot_password", map[string]any{
+		"User":    nil,
+		"Success": passwordResetSent,
+	})
+}
+
+// sendPasswordReset emails a built-in user a link to reset their password.
+// Users without a password of their own, or without an email address, get
+// nothing.
+func (h *Handler) sendPasswordReset(ctx context.Context, user *database.User) error {
+	if user.AuthSource != "builtin" || user.IsRobot || user.Deactivated || user.Email == "" {
+		return nil
+	}
+	token, err := auth.GenerateToken(32)
+	if err != nil {
+		return err
+	}
+	reset := &database.PasswordReset{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetTTL),
+	}
+	if err := h.passwordResets.Create(ctx, reset); err != nil {
+		return err
+	}
+	h.audit(ctx, "user.password_reset_requested", user.Username, "")
+
+	body := fmt.Sprintf("Someone, hopefully you, asked to reset the password of your account %s. Open this link within one hour to choose a new password:\n\n%sIf you did not ask for this, ignore this email: your password stays unchanged.\n",
+		user.Username, h.emailLink("/reset-password?token="+url.QueryEscape(token)))
+	h.sendEmail(ctx, []string{user.Email}, "Reset your password", body)
+	return nil
+}
+
+// passwordResetUser returns the user a reset token was sent to, or nil if
+// the token is unknown or expired, or the user was deactivated since.
+func (h *Handler) passwordResetUser(ctx context.Context, token string) *database.User {
+	if token == "" {
+		return nil
+	}
+	reset, err := h.passwordResets.GetByTokenHash(ctx, auth.HashToken(token))
+	if err != nil || time.Now().After(reset.ExpiresAt) {
+		return nil
+	}
+	user, err := h.users.GetByID(ctx, reset.UserID)
+	if err != nil || user.AuthSource != "builtin" || user.Deactivated {
+		return nil
+	}
+	return user
+}
+
+func (h *Handler) handleResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	if !h.passwordResetEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	// The token is in the URL; keep it out of the Referer of other sites
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	token := r.URL.Query().Get("token")
+	if h.passwordResetUser(r.Context(), token) == nil {
+		h.render(w, "reset_password", map[string]any{
+			"User":    nil,
+			"Invalid": true,
+		})
+		return
+	}
+	h.render(w, "reset_password", map[string]any{
+		"User":  nil,
+		"Token": token,
+	})
+}
+
+func (h *Handler) handleResetPasswordSubmit(w http.ResponseWriter, r *http.Request) {
+	if !h.passwordResetEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	ctx := r.Context()
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	token := r.FormValue("token")
+	user := h.passwordResetUser(ctx, token)
+	if user == nil {
+		h.render(w, "reset_password", map[string]any{
+			"User":    nil,
+			"Invalid": true,
+		})
+		return
+	}
+
+	newPassword := r.FormValue("new_password")
+	confirmPassword := r.FormValue("confirm_password")
+	if newPassword == "" || newPassword != confirmPassword {
+		h.render(w, "reset_password", map[string]any{
+			"User":  nil,
+			"Token": token,
+			"Error": "Enter the new password twice",
+		})
+		return
+	}
+
+	hash, err := auth.HashPassword(newPassword)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "hashing password", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	user.Password = &hash
+	if err := h.users.Update(ctx, user); err != nil {
+		h.logger.ErrorContext(ctx, "updating password", "error", err)
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+	// A link is good for one reset, and whoever knew the old password is
+	// logged out
+	if err := h.passwordResets.DeleteByUser(ctx, user.ID); err != nil {
+		h.logger.ErrorContext(ctx, "deleting password resets", "error", err)
+	}
+	if err := h.sessions.DeleteByUser(ctx, user.ID); err != nil {
+		h.logger.ErrorContext(ctx, "deleting sessions", "error", err)
+	}
+	h.audit(ctx, "user.password_reset", user.Username, "")
+
+	h.render(w, "login", map[string]any{
+		"User":                 nil,
+		"Success":              "Your password was changed. Log in with the new password.",
+		"OAuth2Enabled":        h.config.Auth.OAuth2.Enabled,
+		"PasswordResetEnabled": true,
+		"RememberEnabled":      h.sessionMgr.RememberEnabled(),
+	})
+}
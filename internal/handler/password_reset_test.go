@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// profileStatus returns the status of the profile page with cookies: 200
+// while the session is valid.
+func profileStatus(t *testing.T, app *testApp, cookies []*http.Cookie) int {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	req, _ := http.NewRequest("GET", app.server.URL+"/profile", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func postPasswordForm(t *testing.T, app *testApp, path string, form url.Values) (int, string) {
+	t.Helper()
+	resp, err := http.PostForm(app.server.URL+path, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestPasswordReset(t *testing.T) {
+	app := setupTestApp(t)
+	mailer := &fakeMailer{}
+	app.handler.mailer = mailer
+	app.handler.config.Server.PublicURL = "https://docs.example.com"
+	ctx := context.Background()
+
+	hash, _ := auth.HashPassword("oldpass")
+	app.handler.users.Create(ctx, &database.User{Username: "ada", Email: "ada@example.com", Password: &hash, AuthSource: "builtin", Role: "viewer"})
+	app.handler.users.Create(ctx, &database.User{Username: "ldapuser", Email: "ldap@example.com", AuthSource: "ldap", Role: "viewer"})
+	session := loginUser(t, app, "ada", "oldpass")
+
+	if body := getBody(t, app.server.URL+"/login"); !strings.Contains(body, "Forgot password?") {
+		t.Error("expected a forgot password link on the login page")
+	}
+
+	// Unknown and external users get the same answer, and no email
+	for _, username := range []string{"nobody", "ldapuser"} {
+		_, body := postPasswordForm(t, app, "/forgot-password", url.Values{"username": {username}})
+		if !strings.Contains(body, "a link to reset its password is on its way") {
+			t.Errorf("expected the same answer for %s", username)
+		}
+	}
+	if sent := mailer.take(t, app); len(sent) != 0 {
+		t.Fatalf("expected no email, got %+v", sent)
+	}
+
+	postPasswordForm(t, app, "/forgot-password", url.Values{"username": {"ada"}})
+	sent := mailer.take(t, app)
+	if len(sent) != 1 || sent[0].To[0] != "ada@example.com" {
+		t.Fatalf("expected a reset email to ada, got %+v", sent)
+	}
+	link := "https://docs.example.com/reset-password?token="
+	i := strings.Index(sent[0].Body, link)
+	if i < 0 {
+		t.Fatalf("expected a reset link in %q", sent[0].Body)
+	}
+	token, _, _ := strings.Cut(sent[0].Body[i+len(link):], "\n")
+
+	if body := getBody(t, app.server.URL+"/reset-password?token="+token); !strings.Contains(body, `name="new_password"`) {
+		t.Error("expected the reset form")
+	}
+	if body := getBody(t, app.server.URL+"/reset-password?token=wrong"); !strings.Contains(body, "invalid or has expired") {
+		t.Error("expected an unknown token to be refused")
+	}
+
+	_, body := postPasswordForm(t, app, "/reset-password", url.Values{"token": {token}, "new_password": {"newpass"}, "confirm_password": {"other"}})
+	if !strings.Contains(body, "Enter the new password twice") {
+		t.Error("expected mismatching passwords to be refused")
+	}
+	_, body = postPasswordForm(t, app, "/reset-password", url.Values{"token": {token}, "new_password": {"newpass"}, "confirm_password": {"newpass"}})
+	if !strings.Contains(body, "Your password was changed") {
+		t.Fatalf("expected the password to be reset, got %s", body)
+	}
+
+	if status := profileStatus(t, app, session); status == http.StatusOK {
+		t.Error("expected the sessions of the user to end with the reset")
+	}
+	if cookies := loginUser(t, app, "ada", "oldpass"); len(cookies) != 0 {
+		t.Error("expected the old password to stop working")
+	}
+	if cookies := loginUser(t, app, "ada", "newpass"); len(cookies) == 0 {
+		t.Error("expected the new password to work")
+	}
+
+	_, body = postPasswordForm(t, app, "/reset-password", url.Values{"token": {token}, "new_password": {"again"}, "confirm_password": {"again"}})
+	if !strings.Contains(body, "invalid or has expired") {
+		t.Error("expected a used token to be refused")
+	}
+}
+
+func TestPasswordResetDisabled(t *testing.T) {
+	app := setupTestApp(t)
+
+	if body := getBody(t, app.server.URL+"/login"); strings.Contains(body, "Forgot password?") {
+		t.Error("expected no forgot password link without email")
+	}
+	if status, _ := postPasswordForm(t, app, "/forgot-password", url.Values{"username": {"ada"}}); status != http.StatusNotFound {
+		t.Errorf("expected 404 without email, got %d", status)
+	}
+
+	// Links would be built from the Host header of the request
+	app.handler.mailer = &fakeMailer{}
+	resp, err := http.Get(app.server.URL + "/forgot-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 without a public URL, got %d", resp.StatusCode)
+	}
+}
+
+func TestPasswordResetExpired(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.mailer = &fakeMailer{}
+	app.handler.config.Server.PublicURL = "https://docs.example.com"
+	ctx := context.Background()
+	admin := seedAdmin(t, app)
+
+	app.handler.passwordResets.Create(ctx, &database.PasswordReset{
+		TokenHash: auth.HashToken("expired"),
+		UserID:    admin.ID,
+		ExpiresAt: time.Now().UTC().Add(-time.Minute),
+	})
+	if body := getBody(t, app.server.URL+"/reset-password?token=expired"); !strings.Contains(body, "invalid or has expired") {
+		t.Error("expected an expired token to be refused")
+	}
+
+	admin.Deactivated = true
+	app.handler.users.Update(ctx, admin)
+	app.handler.passwordResets.Create(ctx, &database.PasswordReset{
+		TokenHash: auth.HashToken("deactivated"),
+		UserID:    admin.ID,
+		ExpiresAt: time.Now().UTC().Add(time.Hour),
+	})
+	if body := getBody(t, app.server.URL+"/reset-password?token=deactivated"); !strings.Contains(body, "invalid or has expired") {
+		t.Error("expected the token of a deactivated user to be refused")
+	}
+	_, body := postPasswordForm(t, app, "/reset-password", url.Values{"token": {"deactivated"}, "new_password": {"newpass"}, "confirm_password": {"newpass"}})
+	if !strings.Contains(body, "invalid or has expired") {
+		t.Error("expected a deactivated user not to reset their password")
+	}
+
+	if err := app.handler.runSessionCleanup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.handler.passwordResets.GetByTokenHash(ctx, auth.HashToken("expired")); err == nil {
+		t.Error("expected the cleanup to delete expired resets")
+	}
+}
+
+func TestChangePasswordEndsOtherSessions(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+
+	hash, _ := auth.HashPassword("oldpass")
+	app.handler.users.Create(ctx, &database.User{Username: "ada", Password: &hash, AuthSource: "builtin", Role: "viewer"})
+	other := loginUser(t, app, "ada", "oldpass")
+	current := loginUser(t, app, "ada", "oldpass")
+
+	form := url.Values{"current_password": {"oldpass"}, "new_password": {"newpass"}, "confirm_password": {"newpass"}}
+	req, _ := http.NewRequest("POST", app.server.URL+"/profile/password", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range current {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the password to change, got %d", resp.StatusCode)
+	}
+
+	if status := profileStatus(t, app, other); status == http.StatusOK {
+		t.Error("expected the other session to end")
+	}
+	if status := profileStatus(t, app, resp.Cookies()); status != http.StatusOK {
+		t.Errorf("expected a new session for the current browser, got %d", status)
+	}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// access says who may use a route, see policy.
+type access int
+
+const (
+	accessUnset access = iota
+	// accessPublic routes serve anyone without loading the session, e.g.
+	// static files and health checks.
+	accessPublic
+	// accessSession routes load the user of the session, if any, and
+	// leave the access checks to the handler, e.g. for the visibility of
+	// projects. Anonymous requests are turned away when anonymous access
+	// is off.
+	accessSession
+	// accessUser routes require a logged-in user.
+	accessUser
+	// accessEditor routes require an editor or admin.
+	accessEditor
+	// accessAdmin routes require an admin.
+	accessAdmin
+	// accessAPI routes accept a token with the policy's scope, an API key
+	// if the scope is read, or the session.
+	accessAPI
+	// accessAPIAdmin routes are accessAPI routes for admins only.
+	accessAPIAdmin
+	// accessToken routes require a token with the policy's scope. The
+	// handler authenticates it once it knows the project the token must
+	// be valid for, which may come from the request body.
+	accessToken
+)
+
+// policy is the authorization a route requires before its handler runs.
+// Anonymous requests to pages are redirected to the login page, to the
+// API they get 401 Unauthorized; users without the required role get 403
+// Forbidden.
+type policy struct {
+	access access
+	scope  string // token scope of API and token routes
+}
+
+var (
+	policyPublic  = policy{access: accessPublic}
+	policySession = policy{access: accessSession}
+	policyUser    = policy{access: accessUser}
+	policyEditor  = policy{access: accessEditor}
+	policyAdmin   = policy{access: accessAdmin}
+)
+
+func apiPolicy(scope string) policy      { return policy{access: accessAPI, scope: scope} }
+func apiAdminPolicy(scope string) policy { return policy{access: accessAPIAdmin, scope: scope} }
+func tokenPolicy(scope string) policy    { return policy{access: accessToken, scope: scope} }
+
+// String describes the policy, e.g. "admin" or "api:read".
+func (p policy) String() string {
+	name := map[access]string{
+		accessUnset:    "unset",
+		accessPublic:   "public",
+		accessSession:  "session",
+		accessUser:     "user",
+		accessEditor:   "editor",
+		accessAdmin:    "admin",
+		accessAPI:      "api",
+		accessAPIAdmin: "api-admin",
+		accessToken:    "token",
+	}[p.access]
+	if p.scope != "" {
+		name += ":" + p.scope
+	}
+	return name
+}
+
+// route is a route below the base path.
+type route struct {
+	pattern string // method and path, e.g. "GET /project/{slug}"
+	policy  policy
+	handler http.HandlerFunc
+}
+
+// authorize wraps a handler in the checks of its policy. It panics for
+// routes without a policy, so that none is registered unprotected by
+// mistake.
+func (h *Handler) authorize(p policy, next http.HandlerFunc) http.HandlerFunc {
+	switch p.access {
+	case accessPublic:
+		return next
+	case accessSession:
+		return h.withSession(next)
+	case accessUser:
+		return h.withSession(h.requireAuth(next))
+	case accessEditor:
+		return h.withSession(h.requireEditorOrAdmin(next))
+	case accessAdmin:
+		return h.withSession(h.requireAdmin(next))
+	case accessAPI:
+		return h.withAPIAuth(p.scope, next)
+	case accessAPIAdmin:
+		return h.withAPIAuth(p.scope, h.requireAdmin(next))
+	case accessToken:
+		// Checked by the handler, after refusing uploads during a
+		// shutdown so that clients retry
+		return next
+	}
+	panic(fmt.Sprintf("route without authorization policy: %v", p))
+}
+
+// isAPIRequest reports whether a request is for the API or SCIM, whose
+// errors are JSON rather than pages.
+func (h *Handler) isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, h.config.RoutePrefix()+"/api/") || strings.HasPrefix(r.URL.Path, h.config.RoutePrefix()+"/scim/")
+}
+
+// forbid answers a request of a user without the role a route requires.
+func (h *Handler) forbid(w http.ResponseWriter, r *http.Request) {
+	if h.isAPIRequest(r) {
+		h.jsonError(w, "Forbidden: insufficient role", http.StatusForbidden)
+		return
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
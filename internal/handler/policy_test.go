@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// routePolicies is the authorization policy of every route. A new route
+// fails TestRoutePolicies until it is listed here, so that its policy is
+// reviewed.
+var routePolicies = map[string]string{
+	// Static files
+	"GET /static/": "public",
+
+	// Public pages
+	"GET /{$}":              "session",
+	"GET /login":            "session",
+	"POST /login":           "session",
+	"GET /logout":           "session",
+	"GET /forgot-password":  "session",
+	"POST /forgot-password": "session",
+	"GET /reset-password":   "session",
+	"POST /reset-password":  "session",
+	"GET /licenses":         "session",
+	"GET /auth/oauth2":      "public",
+	"GET /auth/callback":    "session",
+
+	// Search engines
+	"GET /robots.txt":     "public",
+	"GET /offline-sw.js":  "public",
+	"GET /sitemap.xml":    "public",
+	"GET /opensearch.xml": "public",
+
+	// Feeds
+	"GET /feed.atom":                "public",
+	"GET /project/{slug}/feed.atom": "public",
+	"GET /watching.atom":            "public",
+
+	// Project pages
+	"GET /project/{slug}":                                  "session",
+	"POST /project/{slug}/watch":                           "user",
+	"GET /project/{slug}/{version}/{path...}":              "session",
+	"GET /project/{slug}/{version}/download.zip":           "session",
+	"GET /project/{slug}/preview/{id}/{path...}":           "session",
+	"GET /project/{slug}/opensearch.xml":                   "session",
+	"GET /project/{slug}/versions.json":                    "session",
+	"GET /project/{slug}/upload":                           "user",
+	"POST /project/{slug}/upload":                          "user",
+	"POST /project/{slug}/version/{tag}/delete":            "user",
+	"POST /project/{slug}/version/{tag}/pin":               "user",
+	"POST /project/{slug}/version/{tag}/protect":           "user",
+	"POST /project/{slug}/version/{tag}/lifecycle":         "user",
+	"POST /project/{slug}/version/{tag}/rename":            "user",
+	"POST /project/{slug}/unpin":                           "user",
+	"GET /project/{slug}/version/{tag}/download":           "session",
+	"GET /project/{slug}/version/{tag}/offline.json":       "session",
+	"GET /project/{slug}/version/{tag}/attachments/{kind}": "session",
+	"GET /project/{slug}/version/{tag}/accessibility":      "session",
+	"GET /project/{slug}/version/{tag}/links":              "session",
+	"GET /project/{slug}/version/{tag}/thumbnail.png":      "session",
+	"GET /project/{slug}/version/{tag}/export/{format}":    "session",
+
+	// Project token management (for editors)
+	"GET /project/{slug}/tokens":                "user",
+	"POST /project/{slug}/tokens":               "user",
+	"POST /project/{slug}/tokens/{id}/revoke":   "user",
+	"GET /project/{slug}/redirects":             "user",
+	"POST /project/{slug}/redirects":            "user",
+	"GET /project/{slug}/feedback":              "user",
+	"POST /project/{slug}/feedback":             "session",
+	"POST /project/{slug}/feedback/{id}/delete": "user",
+	"GET /project/{slug}/analytics":             "user",
+
+	// Search
+	"GET /search":             "session",
+	"GET /api/search":         "api:read",
+	"GET /api/search/suggest": "api:read",
+
+	// API endpoints
+	"GET /api/projects":                 "api:read",
+	"GET /api/events":                   "api:read",
+	"GET /api/history":                  "api:read",
+	"GET /api/project/{slug}/analytics": "api:read",
+
+	// Backstage TechDocs compatible API
+	"GET /api/techdocs/static/docs/{namespace}/{kind}/{name}/{path...}": "api:read",
+	"GET /api/techdocs/metadata/techdocs/{namespace}/{kind}/{name}":     "api:read",
+	"GET /api/techdocs/metadata/entity/{namespace}/{kind}/{name}":       "api:read",
+	"GET /api/techdocs/sync/{namespace}/{kind}/{name}":                  "api:read",
+	"POST /api/projects":                                       "token:upload",
+	"GET /api/search-index/export":                             "token:admin:project",
+	"GET /api/admin/reindex/status":                            "api-admin:admin:project",
+	"GET /api/admin/backup":                                    "api-admin:admin:project",
+	"GET /api/admin/storage":                                   "api-admin:admin:project",
+	"POST /api/admin/reindex":                                  "api-admin:admin:project",
+	"POST /api/admin/reindex/projects/{slug}":                  "api-admin:admin:project",
+	"POST /api/admin/reindex/projects/{slug}/versions/{tag}":   "api-admin:admin:project",
+	"GET /api/admin/users":                                     "api-admin:admin:project",
+	"GET /api/admin/users/{username}":                          "api-admin:admin:project",
+	"PUT /api/admin/users/{username}":                          "api-admin:admin:project",
+	"DELETE /api/admin/users/{username}":                       "api-admin:admin:project",
+	"POST /api/admin/users/{username}/tokens":                  "api-admin:admin:project",
+	"GET /api/admin/projects/{slug}/access":                    "api-admin:admin:project",
+	"PUT /api/admin/projects/{slug}/access":                    "api-admin:admin:project",
+	"GET /api/project/{slug}/versions":                         "api:read",
+	"GET /api/project/{slug}/version/{tag}":                    "api:read",
+	"DELETE /api/project/{slug}/version/{tag}":                 "token:delete",
+	"GET /api/project/{slug}/version/{tag}/download.zip":       "api:read",
+	"GET /api/project/{slug}/version/{tag}/manifest":           "api:read",
+	"GET /api/project/{slug}/version/{tag}/attachments/{kind}": "api:read",
+	"GET /api/project/{slug}/version/{tag}/accessibility":      "api:read",
+	"GET /api/project/{slug}/version/{tag}/links":              "api:read",
+	"PUT /api/project/{slug}/version/{tag}/protected":          "token:upload",
+	"PUT /api/project/{slug}/version/{tag}/lifecycle":          "token:upload",
+	"POST /api/project/{slug}/version/{tag}/rename":            "token:upload",
+	"GET /api/project/{slug}/version/{tag}/metadata":           "api:read",
+	"PUT /api/project/{slug}/version/{tag}/metadata":           "token:upload",
+	"GET /api/project/{slug}/metadata":                         "api:read",
+	"PUT /api/project/{slug}/metadata":                         "token:admin:project",
+	"GET /api/project/{slug}/tags":                             "api:read",
+	"PUT /api/project/{slug}/tags":                             "token:admin:project",
+	"GET /api/project/{slug}/translations":                     "api:read",
+	"PUT /api/project/{slug}/translations":                     "token:admin:project",
+	"POST /api/project/{slug}/upload":                          "token:upload",
+	"POST /api/upload":                                         "token:upload",
+	"GET /api/project/{slug}/previews":                         "api:read",
+	"POST /api/project/{slug}/preview/{id}/upload":             "token:upload",
+	"DELETE /api/project/{slug}/preview/{id}":                  "token:upload",
+
+	// Declarative API (create-or-update by natural key)
+	"GET /api/project/{slug}":                                       "api:read",
+	"PUT /api/project/{slug}":                                       "token:admin:project",
+	"DELETE /api/project/{slug}":                                    "token:admin:project",
+	"GET /api/project/{slug}/access/{username}":                     "token:admin:project",
+	"PUT /api/project/{slug}/access/{username}":                     "token:admin:project",
+	"DELETE /api/project/{slug}/access/{username}":                  "token:admin:project",
+	"GET /api/project/{slug}/group-mappings/{source}/{group...}":    "token:admin:project",
+	"PUT /api/project/{slug}/group-mappings/{source}/{group...}":    "token:admin:project",
+	"DELETE /api/project/{slug}/group-mappings/{source}/{group...}": "token:admin:project",
+
+	// SCIM provisioning by identity providers
+	"GET /scim/v2/ServiceProviderConfig": "api-admin:scim",
+	"GET /scim/v2/Users":                 "api-admin:scim",
+	"POST /scim/v2/Users":                "api-admin:scim",
+	"GET /scim/v2/Users/{id}":            "api-admin:scim",
+	"PUT /scim/v2/Users/{id}":            "api-admin:scim",
+	"PATCH /scim/v2/Users/{id}":          "api-admin:scim",
+	"DELETE /scim/v2/Users/{id}":         "api-admin:scim",
+	"GET /scim/v2/Groups":                "api-admin:scim",
+	"POST /scim/v2/Groups":               "api-admin:scim",
+	"GET /scim/v2/Groups/{id}":           "api-admin:scim",
+	"PUT /scim/v2/Groups/{id}":           "api-admin:scim",
+	"PATCH /scim/v2/Groups/{id}":         "api-admin:scim",
+	"DELETE /scim/v2/Groups/{id}":        "api-admin:scim",
+
+	// Profile routes
+	"GET /profile":                         "user",
+	"POST /profile/password":               "user",
+	"POST /profile/theme":                  "user",
+	"POST /profile/history/clear":          "user",
+	"POST /profile/feed-token":             "user",
+	"POST /profile/digest":                 "user",
+	"POST /profile/sessions/{id}/revoke":   "user",
+	"POST /profile/sessions/revoke-others": "user",
+
+	// Admin routes (project list + create accessible to editors)
+	"GET /admin/projects":                         "editor",
+	"POST /admin/projects":                        "editor",
+	"GET /admin/projects/{slug}/edit":             "admin",
+	"POST /admin/projects/{slug}/edit":            "admin",
+	"POST /admin/projects/{slug}/delete":          "admin",
+	"POST /admin/projects/{slug}/access/grant":    "admin",
+	"POST /admin/projects/{slug}/access/revoke":   "admin",
+	"GET /admin/users":                            "admin",
+	"POST /admin/users":                           "admin",
+	"POST /admin/users/{id}/delete":               "admin",
+	"POST /admin/users/{id}/role":                 "admin",
+	"POST /admin/users/{id}/password":             "admin",
+	"GET /admin/robots":                           "admin",
+	"POST /admin/robots":                          "admin",
+	"POST /admin/robots/{id}/tokens":              "admin",
+	"POST /admin/robots/{id}/tokens/{tid}/revoke": "admin",
+	"POST /admin/robots/{id}/delete":              "admin",
+	"GET /admin/api-keys":                         "admin",
+	"POST /admin/api-keys":                        "admin",
+	"POST /admin/api-keys/{id}/delete":            "admin",
+	"GET /admin/tokens/rotation":                  "admin",
+	"GET /admin/tokens/rotation.csv":              "admin",
+	"POST /admin/tokens/rotation":                 "admin",
+	"POST /admin/reindex":                         "admin",
+	"POST /admin/projects/{slug}/reindex":         "admin",
+	"GET /admin/search-index/export":              "admin",
+	"GET /admin/groups":                           "admin",
+	"POST /admin/groups":                          "admin",
+	"POST /admin/groups/{id}/delete":              "admin",
+	"POST /admin/groups/ldap-sync":                "admin",
+	"GET /admin/sessions":                         "admin",
+	"POST /admin/sessions/{id}/revoke":            "admin",
+	"GET /admin/global-access":                    "admin",
+	"POST /admin/global-access":                   "admin",
+	"POST /admin/global-access/{id}/delete":       "admin",
+	"POST /admin/deploy-docs":                     "admin",
+	"GET /admin/maintenance":                      "admin",
+	"POST /admin/maintenance/{task}/run":          "admin",
+	"POST /admin/features/{name}":                 "admin",
+	"GET /admin/loadtest/k6.js":                   "admin",
+
+	// Health check, also at the root when routes are prefixed, see RegisterRoutes
+	"GET /healthz": "public",
+	"GET /readyz":  "public"}
+
+func TestRoutePolicies(t *testing.T) {
+	app := setupTestApp(t)
+
+	seen := make(map[string]bool)
+	for _, rt := range app.handler.routes() {
+		if seen[rt.pattern] {
+			t.Errorf("%s: registered twice", rt.pattern)
+		}
+		seen[rt.pattern] = true
+		want, ok := routePolicies[rt.pattern]
+		switch {
+		case rt.policy.access == accessUnset:
+			t.Errorf("%s: no authorization policy", rt.pattern)
+		case !ok:
+			t.Errorf("%s: missing from routePolicies, add it with its policy %q", rt.pattern, rt.policy)
+		case rt.policy.String() != want:
+			t.Errorf("%s: expected policy %q, got %q", rt.pattern, want, rt.policy)
+		}
+	}
+	for pattern := range routePolicies {
+		if !seen[pattern] {
+			t.Errorf("%s: listed in routePolicies but not registered", pattern)
+		}
+	}
+}
+
+func TestRoutePoliciesEnforced(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "p", "Private", false)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+	hash, _ := auth.HashPassword("viewer123")
+	app.handler.users.Create(context.Background(), &database.User{Username: "viewer", Password: &hash, AuthSource: "builtin", Role: "viewer"})
+	viewer := loginUser(t, app, "viewer", "viewer123")
+
+	params := strings.NewReplacer(
+		"{$}", "", "{slug}", "p", "{version}", "1.0.0", "{tag}", "1.0.0", "{path...}", "index.html",
+		"{kind}", "pdf", "{format}", "html", "{id}", "1", "{tid}", "1", "{username}", "viewer",
+		"{source}", "ldap", "{group...}", "devs", "{namespace}", "default", "{name}", "p", "{task}", "backup",
+	)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	request := func(method, path string, cookies []*http.Cookie) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, app.server.URL+path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for _, rt := range app.handler.routes() {
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		path = params.Replace(path)
+		switch rt.policy.access {
+		case accessUser, accessEditor, accessAdmin:
+			if resp := request(method, path, nil); resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/login" {
+				t.Errorf("%s: expected anonymous requests to be redirected to the login page, got %d", rt.pattern, resp.StatusCode)
+			}
+		case accessAPIAdmin, accessToken:
+			if resp := request(method, path, nil); resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("%s: expected 401 for anonymous requests, got %d", rt.pattern, resp.StatusCode)
+			}
+		}
+		switch rt.policy.access {
+		case accessEditor, accessAdmin, accessAPIAdmin:
+			if resp := request(method, path, viewer); resp.StatusCode != http.StatusForbidden {
+				t.Errorf("%s: expected 403 for viewers, got %d", rt.pattern, resp.StatusCode)
+			}
+		}
+	}
+}
+
+func TestRoutePoliciesProjectTokens(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "p", "Private", false)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+
+	token := func(projectID *int64, scopes string) string {
+		raw, _ := auth.GenerateToken(32)
+		app.handler.tokens.Create(ctx, &database.APIToken{UserID: admin.ID, ProjectID: projectID, TokenHash: auth.HashToken(raw), Name: scopes, Scopes: scopes})
+		return raw
+	}
+	projectToken := token(&project.ID, "upload,delete,read,admin:project")
+	adminToken := token(nil, "admin:project")
+
+	params := strings.NewReplacer(
+		"{slug}", "p", "{tag}", "1.0.0", "{path...}", "index.html", "{kind}", "pdf", "{id}", "1",
+		"{username}", "admin", "{source}", "ldap", "{group...}", "devs", "{namespace}", "default", "{name}", "p",
+	)
+	request := func(method, path, token string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, app.server.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, rt := range app.handler.routes() {
+		switch rt.policy.access {
+		case accessAPI, accessAPIAdmin, accessToken:
+		default:
+			continue
+		}
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		// Uploads to /api/upload name their project in the form
+		if !strings.Contains(path, "{slug}") && rt.pattern != "POST /api/upload" {
+			if status := request(method, params.Replace(path), projectToken); status != http.StatusUnauthorized {
+				t.Errorf("%s: expected 401 for a project token on a route without a project, got %d", rt.pattern, status)
+			}
+		}
+		if rt.policy.scope == auth.ScopeSCIM {
+			if status := request(method, params.Replace(path), adminToken); status != http.StatusForbidden {
+				t.Errorf("%s: expected 403 for an admin:project token, got %d", rt.pattern, status)
+			}
+		}
+	}
+
+	if status := request("GET", "/api/projects", adminToken); status != http.StatusOK {
+		t.Errorf("expected admin:project to imply read, got %d", status)
+	}
+	if status := request("GET", "/api/project/p/versions", projectToken); status != http.StatusOK {
+		t.Errorf("expected the project token to read its project, got %d", status)
+	}
+}
@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+	"github.com/qwc/asiakirjat/internal/hooks"
+)
+
+// previewNamePattern matches preview names such as a pull request number
+// or "pr-123".
+var previewNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// previewJSON is a preview as returned by the API.
+type previewJSON struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	UploadedBy  string `json:"uploaded_by"`
+	CreatedAt   string `json:"created_at"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+func (h *Handler) newPreviewJSON(r *http.Request, slug string, p *database.Preview, uploadedBy string) previewJSON {
+	return previewJSON{
+		Name:        p.Name,
+		URL:         h.publicURL(r) + "/project/" + slug + "/preview/" + p.Name + "/",
+		ContentType: p.ContentType,
+		UploadedBy:  uploadedBy,
+		CreatedAt:   p.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+		ExpiresAt:   p.ExpiresAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+// previewExpiry returns when a preview uploaded now expires.
+func (h *Handler) previewExpiry(now time.Time) time.Time {
+	days := h.config.Retention.PreviewDays
+	if days <= 0 {
+		days = 14
+	}
+	return now.AddDate(0, 0, days)
+}
+
+// handleAPIUploadPreview stores documentation as a preview of the project,
+// replacing an earlier upload under the same name. Previews are served
+// like versions but are not indexed, listed apart from versions and
+// deleted when they expire.
+func (h *Handler) handleAPIUploadPreview(w http.ResponseWriter, r *http.Request) {
+	done, ok := h.startUpload(w, true)
+	if !ok {
+		return
+	}
+	defer done()
+	ctx := r.Context()
+	slug := r.PathValue("slug")
+	name := r.PathValue("id")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	user := h.authenticateToken(w, r, project.ID, auth.ScopeUpload)
+	if user == nil {
+		return
+	}
+	if !h.canUpload(ctx, user, project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !previewNamePattern.MatchString(name) {
+		h.jsonError(w, "Invalid preview name: use up to 64 letters, digits, dots, dashes and underscores", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.parseUploadForm(w, r); err != nil {
+		h.jsonError(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	file, header, err := r.FormFile("archive")
+	if err != nil {
+		h.jsonError(w, "File is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// The files are unpacked next to the preview and swapped in when
+	// complete, so the previous upload is served until then.
+	destPath := h.storage.PreviewPath(slug, name)
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		h.logger.ErrorContext(ctx, "creating preview directory", "error", err)
+		h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	tmpPath, err := os.MkdirTemp(filepath.Dir(destPath), "."+name+"-")
+	if err != nil {
+		h.logger.ErrorContext(ctx, "creating preview directory", "error", err)
+		h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmpPath)
+
+	contentType := "archive"
+	if strings.HasSuffix(strings.ToLower(header.Filename), ".pdf") {
+		contentType = "pdf"
+		if _, err := storePDF(file, tmpPath); err != nil {
+			h.jsonError(w, "Failed to store PDF: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if err := docs.ExtractArchiveWithOptions(file, header.Filename, tmpPath, h.extractOptions(project)); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, docs.ErrExtractLimit) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		h.jsonError(w, "Failed to extract archive: "+err.Error(), status)
+		return
+	}
+
+	if reason := h.checkUpload(ctx, hooks.Event{Project: slug, Version: name, User: user.Username, Dir: tmpPath, Filename: header.Filename}); reason != "" {
+		h.jsonError(w, reason, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := h.storage.DeletePreview(slug, name); err != nil {
+		h.logger.ErrorContext(ctx, "replacing preview", "error", err, "project", slug, "preview", name)
+		h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		h.logger.ErrorContext(ctx, "storing preview", "error", err, "project", slug, "preview", name)
+		h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	preview, err := h.previews.Get(ctx, project.ID, name)
+	if err == nil {
+		preview.ContentType = contentType
+		preview.UploadedBy = user.ID
+		preview.CreatedAt = now
+		preview.ExpiresAt = h.previewExpiry(now)
+		err = h.previews.Update(ctx, preview)
+	} else {
+		preview = &database.Preview{
+			ProjectID:   project.ID,
+			Name:        name,
+			ContentType: contentType,
+			UploadedBy:  user.ID,
+			CreatedAt:   now,
+			ExpiresAt:   h.previewExpiry(now),
+		}
+		err = h.previews.Create(ctx, preview)
+	}
+	if err != nil {
+		h.logger.ErrorContext(ctx, "recording preview", "error", err, "project", slug, "preview", name)
+		h.jsonError(w, "Failed to record preview", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.InfoContext(ctx, "preview uploaded", "project", slug, "preview", name, "user", user.Username)
+	h.jsonResponse(w, h.newPreviewJSON(r, slug, preview, user.Username))
+}
+
+// handleAPIListPreviews lists the previews of a project, latest first.
+func (h *Handler) handleAPIListPreviews(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	previews, err := h.projectPreviews(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing previews", "error", err)
+		h.jsonError(w, "Failed to list previews", http.StatusInternalServerError)
+		return
+	}
+	result := make([]previewJSON, 0, len(previews))
+	for _, p := range previews {
+		result = append(result, h.newPreviewJSON(r, slug, &p.Preview, p.UploadedBy))
+	}
+	h.jsonResponse(w, result)
+}
+
+// handleAPIDeletePreview deletes a preview, for CI to clean up when a pull
+// request is closed.
+func (h *Handler) handleAPIDeletePreview(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	user := h.authenticateToken(w, r, project.ID, auth.ScopeUpload)
+	if user == nil {
+		return
+	}
+	if !h.canUpload(ctx, user, project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	preview, err := h.previews.Get(ctx, project.ID, r.PathValue("id"))
+	if err != nil {
+		h.jsonError(w, "Preview not found", http.StatusNotFound)
+		return
+	}
+	if err := h.deletePreview(ctx, slug, preview); err != nil {
+		h.logger.ErrorContext(ctx, "deleting preview", "error", err, "project", slug, "preview", preview.Name)
+		h.jsonError(w, "Failed to delete preview", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) deletePreview(ctx context.Context, slug string, preview *database.Preview) error {
+	if err := h.previews.Delete(ctx, preview.ID); err != nil {
+		return err
+	}
+	return h.storage.DeletePreview(slug, preview.Name)
+}
+
+// previewView is a preview with the name of its uploader.
+type previewView struct {
+	database.Preview
+	UploadedBy string
+}
+
+// projectPreviews returns the unexpired previews of a project.
+func (h *Handler) projectPreviews(ctx context.Context, projectID int64) ([]previewView, error) {
+	previews, err := h.previews.ListByProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var result []previewView
+	for _, p := range previews {
+		if p.ExpiresAt.Before(now) {
+			continue
+		}
+		view := previewView{Preview: p}
+		if uploader, err := h.users.GetByID(ctx, p.UploadedBy); err == nil {
+			view.UploadedBy = uploader.Username
+		}
+		result = append(result, view)
+	}
+	return result, nil
+}
+
+// handleServePreview serves the files of a preview to the users who may
+// view the project. Previews are kept out of search engines.
+func (h *Handler) handleServePreview(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canViewProject(ctx, user, project) {
+		if user == nil {
+			h.redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	preview, err := h.previews.Get(ctx, project.ID, r.PathValue("id"))
+	if err != nil || preview.ExpiresAt.Before(time.Now()) {
+		http.Error(w, "Preview not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("X-Robots-Tag", "noindex")
+	dir := h.storage.PreviewPath(slug, preview.Name)
+	if preview.ContentType == "pdf" {
+		http.ServeFile(w, r, filepath.Join(dir, "document.pdf"))
+		return
+	}
+	opts := h.docServeOptions(project, "")
+	opts.Policy.Private = true
+	docs.ServeDocWithOptions(w, r, dir, r.PathValue("path"), opts)
+}
+
+// runPreviewCleanup deletes the previews that expired.
+func (h *Handler) runPreviewCleanup(ctx context.Context) error {
+	expired, err := h.previews.ListExpired(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	slugs := make(map[int64]string)
+	for _, p := range expired {
+		slug, ok := slugs[p.ProjectID]
+		if !ok {
+			project, err := h.projects.GetByID(ctx, p.ProjectID)
+			if err != nil {
+				return err
+			}
+			slug = project.Slug
+			slugs[p.ProjectID] = slug
+		}
+		if err := h.deletePreview(ctx, slug, &p); err != nil {
+			return err
+		}
+		h.logger.InfoContext(ctx, "deleted expired preview", "project", slug, "preview", p.Name)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestPreviewLifecycle(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := uploadTokenForProject(t, app, "guide")
+	project, _ := app.handler.projects.GetBySlug(ctx, "guide")
+	project.Visibility = database.VisibilityPublic
+	app.handler.projects.Update(ctx, project)
+
+	upload := func(name, content string) (previewJSON, int) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, _ := writer.CreateFormFile("archive", "docs.zip")
+		part.Write(createTestZip(t, map[string]string{"index.html": content}).Bytes())
+		writer.Close()
+		req, _ := http.NewRequest("POST", app.server.URL+"/api/project/guide/preview/"+name+"/upload", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var preview previewJSON
+		json.NewDecoder(resp.Body).Decode(&preview)
+		return preview, resp.StatusCode
+	}
+	page := func() (string, int) {
+		resp, err := http.Get(app.server.URL + "/project/guide/preview/pr-42/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return string(data), resp.StatusCode
+	}
+
+	preview, code := upload("pr-42", "first")
+	if code != http.StatusOK || preview.Name != "pr-42" || preview.UploadedBy != "limits-bot" {
+		t.Fatalf("expected the preview to be stored, got %d %+v", code, preview)
+	}
+	if body, code := page(); code != http.StatusOK || body != "first" {
+		t.Errorf("expected the preview to be served, got %d %q", code, body)
+	}
+	if _, code := upload("../etc", "bad"); code == http.StatusOK {
+		t.Error("expected an invalid preview name to be refused")
+	}
+
+	if _, code := upload("pr-42", "second"); code != http.StatusOK {
+		t.Fatalf("expected a re-upload to succeed, got %d", code)
+	}
+	if body, _ := page(); body != "second" {
+		t.Errorf("expected the re-upload to replace the preview, got %q", body)
+	}
+
+	if versions, _ := app.handler.versions.ListByProject(ctx, project.ID); len(versions) != 0 {
+		t.Errorf("expected previews not to be versions, got %+v", versions)
+	}
+	resp := apiRequest(t, app, "GET", "/api/project/guide/previews", token, "", nil)
+	var previews []previewJSON
+	json.NewDecoder(resp.Body).Decode(&previews)
+	resp.Body.Close()
+	if len(previews) != 1 || previews[0].Name != "pr-42" {
+		t.Errorf("expected pr-42 listed, got %+v", previews)
+	}
+
+	upload("pr-43", "other")
+	stored, _ := app.handler.previews.Get(ctx, project.ID, "pr-42")
+	stored.ExpiresAt = time.Now().Add(-time.Minute)
+	app.handler.previews.Update(ctx, stored)
+	if _, code := page(); code != http.StatusNotFound {
+		t.Errorf("expected an expired preview to be gone, got %d", code)
+	}
+	if err := app.handler.runPreviewCleanup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(app.handler.storage.PreviewPath("guide", "pr-42")); !os.IsNotExist(err) {
+		t.Error("expected the files of the expired preview to be deleted")
+	}
+
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		resp := apiRequest(t, app, "DELETE", "/api/project/guide/preview/pr-43", token, "", nil)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("expected %d, got %d", want, resp.StatusCode)
+		}
+	}
+}
@@ -2,17 +2,37 @@ package handler
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
 	"golang.org/x/crypto/bcrypt"
 )
 
 func (h *Handler) handleProfilePage(w http.ResponseWriter, r *http.Request) {
-	user := auth.UserFromContext(r.Context())
+	h.renderProfile(w, r, nil)
+}
 
-	h.render(w, "profile", map[string]any{
-		"User": user,
-	})
+// renderProfile renders the profile page of the user with data, such as
+// the Error or Success of a form.
+func (h *Handler) renderProfile(w http.ResponseWriter, r *http.Request, data map[string]any) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	if data == nil {
+		data = map[string]any{}
+	}
+	data["User"] = user
+	data["HistoryEnabled"] = h.config.History.Enabled
+	data["Watching"] = h.watchedProjects(ctx, user)
+	if h.watchChannelAvailable(database.WatchDigest) {
+		if digest, err := h.watchDigest(ctx, user.ID, time.Now()); err == nil {
+			data["DigestFrequency"] = digest.Frequency
+		} else {
+			h.logger.ErrorContext(ctx, "getting watch digest", "error", err)
+		}
+	}
+	data["Sessions"] = h.userSessions(r, user)
+	h.render(w, "profile", data)
 }
 
 func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
@@ -20,8 +40,7 @@ func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 	user := auth.UserFromContext(ctx)
 
 	if user.AuthSource != "builtin" {
-		h.render(w, "profile", map[string]any{
-			"User":  user,
+		h.renderProfile(w, r, map[string]any{
 			"Error": "Password is managed by an external provider",
 		})
 		return
@@ -32,32 +51,28 @@ func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 	confirmPassword := r.FormValue("confirm_password")
 
 	if currentPassword == "" || newPassword == "" || confirmPassword == "" {
-		h.render(w, "profile", map[string]any{
-			"User":  user,
+		h.renderProfile(w, r, map[string]any{
 			"Error": "All password fields are required",
 		})
 		return
 	}
 
 	if newPassword != confirmPassword {
-		h.render(w, "profile", map[string]any{
-			"User":  user,
+		h.renderProfile(w, r, map[string]any{
 			"Error": "New passwords do not match",
 		})
 		return
 	}
 
 	if user.Password == nil {
-		h.render(w, "profile", map[string]any{
-			"User":  user,
+		h.renderProfile(w, r, map[string]any{
 			"Error": "Account has no password set",
 		})
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(*user.Password), []byte(currentPassword)); err != nil {
-		h.render(w, "profile", map[string]any{
-			"User":  user,
+		h.renderProfile(w, r, map[string]any{
 			"Error": "Current password is incorrect",
 		})
 		return
@@ -65,20 +80,78 @@ func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 
 	hash, err := auth.HashPassword(newPassword)
 	if err != nil {
-		h.logger.Error("hashing password", "error", err)
+		h.logger.ErrorContext(ctx, "hashing password", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	user.Password = &hash
 	if err := h.users.Update(ctx, user); err != nil {
-		h.logger.Error("updating password", "error", err)
+		h.logger.ErrorContext(ctx, "updating password", "error", err)
 		http.Error(w, "Failed to update password", http.StatusInternalServerError)
 		return
 	}
+	// Log out the other sessions, which may be someone who knew the old
+	// password, and start a new one here
+	remember := h.sessionMgr.Remembered(r)
+	if err := h.sessions.DeleteByUser(ctx, user.ID); err != nil {
+		h.logger.ErrorContext(ctx, "deleting sessions", "error", err)
+	}
+	if err := h.sessionMgr.CreateSession(w, r, user.ID, remember); err != nil {
+		h.logger.ErrorContext(ctx, "creating session", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 
-	h.render(w, "profile", map[string]any{
-		"User":    user,
+	h.renderProfile(w, r, map[string]any{
 		"Success": "Password changed successfully",
 	})
 }
+
+// themeCookie remembers the theme of a reader in the browser, for readers
+// who are not logged in and for the doc overlay, which follows it.
+const themeCookie = "asiakirjat_theme"
+
+// handleSetTheme saves the theme of the user and remembers it in the
+// browser.
+func (h *Handler) handleSetTheme(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	theme := r.FormValue("theme")
+	switch theme {
+	case database.ThemeSystem, database.ThemeLight, database.ThemeDark:
+	default:
+		h.renderProfile(w, r, map[string]any{
+			"Error": "Invalid theme: must be light, dark, or empty to follow the system",
+		})
+		return
+	}
+
+	user.Theme = theme
+	if err := h.users.Update(ctx, user); err != nil {
+		h.logger.ErrorContext(ctx, "updating theme", "error", err)
+		http.Error(w, "Failed to save theme", http.StatusInternalServerError)
+		return
+	}
+
+	cookiePath := h.config.Server.BasePath
+	if cookiePath == "" {
+		cookiePath = "/"
+	}
+	cookie := &http.Cookie{
+		Name:     themeCookie,
+		Value:    theme,
+		Path:     cookiePath,
+		MaxAge:   365 * 24 * 60 * 60,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if theme == database.ThemeSystem {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+
+	h.renderProfile(w, r, map[string]any{
+		"Success": "Theme saved",
+	})
+}
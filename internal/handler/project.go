@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"context"
 	"fmt"
+	"html/template"
 	"net/http"
+	"os"
 	"path/filepath"
 	"strconv"
 
@@ -17,6 +20,23 @@ type versionViewData struct {
 	CreatedAt   interface{ Format(string) string }
 	ProjectSlug string
 	IsPDF       bool
+	Export      bool // a single HTML export can be downloaded
+	ExportPDF   bool // a PDF export can be downloaded
+
+	Signed       bool
+	SignatureKey string
+	Attachments  []string // attachment kinds, e.g. "provenance", "sbom"
+	Protected    bool
+	Metadata     map[string]string
+	ReleaseNotes string // Markdown
+
+	Lifecycle        string
+	LifecycleMessage string
+
+	// Accessibility is the version's accessibility report, if it was checked
+	Accessibility *docs.AccessibilityReport
+	// Links is the version's link check report, if it was checked
+	Links *docs.LinkReport
 }
 
 func (h *Handler) handleProjectDetail(w http.ResponseWriter, r *http.Request) {
@@ -40,33 +60,27 @@ func (h *Handler) handleProjectDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	versions, err := h.versions.ListByProject(ctx, project.ID)
+	// Read the generation first, so that a version list rendered from
+	// older data is never cached under a newer generation.
+	generation := h.versionsGeneration(project.ID)
+	versions, err := h.sortedVersions(ctx, project.ID)
 	if err != nil {
-		h.logger.Error("listing versions", "error", err)
+		h.logger.ErrorContext(ctx, "listing versions", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-
-	// Sort versions by semver descending
 	tags := make([]string, len(versions))
-	versionMap := make(map[string]int)
 	for i, v := range versions {
 		tags[i] = v.Tag
-		versionMap[v.Tag] = i
 	}
-	docs.SortVersionTags(tags)
 
-	var versionViews []versionViewData
-	bp := h.config.Server.BasePath
-	for _, tag := range tags {
-		v := versions[versionMap[tag]]
-		versionViews = append(versionViews, versionViewData{
-			Tag:         v.Tag,
-			URL:         bp + "/project/" + slug + "/" + v.Tag + "/",
-			CreatedAt:   v.CreatedAt,
-			ProjectSlug: slug,
-			IsPDF:       v.ContentType == "pdf",
-		})
+	projectMeta, err := h.metadata.GetProject(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading project metadata", "error", err)
+	}
+	projectTags, err := h.tags.Get(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading project tags", "error", err)
 	}
 
 	canUpload := false
@@ -105,10 +119,35 @@ func (h *Handler) handleProjectDetail(w http.ResponseWriter, r *http.Request) {
 	}
 	baseURL := scheme + "://" + r.Host
 
+	// The version list only changes with the versions and what the user
+	// may do with them, so it is rendered once per generation.
+	pinned := ""
+	if project.PinnedVersion != nil {
+		pinned = *project.PinnedVersion
+	}
+	export := h.featureEnabled(ctx, featureExport, project)
+	listKey := fmt.Sprintf("%d/%s/%s/%t/%q/%t/%q/%t", project.ID, slug, generation, canUpload, pinned, project.PinPermanent, effectiveLatest, export)
+	versionList, err := h.templates.RenderFragment("version_list", listKey, func() any {
+		return map[string]any{
+			"Versions":        h.versionViews(ctx, project, versions),
+			"CanUpload":       canUpload,
+			"CanDelete":       canUpload,
+			"PinnedVersion":   project.PinnedVersion,
+			"PinPermanent":    project.PinPermanent,
+			"EffectiveLatest": effectiveLatest,
+		}
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "rendering version list", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	localized := h.localizeProject(w, r, project)
 	data := map[string]any{
 		"User":            user,
-		"Project":         project,
-		"Versions":        versionViews,
+		"Project":         localized,
+		"VersionList":     versionList,
 		"CanUpload":       canUpload,
 		"CanDelete":       canUpload,
 		"BaseURL":         baseURL,
@@ -116,13 +155,87 @@ func (h *Handler) handleProjectDetail(w http.ResponseWriter, r *http.Request) {
 		"PinPermanent":    project.PinPermanent,
 		"LatestVersion":   latestVersion,
 		"EffectiveLatest": effectiveLatest,
+		"Metadata":        projectMeta,
+		"Tags":            projectTags,
+		"Lifecycle":       h.lifecycleBanner(project, nil),
+		"Maintainer":      projectMaintainer(project),
+		"Analytics":       h.analyticsEnabled(),
+		"Watch":           h.projectWatch(ctx, user, project),
+		"WatchEmail":      h.watchChannelAvailable(database.WatchEmail),
+		"WatchWebhook":    h.watchChannelAvailable(database.WatchWebhook),
+	}
+
+	data["HeadHTML"] = template.HTML(h.projectSearchLink(project.Slug, localized.Name) + h.projectFeedLink(project.Slug, localized.Name) + h.socialMeta(r, project, socialPreview{
+		SiteName:    h.siteName(),
+		Title:       localized.Name,
+		Description: localized.Description,
+		URL:         h.publicURL(r) + "/project/" + project.Slug,
+		Tag:         effectiveLatest,
+	}))
+
+	switch r.URL.Query().Get("msg") {
+	case "version_protected":
+		data["Flash"] = &Flash{
+			Type:    "warning",
+			Message: "Protected versions cannot be deleted or merged. Unprotect the version first.",
+		}
+	case "version_exists":
+		data["Flash"] = &Flash{
+			Type:    "warning",
+			Message: "A version with this tag already exists. Check \"Merge\" to merge the versions.",
+		}
+	case "version_tag_invalid":
+		data["Flash"] = &Flash{
+			Type:    "error",
+			Message: "The new tag does not follow the version tag rules of this project.",
+		}
+	case "version_renamed":
+		data["Flash"] = &Flash{
+			Type:    "success",
+			Message: "Version renamed. Links to the old tag redirect to the new one.",
+		}
+	case "watch_saved":
+		data["Flash"] = &Flash{
+			Type:    "success",
+			Message: "You now watch this project.",
+		}
+	case "watch_removed":
+		data["Flash"] = &Flash{
+			Type:    "success",
+			Message: "You no longer watch this project.",
+		}
+	case "watch_no_email":
+		data["Flash"] = &Flash{
+			Type:    "error",
+			Message: "Your account has no email address to send notifications to.",
+		}
+	case "watch_webhook_invalid":
+		data["Flash"] = &Flash{
+			Type:    "error",
+			Message: "The webhook URL must be an http or https URL.",
+		}
+	}
+
+	if previews, err := h.projectPreviews(ctx, project.ID); err != nil {
+		h.logger.ErrorContext(ctx, "listing previews", "error", err)
+	} else {
+		data["Previews"] = previews
+	}
+
+	if canUpload {
+		if usage, err := h.projectUsage(ctx, project); err != nil {
+			h.logger.ErrorContext(ctx, "getting storage usage", "error", err)
+		} else {
+			data["StorageUsage"] = usage
+			data["MaxUploadSize"] = docs.FormatSize(h.maxUploadSize(project))
+		}
 	}
 
 	// Fetch upload logs for editors/admins
 	if canUpload && h.uploadLogs != nil {
 		logs, err := h.uploadLogs.ListByProject(ctx, project.ID)
 		if err != nil {
-			h.logger.Error("listing upload logs", "error", err)
+			h.logger.ErrorContext(ctx, "listing upload logs", "error", err)
 		} else {
 			// Build user lookup
 			users, _ := h.users.List(ctx)
@@ -158,6 +271,47 @@ func (h *Handler) handleProjectDetail(w http.ResponseWriter, r *http.Request) {
 	h.render(w, "project_detail", data)
 }
 
+// versionViews describes the versions of a project for the version list.
+func (h *Handler) versionViews(ctx context.Context, project *database.Project, versions []database.Version) []versionViewData {
+	attachments := h.versionAttachments(ctx, project.ID)
+	versionMeta, err := h.metadata.ListVersionsByProject(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing version metadata", "error", err)
+	}
+
+	var views []versionViewData
+	bp := h.config.Server.BasePath
+	export := h.featureEnabled(ctx, featureExport, project)
+	for _, v := range versions {
+		view := versionViewData{
+			Tag:         v.Tag,
+			URL:         bp + "/project/" + project.Slug + "/" + v.Tag + "/",
+			CreatedAt:   v.CreatedAt,
+			ProjectSlug: project.Slug,
+			IsPDF:       v.ContentType == "pdf",
+			Export:      export && v.ContentType != "pdf",
+			ExportPDF:   export && v.ContentType != "pdf" && h.config.Export.PDFCommand != "",
+
+			Signed:       v.SignatureStatus == database.SignatureVerified,
+			SignatureKey: v.SignatureKey,
+			Protected:    v.Protected,
+			Metadata:     versionMeta[v.ID],
+			ReleaseNotes: v.ReleaseNotes,
+
+			Lifecycle:        v.Lifecycle,
+			LifecycleMessage: v.LifecycleMessage,
+
+			Accessibility: h.accessibilityReport(ctx, project.Slug, v.Tag),
+			Links:         h.linkReport(ctx, project.Slug, v.Tag),
+		}
+		for _, a := range attachments[v.ID] {
+			view.Attachments = append(view.Attachments, a.Kind)
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
 func (h *Handler) handleDeleteVersion(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user := auth.UserFromContext(ctx)
@@ -170,18 +324,7 @@ func (h *Handler) handleDeleteVersion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check editor access (same logic as canUpload)
-	canDelete := false
-	if user.Role == "admin" || user.Role == "editor" {
-		canDelete = true
-	} else {
-		access, err := h.access.GetAccess(ctx, project.ID, user.ID)
-		if err == nil && access != nil && (access.Role == "editor" || access.Role == "admin") {
-			canDelete = true
-		}
-	}
-
-	if !canDelete {
+	if !h.canDeleteVersions(ctx, user, project) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -192,32 +335,59 @@ func (h *Handler) handleDeleteVersion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete from database
-	if err := h.versions.Delete(ctx, version.ID); err != nil {
-		h.logger.Error("deleting version from database", "error", err)
+	if version.Protected {
+		h.redirect(w, r, "/project/"+slug+"?msg=version_protected", http.StatusSeeOther)
+		return
+	}
+
+	if err := h.deleteVersion(ctx, project, version, user); err != nil {
+		h.logger.ErrorContext(ctx, "deleting version from database", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	h.redirect(w, r, "/project/"+slug, http.StatusSeeOther)
+}
+
+// canDeleteVersions reports whether user may delete versions of project:
+// global editors and admins, and editors of the project.
+func (h *Handler) canDeleteVersions(ctx context.Context, user *database.User, project *database.Project) bool {
+	if user.Role == "admin" || user.Role == "editor" {
+		return true
+	}
+	access, err := h.access.GetAccess(ctx, project.ID, user.ID)
+	return err == nil && access != nil && (access.Role == "editor" || access.Role == "admin")
+}
+
+// deleteVersion deletes a version from the database, the filesystem and
+// the search index. Only the database error is returned; the files and
+// index entries left behind are logged.
+func (h *Handler) deleteVersion(ctx context.Context, project *database.Project, version *database.Version, user *database.User) error {
+	// Delete from database
+	if err := h.versions.Delete(ctx, version.ID); err != nil {
+		return err
+	}
 
 	// Delete from filesystem
-	if err := h.storage.DeleteVersion(slug, tag); err != nil {
-		h.logger.Error("deleting version from filesystem", "error", err)
+	if err := h.storage.DeleteVersion(project.Slug, version.Tag); err != nil {
+		h.logger.ErrorContext(ctx, "deleting version from filesystem", "error", err)
 		// Continue - database record is already deleted
 	}
 
 	// Delete from search index
 	if h.searchIndex != nil {
 		if err := h.searchIndex.DeleteVersion(project.ID, version.ID); err != nil {
-			h.logger.Error("deleting version from search index", "error", err)
+			h.logger.ErrorContext(ctx, "deleting version from search index", "error", err)
 			// Continue - not critical
 		}
 	}
 
-	// Invalidate latest tags cache
-	h.invalidateLatestTagsCache()
+	// Invalidate cached versions
+	h.invalidateVersions(project.ID)
 
-	h.logger.Info("version deleted", "project", slug, "version", tag, "user", user.Username)
-	h.redirect(w, r, "/project/"+slug, http.StatusSeeOther)
+	h.emitEvent(ctx, database.EventVersionDeleted, project.Slug, map[string]any{"version": version.Tag, "reason": "manual", "actor": user.Username})
+
+	h.logger.InfoContext(ctx, "version deleted", "project", project.Slug, "version", version.Tag, "user", user.Username)
+	return nil
 }
 
 func (h *Handler) handleDownloadVersion(w http.ResponseWriter, r *http.Request) {
@@ -243,6 +413,9 @@ func (h *Handler) handleDownloadVersion(w http.ResponseWriter, r *http.Request)
 
 	ver, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag)
 	if err != nil {
+		if h.redirectRenamedVersion(w, r, project, tag, "/project/"+slug+"/version/", "/download") {
+			return
+		}
 		http.Error(w, "Version not found", http.StatusNotFound)
 		return
 	}
@@ -260,6 +433,56 @@ func (h *Handler) handleDownloadVersion(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	h.streamVersionZip(w, slug, tag, versionPath)
+}
+
+// handleDownloadVersionZip exports a version as a zip archive at
+// /project/{slug}/{version}/download.zip. PDF versions are zipped too. A
+// download.zip shipped inside the documentation itself takes precedence.
+func (h *Handler) handleDownloadVersionZip(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canViewProject(ctx, user, project) {
+		if user == nil {
+			h.redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	ver, err := h.versions.GetByProjectAndTag(ctx, project.ID, r.PathValue("version"))
+	if err != nil {
+		if h.redirectRenamedVersion(w, r, project, r.PathValue("version"), "/project/"+slug+"/", "/download.zip") {
+			return
+		}
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	if !h.storage.VersionExists(slug, ver.Tag) {
+		http.Error(w, "Version files not found", http.StatusNotFound)
+		return
+	}
+
+	versionPath := h.storage.VersionPath(slug, ver.Tag)
+	if info, err := os.Stat(filepath.Join(versionPath, "download.zip")); err == nil && info.Mode().IsRegular() {
+		docs.ServeDoc(w, r, versionPath, "download.zip")
+		return
+	}
+	h.streamVersionZip(w, slug, ver.Tag, versionPath)
+}
+
+// streamVersionZip writes the stored version directory as a zip archive.
+// Errors after the first byte can only be logged.
+func (h *Handler) streamVersionZip(w http.ResponseWriter, slug, tag, versionPath string) {
 	w.Header().Set("Content-Type", "application/zip")
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.zip"`, slug, tag))
 
@@ -288,7 +511,7 @@ func (h *Handler) handleProjectTokens(w http.ResponseWriter, r *http.Request) {
 
 	tokens, err := h.tokens.ListByProject(ctx, project.ID)
 	if err != nil {
-		h.logger.Error("listing project tokens", "error", err)
+		h.logger.ErrorContext(ctx, "listing project tokens", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -317,6 +540,7 @@ func (h *Handler) handleProjectTokens(w http.ResponseWriter, r *http.Request) {
 		"User":    user,
 		"Project": project,
 		"Tokens":  tokenViews,
+		"Scopes":  auth.ProjectScopes,
 	})
 }
 
@@ -344,10 +568,16 @@ func (h *Handler) handleProjectCreateToken(w http.ResponseWriter, r *http.Reques
 		name = "default"
 	}
 
+	scopes, err := tokenScopesFromForm(r)
+	if err != nil {
+		http.Error(w, "Invalid scopes: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Generate raw token
 	rawToken, err := auth.GenerateToken(32)
 	if err != nil {
-		h.logger.Error("generating token", "error", err)
+		h.logger.ErrorContext(ctx, "generating token", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -361,11 +591,11 @@ func (h *Handler) handleProjectCreateToken(w http.ResponseWriter, r *http.Reques
 		ProjectID: &projectID,
 		TokenHash: tokenHash,
 		Name:      name,
-		Scopes:    "upload",
+		Scopes:    scopes,
 	}
 
 	if err := h.tokens.Create(ctx, token); err != nil {
-		h.logger.Error("creating token", "error", err)
+		h.logger.ErrorContext(ctx, "creating token", "error", err)
 		http.Error(w, "Failed to create token", http.StatusInternalServerError)
 		return
 	}
@@ -396,6 +626,7 @@ func (h *Handler) handleProjectCreateToken(w http.ResponseWriter, r *http.Reques
 		"User":     user,
 		"Project":  project,
 		"Tokens":   tokenViews,
+		"Scopes":   auth.ProjectScopes,
 		"NewToken": rawToken,
 	})
 }
@@ -436,7 +667,7 @@ func (h *Handler) handleProjectRevokeToken(w http.ResponseWriter, r *http.Reques
 	}
 
 	if err := h.tokens.Delete(ctx, tokenID); err != nil {
-		h.logger.Error("revoking token", "error", err)
+		h.logger.ErrorContext(ctx, "revoking token", "error", err)
 		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
 		return
 	}
@@ -473,13 +704,13 @@ func (h *Handler) handlePinVersion(w http.ResponseWriter, r *http.Request) {
 	project.PinPermanent = permanent
 
 	if err := h.projects.Update(ctx, project); err != nil {
-		h.logger.Error("pinning version", "error", err)
+		h.logger.ErrorContext(ctx, "pinning version", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	h.invalidateLatestTagsCache()
-	h.logger.Info("version pinned", "project", slug, "version", tag, "permanent", permanent, "user", user.Username)
+	h.logger.InfoContext(ctx, "version pinned", "project", slug, "version", tag, "permanent", permanent, "user", user.Username)
 	h.redirect(w, r, "/project/"+slug, http.StatusSeeOther)
 }
 
@@ -504,12 +735,12 @@ func (h *Handler) handleUnpinVersion(w http.ResponseWriter, r *http.Request) {
 	project.PinPermanent = false
 
 	if err := h.projects.Update(ctx, project); err != nil {
-		h.logger.Error("unpinning version", "error", err)
+		h.logger.ErrorContext(ctx, "unpinning version", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	h.invalidateLatestTagsCache()
-	h.logger.Info("version unpinned", "project", slug, "user", user.Username)
+	h.logger.InfoContext(ctx, "version unpinned", "project", slug, "user", user.Username)
 	h.redirect(w, r, "/project/"+slug, http.StatusSeeOther)
 }
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+)
+
+// handleProtectVersion sets or clears the protected flag of a version.
+// Protected versions are skipped by retention and cannot be deleted.
+func (h *Handler) handleProtectVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	slug := r.PathValue("slug")
+	tag := r.PathValue("tag")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canUpload(ctx, user, project) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag)
+	if err != nil {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	protected := r.FormValue("protected") == "true"
+	if err := h.versions.SetProtected(ctx, version.ID, protected); err != nil {
+		h.logger.ErrorContext(ctx, "setting version protection", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	h.invalidateVersions(project.ID)
+
+	h.logger.InfoContext(ctx, "version protection changed", "project", slug, "version", tag, "protected", protected, "user", user.Username)
+	h.redirect(w, r, "/project/"+slug, http.StatusSeeOther)
+}
+
+// handleAPIProtectVersion sets or clears the protected flag of a version
+// from a JSON body of the form {"protected": true}.
+func (h *Handler) handleAPIProtectVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	slug := r.PathValue("slug")
+	tag := r.PathValue("tag")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	user := h.authenticateToken(w, r, project.ID, auth.ScopeUpload)
+	if user == nil {
+		return
+	}
+
+	if !h.canUpload(ctx, user, project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag)
+	if err != nil {
+		h.jsonError(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Protected *bool `json:"protected"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Protected == nil {
+		h.jsonError(w, `Invalid JSON body: expected {"protected": true|false}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.versions.SetProtected(ctx, version.ID, *req.Protected); err != nil {
+		h.logger.ErrorContext(ctx, "setting version protection", "error", err)
+		h.jsonError(w, "Failed to update version", http.StatusInternalServerError)
+		return
+	}
+	h.invalidateVersions(project.ID)
+
+	h.logger.InfoContext(ctx, "version protection changed", "project", slug, "version", tag, "protected", *req.Protected, "user", user.Username)
+	h.jsonResponse(w, map[string]any{
+		"tag":       tag,
+		"protected": *req.Protected,
+	})
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetentionSkipsProtectedVersions(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	app.handler.config.Retention.NonSemverDays = 7
+
+	project := seedProject(t, app, "guarded", "Guarded", true)
+	seedAgedVersion(t, app, project, "release-candidate", 30*24*time.Hour)
+	seedAgedVersion(t, app, project, "feature-old", 30*24*time.Hour)
+
+	v, err := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "release-candidate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.handler.versions.SetProtected(ctx, v.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.handler.runRetentionCleanup(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tags := versionTags(t, app, project)
+	if !tags["release-candidate"] {
+		t.Error("expected protected version to survive retention")
+	}
+	if tags["feature-old"] {
+		t.Error("expected unprotected expired version to be deleted")
+	}
+}
+
+func TestProtectedVersionCannotBeDeleted(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	seedAdmin(t, app)
+	project := seedProject(t, app, "guarded", "Guarded", true)
+	seedAgedVersion(t, app, project, "v1.0.0", time.Hour)
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	post := func(path string, form url.Values) *http.Response {
+		req, _ := http.NewRequest("POST", app.server.URL+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := post("/project/guarded/version/v1.0.0/protect", url.Values{"protected": {"true"}})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected 303 after protecting, got %d", resp.StatusCode)
+	}
+
+	resp = post("/project/guarded/version/v1.0.0/delete", nil)
+	if loc := resp.Header.Get("Location"); !strings.Contains(loc, "msg=version_protected") {
+		t.Errorf("expected redirect with protection notice, got %q", loc)
+	}
+	if _, err := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "v1.0.0"); err != nil {
+		t.Fatal("protected version should not be deleted")
+	}
+
+	post("/project/guarded/version/v1.0.0/protect", url.Values{"protected": {"false"}})
+	post("/project/guarded/version/v1.0.0/delete", nil)
+	if _, err := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "v1.0.0"); err == nil {
+		t.Error("expected unprotected version to be deleted")
+	}
+}
+
+func TestAPIProtectVersion(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := uploadTokenForProject(t, app, "guarded")
+	project, _ := app.handler.projects.GetBySlug(ctx, "guarded")
+	seedAgedVersion(t, app, project, "v1.0.0", time.Hour)
+
+	put := func(body string) int {
+		req, _ := http.NewRequest("PUT", app.server.URL+"/api/project/guarded/version/v1.0.0/protected", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := put(`{"protected": true}`); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	v, _ := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "v1.0.0")
+	if !v.Protected {
+		t.Error("expected version to be protected")
+	}
+
+	if code := put(`{}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for missing flag, got %d", code)
+	}
+
+	if code := put(`{"protected": false}`); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	v, _ = app.handler.versions.GetByProjectAndTag(ctx, project.ID, "v1.0.0")
+	if v.Protected {
+		t.Error("expected version to be unprotected")
+	}
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/config"
+)
+
+func TestProxyAuthLogin(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.proxyAuth = auth.NewProxyAuthenticator(config.ProxyAuthConfig{
+		TrustedProxies: []string{"127.0.0.1", "::1"},
+		UserHeader:     "Remote-User",
+		GroupsHeader:   "Remote-Groups",
+		AdminGroup:     "admins",
+		LogoutURL:      "https://sso.example.com/logout",
+	}, app.handler.users, app.handler.logger)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	get := func(path, user, groups string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", app.server.URL+path, nil)
+		if user != "" {
+			req.Header.Set("Remote-User", user)
+			req.Header.Set("Remote-Groups", groups)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := get("/admin/users", "", ""); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("expected a redirect to login without the header, got %d", resp.StatusCode)
+	}
+	if resp := get("/admin/users", "carol", "admins"); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the proxy admin to see the admin page, got %d", resp.StatusCode)
+	}
+	if resp := get("/admin/users", "dave", "users"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected a proxy viewer to be forbidden, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", app.server.URL+"/logout", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if loc := resp.Header.Get("Location"); loc != "https://sso.example.com/logout" {
+		t.Errorf("expected logout to redirect to the proxy, got %q", loc)
+	}
+}
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/config"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// errQuotaExceeded is returned for uploads that would exceed a storage
+// quota.
+var errQuotaExceeded = errors.New("storage quota exceeded")
+
+// projectQuota returns the storage quota of a project in bytes, or 0 if it
+// has none.
+func (h *Handler) projectQuota(project *database.Project) int64 {
+	if project.StorageQuota != nil {
+		return *project.StorageQuota
+	}
+	return h.config.Storage.ProjectQuotaBytes()
+}
+
+// maxUploadSize returns the largest upload the project accepts: its own
+// limit, if lower than upload.max_size.
+func (h *Handler) maxUploadSize(project *database.Project) int64 {
+	limit := h.config.Upload.MaxSizeBytes()
+	if project.MaxUploadSize != nil && *project.MaxUploadSize > 0 && *project.MaxUploadSize < limit {
+		return *project.MaxUploadSize
+	}
+	return limit
+}
+
+// parseOptionalSize parses a size field of the project form, where empty
+// means the configured default and "0" none.
+func parseOptionalSize(s string) (*int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	n, err := config.ParseSize(s)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("negative size %q", s)
+	}
+	return &n, nil
+}
+
+// sizeInput formats a size for the project form the way parseOptionalSize
+// reads it.
+func sizeInput(n *int64) string {
+	if n == nil {
+		return ""
+	}
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if *n > 0 && *n%unit.factor == 0 {
+			return strconv.FormatInt(*n/unit.factor, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(*n, 10)
+}
+
+// checkUploadSize returns an error if an upload of size bytes is larger
+// than the project accepts.
+func (h *Handler) checkUploadSize(project *database.Project, size int64) error {
+	if limit := h.maxUploadSize(project); size > limit {
+		return fmt.Errorf("upload of %s is larger than the %s this project accepts", docs.FormatSize(size), docs.FormatSize(limit))
+	}
+	return nil
+}
+
+// checkQuota returns an error wrapping errQuotaExceeded if storing size
+// bytes as version tag of the project would exceed its quota or the global
+// one. The size of the version the upload replaces, if any, is not counted.
+func (h *Handler) checkQuota(ctx context.Context, project *database.Project, tag string, size int64) error {
+	projectQuota, globalQuota := h.projectQuota(project), h.config.Storage.QuotaBytes()
+	if projectQuota <= 0 && globalQuota <= 0 {
+		return nil
+	}
+	usage, err := h.versions.UsageByProject(ctx)
+	if err != nil {
+		return err
+	}
+	used, total := usage[project.ID], int64(0)
+	for _, n := range usage {
+		total += n
+	}
+	if existing, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag); err == nil {
+		used -= existing.SizeBytes
+		total -= existing.SizeBytes
+	}
+	if projectQuota > 0 && used+size > projectQuota {
+		return fmt.Errorf("%w: the project would use %s of its %s", errQuotaExceeded, docs.FormatSize(used+size), docs.FormatSize(projectQuota))
+	}
+	if globalQuota > 0 && total+size > globalQuota {
+		return fmt.Errorf("%w: all projects would use %s of %s", errQuotaExceeded, docs.FormatSize(total+size), docs.FormatSize(globalQuota))
+	}
+	return nil
+}
+
+// storageUsage describes how much of its quota a project uses.
+type storageUsage struct {
+	Used  int64
+	Quota int64 // 0 for none
+}
+
+// UsedText and QuotaText return the usage in human-readable units.
+func (u storageUsage) UsedText() string { return docs.FormatSize(u.Used) }
+func (u storageUsage) QuotaText() string {
+	if u.Quota <= 0 {
+		return "unlimited"
+	}
+	return docs.FormatSize(u.Quota)
+}
+
+// Percent returns the share of the quota used, at most 100, or 0 without
+// a quota.
+func (u storageUsage) Percent() int {
+	if u.Quota <= 0 {
+		return 0
+	}
+	return int(min(100, u.Used*100/u.Quota))
+}
+
+// projectUsage returns the storage usage of a project.
+func (h *Handler) projectUsage(ctx context.Context, project *database.Project) (storageUsage, error) {
+	usage, err := h.versions.UsageByProject(ctx)
+	if err != nil {
+		return storageUsage{}, err
+	}
+	return storageUsage{Used: usage[project.ID], Quota: h.projectQuota(project)}, nil
+}
+
+// storageProjectUsage is the usage of one project in the admin API.
+type storageProjectUsage struct {
+	Slug           string `json:"slug"`
+	UsedBytes      int64  `json:"used_bytes"`
+	QuotaBytes     int64  `json:"quota_bytes"`
+	MaxUploadBytes int64  `json:"max_upload_bytes"`
+}
+
+// handleAPIStorageUsage reports the storage used by all projects and each
+// one, with their quotas; a quota of 0 is unlimited.
+func (h *Handler) handleAPIStorageUsage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projects, err := h.projects.List(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing projects", "error", err)
+		h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	usage, err := h.versions.UsageByProject(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "getting storage usage", "error", err)
+		h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := struct {
+		UsedBytes  int64                 `json:"used_bytes"`
+		QuotaBytes int64                 `json:"quota_bytes"`
+		Projects   []storageProjectUsage `json:"projects"`
+	}{QuotaBytes: h.config.Storage.QuotaBytes(), Projects: make([]storageProjectUsage, 0, len(projects))}
+	for _, p := range projects {
+		resp.UsedBytes += usage[p.ID]
+		resp.Projects = append(resp.Projects, storageProjectUsage{
+			Slug:           p.Slug,
+			UsedBytes:      usage[p.ID],
+			QuotaBytes:     h.projectQuota(&p),
+			MaxUploadBytes: h.maxUploadSize(&p),
+		})
+	}
+	h.jsonResponse(w, resp)
+}
+
+// runStorageUsage records the size of versions without one, such as those
+// uploaded before sizes were kept, from their manifests.
+func (h *Handler) runStorageUsage(ctx context.Context) error {
+	projects, err := h.projects.List(ctx)
+	if err != nil {
+		return fmt.Errorf("listing projects: %w", err)
+	}
+	recorded := 0
+	for _, p := range projects {
+		versions, err := h.versions.ListByProject(ctx, p.ID)
+		if err != nil {
+			return fmt.Errorf("listing versions of %s: %w", p.Slug, err)
+		}
+		for _, v := range versions {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if v.SizeBytes > 0 {
+				continue
+			}
+			m, err := h.versionManifest(ctx, p.Slug, v.Tag)
+			if err != nil {
+				h.logger.WarnContext(ctx, "reading version manifest", "error", err, "project", p.Slug, "version", v.Tag)
+				continue
+			}
+			if size := m.Size(); size > 0 {
+				if err := h.versions.SetSize(ctx, v.ID, size); err != nil {
+					return err
+				}
+				recorded++
+			}
+		}
+	}
+	if recorded > 0 {
+		h.logger.InfoContext(ctx, "recorded version sizes", "versions", recorded)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func quotaArchive(t *testing.T) io.Reader {
+	return createTestZip(t, map[string]string{"index.html": strings.Repeat("a", 4096)})
+}
+
+func TestUploadProjectQuota(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.Storage.ProjectQuota = "6KB"
+	token := uploadTokenForProject(t, app, "quota")
+	ctx := context.Background()
+
+	if resp := postArchive(t, app, "quota", token, "1.0.0", quotaArchive(t)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected first upload to succeed, got %d", resp.StatusCode)
+	}
+	project, _ := app.handler.projects.GetBySlug(ctx, "quota")
+	v, err := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.SizeBytes != 4096 {
+		t.Errorf("expected size 4096, got %d", v.SizeBytes)
+	}
+
+	// Replacing the version does not count it twice
+	if resp := postArchive(t, app, "quota", token, "1.0.0", quotaArchive(t)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected re-upload to succeed, got %d", resp.StatusCode)
+	}
+
+	if resp := postArchive(t, app, "quota", token, "2.0.0", quotaArchive(t)); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 over the quota, got %d", resp.StatusCode)
+	}
+	if _, err := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "2.0.0"); err == nil {
+		t.Error("expected no version over the quota")
+	}
+	if app.handler.storage.VersionExists("quota", "2.0.0") {
+		t.Error("expected the files of the rejected upload to be deleted")
+	}
+
+	// A quota of the project's own overrides the default
+	unlimited := int64(0)
+	project.StorageQuota = &unlimited
+	if err := app.handler.projects.Update(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	if resp := postArchive(t, app, "quota", token, "2.0.0", quotaArchive(t)); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected upload without a quota to succeed, got %d", resp.StatusCode)
+	}
+}
+
+func TestUploadOverQuotaKeepsVersion(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.Storage.ProjectQuota = "6KB"
+	token := uploadTokenForProject(t, app, "quota")
+	ctx := context.Background()
+	project, _ := app.handler.projects.GetBySlug(ctx, "quota")
+	project.Visibility = database.VisibilityPublic
+	app.handler.projects.Update(ctx, project)
+
+	if resp := postArchive(t, app, "quota", token, "1.0.0", quotaArchive(t)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected first upload to succeed, got %d", resp.StatusCode)
+	}
+
+	// A re-upload over the quota is refused without touching the version
+	larger := createTestZip(t, map[string]string{"index.html": strings.Repeat("b", 8192)})
+	if resp := postArchive(t, app, "quota", token, "1.0.0", larger); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 over the quota, got %d", resp.StatusCode)
+	}
+
+	resp, err := http.Get(app.server.URL + "/project/quota/1.0.0/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), strings.Repeat("a", 4096)) {
+		t.Errorf("expected the previous files to be served, got %d", resp.StatusCode)
+	}
+	if _, err := app.handler.storage.ReadManifest("quota", "1.0.0"); err != nil {
+		t.Errorf("expected the manifest to be kept: %v", err)
+	}
+	v, _ := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "1.0.0")
+	if v.SizeBytes != 4096 {
+		t.Errorf("expected the recorded size to be kept, got %d", v.SizeBytes)
+	}
+}
+
+func TestUploadGlobalQuota(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.Storage.Quota = "6KB"
+	token := uploadTokenForProject(t, app, "quota")
+
+	if resp := postArchive(t, app, "quota", token, "1.0.0", quotaArchive(t)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected first upload to succeed, got %d", resp.StatusCode)
+	}
+	if resp := postArchive(t, app, "quota", token, "2.0.0", quotaArchive(t)); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 over the global quota, got %d", resp.StatusCode)
+	}
+}
+
+func TestUploadProjectMaxUploadSize(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "quota")
+	ctx := context.Background()
+
+	project, _ := app.handler.projects.GetBySlug(ctx, "quota")
+	limit := int64(64)
+	project.MaxUploadSize = &limit
+	if err := app.handler.projects.Update(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := postArchive(t, app, "quota", token, "1.0.0", quotaArchive(t)); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 over the project's upload limit, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIStorageUsage(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.Storage.Quota = "1MB"
+	token := uploadTokenForProject(t, app, "quota")
+	if resp := postArchive(t, app, "quota", token, "1.0.0", quotaArchive(t)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload failed with %d", resp.StatusCode)
+	}
+
+	resp := apiRequest(t, app, "GET", "/api/admin/storage", adminAPIToken(t, app), "", nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var usage struct {
+		UsedBytes  int64                 `json:"used_bytes"`
+		QuotaBytes int64                 `json:"quota_bytes"`
+		Projects   []storageProjectUsage `json:"projects"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&usage); err != nil {
+		t.Fatal(err)
+	}
+	if usage.UsedBytes != 4096 || usage.QuotaBytes != 1<<20 {
+		t.Errorf("unexpected totals: %+v", usage)
+	}
+	if len(usage.Projects) != 1 || usage.Projects[0].Slug != "quota" || usage.Projects[0].UsedBytes != 4096 {
+		t.Errorf("unexpected projects: %+v", usage.Projects)
+	}
+}
+
+func TestStorageUsageBackfill(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "quota")
+	ctx := context.Background()
+	if resp := postArchive(t, app, "quota", token, "1.0.0", quotaArchive(t)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload failed with %d", resp.StatusCode)
+	}
+	project, _ := app.handler.projects.GetBySlug(ctx, "quota")
+	v, _ := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "1.0.0")
+	if err := app.handler.versions.SetSize(ctx, v.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.handler.runStorageUsage(ctx); err != nil {
+		t.Fatal(err)
+	}
+	v, _ = app.handler.versions.GetByProjectAndTag(ctx, project.ID, "1.0.0")
+	if v.SizeBytes != 4096 {
+		t.Errorf("expected the size to be recorded, got %d", v.SizeBytes)
+	}
+}
+
+func TestParseOptionalSize(t *testing.T) {
+	for in, want := range map[string]string{"": "", "0": "0", "2GB": "2GB", "1024": "1KB", "1500": "1500"} {
+		n, err := parseOptionalSize(in)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if got := sizeInput(n); got != want {
+			t.Errorf("%q: got %q, want %q", in, got, want)
+		}
+	}
+	if _, err := parseOptionalSize("lots"); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
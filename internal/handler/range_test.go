@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestServeDocRanges(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := uploadTokenForProject(t, app, "guide")
+	project, _ := app.handler.projects.GetBySlug(ctx, "guide")
+	project.Visibility = database.VisibilityPublic
+	app.handler.projects.Update(ctx, project)
+
+	video := strings.Repeat("0123456789", 1000)
+	resp := postArchive(t, app, "guide", token, "1.0.0", createTestZip(t, map[string]string{
+		"index.html": "<html><body>Welcome</body></html>",
+		"intro.mp4":  video,
+	}))
+	resp.Body.Close()
+
+	request := func(method, path, ranges string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, app.server.URL+"/project/guide/1.0.0/"+path, nil)
+		req.Header.Set("Range", ranges)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := request("GET", "intro.mp4", "bytes=9990-")
+	if resp.StatusCode != http.StatusPartialContent || body != "0123456789" || resp.Header.Get("Content-Range") != "bytes 9990-9999/10000" {
+		t.Errorf("expected the last 10 bytes, got %d %q %q", resp.StatusCode, body, resp.Header.Get("Content-Range"))
+	}
+	resp, body = request("HEAD", "intro.mp4", "")
+	if resp.StatusCode != http.StatusOK || body != "" || resp.ContentLength != int64(len(video)) || resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("expected HEAD to describe the file, got %d %d %v", resp.StatusCode, resp.ContentLength, resp.Header)
+	}
+
+	// A range of a page would lack the overlay, so the whole page is sent
+	resp, body = request("GET", "", "bytes=0-10")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "Welcome") || !strings.Contains(body, "asiakirjat-overlay") {
+		t.Errorf("expected the whole page with the overlay, got %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Range") != "" || resp.Header.Get("Accept-Ranges") != "" {
+		t.Errorf("expected no range headers on a page, got %v", resp.Header)
+	}
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// maxRedirectsLen limits the redirect rules stored for a project.
+const maxRedirectsLen = 64 * 1024
+
+// redirectLines returns the rules of a project's redirects, one per line,
+// without blank lines and comments.
+func redirectLines(text string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// validateRedirects checks the redirect rules of a project.
+func validateRedirects(text string) error {
+	if len(text) > maxRedirectsLen {
+		return fmt.Errorf("redirects too long: at most %d bytes", maxRedirectsLen)
+	}
+	if _, err := docs.ParseRedirects(text); err != nil {
+		return fmt.Errorf("invalid redirects: %w", err)
+	}
+	return nil
+}
+
+// redirectMovedPage redirects a request for a page of a version if a rule
+// of the version or the project matches it, and reports whether it did.
+// Rules only apply to paths the version has no file for, unless forced,
+// so pages that were moved keep working.
+func (h *Handler) redirectMovedPage(w http.ResponseWriter, r *http.Request, project *database.Project, ver *database.Version, storagePath, filePath string) bool {
+	rules := h.redirectRules(r.Context(), project, ver, storagePath)
+	rule, ok := docs.MatchRedirect(rules, "/"+filePath)
+	if !ok {
+		return false
+	}
+	if !rule.Force {
+		if _, err := os.Stat(filepath.Join(storagePath, filepath.FromSlash(filePath))); err == nil {
+			return false
+		}
+	}
+	if strings.HasPrefix(rule.To, "/") {
+		h.redirect(w, r, "/project/"+project.Slug+"/"+escapePath(ver.Tag)+rule.To, rule.Status)
+		return true
+	}
+	http.Redirect(w, r, rule.To, rule.Status)
+	return true
+}
+
+// redirectRules returns the redirect rules of a version followed by those
+// of its project. Parsed rules are cached; rules that fail to parse are
+// logged once per load and left out.
+func (h *Handler) redirectRules(ctx context.Context, project *database.Project, ver *database.Version, storagePath string) []docs.RedirectRule {
+	versionRules, _ := h.versionRedirects.Load(storagePath, func() ([]docs.RedirectRule, error) {
+		rules, err := docs.ReadRedirects(storagePath)
+		if err != nil {
+			h.logger.WarnContext(ctx, "reading version redirects", "error", err, "project", project.Slug, "version", ver.Tag)
+		}
+		return rules, nil
+	})
+	if project.Redirects == "" {
+		return versionRules
+	}
+	projectRules, _ := h.projectRedirects.Load(project.Redirects, func() ([]docs.RedirectRule, error) {
+		rules, err := docs.ParseRedirects(project.Redirects)
+		if err != nil {
+			h.logger.WarnContext(ctx, "parsing project redirects", "error", err, "project", project.Slug)
+		}
+		return rules, nil
+	})
+	return slices.Concat(versionRules, projectRules)
+}
+
+// handleProjectRedirects shows the redirect rules of a project to its
+// editors.
+func (h *Handler) handleProjectRedirects(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canUpload(ctx, user, project) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	data := map[string]any{
+		"User":      user,
+		"Project":   project,
+		"Redirects": project.Redirects,
+	}
+	if r.URL.Query().Get("msg") == "saved" {
+		data["Flash"] = &Flash{Type: "success", Message: "Redirects saved"}
+	}
+	h.render(w, "project_redirects", data)
+}
+
+// handleProjectSaveRedirects replaces the redirect rules of a project.
+func (h *Handler) handleProjectSaveRedirects(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canUpload(ctx, user, project) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	redirects := strings.TrimSpace(strings.ReplaceAll(r.FormValue("redirects"), "\r\n", "\n"))
+	if err := validateRedirects(redirects); err != nil {
+		h.render(w, "project_redirects", map[string]any{
+			"User":      user,
+			"Project":   project,
+			"Redirects": redirects,
+			"Error":     err.Error(),
+		})
+		return
+	}
+
+	project.Redirects = redirects
+	if err := h.projects.Update(ctx, project); err != nil {
+		h.logger.ErrorContext(ctx, "updating project redirects", "error", err)
+		http.Error(w, "Failed to save redirects", http.StatusInternalServerError)
+		return
+	}
+	h.audit(ctx, "project.redirects", user.Username, fmt.Sprintf("%s: %d rules", project.Slug, len(redirectLines(redirects))))
+	h.redirect(w, r, "/project/"+project.Slug+"/redirects?msg=saved", http.StatusSeeOther)
+}
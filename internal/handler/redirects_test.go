@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+func TestServeRedirects(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	seedAdmin(t, app)
+	token := uploadTokenForProject(t, app, "guide")
+	project, _ := app.handler.projects.GetBySlug(ctx, "guide")
+	project.Visibility = database.VisibilityPublic
+	app.handler.projects.Update(ctx, project)
+
+	resp := postArchive(t, app, "guide", token, "1.0.0", createTestZip(t, map[string]string{
+		"_redirects":        "/old.html /new.html\n/guide/* /manual/:splat 302\n/kept.html /new.html\n",
+		"new.html":          "new",
+		"kept.html":         "kept",
+		"manual/setup.html": "setup",
+	}))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the upload to succeed, got %d", resp.StatusCode)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	get := func(path string) *http.Response {
+		t.Helper()
+		resp, err := client.Get(app.server.URL + "/project/guide/1.0.0" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{"/old.html", http.StatusMovedPermanently, "/project/guide/1.0.0/new.html"},
+		{"/guide/setup.html", http.StatusFound, "/project/guide/1.0.0/manual/setup.html"},
+		{"/kept.html", http.StatusOK, ""},
+		{"/missing.html", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		resp := get(tt.path)
+		if resp.StatusCode != tt.status || resp.Header.Get("Location") != tt.location {
+			t.Errorf("%s: expected %d to %q, got %d to %q", tt.path, tt.status, tt.location, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+
+	// Editors add rules for every version in the project settings.
+	cookies := loginUser(t, app, "admin", "admin123")
+	save := func(rules string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("POST", app.server.URL+"/project/guide/redirects", strings.NewReader(url.Values{"redirects": {rules}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	resp = save("/missing.html /new.html 308\n/old.html /kept.html\n")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected the redirects to be saved, got %d", resp.StatusCode)
+	}
+	if resp := get("/missing.html"); resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Location") != "/project/guide/1.0.0/new.html" {
+		t.Errorf("expected the project rule to apply, got %d to %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if resp := get("/old.html"); resp.Header.Get("Location") != "/project/guide/1.0.0/new.html" {
+		t.Errorf("expected the version's rule to take precedence, got %q", resp.Header.Get("Location"))
+	}
+
+	resp = save("/a //evil.example.com")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "must start with /") {
+		t.Error("expected an invalid rule to be refused")
+	}
+
+	resp = postArchive(t, app, "guide", token, "1.0.0", createTestZip(t, map[string]string{
+		"_redirects": "/a /b 200\n",
+		"index.html": "index",
+	}))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected an upload with invalid redirects to be refused, got %d", resp.StatusCode)
+	}
+}
+
+func TestServeRedirectsCached(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	seedAdmin(t, app)
+	token := uploadTokenForProject(t, app, "guide")
+	project, _ := app.handler.projects.GetBySlug(ctx, "guide")
+	project.Visibility = database.VisibilityPublic
+	app.handler.projects.Update(ctx, project)
+	var logs bytes.Buffer
+	app.handler.logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	resp := postArchive(t, app, "guide", token, "1.0.0", createTestZip(t, map[string]string{
+		"_redirects": "/old.html /new.html\n",
+		"new.html":   "new",
+		"kept.html":  "kept",
+	}))
+	resp.Body.Close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	location := func() string {
+		t.Helper()
+		resp, err := client.Get(app.server.URL + "/project/guide/1.0.0/old.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("Location")
+	}
+	if got := location(); got != "/project/guide/1.0.0/new.html" {
+		t.Fatalf("expected the version's rule to apply, got %q", got)
+	}
+
+	// The parsed rules are kept until the versions of the project change.
+	redirectsPath := filepath.Join(app.handler.storage.VersionPath("guide", "1.0.0"), docs.RedirectsFile)
+	os.WriteFile(redirectsPath, []byte("/old.html /kept.html\n"), 0644)
+	if got := location(); got != "/project/guide/1.0.0/new.html" {
+		t.Errorf("expected the cached rules, got %q", got)
+	}
+	app.handler.invalidateVersions(project.ID)
+	if got := location(); got != "/project/guide/1.0.0/kept.html" {
+		t.Errorf("expected the rules to be read again, got %q", got)
+	}
+
+	// Rules that fail to parse are logged once and left out.
+	os.WriteFile(redirectsPath, []byte("/old.html /kept.html 200\n"), 0644)
+	app.handler.invalidateVersions(project.ID)
+	location()
+	location()
+	if n := strings.Count(logs.String(), "reading version redirects"); n != 1 {
+		t.Errorf("expected the parse error to be logged once, got %d times:\n%s", n, logs.String())
+	}
+}
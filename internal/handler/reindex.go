@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// Reindex scopes, see reindexStatus.
+const (
+	reindexRebuild = "rebuild" // rebuild of the whole index
+	reindexResume  = "resume"  // continued rebuild after a restart
+	reindexChanged = "changed" // all versions, unchanged ones skipped
+	reindexProject = "project" // the versions of one project
+	reindexVersion = "version" // one version
+)
+
+// reindexStatus describes the running or the last reindex.
+type reindexStatus struct {
+	Running bool   `json:"running"`
+	Scope   string `json:"scope,omitempty"`
+	// Target is the project slug, or "slug/tag", of project and version
+	// reindexes
+	Target string `json:"target,omitempty"`
+	Force  bool   `json:"force,omitempty"`
+
+	Current int    `json:"current"`
+	Total   int    `json:"total"`
+	Project string `json:"project,omitempty"`
+	Version string `json:"version,omitempty"`
+	Indexed int    `json:"indexed"`
+	Skipped int    `json:"skipped"`
+
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Progress describes the progress for the admin page, e.g.
+// "3/10: guide 1.0".
+func (s reindexStatus) Progress() string {
+	switch {
+	case s.Total > 0:
+		return fmt.Sprintf("%d/%d: %s %s", s.Current, s.Total, s.Project, s.Version)
+	case s.Scope == reindexResume:
+		return "Resuming..."
+	default:
+		return "Starting..."
+	}
+}
+
+// reindexState tracks the reindex of the search index. Only one runs at a
+// time.
+type reindexState struct {
+	mu     sync.Mutex
+	status reindexStatus
+}
+
+// start marks a reindex as running, unless one already is.
+func (s *reindexState) start(scope, target string, force bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.Running {
+		return false
+	}
+	now := time.Now().UTC()
+	s.status = reindexStatus{Running: true, Scope: scope, Target: target, Force: force, StartedAt: &now}
+	return true
+}
+
+func (s *reindexState) progress(p docs.ReindexProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Current, s.status.Total = p.Current, p.Total
+	s.status.Project, s.status.Version = p.Project, p.Version
+	s.status.Indexed, s.status.Skipped = p.Indexed, p.Skipped
+}
+
+func (s *reindexState) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	s.status.Running, s.status.FinishedAt = false, &now
+	if err != nil {
+		s.status.Error = err.Error()
+	}
+}
+
+func (s *reindexState) get() reindexStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+func (s *reindexState) running() bool {
+	return s.get().Running
+}
+
+// reindexTargetsOf lists the versions of the given projects, with their
+// labels, for a reindex.
+func (h *Handler) reindexTargetsOf(ctx context.Context, projects []database.Project, tag string) ([]docs.ReindexProject, []docs.ReindexVersion, error) {
+	all, versions, err := h.reindexTargets(ctx, projects...)
+	if err != nil || tag == "" {
+		return all, versions, err
+	}
+	var matching []docs.ReindexVersion
+	for _, v := range versions {
+		if v.Tag == tag {
+			matching = append(matching, v)
+		}
+	}
+	return all, matching, nil
+}
+
+// startPartialReindex indexes versions again in the background, skipping
+// unchanged ones unless force is set. It returns false if a reindex is
+// already running.
+func (h *Handler) startPartialReindex(ctx context.Context, scope, target string, force bool, projects []docs.ReindexProject, versions []docs.ReindexVersion) bool {
+	if !h.reindex.start(scope, target, force) {
+		return false
+	}
+	h.goJob(ctx, func(ctx context.Context) {
+		progressFn := func(p docs.ReindexProgress) {
+			h.reindex.progress(p)
+			h.logger.DebugContext(ctx, "reindex progress", "current", p.Current, "total", p.Total, "project", p.Project, "version", p.Version)
+		}
+		var progress docs.ReindexProgress
+		err := h.limitJob(jobSearchIndex, func(ctx context.Context) error {
+			var err error
+			progress, err = h.searchIndex.ReindexVersions(ctx, projects, versions, force, progressFn)
+			return err
+		})(ctx)
+		if errors.Is(err, context.Canceled) {
+			err = errReindexInterrupted
+		}
+		h.reindex.progress(progress)
+		h.reindex.finish(err)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "reindex failed", "error", err, "scope", scope, "target", target)
+			if err != errReindexInterrupted {
+				h.alertReindexFailed(ctx, scope, target, err)
+			}
+			return
+		}
+		h.logger.InfoContext(ctx, "reindex completed", "scope", scope, "target", target, "indexed", progress.Indexed, "skipped", progress.Skipped)
+	})
+	return true
+}
+
+// handleAdminReindexProject indexes the changed versions of a project
+// again, or all of them with force=1.
+func (h *Handler) handleAdminReindexProject(w http.ResponseWriter, r *http.Request) {
+	if h.refuseDuringShutdown(w, false) {
+		return
+	}
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	force := r.FormValue("force") == "1"
+	projects, versions, err := h.reindexTargetsOf(ctx, []database.Project{*project}, "")
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing versions for reindex", "error", err, "project", project.Slug)
+		h.redirect(w, r, "/admin/projects", http.StatusSeeOther)
+		return
+	}
+	if !h.startPartialReindex(ctx, reindexProject, project.Slug, force, projects, versions) {
+		h.redirect(w, r, "/admin/projects?msg=reindex_already_running", http.StatusSeeOther)
+		return
+	}
+	h.audit(ctx, "search_index.reindex", user.Username, reindexProject+" "+project.Slug)
+	h.redirect(w, r, "/admin/projects?msg=reindex_started", http.StatusSeeOther)
+}
+
+// reindexStatusResponse is the reindex status returned by the API.
+type reindexStatusResponse struct {
+	reindexStatus
+	// Incomplete is set while a rebuild is running, and after one failed
+	// or was interrupted until the missing versions are indexed
+	Incomplete bool `json:"incomplete"`
+	// Outdated is set when the analysis settings changed since the index
+	// was built
+	Outdated       bool   `json:"outdated"`
+	AnalysisChange string `json:"analysis_change,omitempty"`
+}
+
+func (h *Handler) reindexStatusResponse() reindexStatusResponse {
+	resp := reindexStatusResponse{reindexStatus: h.reindex.get()}
+	if h.searchIndex != nil {
+		resp.Incomplete = h.searchIndex.Incomplete()
+		resp.Outdated = h.searchIndex.Outdated()
+		resp.AnalysisChange = h.searchIndex.AnalysisChange()
+	}
+	return resp
+}
+
+// handleAPIReindexStatus returns the progress of the running reindex, or
+// the result of the last one.
+func (h *Handler) handleAPIReindexStatus(w http.ResponseWriter, r *http.Request) {
+	h.jsonResponse(w, h.reindexStatusResponse())
+}
+
+// handleAPIReindex starts a rebuild of the whole index, or with
+// changed=true a reindex of the versions changed since they were indexed.
+func (h *Handler) handleAPIReindex(w http.ResponseWriter, r *http.Request) {
+	if h.refuseDuringShutdown(w, true) {
+		return
+	}
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	changed, _ := strconv.ParseBool(r.FormValue("changed"))
+	projects, versions, err := h.reindexTargets(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing projects for reindex", "error", err)
+		h.jsonError(w, "Failed to list projects", http.StatusInternalServerError)
+		return
+	}
+	scope := reindexRebuild
+	if changed && !h.searchIndex.Outdated() {
+		scope = reindexChanged
+	}
+	h.startAPIReindex(w, r, user, scope, "", false, projects, versions)
+}
+
+// handleAPIReindexProject indexes the changed versions of a project again,
+// or all of them with force=true.
+func (h *Handler) handleAPIReindexProject(w http.ResponseWriter, r *http.Request) {
+	h.apiReindexProject(w, r, "")
+}
+
+// handleAPIReindexVersion indexes a version again if it changed, or with
+// force=true in any case.
+func (h *Handler) handleAPIReindexVersion(w http.ResponseWriter, r *http.Request) {
+	h.apiReindexProject(w, r, r.PathValue("tag"))
+}
+
+func (h *Handler) apiReindexProject(w http.ResponseWriter, r *http.Request, tag string) {
+	if h.refuseDuringShutdown(w, true) {
+		return
+	}
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	force, _ := strconv.ParseBool(r.FormValue("force"))
+	projects, versions, err := h.reindexTargetsOf(ctx, []database.Project{*project}, tag)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing versions for reindex", "error", err, "project", project.Slug)
+		h.jsonError(w, "Failed to list versions", http.StatusInternalServerError)
+		return
+	}
+	scope, target := reindexProject, project.Slug
+	if tag != "" {
+		if len(versions) == 0 {
+			h.jsonError(w, "Version not found", http.StatusNotFound)
+			return
+		}
+		scope, target = reindexVersion, project.Slug+"/"+tag
+	}
+	h.startAPIReindex(w, r, user, scope, target, force, projects, versions)
+}
+
+// startAPIReindex starts a reindex and responds with its status, or with
+// 409 Conflict if one is running already.
+func (h *Handler) startAPIReindex(w http.ResponseWriter, r *http.Request, user *database.User, scope, target string, force bool, projects []docs.ReindexProject, versions []docs.ReindexVersion) {
+	ctx := r.Context()
+	var started bool
+	if scope == reindexRebuild {
+		started = h.startReindex(ctx, false, projects, versions)
+	} else {
+		started = h.startPartialReindex(ctx, scope, target, force, projects, versions)
+	}
+	if !started {
+		h.jsonError(w, "Reindex is already running", http.StatusConflict)
+		return
+	}
+	details := scope
+	if target != "" {
+		details += " " + target
+	}
+	h.audit(ctx, "search_index.reindex", user.Username, details)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", h.config.Server.BasePath+"/api/admin/reindex/status")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(h.reindexStatusResponse())
+}
+
+// errReindexInterrupted is recorded as the error of a reindex stopped by a
+// shutdown.
+var errReindexInterrupted = errors.New("interrupted by shutdown")
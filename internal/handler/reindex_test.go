@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIReindex(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	token := adminAPIToken(t, app)
+	guide := seedProject(t, app, "guide", "Guide", true)
+	other := seedProject(t, app, "other", "Other", true)
+	seedSEOVersion(t, app, guide, admin, "1.0.0")
+	seedSEOVersion(t, app, guide, admin, "2.0.0")
+	seedSEOVersion(t, app, other, admin, "1.0.0")
+
+	status := func() reindexStatusResponse {
+		t.Helper()
+		resp := apiRequest(t, app, "GET", "/api/admin/reindex/status", token, "", nil)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 for the status, got %d", resp.StatusCode)
+		}
+		var s reindexStatusResponse
+		if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	reindex := func(path string) reindexStatusResponse {
+		t.Helper()
+		resp := apiRequest(t, app, "POST", path, token, "", nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("POST %s: expected 202, got %d", path, resp.StatusCode)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if s := status(); !s.Running {
+				return s
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("POST %s: reindex did not finish", path)
+		return reindexStatusResponse{}
+	}
+
+	if s := status(); s.Running || s.StartedAt != nil {
+		t.Errorf("expected no reindex yet, got %+v", s)
+	}
+	if s := reindex("/api/admin/reindex"); s.Scope != reindexRebuild || s.Indexed != 3 || s.Total != 3 || s.Error != "" || s.Incomplete {
+		t.Errorf("expected a full rebuild of 3 versions, got %+v", s)
+	}
+	if s := reindex("/api/admin/reindex?changed=true"); s.Scope != reindexChanged || s.Indexed != 0 || s.Skipped != 3 {
+		t.Errorf("expected unchanged versions to be skipped, got %+v", s)
+	}
+	if s := reindex("/api/admin/reindex/projects/guide?force=true"); s.Target != "guide" || s.Indexed != 2 || s.Skipped != 0 {
+		t.Errorf("expected the guide's versions to be indexed, got %+v", s)
+	}
+	if s := reindex("/api/admin/reindex/projects/guide/versions/2.0.0"); s.Target != "guide/2.0.0" || s.Total != 1 || s.Skipped != 1 {
+		t.Errorf("expected the unchanged version to be skipped, got %+v", s)
+	}
+
+	for path, want := range map[string]int{
+		"/api/admin/reindex/projects/missing":              http.StatusNotFound,
+		"/api/admin/reindex/projects/guide/versions/9.9.9": http.StatusNotFound,
+	} {
+		resp := apiRequest(t, app, "POST", path, token, "", nil)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("POST %s: expected %d, got %d", path, want, resp.StatusCode)
+		}
+	}
+
+	// One reindex at a time
+	app.handler.reindex.start(reindexRebuild, "", false)
+	resp := apiRequest(t, app, "POST", "/api/admin/reindex/projects/guide", token, "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 while a reindex runs, got %d", resp.StatusCode)
+	}
+	app.handler.reindex.finish(nil)
+
+	// Tokens of non-admins cannot reindex
+	editorToken := uploadTokenForProject(t, app, "limits")
+	resp = apiRequest(t, app, "POST", "/api/admin/reindex", editorToken, "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a non-admin token, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminReindexStatusPolling(t *testing.T) {
+	app := setupTestApp(t)
+	seedAdmin(t, app)
+	cookies := loginUser(t, app, "admin", "admin123")
+
+	req, _ := http.NewRequest("GET", app.server.URL+"/api/admin/reindex/status", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the admin page to poll with its session, got %d", resp.StatusCode)
+	}
+
+	app.handler.reindex.start(reindexRebuild, "", false)
+	req, _ = http.NewRequest("GET", app.server.URL+"/admin/projects", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	app.handler.reindex.finish(nil)
+	if !strings.Contains(string(body), `id="reindex-progress"`) || !strings.Contains(string(body), `\/api\/admin\/reindex\/status`) {
+		t.Error("expected the admin page to poll the reindex status")
+	}
+}
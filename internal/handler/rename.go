@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+var (
+	errVersionExists    = errors.New("a version with this tag already exists")
+	errVersionProtected = errors.New("protected versions cannot be merged into another version")
+	errSameVersionTag   = errors.New("the new tag is the current tag")
+)
+
+// renameVersion gives a version a new tag: its files, attachments, search
+// index entries and a pin move along, and the old tag redirects to the new
+// one. When a version with the new tag exists and merge is set, the version
+// is deleted instead and its tag redirects to the existing version. to must
+// already have passed the version rules of the project. It reports whether
+// the version was merged.
+func (h *Handler) renameVersion(ctx context.Context, project *database.Project, version *database.Version, to string, merge bool, actor string) (bool, error) {
+	from := version.Tag
+	if to == from {
+		return false, errSameVersionTag
+	}
+
+	_, err := h.versions.GetByProjectAndTag(ctx, project.ID, to)
+	exists := err == nil
+	if exists && !merge {
+		return false, errVersionExists
+	}
+
+	if exists {
+		if version.Protected {
+			return false, errVersionProtected
+		}
+		if err := h.versions.Delete(ctx, version.ID); err != nil {
+			return false, err
+		}
+		if err := h.storage.DeleteVersion(project.Slug, from); err != nil {
+			h.logger.ErrorContext(ctx, "deleting merged version from filesystem", "error", err)
+		}
+		if h.searchIndex != nil {
+			if err := h.searchIndex.DeleteVersion(project.ID, version.ID); err != nil {
+				h.logger.ErrorContext(ctx, "deleting merged version from search index", "error", err)
+			}
+		}
+	} else {
+		if h.storage.VersionExists(project.Slug, to) {
+			return false, errVersionExists
+		}
+		if err := h.storage.RenameVersion(project.Slug, from, to); err != nil {
+			return false, err
+		}
+		storagePath := h.storage.VersionPath(project.Slug, to)
+		if err := h.versions.Rename(ctx, version.ID, to, storagePath); err != nil {
+			if err := h.storage.RenameVersion(project.Slug, to, from); err != nil {
+				h.logger.ErrorContext(ctx, "moving back renamed version", "error", err)
+			}
+			return false, err
+		}
+		version.Tag = to
+		version.StoragePath = storagePath
+
+		if h.searchIndex != nil {
+			v := *version
+			h.goJob(ctx, func(ctx context.Context) {
+				h.searchIndex.DeleteVersion(project.ID, v.ID)
+				if err := h.searchIndex.IndexVersionWithMetadata(ctx, project.ID, v.ID, project.Slug, project.Name, v.Tag, v.StoragePath, h.searchMetadata(ctx, project.ID, v.ID)); err != nil {
+					h.logger.ErrorContext(ctx, "reindexing renamed version", "error", err)
+				}
+			})
+		}
+	}
+
+	if project.PinnedVersion != nil && *project.PinnedVersion == from {
+		project.PinnedVersion = &to
+		if err := h.projects.Update(ctx, project); err != nil {
+			h.logger.ErrorContext(ctx, "moving pin of renamed version", "error", err)
+		}
+	}
+	if err := h.redirects.Set(ctx, project.ID, from, to); err != nil {
+		h.logger.ErrorContext(ctx, "recording version redirect", "error", err)
+	}
+	h.invalidateVersions(project.ID)
+
+	if exists {
+		h.emitEvent(ctx, database.EventVersionDeleted, project.Slug, map[string]any{"version": from, "reason": "merged", "merged_into": to, "actor": actor})
+		h.audit(ctx, "version.merge", actor, fmt.Sprintf("%s: %s -> %s", project.Slug, from, to))
+	} else {
+		h.emitEvent(ctx, database.EventVersionRenamed, project.Slug, map[string]any{"version": to, "previous": from, "actor": actor})
+		h.audit(ctx, "version.rename", actor, fmt.Sprintf("%s: %s -> %s", project.Slug, from, to))
+	}
+	return exists, nil
+}
+
+// redirectRenamedVersion answers with a permanent redirect to prefix + the
+// new tag + suffix when tag is the old tag of a renamed or merged version.
+// It returns false when there is no such redirect.
+func (h *Handler) redirectRenamedVersion(w http.ResponseWriter, r *http.Request, project *database.Project, tag, prefix, suffix string) bool {
+	if h.redirects == nil {
+		return false
+	}
+	newTag, err := h.redirects.Get(r.Context(), project.ID, tag)
+	if err != nil {
+		return false
+	}
+	target := prefix + escapePath(newTag) + suffix
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	h.redirect(w, r, target, http.StatusMovedPermanently)
+	return true
+}
+
+// handleRenameVersion renames a version to the tag in the new_tag form
+// field, or merges it into an existing version when merge is set.
+func (h *Handler) handleRenameVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	slug := r.PathValue("slug")
+	tag := r.PathValue("tag")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canUpload(ctx, user, project) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag)
+	if err != nil {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	newTag, err := normalizeVersionTag(project, r.FormValue("new_tag"))
+	if err != nil {
+		h.redirect(w, r, "/project/"+slug+"?msg=version_tag_invalid", http.StatusSeeOther)
+		return
+	}
+
+	_, err = h.renameVersion(ctx, project, version, newTag, r.FormValue("merge") == "true", user.Username)
+	switch {
+	case errors.Is(err, errVersionExists):
+		h.redirect(w, r, "/project/"+slug+"?msg=version_exists", http.StatusSeeOther)
+		return
+	case errors.Is(err, errVersionProtected):
+		h.redirect(w, r, "/project/"+slug+"?msg=version_protected", http.StatusSeeOther)
+		return
+	case errors.Is(err, errSameVersionTag):
+		h.redirect(w, r, "/project/"+slug, http.StatusSeeOther)
+		return
+	case err != nil:
+		h.logger.ErrorContext(ctx, "renaming version", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.InfoContext(ctx, "version renamed", "project", slug, "version", tag, "new_tag", newTag, "user", user.Username)
+	h.redirect(w, r, "/project/"+slug+"?msg=version_renamed", http.StatusSeeOther)
+}
+
+// handleAPIRenameVersion renames a version from a JSON body of the form
+// {"tag": "1.2.0", "merge": false}.
+func (h *Handler) handleAPIRenameVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	slug := r.PathValue("slug")
+	tag := r.PathValue("tag")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	user := h.authenticateToken(w, r, project.ID, auth.ScopeUpload)
+	if user == nil {
+		return
+	}
+
+	if !h.canUpload(ctx, user, project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag)
+	if err != nil {
+		h.jsonError(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Tag   string `json:"tag"`
+		Merge bool   `json:"merge"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, `Invalid JSON body: expected {"tag": "...", "merge": false}`, http.StatusBadRequest)
+		return
+	}
+	newTag, err := normalizeVersionTag(project, req.Tag)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	merged, err := h.renameVersion(ctx, project, version, newTag, req.Merge, user.Username)
+	switch {
+	case errors.Is(err, errVersionExists):
+		h.jsonError(w, "A version with this tag already exists; set merge to merge the versions", http.StatusConflict)
+		return
+	case errors.Is(err, errVersionProtected):
+		h.jsonError(w, "Protected versions cannot be merged into another version", http.StatusConflict)
+		return
+	case errors.Is(err, errSameVersionTag):
+		h.jsonError(w, "The new tag is the current tag", http.StatusBadRequest)
+		return
+	case err != nil:
+		h.logger.ErrorContext(ctx, "renaming version", "error", err)
+		h.jsonError(w, "Failed to rename version", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.InfoContext(ctx, "version renamed", "project", slug, "version", tag, "new_tag", newTag, "merged", merged, "user", user.Username)
+	h.jsonResponse(w, map[string]any{
+		"tag":      newTag,
+		"previous": tag,
+		"merged":   merged,
+	})
+}
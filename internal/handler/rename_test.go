@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenameVersion(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.0")
+	seedSEOVersion(t, app, project, admin, "2.0.0")
+	token := adminAPIToken(t, app)
+
+	attachments := app.handler.storage.AttachmentPath("guide", "1.0")
+	os.MkdirAll(attachments, 0755)
+	os.WriteFile(filepath.Join(attachments, "sbom.json"), []byte("{}"), 0644)
+
+	pin := "1.0"
+	project.PinnedVersion = &pin
+	if err := app.handler.projects.Update(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := apiRequest(t, app, "POST", "/api/project/guide/version/1.0/rename", token, `{"tag": "1.0.0"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	tags := versionTags(t, app, project)
+	if tags["1.0"] || !tags["1.0.0"] {
+		t.Fatalf("expected 1.0 to be renamed to 1.0.0, got %v", tags)
+	}
+	if !app.handler.storage.VersionExists("guide", "1.0.0") || app.handler.storage.VersionExists("guide", "1.0") {
+		t.Error("expected the version files to move")
+	}
+	if _, err := os.Stat(filepath.Join(app.handler.storage.AttachmentPath("guide", "1.0.0"), "sbom.json")); err != nil {
+		t.Error("expected the attachments to move")
+	}
+	project, _ = app.handler.projects.GetBySlug(ctx, "guide")
+	if project.PinnedVersion == nil || *project.PinnedVersion != "1.0.0" {
+		t.Errorf("expected the pin to follow the rename, got %v", project.PinnedVersion)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(app.server.URL + "/project/guide/1.0/guide/intro.html?q=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "/project/guide/1.0.0/guide/intro.html?q=x" {
+		t.Errorf("expected a redirect to the new tag, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// Renaming onto an existing tag needs merge.
+	resp = apiRequest(t, app, "POST", "/api/project/guide/version/1.0.0/rename", token, `{"tag": "2.0.0"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 without merge, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "POST", "/api/project/guide/version/1.0.0/rename", token, `{"tag": "2.0.0", "merge": true}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for merge, got %d", resp.StatusCode)
+	}
+	tags = versionTags(t, app, project)
+	if tags["1.0.0"] || !tags["2.0.0"] {
+		t.Fatalf("expected 1.0.0 to be merged into 2.0.0, got %v", tags)
+	}
+
+	// Earlier redirects follow the merge.
+	resp, err = client.Get(app.server.URL + "/project/guide/1.0/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Location") != "/project/guide/2.0.0/index.html" {
+		t.Errorf("expected the old redirect to point at the merged version, got %q", resp.Header.Get("Location"))
+	}
+
+	resp = apiRequest(t, app, "POST", "/api/project/guide/version/2.0.0/rename", token, `{"tag": "../x"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid tag, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/logging"
+)
+
+func TestLoggingMiddlewareRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	logHandler, _ := logging.NewHandler(&logs, "json", slog.LevelInfo)
+	logger := slog.New(logHandler)
+
+	var seen string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+		logger.ErrorContext(r.Context(), "store failed")
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	server := httptest.NewServer(LoggingMiddleware(logger, RecoveryMiddleware(logger, mux)))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/ok", nil)
+	req.Header.Set("X-Request-ID", "client-42")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if seen != "client-42" || resp.Header.Get("X-Request-ID") != "client-42" {
+		t.Errorf("expected the client request ID to be kept, got %q and header %q", seen, resp.Header.Get("X-Request-ID"))
+	}
+	if n := strings.Count(logs.String(), `"request_id":"client-42"`); n != 2 {
+		t.Errorf("expected the handler and request log lines to carry the ID, got %d in %s", n, logs.String())
+	}
+
+	for _, path := range []string{"/fail", "/panic"} {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		req.Header.Set("X-Request-ID", "bad id<>")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		id := resp.Header.Get("X-Request-ID")
+		if id == "" || id == "bad id<>" {
+			t.Errorf("%s: expected a generated request ID, got %q", path, id)
+		}
+		if resp.StatusCode != http.StatusInternalServerError || !strings.Contains(string(body), "Request ID: "+id) {
+			t.Errorf("%s: expected the error page to show the request ID, got %d %q", path, resp.StatusCode, body)
+		}
+	}
+}
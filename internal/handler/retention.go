@@ -2,12 +2,45 @@ package handler
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/qwc/asiakirjat/internal/database"
 	"github.com/qwc/asiakirjat/internal/docs"
 )
 
+// retentionSummary collects the outcome of a retention run for logging and
+// the audit log.
+type retentionSummary struct {
+	DryRun   bool
+	Projects int      // projects with an active policy
+	Expired  []string // "slug@tag" of deleted (or, in dry-run mode, deletable) versions
+	Failed   int
+}
+
+func (s *retentionSummary) action() string {
+	if s.DryRun {
+		return "retention.dry_run"
+	}
+	return "retention.prune"
+}
+
+func (s *retentionSummary) String() string {
+	verb := "deleted"
+	if s.DryRun {
+		verb = "would delete"
+	}
+	msg := fmt.Sprintf("%s %d version(s) across %d project(s) with a retention policy", verb, len(s.Expired), s.Projects)
+	if s.Failed > 0 {
+		msg += fmt.Sprintf(", %d failed", s.Failed)
+	}
+	if len(s.Expired) > 0 {
+		msg += ": " + strings.Join(s.Expired, ", ")
+	}
+	return msg
+}
+
 // effectiveRetentionDays returns the retention policy for a project in days.
 // Per-project override takes precedence over the global default.
 // Returns 0 for unlimited (no auto-deletion).
@@ -18,85 +51,106 @@ func (h *Handler) effectiveRetentionDays(project *database.Project) int {
 	return h.config.Retention.NonSemverDays
 }
 
-// enforceRetentionPolicy deletes non-semver versions older than the
-// configured retention period for the given project.
+// enforceRetentionPolicy applies the retention policy to a single project,
+// e.g. after an upload, and records an audit entry if anything expired.
 func (h *Handler) enforceRetentionPolicy(ctx context.Context, project *database.Project) {
+	summary := &retentionSummary{DryRun: h.config.Retention.DryRun}
+	h.pruneExpiredVersions(ctx, project, summary)
+	if len(summary.Expired) > 0 {
+		h.audit(ctx, summary.action(), "system", summary.String())
+	}
+}
+
+// pruneExpiredVersions deletes unprotected non-semver versions older than
+// the project's retention period from the database, storage and search index. In dry-run
+// mode the versions are only recorded in the summary.
+func (h *Handler) pruneExpiredVersions(ctx context.Context, project *database.Project, summary *retentionSummary) {
 	days := h.effectiveRetentionDays(project)
 	if days <= 0 {
 		return
 	}
+	summary.Projects++
 
 	versions, err := h.versions.ListByProject(ctx, project.ID)
 	if err != nil {
-		h.logger.Error("retention: listing versions", "error", err, "project", project.Slug)
+		h.logger.ErrorContext(ctx, "retention: listing versions", "error", err, "project", project.Slug)
+		summary.Failed++
 		return
 	}
 
 	cutoff := time.Now().AddDate(0, 0, -days)
 
 	for _, v := range versions {
-		if docs.IsSemver(v.Tag) {
+		if docs.IsSemver(v.Tag) || v.Protected {
 			continue
 		}
 		if v.CreatedAt.After(cutoff) {
 			continue
 		}
 
-		h.logger.Info("retention: deleting expired version",
+		if summary.DryRun {
+			h.logger.InfoContext(ctx, "retention: would delete expired version (dry run)",
+				"project", project.Slug, "version", v.Tag,
+				"created_at", v.CreatedAt, "retention_days", days)
+			summary.Expired = append(summary.Expired, project.Slug+"@"+v.Tag)
+			continue
+		}
+
+		h.logger.InfoContext(ctx, "retention: deleting expired version",
 			"project", project.Slug, "version", v.Tag,
 			"created_at", v.CreatedAt, "retention_days", days)
 
 		if err := h.versions.Delete(ctx, v.ID); err != nil {
-			h.logger.Error("retention: deleting version from database", "error", err, "project", project.Slug, "version", v.Tag)
+			h.logger.ErrorContext(ctx, "retention: deleting version from database", "error", err, "project", project.Slug, "version", v.Tag)
+			summary.Failed++
 			continue
 		}
+		summary.Expired = append(summary.Expired, project.Slug+"@"+v.Tag)
+		h.emitEvent(ctx, database.EventVersionDeleted, project.Slug, map[string]any{"version": v.Tag, "reason": "retention", "actor": "system"})
 		if err := h.storage.DeleteVersion(project.Slug, v.Tag); err != nil {
-			h.logger.Error("retention: deleting version from filesystem", "error", err, "project", project.Slug, "version", v.Tag)
+			h.logger.ErrorContext(ctx, "retention: deleting version from filesystem", "error", err, "project", project.Slug, "version", v.Tag)
 		}
 		if h.searchIndex != nil {
 			if err := h.searchIndex.DeleteVersion(project.ID, v.ID); err != nil {
-				h.logger.Error("retention: deleting version from search index", "error", err, "project", project.Slug, "version", v.Tag)
+				h.logger.ErrorContext(ctx, "retention: deleting version from search index", "error", err, "project", project.Slug, "version", v.Tag)
 			}
 		}
-		h.invalidateLatestTagsCache()
+		h.invalidateVersions(project.ID)
 	}
 }
 
-// runRetentionCleanup iterates all projects and enforces retention for
-// those with a non-zero effective retention policy.
-func (h *Handler) runRetentionCleanup(ctx context.Context) {
+// runRetentionCleanup enforces retention for every project with a non-zero
+// effective retention policy, honoring retention.dry_run.
+func (h *Handler) runRetentionCleanup(ctx context.Context) error {
+	return h.runRetention(ctx, h.config.Retention.DryRun)
+}
+
+// runRetentionDryRun reports what a retention run would delete.
+func (h *Handler) runRetentionDryRun(ctx context.Context) error {
+	return h.runRetention(ctx, true)
+}
+
+func (h *Handler) runRetention(ctx context.Context, dryRun bool) error {
 	projects, err := h.projects.List(ctx)
 	if err != nil {
-		h.logger.Error("retention: listing projects", "error", err)
-		return
+		return fmt.Errorf("retention: listing projects: %w", err)
 	}
 
+	summary := &retentionSummary{DryRun: dryRun}
 	for i := range projects {
 		if ctx.Err() != nil {
-			return
-		}
-		if h.effectiveRetentionDays(&projects[i]) > 0 {
-			h.enforceRetentionPolicy(ctx, &projects[i])
+			return ctx.Err()
 		}
+		h.pruneExpiredVersions(ctx, &projects[i], summary)
 	}
-}
 
-// StartRetentionWorker runs retention cleanup once immediately, then
-// every hour. It stops when the context is cancelled.
-func (h *Handler) StartRetentionWorker(ctx context.Context) {
-	h.logger.Info("retention worker started")
-	h.runRetentionCleanup(ctx)
-
-	ticker := time.NewTicker(1 * time.Hour)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			h.logger.Info("retention worker stopped")
-			return
-		case <-ticker.C:
-			h.runRetentionCleanup(ctx)
-		}
+	h.logger.InfoContext(ctx, "retention: run complete",
+		"dry_run", dryRun, "projects", summary.Projects,
+		"expired", len(summary.Expired), "failed", summary.Failed)
+	h.audit(ctx, summary.action(), "system", summary.String())
+
+	if summary.Failed > 0 {
+		return fmt.Errorf("retention: %d deletion(s) failed", summary.Failed)
 	}
+	return nil
 }
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// seedAgedVersion creates a version with storage whose upload time is age ago.
+func seedAgedVersion(t *testing.T, app *testApp, project *database.Project, tag string, age time.Duration) {
+	t.Helper()
+	ctx := context.Background()
+	if err := app.handler.storage.EnsureVersionDir(project.Slug, tag); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := app.handler.users.GetByUsername(ctx, "admin")
+	if err != nil {
+		admin = seedAdmin(t, app)
+	}
+	v := &database.Version{
+		ProjectID:   project.ID,
+		Tag:         tag,
+		StoragePath: app.handler.storage.VersionPath(project.Slug, tag),
+		ContentType: "archive",
+		UploadedBy:  admin.ID,
+	}
+	if err := app.handler.versions.Create(ctx, v); err != nil {
+		t.Fatal(err)
+	}
+	v.CreatedAt = time.Now().Add(-age)
+	if err := app.handler.versions.Update(ctx, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func versionTags(t *testing.T, app *testApp, project *database.Project) map[string]bool {
+	t.Helper()
+	versions, err := app.handler.versions.ListByProject(context.Background(), project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := make(map[string]bool)
+	for _, v := range versions {
+		tags[v.Tag] = true
+	}
+	return tags
+}
+
+func TestRetentionPrunesExpiredNonSemverVersions(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	app.handler.config.Retention.NonSemverDays = 7
+
+	project := seedProject(t, app, "pruned", "Pruned", true)
+	seedAgedVersion(t, app, project, "feature-old", 30*24*time.Hour)
+	seedAgedVersion(t, app, project, "main", time.Hour)
+	seedAgedVersion(t, app, project, "v1.0.0", 30*24*time.Hour)
+
+	// A per-project override of 0 disables retention for that project
+	unlimited := 0
+	kept := seedProject(t, app, "kept", "Kept", true)
+	kept.RetentionDays = &unlimited
+	app.handler.projects.Update(ctx, kept)
+	seedAgedVersion(t, app, kept, "feature-old", 30*24*time.Hour)
+
+	if err := app.handler.runRetentionCleanup(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tags := versionTags(t, app, project)
+	if tags["feature-old"] {
+		t.Error("expected expired non-semver version to be deleted")
+	}
+	if !tags["main"] || !tags["v1.0.0"] {
+		t.Errorf("expected recent and semver versions to be kept, got %v", tags)
+	}
+	if app.handler.storage.VersionExists("pruned", "feature-old") {
+		t.Error("expected storage for expired version to be removed")
+	}
+	if !versionTags(t, app, kept)["feature-old"] {
+		t.Error("expected project override to keep its versions")
+	}
+
+	entries, err := app.handler.auditLog.List(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != "retention.prune" {
+		t.Fatalf("expected one retention.prune audit entry, got %+v", entries)
+	}
+	if !strings.Contains(entries[0].Details, "pruned@feature-old") {
+		t.Errorf("expected audit details to list the deleted version, got %q", entries[0].Details)
+	}
+}
+
+func TestRetentionDryRunKeepsVersions(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	app.handler.config.Retention.NonSemverDays = 7
+	app.handler.config.Retention.DryRun = true
+
+	project := seedProject(t, app, "dry", "Dry", true)
+	seedAgedVersion(t, app, project, "feature-old", 30*24*time.Hour)
+
+	if err := app.handler.runRetentionCleanup(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !versionTags(t, app, project)["feature-old"] {
+		t.Error("expected dry run to keep the version")
+	}
+	if !app.handler.storage.VersionExists("dry", "feature-old") {
+		t.Error("expected dry run to keep the version's files")
+	}
+
+	entries, _ := app.handler.auditLog.List(ctx, 10)
+	if len(entries) != 1 || entries[0].Action != "retention.dry_run" {
+		t.Fatalf("expected one retention.dry_run audit entry, got %+v", entries)
+	}
+	if !strings.Contains(entries[0].Details, "would delete 1 version") {
+		t.Errorf("unexpected audit details %q", entries[0].Details)
+	}
+}
@@ -0,0 +1,1000 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// SCIM 2.0 (RFC 7643, RFC 7644) lets an identity provider create, update,
+// deactivate and delete users, and push the groups they are members of,
+// instead of users being created at their first login. Group members get
+// the access of the group mappings and global access rules of the "scim"
+// source, matched by the display name of the group.
+
+const (
+	scimUserSchema   = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema  = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema  = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimContentType  = "application/scim+json"
+	scimMaxResults   = 200
+	scimSource       = "scim"       // Auth source of users, and source of group mappings and grants
+	scimGroupSubject = "scim_group" // Subject type of global access rules
+)
+
+var errUserDeactivated = errors.New("user is deactivated")
+
+// scimFilter matches the only filters identity providers need to find a
+// resource before creating it, e.g. userName eq "ada".
+var scimFilter = regexp.MustCompile(`(?i)^\s*(\w+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type scimUser struct {
+	Schemas  []string     `json:"schemas"`
+	ID       string       `json:"id"`
+	UserName string       `json:"userName"`
+	Active   bool         `json:"active"`
+	Emails   []scimEmail  `json:"emails,omitempty"`
+	Groups   []scimMember `json:"groups,omitempty"`
+	Meta     scimMeta     `json:"meta"`
+}
+
+type scimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members"`
+	Meta        scimMeta     `json:"meta"`
+}
+
+type scimList[T any] struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []T      `json:"Resources"`
+}
+
+// scimUserRequest is the body of POST and PUT requests for users.
+// Attributes this server does not keep, such as names, are ignored.
+type scimUserRequest struct {
+	UserName string      `json:"userName"`
+	Active   *bool       `json:"active"`
+	Emails   []scimEmail `json:"emails"`
+}
+
+// scimGroupRequest is the body of POST and PUT requests for groups.
+type scimGroupRequest struct {
+	DisplayName string       `json:"displayName"`
+	ExternalID  string       `json:"externalId"`
+	Members     []scimMember `json:"members"`
+}
+
+// scimPatch is the body of PATCH requests. Values are decoded by the path
+// they apply to.
+type scimPatch struct {
+	Operations []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	} `json:"Operations"`
+}
+
+// scimOnly answers 404 while SCIM is not enabled.
+func (h *Handler) scimOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.config.Auth.SCIM.Enabled {
+			h.scimError(w, http.StatusNotFound, "", "SCIM is not enabled")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (h *Handler) scimResponse(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// scimError answers with a SCIM error; scimType is empty or one of the
+// types of RFC 7644, such as "uniqueness".
+func (h *Handler) scimError(w http.ResponseWriter, status int, scimType, detail string) {
+	body := map[string]any{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	h.scimResponse(w, status, body)
+}
+
+// scimPage returns the 1-based start index and count of a list request.
+func scimPage(r *http.Request) (start, count int) {
+	start, count = 1, scimMaxResults
+	if n, err := strconv.Atoi(r.URL.Query().Get("startIndex")); err == nil && n > 1 {
+		start = n
+	}
+	if n, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil && n >= 0 && n < scimMaxResults {
+		count = n
+	}
+	return start, count
+}
+
+// writeSCIMList answers a list request with the page of resources it asks
+// for.
+func writeSCIMList[T any](h *Handler, w http.ResponseWriter, r *http.Request, resources []T) {
+	start, count := scimPage(r)
+	page := []T{}
+	if start <= len(resources) {
+		page = resources[start-1 : min(len(resources), start-1+count)]
+	}
+	h.scimResponse(w, http.StatusOK, scimList[T]{
+		Schemas:      []string{scimListSchema},
+		TotalResults: len(resources),
+		StartIndex:   start,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	})
+}
+
+// parseSCIMFilter returns the attribute and value of an eq filter. An
+// empty filter matches everything.
+func parseSCIMFilter(filter string) (attr, value string, ok bool) {
+	if filter == "" {
+		return "", "", true
+	}
+	m := scimFilter.FindStringSubmatch(filter)
+	if m == nil {
+		return "", "", false
+	}
+	value, err := strconv.Unquote(`"` + m[2] + `"`)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.ToLower(m[1]), value, true
+}
+
+// parseSCIMBool accepts booleans and, as some providers send them, the
+// strings "True" and "False".
+func parseSCIMBool(raw json.RawMessage) (bool, bool) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, true
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if v, err := strconv.ParseBool(s); err == nil {
+			return v, true
+		}
+	}
+	return false, false
+}
+
+// primaryEmail returns the primary email address, or else the first.
+func primaryEmail(emails []scimEmail) string {
+	for _, e := range emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+func scimTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func (h *Handler) handleSCIMServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	supported := func(b bool) map[string]bool { return map[string]bool{"supported": b} }
+	h.scimResponse(w, http.StatusOK, map[string]any{
+		"schemas":        []string{scimConfigSchema},
+		"patch":          supported(true),
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "API token",
+			"description": "An API token of an admin with the scim scope",
+			"primary":     true,
+		}},
+		"meta": map[string]string{"resourceType": "ServiceProviderConfig", "location": h.publicURL(r) + "/scim/v2/ServiceProviderConfig"},
+	})
+}
+
+// scimUserResource renders a user with the groups it is a member of.
+func (h *Handler) scimUserResource(ctx context.Context, r *http.Request, user *database.User) scimUser {
+	id := strconv.FormatInt(user.ID, 10)
+	res := scimUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       id,
+		UserName: user.Username,
+		Active:   !user.Deactivated,
+		Meta: scimMeta{
+			ResourceType: "User",
+			Created:      scimTime(user.CreatedAt),
+			LastModified: scimTime(user.UpdatedAt),
+			Location:     h.publicURL(r) + "/scim/v2/Users/" + id,
+		},
+	}
+	if user.Email != "" {
+		res.Emails = []scimEmail{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	groups, err := h.scimGroups.ListByUser(ctx, user.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing SCIM groups of user", "error", err)
+	}
+	for _, g := range groups {
+		res.Groups = append(res.Groups, scimMember{Value: strconv.FormatInt(g.ID, 10), Display: g.DisplayName})
+	}
+	return res
+}
+
+// scimUser returns the user of the {id} path value. Robots are not managed
+// over SCIM.
+func (h *Handler) scimUser(w http.ResponseWriter, r *http.Request) *database.User {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err == nil {
+		if user, err := h.users.GetByID(r.Context(), id); err == nil && !user.IsRobot {
+			return user
+		}
+	}
+	h.scimError(w, http.StatusNotFound, "", "User not found")
+	return nil
+}
+
+func (h *Handler) handleSCIMListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	attr, value, ok := parseSCIMFilter(r.URL.Query().Get("filter"))
+	if !ok || (attr != "" && attr != "username") {
+		h.scimError(w, http.StatusBadRequest, "invalidFilter", "Only filters of the form userName eq \"name\" are supported")
+		return
+	}
+	users, err := h.users.List(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing users", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to list users")
+		return
+	}
+	resources := []scimUser{}
+	for i := range users {
+		if attr == "" || strings.EqualFold(users[i].Username, value) {
+			resources = append(resources, h.scimUserResource(ctx, r, &users[i]))
+		}
+	}
+	writeSCIMList(h, w, r, resources)
+}
+
+func (h *Handler) handleSCIMGetUser(w http.ResponseWriter, r *http.Request) {
+	user := h.scimUser(w, r)
+	if user == nil {
+		return
+	}
+	h.scimResponse(w, http.StatusOK, h.scimUserResource(r.Context(), r, user))
+}
+
+// handleSCIMCreateUser creates a user with the default role of SCIM users.
+// The user logs in through one of the external sources.
+func (h *Handler) handleSCIMCreateUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	caller := auth.UserFromContext(ctx)
+
+	var req scimUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserName == "" {
+		h.scimError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+	if _, err := h.users.GetByUsername(ctx, req.UserName); err == nil {
+		h.scimError(w, http.StatusConflict, "uniqueness", "User "+req.UserName+" already exists")
+		return
+	}
+
+	role := h.config.Auth.SCIM.DefaultRole
+	if !isUserRole(role) {
+		role = "viewer"
+	}
+	user := &database.User{
+		Username:    req.UserName,
+		Email:       primaryEmail(req.Emails),
+		AuthSource:  scimSource,
+		Role:        role,
+		Deactivated: req.Active != nil && !*req.Active,
+	}
+	if err := h.users.Create(ctx, user); err != nil {
+		h.logger.ErrorContext(ctx, "creating user via SCIM", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to create user")
+		return
+	}
+	h.audit(ctx, "user.create", caller.Username, user.Username+": "+role+" (SCIM)")
+
+	res := h.scimUserResource(ctx, r, user)
+	w.Header().Set("Location", res.Meta.Location)
+	h.scimResponse(w, http.StatusCreated, res)
+}
+
+// handleSCIMReplaceUser replaces the user name, email address and active
+// state of a user.
+func (h *Handler) handleSCIMReplaceUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := h.scimUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req scimUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserName == "" {
+		h.scimError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+	email := primaryEmail(req.Emails)
+	active := req.Active == nil || *req.Active
+	if !h.updateSCIMUser(w, r, user, req.UserName, email, active) {
+		return
+	}
+	h.scimResponse(w, http.StatusOK, h.scimUserResource(ctx, r, user))
+}
+
+// handleSCIMPatchUser applies add, replace and remove operations to the
+// user name, email address and active state of a user. Operations on
+// attributes this server does not keep are ignored.
+func (h *Handler) handleSCIMPatchUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := h.scimUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var patch scimPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		h.scimError(w, http.StatusBadRequest, "invalidSyntax", "Invalid PATCH body")
+		return
+	}
+	username, email, active := user.Username, user.Email, !user.Deactivated
+	for _, op := range patch.Operations {
+		kind := strings.ToLower(op.Op)
+		if kind != "add" && kind != "replace" && kind != "remove" {
+			h.scimError(w, http.StatusBadRequest, "invalidSyntax", "Unknown operation "+op.Op)
+			return
+		}
+		values := map[string]json.RawMessage{}
+		if op.Path == "" {
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				h.scimError(w, http.StatusBadRequest, "invalidValue", "Operations without a path need an object value")
+				return
+			}
+		} else {
+			values[op.Path] = op.Value
+		}
+		for path, value := range values {
+			path = strings.ToLower(path)
+			switch {
+			case path == "active":
+				if kind == "remove" {
+					continue
+				}
+				b, ok := parseSCIMBool(value)
+				if !ok {
+					h.scimError(w, http.StatusBadRequest, "invalidValue", "active must be a boolean")
+					return
+				}
+				active = b
+			case path == "username":
+				if kind == "remove" || json.Unmarshal(value, &username) != nil {
+					h.scimError(w, http.StatusBadRequest, "invalidValue", "userName must be a string")
+					return
+				}
+			case path == "emails" || strings.HasPrefix(path, "emails["):
+				if kind == "remove" {
+					email = ""
+					continue
+				}
+				var emails []scimEmail
+				if json.Unmarshal(value, &emails) == nil {
+					email = primaryEmail(emails)
+				} else if json.Unmarshal(value, &email) != nil {
+					h.scimError(w, http.StatusBadRequest, "invalidValue", "Invalid emails value")
+					return
+				}
+			}
+		}
+	}
+	if !h.updateSCIMUser(w, r, user, username, email, active) {
+		return
+	}
+	h.scimResponse(w, http.StatusOK, h.scimUserResource(ctx, r, user))
+}
+
+// updateSCIMUser saves the changes of a PUT or PATCH request, and revokes
+// the sessions and tokens of a user who is deactivated. It answers and
+// returns false if the changes cannot be saved.
+func (h *Handler) updateSCIMUser(w http.ResponseWriter, r *http.Request, user *database.User, username, email string, active bool) bool {
+	ctx := r.Context()
+	caller := auth.UserFromContext(ctx)
+
+	if username == "" {
+		h.scimError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return false
+	}
+	if username != user.Username {
+		if _, err := h.users.GetByUsername(ctx, username); err == nil {
+			h.scimError(w, http.StatusConflict, "uniqueness", "User "+username+" already exists")
+			return false
+		}
+	}
+	wasActive := !user.Deactivated
+	if wasActive && !active && user.ID == caller.ID {
+		h.scimError(w, http.StatusConflict, "mutability", "Cannot deactivate the authenticated user")
+		return false
+	}
+	if username == user.Username && email == user.Email && active == wasActive {
+		return true
+	}
+
+	if username != user.Username {
+		h.audit(ctx, "user.rename", caller.Username, user.Username+" -> "+username+" (SCIM)")
+	}
+	user.Username = username
+	user.Email = email
+	user.Deactivated = !active
+	if err := h.users.Update(ctx, user); err != nil {
+		h.logger.ErrorContext(ctx, "updating user via SCIM", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to update user")
+		return false
+	}
+	switch {
+	case wasActive && !active:
+		h.revokeUserCredentials(ctx, user)
+		h.audit(ctx, "user.deactivate", caller.Username, user.Username+" (SCIM)")
+	case !wasActive && active:
+		h.audit(ctx, "user.activate", caller.Username, user.Username+" (SCIM)")
+	}
+	return true
+}
+
+// revokeUserCredentials ends the sessions of a user and deletes their API
+// and feed tokens, so that a deactivated user is locked out at once.
+func (h *Handler) revokeUserCredentials(ctx context.Context, user *database.User) {
+	if err := h.sessions.DeleteByUser(ctx, user.ID); err != nil {
+		h.logger.ErrorContext(ctx, "deleting sessions", "error", err, "user", user.Username)
+	}
+	if err := h.tokens.DeleteByUser(ctx, user.ID); err != nil {
+		h.logger.ErrorContext(ctx, "deleting tokens", "error", err, "user", user.Username)
+	}
+	if h.watchers != nil {
+		if err := h.watchers.DeleteFeedToken(ctx, user.ID); err != nil {
+			h.logger.ErrorContext(ctx, "deleting feed token", "error", err, "user", user.Username)
+		}
+	}
+}
+
+func (h *Handler) handleSCIMDeleteUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	caller := auth.UserFromContext(ctx)
+	user := h.scimUser(w, r)
+	if user == nil {
+		return
+	}
+	if user.ID == caller.ID {
+		h.scimError(w, http.StatusConflict, "mutability", "Cannot delete the authenticated user")
+		return
+	}
+	if err := h.users.Delete(ctx, user.ID); err != nil {
+		h.logger.ErrorContext(ctx, "deleting user via SCIM", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to delete user")
+		return
+	}
+	h.audit(ctx, "user.delete", caller.Username, user.Username+" (SCIM)")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scimGroupResource renders a group with its members.
+func (h *Handler) scimGroupResource(ctx context.Context, r *http.Request, group *database.SCIMGroup) (scimGroup, error) {
+	id := strconv.FormatInt(group.ID, 10)
+	res := scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          id,
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Members:     []scimMember{},
+		Meta: scimMeta{
+			ResourceType: "Group",
+			Created:      scimTime(group.CreatedAt),
+			LastModified: scimTime(group.UpdatedAt),
+			Location:     h.publicURL(r) + "/scim/v2/Groups/" + id,
+		},
+	}
+	members, err := h.scimGroups.ListMembers(ctx, group.ID)
+	if err != nil {
+		return res, err
+	}
+	for _, userID := range members {
+		member := scimMember{Value: strconv.FormatInt(userID, 10)}
+		if user, err := h.users.GetByID(ctx, userID); err == nil {
+			member.Display = user.Username
+		}
+		res.Members = append(res.Members, member)
+	}
+	return res, nil
+}
+
+func (h *Handler) writeSCIMGroup(w http.ResponseWriter, r *http.Request, status int, group *database.SCIMGroup) {
+	res, err := h.scimGroupResource(r.Context(), r, group)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "listing SCIM group members", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to list group members")
+		return
+	}
+	if status == http.StatusCreated {
+		w.Header().Set("Location", res.Meta.Location)
+	}
+	h.scimResponse(w, status, res)
+}
+
+func (h *Handler) scimGroup(w http.ResponseWriter, r *http.Request) *database.SCIMGroup {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err == nil {
+		if group, err := h.scimGroups.GetByID(r.Context(), id); err == nil {
+			return group
+		}
+	}
+	h.scimError(w, http.StatusNotFound, "", "Group not found")
+	return nil
+}
+
+// scimGroupNamed returns the group with a display name, if any.
+func (h *Handler) scimGroupNamed(ctx context.Context, name string) (*database.SCIMGroup, error) {
+	groups, err := h.scimGroups.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		if strings.EqualFold(groups[i].DisplayName, name) {
+			return &groups[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// scimMemberIDs resolves the members of a request to users. It answers
+// and returns false if one is not a user managed over SCIM.
+func (h *Handler) scimMemberIDs(w http.ResponseWriter, r *http.Request, members []scimMember) ([]int64, bool) {
+	var ids []int64
+	for _, m := range members {
+		id, err := strconv.ParseInt(m.Value, 10, 64)
+		if err == nil {
+			if user, err := h.users.GetByID(r.Context(), id); err == nil && !user.IsRobot {
+				if !slices.Contains(ids, id) {
+					ids = append(ids, id)
+				}
+				continue
+			}
+		}
+		h.scimError(w, http.StatusBadRequest, "invalidValue", "Unknown member "+m.Value)
+		return nil, false
+	}
+	return ids, true
+}
+
+func (h *Handler) handleSCIMListGroups(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	attr, value, ok := parseSCIMFilter(r.URL.Query().Get("filter"))
+	if !ok || (attr != "" && attr != "displayname") {
+		h.scimError(w, http.StatusBadRequest, "invalidFilter", "Only filters of the form displayName eq \"name\" are supported")
+		return
+	}
+	groups, err := h.scimGroups.List(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing SCIM groups", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to list groups")
+		return
+	}
+	resources := []scimGroup{}
+	for i := range groups {
+		if attr != "" && !strings.EqualFold(groups[i].DisplayName, value) {
+			continue
+		}
+		res, err := h.scimGroupResource(ctx, r, &groups[i])
+		if err != nil {
+			h.logger.ErrorContext(ctx, "listing SCIM group members", "error", err)
+			h.scimError(w, http.StatusInternalServerError, "", "Failed to list groups")
+			return
+		}
+		resources = append(resources, res)
+	}
+	writeSCIMList(h, w, r, resources)
+}
+
+func (h *Handler) handleSCIMGetGroup(w http.ResponseWriter, r *http.Request) {
+	if group := h.scimGroup(w, r); group != nil {
+		h.writeSCIMGroup(w, r, http.StatusOK, group)
+	}
+}
+
+func (h *Handler) handleSCIMCreateGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	caller := auth.UserFromContext(ctx)
+
+	var req scimGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DisplayName == "" {
+		h.scimError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	existing, err := h.scimGroupNamed(ctx, req.DisplayName)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing SCIM groups", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to list groups")
+		return
+	}
+	if existing != nil {
+		h.scimError(w, http.StatusConflict, "uniqueness", "Group "+req.DisplayName+" already exists")
+		return
+	}
+	members, ok := h.scimMemberIDs(w, r, req.Members)
+	if !ok {
+		return
+	}
+
+	group := &database.SCIMGroup{DisplayName: req.DisplayName, ExternalID: req.ExternalID}
+	if err := h.scimGroups.Create(ctx, group); err != nil {
+		h.logger.ErrorContext(ctx, "creating SCIM group", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to create group")
+		return
+	}
+	if !h.setSCIMGroupMembers(w, r, group, nil, members) {
+		return
+	}
+	h.audit(ctx, "scim.group.create", caller.Username, group.DisplayName)
+	if group, err := h.scimGroups.GetByID(ctx, group.ID); err == nil {
+		h.writeSCIMGroup(w, r, http.StatusCreated, group)
+	}
+}
+
+// handleSCIMReplaceGroup replaces the display name and members of a group.
+func (h *Handler) handleSCIMReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	group := h.scimGroup(w, r)
+	if group == nil {
+		return
+	}
+
+	var req scimGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DisplayName == "" {
+		h.scimError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	members, ok := h.scimMemberIDs(w, r, req.Members)
+	if !ok {
+		return
+	}
+	group.ExternalID = req.ExternalID
+	if h.updateSCIMGroup(w, r, group, req.DisplayName, members) {
+		h.writeSCIMGroup(w, r, http.StatusOK, group)
+	}
+}
+
+// handleSCIMPatchGroup applies operations on the display name and members
+// of a group, e.g. adding a member or removing one by
+// members[value eq "12"].
+func (h *Handler) handleSCIMPatchGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	group := h.scimGroup(w, r)
+	if group == nil {
+		return
+	}
+	members, err := h.scimGroups.ListMembers(ctx, group.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing SCIM group members", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to list group members")
+		return
+	}
+
+	var patch scimPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		h.scimError(w, http.StatusBadRequest, "invalidSyntax", "Invalid PATCH body")
+		return
+	}
+	name := group.DisplayName
+	for _, op := range patch.Operations {
+		kind := strings.ToLower(op.Op)
+		values := map[string]json.RawMessage{}
+		if op.Path == "" {
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				h.scimError(w, http.StatusBadRequest, "invalidValue", "Operations without a path need an object value")
+				return
+			}
+		} else {
+			values[op.Path] = op.Value
+		}
+		for path, value := range values {
+			lower := strings.ToLower(path)
+			switch {
+			case lower == "displayname":
+				if kind != "add" && kind != "replace" {
+					h.scimError(w, http.StatusBadRequest, "invalidValue", "displayName can only be added or replaced")
+					return
+				}
+				if json.Unmarshal(value, &name) != nil || name == "" {
+					h.scimError(w, http.StatusBadRequest, "invalidValue", "displayName must be a string")
+					return
+				}
+			case lower == "externalid":
+				switch kind {
+				case "add", "replace":
+					if json.Unmarshal(value, &group.ExternalID) != nil {
+						h.scimError(w, http.StatusBadRequest, "invalidValue", "externalId must be a string")
+						return
+					}
+				case "remove":
+					group.ExternalID = ""
+				default:
+					h.scimError(w, http.StatusBadRequest, "invalidValue", "Unsupported operation "+op.Op+" on externalId")
+					return
+				}
+			case lower == "members":
+				var listed []scimMember
+				if len(value) > 0 && json.Unmarshal(value, &listed) != nil {
+					h.scimError(w, http.StatusBadRequest, "invalidValue", "members must be a list")
+					return
+				}
+				ids, ok := h.scimMemberIDs(w, r, listed)
+				if !ok {
+					return
+				}
+				switch kind {
+				case "add":
+					for _, id := range ids {
+						if !slices.Contains(members, id) {
+							members = append(members, id)
+						}
+					}
+				case "replace":
+					members = ids
+				case "remove":
+					if len(value) == 0 {
+						members = nil
+					}
+					members = slices.DeleteFunc(members, func(id int64) bool { return slices.Contains(ids, id) })
+				default:
+					h.scimError(w, http.StatusBadRequest, "invalidSyntax", "Unknown operation "+op.Op)
+					return
+				}
+			case strings.HasPrefix(lower, "members[") && kind == "remove":
+				// members[value eq "12"]
+				_, value, ok := parseSCIMFilter(strings.TrimSuffix(path[len("members["):], "]"))
+				id, err := strconv.ParseInt(value, 10, 64)
+				if !ok || err != nil {
+					h.scimError(w, http.StatusBadRequest, "invalidPath", "Invalid path "+path)
+					return
+				}
+				members = slices.DeleteFunc(members, func(m int64) bool { return m == id })
+			}
+		}
+	}
+	if h.updateSCIMGroup(w, r, group, name, members) {
+		h.writeSCIMGroup(w, r, http.StatusOK, group)
+	}
+}
+
+// updateSCIMGroup saves the display name and members of a group. It
+// answers and returns false if they cannot be saved.
+func (h *Handler) updateSCIMGroup(w http.ResponseWriter, r *http.Request, group *database.SCIMGroup, name string, members []int64) bool {
+	ctx := r.Context()
+	caller := auth.UserFromContext(ctx)
+
+	if !strings.EqualFold(name, group.DisplayName) {
+		existing, err := h.scimGroupNamed(ctx, name)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "listing SCIM groups", "error", err)
+			h.scimError(w, http.StatusInternalServerError, "", "Failed to list groups")
+			return false
+		}
+		if existing != nil {
+			h.scimError(w, http.StatusConflict, "uniqueness", "Group "+name+" already exists")
+			return false
+		}
+	}
+	previous, err := h.scimGroups.ListMembers(ctx, group.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing SCIM group members", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to list group members")
+		return false
+	}
+	if name != group.DisplayName {
+		h.audit(ctx, "scim.group.rename", caller.Username, group.DisplayName+" -> "+name)
+	}
+	group.DisplayName = name
+	if err := h.scimGroups.Update(ctx, group); err != nil {
+		h.logger.ErrorContext(ctx, "updating SCIM group", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to update group")
+		return false
+	}
+	// A rename changes which mappings apply to every member
+	if !h.setSCIMGroupMembers(w, r, group, previous, members) {
+		return false
+	}
+	if updated, err := h.scimGroups.GetByID(ctx, group.ID); err == nil {
+		*group = *updated
+	}
+	return true
+}
+
+// setSCIMGroupMembers saves the members of a group and syncs the access
+// of everyone who was or is a member.
+func (h *Handler) setSCIMGroupMembers(w http.ResponseWriter, r *http.Request, group *database.SCIMGroup, previous, members []int64) bool {
+	ctx := r.Context()
+	if err := h.scimGroups.SetMembers(ctx, group.ID, members); err != nil {
+		h.logger.ErrorContext(ctx, "setting SCIM group members", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to set group members")
+		return false
+	}
+	affected := make(map[int64]bool)
+	for _, userID := range append(slices.Clone(previous), members...) {
+		if !affected[userID] {
+			affected[userID] = true
+			h.syncSCIMAccess(ctx, userID)
+		}
+	}
+	return true
+}
+
+func (h *Handler) handleSCIMDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	caller := auth.UserFromContext(ctx)
+	group := h.scimGroup(w, r)
+	if group == nil {
+		return
+	}
+	members, err := h.scimGroups.ListMembers(ctx, group.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing SCIM group members", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to list group members")
+		return
+	}
+	if err := h.scimGroups.Delete(ctx, group.ID); err != nil {
+		h.logger.ErrorContext(ctx, "deleting SCIM group", "error", err)
+		h.scimError(w, http.StatusInternalServerError, "", "Failed to delete group")
+		return
+	}
+	for _, userID := range members {
+		h.syncSCIMAccess(ctx, userID)
+	}
+	h.audit(ctx, "scim.group.delete", caller.Username, group.DisplayName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// syncSCIMMembers syncs the access of all members of SCIM groups, after a
+// mapping or rule of the scim source changed. The other sources sync at
+// the next login instead.
+func (h *Handler) syncSCIMMembers(ctx context.Context) {
+	if !h.config.Auth.SCIM.Enabled || h.scimGroups == nil {
+		return
+	}
+	groups, err := h.scimGroups.List(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing SCIM groups", "error", err)
+		return
+	}
+	synced := make(map[int64]bool)
+	for _, g := range groups {
+		members, err := h.scimGroups.ListMembers(ctx, g.ID)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "listing SCIM group members", "error", err)
+			continue
+		}
+		for _, userID := range members {
+			if !synced[userID] {
+				synced[userID] = true
+				h.syncSCIMAccess(ctx, userID)
+			}
+		}
+	}
+}
+
+// syncSCIMAccess grants a user the project access mapped to their SCIM
+// groups and the highest role of the scim_group global access rules, and
+// revokes what came from groups they left, like the login of the other
+// sources does.
+func (h *Handler) syncSCIMAccess(ctx context.Context, userID int64) {
+	groups, err := h.scimGroups.ListByUser(ctx, userID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing SCIM groups of user", "error", err)
+		return
+	}
+	isMember := func(name string) bool {
+		return slices.ContainsFunc(groups, func(g database.SCIMGroup) bool { return strings.EqualFold(g.DisplayName, name) })
+	}
+
+	mappings, err := h.groupMappings.ListBySource(ctx, scimSource)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing SCIM group mappings", "error", err)
+		return
+	}
+	granted := make(map[int64]string)
+	for _, m := range mappings {
+		if isMember(m.GroupIdentifier) && auth.RoleHigher(m.Role, granted[m.ProjectID]) {
+			granted[m.ProjectID] = m.Role
+		}
+	}
+	existing, err := h.access.ListByUserAndSource(ctx, userID, scimSource)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing SCIM project access", "error", err)
+		return
+	}
+	for projectID, role := range granted {
+		if !slices.ContainsFunc(existing, func(a database.ProjectAccess) bool { return a.ProjectID == projectID && a.Role == role }) {
+			access := &database.ProjectAccess{ProjectID: projectID, UserID: userID, Role: role, Source: scimSource}
+			if err := h.access.Grant(ctx, access); err != nil {
+				h.logger.WarnContext(ctx, "granting SCIM project access", "project_id", projectID, "error", err)
+			}
+		}
+	}
+	for _, a := range existing {
+		if _, ok := granted[a.ProjectID]; !ok {
+			if err := h.access.RevokeBySource(ctx, a.ProjectID, userID, scimSource); err != nil {
+				h.logger.WarnContext(ctx, "revoking SCIM project access", "project_id", a.ProjectID, "error", err)
+			}
+		}
+	}
+
+	if h.globalAccess == nil {
+		return
+	}
+	rules, err := h.globalAccess.ListRules(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing global access rules", "error", err)
+		return
+	}
+	best := ""
+	for _, rule := range rules {
+		if rule.SubjectType == scimGroupSubject && isMember(rule.SubjectIdentifier) && auth.RoleHigher(rule.Role, best) {
+			best = rule.Role
+		}
+	}
+	if best == "" {
+		err = h.globalAccess.DeleteGrantsBySource(ctx, userID, scimSource)
+	} else {
+		err = h.globalAccess.UpsertGrant(ctx, &database.GlobalAccessGrant{UserID: userID, Role: best, Source: scimSource})
+	}
+	if err != nil {
+		h.logger.ErrorContext(ctx, "syncing SCIM global access", "error", err)
+	}
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// scimToken enables SCIM and creates a token with the scim scope for an
+// admin robot, as identity providers are given.
+func scimToken(t *testing.T, app *testApp) string {
+	t.Helper()
+	ctx := context.Background()
+	app.handler.config.Auth.SCIM.Enabled = true
+	robot := &database.User{Username: "idp", AuthSource: "robot", Role: "admin", IsRobot: true}
+	if err := app.handler.users.Create(ctx, robot); err != nil {
+		t.Fatal(err)
+	}
+	rawToken, _ := auth.GenerateToken(32)
+	app.handler.tokens.Create(ctx, &database.APIToken{
+		UserID:    robot.ID,
+		TokenHash: auth.HashToken(rawToken),
+		Name:      "idp",
+		Scopes:    auth.ScopeSCIM,
+	})
+	return rawToken
+}
+
+// scimCall makes a SCIM request and decodes the response into out, if
+// given.
+func scimCall(t *testing.T, app *testApp, method, path, token, body string, out any) int {
+	t.Helper()
+	resp := apiRequest(t, app, method, path, token, body, nil)
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func TestSCIMUsers(t *testing.T) {
+	app := setupTestApp(t)
+	token := scimToken(t, app)
+	app.handler.config.Auth.SCIM.Enabled = false
+	if status := scimCall(t, app, "GET", "/scim/v2/Users", token, "", nil); status != http.StatusNotFound {
+		t.Errorf("expected 404 while SCIM is off, got %d", status)
+	}
+	app.handler.config.Auth.SCIM.Enabled = true
+
+	var created scimUser
+	status := scimCall(t, app, "POST", "/scim/v2/Users", token, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "ada", "active": true, "emails": [{"value": "ada@example.com", "primary": true}]}`, &created)
+	if status != http.StatusCreated || created.UserName != "ada" || !created.Active || created.Emails[0].Value != "ada@example.com" {
+		t.Fatalf("expected ada to be created, got %d %+v", status, created)
+	}
+	user, _ := app.handler.users.GetByUsername(context.Background(), "ada")
+	if user.AuthSource != "scim" || user.Role != "viewer" {
+		t.Errorf("expected a SCIM viewer, got %+v", user)
+	}
+	if status := scimCall(t, app, "POST", "/scim/v2/Users", token, `{"userName": "ada"}`, nil); status != http.StatusConflict {
+		t.Errorf("expected 409 for an existing user, got %d", status)
+	}
+
+	var list scimList[scimUser]
+	scimCall(t, app, "GET", `/scim/v2/Users?filter=userName+eq+%22ADA%22`, token, "", &list)
+	if list.TotalResults != 1 || list.Resources[0].ID != created.ID {
+		t.Errorf("expected the filter to find ada, got %+v", list)
+	}
+	if status := scimCall(t, app, "GET", `/scim/v2/Users?filter=name.givenName+sw+%22A%22`, token, "", nil); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unsupported filter, got %d", status)
+	}
+
+	var patched scimUser
+	scimCall(t, app, "PATCH", "/scim/v2/Users/"+created.ID, token, `{"Operations": [{"op": "Replace", "path": "emails[type eq \"work\"].value", "value": "lovelace@example.com"}, {"op": "replace", "path": "name.familyName", "value": "Lovelace"}]}`, &patched)
+	if patched.Emails[0].Value != "lovelace@example.com" {
+		t.Errorf("expected the email to change, got %+v", patched)
+	}
+
+	if status := scimCall(t, app, "DELETE", "/scim/v2/Users/"+created.ID, token, "", nil); status != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", status)
+	}
+	if status := scimCall(t, app, "GET", "/scim/v2/Users/"+created.ID, token, "", nil); status != http.StatusNotFound {
+		t.Errorf("expected the user to be gone, got %d", status)
+	}
+}
+
+func TestSCIMDeactivationRevokesAccess(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := scimToken(t, app)
+
+	hash, _ := auth.HashPassword("secret")
+	user := &database.User{Username: "ada", Password: &hash, AuthSource: "builtin", Role: "viewer"}
+	app.handler.users.Create(ctx, user)
+	session := loginUser(t, app, "ada", "secret")
+	rawToken, _ := auth.GenerateToken(32)
+	app.handler.tokens.Create(ctx, &database.APIToken{UserID: user.ID, TokenHash: auth.HashToken(rawToken), Name: "ci", Scopes: auth.ScopeRead})
+
+	id := strconv.FormatInt(user.ID, 10)
+	var patched scimUser
+	scimCall(t, app, "PATCH", "/scim/v2/Users/"+id, token, `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": [{"op": "Replace", "path": "active", "value": "False"}]}`, &patched)
+	if patched.Active {
+		t.Fatalf("expected ada to be deactivated, got %+v", patched)
+	}
+
+	if status := profileStatus(t, app, session); status == http.StatusOK {
+		t.Error("expected the session to end")
+	}
+	if status := scimCall(t, app, "GET", "/api/projects", rawToken, "", nil); status != http.StatusUnauthorized {
+		t.Errorf("expected the API token to be revoked, got %d", status)
+	}
+	if cookies := loginUser(t, app, "ada", "secret"); len(cookies) != 0 {
+		t.Error("expected a deactivated user not to log in")
+	}
+
+	scimCall(t, app, "PUT", "/scim/v2/Users/"+id, token, `{"userName": "ada", "active": true}`, &patched)
+	if !patched.Active {
+		t.Fatalf("expected ada to be active again, got %+v", patched)
+	}
+	if cookies := loginUser(t, app, "ada", "secret"); len(cookies) == 0 {
+		t.Error("expected a reactivated user to log in")
+	}
+}
+
+func TestSCIMGroupsGrantAccess(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := scimToken(t, app)
+	project := seedProject(t, app, "handbook", "Handbook", false)
+	app.handler.groupMappings.Create(ctx, &database.AuthGroupMapping{AuthSource: "scim", GroupIdentifier: "Writers", ProjectID: project.ID, Role: "editor"})
+
+	var ada, bob scimUser
+	scimCall(t, app, "POST", "/scim/v2/Users", token, `{"userName": "ada"}`, &ada)
+	scimCall(t, app, "POST", "/scim/v2/Users", token, `{"userName": "bob"}`, &bob)
+	adaID, _ := strconv.ParseInt(ada.ID, 10, 64)
+	bobID, _ := strconv.ParseInt(bob.ID, 10, 64)
+	role := func(userID int64) string {
+		access, err := app.handler.access.GetAccessBySource(ctx, project.ID, userID, "scim")
+		if err != nil {
+			return ""
+		}
+		return access.Role
+	}
+
+	var group scimGroup
+	status := scimCall(t, app, "POST", "/scim/v2/Groups", token, `{"displayName": "Writers", "members": [{"value": "`+ada.ID+`"}]}`, &group)
+	if status != http.StatusCreated || len(group.Members) != 1 || group.Members[0].Display != "ada" {
+		t.Fatalf("expected the group to be created, got %d %+v", status, group)
+	}
+	if role(adaID) != "editor" {
+		t.Error("expected the group member to get the mapped access")
+	}
+	if status := scimCall(t, app, "POST", "/scim/v2/Groups", token, `{"displayName": "writers"}`, nil); status != http.StatusConflict {
+		t.Errorf("expected 409 for an existing group, got %d", status)
+	}
+	if status := scimCall(t, app, "POST", "/scim/v2/Groups", token, `{"displayName": "Readers", "members": [{"value": "999"}]}`, nil); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown member, got %d", status)
+	}
+
+	scimCall(t, app, "PATCH", "/scim/v2/Groups/"+group.ID, token, `{"Operations": [{"op": "add", "path": "members", "value": [{"value": "`+bob.ID+`"}]}, {"op": "remove", "path": "members[value eq \"`+ada.ID+`\"]"}]}`, &group)
+	if len(group.Members) != 1 || group.Members[0].Value != bob.ID {
+		t.Errorf("expected bob to replace ada, got %+v", group.Members)
+	}
+	if role(adaID) != "" || role(bobID) != "editor" {
+		t.Errorf("expected access to follow the members, got ada %q bob %q", role(adaID), role(bobID))
+	}
+
+	var user scimUser
+	scimCall(t, app, "GET", "/scim/v2/Users/"+bob.ID, token, "", &user)
+	if len(user.Groups) != 1 || user.Groups[0].Display != "Writers" {
+		t.Errorf("expected bob's groups on the user, got %+v", user.Groups)
+	}
+
+	scimCall(t, app, "DELETE", "/scim/v2/Groups/"+group.ID, token, "", nil)
+	if role(bobID) != "" {
+		t.Error("expected access to end with the group")
+	}
+}
+
+func TestSCIMPatchGroupAttributes(t *testing.T) {
+	app := setupTestApp(t)
+	token := scimToken(t, app)
+
+	var group scimGroup
+	scimCall(t, app, "POST", "/scim/v2/Groups", token, `{"displayName": "Writers", "externalId": "w-1"}`, &group)
+	patch := func(ops string) (int, map[string]any) {
+		t.Helper()
+		var out map[string]any
+		status := scimCall(t, app, "PATCH", "/scim/v2/Groups/"+group.ID, token, `{"Operations": [`+ops+`]}`, &out)
+		return status, out
+	}
+
+	if status, _ := patch(`{"op": "replace", "value": {"displayName": "Authors", "externalId": "a-1"}}`); status != http.StatusOK {
+		t.Fatalf("expected the group to be renamed, got %d", status)
+	}
+	if status, _ := patch(`{"op": "remove", "path": "externalId"}`); status != http.StatusOK {
+		t.Fatalf("expected the externalId to be removed, got %d", status)
+	}
+	saved, _ := app.handler.scimGroups.GetByID(context.Background(), mustParseID(t, group.ID))
+	if saved.DisplayName != "Authors" || saved.ExternalID != "" {
+		t.Errorf("expected Authors without an externalId, got %+v", saved)
+	}
+
+	for _, ops := range []string{
+		`{"op": "remove", "path": "displayName"}`,
+		`{"op": "copy", "path": "displayName", "value": "Editors"}`,
+		`{"op": "copy", "path": "externalId", "value": "e-1"}`,
+		`{"op": "add", "path": "externalId", "value": 12}`,
+	} {
+		status, out := patch(ops)
+		if status != http.StatusBadRequest || out["scimType"] != "invalidValue" {
+			t.Errorf("%s: expected 400 invalidValue, got %d %v", ops, status, out)
+		}
+	}
+	saved, _ = app.handler.scimGroups.GetByID(context.Background(), saved.ID)
+	if saved.DisplayName != "Authors" || saved.ExternalID != "" {
+		t.Errorf("expected refused operations to change nothing, got %+v", saved)
+	}
+}
+
+func mustParseID(t *testing.T, id string) int64 {
+	t.Helper()
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSCIMRequiresScope(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.Auth.SCIM.Enabled = true
+	token := adminAPIToken(t, app)
+	readOnly, _ := auth.GenerateToken(32)
+	robot, _ := app.handler.users.GetByUsername(context.Background(), "terraform")
+	app.handler.tokens.Create(context.Background(), &database.APIToken{UserID: robot.ID, TokenHash: auth.HashToken(readOnly), Name: "read", Scopes: auth.ScopeRead})
+
+	if status := scimCall(t, app, "GET", "/scim/v2/Users", readOnly, "", nil); status != http.StatusForbidden {
+		t.Errorf("expected 403 without the scim scope, got %d", status)
+	}
+	// admin:project implies the project scopes only
+	if status := scimCall(t, app, "GET", "/scim/v2/Users", token, "", nil); status != http.StatusForbidden {
+		t.Errorf("expected 403 with admin:project, got %d", status)
+	}
+}
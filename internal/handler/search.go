@@ -2,10 +2,9 @@ package handler
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/qwc/asiakirjat/internal/auth"
 	"github.com/qwc/asiakirjat/internal/database"
@@ -45,21 +44,26 @@ func (h *Handler) handleAPISearch(w http.ResponseWriter, r *http.Request) {
 		ProjectSlug: projectSlug,
 		VersionTag:  versionTag,
 		AllVersions: allVersions,
+		Metadata:    metadataFilter(r.URL.Query()),
 		Limit:       limit,
 		Offset:      offset,
 	}
 
 	latestTags := h.getLatestVersionTags(ctx)
 
-	results, err := h.searchIndex.Search(sq, latestTags)
+	results, err := h.searchIndex.Search(ctx, sq, latestTags)
+	if ctx.Err() != nil {
+		return // client went away
+	}
 	if err != nil {
-		h.logger.Error("search failed", "error", err)
+		h.logger.ErrorContext(ctx, "search failed", "error", err)
 		h.jsonError(w, "Search failed", http.StatusInternalServerError)
 		return
 	}
 
 	// Filter results by user's project access
-	results = h.filterSearchResults(ctx, user, results)
+	includeRetired := projectSlug != "" || r.URL.Query().Get("include_deprecated") == "1"
+	results = h.filterSearchResults(ctx, user, results, includeRetired)
 
 	h.jsonResponse(w, results)
 }
@@ -72,6 +76,7 @@ func (h *Handler) handleSearchPage(w http.ResponseWriter, r *http.Request) {
 	projectSlug := r.URL.Query().Get("project")
 	versionTag := r.URL.Query().Get("version")
 	allVersions := r.URL.Query().Get("all_versions") == "1"
+	includeDeprecated := r.URL.Query().Get("include_deprecated") == "1"
 
 	limit := 20
 	if l := r.URL.Query().Get("limit"); l != "" {
@@ -91,7 +96,7 @@ func (h *Handler) handleSearchPage(w http.ResponseWriter, r *http.Request) {
 	allProjects, _ := h.projects.List(ctx)
 	var accessibleProjects []database.Project
 	for _, p := range allProjects {
-		if h.canViewProject(ctx, user, &p) {
+		if h.canListProject(ctx, user, &p) {
 			accessibleProjects = append(accessibleProjects, p)
 		}
 	}
@@ -101,26 +106,24 @@ func (h *Handler) handleSearchPage(w http.ResponseWriter, r *http.Request) {
 	if projectSlug != "" {
 		project, err := h.projects.GetBySlug(ctx, projectSlug)
 		if err == nil {
-			versions, _ := h.versions.ListByProject(ctx, project.ID)
-			tags := make([]string, len(versions))
-			for i, v := range versions {
-				tags[i] = v.Tag
+			versions, _ := h.sortedVersions(ctx, project.ID)
+			for _, v := range versions {
+				projectVersions = append(projectVersions, v.Tag)
 			}
-			docs.SortVersionTags(tags)
-			projectVersions = tags
 		}
 	}
 
 	data := map[string]any{
-		"User":            user,
-		"Query":           q,
-		"Project":         projectSlug,
-		"Version":         versionTag,
-		"AllVersions":     allVersions,
-		"Limit":           limit,
-		"Offset":          offset,
-		"Projects":        accessibleProjects,
-		"ProjectVersions": projectVersions,
+		"User":              user,
+		"Query":             q,
+		"Project":           projectSlug,
+		"Version":           versionTag,
+		"AllVersions":       allVersions,
+		"IncludeDeprecated": includeDeprecated,
+		"Limit":             limit,
+		"Offset":            offset,
+		"Projects":          accessibleProjects,
+		"ProjectVersions":   projectVersions,
 	}
 
 	if q != "" {
@@ -141,18 +144,22 @@ func (h *Handler) handleSearchPage(w http.ResponseWriter, r *http.Request) {
 			ProjectSlug: projectSlug,
 			VersionTag:  searchVersionTag,
 			AllVersions: searchAllVersions,
+			Metadata:    metadataFilter(r.URL.Query()),
 			Limit:       limit,
 			Offset:      offset,
 		}
 
 		latestTags := h.getLatestVersionTags(ctx)
 
-		results, err := h.searchIndex.Search(sq, latestTags)
+		results, err := h.searchIndex.Search(ctx, sq, latestTags)
+		if ctx.Err() != nil {
+			return // client went away
+		}
 		if err != nil {
-			h.logger.Error("search failed", "error", err)
+			h.logger.ErrorContext(ctx, "search failed", "error", err)
 			data["Error"] = "Search failed"
 		} else {
-			results = h.filterSearchResults(ctx, user, results)
+			results = h.filterSearchResults(ctx, user, results, includeDeprecated || projectSlug != "")
 			data["Results"] = results.Results
 			data["Total"] = results.Total
 			data["HasPrev"] = offset > 0
@@ -165,128 +172,167 @@ func (h *Handler) handleSearchPage(w http.ResponseWriter, r *http.Request) {
 	h.render(w, "search", data)
 }
 
+// handleAdminReindex rebuilds the whole search index, or with changed=1
+// indexes the versions changed since they were indexed again. An outdated
+// index is always rebuilt, as only a rebuild applies the analysis settings.
 func (h *Handler) handleAdminReindex(w http.ResponseWriter, r *http.Request) {
+	if h.refuseDuringShutdown(w, false) {
+		return
+	}
 	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
 
 	// Check if reindex is already running
-	if h.reindexRunning {
+	if h.reindex.running() {
 		h.redirect(w, r, "/admin/projects?msg=reindex_already_running", http.StatusSeeOther)
 		return
 	}
 
-	allProjects, err := h.projects.List(ctx)
+	projects, versions, err := h.reindexTargets(ctx)
 	if err != nil {
-		h.logger.Error("listing projects for reindex", "error", err)
+		h.logger.ErrorContext(ctx, "listing projects for reindex", "error", err)
 		h.redirect(w, r, "/admin/projects", http.StatusSeeOther)
 		return
 	}
 
+	scope := reindexRebuild
+	var started bool
+	if r.FormValue("changed") == "1" && !h.searchIndex.Outdated() {
+		scope = reindexChanged
+		started = h.startPartialReindex(ctx, scope, "", false, projects, versions)
+	} else {
+		started = h.startReindex(ctx, false, projects, versions)
+	}
+	if !started {
+		h.redirect(w, r, "/admin/projects?msg=reindex_already_running", http.StatusSeeOther)
+		return
+	}
+	h.audit(ctx, "search_index.reindex", user.Username, scope)
+	h.redirect(w, r, "/admin/projects?msg=reindex_started", http.StatusSeeOther)
+}
+
+// reindexTargets lists the versions with their labels of the given
+// projects, or of all projects if none are given, for a reindex.
+func (h *Handler) reindexTargets(ctx context.Context, only ...database.Project) ([]docs.ReindexProject, []docs.ReindexVersion, error) {
+	allProjects := only
+	if len(only) == 0 {
+		var err error
+		if allProjects, err = h.projects.List(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	var projects []docs.ReindexProject
 	var versions []docs.ReindexVersion
 
+	projectMeta, err := h.metadata.ListProjects(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing project metadata for reindex", "error", err)
+	}
+
 	for _, p := range allProjects {
 		projects = append(projects, docs.ReindexProject{
-			ID:   p.ID,
-			Slug: p.Slug,
-			Name: p.Name,
+			ID:       p.ID,
+			Slug:     p.Slug,
+			Name:     p.Name,
+			Metadata: projectMeta[p.ID],
 		})
 
 		vlist, err := h.versions.ListByProject(ctx, p.ID)
 		if err != nil {
 			continue
 		}
+		versionMeta, err := h.metadata.ListVersionsByProject(ctx, p.ID)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "listing version metadata for reindex", "error", err, "project", p.Slug)
+		}
 		for _, v := range vlist {
 			versions = append(versions, docs.ReindexVersion{
 				ID:          v.ID,
 				ProjectID:   v.ProjectID,
 				Tag:         v.Tag,
 				StoragePath: v.StoragePath,
+				Metadata:    versionMeta[v.ID],
 			})
 		}
 	}
-
-	// Mark reindex as running
-	h.reindexRunning = true
-	h.reindexProgress = "Starting..."
-
-	go func() {
-		defer func() {
-			h.reindexRunning = false
-			h.reindexProgress = ""
-		}()
-
-		progressFn := func(p docs.ReindexProgress) {
-			h.reindexProgress = fmt.Sprintf("%d/%d: %s %s", p.Current, p.Total, p.Project, p.Version)
-			h.logger.Info("reindex progress", "current", p.Current, "total", p.Total, "project", p.Project, "version", p.Version)
-		}
-
-		if err := h.searchIndex.ReindexAllWithProgress(projects, versions, progressFn); err != nil {
-			h.logger.Error("reindex failed", "error", err)
-		} else {
-			h.logger.Info("reindex completed", "versions", len(versions))
-		}
-	}()
-
-	h.redirect(w, r, "/admin/projects?msg=reindex_started", http.StatusSeeOther)
+	return projects, versions, nil
 }
 
-// latestTagsCacheTTL is how long the latest version tags cache is valid.
-const latestTagsCacheTTL = 30 * time.Second
-
-// getLatestVersionTags returns a map of projectSlug -> latest version tag.
-// Results are cached to avoid per-query DB lookups.
-func (h *Handler) getLatestVersionTags(ctx context.Context) map[string]string {
-	// Check if cache is still valid
-	if h.latestTagsCache != nil && time.Since(h.latestTagsCacheTime) < latestTagsCacheTTL {
-		return h.latestTagsCache
+// startReindex rebuilds the search index in the background, or continues
+// the interrupted rebuild of the checkpoint if resume is set. It returns
+// false if a reindex is already running.
+func (h *Handler) startReindex(ctx context.Context, resume bool, projects []docs.ReindexProject, versions []docs.ReindexVersion) bool {
+	scope := reindexRebuild
+	if resume {
+		scope = reindexResume
 	}
-
-	result := make(map[string]string)
-
-	projects, err := h.projects.List(ctx)
-	if err != nil {
-		return result
+	if !h.reindex.start(scope, "", false) {
+		return false
 	}
 
-	for _, p := range projects {
-		versions, err := h.versions.ListByProject(ctx, p.ID)
-		if err != nil || len(versions) == 0 {
-			continue
+	h.goJob(ctx, func(ctx context.Context) {
+		var last docs.ReindexProgress
+		progressFn := func(p docs.ReindexProgress) {
+			p.Indexed = p.Current - 1
+			last = p
+			h.reindex.progress(p)
+			h.logger.InfoContext(ctx, "reindex progress", "current", p.Current, "total", p.Total, "project", p.Project, "version", p.Version)
 		}
-		result[p.Slug] = latestVersionTag(versions, p.PinnedVersion)
-	}
-
-	// Update cache
-	h.latestTagsCache = result
-	h.latestTagsCacheTime = time.Now()
-
-	return result
-}
 
-// invalidateLatestTagsCache clears the cached latest version tags.
-// Call this after uploading or deleting versions.
-func (h *Handler) invalidateLatestTagsCache() {
-	h.latestTagsCache = nil
+		err := h.limitJob(jobSearchIndex, func(ctx context.Context) error {
+			if resume {
+				return h.searchIndex.ResumeReindex(ctx, projects, versions, progressFn)
+			}
+			return h.searchIndex.ReindexAllWithProgress(ctx, projects, versions, progressFn)
+		})(ctx)
+		if errors.Is(err, context.Canceled) {
+			h.logger.WarnContext(ctx, "reindex interrupted by shutdown, it resumes at the next start", "progress", h.reindex.get().Progress())
+			err = errReindexInterrupted
+		} else if err != nil {
+			h.logger.ErrorContext(ctx, "reindex failed", "error", err)
+			h.alertReindexFailed(ctx, scope, "", err)
+		} else {
+			last.Indexed = last.Current
+			h.reindex.progress(last)
+			h.logger.InfoContext(ctx, "reindex completed", "versions", len(versions))
+		}
+		h.reindex.finish(err)
+	})
+	return true
 }
 
 // filterSearchResults removes results for projects the user can't access
-// and prefixes URLs with the base path.
-func (h *Handler) filterSearchResults(ctx context.Context, user *database.User, results *docs.SearchResults) *docs.SearchResults {
+// and prefixes URLs with the base path. Unless includeRetired is set,
+// results of deprecated and end-of-life projects and versions are removed too.
+func (h *Handler) filterSearchResults(ctx context.Context, user *database.User, results *docs.SearchResults, includeRetired bool) *docs.SearchResults {
 	// Cache project access checks
-	projectCache := make(map[string]bool)
+	projectCache := make(map[string]*database.Project)
+	versionCache := make(map[string]bool)
 	bp := h.config.Server.BasePath
 
 	var filtered []docs.SearchResult
 	for _, r := range results.Results {
-		allowed, ok := projectCache[r.ProjectSlug]
+		project, ok := projectCache[r.ProjectSlug]
 		if !ok {
 			p, err := h.projects.GetBySlug(ctx, r.ProjectSlug)
-			if err != nil {
-				allowed = false
-			} else {
-				allowed = h.canViewProject(ctx, user, p)
+			if err == nil && h.canListProject(ctx, user, p) {
+				project = p
 			}
-			projectCache[r.ProjectSlug] = allowed
+			projectCache[r.ProjectSlug] = project
+		}
+		allowed := project != nil
+		if allowed && !includeRetired {
+			key := r.ProjectSlug + "/" + r.VersionTag
+			retired, ok := versionCache[key]
+			if !ok {
+				retired = isRetired(project.Lifecycle)
+				if v, err := h.versions.GetByProjectAndTag(ctx, project.ID, r.VersionTag); err == nil && isRetired(v.Lifecycle) {
+					retired = true
+				}
+				versionCache[key] = retired
+			}
+			allowed = !retired
 		}
 		if allowed {
 			// Prefix URL with base path
@@ -305,21 +351,40 @@ func (h *Handler) filterSearchResults(ctx context.Context, user *database.User,
 	}
 }
 
+// canListProject checks if a project appears in the project lists, search
+// and feeds shown to a user. Unlisted projects can be viewed by anyone who
+// knows their URL, but are only listed for signed-in users.
+func (h *Handler) canListProject(ctx context.Context, user *database.User, project *database.Project) bool {
+	if user == nil && project.Visibility == database.VisibilityUnlisted {
+		return false
+	}
+	return h.canViewProject(ctx, user, project)
+}
+
+// validVisibility reports whether v is a known project visibility.
+func validVisibility(v string) bool {
+	switch v {
+	case database.VisibilityPublic, database.VisibilityPrivate, database.VisibilityCustom, database.VisibilityUnlisted:
+		return true
+	}
+	return false
+}
+
 // canViewProject checks if a user can view a project.
 func (h *Handler) canViewProject(ctx context.Context, user *database.User, project *database.Project) bool {
 	username := "<anonymous>"
 	if user != nil {
 		username = user.Username
 	}
-	if project.Visibility == database.VisibilityPublic {
+	if project.Visibility == database.VisibilityPublic || project.Visibility == database.VisibilityUnlisted {
 		return true
 	}
 	if user == nil {
-		h.logger.Debug("access denied: anonymous user, non-public project", "project", project.Slug, "visibility", project.Visibility)
+		h.logger.DebugContext(ctx, "access denied: anonymous user, non-public project", "project", project.Slug, "visibility", project.Visibility)
 		return false
 	}
 	if user.Role == "admin" {
-		h.logger.Debug("access granted: admin user", "username", username, "project", project.Slug)
+		h.logger.DebugContext(ctx, "access granted: admin user", "username", username, "project", project.Slug)
 		return true
 	}
 	if project.Visibility == database.VisibilityPrivate {
@@ -327,10 +392,10 @@ func (h *Handler) canViewProject(ctx context.Context, user *database.User, proje
 		if h.globalAccess != nil {
 			grant, err := h.globalAccess.GetGrantByUser(ctx, user.ID)
 			if err == nil && grant != nil {
-				h.logger.Debug("access granted: global access grant", "username", username, "project", project.Slug, "grant_role", grant.Role, "grant_source", grant.Source)
+				h.logger.DebugContext(ctx, "access granted: global access grant", "username", username, "project", project.Slug, "grant_role", grant.Role, "grant_source", grant.Source)
 				return true
 			}
-			h.logger.Debug("access denied: no global access grant for private project", "username", username, "project", project.Slug, "user_id", user.ID)
+			h.logger.DebugContext(ctx, "access denied: no global access grant for private project", "username", username, "project", project.Slug, "user_id", user.ID)
 		}
 		return false
 	}
@@ -338,9 +403,9 @@ func (h *Handler) canViewProject(ctx context.Context, user *database.User, proje
 	effectiveRole, err := h.access.GetEffectiveRole(ctx, project.ID, user.ID)
 	allowed := err == nil && effectiveRole != ""
 	if allowed {
-		h.logger.Debug("access granted: project-level access", "username", username, "project", project.Slug, "effective_role", effectiveRole)
+		h.logger.DebugContext(ctx, "access granted: project-level access", "username", username, "project", project.Slug, "effective_role", effectiveRole)
 	} else {
-		h.logger.Debug("access denied: no project-level access", "username", username, "project", project.Slug, "user_id", user.ID)
+		h.logger.DebugContext(ctx, "access denied: no project-level access", "username", username, "project", project.Slug, "user_id", user.ID)
 	}
 	return allowed
 }
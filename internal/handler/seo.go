@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// sitemapMaxURLs is the limit of a single sitemap file.
+const sitemapMaxURLs = 50000
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// indexableProject is a project anonymous visitors can read, with its
+// versions and the tag of its latest version.
+type indexableProject struct {
+	project  database.Project
+	versions []database.Version
+	latest   string
+}
+
+// publicURL returns the external URL of the server, including the base
+// path, for links that leave the browser such as sitemap entries.
+func (h *Handler) publicURL(r *http.Request) string {
+	if h.config.Server.PublicURL != "" {
+		return strings.TrimSuffix(h.config.Server.PublicURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + h.config.Server.BasePath
+}
+
+// indexableProjects lists the projects that may appear in search engines:
+// readable without login and not hidden from the sitemap.
+func (h *Handler) indexableProjects(ctx context.Context) ([]indexableProject, error) {
+	projects, err := h.projects.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing projects: %w", err)
+	}
+	var result []indexableProject
+	for _, p := range projects {
+		if p.HideFromSitemap || !h.canListProject(ctx, nil, &p) {
+			continue
+		}
+		versions, err := h.sortedVersions(ctx, p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("listing versions: %w", err)
+		}
+		if len(versions) == 0 {
+			continue
+		}
+		result = append(result, indexableProject{
+			project:  p,
+			versions: versions,
+			latest:   latestVersionTag(versions, p.PinnedVersion),
+		})
+	}
+	return result, nil
+}
+
+// escapePath percent-encodes a slash-separated URL path.
+func escapePath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// handleSitemap lists the project pages and the HTML pages of the latest
+// version of every indexable project.
+func (h *Handler) handleSitemap(w http.ResponseWriter, r *http.Request) {
+	if !h.config.Access.AllowAnonymous {
+		http.NotFound(w, r)
+		return
+	}
+	projects, err := h.indexableProjects(r.Context())
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "building sitemap", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	base := h.publicURL(r)
+	set := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, ip := range projects {
+		set.URLs = append(set.URLs, sitemapURL{Loc: base + "/project/" + ip.project.Slug})
+
+		var latest database.Version
+		for _, v := range ip.versions {
+			if v.Tag == ip.latest {
+				latest = v
+			}
+		}
+		lastMod := latest.CreatedAt.UTC().Format("2006-01-02")
+		versionURL := base + "/project/" + ip.project.Slug + "/" + escapePath(latest.Tag) + "/"
+		if latest.ContentType == "pdf" {
+			set.URLs = append(set.URLs, sitemapURL{Loc: versionURL, LastMod: lastMod})
+			continue
+		}
+
+		storagePath := h.storage.VersionPath(ip.project.Slug, latest.Tag)
+		filepath.WalkDir(storagePath, func(path string, d fs.DirEntry, err error) error {
+			if r.Context().Err() != nil {
+				return filepath.SkipAll
+			}
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if len(set.URLs) >= sitemapMaxURLs {
+				return filepath.SkipAll
+			}
+			ext := strings.ToLower(filepath.Ext(path))
+			if ext != ".html" && ext != ".htm" {
+				return nil
+			}
+			rel, err := filepath.Rel(storagePath, path)
+			if err != nil {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+			if rel == "index.html" {
+				rel = ""
+			}
+			set.URLs = append(set.URLs, sitemapURL{Loc: versionURL + escapePath(rel), LastMod: lastMod})
+			return nil
+		})
+	}
+	if r.Context().Err() != nil {
+		return // client went away
+	}
+	if len(set.URLs) > sitemapMaxURLs {
+		set.URLs = set.URLs[:sitemapMaxURLs]
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(set); err != nil {
+		h.logger.ErrorContext(r.Context(), "writing sitemap", "error", err)
+	}
+}
+
+// handleRobots keeps crawlers out of pages that need a login or have no
+// content of their own, and points them to the sitemap.
+func (h *Handler) handleRobots(w http.ResponseWriter, r *http.Request) {
+	bp := h.config.Server.BasePath
+
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	// Crawlers cannot log in, so there is nothing for them to index
+	if !h.config.Access.AllowAnonymous {
+		b.WriteString("Disallow: " + bp + "/\n")
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(b.String()))
+		return
+	}
+	for _, path := range []string{"/admin/", "/api/", "/auth/", "/login", "/logout", "/profile", "/search"} {
+		b.WriteString("Disallow: " + bp + path + "\n")
+	}
+
+	projects, err := h.projects.List(r.Context())
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "building robots.txt", "error", err)
+	}
+	// Private and unlisted projects are not listed, so robots.txt does not
+	// reveal them
+	for _, p := range projects {
+		if p.HideFromSitemap && h.canListProject(r.Context(), nil, &p) {
+			b.WriteString("Disallow: " + bp + "/project/" + p.Slug + "$\n")
+			b.WriteString("Disallow: " + bp + "/project/" + p.Slug + "/\n")
+		}
+	}
+
+	if h.config.SEO.DisallowOldVersions {
+		indexable, err := h.indexableProjects(r.Context())
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "building robots.txt", "error", err)
+		}
+		for _, ip := range indexable {
+			for _, v := range ip.versions {
+				if v.Tag != ip.latest {
+					b.WriteString("Disallow: " + bp + "/project/" + ip.project.Slug + "/" + escapePath(v.Tag) + "/\n")
+				}
+			}
+		}
+	}
+
+	b.WriteString("\nSitemap: " + h.publicURL(r) + "/sitemap.xml\n")
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// markStaleVersion keeps search engines from surfacing a non-latest version:
+// the response gets an X-Robots-Tag: noindex header and a canonical link to
+// the same path in the latest version. It returns the canonical <link> to
+// inject into HTML pages, or "" if the version may be indexed.
+func (h *Handler) markStaleVersion(w http.ResponseWriter, r *http.Request, project *database.Project, tag, filePath string) string {
+	if project.IndexOldVersions {
+		return ""
+	}
+	latest := h.getLatestVersionTags(r.Context())[project.Slug]
+	if latest == "" || latest == tag {
+		return ""
+	}
+
+	canonical := h.publicURL(r) + "/project/" + project.Slug + "/" + escapePath(latest) + "/" + escapePath(filePath)
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Header().Set("Link", "<"+canonical+`>; rel="canonical"`)
+	return `<link rel="canonical" href="` + html.EscapeString(canonical) + `">`
+}
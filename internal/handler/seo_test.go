@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func seedSEOVersion(t testing.TB, app *testApp, project *database.Project, uploader *database.User, tag string) {
+	t.Helper()
+	storage := app.handler.storage
+	storage.EnsureVersionDir(project.Slug, tag)
+	versionPath := storage.VersionPath(project.Slug, tag)
+	os.MkdirAll(filepath.Join(versionPath, "guide"), 0755)
+	os.WriteFile(filepath.Join(versionPath, "index.html"), []byte("<html></html>"), 0644)
+	os.WriteFile(filepath.Join(versionPath, "guide", "intro.html"), []byte("<html><head><title>Intro</title></head><body></body></html>"), 0644)
+	os.WriteFile(filepath.Join(versionPath, "style.css"), []byte("body{}"), 0644)
+	version := &database.Version{ProjectID: project.ID, Tag: tag, StoragePath: versionPath, UploadedBy: uploader.ID}
+	if err := app.handler.versions.Create(context.Background(), version); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getBody(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: expected 200, got %d", url, resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestSitemapListsLatestPublicVersions(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.Server.PublicURL = "https://docs.example.com/"
+	admin := seedAdmin(t, app)
+	public := seedProject(t, app, "public-docs", "Public", true)
+	seedSEOVersion(t, app, public, admin, "v1.0.0")
+	seedSEOVersion(t, app, public, admin, "v2.0.0")
+	private := seedProject(t, app, "secret", "Secret", false)
+	seedSEOVersion(t, app, private, admin, "v1.0.0")
+	hidden := seedProject(t, app, "hidden", "Hidden", true)
+	hidden.HideFromSitemap = true
+	app.handler.projects.Update(context.Background(), hidden)
+	seedSEOVersion(t, app, hidden, admin, "v1.0.0")
+
+	sitemap := getBody(t, app.server.URL+"/sitemap.xml")
+	for _, want := range []string{
+		"<loc>https://docs.example.com/project/public-docs</loc>",
+		"<loc>https://docs.example.com/project/public-docs/v2.0.0/</loc>",
+		"<loc>https://docs.example.com/project/public-docs/v2.0.0/guide/intro.html</loc>",
+	} {
+		if !strings.Contains(sitemap, want) {
+			t.Errorf("sitemap missing %s", want)
+		}
+	}
+	for _, unwanted := range []string{"v1.0.0", "secret", "hidden", "style.css"} {
+		if strings.Contains(sitemap, unwanted) {
+			t.Errorf("sitemap should not contain %q", unwanted)
+		}
+	}
+
+	robots := getBody(t, app.server.URL+"/robots.txt")
+	if !strings.Contains(robots, "Disallow: /project/hidden/") || strings.Contains(robots, "secret") {
+		t.Errorf("unexpected robots.txt:\n%s", robots)
+	}
+	if !strings.Contains(robots, "Sitemap: https://docs.example.com/sitemap.xml") {
+		t.Errorf("robots.txt should point to the sitemap:\n%s", robots)
+	}
+	if strings.Contains(robots, "v1.0.0") {
+		t.Errorf("old versions should only be disallowed when configured:\n%s", robots)
+	}
+
+	app.handler.config.SEO.DisallowOldVersions = true
+	robots = getBody(t, app.server.URL+"/robots.txt")
+	if !strings.Contains(robots, "Disallow: /project/public-docs/v1.0.0/") || strings.Contains(robots, "public-docs/v2.0.0") {
+		t.Errorf("expected only the old version to be disallowed:\n%s", robots)
+	}
+}
+
+func TestOldVersionsAreNoindexWithCanonical(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.Server.PublicURL = "https://docs.example.com"
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "docs", "Docs", true)
+	seedSEOVersion(t, app, project, admin, "v1.0.0")
+	seedSEOVersion(t, app, project, admin, "v2.0.0")
+
+	resp, err := http.Get(app.server.URL + "/project/docs/v1.0.0/guide/intro.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Robots-Tag"); got != "noindex" {
+		t.Errorf("expected X-Robots-Tag noindex, got %q", got)
+	}
+	canonical := `<link rel="canonical" href="https://docs.example.com/project/docs/v2.0.0/guide/intro.html"></head>`
+	if !strings.Contains(string(body), canonical) {
+		t.Errorf("expected canonical link in head, got %s", body)
+	}
+
+	resp, err = http.Get(app.server.URL + "/project/docs/v2.0.0/guide/intro.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Robots-Tag") != "" || resp.Header.Get("Link") != "" {
+		t.Error("the latest version should be indexable")
+	}
+
+	project.IndexOldVersions = true
+	app.handler.projects.Update(context.Background(), project)
+	resp, err = http.Get(app.server.URL + "/project/docs/v1.0.0/guide/intro.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Robots-Tag") != "" {
+		t.Error("old versions should be indexable when the project allows it")
+	}
+}
+
+func TestSocialPreviewTags(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.Server.PublicURL = "https://docs.example.com"
+	app.handler.config.Branding.LogoURL = "/static/custom/logo.png"
+	admin := seedAdmin(t, app)
+	public := seedProject(t, app, "public-docs", "Public Docs", true)
+	public.Description = "The **public** handbook & guide."
+	app.handler.projects.Update(context.Background(), public)
+	seedSEOVersion(t, app, public, admin, "v1.0.0")
+	private := seedProject(t, app, "secret", "Secret", false)
+	seedSEOVersion(t, app, private, admin, "v1.0.0")
+
+	body := getBody(t, app.server.URL+"/project/public-docs")
+	for _, want := range []string{
+		`<meta property="og:title" content="Public Docs">`,
+		`<meta property="og:description" content="The public handbook &amp; guide.">`,
+		`<meta property="og:url" content="https://docs.example.com/project/public-docs">`,
+		`<meta property="og:image" content="https://docs.example.com/static/custom/logo.png">`,
+		`<meta name="twitter:card" content="summary">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("project page missing %s", want)
+		}
+	}
+
+	page := getBody(t, app.server.URL+"/project/public-docs/v1.0.0/guide/intro.html")
+	if !strings.Contains(page, `<meta property="og:site_name" content="Public Docs">`) ||
+		!strings.Contains(page, `content="https://docs.example.com/project/public-docs/v1.0.0/guide/intro.html"`) {
+		t.Error("expected preview tags in the served page")
+	}
+	if strings.Contains(page, "og:title") {
+		t.Error("served pages should keep their own title")
+	}
+	if css := getBody(t, app.server.URL+"/project/public-docs/v1.0.0/style.css"); strings.Contains(css, "og:") {
+		t.Error("assets should not get preview tags")
+	}
+
+	req, _ := http.NewRequest("GET", app.server.URL+"/project/secret/v1.0.0/guide/intro.html", nil)
+	for _, c := range loginUser(t, app, "admin", "admin123") {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.Contains(string(secret), "og:") {
+		t.Error("projects anonymous readers cannot view should not get preview tags")
+	}
+
+	app.handler.config.SEO.SocialPreviews = false
+	if body := getBody(t, app.server.URL+"/project/public-docs"); strings.Contains(body, "og:") {
+		t.Error("expected no preview tags when disabled")
+	}
+}
+
+func TestPreviewText(t *testing.T) {
+	long := strings.Repeat("word ", 60)
+	got := previewText(long)
+	if !strings.HasSuffix(got, "word…") || len([]rune(got)) > maxPreviewDescription+1 {
+		t.Errorf("unexpected cut: %q", got)
+	}
+	if got := previewText("short"); got != "short" {
+		t.Errorf("expected short text unchanged, got %q", got)
+	}
+}
+
+func TestOpenSearchDescriptions(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.Server.PublicURL = "https://docs.example.com"
+	admin := seedAdmin(t, app)
+	public := seedProject(t, app, "public-docs", "Public Documentation Set", true)
+	seedSEOVersion(t, app, public, admin, "v1.0.0")
+	seedProject(t, app, "secret", "Secret", false)
+
+	site := getBody(t, app.server.URL+"/opensearch.xml")
+	for _, want := range []string{
+		`<ShortName>asiakirjat</ShortName>`,
+		`template="https://docs.example.com/search?q={searchTerms}"`,
+		`rel="self" template="https://docs.example.com/opensearch.xml"`,
+	} {
+		if !strings.Contains(site, want) {
+			t.Errorf("site description missing %s", want)
+		}
+	}
+
+	project := getBody(t, app.server.URL+"/project/public-docs/opensearch.xml")
+	if !strings.Contains(project, `<ShortName>Public Documenta</ShortName>`) ||
+		!strings.Contains(project, `template="https://docs.example.com/search?q={searchTerms}&amp;project=public-docs"`) {
+		t.Errorf("unexpected project description: %s", project)
+	}
+	resp, err := http.Get(app.server.URL + "/project/secret/opensearch.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a project anonymous users cannot view, got %d", resp.StatusCode)
+	}
+
+	link := `<link rel="search" type="application/opensearchdescription+xml" title="Public Documentation Set" href="/project/public-docs/opensearch.xml">`
+	if body := getBody(t, app.server.URL+"/project/public-docs"); !strings.Contains(body, link) || !strings.Contains(body, `href="/opensearch.xml"`) {
+		t.Error("expected the site and project search links on the project page")
+	}
+	if page := getBody(t, app.server.URL+"/project/public-docs/v1.0.0/guide/intro.html"); !strings.Contains(page, link) {
+		t.Error("expected the project search link in served pages")
+	}
+}
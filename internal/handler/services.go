@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"io/fs"
+	"log/slog"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/config"
+	"github.com/qwc/asiakirjat/internal/docs"
+	"github.com/qwc/asiakirjat/internal/email"
+	"github.com/qwc/asiakirjat/internal/events"
+	"github.com/qwc/asiakirjat/internal/hooks"
+	"github.com/qwc/asiakirjat/internal/scheduler"
+	"github.com/qwc/asiakirjat/internal/store"
+	"github.com/qwc/asiakirjat/internal/templates"
+)
+
+// ProjectService is the data of projects: the projects themselves and
+// their labels, tags and translations.
+type ProjectService struct {
+	Projects     store.ProjectStore
+	Metadata     store.MetadataStore
+	Tags         store.TagStore
+	Translations store.TranslationStore
+}
+
+// VersionService is the data of versions: the versions, their files and
+// search index, and what was uploaded and renamed.
+type VersionService struct {
+	Versions    store.VersionStore
+	Storage     docs.Storage
+	SearchIndex *docs.SearchIndex
+	Attachments store.AttachmentStore
+	UploadLogs  store.UploadLogStore
+	Redirects   store.VersionRedirectStore
+	History     store.HistoryStore
+	Previews    store.PreviewStore
+}
+
+// AccessService is who may do what: users, their sessions, roles and
+// tokens, and how they log in.
+type AccessService struct {
+	Users          store.UserStore
+	Sessions       store.SessionStore
+	PasswordResets store.PasswordResetStore
+	Access         store.ProjectAccessStore
+	GlobalAccess   store.GlobalAccessStore
+	GroupMappings  store.AuthGroupMappingStore
+	SCIMGroups     store.SCIMGroupStore
+	Tokens         store.TokenStore
+	APIKeys        store.APIKeyStore
+	Authenticators []auth.Authenticator
+	LDAPAuth       *auth.LDAPAuthenticator
+	OAuth2Auth     *auth.OAuth2Authenticator
+	ProxyAuth      *auth.ProxyAuthenticator
+	SessionMgr     *auth.SessionManager
+}
+
+// ActivityService records what happens: the audit log, events and their
+// subscribers, project watchers, notification emails, reader feedback and
+// view analytics.
+type ActivityService struct {
+	AuditLog       store.AuditLogStore
+	Events         store.EventStore
+	EventPublisher events.Publisher
+	Watchers       store.WatcherStore
+	Mailer         email.Sender // nil while email is not configured
+	Feedback       store.FeedbackStore
+	Analytics      store.AnalyticsStore
+}
+
+// Services are what the handlers are built on, grouped by concern. The
+// stores are interfaces, so a fork can wrap or replace single ones, and
+// extensions get the same services as the core handlers, see Extension.
+type Services struct {
+	Config       *config.Config
+	Logger       *slog.Logger
+	Projects     ProjectService
+	Versions     VersionService
+	Access       AccessService
+	Activity     ActivityService
+	FeatureFlags store.FeatureFlagStore
+	// JobLocks runs each scheduled maintenance task on one of the servers
+	// sharing the database; nil runs them on every server
+	JobLocks store.JobLockStore
+}
+
+// Deps are the services of a handler and what it serves pages with.
+type Deps struct {
+	Services
+	Templates *templates.Engine
+	StaticFS  fs.FS
+	Scheduler *scheduler.Scheduler
+	DBPing    func(context.Context) error // Checks the database for degraded mode; nil disables it
+	DBStats   func() sql.DBStats          // Connection pool statistics for /healthz?verbose=1; may be nil
+	// Backup writes a backup of the server, see the backup package; nil
+	// disables backups through the API
+	Backup func(context.Context, io.Writer) error
+
+	// Extensions add routes of their own, see Extension
+	Extensions []Extension
+	// Hooks run site-specific logic at uploads, page views and logins;
+	// nil runs none
+	Hooks *hooks.Registry
+}
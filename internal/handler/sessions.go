@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// sessionView is a login session as the profile and admin pages list it.
+// Session IDs are the secret in the cookie, so pages refer to sessions by
+// the start of their hash instead.
+type sessionView struct {
+	Handle     string
+	Username   string
+	Device     string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	Remembered bool
+	Current    bool
+}
+
+// sessionHandle returns the public name of a session.
+func sessionHandle(id string) string {
+	return auth.HashToken(id)[:16]
+}
+
+// userAgentBrowsers and userAgentSystems name browsers and operating
+// systems by a token in their user agent, most specific first.
+var (
+	userAgentBrowsers = [][2]string{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"},
+		{"Safari/", "Safari"}, {"curl/", "curl"},
+	}
+	userAgentSystems = [][2]string{
+		{"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"}, {"Windows", "Windows"},
+		{"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	}
+)
+
+// describeUserAgent names the browser and operating system of a user
+// agent, e.g. "Firefox on Linux".
+func describeUserAgent(ua string) string {
+	if ua == "" {
+		return "Unknown device"
+	}
+	browser, system := "", ""
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(ua, b[0]) {
+			browser = b[1]
+			break
+		}
+	}
+	for _, s := range userAgentSystems {
+		if strings.Contains(ua, s[0]) {
+			system = s[1]
+			break
+		}
+	}
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	if len(ua) > 40 {
+		return ua[:40] + "…"
+	}
+	return ua
+}
+
+// sessionViews describes sessions, marking the one of the request.
+func (h *Handler) sessionViews(r *http.Request, sessions []database.Session, usernames map[int64]string) []sessionView {
+	current := h.sessionMgr.SessionID(r)
+	idle := h.sessionMgr.IdleTimeout()
+	now := time.Now()
+	views := make([]sessionView, 0, len(sessions))
+	for _, s := range sessions {
+		remembered := s.RememberUntil != nil && s.RememberUntil.After(now)
+		expiresAt := s.ExpiresAt
+		if remembered {
+			expiresAt = *s.RememberUntil
+		} else if idle > 0 && s.LastSeenAt.Add(idle).Before(now) {
+			continue
+		}
+		views = append(views, sessionView{
+			Handle:     sessionHandle(s.ID),
+			Username:   usernames[s.UserID],
+			Device:     describeUserAgent(s.UserAgent),
+			IPAddress:  s.IPAddress,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  expiresAt,
+			Remembered: remembered,
+			Current:    s.ID == current,
+		})
+	}
+	return views
+}
+
+// userSessions lists the sessions of the user, for the profile page.
+func (h *Handler) userSessions(r *http.Request, user *database.User) []sessionView {
+	sessions, err := h.sessions.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "listing sessions", "error", err)
+		return nil
+	}
+	return h.sessionViews(r, sessions, nil)
+}
+
+// findSession returns the session with the handle among sessions.
+func findSession(sessions []database.Session, handle string) *database.Session {
+	for i := range sessions {
+		if sessionHandle(sessions[i].ID) == handle {
+			return &sessions[i]
+		}
+	}
+	return nil
+}
+
+// handleRevokeSession logs the user out of one of their sessions, which
+// may be the current one.
+func (h *Handler) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	sessions, err := h.sessions.ListByUser(ctx, user.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing sessions", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	session := findSession(sessions, r.PathValue("id"))
+	if session == nil {
+		h.renderProfile(w, r, map[string]any{"Error": "Session not found. It may have ended already."})
+		return
+	}
+	if session.ID == h.sessionMgr.SessionID(r) {
+		h.sessionMgr.DestroySession(w, r)
+		h.redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if err := h.sessions.Delete(ctx, session.ID); err != nil {
+		h.logger.ErrorContext(ctx, "deleting session", "error", err)
+		http.Error(w, "Failed to end session", http.StatusInternalServerError)
+		return
+	}
+	h.renderProfile(w, r, map[string]any{"Success": "Session ended."})
+}
+
+// handleRevokeOtherSessions logs the user out everywhere but here.
+func (h *Handler) handleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	sessions, err := h.sessions.ListByUser(ctx, user.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing sessions", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	current := h.sessionMgr.SessionID(r)
+	for _, s := range sessions {
+		if s.ID == current {
+			continue
+		}
+		if err := h.sessions.Delete(ctx, s.ID); err != nil {
+			h.logger.ErrorContext(ctx, "deleting session", "error", err)
+		}
+	}
+	h.renderProfile(w, r, map[string]any{"Success": "Logged out of all other sessions."})
+}
+
+// usernamesByID maps the IDs of all users to their names.
+func (h *Handler) usernamesByID(ctx context.Context) (map[int64]string, error) {
+	users, err := h.users.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(users))
+	for _, u := range users {
+		names[u.ID] = u.Username
+	}
+	return names, nil
+}
+
+// handleAdminSessions lists the sessions of all users.
+func (h *Handler) handleAdminSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	sessions, err := h.sessions.List(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing sessions", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	usernames, err := h.usernamesByID(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing users", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	var flash *Flash
+	if r.URL.Query().Get("msg") == "revoked" {
+		flash = &Flash{Type: "success", Message: "Session ended."}
+	}
+	h.render(w, "admin_sessions", map[string]any{
+		"User":        auth.UserFromContext(ctx),
+		"Sessions":    h.sessionViews(r, sessions, usernames),
+		"MaxAge":      time.Duration(h.config.Auth.Session.MaxAge) * time.Second,
+		"IdleTimeout": h.sessionMgr.IdleTimeout(),
+		"Flash":       flash,
+	})
+}
+
+// handleAdminRevokeSession logs a user out of a session.
+func (h *Handler) handleAdminRevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	admin := auth.UserFromContext(ctx)
+
+	sessions, err := h.sessions.List(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing sessions", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	session := findSession(sessions, r.PathValue("id"))
+	if session == nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err := h.sessions.Delete(ctx, session.ID); err != nil {
+		h.logger.ErrorContext(ctx, "deleting session", "error", err)
+		http.Error(w, "Failed to end session", http.StatusInternalServerError)
+		return
+	}
+	details := strconv.FormatInt(session.UserID, 10)
+	if u, err := h.users.GetByID(ctx, session.UserID); err == nil {
+		details = u.Username
+	}
+	h.audit(ctx, "session.revoke", admin.Username, details+" from "+cmp.Or(session.IPAddress, "unknown address"))
+	h.redirect(w, r, "/admin/sessions?msg=revoked", http.StatusSeeOther)
+}
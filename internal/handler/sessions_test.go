@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+const firefoxUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+
+// loginFrom logs in with a user agent and returns the session cookies.
+func loginFrom(t *testing.T, app *testApp, username, password, userAgent string) []*http.Cookie {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	req, _ := http.NewRequest("POST", app.server.URL+"/login", strings.NewReader("username="+username+"&password="+password))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.Cookies()
+}
+
+func seedSessionUser(t *testing.T, app *testApp) *database.User {
+	t.Helper()
+	hash, _ := auth.HashPassword("secret")
+	user := &database.User{Username: "ada", Password: &hash, AuthSource: "builtin", Role: "viewer"}
+	if err := app.handler.users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestProfileListsSessions(t *testing.T) {
+	app := setupTestApp(t)
+	user := seedSessionUser(t, app)
+	laptop := loginFrom(t, app, "ada", "secret", firefoxUserAgent)
+	loginFrom(t, app, "ada", "secret", "curl/8.5.0")
+
+	sessions, _ := app.handler.sessions.ListByUser(context.Background(), user.ID)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	if sessions[0].IPAddress != "127.0.0.1" {
+		t.Errorf("expected the client address to be recorded, got %q", sessions[0].IPAddress)
+	}
+
+	body := getWithCookies(t, app, "/profile", laptop)
+	for _, want := range []string{"Firefox on Linux", "curl", "(this session)", "Log Out Other Sessions"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q on the profile page", want)
+		}
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	app := setupTestApp(t)
+	user := seedSessionUser(t, app)
+	laptop := loginFrom(t, app, "ada", "secret", firefoxUserAgent)
+	phone := loginFrom(t, app, "ada", "secret", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Safari/604.1")
+
+	sessions, _ := app.handler.sessions.ListByUser(context.Background(), user.ID)
+	var phoneHandle string
+	for _, s := range sessions {
+		if s.ID == phone[0].Value {
+			phoneHandle = sessionHandle(s.ID)
+		}
+	}
+
+	if body := postWithCookies(t, app, "/profile/sessions/"+phoneHandle+"/revoke", laptop, nil); !strings.Contains(body, "Session ended.") {
+		t.Error("expected the session to be ended")
+	}
+	if status := profileStatus(t, app, phone); status == http.StatusOK {
+		t.Error("expected the revoked session to be logged out")
+	}
+	if status := profileStatus(t, app, laptop); status != http.StatusOK {
+		t.Errorf("expected the current session to stay, got %d", status)
+	}
+	if body := postWithCookies(t, app, "/profile/sessions/"+phoneHandle+"/revoke", laptop, nil); !strings.Contains(body, "Session not found") {
+		t.Error("expected an ended session not to be found")
+	}
+
+	postWithCookies(t, app, "/profile/sessions/"+sessionHandle(laptop[0].Value)+"/revoke", laptop, nil)
+	if status := profileStatus(t, app, laptop); status == http.StatusOK {
+		t.Error("expected revoking the current session to log out")
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	app := setupTestApp(t)
+	seedSessionUser(t, app)
+	laptop := loginFrom(t, app, "ada", "secret", firefoxUserAgent)
+	phone := loginFrom(t, app, "ada", "secret", "curl/8.5.0")
+	seedAdmin(t, app)
+	admin := loginUser(t, app, "admin", "admin123")
+
+	postWithCookies(t, app, "/profile/sessions/revoke-others", laptop, nil)
+	if status := profileStatus(t, app, phone); status == http.StatusOK {
+		t.Error("expected the other session to be logged out")
+	}
+	if status := profileStatus(t, app, laptop); status != http.StatusOK {
+		t.Errorf("expected the current session to stay, got %d", status)
+	}
+	if status := profileStatus(t, app, admin); status != http.StatusOK {
+		t.Errorf("expected sessions of other users to stay, got %d", status)
+	}
+}
+
+func TestAdminSessions(t *testing.T) {
+	app := setupTestApp(t)
+	seedSessionUser(t, app)
+	seedAdmin(t, app)
+	ada := loginFrom(t, app, "ada", "secret", firefoxUserAgent)
+	admin := loginUser(t, app, "admin", "admin123")
+
+	if body := getWithCookies(t, app, "/admin/sessions", admin); !strings.Contains(body, "ada") || !strings.Contains(body, "Firefox on Linux") {
+		t.Error("expected ada's session on the admin page")
+	}
+
+	if body := postWithCookies(t, app, "/admin/sessions/"+sessionHandle(ada[0].Value)+"/revoke", admin, nil); !strings.Contains(body, "Session ended.") {
+		t.Error("expected the session to be ended")
+	}
+	if status := profileStatus(t, app, ada); status == http.StatusOK {
+		t.Error("expected ada to be logged out")
+	}
+	entries, _ := app.handler.auditLog.List(context.Background(), 10)
+	if len(entries) == 0 || entries[0].Action != "session.revoke" || !strings.HasPrefix(entries[0].Details, "ada from ") {
+		t.Errorf("expected the revocation to be audited, got %+v", entries)
+	}
+}
+
+func TestDescribeUserAgent(t *testing.T) {
+	tests := map[string]string{
+		firefoxUserAgent: "Firefox on Linux",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0": "Edge on Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15":            "Safari on macOS",
+		"curl/8.5.0": "curl",
+		"":           "Unknown device",
+	}
+	for ua, want := range tests {
+		if got := describeUserAgent(ua); got != want {
+			t.Errorf("describeUserAgent(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestLoginRememberMe(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.sessionMgr.SetRememberMaxAge(30 * 86400)
+	user := seedSessionUser(t, app)
+
+	if body := getWithCookies(t, app, "/login", nil); !strings.Contains(body, `name="remember"`) {
+		t.Error("expected the remember-me checkbox on the login page")
+	}
+	if cookies := loginFrom(t, app, "ada", "secret", firefoxUserAgent); len(cookies) != 1 {
+		t.Errorf("expected only a session cookie without remember-me, got %d cookies", len(cookies))
+	}
+
+	rememberMe := func() *http.Cookie {
+		t.Helper()
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.PostForm(app.server.URL+"/login", url.Values{"username": {"ada"}, "password": {"secret"}, "remember": {"1"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		for _, c := range resp.Cookies() {
+			if c.Name == "test_session_remember" {
+				return c
+			}
+		}
+		t.Fatal("expected a remember-me cookie")
+		return nil
+	}
+
+	// Without the session cookie, the remember-me cookie logs in
+	if status := profileStatus(t, app, []*http.Cookie{rememberMe()}); status != http.StatusOK {
+		t.Errorf("expected the remember-me cookie to log in, got %d", status)
+	}
+
+	remember := rememberMe()
+	getWithCookies(t, app, "/logout", []*http.Cookie{remember})
+	if status := profileStatus(t, app, []*http.Cookie{remember}); status == http.StatusOK {
+		t.Error("expected logging out to end the remember-me token")
+	}
+	// Left are the plain login and the first remembered one
+	if sessions, _ := app.handler.sessions.ListByUser(context.Background(), user.ID); len(sessions) != 2 {
+		t.Errorf("expected logging out to end the renewed session, got %d sessions", len(sessions))
+	}
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+)
+
+// shutdownRetryAfter is the Retry-After value, in seconds, of uploads
+// refused during shutdown.
+const shutdownRetryAfter = "30"
+
+// goJob runs fn in the background and tracks it, so that a shutdown waits
+// for it before the search index and database are closed. fn gets a
+// context with the values of ctx, such as the request ID, that outlives
+// the request but is cancelled when the shutdown timeout is reached.
+func (h *Handler) goJob(ctx context.Context, fn func(ctx context.Context)) {
+	h.jobs.Add(1)
+	go func() {
+		defer h.jobs.Done()
+		ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		defer cancel()
+		defer context.AfterFunc(h.jobsCtx, cancel)()
+		fn(ctx)
+	}()
+}
+
+// BeginShutdown makes the handler refuse new uploads and reindexing.
+// Requests already running are not affected.
+func (h *Handler) BeginShutdown() {
+	h.shuttingDown.Store(true)
+}
+
+// WaitForJobs waits for background jobs started by requests, such as search
+// indexing after an upload. When ctx expires first, the jobs are cancelled
+// and WaitForJobs waits until they have stopped: a reindex stops after the
+// version it is indexing and is resumed by index verification at the next
+// start.
+func (h *Handler) WaitForJobs(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.jobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	h.logger.Warn("shutdown timeout reached, cancelling background jobs")
+	h.cancelJobs()
+	<-done
+	return ctx.Err()
+}
+
+// ResumeIndexing continues a rebuild of the search index interrupted by
+// the last shutdown in the background. If the index is incomplete without
+// a saved rebuild, e.g. after an import, the versions missing from it are
+// indexed instead.
+func (h *Handler) ResumeIndexing() {
+	if h.searchIndex == nil || !h.searchIndex.Incomplete() {
+		return
+	}
+	ctx := h.jobsCtx
+	cp, err := h.searchIndex.Checkpoint()
+	if err != nil {
+		h.logger.ErrorContext(ctx, "reading reindex checkpoint", "error", err)
+	}
+	if cp != nil && cp.Queue != nil {
+		projects, versions, err := h.reindexTargets(ctx)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "listing projects to resume reindex", "error", err)
+			return
+		}
+		h.logger.Info("search index rebuild was interrupted, resuming", "done", len(cp.Done), "total", len(cp.Queue))
+		h.startReindex(ctx, true, projects, versions)
+		return
+	}
+
+	h.logger.Info("search index is incomplete, indexing missing versions")
+	h.goJob(ctx, func(ctx context.Context) {
+		if err := h.limitJob(jobSearchIndex, h.runIndexVerification)(ctx); err != nil {
+			h.logger.ErrorContext(ctx, "indexing missing versions", "error", err)
+		}
+	})
+}
+
+// refuseDuringShutdown answers 503 and returns true once shutdown has
+// begun, so that clients retry the upload against the restarted server.
+func (h *Handler) refuseDuringShutdown(w http.ResponseWriter, api bool) bool {
+	if !h.shuttingDown.Load() {
+		return false
+	}
+	w.Header().Set("Retry-After", shutdownRetryAfter)
+	if api {
+		h.jsonError(w, "Server is shutting down", http.StatusServiceUnavailable)
+	} else {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+	}
+	return true
+}
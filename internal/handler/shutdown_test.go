@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+func TestUploadsRefusedDuringShutdown(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.BeginShutdown()
+
+	for _, path := range []string{"/api/project/guide/upload", "/api/upload", "/project/guide/upload", "/admin/reindex"} {
+		req := httptest.NewRequest("POST", path, strings.NewReader(""))
+		rec := httptest.NewRecorder()
+		switch path {
+		case "/project/guide/upload":
+			app.handler.handleUploadSubmit(rec, req)
+		case "/admin/reindex":
+			app.handler.handleAdminReindex(rec, req)
+		default:
+			app.mux.ServeHTTP(rec, req)
+		}
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("POST %s: expected 503, got %d", path, rec.Code)
+		}
+		if rec.Header().Get("Retry-After") == "" {
+			t.Errorf("POST %s: expected a Retry-After header", path)
+		}
+	}
+}
+
+func TestWaitForJobs(t *testing.T) {
+	app := setupTestApp(t)
+
+	release := make(chan struct{})
+	finished := false
+	app.handler.goJob(context.Background(), func(context.Context) {
+		<-release
+		finished = true
+	})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+
+	if err := app.handler.WaitForJobs(context.Background()); err != nil {
+		t.Fatalf("WaitForJobs: %v", err)
+	}
+	if !finished {
+		t.Error("expected WaitForJobs to wait for the job")
+	}
+
+	// A job still running at the deadline is cancelled and waited for.
+	stopped := false
+	app.handler.goJob(context.Background(), func(ctx context.Context) {
+		<-ctx.Done()
+		stopped = true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := app.handler.WaitForJobs(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if !stopped {
+		t.Error("expected the job to be cancelled")
+	}
+}
+
+func TestInterruptedReindexResumed(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+	version, err := app.handler.versions.GetByProjectAndTag(context.Background(), project.ID, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = app.handler.searchIndex.ReindexAllWithProgress(ctx,
+		[]docs.ReindexProject{{ID: project.ID, Slug: project.Slug, Name: project.Name}},
+		[]docs.ReindexVersion{{ID: version.ID, ProjectID: project.ID, Tag: version.Tag, StoragePath: version.StoragePath}}, nil)
+	if err != context.Canceled {
+		t.Fatalf("expected the reindex to be cancelled, got %v", err)
+	}
+	if !app.handler.searchIndex.Incomplete() {
+		t.Fatal("expected the index to be marked incomplete")
+	}
+
+	app.handler.ResumeIndexing()
+	if err := app.handler.WaitForJobs(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if app.handler.searchIndex.Incomplete() {
+		t.Error("expected the index to be complete after resuming")
+	}
+	indexed, err := app.handler.searchIndex.IndexedVersionIDs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !indexed[version.ID] {
+		t.Error("expected the missing version to be indexed")
+	}
+}
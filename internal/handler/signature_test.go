@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// setupSigning creates a project with an ECDSA signing key and an upload
+// token for it. It returns the private key and the raw token.
+func setupSigning(t *testing.T, app *testApp, slug string, require bool) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project := seedProject(t, app, slug, "Signed Project", false)
+	project.RequireSignature = require
+	project.SigningKeys = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err := app.handler.projects.Update(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+
+	robot := &database.User{Username: "signer-bot", AuthSource: "robot", Role: "editor", IsRobot: true}
+	app.handler.users.Create(ctx, robot)
+
+	rawToken, _ := auth.GenerateToken(32)
+	app.handler.tokens.Create(ctx, &database.APIToken{
+		UserID:    robot.ID,
+		TokenHash: auth.HashToken(rawToken),
+		Name:      "ci",
+		Scopes:    "upload",
+	})
+	return key, rawToken
+}
+
+func uploadWithSignature(t *testing.T, app *testApp, slug, token string, archive, sig []byte) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("version", "1.0.0")
+	part, _ := writer.CreateFormFile("archive", "docs.zip")
+	part.Write(archive)
+	if sig != nil {
+		part, _ = writer.CreateFormFile("signature", "docs.zip.sig")
+		part.Write(sig)
+	}
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", app.server.URL+"/api/project/"+slug+"/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestAPIUploadWithValidSignature(t *testing.T) {
+	app := setupTestApp(t)
+	key, token := setupSigning(t, app, "signed", true)
+
+	archive := createTestZip(t, map[string]string{"index.html": "<html>signed</html>"}).Bytes()
+	digest := sha256.Sum256(archive)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := uploadWithSignature(t, app, "signed", token, archive, []byte(base64.StdEncoding.EncodeToString(sig)))
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	project, _ := app.handler.projects.GetBySlug(context.Background(), "signed")
+	version, err := app.handler.versions.GetByProjectAndTag(context.Background(), project.ID, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.SignatureStatus != database.SignatureVerified {
+		t.Errorf("expected verified status, got %q", version.SignatureStatus)
+	}
+	if version.SignatureKey == "" {
+		t.Error("expected signature key fingerprint to be stored")
+	}
+}
+
+func TestAPIUploadRejectsInvalidSignature(t *testing.T) {
+	app := setupTestApp(t)
+	_, token := setupSigning(t, app, "signed", false)
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	archive := createTestZip(t, map[string]string{"index.html": "<html>signed</html>"}).Bytes()
+	digest := sha256.Sum256(archive)
+	sig, _ := ecdsa.SignASN1(rand.Reader, other, digest[:])
+
+	resp := uploadWithSignature(t, app, "signed", token, archive, sig)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for signature from unknown key, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIUploadRequiresSignature(t *testing.T) {
+	app := setupTestApp(t)
+	_, token := setupSigning(t, app, "signed", true)
+
+	archive := createTestZip(t, map[string]string{"index.html": "<html>unsigned</html>"}).Bytes()
+	resp := uploadWithSignature(t, app, "signed", token, archive, nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for missing signature, got %d", resp.StatusCode)
+	}
+
+	project, _ := app.handler.projects.GetBySlug(context.Background(), "signed")
+	if _, err := app.handler.versions.GetByProjectAndTag(context.Background(), project.ID, "1.0.0"); err == nil {
+		t.Error("expected no version to be created")
+	}
+}
+
+func TestAPIUploadUnsignedWhenOptional(t *testing.T) {
+	app := setupTestApp(t)
+	_, token := setupSigning(t, app, "signed", false)
+
+	archive := createTestZip(t, map[string]string{"index.html": "<html>unsigned</html>"}).Bytes()
+	resp := uploadWithSignature(t, app, "signed", token, archive, nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	project, _ := app.handler.projects.GetBySlug(context.Background(), "signed")
+	version, err := app.handler.versions.GetByProjectAndTag(context.Background(), project.ID, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.SignatureStatus != database.SignatureUnsigned {
+		t.Errorf("expected unsigned status, got %q", version.SignatureStatus)
+	}
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// storageGCGrace is how old a version directory without a version must be
+// before it counts as orphaned; uploads create the directory before the
+// version.
+const storageGCGrace = time.Hour
+
+// errStorageMissing stops a cleanup that would delete every version, as
+// happens when the storage is not mounted.
+var errStorageMissing = errors.New("no version has its files; is the storage mounted?")
+
+// StorageReport lists the version directories without a version and the
+// versions without a directory found by CheckStorage.
+type StorageReport struct {
+	Clean    bool
+	Orphaned []string // "slug@tag" of directories without a version
+	Missing  []string // "slug@tag" of versions without a directory
+	Failed   int
+}
+
+func (r *StorageReport) action() string {
+	if r.Clean {
+		return "storage.gc"
+	}
+	return "storage.check"
+}
+
+func (r *StorageReport) String() string {
+	verb := "found"
+	if r.Clean {
+		verb = "deleted"
+	}
+	msg := fmt.Sprintf("%s %d orphaned version dir(s) and %d version(s) with missing files", verb, len(r.Orphaned), len(r.Missing))
+	if r.Failed > 0 {
+		msg += fmt.Sprintf(", %d failed", r.Failed)
+	}
+	if len(r.Orphaned) > 0 {
+		msg += "; orphaned: " + strings.Join(r.Orphaned, ", ")
+	}
+	if len(r.Missing) > 0 {
+		msg += "; missing: " + strings.Join(r.Missing, ", ")
+	}
+	return msg
+}
+
+// CheckStorage compares the version directories in storage with the
+// versions in the database. With clean, it deletes the directories of
+// versions that do not exist, with their attachments and manifests, and
+// the versions whose directory is missing.
+func (h *Handler) CheckStorage(ctx context.Context, clean bool) (*StorageReport, error) {
+	projects, err := h.projects.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing projects: %w", err)
+	}
+	dirs, err := h.storage.ListVersionDirs()
+	if err != nil {
+		return nil, err
+	}
+	onDisk := make(map[string]bool, len(dirs))
+	for _, d := range dirs {
+		onDisk[d.Slug+"@"+d.Tag] = true
+	}
+
+	report := &StorageReport{Clean: clean}
+	known := make(map[string]bool)
+	projectsBySlug := make(map[string]bool, len(projects))
+	var missing []database.Version
+	missingProject := make(map[int64]*database.Project)
+	total := 0
+	for i, p := range projects {
+		projectsBySlug[p.Slug] = true
+		versions, err := h.versions.ListByProject(ctx, p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("listing versions of %s: %w", p.Slug, err)
+		}
+		for _, v := range versions {
+			total++
+			key := p.Slug + "@" + v.Tag
+			known[key] = true
+			if !onDisk[key] {
+				report.Missing = append(report.Missing, key)
+				missing = append(missing, v)
+				missingProject[v.ID] = &projects[i]
+			}
+		}
+	}
+
+	if clean && total > 0 && len(missing) == total {
+		report.Clean = false
+		return report, errStorageMissing
+	}
+
+	cutoff := time.Now().Add(-storageGCGrace)
+	orphanedProjects := make(map[string]bool)
+	for _, d := range dirs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		key := d.Slug + "@" + d.Tag
+		if known[key] || d.ModTime.After(cutoff) {
+			continue
+		}
+		report.Orphaned = append(report.Orphaned, key)
+		if !clean {
+			continue
+		}
+		h.logger.InfoContext(ctx, "storage: deleting orphaned version directory", "project", d.Slug, "version", d.Tag)
+		if err := h.storage.DeleteVersion(d.Slug, d.Tag); err != nil {
+			h.logger.ErrorContext(ctx, "storage: deleting orphaned version directory", "error", err, "project", d.Slug, "version", d.Tag)
+			report.Failed++
+			continue
+		}
+		if !projectsBySlug[d.Slug] {
+			orphanedProjects[d.Slug] = true
+		}
+	}
+	for slug := range orphanedProjects {
+		if err := h.storage.RemoveProjectDir(slug); err != nil {
+			h.logger.ErrorContext(ctx, "storage: removing project directory", "error", err, "project", slug)
+		}
+	}
+
+	if clean {
+		for _, v := range missing {
+			project := missingProject[v.ID]
+			if v.Protected {
+				// Protected versions are never deleted; an admin restores
+				// their files or unprotects them.
+				h.logger.WarnContext(ctx, "storage: keeping protected version with missing files", "project", project.Slug, "version", v.Tag)
+				continue
+			}
+			h.logger.InfoContext(ctx, "storage: deleting version with missing files", "project", project.Slug, "version", v.Tag)
+			if err := h.versions.Delete(ctx, v.ID); err != nil {
+				h.logger.ErrorContext(ctx, "storage: deleting version from database", "error", err, "project", project.Slug, "version", v.Tag)
+				report.Failed++
+				continue
+			}
+			h.emitEvent(ctx, database.EventVersionDeleted, project.Slug, map[string]any{"version": v.Tag, "reason": "missing_files", "actor": "system"})
+			if err := h.storage.DeleteVersion(project.Slug, v.Tag); err != nil {
+				h.logger.ErrorContext(ctx, "storage: deleting version attachments", "error", err, "project", project.Slug, "version", v.Tag)
+			}
+			if h.searchIndex != nil {
+				if err := h.searchIndex.DeleteVersion(project.ID, v.ID); err != nil {
+					h.logger.ErrorContext(ctx, "storage: deleting version from search index", "error", err, "project", project.Slug, "version", v.Tag)
+				}
+			}
+			h.invalidateVersions(project.ID)
+		}
+	}
+	return report, nil
+}
+
+// runStorageCheck reports orphaned version directories and versions with
+// missing files in the audit log.
+func (h *Handler) runStorageCheck(ctx context.Context) error {
+	return h.runStorage(ctx, false)
+}
+
+// runStorageGC deletes orphaned version directories and versions with
+// missing files.
+func (h *Handler) runStorageGC(ctx context.Context) error {
+	return h.runStorage(ctx, true)
+}
+
+func (h *Handler) runStorage(ctx context.Context, clean bool) error {
+	report, err := h.CheckStorage(ctx, clean)
+	if report != nil {
+		h.logger.InfoContext(ctx, "storage: check complete",
+			"clean", clean, "orphaned", len(report.Orphaned), "missing", len(report.Missing), "failed", report.Failed)
+		h.audit(ctx, report.action(), "system", report.String())
+	}
+	if err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("storage: %d deletion(s) failed", report.Failed)
+	}
+	return nil
+}
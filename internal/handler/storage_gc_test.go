@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestCheckStorage(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := uploadTokenForProject(t, app, "docs")
+	if resp := postArchive(t, app, "docs", token, "1.0.0", quotaArchive(t)); resp.StatusCode != 200 {
+		t.Fatalf("upload failed with %d", resp.StatusCode)
+	}
+	project, _ := app.handler.projects.GetBySlug(ctx, "docs")
+
+	// A version whose files are gone
+	admin := seedAdmin(t, app)
+	missing := &database.Version{ProjectID: project.ID, Tag: "0.9.0", ContentType: "archive", UploadedBy: admin.ID}
+	if err := app.handler.versions.Create(ctx, missing); err != nil {
+		t.Fatal(err)
+	}
+
+	// Directories without a version: an old one, one of a deleted project
+	// and one an upload is still writing to
+	old := time.Now().Add(-2 * time.Hour)
+	for _, dir := range []struct{ slug, tag string }{{"docs", "0.1.0"}, {"gone", "1.0.0"}} {
+		app.handler.storage.EnsureVersionDir(dir.slug, dir.tag)
+		os.Chtimes(app.handler.storage.VersionPath(dir.slug, dir.tag), old, old)
+	}
+	app.handler.storage.EnsureVersionDir("docs", "2.0.0")
+
+	report, err := app.handler.CheckStorage(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Orphaned) != 2 || report.Orphaned[0] != "docs@0.1.0" || report.Orphaned[1] != "gone@1.0.0" {
+		t.Errorf("unexpected orphaned directories: %v", report.Orphaned)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "docs@0.9.0" {
+		t.Errorf("unexpected missing versions: %v", report.Missing)
+	}
+	if !app.handler.storage.VersionExists("docs", "0.1.0") {
+		t.Error("expected a check to delete nothing")
+	}
+
+	if _, err := app.handler.CheckStorage(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if app.handler.storage.VersionExists("docs", "0.1.0") {
+		t.Error("expected the orphaned directory to be deleted")
+	}
+	if _, err := os.Stat(app.handler.storage.ProjectPath("gone")); !os.IsNotExist(err) {
+		t.Error("expected the directory of the deleted project to be removed")
+	}
+	if !app.handler.storage.VersionExists("docs", "2.0.0") {
+		t.Error("expected a directory being uploaded to be kept")
+	}
+	if !app.handler.storage.VersionExists("docs", "1.0.0") {
+		t.Error("expected the uploaded version to be kept")
+	}
+	if _, err := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "0.9.0"); err == nil {
+		t.Error("expected the version with missing files to be deleted")
+	}
+}
+
+func TestCheckStorageKeepsProtected(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := uploadTokenForProject(t, app, "docs")
+	if resp := postArchive(t, app, "docs", token, "1.0.0", quotaArchive(t)); resp.StatusCode != 200 {
+		t.Fatalf("upload failed with %d", resp.StatusCode)
+	}
+	project, _ := app.handler.projects.GetBySlug(ctx, "docs")
+	admin := seedAdmin(t, app)
+	missing := &database.Version{ProjectID: project.ID, Tag: "0.9.0", ContentType: "archive", UploadedBy: admin.ID}
+	if err := app.handler.versions.Create(ctx, missing); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.handler.versions.SetProtected(ctx, missing.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := app.handler.CheckStorage(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "docs@0.9.0" {
+		t.Errorf("expected the protected version to be reported, got %v", report.Missing)
+	}
+	if _, err := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "0.9.0"); err != nil {
+		t.Errorf("expected the protected version to be kept: %v", err)
+	}
+}
+
+func TestCheckStorageUnmounted(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	project := seedProject(t, app, "docs", "Docs", true)
+	admin := seedAdmin(t, app)
+	v := &database.Version{ProjectID: project.ID, Tag: "1.0.0", ContentType: "archive", UploadedBy: admin.ID}
+	if err := app.handler.versions.Create(ctx, v); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.handler.CheckStorage(ctx, true); err != errStorageMissing {
+		t.Fatalf("expected errStorageMissing, got %v", err)
+	}
+	if _, err := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "1.0.0"); err != nil {
+		t.Error("expected no version to be deleted when all files are missing")
+	}
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// maxSuggestedTerms and maxSuggestedProjects limit the completions and
+// projects suggested for a search as it is typed.
+const (
+	maxSuggestedTerms    = 5
+	maxSuggestedProjects = 5
+)
+
+type searchSuggestions struct {
+	Terms    []string            `json:"terms"`
+	Pages    []docs.SearchResult `json:"pages"`
+	Projects []projectSuggestion `json:"projects"`
+}
+
+type projectSuggestion struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// handleAPISearchSuggest suggests completions of the last word of a search
+// as it is typed, the pages it would find and the projects whose name
+// starts with it. Completions only come from pages the user can view.
+// With format=opensearch, the completions are returned as OpenSearch
+// suggestions for browsers.
+func (h *Handler) handleAPISearchSuggest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	openSearch := query.Get("format") == "opensearch"
+	if !h.featureEnabled(ctx, featureSearchSuggest, nil) {
+		h.jsonError(w, "Search suggestions are disabled", http.StatusNotFound)
+		return
+	}
+
+	limit := 8
+	if l := query.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 20 {
+			limit = parsed
+		}
+	}
+
+	result := searchSuggestions{Terms: []string{}, Pages: []docs.SearchResult{}, Projects: []projectSuggestion{}}
+	if q != "" {
+		projectSlug := query.Get("project")
+		// Results are fetched generously, as some may be filtered out
+		suggestions, err := h.searchIndex.Suggest(ctx, docs.SearchQuery{
+			Query:       q,
+			ProjectSlug: projectSlug,
+			VersionTag:  query.Get("version"),
+			AllVersions: query.Get("all_versions") == "1",
+			Limit:       limit * 3,
+		}, h.getLatestVersionTags(ctx))
+		if ctx.Err() != nil {
+			return // client went away
+		}
+		if err != nil {
+			h.logger.ErrorContext(ctx, "search suggest failed", "error", err)
+			h.jsonError(w, "Search failed", http.StatusInternalServerError)
+			return
+		}
+
+		pages := &docs.SearchResults{}
+		for _, s := range suggestions {
+			pages.Results = append(pages.Results, s.SearchResult)
+		}
+		pages = h.filterSearchResults(ctx, user, pages, projectSlug != "")
+		allowed := make(map[string]bool)
+		for _, p := range pages.Results {
+			allowed[p.ProjectSlug+"/"+p.VersionTag] = true
+		}
+		result.Pages = pages.Results[:min(len(pages.Results), limit)]
+
+		// Completions found on more pages come first
+		counts := make(map[string]int)
+		for _, s := range suggestions {
+			if allowed[s.ProjectSlug+"/"+s.VersionTag] {
+				for _, term := range s.Terms {
+					counts[term]++
+				}
+			}
+		}
+		for term := range counts {
+			result.Terms = append(result.Terms, term)
+		}
+		slices.SortFunc(result.Terms, func(a, b string) int {
+			return cmp.Or(counts[b]-counts[a], strings.Compare(a, b))
+		})
+		result.Terms = result.Terms[:min(len(result.Terms), maxSuggestedTerms)]
+
+		if projectSlug == "" && !openSearch {
+			result.Projects = h.suggestProjects(w, r, user, q)
+		}
+	}
+
+	if openSearch {
+		completions := []string{}
+		words := strings.Fields(q)
+		for _, term := range result.Terms {
+			completions = append(completions, strings.Join(append(slices.Clone(words[:len(words)-1]), term), " "))
+		}
+		w.Header().Set("Content-Type", "application/x-suggestions+json")
+		json.NewEncoder(w).Encode([]any{q, completions})
+		return
+	}
+	h.jsonResponse(w, result)
+}
+
+// suggestProjects returns the projects listed for the user whose name, in
+// the request's language, has a word starting with q, or whose slug starts
+// with it.
+func (h *Handler) suggestProjects(w http.ResponseWriter, r *http.Request, user *database.User, q string) []projectSuggestion {
+	ctx := r.Context()
+	all, err := h.projects.List(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing projects for search suggest", "error", err)
+		return []projectSuggestion{}
+	}
+	var projects []database.Project
+	for _, p := range all {
+		if h.canListProject(ctx, user, &p) {
+			projects = append(projects, p)
+		}
+	}
+	h.localizeProjects(w, r, projects)
+
+	q = strings.ToLower(q)
+	suggestions := []projectSuggestion{}
+	for _, p := range projects {
+		name := strings.ToLower(p.Name)
+		if strings.HasPrefix(name, q) || strings.Contains(name, " "+q) || strings.HasPrefix(p.Slug, q) {
+			suggestions = append(suggestions, projectSuggestion{
+				Slug: p.Slug,
+				Name: p.Name,
+				URL:  h.config.Server.BasePath + "/project/" + p.Slug,
+			})
+			if len(suggestions) == maxSuggestedProjects {
+				break
+			}
+		}
+	}
+	return suggestions
+}
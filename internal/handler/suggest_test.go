@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestSearchSuggest(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	ctx := context.Background()
+
+	index := func(project *database.Project, pages map[string]string) {
+		t.Helper()
+		app.handler.storage.EnsureVersionDir(project.Slug, "v1.0.0")
+		path := app.handler.storage.VersionPath(project.Slug, "v1.0.0")
+		for name, content := range pages {
+			os.WriteFile(filepath.Join(path, name), []byte(content), 0644)
+		}
+		version := &database.Version{ProjectID: project.ID, Tag: "v1.0.0", StoragePath: path, UploadedBy: admin.ID}
+		app.handler.versions.Create(ctx, version)
+		if err := app.handler.searchIndex.IndexVersion(ctx, project.ID, version.ID, project.Slug, project.Name, "v1.0.0", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index(seedProject(t, app, "widgets", "Widget Handbook", true), map[string]string{
+		"index.html":  "<html><head><title>Configure Widgets</title></head><body><p>Configuration of widgets.</p></body></html>",
+		"setup.html":  "<html><head><title>Setup</title></head><body><p>Configure the widget configuration file.</p></body></html>",
+		"manual.html": "<html><head><title>Manual</title></head><body><p>Nothing to see here.</p></body></html>",
+	})
+	index(seedProject(t, app, "secret", "Secret Plans", false), map[string]string{
+		"index.html": "<html><head><title>Confidential</title></head><body><p>Confidential configurator.</p></body></html>",
+	})
+
+	suggest := func(query string) searchSuggestions {
+		t.Helper()
+		resp, err := http.Get(app.server.URL + "/api/search/suggest?q=" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var s searchSuggestions
+		json.NewDecoder(resp.Body).Decode(&s)
+		return s
+	}
+
+	s := suggest("conf")
+	if !slices.Equal(s.Terms, []string{"configuration", "configure"}) {
+		t.Errorf("expected completions from public pages, most frequent first, got %v", s.Terms)
+	}
+	if len(s.Pages) != 2 || s.Pages[0].PageTitle != "Configure Widgets" {
+		t.Errorf("expected the title match first, got %+v", s.Pages)
+	}
+	for _, p := range s.Pages {
+		if p.ProjectSlug != "widgets" {
+			t.Errorf("unexpected page of %s", p.ProjectSlug)
+		}
+	}
+
+	if s := suggest("configure+wid"); len(s.Pages) != 2 || !slices.Equal(s.Terms, []string{"widget", "widgets"}) {
+		t.Errorf("expected the earlier words to narrow the pages, got %+v", s)
+	}
+	if s := suggest("hand"); len(s.Projects) != 1 || s.Projects[0].Slug != "widgets" {
+		t.Errorf("expected the project to be suggested, got %+v", s.Projects)
+	}
+	if s := suggest("secr"); len(s.Projects) != 0 || len(s.Pages) != 0 {
+		t.Errorf("expected nothing of the private project, got %+v", s)
+	}
+	if s := suggest("c"); len(s.Terms) != 0 || len(s.Pages) != 0 {
+		t.Errorf("expected no suggestions for a single letter, got %+v", s)
+	}
+
+	resp, err := http.Get(app.server.URL + "/api/search/suggest?format=opensearch&q=Configure+wid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var openSearch []any
+	json.NewDecoder(resp.Body).Decode(&openSearch)
+	if resp.Header.Get("Content-Type") != "application/x-suggestions+json" || len(openSearch) != 2 ||
+		!strings.Contains(strings.Join(toStrings(openSearch[1]), "|"), "Configure widget") {
+		t.Errorf("unexpected OpenSearch suggestions %q: %v", resp.Header.Get("Content-Type"), openSearch)
+	}
+}
+
+func toStrings(v any) []string {
+	var out []string
+	items, _ := v.([]any)
+	for _, item := range items {
+		s, _ := item.(string)
+		out = append(out, s)
+	}
+	return out
+}
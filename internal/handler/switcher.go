@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// switcherVersionJSON is a version in the version switcher of the doc
+// overlay. URL is the page being read in that version if HasPage, and
+// the root of the version otherwise.
+type switcherVersionJSON struct {
+	Tag         string `json:"tag"`
+	ContentType string `json:"content_type"`
+	URL         string `json:"url"`
+	HasPage     bool   `json:"has_page"`
+}
+
+// handleVersionSwitcher lists the versions of a project, newest first, for
+// the version switcher of the doc overlay. ?path= is the page being read,
+// relative to the root of its version, so that switching versions keeps
+// readers on the same page where the other version has it.
+func (h *Handler) handleVersionSwitcher(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil || !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	versions, err := h.versions.ListByProject(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing versions", "error", err)
+		h.jsonError(w, "Failed to list versions", http.StatusInternalServerError)
+		return
+	}
+
+	page := path.Clean("/" + r.URL.Query().Get("path"))[1:]
+	tags := make([]string, len(versions))
+	byTag := make(map[string]*database.Version, len(versions))
+	for i := range versions {
+		tags[i] = versions[i].Tag
+		byTag[versions[i].Tag] = &versions[i]
+	}
+	docs.SortVersionTags(tags)
+
+	result := make([]switcherVersionJSON, 0, len(tags))
+	for _, tag := range tags {
+		ver := byTag[tag]
+		if !h.storage.VersionExists(slug, tag) {
+			continue
+		}
+		entry := switcherVersionJSON{
+			Tag:         tag,
+			ContentType: ver.ContentType,
+			URL:         h.config.Server.BasePath + "/project/" + slug + "/" + escapePath(tag) + "/",
+		}
+		if page != "" && ver.ContentType != "pdf" && h.versionHasPage(project, h.storage.VersionPath(slug, tag), page) {
+			entry.URL += escapePath(page)
+			entry.HasPage = true
+		}
+		result = append(result, entry)
+	}
+	h.jsonResponse(w, result)
+}
+
+// versionHasPage reports whether the version stored in dir serves page,
+// as a file, a directory with an index.html or through a redirect.
+func (h *Handler) versionHasPage(project *database.Project, dir, page string) bool {
+	full := filepath.Join(dir, filepath.FromSlash(page))
+	if info, err := os.Stat(full); err == nil {
+		if !info.IsDir() {
+			return true
+		}
+		_, err := os.Stat(filepath.Join(full, "index.html"))
+		return err == nil
+	}
+	rules, _ := docs.ReadRedirects(dir)
+	if project.Redirects != "" {
+		projectRules, _ := docs.ParseRedirects(project.Redirects)
+		rules = append(rules, projectRules...)
+	}
+	_, ok := docs.MatchRedirect(rules, "/"+page)
+	return ok
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestVersionSwitcher(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	project.Redirects = "/moved.html /manual/moved.html"
+	app.handler.projects.Update(ctx, project)
+
+	for tag, files := range map[string]map[string]string{
+		"1.0.0": {"index.html": "index", "install.html": "install", "moved.html": "moved"},
+		"2.0.0": {"index.html": "index", "manual/moved.html": "moved", "manual/index.html": "manual"},
+	} {
+		dir := app.handler.storage.VersionPath("guide", tag)
+		for name, content := range files {
+			os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+			os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		}
+		if err := app.handler.versions.Create(ctx, &database.Version{ProjectID: project.ID, Tag: tag, StoragePath: dir, UploadedBy: admin.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(page string) []switcherVersionJSON {
+		t.Helper()
+		resp, err := http.Get(app.server.URL + "/project/guide/versions.json?path=" + page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var versions []switcherVersionJSON
+		json.NewDecoder(resp.Body).Decode(&versions)
+		return versions
+	}
+
+	tests := []struct {
+		page string
+		want map[string]string
+	}{
+		{"install.html", map[string]string{
+			"2.0.0": "/project/guide/2.0.0/",
+			"1.0.0": "/project/guide/1.0.0/install.html",
+		}},
+		{"moved.html", map[string]string{
+			"2.0.0": "/project/guide/2.0.0/moved.html",
+			"1.0.0": "/project/guide/1.0.0/moved.html",
+		}},
+		{"manual", map[string]string{
+			"2.0.0": "/project/guide/2.0.0/manual",
+			"1.0.0": "/project/guide/1.0.0/",
+		}},
+		{"../../other/1.0.0/index.html", map[string]string{
+			"2.0.0": "/project/guide/2.0.0/",
+			"1.0.0": "/project/guide/1.0.0/",
+		}},
+	}
+	for _, tt := range tests {
+		versions := get(tt.page)
+		if len(versions) != 2 || versions[0].Tag != "2.0.0" {
+			t.Fatalf("%s: expected both versions, newest first, got %+v", tt.page, versions)
+		}
+		for _, v := range versions {
+			if v.URL != tt.want[v.Tag] || v.HasPage != (v.URL != "/project/guide/"+v.Tag+"/") {
+				t.Errorf("%s: expected %s to link to %q, got %+v", tt.page, v.Tag, tt.want[v.Tag], v)
+			}
+		}
+	}
+
+	seedProject(t, app, "secret", "Secret", false)
+	resp, err := http.Get(app.server.URL + "/project/secret/versions.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Error("expected the versions of a private project to be hidden from anonymous users")
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+const maxProjectTags = 20
+
+var projectTagRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9.+_-]{0,31}$`)
+
+// normalizeTags lowercases tags, joins words with hyphens, and returns them
+// sorted without duplicates.
+func normalizeTags(tags []string) ([]string, error) {
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+		if tag == "" {
+			continue
+		}
+		if !projectTagRegex.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q: use 1-32 letters, digits, dots, plus signs, hyphens and underscores", tag)
+		}
+		result = append(result, tag)
+	}
+	slices.Sort(result)
+	result = slices.Compact(result)
+	if len(result) > maxProjectTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxProjectTags)
+	}
+	return result, nil
+}
+
+// parseTagText parses the comma-separated tags entered in the web UI.
+func parseTagText(text string) ([]string, error) {
+	return normalizeTags(strings.Split(text, ","))
+}
+
+// tagCounts returns how many of projects carry each tag.
+func tagCounts(projects []database.Project, tags map[int64][]string) map[string]int {
+	counts := make(map[string]int)
+	for _, p := range projects {
+		for _, tag := range tags[p.ID] {
+			counts[tag]++
+		}
+	}
+	return counts
+}
+
+func (h *Handler) handleAPIGetProjectTags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	tags, err := h.tags.Get(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading project tags", "error", err)
+		h.jsonError(w, "Failed to load tags", http.StatusInternalServerError)
+		return
+	}
+	h.writeResource(w, http.StatusOK, tags)
+}
+
+// handleAPIPutProjectTags replaces a project's tags.
+func (h *Handler) handleAPIPutProjectTags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	user := h.authenticateToken(w, r, project.ID, auth.ScopeAdminProject)
+	if user == nil {
+		return
+	}
+	if !h.canUpload(ctx, user, project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req []string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON body: expected an array of strings", http.StatusBadRequest)
+		return
+	}
+	tags, err := normalizeTags(req)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	current, err := h.tags.Get(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading project tags", "error", err)
+		h.jsonError(w, "Failed to load tags", http.StatusInternalServerError)
+		return
+	}
+	if !h.checkPreconditions(w, r, resourceETag(current)) {
+		return
+	}
+
+	if !slices.Equal(current, tags) {
+		if err := h.tags.Set(ctx, project.ID, tags); err != nil {
+			h.logger.ErrorContext(ctx, "setting project tags", "error", err)
+			h.jsonError(w, "Failed to save tags", http.StatusInternalServerError)
+			return
+		}
+		data := projectEventData(project, user)
+		data["tags"] = tags
+		h.emitEvent(ctx, database.EventProjectUpdated, project.Slug, data)
+	}
+	h.writeResource(w, http.StatusOK, tags)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestProjectTags(t *testing.T) {
+	app := setupTestApp(t)
+	token := adminAPIToken(t, app)
+	for _, slug := range []string{"go-sdk", "py-sdk", "handbook"} {
+		resp := apiRequest(t, app, "PUT", "/api/project/"+slug, token, `{"visibility": "public"}`, nil)
+		resp.Body.Close()
+	}
+
+	resp := apiRequest(t, app, "PUT", "/api/project/go-sdk/tags", token, `["SDK", "Go", "sdk", "Client Library"]`, nil)
+	var tags []string
+	json.NewDecoder(resp.Body).Decode(&tags)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !slices.Equal(tags, []string{"client-library", "go", "sdk"}) {
+		t.Fatalf("expected normalized tags, got %d %v", resp.StatusCode, tags)
+	}
+	resp = apiRequest(t, app, "PUT", "/api/project/py-sdk/tags", token, `["sdk", "python"]`, nil)
+	resp.Body.Close()
+
+	resp = apiRequest(t, app, "PUT", "/api/project/handbook/tags", token, `["no/slashes"]`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid tag, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "GET", "/api/projects?tag=sdk&facets=tags", token, "", nil)
+	var result struct {
+		Projects []struct {
+			Slug string   `json:"slug"`
+			Tags []string `json:"tags"`
+		} `json:"projects"`
+		Facets struct {
+			Tags map[string]int `json:"tags"`
+		} `json:"facets"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if len(result.Projects) != 2 {
+		t.Errorf("expected the two SDK projects, got %+v", result.Projects)
+	}
+	if result.Facets.Tags["sdk"] != 2 || result.Facets.Tags["python"] != 1 {
+		t.Errorf("unexpected tags facet: %v", result.Facets.Tags)
+	}
+
+	body := getBody(t, app.server.URL+"/?tag=python")
+	if !strings.Contains(body, "py-sdk") || strings.Contains(body, "go-sdk") {
+		t.Error("expected only the python project on the filtered front page")
+	}
+	if !strings.Contains(body, "tag-chip-active") {
+		t.Error("expected the active tag to be marked")
+	}
+
+	if body := getBody(t, app.server.URL+"/project/go-sdk"); !strings.Contains(body, "?tag=client-library") {
+		t.Error("expected tag chips on the project page")
+	}
+}
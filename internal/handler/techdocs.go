@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// techDocsEntityKey is the metadata label that maps a Backstage entity
+// reference (kind:namespace/name) to a project. Without it, an entity
+// resolves to the project whose slug equals the entity name.
+const techDocsEntityKey = "backstage-entity"
+
+const techDocsMetadataFile = "techdocs_metadata.json"
+
+type techDocsMetadata struct {
+	SiteName        string   `json:"site_name"`
+	SiteDescription string   `json:"site_description"`
+	Etag            string   `json:"etag"`
+	BuildTimestamp  int64    `json:"build_timestamp"`
+	Files           []string `json:"files,omitempty"`
+}
+
+// entityRef normalizes a Backstage entity reference. The namespace
+// defaults to "default" and references compare case-insensitively.
+func entityRef(kind, namespace, name string) string {
+	if namespace == "" {
+		namespace = "default"
+	}
+	return strings.ToLower(kind + ":" + namespace + "/" + name)
+}
+
+func parseEntityRef(ref string) string {
+	kind, rest, ok := strings.Cut(strings.TrimSpace(ref), ":")
+	if !ok {
+		return ""
+	}
+	namespace, name, ok := strings.Cut(rest, "/")
+	if !ok {
+		namespace, name = "", rest
+	}
+	return entityRef(kind, namespace, name)
+}
+
+// techDocsProject resolves an entity triplet to a project.
+func (h *Handler) techDocsProject(ctx context.Context, namespace, kind, name string) (*database.Project, error) {
+	ref := entityRef(kind, namespace, name)
+	metadata, err := h.metadata.ListProjects(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing project metadata: %w", err)
+	}
+	for projectID, meta := range metadata {
+		if value, ok := meta[techDocsEntityKey]; ok && parseEntityRef(value) == ref {
+			return h.projects.GetByID(ctx, projectID)
+		}
+	}
+	return h.projects.GetBySlug(ctx, strings.ToLower(name))
+}
+
+// techDocsTarget resolves the request's entity to a viewable project and
+// its latest version, writing an error response if that fails.
+func (h *Handler) techDocsTarget(w http.ResponseWriter, r *http.Request) (*database.Project, *database.Version, bool) {
+	ctx := r.Context()
+	project, err := h.techDocsProject(ctx, r.PathValue("namespace"), r.PathValue("kind"), r.PathValue("name"))
+	if err != nil {
+		h.jsonError(w, "Entity not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return nil, nil, false
+	}
+
+	versions, err := h.versions.ListByProject(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing versions", "error", err)
+		h.jsonError(w, "Failed to list versions", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	tag := latestVersionTag(versions, project.PinnedVersion)
+	for i := range versions {
+		if versions[i].Tag == tag {
+			return project, &versions[i], true
+		}
+	}
+	h.jsonError(w, "No documentation published for this entity", http.StatusNotFound)
+	return nil, nil, false
+}
+
+// buildTechDocsMetadata describes a version in the techdocs_metadata.json
+// format for documentation that was not built with a TechDocs generator.
+func buildTechDocsMetadata(ctx context.Context, project *database.Project, version *database.Version, storagePath string) techDocsMetadata {
+	meta := techDocsMetadata{
+		SiteName:        project.Name,
+		SiteDescription: project.Description,
+		Etag:            fmt.Sprintf("%s-%d", version.Tag, version.CreatedAt.Unix()),
+		BuildTimestamp:  version.CreatedAt.Unix(),
+	}
+	filepath.WalkDir(storagePath, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(storagePath, path); err == nil {
+			meta.Files = append(meta.Files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return meta
+}
+
+// serveTechDocsMetadata serves the techdocs_metadata.json of the version,
+// or generates one if the documentation does not ship it.
+func (h *Handler) serveTechDocsMetadata(w http.ResponseWriter, r *http.Request, project *database.Project, version *database.Version) {
+	storagePath := h.storage.VersionPath(project.Slug, version.Tag)
+	if _, err := os.Stat(filepath.Join(storagePath, techDocsMetadataFile)); err == nil {
+		w.Header().Set("Content-Type", "application/json")
+		docs.ServeDoc(w, r, storagePath, techDocsMetadataFile)
+		return
+	}
+	meta := buildTechDocsMetadata(r.Context(), project, version, storagePath)
+	if r.Context().Err() != nil {
+		return // client went away
+	}
+	h.jsonResponse(w, meta)
+}
+
+// handleTechDocsStatic serves documentation files of an entity's latest
+// version, like the static/docs route of the TechDocs backend.
+func (h *Handler) handleTechDocsStatic(w http.ResponseWriter, r *http.Request) {
+	project, version, ok := h.techDocsTarget(w, r)
+	if !ok {
+		return
+	}
+	filePath := r.PathValue("path")
+	if filePath == techDocsMetadataFile {
+		h.serveTechDocsMetadata(w, r, project, version)
+		return
+	}
+	docs.ServeDocWithOptions(w, r, h.storage.VersionPath(project.Slug, version.Tag), filePath, h.docServeOptions(project, ""))
+}
+
+func (h *Handler) handleTechDocsMetadata(w http.ResponseWriter, r *http.Request) {
+	project, version, ok := h.techDocsTarget(w, r)
+	if !ok {
+		return
+	}
+	h.serveTechDocsMetadata(w, r, project, version)
+}
+
+// handleTechDocsEntityMetadata returns a minimal catalog entity for the
+// project, which the TechDocs reader uses for its page header.
+func (h *Handler) handleTechDocsEntityMetadata(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := h.techDocsTarget(w, r)
+	if !ok {
+		return
+	}
+	h.jsonResponse(w, map[string]any{
+		"apiVersion": "backstage.io/v1alpha1",
+		"kind":       r.PathValue("kind"),
+		"metadata": map[string]any{
+			"namespace":   r.PathValue("namespace"),
+			"name":        r.PathValue("name"),
+			"title":       project.Name,
+			"description": project.Description,
+		},
+	})
+}
+
+// handleTechDocsSync answers the reader's build check. Documentation is
+// published by uploads, so there is never anything to rebuild.
+func (h *Handler) handleTechDocsSync(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := h.techDocsTarget(w, r); !ok {
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		fmt.Fprint(w, "event: finish\ndata: {\"updated\":false}\n\n")
+		return
+	}
+	h.jsonResponse(w, map[string]bool{"updated": false})
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTechDocsServesLatestVersion(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "payments")
+	resp := postArchive(t, app, "payments", token, "1.0.0", createTestZip(t, map[string]string{"index.html": "<html>payments docs</html>"}))
+	resp.Body.Close()
+
+	resp = apiRequest(t, app, "GET", "/api/techdocs/static/docs/default/component/Payments/index.html", token, "", nil)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "<html>payments docs</html>" {
+		t.Fatalf("expected docs page, got %d %q", resp.StatusCode, body)
+	}
+
+	resp = apiRequest(t, app, "GET", "/api/techdocs/static/docs/default/component/payments/techdocs_metadata.json", token, "", nil)
+	defer resp.Body.Close()
+	var meta techDocsMetadata
+	json.NewDecoder(resp.Body).Decode(&meta)
+	if meta.SiteName != "Limits Project" || len(meta.Files) != 1 || !strings.HasPrefix(meta.Etag, "1.0.0-") {
+		t.Errorf("unexpected generated metadata %+v", meta)
+	}
+
+	// Private projects stay private
+	anon, err := http.Get(app.server.URL + "/api/techdocs/metadata/techdocs/default/component/payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anon.Body.Close()
+	if anon.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for anonymous caller, got %d", anon.StatusCode)
+	}
+}
+
+func TestTechDocsEntityLabelMapping(t *testing.T) {
+	app := setupTestApp(t)
+	project := seedProject(t, app, "handbook", "Handbook", true)
+	app.handler.metadata.SetProject(context.Background(), project.ID, map[string]string{techDocsEntityKey: "System:platform/Company-Handbook"})
+
+	resp, err := http.Get(app.server.URL + "/api/techdocs/metadata/entity/platform/system/company-handbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// The project has no versions yet, but the entity must resolve to it
+	var body map[string]string
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusNotFound || body["error"] != "No documentation published for this entity" {
+		t.Errorf("expected the mapped project without docs, got %d %v", resp.StatusCode, body)
+	}
+}
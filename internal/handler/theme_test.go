@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestUserTheme(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	admin := seedAdmin(t, app)
+	cookies := loginUser(t, app, "admin", "admin123")
+
+	setTheme := func(theme string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", app.server.URL+"/profile/theme", strings.NewReader(url.Values{"theme": {theme}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp, string(body)
+	}
+
+	resp, body := setTheme("dark")
+	if !strings.Contains(body, "Theme saved") || !strings.Contains(body, `<html lang="en" data-theme="dark">`) {
+		t.Fatal("expected the theme to be saved and applied")
+	}
+	var saved *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == themeCookie {
+			saved = c
+		}
+	}
+	if saved == nil || saved.Value != "dark" {
+		t.Errorf("expected the theme to be remembered in a cookie, got %v", saved)
+	}
+	if user, _ := app.handler.users.GetByID(ctx, admin.ID); user.Theme != database.ThemeDark {
+		t.Errorf("expected the dark theme to be stored, got %q", user.Theme)
+	}
+
+	if _, body := setTheme("neon"); !strings.Contains(body, "Invalid theme") {
+		t.Error("expected an unknown theme to be refused")
+	}
+
+	// Docs that follow the reader's theme get the overlay in theirs, and
+	// follow the browser for readers who chose none.
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+	project.OverlayTheme = database.OverlayAuto
+	app.handler.projects.Update(ctx, project)
+
+	setTheme("light")
+	req, _ := http.NewRequest("GET", app.server.URL+"/project/guide/1.0.0/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), `class=" ao-theme-light"`) {
+		t.Error("expected the overlay in the reader's light theme")
+	}
+	if body := getBody(t, app.server.URL+"/project/guide/1.0.0/"); !strings.Contains(body, `class=" ao-theme-auto"`) {
+		t.Error("expected the overlay to follow the browser for anonymous readers")
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// renderThumbnail renders the preview image of a version. Each version is
+// rendered at most once at a time; a failed rendering is not retried until
+// the version is uploaded again or the server restarts.
+func (h *Handler) renderThumbnail(slug, tag string) {
+	key := slug + "/" + tag
+	if _, running := h.thumbnailRenders.LoadOrStore(key, true); running {
+		return
+	}
+
+	timeout := time.Duration(h.config.Thumbnails.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(h.jobsCtx, timeout)
+	defer cancel()
+
+	err := docs.RenderThumbnail(ctx, h.config.Thumbnails.Command, h.storage.VersionPath(slug, tag), h.storage.AttachmentPath(slug, tag))
+	if err != nil {
+		h.logger.ErrorContext(ctx, "rendering thumbnail", "error", err, "project", slug, "version", tag)
+		return
+	}
+	h.thumbnailRenders.Delete(key)
+	h.logger.InfoContext(ctx, "thumbnail rendered", "project", slug, "version", tag)
+}
+
+// rerenderThumbnail replaces the preview image of a re-uploaded or new
+// version.
+func (h *Handler) rerenderThumbnail(slug, tag string) {
+	h.thumbnailRenders.Delete(slug + "/" + tag)
+	h.renderThumbnail(slug, tag)
+}
+
+// hasThumbnail reports whether a version has a preview image. Versions
+// uploaded before thumbnails were enabled are rendered in the background
+// the first time they are asked for.
+func (h *Handler) hasThumbnail(slug, tag string) bool {
+	if h.config.Thumbnails.Command == "" || tag == "" {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(h.storage.AttachmentPath(slug, tag), docs.ThumbnailFile)); err == nil {
+		return true
+	}
+	if _, err := os.Stat(filepath.Join(h.storage.VersionPath(slug, tag), "index.html")); err == nil {
+		h.goJob(h.jobsCtx, func(context.Context) { h.renderThumbnail(slug, tag) })
+	}
+	return false
+}
+
+func (h *Handler) handleThumbnail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !h.canViewProject(ctx, user, project) {
+		if user == nil {
+			h.redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, r.PathValue("tag"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := filepath.Join(h.storage.AttachmentPath(project.Slug, version.Tag), docs.ThumbnailFile)
+	if _, err := os.Stat(path); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+func TestProjectCardThumbnails(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	public := seedProject(t, app, "guide", "Guide", true)
+	private := seedProject(t, app, "internal", "Internal", false)
+	seedSEOVersion(t, app, public, admin, "1.0.0")
+	seedSEOVersion(t, app, private, admin, "1.0.0")
+	app.handler.config.Thumbnails.Command = "cp {input} {output}"
+
+	// The first view renders the thumbnail in the background.
+	if strings.Contains(getBody(t, app.server.URL+"/"), "project-card-thumbnail") {
+		t.Fatal("expected no thumbnail before rendering")
+	}
+	thumbnail := filepath.Join(app.handler.storage.AttachmentPath("guide", "1.0.0"), docs.ThumbnailFile)
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(thumbnail); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if !strings.Contains(getBody(t, app.server.URL+"/"), `src="/project/guide/version/1.0.0/thumbnail.png"`) {
+		t.Error("expected the project card to show the thumbnail")
+	}
+	if body := getBody(t, app.server.URL+"/project/guide/version/1.0.0/thumbnail.png"); body != "<html></html>" {
+		t.Errorf("unexpected thumbnail %q", body)
+	}
+
+	app.handler.rerenderThumbnail("internal", "1.0.0")
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for path, want := range map[string]int{
+		"/project/internal/version/1.0.0/thumbnail.png": http.StatusSeeOther,
+		"/project/guide/version/9.9.9/thumbnail.png":    http.StatusNotFound,
+	} {
+		resp, err := client.Get(app.server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s: expected %d, got %d", path, want, resp.StatusCode)
+		}
+	}
+}
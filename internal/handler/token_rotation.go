@@ -0,0 +1,297 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+const (
+	defaultRotationDays  = 365
+	defaultRotationGrace = 14
+)
+
+// tokenCampaignTarget is a token picked by a rotation campaign, with who
+// to notify about it: the token's user and the owner of its project.
+type tokenCampaignTarget struct {
+	Token    database.APIToken
+	Username string
+	IsRobot  bool
+	Project  *database.Project
+	Notify   []string
+	// NewToken is the replacement token after a rotation, shown once
+	NewToken string
+}
+
+// rotationParams reads the age in days of the tokens to expire or rotate
+// and the grace period in days before the old tokens stop working.
+func rotationParams(r *http.Request) (days, grace int, err error) {
+	days, grace = defaultRotationDays, defaultRotationGrace
+	if v := r.FormValue("days"); v != "" {
+		if days, err = strconv.Atoi(v); err != nil || days < 0 {
+			return 0, 0, fmt.Errorf("invalid days: must be a number of days")
+		}
+	}
+	if v := r.FormValue("grace"); v != "" {
+		if grace, err = strconv.Atoi(v); err != nil || grace < 0 {
+			return 0, 0, fmt.Errorf("invalid grace: must be a number of days")
+		}
+	}
+	return days, grace, nil
+}
+
+// tokenCampaignTargets returns the tokens created more than days ago.
+// Tokens that already expire within the grace period are left out, so
+// running a campaign twice does not pick them up again.
+func (h *Handler) tokenCampaignTargets(ctx context.Context, days, grace int, now time.Time) ([]tokenCampaignTarget, error) {
+	tokens, err := h.tokens.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := now.AddDate(0, 0, -days)
+	deadline := now.AddDate(0, 0, grace)
+
+	users := make(map[int64]*database.User)
+	projects := make(map[int64]*database.Project)
+	ownerEmails := make(map[string]string)
+
+	var targets []tokenCampaignTarget
+	for _, token := range tokens {
+		if token.CreatedAt.After(cutoff) || (token.ExpiresAt != nil && !token.ExpiresAt.After(deadline)) {
+			continue
+		}
+
+		user, ok := users[token.UserID]
+		if !ok {
+			if user, err = h.users.GetByID(ctx, token.UserID); err != nil {
+				user = nil
+			}
+			users[token.UserID] = user
+		}
+
+		target := tokenCampaignTarget{Token: token}
+		var notify []string
+		if user != nil {
+			target.Username = user.Username
+			target.IsRobot = user.IsRobot
+			notify = append(notify, user.Email)
+		}
+
+		if token.ProjectID != nil {
+			project, ok := projects[*token.ProjectID]
+			if !ok {
+				if project, err = h.projects.GetByID(ctx, *token.ProjectID); err != nil {
+					project = nil
+				}
+				projects[*token.ProjectID] = project
+			}
+			target.Project = project
+			if project != nil {
+				if project.Owner != "" {
+					email, ok := ownerEmails[project.Owner]
+					if !ok {
+						if owner, err := h.users.GetByUsername(ctx, project.Owner); err == nil {
+							email = owner.Email
+						}
+						ownerEmails[project.Owner] = email
+					}
+					notify = append(notify, email)
+				}
+				if addr, err := mail.ParseAddress(project.OwnerContact); err == nil && addr.Name == "" {
+					notify = append(notify, addr.Address)
+				}
+			}
+		}
+
+		for _, email := range notify {
+			if email != "" && !slices.Contains(target.Notify, email) {
+				target.Notify = append(target.Notify, email)
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// notifyAddresses returns the distinct addresses to notify about targets.
+func notifyAddresses(targets []tokenCampaignTarget) []string {
+	var addresses []string
+	for _, t := range targets {
+		for _, email := range t.Notify {
+			if !slices.Contains(addresses, email) {
+				addresses = append(addresses, email)
+			}
+		}
+	}
+	return addresses
+}
+
+// handleAdminTokenRotation previews the tokens a rotation campaign would
+// expire or rotate.
+func (h *Handler) handleAdminTokenRotation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	days, grace, err := rotationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	targets, err := h.tokenCampaignTargets(ctx, days, grace, time.Now())
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing tokens", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.render(w, "admin_token_rotation", map[string]any{
+		"User":    user,
+		"Days":    days,
+		"Grace":   grace,
+		"Targets": targets,
+		"MailTo":  rotationMailTo(targets, days, grace),
+	})
+}
+
+// rotationMailTo builds a mailto: link that notifies everyone affected by a
+// campaign, with the addresses in Bcc.
+func rotationMailTo(targets []tokenCampaignTarget, days, grace int) string {
+	addresses := notifyAddresses(targets)
+	if len(addresses) == 0 {
+		return ""
+	}
+	q := url.Values{}
+	q.Set("bcc", strings.Join(addresses, ","))
+	q.Set("subject", "API token rotation")
+	q.Set("body", fmt.Sprintf("API tokens of asiakirjat that are older than %d days will stop working in %d days. Please replace them with new tokens.", days, grace))
+	return "mailto:?" + strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+// handleAdminTokenRotationCSV exports the tokens of a campaign with their
+// robots and owners. Token secrets are never part of the export.
+func (h *Handler) handleAdminTokenRotationCSV(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	days, grace, err := rotationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	targets, err := h.tokenCampaignTargets(ctx, days, grace, time.Now())
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing tokens", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="token-rotation.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"token_id", "token_name", "user", "robot", "project", "scopes", "created_at", "expires_at", "project_owner", "notify"})
+	for _, t := range targets {
+		var project, owner, expires string
+		if t.Project != nil {
+			project, owner = t.Project.Slug, t.Project.Owner
+		}
+		if t.Token.ExpiresAt != nil {
+			expires = t.Token.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		cw.Write([]string{
+			strconv.FormatInt(t.Token.ID, 10),
+			t.Token.Name,
+			t.Username,
+			strconv.FormatBool(t.IsRobot),
+			project,
+			t.Token.Scopes,
+			t.Token.CreatedAt.UTC().Format(time.RFC3339),
+			expires,
+			owner,
+			strings.Join(t.Notify, " "),
+		})
+	}
+	cw.Flush()
+}
+
+// handleAdminRunTokenRotation expires the tokens of a campaign at the end
+// of the grace period. With action=rotate, each token also gets a
+// replacement with the same user, project, name and scopes, shown once.
+func (h *Handler) handleAdminRunTokenRotation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	days, grace, err := rotationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	action := r.FormValue("action")
+	if action != "expire" && action != "rotate" {
+		http.Error(w, "Invalid action: must be expire or rotate", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	targets, err := h.tokenCampaignTargets(ctx, days, grace, now)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing tokens", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	deadline := now.AddDate(0, 0, grace).UTC().Truncate(time.Second)
+
+	var done int
+	for i := range targets {
+		t := &targets[i]
+		if action == "rotate" {
+			rawToken, err := auth.GenerateToken(32)
+			if err != nil {
+				h.logger.ErrorContext(ctx, "generating token", "error", err)
+				break
+			}
+			replacement := &database.APIToken{
+				UserID:    t.Token.UserID,
+				ProjectID: t.Token.ProjectID,
+				TokenHash: auth.HashToken(rawToken),
+				Name:      t.Token.Name,
+				Scopes:    t.Token.Scopes,
+			}
+			if err := h.tokens.Create(ctx, replacement); err != nil {
+				h.logger.ErrorContext(ctx, "creating token", "error", err, "token", t.Token.ID)
+				continue
+			}
+			t.NewToken = rawToken
+		}
+		if err := h.tokens.SetExpiresAt(ctx, t.Token.ID, &deadline); err != nil {
+			h.logger.ErrorContext(ctx, "expiring token", "error", err, "token", t.Token.ID)
+			continue
+		}
+		done++
+	}
+
+	h.audit(ctx, "token."+action, eventActor(user),
+		fmt.Sprintf("%d of %d tokens older than %d days, expiring %s", done, len(targets), days, deadline.Format("2006-01-02")))
+
+	h.render(w, "admin_token_rotation", map[string]any{
+		"User":     user,
+		"Days":     days,
+		"Grace":    grace,
+		"Targets":  targets,
+		"MailTo":   rotationMailTo(targets, days, grace),
+		"Done":     done,
+		"Action":   action,
+		"Deadline": deadline,
+	})
+}
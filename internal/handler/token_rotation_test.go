@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestTokenCampaignTargets(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+
+	owner := &database.User{Username: "alice", Email: "alice@example.com", AuthSource: "builtin", Role: "editor"}
+	app.handler.users.Create(ctx, owner)
+	project := seedProject(t, app, "svc", "Service", true)
+	project.Owner = "alice"
+	project.OwnerContact = "docs@example.com"
+	app.handler.projects.Update(ctx, project)
+
+	robot := &database.User{Username: "ci-bot", AuthSource: "robot", Role: "editor", IsRobot: true}
+	app.handler.users.Create(ctx, robot)
+	app.handler.tokens.Create(ctx, &database.APIToken{UserID: robot.ID, ProjectID: &project.ID, TokenHash: "a", Name: "ci", Scopes: "upload"})
+	soon := time.Now().AddDate(1, 0, 1)
+	app.handler.tokens.Create(ctx, &database.APIToken{UserID: robot.ID, TokenHash: "b", Name: "expiring", Scopes: "read", ExpiresAt: &soon})
+
+	if targets, _ := app.handler.tokenCampaignTargets(ctx, 365, 14, time.Now()); len(targets) != 0 {
+		t.Fatalf("expected no tokens older than a year, got %d", len(targets))
+	}
+
+	// A year from now both tokens are old, but one already expires within
+	// the grace period
+	targets, err := app.handler.tokenCampaignTargets(ctx, 365, 14, time.Now().AddDate(1, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].Token.Name != "ci" || !targets[0].IsRobot {
+		t.Fatalf("unexpected targets %+v", targets)
+	}
+	if got := strings.Join(targets[0].Notify, ","); got != "alice@example.com,docs@example.com" {
+		t.Errorf("expected the owner and the contact to be notified, got %q", got)
+	}
+}
+
+func TestAdminTokenRotation(t *testing.T) {
+	app := setupTestApp(t)
+	seedAdmin(t, app)
+	ctx := context.Background()
+
+	robot := &database.User{Username: "ci-bot", AuthSource: "robot", Role: "editor", IsRobot: true}
+	app.handler.users.Create(ctx, robot)
+	rawToken, _ := auth.GenerateToken(32)
+	old := &database.APIToken{UserID: robot.ID, TokenHash: auth.HashToken(rawToken), Name: "ci", Scopes: "upload,read"}
+	app.handler.tokens.Create(ctx, old)
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	do := func(method, path string, form url.Values) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, app.server.URL+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := do("GET", "/admin/tokens/rotation.csv?days=0", nil)
+	if code != http.StatusOK || !strings.HasPrefix(body, "token_id,token_name,user,robot") || !strings.Contains(body, ",ci,ci-bot,true,") {
+		t.Fatalf("unexpected CSV export (%d):\n%s", code, body)
+	}
+	if strings.Contains(body, old.TokenHash) {
+		t.Error("expected no token hashes in the export")
+	}
+
+	code, body = do("POST", "/admin/tokens/rotation", url.Values{"days": {"0"}, "grace": {"7"}, "action": {"rotate"}})
+	if code != http.StatusOK || !strings.Contains(body, "Rotated 1 of 1 tokens") {
+		t.Fatalf("expected the rotation result (%d)", code)
+	}
+
+	tokens, _ := app.handler.tokens.ListByUser(ctx, robot.ID)
+	if len(tokens) != 2 {
+		t.Fatalf("expected a replacement token, got %d tokens", len(tokens))
+	}
+	for _, token := range tokens {
+		if token.ID == old.ID {
+			if token.ExpiresAt == nil || token.ExpiresAt.Before(time.Now().AddDate(0, 0, 6)) {
+				t.Errorf("expected the old token to expire after the grace period, got %v", token.ExpiresAt)
+			}
+		} else if token.Name != "ci" || token.Scopes != "upload,read" || token.ExpiresAt != nil {
+			t.Errorf("unexpected replacement %+v", token)
+		} else if !strings.Contains(body, "<code class=\"token-display\">") {
+			t.Error("expected the replacement token to be shown")
+		}
+	}
+
+	// Tokens that already expire are not picked up again
+	if _, body = do("GET", "/admin/tokens/rotation.csv?days=0&grace=7", nil); strings.Count(body, "\n") != 2 {
+		t.Errorf("expected only the replacement token in a second campaign, got:\n%s", body)
+	}
+
+	entries, _ := app.handler.auditLog.List(ctx, 10)
+	if len(entries) == 0 || entries[0].Action != "token.rotate" {
+		t.Errorf("expected a token.rotate audit entry, got %+v", entries)
+	}
+}
@@ -0,0 +1,276 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+const maxProjectTranslations = 20
+
+// localeRegex matches the language tags of translations, such as "fi" or
+// "sv-fi", after lowercasing.
+var localeRegex = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8}){0,2}$`)
+
+// translationJSON is a translation in the API, keyed by its locale.
+type translationJSON struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// normalizeLocale lowercases a language tag and joins its parts with
+// hyphens, so "sv_FI" and "sv-fi" are the same locale.
+func normalizeLocale(locale string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(locale)), "_", "-")
+}
+
+// normalizeTranslations checks translations and returns them sorted by
+// locale. Translations without a name and description are dropped.
+func normalizeTranslations(translations []database.ProjectTranslation) ([]database.ProjectTranslation, error) {
+	result := []database.ProjectTranslation{}
+	seen := make(map[string]bool)
+	for _, t := range translations {
+		t.Locale = normalizeLocale(t.Locale)
+		t.Name = strings.TrimSpace(t.Name)
+		if t.Name == "" && strings.TrimSpace(t.Description) == "" {
+			continue
+		}
+		if !localeRegex.MatchString(t.Locale) {
+			return nil, fmt.Errorf("invalid locale %q: use a language tag such as fi or sv-FI", t.Locale)
+		}
+		if seen[t.Locale] {
+			return nil, fmt.Errorf("duplicate locale %q", t.Locale)
+		}
+		if len(t.Name) > 255 {
+			return nil, fmt.Errorf("name of locale %q is longer than 255 characters", t.Locale)
+		}
+		seen[t.Locale] = true
+		result = append(result, t)
+	}
+	if len(result) > maxProjectTranslations {
+		return nil, fmt.Errorf("at most %d translations are allowed", maxProjectTranslations)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Locale < result[j].Locale })
+	return result, nil
+}
+
+// requestLocales returns the locales a request prefers, best first: the
+// lang query parameter alone if given, otherwise the Accept-Language
+// header by quality.
+func requestLocales(r *http.Request) []string {
+	if lang := normalizeLocale(r.URL.Query().Get("lang")); lang != "" {
+		return []string{lang}
+	}
+
+	var locales []string
+
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var accepted []weighted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = normalizeLocale(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			accepted = append(accepted, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].q > accepted[j].q })
+	for _, a := range accepted {
+		locales = append(locales, a.locale)
+	}
+	return locales
+}
+
+// pickTranslation returns the translation for the most preferred locale
+// that has one, or nil. A locale also matches a translation of its
+// language, so "fi-fi" gets "fi", and a language matches its regional
+// translations, so "sv" gets "sv-fi".
+func pickTranslation(translations []database.ProjectTranslation, locales []string) *database.ProjectTranslation {
+	for _, locale := range locales {
+		for i := range translations {
+			if translations[i].Locale == locale {
+				return &translations[i]
+			}
+		}
+		lang, _, _ := strings.Cut(locale, "-")
+		for i := range translations {
+			if l, _, _ := strings.Cut(translations[i].Locale, "-"); l == lang {
+				return &translations[i]
+			}
+		}
+	}
+	return nil
+}
+
+// localizeProjects replaces the names and descriptions of projects with
+// the translations the request prefers. The response then varies by
+// Accept-Language.
+func (h *Handler) localizeProjects(w http.ResponseWriter, r *http.Request, projects []database.Project) {
+	if h.translations == nil {
+		return
+	}
+	w.Header().Add("Vary", "Accept-Language")
+	locales := requestLocales(r)
+	if len(locales) == 0 || len(projects) == 0 {
+		return
+	}
+	all, err := h.translations.List(r.Context())
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "listing project translations", "error", err)
+		return
+	}
+	for i := range projects {
+		applyTranslation(&projects[i], pickTranslation(all[projects[i].ID], locales))
+	}
+}
+
+// localizeProject is localizeProjects for a single project. It returns a
+// copy, as projects may be shared with a cache.
+func (h *Handler) localizeProject(w http.ResponseWriter, r *http.Request, project *database.Project) *database.Project {
+	projects := []database.Project{*project}
+	h.localizeProjects(w, r, projects)
+	return &projects[0]
+}
+
+func applyTranslation(p *database.Project, t *database.ProjectTranslation) {
+	if t == nil {
+		return
+	}
+	if t.Name != "" {
+		p.Name = t.Name
+	}
+	if t.Description != "" {
+		p.Description = t.Description
+	}
+}
+
+// translationMap converts translations to their API form.
+func translationMap(translations []database.ProjectTranslation) map[string]translationJSON {
+	result := make(map[string]translationJSON, len(translations))
+	for _, t := range translations {
+		result[t.Locale] = translationJSON{Name: t.Name, Description: t.Description}
+	}
+	return result
+}
+
+// parseTranslationForm reads the translation rows of the project edit form.
+func parseTranslationForm(r *http.Request) ([]database.ProjectTranslation, error) {
+	locales := r.Form["translation_locale"]
+	names := r.Form["translation_name"]
+	descriptions := r.Form["translation_description"]
+	var translations []database.ProjectTranslation
+	for i, locale := range locales {
+		t := database.ProjectTranslation{Locale: locale}
+		if i < len(names) {
+			t.Name = names[i]
+		}
+		if i < len(descriptions) {
+			t.Description = descriptions[i]
+		}
+		if strings.TrimSpace(locale) == "" {
+			continue
+		}
+		translations = append(translations, t)
+	}
+	return normalizeTranslations(translations)
+}
+
+func (h *Handler) handleAPIGetProjectTranslations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	translations, err := h.translations.Get(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading project translations", "error", err)
+		h.jsonError(w, "Failed to load translations", http.StatusInternalServerError)
+		return
+	}
+	h.writeResource(w, http.StatusOK, translationMap(translations))
+}
+
+// handleAPIPutProjectTranslations replaces a project's translations.
+func (h *Handler) handleAPIPutProjectTranslations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	user := h.authenticateToken(w, r, project.ID, auth.ScopeAdminProject)
+	if user == nil {
+		return
+	}
+	if !h.canUpload(ctx, user, project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req map[string]translationJSON
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, `Invalid JSON body: expected an object such as {"fi": {"name": "...", "description": "..."}}`, http.StatusBadRequest)
+		return
+	}
+	var requested []database.ProjectTranslation
+	for locale, t := range req {
+		requested = append(requested, database.ProjectTranslation{Locale: locale, Name: t.Name, Description: t.Description})
+	}
+	translations, err := normalizeTranslations(requested)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	current, err := h.translations.Get(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading project translations", "error", err)
+		h.jsonError(w, "Failed to load translations", http.StatusInternalServerError)
+		return
+	}
+	if !h.checkPreconditions(w, r, resourceETag(translationMap(current))) {
+		return
+	}
+
+	if !translationsEqual(current, translations) {
+		if err := h.translations.Set(ctx, project.ID, translations); err != nil {
+			h.logger.ErrorContext(ctx, "setting project translations", "error", err)
+			h.jsonError(w, "Failed to save translations", http.StatusInternalServerError)
+			return
+		}
+		data := projectEventData(project, user)
+		data["translations"] = translationMap(translations)
+		h.emitEvent(ctx, database.EventProjectUpdated, project.Slug, data)
+	}
+	h.writeResource(w, http.StatusOK, translationMap(translations))
+}
+
+// translationsEqual compares translations sorted by locale.
+func translationsEqual(a, b []database.ProjectTranslation) bool {
+	return slices.EqualFunc(a, b, func(x, y database.ProjectTranslation) bool {
+		return x.Locale == y.Locale && x.Name == y.Name && x.Description == y.Description
+	})
+}
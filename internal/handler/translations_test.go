@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestProjectTranslations(t *testing.T) {
+	app := setupTestApp(t)
+	token := adminAPIToken(t, app)
+	resp := apiRequest(t, app, "PUT", "/api/project/handbook", token, `{"name": "Handbook", "description": "The handbook", "visibility": "public"}`, nil)
+	resp.Body.Close()
+
+	resp = apiRequest(t, app, "PUT", "/api/project/handbook/translations", token,
+		`{"FI": {"name": "Käsikirja", "description": "Käsikirja kaikille"}, "sv_fi": {"name": "Handbok"}}`, nil)
+	var translations map[string]translationJSON
+	json.NewDecoder(resp.Body).Decode(&translations)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || translations["fi"].Name != "Käsikirja" || translations["sv-fi"].Name != "Handbok" {
+		t.Fatalf("expected normalized translations, got %d %v", resp.StatusCode, translations)
+	}
+
+	resp = apiRequest(t, app, "PUT", "/api/project/handbook/translations", token, `{"not a locale": {"name": "x"}}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid locale, got %d", resp.StatusCode)
+	}
+
+	projectName := func(header map[string]string, query string) (string, string) {
+		t.Helper()
+		resp := apiRequest(t, app, "GET", "/api/projects"+query, token, "", header)
+		defer resp.Body.Close()
+		var projects []struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		}
+		json.NewDecoder(resp.Body).Decode(&projects)
+		if len(projects) != 1 {
+			t.Fatalf("expected one project, got %+v", projects)
+		}
+		if !strings.Contains(resp.Header.Get("Vary"), "Accept-Language") {
+			t.Error("expected the project list to vary by Accept-Language")
+		}
+		return projects[0].Name, projects[0].Description
+	}
+	if name, desc := projectName(map[string]string{"Accept-Language": "fi-FI, en;q=0.8"}, ""); name != "Käsikirja" || desc != "Käsikirja kaikille" {
+		t.Errorf("expected the Finnish translation, got %q %q", name, desc)
+	}
+	if name, desc := projectName(map[string]string{"Accept-Language": "sv"}, ""); name != "Handbok" || desc != "The handbook" {
+		t.Errorf("expected the Swedish name and the default description, got %q %q", name, desc)
+	}
+	if name, _ := projectName(map[string]string{"Accept-Language": "fi"}, "?lang=en"); name != "Handbook" {
+		t.Errorf("expected the lang parameter to override Accept-Language, got %q", name)
+	}
+
+	req, _ := http.NewRequest("GET", app.server.URL+"/", nil)
+	req.Header.Set("Accept-Language", "fi")
+	page, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(page.Body)
+	page.Body.Close()
+	if !strings.Contains(string(body), "Käsikirja") {
+		t.Error("expected the Finnish name on the front page")
+	}
+}
+
+func TestRequestLocales(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "en;q=0.5, fi-FI, de;q=0, *")
+	if got := requestLocales(r); !slices.Equal(got, []string{"fi-fi", "en"}) {
+		t.Errorf("unexpected locales: %v", got)
+	}
+	r = httptest.NewRequest("GET", "/?lang=sv_FI", nil)
+	r.Header.Set("Accept-Language", "fi")
+	if got := requestLocales(r); !slices.Equal(got, []string{"sv-fi"}) {
+		t.Errorf("expected only the lang parameter, got %v", got)
+	}
+
+	translations := []database.ProjectTranslation{{Locale: "fi"}, {Locale: "sv-fi"}}
+	for _, tt := range []struct {
+		locales []string
+		want    string
+	}{
+		{[]string{"fi-fi"}, "fi"},
+		{[]string{"sv"}, "sv-fi"},
+		{[]string{"de", "sv-se"}, "sv-fi"},
+		{[]string{"de"}, ""},
+	} {
+		got := ""
+		if tr := pickTranslation(translations, tt.locales); tr != nil {
+			got = tr.Locale
+		}
+		if got != tt.want {
+			t.Errorf("pickTranslation(%v) = %q, want %q", tt.locales, got, tt.want)
+		}
+	}
+}
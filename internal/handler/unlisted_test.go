@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestUnlistedProject(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	seedProject(t, app, "open", "Open Docs", true)
+	project := seedProject(t, app, "hidden", "Hidden Docs", true)
+	project.Visibility = database.VisibilityUnlisted
+	if err := app.handler.projects.Update(context.Background(), project); err != nil {
+		t.Fatal(err)
+	}
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+
+	get := func(path string, cookies []*http.Cookie) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", app.server.URL+path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	// Anyone with the URL can read the docs, but search engines should not.
+	resp, _ := get("/project/hidden/1.0.0/guide/intro.html", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Robots-Tag") != "noindex" {
+		t.Errorf("expected a readable noindex page, got %d %q", resp.StatusCode, resp.Header.Get("X-Robots-Tag"))
+	}
+	if resp, _ := get("/project/hidden", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the project page to be readable, got %d", resp.StatusCode)
+	}
+
+	for _, path := range []string{"/", "/api/projects", "/sitemap.xml", "/robots.txt"} {
+		_, body := get(path, nil)
+		if strings.Contains(body, "hidden") {
+			t.Errorf("expected %s not to list the unlisted project for anonymous users", path)
+		}
+	}
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	for _, path := range []string{"/", "/api/projects"} {
+		_, body := get(path, cookies)
+		if !strings.Contains(body, "hidden") {
+			t.Errorf("expected %s to list the unlisted project for signed-in users", path)
+		}
+	}
+}
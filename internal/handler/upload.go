@@ -2,7 +2,12 @@ package handler
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -12,9 +17,14 @@ import (
 	"github.com/qwc/asiakirjat/internal/auth"
 	"github.com/qwc/asiakirjat/internal/database"
 	"github.com/qwc/asiakirjat/internal/docs"
+	"github.com/qwc/asiakirjat/internal/hooks"
 )
 
-const maxUploadSize = 100 << 20 // 100 MB
+// uploadMemoryLimit is how much of a multipart upload is held in memory;
+// larger file parts are streamed to temp files while parsing.
+const uploadMemoryLimit = 1 << 20 // 1 MB
+
+const maxSignatureSize = 64 << 10 // 64 KB
 
 func (h *Handler) handleUploadForm(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -39,6 +49,11 @@ func (h *Handler) handleUploadForm(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleUploadSubmit(w http.ResponseWriter, r *http.Request) {
+	done, ok := h.startUpload(w, false)
+	if !ok {
+		return
+	}
+	defer done()
 	ctx := r.Context()
 	user := auth.UserFromContext(ctx)
 	slug := r.PathValue("slug")
@@ -48,7 +63,7 @@ func (h *Handler) handleUploadSubmit(w http.ResponseWriter, r *http.Request) {
 		if h.config.Projects.AutoCreate && canAutoCreate(user) && isValidSlug(slug) {
 			project, err = h.autoCreateProject(ctx, slug, user)
 			if err != nil {
-				h.logger.Error("auto-creating project", "error", err)
+				h.logger.ErrorContext(ctx, "auto-creating project", "error", err)
 				http.Error(w, "Failed to create project", http.StatusInternalServerError)
 				return
 			}
@@ -63,12 +78,11 @@ func (h *Handler) handleUploadSubmit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
-	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+	if err := h.parseUploadForm(w, r); err != nil {
 		h.render(w, "upload", map[string]any{
 			"User":    user,
 			"Project": project,
-			"Error":   "File too large (max 100 MB)",
+			"Error":   fmt.Sprintf("File too large (max %d MB)", h.config.Upload.MaxSizeBytes()>>20),
 		})
 		return
 	}
@@ -82,6 +96,23 @@ func (h *Handler) handleUploadSubmit(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	versionTag, err = normalizeVersionTag(project, versionTag)
+	if err != nil {
+		h.render(w, "upload", map[string]any{
+			"User":    user,
+			"Project": project,
+			"Error":   err.Error(),
+		})
+		return
+	}
+	if err := h.checkOverwrite(ctx, project, versionTag, user, r.FormValue("force") == "true"); err != nil {
+		h.render(w, "upload", map[string]any{
+			"User":    user,
+			"Project": project,
+			"Error":   err.Error(),
+		})
+		return
+	}
 
 	file, header, err := r.FormFile("archive")
 	if err != nil {
@@ -93,23 +124,73 @@ func (h *Handler) handleUploadSubmit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer file.Close()
+	if err := h.checkUploadSize(project, header.Size); err != nil {
+		h.render(w, "upload", map[string]any{
+			"User":    user,
+			"Project": project,
+			"Error":   err.Error(),
+		})
+		return
+	}
+
+	sigStatus, sigKey, err := h.verifyUploadSignature(r, project, file)
+	if err != nil {
+		h.render(w, "upload", map[string]any{
+			"User":    user,
+			"Project": project,
+			"Error":   "Signature rejected: " + err.Error(),
+		})
+		return
+	}
+
+	attachmentFiles, err := h.uploadAttachments(r)
+	if err != nil {
+		h.render(w, "upload", map[string]any{
+			"User":    user,
+			"Project": project,
+			"Error":   "The " + err.Error(),
+		})
+		return
+	}
+
+	versionMeta, err := uploadMetadata(r)
+	if err != nil {
+		h.render(w, "upload", map[string]any{
+			"User":    user,
+			"Project": project,
+			"Error":   err.Error(),
+		})
+		return
+	}
+	releaseNotes, err := uploadReleaseNotes(r)
+	if err != nil {
+		h.render(w, "upload", map[string]any{
+			"User":    user,
+			"Project": project,
+			"Error":   err.Error(),
+		})
+		return
+	}
 
 	isPDF := strings.HasSuffix(strings.ToLower(header.Filename), ".pdf")
 
-	// Prepare storage directory
-	if err := h.storage.EnsureVersionDir(slug, versionTag); err != nil {
-		h.logger.Error("creating version directory", "error", err)
+	// The files are unpacked next to the version and swapped in once the
+	// upload is accepted, so a rejected re-upload leaves it untouched.
+	stagePath, err := h.stageVersion(slug, versionTag)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "creating version directory", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	defer os.RemoveAll(stagePath)
 
 	destPath := h.storage.VersionPath(slug, versionTag)
 	contentType := "archive"
 
+	var manifest docs.Manifest
 	if isPDF {
 		contentType = "pdf"
-		if err := storePDF(file, destPath); err != nil {
-			h.storage.DeleteVersion(slug, versionTag)
+		if manifest, err = storePDF(file, stagePath); err != nil {
 			h.render(w, "upload", map[string]any{
 				"User":    user,
 				"Project": project,
@@ -118,8 +199,9 @@ func (h *Handler) handleUploadSubmit(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	} else {
-		if err := docs.ExtractArchive(file, header.Filename, destPath); err != nil {
-			h.storage.DeleteVersion(slug, versionTag)
+		opts := h.extractOptions(project)
+		opts.Manifest = &manifest
+		if err := docs.ExtractArchiveWithOptions(file, header.Filename, stagePath, opts); err != nil {
 			h.render(w, "upload", map[string]any{
 				"User":    user,
 				"Project": project,
@@ -129,6 +211,34 @@ func (h *Handler) handleUploadSubmit(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if reason := h.checkUpload(ctx, hooks.Event{Project: slug, Version: versionTag, User: user.Username, Dir: stagePath, Filename: header.Filename}); reason != "" {
+		h.render(w, "upload", map[string]any{
+			"User":    user,
+			"Project": project,
+			"Error":   reason,
+		})
+		return
+	}
+	if err := h.checkQuota(ctx, project, versionTag, manifest.Size()); err != nil {
+		if !errors.Is(err, errQuotaExceeded) {
+			h.logger.ErrorContext(ctx, "checking storage quota", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		h.render(w, "upload", map[string]any{
+			"User":    user,
+			"Project": project,
+			"Error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.storage.ReplaceVersion(slug, versionTag, stagePath); err != nil {
+		h.logger.ErrorContext(ctx, "storing version files", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
 	// Check if version already exists (for re-upload)
 	existingVersion, _ := h.versions.GetByProjectAndTag(ctx, project.ID, versionTag)
 	isReupload := existingVersion != nil
@@ -138,11 +248,18 @@ func (h *Handler) handleUploadSubmit(w http.ResponseWriter, r *http.Request) {
 		// Update existing version
 		existingVersion.StoragePath = destPath
 		existingVersion.ContentType = contentType
+		existingVersion.LandingPath = h.detectLandingPage(project, contentType, destPath)
 		existingVersion.UploadedBy = user.ID
 		existingVersion.CreatedAt = time.Now()
+		existingVersion.SignatureStatus = sigStatus
+		existingVersion.SignatureKey = sigKey
+		existingVersion.SizeBytes = manifest.Size()
+		if releaseNotes != "" {
+			existingVersion.ReleaseNotes = releaseNotes
+		}
 		if err := h.versions.Update(ctx, existingVersion); err != nil {
 			h.storage.DeleteVersion(slug, versionTag)
-			h.logger.Error("updating version record", "error", err)
+			h.logger.ErrorContext(ctx, "updating version record", "error", err)
 			h.render(w, "upload", map[string]any{
 				"User":    user,
 				"Project": project,
@@ -164,10 +281,16 @@ func (h *Handler) handleUploadSubmit(w http.ResponseWriter, r *http.Request) {
 			StoragePath: destPath,
 			ContentType: contentType,
 			UploadedBy:  user.ID,
+			LandingPath: h.detectLandingPage(project, contentType, destPath),
+			SizeBytes:   manifest.Size(),
+
+			SignatureStatus: sigStatus,
+			SignatureKey:    sigKey,
+			ReleaseNotes:    releaseNotes,
 		}
 		if err := h.versions.Create(ctx, version); err != nil {
 			h.storage.DeleteVersion(slug, versionTag)
-			h.logger.Error("creating version record", "error", err)
+			h.logger.ErrorContext(ctx, "creating version record", "error", err)
 			h.render(w, "upload", map[string]any{
 				"User":    user,
 				"Project": project,
@@ -177,6 +300,17 @@ func (h *Handler) handleUploadSubmit(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if err := h.saveAttachments(ctx, slug, version, attachmentFiles, isReupload); err != nil {
+		h.logger.ErrorContext(ctx, "storing attachments", "error", err, "project", slug, "version", versionTag)
+	}
+	h.storeManifest(ctx, slug, versionTag, manifest)
+
+	if versionMeta != nil {
+		if err := h.metadata.SetVersion(ctx, version.ID, versionMeta); err != nil {
+			h.logger.ErrorContext(ctx, "setting version metadata", "error", err, "project", slug, "version", versionTag)
+		}
+	}
+
 	// Log the upload
 	if h.uploadLogs != nil {
 		uploadLog := &database.UploadLog{
@@ -188,7 +322,7 @@ func (h *Handler) handleUploadSubmit(w http.ResponseWriter, r *http.Request) {
 			Filename:    header.Filename,
 		}
 		if err := h.uploadLogs.Create(ctx, uploadLog); err != nil {
-			h.logger.Error("creating upload log", "error", err)
+			h.logger.ErrorContext(ctx, "creating upload log", "error", err)
 		}
 	}
 
@@ -196,40 +330,153 @@ func (h *Handler) handleUploadSubmit(w http.ResponseWriter, r *http.Request) {
 	if !isReupload && project.PinnedVersion != nil && !project.PinPermanent {
 		project.PinnedVersion = nil
 		if err := h.projects.Update(ctx, project); err != nil {
-			h.logger.Error("clearing temporary pin", "error", err)
+			h.logger.ErrorContext(ctx, "clearing temporary pin", "error", err)
 		}
 	}
 
-	// Invalidate latest tags cache
-	h.invalidateLatestTagsCache()
+	// Invalidate cached versions
+	h.invalidateVersions(project.ID)
+
+	h.emitEvent(ctx, database.EventVersionPublished, slug, map[string]any{
+		"version":      versionTag,
+		"content_type": contentType,
+		"reupload":     isReupload,
+		"actor":        user.Username,
+	})
+	if !isReupload {
+		h.notifyWatchers(ctx, project, version, user)
+	}
+	h.runHooksAsync(ctx, hooks.Event{Point: hooks.PostPublish, Project: slug, Version: versionTag, User: user.Username, Dir: destPath})
 
 	// Async index for full-text search
 	if h.searchIndex != nil {
-		go func() {
-			if err := h.searchIndex.IndexVersion(project.ID, version.ID, slug, project.Name, versionTag, destPath); err != nil {
-				h.logger.Error("indexing version", "error", err, "project", slug, "version", versionTag)
+		indexMeta := h.searchMetadata(ctx, project.ID, version.ID)
+		h.goJob(ctx, func(ctx context.Context) {
+			if err := h.searchIndex.IndexVersionWithMetadata(ctx, project.ID, version.ID, slug, project.Name, versionTag, destPath, indexMeta); err != nil {
+				h.logger.ErrorContext(ctx, "indexing version", "error", err, "project", slug, "version", versionTag)
 			}
-		}()
+		})
+	}
+
+	if h.config.Accessibility.CheckUploads && contentType == "archive" {
+		h.goJob(ctx, func(ctx context.Context) { h.checkVersionAccessibility(ctx, slug, versionTag, destPath) })
+	}
+
+	if h.config.Upload.CheckLinks && contentType == "archive" {
+		h.goJob(ctx, func(ctx context.Context) { h.checkVersionLinks(ctx, slug, versionTag, destPath) })
+	}
+
+	if h.config.Thumbnails.Command != "" && contentType == "archive" {
+		h.goJob(ctx, func(context.Context) { h.rerenderThumbnail(slug, versionTag) })
 	}
 
 	// Enforce retention after new non-semver upload
 	if !isReupload && !docs.IsSemver(versionTag) {
-		go h.enforceRetentionPolicy(context.Background(), project)
+		h.goJob(ctx, func(ctx context.Context) { h.enforceRetentionPolicy(ctx, project) })
 	}
 
 	h.redirect(w, r, "/project/"+slug, http.StatusSeeOther)
 }
 
-// storePDF copies a PDF file into destDir as "document.pdf".
-func storePDF(src io.Reader, destDir string) error {
+// parseUploadForm caps the request body at upload.max_size and parses the
+// multipart form. File parts above uploadMemoryLimit are spooled to disk, so
+// archives are never held in memory as a whole.
+func (h *Handler) parseUploadForm(w http.ResponseWriter, r *http.Request) error {
+	if r.MultipartForm != nil {
+		return nil
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.config.Upload.MaxSizeBytes())
+	return r.ParseMultipartForm(uploadMemoryLimit)
+}
+
+// extractOptions returns the archive extraction options from the upload
+// config and the settings of the project.
+func (h *Handler) extractOptions(project *database.Project) docs.ExtractOptions {
+	return docs.ExtractOptions{
+		Limits: docs.ExtractLimits{
+			MaxFileSize:  h.config.Upload.MaxFileSizeBytes(),
+			MaxTotalSize: h.config.Upload.MaxExtractedSizeBytes(),
+			MaxFiles:     h.config.Upload.MaxFiles,
+		},
+		KeepSingleRoot: h.config.Upload.KeepSingleRoot,
+		SanitizeHTML:   project.SanitizeHTML,
+	}
+}
+
+// verifyUploadSignature checks the optional "signature" form file, a
+// detached signature over the uploaded file, against the project's signing
+// keys. It returns the signature status and key fingerprint to store on the
+// version. Errors are meant to be shown to the uploader after "Signature
+// rejected: ".
+func (h *Handler) verifyUploadSignature(r *http.Request, project *database.Project, archive io.ReadSeeker) (string, string, error) {
+	sigFile, _, err := r.FormFile("signature")
+	if errors.Is(err, http.ErrMissingFile) {
+		if project.RequireSignature {
+			return "", "", errors.New("this project requires a signature file")
+		}
+		return database.SignatureUnsigned, "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("reading signature: %w", err)
+	}
+	defer sigFile.Close()
+
+	sig, err := io.ReadAll(io.LimitReader(sigFile, maxSignatureSize+1))
+	if err != nil {
+		return "", "", fmt.Errorf("reading signature: %w", err)
+	}
+	if len(sig) > maxSignatureSize {
+		return "", "", errors.New("signature file too large")
+	}
+
+	if strings.TrimSpace(project.SigningKeys) == "" {
+		if project.RequireSignature {
+			return "", "", errors.New("this project requires a signature but has no signing keys configured")
+		}
+		// Nothing to verify against; keep the upload unsigned
+		return database.SignatureUnsigned, "", nil
+	}
+
+	keyID, err := docs.VerifyDetachedSignature(archive, sig, project.SigningKeys)
+	if _, seekErr := archive.Seek(0, io.SeekStart); seekErr != nil {
+		return "", "", fmt.Errorf("rewinding upload: %w", seekErr)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("verification failed: %w", err)
+	}
+	return database.SignatureVerified, keyID, nil
+}
+
+// stageVersion creates the directory an upload of a version is unpacked
+// into before storage.ReplaceVersion swaps it in. It is kept in the project
+// directory, where a leading dot tells it from the versions.
+func (h *Handler) stageVersion(slug, tag string) (string, error) {
+	if err := h.storage.EnsureProjectDir(slug); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(h.storage.ProjectPath(slug), "."+tag+"-")
+}
+
+// storePDF copies a PDF file into destDir as "document.pdf" and returns
+// its manifest.
+func storePDF(src io.Reader, destDir string) (docs.Manifest, error) {
 	path := filepath.Join(destDir, "document.pdf")
+	// A deduplicated file is shared with other versions, so it is replaced
+	// rather than overwritten.
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
 	f, err := os.Create(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer f.Close()
-	_, err = io.Copy(f, src)
-	return err
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), src)
+	if err != nil {
+		return nil, err
+	}
+	return docs.Manifest{{Path: "document.pdf", Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}}, nil
 }
 
 func (h *Handler) canUpload(ctx context.Context, user *database.User, project *database.Project) bool {
@@ -238,28 +485,28 @@ func (h *Handler) canUpload(ctx context.Context, user *database.User, project *d
 	}
 	// Check user's global role first
 	if user.Role == "admin" || user.Role == "editor" {
-		h.logger.Debug("upload granted: global role", "username", user.Username, "project", project.Slug, "role", user.Role)
+		h.logger.DebugContext(ctx, "upload granted: global role", "username", user.Username, "project", project.Slug, "role", user.Role)
 		return true
 	}
 	// For private projects, check global access grants for editor role
 	if project.Visibility == database.VisibilityPrivate && h.globalAccess != nil {
 		grant, err := h.globalAccess.GetGrantByUser(ctx, user.ID)
 		if err == nil && grant != nil && (grant.Role == "editor" || grant.Role == "admin") {
-			h.logger.Debug("upload granted: global access grant", "username", user.Username, "project", project.Slug, "grant_role", grant.Role)
+			h.logger.DebugContext(ctx, "upload granted: global access grant", "username", user.Username, "project", project.Slug, "grant_role", grant.Role)
 			return true
 		}
 	}
 	// Check project-level access (from all sources: manual, ldap, oauth2)
 	effectiveRole, err := h.access.GetEffectiveRole(ctx, project.ID, user.ID)
 	if err != nil {
-		h.logger.Debug("upload denied: error checking project access", "username", user.Username, "project", project.Slug, "error", err)
+		h.logger.DebugContext(ctx, "upload denied: error checking project access", "username", user.Username, "project", project.Slug, "error", err)
 		return false
 	}
 	allowed := effectiveRole == "editor" || effectiveRole == "admin"
 	if allowed {
-		h.logger.Debug("upload granted: project-level access", "username", user.Username, "project", project.Slug, "effective_role", effectiveRole)
+		h.logger.DebugContext(ctx, "upload granted: project-level access", "username", user.Username, "project", project.Slug, "effective_role", effectiveRole)
 	} else {
-		h.logger.Debug("upload denied: insufficient project role", "username", user.Username, "project", project.Slug, "effective_role", effectiveRole)
+		h.logger.DebugContext(ctx, "upload denied: insufficient project role", "username", user.Username, "project", project.Slug, "effective_role", effectiveRole)
 	}
 	return allowed
 }
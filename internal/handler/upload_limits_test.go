@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func uploadTokenForProject(t *testing.T, app *testApp, slug string) string {
+	t.Helper()
+	ctx := context.Background()
+	project := seedProject(t, app, slug, "Limits Project", false)
+
+	robot := &database.User{Username: "limits-bot", AuthSource: "robot", Role: "editor", IsRobot: true}
+	app.handler.users.Create(ctx, robot)
+	app.handler.access.Grant(ctx, &database.ProjectAccess{ProjectID: project.ID, UserID: robot.ID, Role: "editor"})
+
+	rawToken, _ := auth.GenerateToken(32)
+	app.handler.tokens.Create(ctx, &database.APIToken{
+		UserID:    robot.ID,
+		TokenHash: auth.HashToken(rawToken),
+		Name:      "ci",
+		Scopes:    "upload,read",
+	})
+	return rawToken
+}
+
+// postArchive uploads an archive as a version through the API. The response
+// body is read and closed; the returned one holds a copy.
+func postArchive(t *testing.T, app *testApp, slug, token, tag string, archive io.Reader) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("version", tag)
+	part, _ := writer.CreateFormFile("archive", "docs.zip")
+	io.Copy(part, archive)
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", app.server.URL+"/api/project/"+slug+"/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp
+}
+
+func TestAPIUploadExceedsMaxSize(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.Upload.MaxSize = "1KB"
+	token := uploadTokenForProject(t, app, "limits")
+
+	// The body limit is hit while parsing, before the archive is inspected
+	resp := postArchive(t, app, "limits", token, "1.0.0", strings.NewReader(strings.Repeat("x", 8192)))
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIUploadExceedsExtractedFileSize(t *testing.T) {
+	app := setupTestApp(t)
+	app.handler.config.Upload.MaxFileSize = "1KB"
+	token := uploadTokenForProject(t, app, "limits")
+
+	// Highly compressible content: small upload, large extracted file
+	archive := createTestZip(t, map[string]string{"index.html": strings.Repeat("a", 64<<10)})
+	resp := postArchive(t, app, "limits", token, "1.0.0", archive)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", resp.StatusCode)
+	}
+
+	project, _ := app.handler.projects.GetBySlug(context.Background(), "limits")
+	if _, err := app.handler.versions.GetByProjectAndTag(context.Background(), project.ID, "1.0.0"); err == nil {
+		t.Error("expected no version to be created")
+	}
+}
+
+func TestAPIUploadSanitizesHTML(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "untrusted")
+	project, _ := app.handler.projects.GetBySlug(context.Background(), "untrusted")
+	project.SanitizeHTML = true
+	app.handler.projects.Update(context.Background(), project)
+
+	resp := postArchive(t, app, "untrusted", token, "1.0.0", createTestZip(t, map[string]string{
+		"index.html": `<html><body><p onmouseover="steal()">Docs</p><script>steal()</script></body></html>`,
+	}))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected the upload to succeed, got %d", resp.StatusCode)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(app.handler.storage.VersionPath("untrusted", "1.0.0"), "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stored) != `<html><head></head><body><p>Docs</p></body></html>` {
+		t.Errorf("expected the page to be sanitized, got %s", stored)
+	}
+}
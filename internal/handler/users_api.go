@@ -0,0 +1,498 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// The user and access admin API automates onboarding: it creates users and
+// robots, issues robot tokens, and sets who may access a project. Users and
+// project access documents follow the declarative API: PUT creates or
+// replaces them and responses carry an ETag for If-Match.
+
+type userResource struct {
+	ID         int64  `json:"id"`
+	Username   string `json:"username"`
+	Email      string `json:"email"`
+	Role       string `json:"role"`
+	AuthSource string `json:"auth_source"`
+	Robot      bool   `json:"robot"`
+}
+
+func newUserResource(u *database.User) userResource {
+	return userResource{
+		ID:         u.ID,
+		Username:   u.Username,
+		Email:      u.Email,
+		Role:       u.Role,
+		AuthSource: u.AuthSource,
+		Robot:      u.IsRobot,
+	}
+}
+
+// projectAccessDocument lists everyone with access to a project. Users
+// holds all grants, including those synced from LDAP or OAuth2; a PUT only
+// replaces the manual grants and the mappings not defined in the
+// configuration file.
+type projectAccessDocument struct {
+	Project       string               `json:"project"`
+	Users         []projectAccessEntry `json:"users"`
+	GroupMappings []groupMappingEntry  `json:"group_mappings"`
+}
+
+type projectAccessEntry struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Source   string `json:"source,omitempty"`
+}
+
+type groupMappingEntry struct {
+	AuthSource      string `json:"auth_source"`
+	GroupIdentifier string `json:"group_identifier"`
+	Role            string `json:"role"`
+	FromConfig      bool   `json:"from_config,omitempty"`
+}
+
+func isUserRole(role string) bool {
+	return role == "admin" || role == "editor" || role == "viewer"
+}
+
+func isGroupMappingSource(source string) bool {
+	return source == "ldap" || source == "oauth2" || source == "proxy" || source == "scim"
+}
+
+// handleAPIListUsers lists users and robots by username.
+func (h *Handler) handleAPIListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	users, err := h.users.List(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing users", "error", err)
+		h.jsonError(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+	robots, err := h.users.ListRobots(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing robots", "error", err)
+		h.jsonError(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+	users = append(users, robots...)
+	result := make([]userResource, 0, len(users))
+	for i := range users {
+		result = append(result, newUserResource(&users[i]))
+	}
+	slices.SortFunc(result, func(a, b userResource) int { return cmp.Compare(a.Username, b.Username) })
+	h.jsonResponse(w, result)
+}
+
+func (h *Handler) handleAPIGetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.users.GetByUsername(r.Context(), r.PathValue("username"))
+	if err != nil {
+		h.jsonError(w, "User not found", http.StatusNotFound)
+		return
+	}
+	h.writeResource(w, http.StatusOK, newUserResource(user))
+}
+
+// handleAPIPutUser creates a builtin user or a robot, or updates the role,
+// email and password of an existing one. Whether a user is a robot is
+// fixed at creation.
+func (h *Handler) handleAPIPutUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	caller := auth.UserFromContext(ctx)
+	username := r.PathValue("username")
+
+	var req struct {
+		Email    string `json:"email"`
+		Role     string `json:"role"`
+		Password string `json:"password"`
+		Robot    bool   `json:"robot"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if !isUserRole(req.Role) {
+		h.jsonError(w, "Invalid role: must be admin, editor or viewer", http.StatusBadRequest)
+		return
+	}
+
+	existing, _ := h.users.GetByUsername(ctx, username)
+	current := ""
+	if existing != nil {
+		current = resourceETag(newUserResource(existing))
+	}
+	if !h.checkPreconditions(w, r, current) {
+		return
+	}
+
+	var hash *string
+	if req.Password != "" {
+		if req.Robot || (existing != nil && existing.AuthSource != "builtin") {
+			h.jsonError(w, "Passwords can only be set for builtin users", http.StatusBadRequest)
+			return
+		}
+		hashed, err := auth.HashPassword(req.Password)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "hashing password", "error", err)
+			h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		hash = &hashed
+	}
+
+	if existing == nil {
+		user := &database.User{Username: username, Email: req.Email, Role: req.Role, AuthSource: "builtin", Password: hash}
+		if req.Robot {
+			user.AuthSource = "robot"
+			user.IsRobot = true
+		} else if hash == nil {
+			h.jsonError(w, "Password is required for new users", http.StatusBadRequest)
+			return
+		}
+		if err := h.users.Create(ctx, user); err != nil {
+			h.logger.ErrorContext(ctx, "creating user via API", "error", err)
+			h.jsonError(w, "Failed to create user", http.StatusInternalServerError)
+			return
+		}
+		h.audit(ctx, "user.create", caller.Username, username+": "+user.Role)
+		h.writeResource(w, http.StatusCreated, newUserResource(user))
+		return
+	}
+
+	if existing.IsRobot != req.Robot {
+		h.jsonError(w, "Cannot change whether a user is a robot", http.StatusConflict)
+		return
+	}
+	if existing.Role != req.Role || existing.Email != req.Email || hash != nil {
+		if existing.Role != req.Role {
+			h.audit(ctx, "user.role", caller.Username, username+": "+existing.Role+" -> "+req.Role)
+		}
+		existing.Role = req.Role
+		existing.Email = req.Email
+		if hash != nil {
+			existing.Password = hash
+		}
+		if err := h.users.Update(ctx, existing); err != nil {
+			h.logger.ErrorContext(ctx, "updating user via API", "error", err)
+			h.jsonError(w, "Failed to update user", http.StatusInternalServerError)
+			return
+		}
+	}
+	h.writeResource(w, http.StatusOK, newUserResource(existing))
+}
+
+func (h *Handler) handleAPIDeleteUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	caller := auth.UserFromContext(ctx)
+
+	user, _ := h.users.GetByUsername(ctx, r.PathValue("username"))
+	current := ""
+	if user != nil {
+		current = resourceETag(newUserResource(user))
+	}
+	if !h.checkPreconditions(w, r, current) {
+		return
+	}
+	if user == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if user.ID == caller.ID {
+		h.jsonError(w, "Cannot delete the authenticated user", http.StatusConflict)
+		return
+	}
+	if err := h.users.Delete(ctx, user.ID); err != nil {
+		h.logger.ErrorContext(ctx, "deleting user via API", "error", err)
+		h.jsonError(w, "Failed to delete user", http.StatusInternalServerError)
+		return
+	}
+	h.audit(ctx, "user.delete", caller.Username, user.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAPICreateRobotToken issues a token for a robot. The raw token is
+// only ever returned in this response.
+func (h *Handler) handleAPICreateRobotToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	caller := auth.UserFromContext(ctx)
+
+	robot, err := h.users.GetByUsername(ctx, r.PathValue("username"))
+	if err != nil {
+		h.jsonError(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if !robot.IsRobot {
+		h.jsonError(w, "Tokens can only be issued to robots", http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		Name      string     `json:"name"`
+		Project   string     `json:"project"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	scopes := auth.ScopeUpload
+	if len(req.Scopes) > 0 {
+		if scopes, err = auth.NormalizeScopes(req.Scopes); err != nil {
+			h.jsonError(w, "Invalid scopes: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	token := &database.APIToken{
+		UserID:    robot.ID,
+		Name:      cmp.Or(req.Name, "default"),
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if req.Project != "" {
+		project, err := h.projects.GetBySlug(ctx, req.Project)
+		if err != nil {
+			h.jsonError(w, "Project not found", http.StatusBadRequest)
+			return
+		}
+		token.ProjectID = &project.ID
+	}
+
+	rawToken, err := auth.GenerateToken(32)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "generating token", "error", err)
+		h.jsonError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	token.TokenHash = auth.HashToken(rawToken)
+	if err := h.tokens.Create(ctx, token); err != nil {
+		h.logger.ErrorContext(ctx, "creating token via API", "error", err)
+		h.jsonError(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+	h.audit(ctx, "token.create", caller.Username, robot.Username+": "+token.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":         token.ID,
+		"name":       token.Name,
+		"project":    req.Project,
+		"scopes":     token.Scopes,
+		"expires_at": token.ExpiresAt,
+		"token":      rawToken,
+	})
+}
+
+// projectAccess builds the access document of a project.
+func (h *Handler) projectAccess(ctx context.Context, project *database.Project) (*projectAccessDocument, error) {
+	doc := &projectAccessDocument{Project: project.Slug, Users: []projectAccessEntry{}, GroupMappings: []groupMappingEntry{}}
+
+	grants, err := h.access.ListByProject(ctx, project.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range grants {
+		user, err := h.users.GetByID(ctx, g.UserID)
+		if err != nil {
+			continue
+		}
+		doc.Users = append(doc.Users, projectAccessEntry{Username: user.Username, Role: g.Role, Source: g.Source})
+	}
+	slices.SortFunc(doc.Users, func(a, b projectAccessEntry) int {
+		return cmp.Or(cmp.Compare(a.Username, b.Username), cmp.Compare(a.Source, b.Source))
+	})
+
+	mappings, err := h.groupMappings.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mappings {
+		if m.ProjectID == project.ID {
+			doc.GroupMappings = append(doc.GroupMappings, groupMappingEntry{
+				AuthSource:      m.AuthSource,
+				GroupIdentifier: m.GroupIdentifier,
+				Role:            m.Role,
+				FromConfig:      m.FromConfig,
+			})
+		}
+	}
+	slices.SortFunc(doc.GroupMappings, func(a, b groupMappingEntry) int {
+		return cmp.Or(cmp.Compare(a.AuthSource, b.AuthSource), cmp.Compare(a.GroupIdentifier, b.GroupIdentifier))
+	})
+	return doc, nil
+}
+
+func (h *Handler) handleAPIGetProjectAccess(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	doc, err := h.projectAccess(ctx, project)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing project access", "error", err)
+		h.jsonError(w, "Failed to list project access", http.StatusInternalServerError)
+		return
+	}
+	h.writeResource(w, http.StatusOK, doc)
+}
+
+// handleAPIPutProjectAccess replaces the manual grants and group mappings
+// of a project with those of the request, granting, changing and revoking
+// as needed. The request is validated as a whole before anything changes.
+func (h *Handler) handleAPIPutProjectAccess(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	caller := auth.UserFromContext(ctx)
+	project, err := h.projects.GetBySlug(ctx, r.PathValue("slug"))
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Users         []projectAccessEntry `json:"users"`
+		GroupMappings []groupMappingEntry  `json:"group_mappings"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := h.projectAccess(ctx, project)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing project access", "error", err)
+		h.jsonError(w, "Failed to list project access", http.StatusInternalServerError)
+		return
+	}
+	if !h.checkPreconditions(w, r, resourceETag(doc)) {
+		return
+	}
+
+	wantUsers := make(map[int64]string)
+	usernames := make(map[int64]string)
+	for _, e := range req.Users {
+		if !isGrantableRole(e.Role) {
+			h.jsonError(w, "Invalid role for "+e.Username+": must be viewer or editor", http.StatusBadRequest)
+			return
+		}
+		user, err := h.users.GetByUsername(ctx, e.Username)
+		if err != nil {
+			h.jsonError(w, "User not found: "+e.Username, http.StatusBadRequest)
+			return
+		}
+		wantUsers[user.ID] = e.Role
+		usernames[user.ID] = user.Username
+	}
+
+	type mappingKey struct{ source, group string }
+	wantMappings := make(map[mappingKey]string)
+	for _, e := range req.GroupMappings {
+		if !isGroupMappingSource(e.AuthSource) || e.GroupIdentifier == "" {
+			h.jsonError(w, "Invalid group mapping: auth_source must be ldap, oauth2, proxy or scim and group_identifier is required", http.StatusBadRequest)
+			return
+		}
+		if !isGrantableRole(e.Role) {
+			h.jsonError(w, "Invalid role for group "+e.GroupIdentifier+": must be viewer or editor", http.StatusBadRequest)
+			return
+		}
+		wantMappings[mappingKey{e.AuthSource, e.GroupIdentifier}] = e.Role
+	}
+	mappings, err := h.groupMappings.List(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing group mappings", "error", err)
+		h.jsonError(w, "Failed to list group mappings", http.StatusInternalServerError)
+		return
+	}
+	for _, m := range mappings {
+		key := mappingKey{m.AuthSource, m.GroupIdentifier}
+		if m.ProjectID != project.ID || !m.FromConfig {
+			continue
+		}
+		if role, ok := wantMappings[key]; ok && role != m.Role {
+			h.jsonError(w, "Group mapping "+m.GroupIdentifier+" is defined in the configuration file", http.StatusConflict)
+			return
+		}
+		delete(wantMappings, key)
+	}
+
+	grants, err := h.access.ListByProject(ctx, project.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing project access", "error", err)
+		h.jsonError(w, "Failed to list project access", http.StatusInternalServerError)
+		return
+	}
+	for _, g := range grants {
+		if g.Source != "manual" {
+			continue
+		}
+		role, ok := wantUsers[g.UserID]
+		switch {
+		case !ok:
+			if err := h.access.RevokeBySource(ctx, project.ID, g.UserID, "manual"); err != nil {
+				h.logger.ErrorContext(ctx, "revoking access via API", "error", err)
+				h.jsonError(w, "Failed to revoke access", http.StatusInternalServerError)
+				return
+			}
+			h.emitAccessEvent(ctx, database.EventAccessRevoked, project, caller, g.UserID, "")
+		case role == g.Role:
+			delete(wantUsers, g.UserID)
+		}
+	}
+	for userID, role := range wantUsers {
+		access := &database.ProjectAccess{ProjectID: project.ID, UserID: userID, Role: role, Source: "manual"}
+		if err := h.access.Grant(ctx, access); err != nil {
+			h.logger.ErrorContext(ctx, "granting access via API", "error", err, "username", usernames[userID])
+			h.jsonError(w, "Failed to grant access", http.StatusInternalServerError)
+			return
+		}
+		h.emitAccessEvent(ctx, database.EventAccessGranted, project, caller, userID, role)
+	}
+
+	for i := range mappings {
+		m := &mappings[i]
+		if m.ProjectID != project.ID || m.FromConfig {
+			continue
+		}
+		key := mappingKey{m.AuthSource, m.GroupIdentifier}
+		role, ok := wantMappings[key]
+		delete(wantMappings, key)
+		switch {
+		case !ok:
+			err = h.groupMappings.Delete(ctx, m.ID)
+		case role != m.Role:
+			m.Role = role
+			err = h.groupMappings.Update(ctx, m)
+		}
+		if err != nil {
+			h.logger.ErrorContext(ctx, "updating group mappings via API", "error", err)
+			h.jsonError(w, "Failed to update group mappings", http.StatusInternalServerError)
+			return
+		}
+	}
+	for key, role := range wantMappings {
+		m := &database.AuthGroupMapping{AuthSource: key.source, GroupIdentifier: key.group, ProjectID: project.ID, Role: role}
+		if err := h.groupMappings.Create(ctx, m); err != nil {
+			h.logger.ErrorContext(ctx, "creating group mapping via API", "error", err)
+			h.jsonError(w, "Failed to create group mapping", http.StatusInternalServerError)
+			return
+		}
+	}
+	h.syncSCIMMembers(ctx)
+
+	if doc, err = h.projectAccess(ctx, project); err != nil {
+		h.logger.ErrorContext(ctx, "listing project access", "error", err)
+		h.jsonError(w, "Failed to list project access", http.StatusInternalServerError)
+		return
+	}
+	h.writeResource(w, http.StatusOK, doc)
+}
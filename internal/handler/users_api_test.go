@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestAPIPutUser(t *testing.T) {
+	app := setupTestApp(t)
+	token := adminAPIToken(t, app)
+	body := `{"email": "alice@example.com", "role": "editor", "password": "secret123"}`
+
+	resp := apiRequest(t, app, "PUT", "/api/admin/users/alice", token, body, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 on create, got %d", resp.StatusCode)
+	}
+	user, err := app.handler.users.GetByUsername(context.Background(), "alice")
+	if err != nil || user.Role != "editor" || user.AuthSource != "builtin" {
+		t.Fatalf("expected a builtin editor, got %+v (%v)", user, err)
+	}
+	if len(loginUser(t, app, "alice", "secret123")) == 0 {
+		t.Error("expected alice to log in with the password")
+	}
+
+	resp = apiRequest(t, app, "PUT", "/api/admin/users/alice", token, `{"email": "alice@example.com", "role": "viewer"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 on update, got %d", resp.StatusCode)
+	}
+	etag := resp.Header.Get("ETag")
+	resp = apiRequest(t, app, "PUT", "/api/admin/users/alice", token, `{"role": "viewer", "robot": true}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 when turning a user into a robot, got %d", resp.StatusCode)
+	}
+	resp = apiRequest(t, app, "PUT", "/api/admin/users/bob", token, `{"role": "viewer"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a new user without password, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "GET", "/api/admin/users", token, "", nil)
+	var users []userResource
+	json.NewDecoder(resp.Body).Decode(&users)
+	resp.Body.Close()
+	if len(users) != 2 {
+		t.Errorf("expected alice and the terraform robot, got %+v", users)
+	}
+
+	for range 2 {
+		resp = apiRequest(t, app, "DELETE", "/api/admin/users/alice", token, "", map[string]string{"If-Match": etag})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("expected 204, got %d", resp.StatusCode)
+		}
+		etag = ""
+	}
+	resp = apiRequest(t, app, "DELETE", "/api/admin/users/terraform", token, "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 when deleting the caller, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPICreateRobotToken(t *testing.T) {
+	app := setupTestApp(t)
+	token := adminAPIToken(t, app)
+	seedProject(t, app, "handbook", "Handbook", false)
+
+	resp := apiRequest(t, app, "PUT", "/api/admin/users/ci", token, `{"role": "editor", "robot": true}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 on create, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "POST", "/api/admin/users/ci/tokens", token, `{"name": "deploy", "project": "handbook", "scopes": ["upload", "read"]}`, nil)
+	var result struct {
+		Token  string `json:"token"`
+		Scopes string `json:"scopes"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || result.Token == "" || result.Scopes != "upload,read" {
+		t.Fatalf("expected a new token, got %d %+v", resp.StatusCode, result)
+	}
+	resp = apiRequest(t, app, "PUT", "/api/admin/projects/handbook/access", token, `{"users": [{"username": "ci", "role": "editor"}]}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 granting access, got %d", resp.StatusCode)
+	}
+	resp = apiRequest(t, app, "GET", "/api/project/handbook/versions", result.Token, "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the token to read the project, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "POST", "/api/admin/users/terraform/tokens", uploadTokenForProject(t, app, "uploads"), `{}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 without an admin token, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIPutProjectAccess(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := adminAPIToken(t, app)
+	project := seedProject(t, app, "handbook", "Handbook", false)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if err := app.handler.users.Create(ctx, &database.User{Username: name, AuthSource: "builtin", Role: "viewer"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	carol, _ := app.handler.users.GetByUsername(ctx, "carol")
+	app.handler.access.Grant(ctx, &database.ProjectAccess{ProjectID: project.ID, UserID: carol.ID, Role: "viewer", Source: "ldap"})
+	app.handler.groupMappings.Create(ctx, &database.AuthGroupMapping{AuthSource: "ldap", GroupIdentifier: "cn=old", ProjectID: project.ID, Role: "viewer"})
+
+	put := func(body string) (projectAccessDocument, int) {
+		resp := apiRequest(t, app, "PUT", "/api/admin/projects/handbook/access", token, body, nil)
+		defer resp.Body.Close()
+		var doc projectAccessDocument
+		json.NewDecoder(resp.Body).Decode(&doc)
+		return doc, resp.StatusCode
+	}
+
+	doc, code := put(`{
+		"users": [{"username": "alice", "role": "editor"}, {"username": "bob", "role": "viewer"}],
+		"group_mappings": [{"auth_source": "oauth2", "group_identifier": "docs", "role": "viewer"}]
+	}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	wantUsers := []projectAccessEntry{
+		{Username: "alice", Role: "editor", Source: "manual"},
+		{Username: "bob", Role: "viewer", Source: "manual"},
+		{Username: "carol", Role: "viewer", Source: "ldap"},
+	}
+	if len(doc.Users) != len(wantUsers) {
+		t.Fatalf("expected %+v, got %+v", wantUsers, doc.Users)
+	}
+	for i := range wantUsers {
+		if doc.Users[i] != wantUsers[i] {
+			t.Errorf("user %d: expected %+v, got %+v", i, wantUsers[i], doc.Users[i])
+		}
+	}
+	if len(doc.GroupMappings) != 1 || doc.GroupMappings[0].GroupIdentifier != "docs" {
+		t.Errorf("expected only the docs group mapping, got %+v", doc.GroupMappings)
+	}
+
+	doc, _ = put(`{"users": [{"username": "bob", "role": "editor"}]}`)
+	if len(doc.Users) != 2 || doc.Users[0] != (projectAccessEntry{Username: "bob", Role: "editor", Source: "manual"}) || len(doc.GroupMappings) != 0 {
+		t.Errorf("expected alice and the group mapping to be revoked, got %+v", doc)
+	}
+
+	if _, code := put(`{"users": [{"username": "nobody", "role": "viewer"}]}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown user, got %d", code)
+	}
+	if _, code := put(`{"users": [{"username": "bob", "role": "admin"}]}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an ungrantable role, got %d", code)
+	}
+	if access, _ := app.handler.access.GetAccessBySource(ctx, project.ID, carol.ID, "ldap"); access == nil {
+		t.Error("expected the synced grant to be kept")
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
-	"strings"
+	"time"
 
 	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
 	"github.com/qwc/asiakirjat/internal/docs"
+	"github.com/qwc/asiakirjat/internal/hooks"
 	"github.com/qwc/asiakirjat/internal/templates"
 )
 
@@ -36,11 +38,57 @@ func (h *Handler) handleServeDoc(w http.ResponseWriter, r *http.Request) {
 
 	ver, err := h.versions.GetByProjectAndTag(ctx, project.ID, version)
 	if err != nil {
+		if h.redirectRenamedVersion(w, r, project, version, "/project/"+slug+"/", "/"+escapePath(filePath)) {
+			return
+		}
 		http.Error(w, "Version not found", http.StatusNotFound)
 		return
 	}
 
+	if filePath == "" && h.redirectToLandingPage(w, r, project, ver) {
+		return
+	}
+
+	if h.hooks.Has(hooks.PreServe) && !h.checkServe(w, r, user, hooks.Event{Project: slug, Version: ver.Tag, Path: filePath}) {
+		return
+	}
+
 	storagePath := h.storage.VersionPath(slug, ver.Tag)
+	if h.redirectMovedPage(w, r, project, ver, storagePath, filePath) {
+		return
+	}
+	if h.analyticsEnabled() {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		w = sw
+		page := filePath != "document.pdf"
+		if ver.ContentType != "pdf" {
+			page, _ = overlayInjection(project, filePath)
+			page = page || docs.IsMarkdown(filePath)
+		}
+		defer func() { h.recordPageHit(r, user, project, ver, filePath, page, sw.status) }()
+	}
+	canonicalHead := h.markStaleVersion(w, r, project, ver.Tag, filePath)
+	if project.Visibility == database.VisibilityUnlisted {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+	overlayData := templates.OverlayData{
+		Slug:        slug,
+		ProjectName: project.Name,
+		Version:     ver.Tag,
+		Offline:     h.config.Offline.Enabled,
+	}
+	if m := projectMaintainer(project); m != nil {
+		overlayData.MaintainedBy = m.Name
+		overlayData.ContactURL = m.ContactURL
+	}
+	if project.FeedbackMode != database.FeedbackOff {
+		overlayData.FeedbackMode = project.FeedbackMode
+		overlayData.FeedbackURL = project.FeedbackURL
+	}
+	if banner := h.lifecycleBanner(project, ver); banner != nil {
+		overlayData.Lifecycle = banner.State
+		overlayData.LifecycleMessage = banner.Message
+	}
 
 	// PDF version handling
 	if ver.ContentType == "pdf" {
@@ -50,46 +98,73 @@ func (h *Handler) handleServeDoc(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		// Render PDF viewer wrapper page
-		h.servePDFViewer(w, r, slug, project.Name, ver.Tag, storagePath)
+		h.recordPageView(r, user, project, ver, "")
+		h.servePDFViewer(w, r, project, overlayData, storagePath)
+		return
+	}
+
+	if h.serveIndexFallback(w, r, user, project, ver, storagePath, filePath) {
+		return
+	}
+	// The project search and link previews go into pages only, not into
+	// the assets they load
+	headHTML := canonicalHead
+	if inject, _ := overlayInjection(project, filePath); inject || docs.IsMarkdown(filePath) {
+		headHTML = h.projectSearchLink(project.Slug, project.Name) + h.socialMeta(r, project, socialPreview{
+			SiteName:    project.Name,
+			Description: project.Description,
+			URL:         h.publicURL(r) + "/project/" + project.Slug + "/" + escapePath(ver.Tag) + "/" + escapePath(filePath),
+			Tag:         ver.Tag,
+		}) + canonicalHead
+	}
+	if h.serveMarkdown(w, r, project, ver, storagePath, filePath, headHTML, overlayData) {
+		h.recordPageView(r, user, project, ver, filePath)
 		return
 	}
 
 	// For paths that might be HTML, inject the overlay toolbar
-	maybeHTML := filePath == "" ||
-		strings.HasSuffix(filePath, "/") ||
-		strings.HasSuffix(filePath, ".html") ||
-		strings.HasSuffix(filePath, ".htm") ||
-		!strings.Contains(filePath, ".")
-
-	if maybeHTML {
-		overlayHTML, err := h.templates.RenderOverlay(templates.OverlayData{
-			Slug:        slug,
-			ProjectName: project.Name,
-			Version:     ver.Tag,
-		})
+	if inject, sniff := overlayInjection(project, filePath); inject {
+		h.recordPageView(r, user, project, ver, filePath)
+		overlayHTML, err := h.renderOverlay(ctx, project, storagePath, overlayData)
 		if err != nil {
-			h.logger.Error("rendering overlay", "error", err)
-			docs.ServeDoc(w, r, storagePath, filePath)
+			h.logger.ErrorContext(ctx, "rendering overlay", "error", err)
+			docs.ServeDocWithOptions(w, r, storagePath, filePath, h.docServeOptions(project, ""))
 			return
 		}
 
-		docs.InjectOverlay(w, r, overlayHTML, func(rw http.ResponseWriter, req *http.Request) {
-			docs.ServeDoc(rw, req, storagePath, filePath)
+		opts := h.docServeOptions(project, headHTML+overlayHTML)
+		docs.InjectOverlayWithOptions(w, r, docs.OverlayOptions{
+			HeadHTML:    headHTML,
+			OverlayHTML: overlayHTML,
+			MaxSize:     h.config.Overlay.MaxSizeBytes(),
+			Sniff:       sniff,
+		}, func(rw http.ResponseWriter, req *http.Request) {
+			docs.ServeDocWithOptions(rw, req, storagePath, filePath, opts)
 		})
 		return
 	}
 
-	docs.ServeDoc(w, r, storagePath, filePath)
+	docs.ServeDocWithOptions(w, r, storagePath, filePath, h.docServeOptions(project, ""))
 }
 
-func (h *Handler) servePDFViewer(w http.ResponseWriter, r *http.Request, slug, projectName, version, storagePath string) {
-	overlayHTML, err := h.templates.RenderOverlay(templates.OverlayData{
-		Slug:        slug,
-		ProjectName: projectName,
-		Version:     version,
-	})
+// docServeOptions returns the caching options for files of a project.
+// variant is the HTML injected into pages, if any.
+func (h *Handler) docServeOptions(project *database.Project, variant string) docs.ServeOptions {
+	return docs.ServeOptions{
+		Variant: variant,
+		Policy: &docs.CachePolicy{
+			Private:     project.Visibility != database.VisibilityPublic,
+			HTMLMaxAge:  time.Duration(h.config.Cache.HTMLMaxAge) * time.Second,
+			AssetMaxAge: time.Duration(h.config.Cache.AssetMaxAge) * time.Second,
+		},
+		Cache: h.fileCache,
+	}
+}
+
+func (h *Handler) servePDFViewer(w http.ResponseWriter, r *http.Request, project *database.Project, overlayData templates.OverlayData, storagePath string) {
+	overlayHTML, err := h.renderOverlay(r.Context(), project, storagePath, overlayData)
 	if err != nil {
-		h.logger.Error("rendering overlay for PDF viewer", "error", err)
+		h.logger.ErrorContext(r.Context(), "rendering overlay for PDF viewer", "error", err)
 		// Fall back to serving the raw PDF
 		http.ServeFile(w, r, filepath.Join(storagePath, "document.pdf"))
 		return
@@ -127,14 +202,16 @@ hint.style.display='flex';
 hint.querySelector('button').addEventListener('click',function(){hint.style.display='none';fit();});
 }
 
+// The toolbar is at the top or bottom, or collapsed and floating
 function fit(){
-var h=o?o.offsetHeight:0;
-if(hint.style.display!=='none')h+=hint.offsetHeight;
-if(hint.style.display!=='none')hint.style.top=(o?o.offsetHeight:0)+'px';
-e.style.top=h+'px';e.style.height='calc(100vh - '+h+'px)';
+var oh=o&&!o.classList.contains('ao-collapsed')?o.offsetHeight:0;
+var bottom=o&&o.classList.contains('ao-bottom');
+var h=bottom?0:oh;
+if(hint.style.display!=='none'){hint.style.top=h+'px';h+=hint.offsetHeight;}
+e.style.top=h+'px';e.style.height='calc(100vh - '+(h+(bottom?oh:0))+'px)';
 }
 fit();window.addEventListener('resize',fit);
 })();
 </script>
-</body></html>`, projectName, version, overlayHTML)
+</body></html>`, overlayData.ProjectName, overlayData.Version, overlayHTML)
 }
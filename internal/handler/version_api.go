@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+)
+
+// versionDetailJSON is a version as returned by GET
+// /api/project/{slug}/version/{tag}.
+type versionDetailJSON struct {
+	Tag         string `json:"tag"`
+	ContentType string `json:"content_type"`
+	CreatedAt   string `json:"created_at"`
+	UploadedBy  string `json:"uploaded_by"`
+
+	Size      int64  `json:"size"`
+	FileCount int    `json:"file_count"`
+	SHA256    string `json:"sha256"`
+
+	SignatureStatus string `json:"signature_status"`
+	SignatureKey    string `json:"signature_key,omitempty"`
+	Protected       bool   `json:"protected"`
+
+	Lifecycle        string `json:"lifecycle"`
+	LifecycleMessage string `json:"lifecycle_message,omitempty"`
+	LandingPath      string `json:"landing_path,omitempty"`
+
+	ReleaseNotes string            `json:"release_notes,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Attachments  []attachmentJSON  `json:"attachments,omitempty"`
+}
+
+// handleAPIGetVersion describes a version: who uploaded it when, the size
+// and number of its files, and a checksum of them to verify a download
+// or copy against.
+func (h *Handler) handleAPIGetVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canViewProject(ctx, auth.UserFromContext(ctx), project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, r.PathValue("tag"))
+	if err != nil || !h.storage.VersionExists(slug, version.Tag) {
+		h.jsonError(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	manifest, err := h.versionManifest(ctx, slug, version.Tag)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.ErrorContext(ctx, "reading version files", "error", err, "project", slug, "version", version.Tag)
+		h.jsonError(w, "Failed to read version files", http.StatusInternalServerError)
+		return
+	}
+	metadata, err := h.metadata.GetVersion(ctx, version.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "loading version metadata", "error", err)
+		h.jsonError(w, "Failed to load metadata", http.StatusInternalServerError)
+		return
+	}
+
+	result := versionDetailJSON{
+		Tag:         version.Tag,
+		ContentType: version.ContentType,
+		CreatedAt:   version.CreatedAt.Format("2006-01-02T15:04:05Z"),
+
+		Size:      manifest.Size(),
+		FileCount: len(manifest),
+		SHA256:    manifest.Digest(),
+
+		SignatureStatus: version.SignatureStatus,
+		SignatureKey:    version.SignatureKey,
+		Protected:       version.Protected,
+
+		Lifecycle:        version.Lifecycle,
+		LifecycleMessage: version.LifecycleMessage,
+		LandingPath:      version.LandingPath,
+
+		ReleaseNotes: version.ReleaseNotes,
+	}
+	if len(metadata) > 0 {
+		result.Metadata = metadata
+	}
+	if uploader, err := h.users.GetByID(ctx, version.UploadedBy); err == nil {
+		result.UploadedBy = uploader.Username
+	}
+	bp := h.config.Server.BasePath
+	for _, a := range h.versionAttachments(ctx, project.ID)[version.ID] {
+		result.Attachments = append(result.Attachments, attachmentJSON{
+			Kind:     a.Kind,
+			Filename: a.Filename,
+			Size:     a.Size,
+			SHA256:   a.SHA256,
+			URL:      bp + "/api/project/" + slug + "/version/" + version.Tag + "/attachments/" + a.Kind,
+		})
+	}
+	h.jsonResponse(w, result)
+}
+
+// handleAPIDeleteVersion deletes a version with the permission checks of
+// the web form: the token's user must be an editor of the project, and
+// protected versions are refused.
+func (h *Handler) handleAPIDeleteVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		h.jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	user := h.authenticateToken(w, r, project.ID, auth.ScopeDelete)
+	if user == nil {
+		return
+	}
+	if !h.canDeleteVersions(ctx, user, project) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	version, err := h.versions.GetByProjectAndTag(ctx, project.ID, r.PathValue("tag"))
+	if err != nil {
+		h.jsonError(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	if version.Protected {
+		h.jsonError(w, "Version is protected; unprotect it first", http.StatusConflict)
+		return
+	}
+
+	if err := h.deleteVersion(ctx, project, version, user); err != nil {
+		h.logger.ErrorContext(ctx, "deleting version via API", "error", err)
+		h.jsonError(w, "Failed to delete version", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestAPIVersion(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", false)
+	seedSEOVersion(t, app, project, admin, "1.0.0")
+	seedSEOVersion(t, app, project, admin, "2.0.0")
+	released, _ := app.handler.versions.GetByProjectAndTag(ctx, project.ID, "2.0.0")
+	app.handler.versions.SetProtected(ctx, released.ID, true)
+
+	robot := &database.User{Username: "cleanup-bot", AuthSource: "robot", Role: "viewer", IsRobot: true}
+	app.handler.users.Create(ctx, robot)
+	app.handler.access.Grant(ctx, &database.ProjectAccess{ProjectID: project.ID, UserID: robot.ID, Role: "editor"})
+	token := func(scopes string) string {
+		raw, _ := auth.GenerateToken(32)
+		app.handler.tokens.Create(ctx, &database.APIToken{UserID: robot.ID, TokenHash: auth.HashToken(raw), Name: scopes, Scopes: scopes})
+		return raw
+	}
+	deleteToken, readToken := token("delete,read"), token("read")
+
+	resp := apiRequest(t, app, "GET", "/api/project/guide/version/1.0.0", readToken, "", nil)
+	var version versionDetailJSON
+	json.NewDecoder(resp.Body).Decode(&version)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if version.FileCount != 3 || version.Size != 78 || len(version.SHA256) != 64 || version.UploadedBy != "admin" {
+		t.Errorf("unexpected version %+v", version)
+	}
+
+	for _, path := range []string{"/api/project/guide/version/1.0.0", "/api/project/guide/versions"} {
+		resp := apiRequest(t, app, "GET", path, "", "", nil)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Errorf("%s: expected a private project to be hidden from anonymous users", path)
+		}
+	}
+
+	for _, tc := range []struct {
+		tag, token string
+		want       int
+	}{
+		{"1.0.0", readToken, http.StatusForbidden},
+		{"2.0.0", deleteToken, http.StatusConflict},
+		{"1.0.0", deleteToken, http.StatusNoContent},
+		{"1.0.0", deleteToken, http.StatusNotFound},
+	} {
+		resp := apiRequest(t, app, "DELETE", "/api/project/guide/version/"+tc.tag, tc.token, "", nil)
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("DELETE %s: expected %d, got %d", tc.tag, tc.want, resp.StatusCode)
+		}
+	}
+	if app.handler.storage.VersionExists("guide", "1.0.0") {
+		t.Error("expected the files of the version to be deleted")
+	}
+}
+
+func TestAPIVersionManifest(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "guide")
+	resp := postArchive(t, app, "guide", token, "1.0.0", createTestZip(t, map[string]string{
+		"site/index.html":    "<html>home</html>",
+		"site/css/style.css": "body {}",
+	}))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected upload to succeed, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, app, "GET", "/api/project/guide/version/1.0.0/manifest", token, "", nil)
+	var manifest struct {
+		SHA256 string `json:"sha256"`
+		Size   int64  `json:"size"`
+		Files  []struct {
+			Path   string `json:"path"`
+			SHA256 string `json:"sha256"`
+		} `json:"files"`
+	}
+	json.NewDecoder(resp.Body).Decode(&manifest)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if len(manifest.Files) != 2 || manifest.Files[0].Path != "css/style.css" || manifest.Size != 24 {
+		t.Errorf("expected the two extracted files, got %+v", manifest)
+	}
+
+	resp = apiRequest(t, app, "GET", "/api/project/guide/version/1.0.0", token, "", nil)
+	var version versionDetailJSON
+	json.NewDecoder(resp.Body).Decode(&version)
+	resp.Body.Close()
+	if version.SHA256 != manifest.SHA256 || version.FileCount != 2 {
+		t.Errorf("expected the version checksum to match the manifest, got %+v", version)
+	}
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/docs"
+)
+
+// latestTagsCacheTTL is how long the latest version tags cache is valid.
+const latestTagsCacheTTL = 30 * time.Second
+
+// versionCache caches the sorted version lists of projects and the latest
+// version tag of every project. A project's list is loaded on first use
+// and dropped when one of its versions is uploaded, changed or deleted.
+type versionCache struct {
+	mu             sync.Mutex
+	gen            uint64           // incremented by every invalidation
+	projectGens    map[int64]uint64 // incremented when a project's versions change
+	resets         uint64           // incremented when all projects' versions change
+	lists          map[int64][]database.Version
+	latestTags     map[string]string
+	latestTagsTime time.Time
+}
+
+// versionsGeneration returns a string that changes whenever the versions of
+// a project, or anything shown with them, change. It keys rendered version
+// lists.
+func (h *Handler) versionsGeneration(projectID int64) string {
+	c := &h.versionCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Sprintf("%d.%d", c.resets, c.projectGens[projectID])
+}
+
+// sortedVersions returns the versions of a project, newest first in the
+// order of docs.SortVersionTags.
+func (h *Handler) sortedVersions(ctx context.Context, projectID int64) ([]database.Version, error) {
+	c := &h.versionCache
+	c.mu.Lock()
+	if list, ok := c.lists[projectID]; ok {
+		c.mu.Unlock()
+		return slices.Clone(list), nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	versions, err := h.versions.ListByProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	sortVersions(versions)
+
+	// Don't store a list that was read before an invalidation.
+	c.mu.Lock()
+	if c.gen == gen {
+		if c.lists == nil {
+			c.lists = make(map[int64][]database.Version)
+		}
+		c.lists[projectID] = versions
+	}
+	c.mu.Unlock()
+	return slices.Clone(versions), nil
+}
+
+// sortVersions sorts versions newest first by their tags.
+func sortVersions(versions []database.Version) {
+	tags := make([]string, len(versions))
+	byTag := make(map[string]database.Version, len(versions))
+	for i, v := range versions {
+		tags[i] = v.Tag
+		byTag[v.Tag] = v
+	}
+	docs.SortVersionTags(tags)
+	for i, tag := range tags {
+		versions[i] = byTag[tag]
+	}
+}
+
+// getLatestVersionTags returns a map of projectSlug -> latest version tag.
+// Results are cached to avoid per-query DB lookups.
+func (h *Handler) getLatestVersionTags(ctx context.Context) map[string]string {
+	c := &h.versionCache
+	c.mu.Lock()
+	if c.latestTags != nil && time.Since(c.latestTagsTime) < latestTagsCacheTTL {
+		tags := c.latestTags
+		c.mu.Unlock()
+		return tags
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	result := make(map[string]string)
+
+	projects, err := h.projects.List(ctx)
+	if err != nil {
+		return result
+	}
+
+	for _, p := range projects {
+		versions, err := h.sortedVersions(ctx, p.ID)
+		if err != nil || len(versions) == 0 {
+			continue
+		}
+		result[p.Slug] = latestVersionTag(versions, p.PinnedVersion)
+	}
+
+	c.mu.Lock()
+	if c.gen == gen {
+		c.latestTags = result
+		c.latestTagsTime = time.Now()
+	}
+	c.mu.Unlock()
+
+	return result
+}
+
+// WarmCaches loads the version lists and latest version tags of all
+// projects, so that the first requests after a start are not slower than
+// the rest.
+func (h *Handler) WarmCaches(ctx context.Context) {
+	start := time.Now()
+	tags := h.getLatestVersionTags(ctx)
+	h.logger.InfoContext(ctx, "version caches warmed", "projects", len(tags), "duration", time.Since(start))
+}
+
+// invalidateVersions drops the cached versions of a project after one of
+// them was uploaded, changed or deleted, or its labels, attachments,
+// accessibility or link report changed.
+func (h *Handler) invalidateVersions(projectID int64) {
+	c := &h.versionCache
+	c.mu.Lock()
+	c.gen++
+	if c.projectGens == nil {
+		c.projectGens = make(map[int64]uint64)
+	}
+	c.projectGens[projectID]++
+	delete(c.lists, projectID)
+	c.latestTags = nil
+	c.mu.Unlock()
+	h.versionRedirects.Clear()
+}
+
+// invalidateAllVersions drops the cached versions of all projects.
+func (h *Handler) invalidateAllVersions() {
+	c := &h.versionCache
+	c.mu.Lock()
+	c.gen++
+	c.resets++
+	c.lists = nil
+	c.latestTags = nil
+	c.mu.Unlock()
+	h.versionRedirects.Clear()
+}
+
+// invalidateLatestTagsCache clears the cached latest version tags, e.g.
+// after a version was pinned.
+func (h *Handler) invalidateLatestTagsCache() {
+	c := &h.versionCache
+	c.mu.Lock()
+	c.gen++
+	c.latestTags = nil
+	c.mu.Unlock()
+}
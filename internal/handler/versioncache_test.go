@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestVersionCache(t *testing.T) {
+	app := setupTestApp(t)
+	admin := seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	seedSEOVersion(t, app, project, admin, "1.2.0")
+	seedSEOVersion(t, app, project, admin, "1.10.0")
+	ctx := context.Background()
+
+	app.handler.WarmCaches(ctx)
+	if tag := app.handler.versionCache.latestTags["guide"]; tag != "1.10.0" {
+		t.Fatalf("expected warmed latest tag 1.10.0, got %q", tag)
+	}
+
+	versions, err := app.handler.sortedVersions(ctx, project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Tag != "1.10.0" || versions[1].Tag != "1.2.0" {
+		t.Fatalf("expected versions sorted newest first, got %+v", versions)
+	}
+
+	// Writes that bypass the handler are not seen until invalidation.
+	if err := app.handler.versions.Create(ctx, &database.Version{ProjectID: project.ID, Tag: "2.0.0", StoragePath: t.TempDir(), UploadedBy: admin.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := app.handler.sortedVersions(ctx, project.ID); len(versions) != 2 {
+		t.Errorf("expected the cached list, got %d versions", len(versions))
+	}
+	app.handler.invalidateVersions(project.ID)
+	versions, _ = app.handler.sortedVersions(ctx, project.ID)
+	if len(versions) != 3 || versions[0].Tag != "2.0.0" {
+		t.Errorf("expected 2.0.0 first after invalidation, got %+v", versions)
+	}
+	if tag := app.handler.getLatestVersionTags(ctx)["guide"]; tag != "2.0.0" {
+		t.Errorf("expected latest tag 2.0.0 after invalidation, got %q", tag)
+	}
+
+	// Changing a version through the handler invalidates the list.
+	cookies := loginUser(t, app, "admin", "admin123")
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	req, _ := http.NewRequest("POST", app.server.URL+"/project/guide/version/2.0.0/protect", strings.NewReader("protected=true"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	versions, _ = app.handler.sortedVersions(ctx, project.ID)
+	if !versions[0].Protected {
+		t.Error("expected the protection change to be visible")
+	}
+}
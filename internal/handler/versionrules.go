@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+const (
+	maxVersionTagLen     = 128
+	maxVersionPatternLen = 255
+)
+
+// strictSemverRegex matches MAJOR.MINOR.PATCH with optional pre-release and
+// build parts and an optional "v" prefix.
+var strictSemverRegex = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// validateVersionPattern checks a project's version tag pattern.
+func validateVersionPattern(pattern string) error {
+	if len(pattern) > maxVersionPatternLen {
+		return fmt.Errorf("version pattern is longer than %d characters", maxVersionPatternLen)
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return fmt.Errorf("invalid version pattern: %w", err)
+	}
+	return nil
+}
+
+// normalizeVersionTag applies the version rules of a project to an
+// uploaded tag. It returns the tag to store, or an error naming the rule
+// the tag breaks. Tags that would leave the project directory are always
+// rejected.
+func normalizeVersionTag(project *database.Project, tag string) (string, error) {
+	tag = strings.TrimSpace(tag)
+	if project.NormalizeVersions {
+		tag = strings.ToLower(tag)
+		if rest, ok := strings.CutPrefix(tag, "v"); ok && rest != "" && rest[0] >= '0' && rest[0] <= '9' {
+			tag = rest
+		}
+	}
+
+	if tag == "" {
+		return "", fmt.Errorf("version tag is required")
+	}
+	if len(tag) > maxVersionTagLen || strings.HasPrefix(tag, ".") || strings.ContainsAny(tag, `/\`) ||
+		strings.ContainsFunc(tag, unicode.IsControl) {
+		return "", fmt.Errorf("invalid version tag %q: use at most %d characters, no slashes, not starting with a dot", tag, maxVersionTagLen)
+	}
+	if tag == "preview" {
+		return "", fmt.Errorf("version tag %q is reserved: previews are served below it", tag)
+	}
+	if project.VersionSemverOnly && !strictSemverRegex.MatchString(tag) {
+		return "", fmt.Errorf("version tag %q is not a semantic version such as 1.2.3", tag)
+	}
+	if project.VersionPattern != "" {
+		re, err := regexp.Compile(`^(?:` + project.VersionPattern + `)$`)
+		if err != nil || !re.MatchString(tag) {
+			return "", fmt.Errorf("version tag %q does not match the pattern %s", tag, project.VersionPattern)
+		}
+	}
+	return tag, nil
+}
+
+// checkOverwrite refuses the upload of a tag that already exists in a
+// project with immutable versions. Admins may force the overwrite, which
+// is audited.
+func (h *Handler) checkOverwrite(ctx context.Context, project *database.Project, tag string, user *database.User, force bool) error {
+	if !project.ImmutableVersions {
+		return nil
+	}
+	if _, err := h.versions.GetByProjectAndTag(ctx, project.ID, tag); err != nil {
+		return nil
+	}
+	if !force || user.Role != "admin" {
+		return fmt.Errorf("version %s already exists and versions of this project are immutable", tag)
+	}
+	h.audit(ctx, "version.overwrite", user.Username, project.Slug+": "+tag)
+	return nil
+}
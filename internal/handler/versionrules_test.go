@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+func TestNormalizeVersionTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		project database.Project
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{"any tag", database.Project{}, "Nightly", "Nightly", false},
+		{"path traversal", database.Project{}, "../other", "", true},
+		{"hidden directory", database.Project{}, ".git", "", true},
+		{"reserved for previews", database.Project{}, "preview", "", true},
+		{"normalized", database.Project{NormalizeVersions: true}, "V1.0", "1.0", false},
+		{"normalization keeps words", database.Project{NormalizeVersions: true}, "Vnext", "vnext", false},
+		{"semver", database.Project{VersionSemverOnly: true}, "v1.2.3-rc.1", "v1.2.3-rc.1", false},
+		{"not semver", database.Project{VersionSemverOnly: true}, "1.2", "", true},
+		{"pattern", database.Project{VersionPattern: `\d+\.\d+|latest`}, "latest", "latest", false},
+		{"pattern matches whole tag", database.Project{VersionPattern: `\d+\.\d+`}, "1.2-beta", "", true},
+		{"pattern after normalization", database.Project{VersionPattern: `\d+\.\d+`, NormalizeVersions: true}, "v2.0", "2.0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeVersionTag(&tt.project, tt.tag)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("normalizeVersionTag(%q) = %q, %v; want %q, error %v", tt.tag, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	if err := validateVersionPattern(`(`); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestUploadAppliesVersionRules(t *testing.T) {
+	app := setupTestApp(t)
+	token := uploadTokenForProject(t, app, "rules")
+	project, _ := app.handler.projects.GetBySlug(context.Background(), "rules")
+	project.VersionSemverOnly = true
+	project.NormalizeVersions = true
+	if err := app.handler.projects.Update(context.Background(), project); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(tag string) int {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("version", tag)
+		part, _ := writer.CreateFormFile("archive", "docs.zip")
+		part.Write(createTestZip(t, map[string]string{"index.html": "<html></html>"}).Bytes())
+		writer.Close()
+		req, _ := http.NewRequest("POST", app.server.URL+"/api/project/rules/upload", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := upload("nightly"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non-semver tag, got %d", code)
+	}
+	if code := upload("V1.0.0"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if _, err := app.handler.versions.GetByProjectAndTag(context.Background(), project.ID, "1.0.0"); err != nil {
+		t.Errorf("expected the version stored as 1.0.0: %v", err)
+	}
+}
+
+func TestUploadImmutableVersions(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	token := uploadTokenForProject(t, app, "frozen")
+	project, _ := app.handler.projects.GetBySlug(ctx, "frozen")
+	project.ImmutableVersions = true
+	if err := app.handler.projects.Update(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(query, content string) int {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("version", "1.0.0")
+		part, _ := writer.CreateFormFile("archive", "docs.zip")
+		part.Write(createTestZip(t, map[string]string{"index.html": content}).Bytes())
+		writer.Close()
+		req, _ := http.NewRequest("POST", app.server.URL+"/api/project/frozen/upload"+query, &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	index := func() string {
+		data, _ := os.ReadFile(filepath.Join(app.handler.storage.VersionPath("frozen", "1.0.0"), "index.html"))
+		return string(data)
+	}
+
+	if code := upload("", "first"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := upload("", "second"); code != http.StatusConflict {
+		t.Errorf("expected 409 for a re-upload, got %d", code)
+	}
+	if code := upload("?force=true", "second"); code != http.StatusConflict {
+		t.Errorf("expected 409 when an editor forces, got %d", code)
+	}
+	if got := index(); got != "first" {
+		t.Errorf("expected the released files to be kept, got %q", got)
+	}
+
+	robot, _ := app.handler.users.GetByUsername(ctx, "limits-bot")
+	robot.Role = "admin"
+	app.handler.users.Update(ctx, robot)
+	if code := upload("?force=true", "second"); code != http.StatusOK {
+		t.Fatalf("expected 200 when an admin forces, got %d", code)
+	}
+	if got := index(); got != "second" {
+		t.Errorf("expected the files to be replaced, got %q", got)
+	}
+}
@@ -0,0 +1,345 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// watchChannels are the channels projects can be watched on, in the order
+// the project page offers them.
+var watchChannels = []string{database.WatchEmail, database.WatchDigest, database.WatchWebhook, database.WatchFeed}
+
+const (
+	webhookTimeout   = 10 * time.Second
+	webhookURLMaxLen = 2048
+)
+
+// watchChannelAvailable reports whether projects can be watched on a
+// channel.
+func (h *Handler) watchChannelAvailable(channel string) bool {
+	switch channel {
+	case database.WatchEmail, database.WatchDigest:
+		return h.mailer != nil
+	case database.WatchWebhook:
+		return h.config.Watch.Webhooks
+	case database.WatchFeed:
+		return true
+	}
+	return false
+}
+
+// validateWebhookURL checks that a webhook URL is an absolute HTTP(S) URL.
+// Where it points to is checked when connecting, see webhookClient.
+func validateWebhookURL(raw string) error {
+	if len(raw) > webhookURLMaxLen {
+		return fmt.Errorf("webhook URL is longer than %d characters", webhookURLMaxLen)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q: must be an http or https URL", raw)
+	}
+	return nil
+}
+
+// handleWatchProject sets the channels the user watches a project on. The
+// form lists the chosen channels; none unwatches the project.
+func (h *Handler) handleWatchProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+	slug := r.PathValue("slug")
+
+	project, err := h.projects.GetBySlug(ctx, slug)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if !h.canViewProject(ctx, user, project) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	r.ParseForm()
+	var watchers []database.Watcher
+	for _, channel := range watchChannels {
+		if !slices.Contains(r.Form["channel"], channel) || !h.watchChannelAvailable(channel) {
+			continue
+		}
+		watcher := database.Watcher{Channel: channel}
+		switch channel {
+		case database.WatchEmail, database.WatchDigest:
+			if user.Email == "" {
+				h.redirect(w, r, "/project/"+slug+"?msg=watch_no_email", http.StatusSeeOther)
+				return
+			}
+		case database.WatchWebhook:
+			watcher.Target = strings.TrimSpace(r.FormValue("webhook_url"))
+			if err := validateWebhookURL(watcher.Target); err != nil {
+				h.redirect(w, r, "/project/"+slug+"?msg=watch_webhook_invalid", http.StatusSeeOther)
+				return
+			}
+		}
+		watchers = append(watchers, watcher)
+	}
+
+	if err := h.watchers.Set(ctx, user.ID, project.ID, watchers); err != nil {
+		h.logger.ErrorContext(ctx, "setting watchers", "error", err)
+		http.Error(w, "Failed to save watch settings", http.StatusInternalServerError)
+		return
+	}
+	msg := "watch_saved"
+	if len(watchers) == 0 {
+		msg = "watch_removed"
+	}
+	h.redirect(w, r, "/project/"+slug+"?msg="+msg, http.StatusSeeOther)
+}
+
+// watchSettings are the channels the user watches a project on.
+type watchSettings struct {
+	Email      bool
+	Digest     bool
+	Webhook    bool
+	WebhookURL string
+	Feed       bool
+}
+
+// Any reports whether the project is watched at all.
+func (s watchSettings) Any() bool {
+	return s.Email || s.Digest || s.Webhook || s.Feed
+}
+
+// projectWatch returns how the user watches a project.
+func (h *Handler) projectWatch(ctx context.Context, user *database.User, project *database.Project) watchSettings {
+	var settings watchSettings
+	if user == nil || h.watchers == nil {
+		return settings
+	}
+	watchers, err := h.watchers.ListByUser(ctx, user.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing watchers", "error", err)
+		return settings
+	}
+	for _, wt := range watchers {
+		if wt.ProjectID != project.ID {
+			continue
+		}
+		switch wt.Channel {
+		case database.WatchEmail:
+			settings.Email = true
+		case database.WatchDigest:
+			settings.Digest = true
+		case database.WatchWebhook:
+			settings.Webhook = true
+			settings.WebhookURL = wt.Target
+		case database.WatchFeed:
+			settings.Feed = true
+		}
+	}
+	return settings
+}
+
+// watchedProject is a project the user watches, for the profile page.
+type watchedProject struct {
+	Slug     string
+	Name     string
+	Channels []string
+}
+
+// watchedProjects lists the projects the user watches and can still read.
+func (h *Handler) watchedProjects(ctx context.Context, user *database.User) []watchedProject {
+	if user == nil || h.watchers == nil {
+		return nil
+	}
+	watchers, err := h.watchers.ListByUser(ctx, user.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "listing watched projects", "error", err)
+		return nil
+	}
+	var watched []watchedProject
+	byProject := make(map[int64]int)
+	for _, wt := range watchers {
+		i, ok := byProject[wt.ProjectID]
+		if !ok {
+			project, err := h.projects.GetByID(ctx, wt.ProjectID)
+			if err != nil || !h.canViewProject(ctx, user, project) {
+				continue
+			}
+			i = len(watched)
+			byProject[wt.ProjectID] = i
+			watched = append(watched, watchedProject{Slug: project.Slug, Name: project.Name})
+		}
+		watched[i].Channels = append(watched[i].Channels, wt.Channel)
+	}
+	for _, wp := range watched {
+		slices.SortFunc(wp.Channels, func(a, b string) int {
+			return slices.Index(watchChannels, a) - slices.Index(watchChannels, b)
+		})
+	}
+	slices.SortFunc(watched, func(a, b watchedProject) int { return strings.Compare(a.Name, b.Name) })
+	return watched
+}
+
+// webhookPayload is what webhooks of watchers are posted.
+type webhookPayload struct {
+	Type         string `json:"type"`
+	Project      string `json:"project"`
+	ProjectName  string `json:"project_name"`
+	Version      string `json:"version"`
+	ContentType  string `json:"content_type"`
+	URL          string `json:"url,omitempty"`
+	ReleaseNotes string `json:"release_notes,omitempty"`
+	Actor        string `json:"actor"`
+	PublishedAt  string `json:"published_at"`
+}
+
+// notifyWatchers tells the watchers of a project about a new version in the
+// background: by email and webhook now, and in their feed the next time it
+// is read. Watchers who can no longer read the project are skipped.
+func (h *Handler) notifyWatchers(ctx context.Context, project *database.Project, version *database.Version, actor *database.User) {
+	if h.watchers == nil {
+		return
+	}
+	h.goJob(ctx, func(ctx context.Context) {
+		watchers, err := h.watchers.ListByProject(ctx, project.ID)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "listing watchers", "error", err, "project", project.Slug)
+			return
+		}
+
+		path := "/project/" + project.Slug + "/" + version.Tag + "/"
+		subject := fmt.Sprintf("%s %s was published", project.Name, version.Tag)
+		body := fmt.Sprintf("%s published version %s of %s.\n\n%s", eventActor(actor), version.Tag, project.Name, h.emailLink(path))
+		if version.ReleaseNotes != "" {
+			body += "Release notes:\n\n" + version.ReleaseNotes + "\n\n"
+		}
+		body += "-- \nYou get this email because you watch " + project.Name + ". Change this on the project page.\n"
+		payload := webhookPayload{
+			Type:         database.EventVersionPublished,
+			Project:      project.Slug,
+			ProjectName:  project.Name,
+			Version:      version.Tag,
+			ContentType:  version.ContentType,
+			ReleaseNotes: version.ReleaseNotes,
+			Actor:        eventActor(actor),
+			PublishedAt:  time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		}
+		if link := h.emailLink(path); link != "" {
+			payload.URL = strings.TrimSpace(link)
+		}
+
+		readers := make(map[int64]*database.User)
+		for _, wt := range watchers {
+			user, seen := readers[wt.UserID]
+			if !seen {
+				if u, err := h.users.GetByID(ctx, wt.UserID); err == nil && !u.Deactivated && h.canViewProject(ctx, u, project) {
+					user = u
+				}
+				readers[wt.UserID] = user
+			}
+			if user == nil {
+				continue
+			}
+			switch wt.Channel {
+			case database.WatchEmail:
+				if user.Email != "" {
+					h.sendEmail(ctx, []string{user.Email}, subject, body)
+				}
+			case database.WatchWebhook:
+				if h.config.Watch.Webhooks {
+					h.postWebhook(ctx, wt.Target, payload)
+				}
+			}
+		}
+	})
+}
+
+// postWebhook posts the payload to the webhook of a watcher. Like emails,
+// failures are only logged.
+func (h *Handler) postWebhook(ctx context.Context, target string, payload webhookPayload) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "encoding webhook", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		h.logger.ErrorContext(ctx, "creating webhook request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "asiakirjat-webhook")
+	resp, err := h.webhookClient().Do(req)
+	if err != nil {
+		h.logger.WarnContext(ctx, "posting webhook", "error", err, "project", payload.Project)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		h.logger.WarnContext(ctx, "webhook refused", "status", resp.StatusCode, "project", payload.Project)
+	}
+}
+
+// webhookClient posts webhooks. Webhook URLs are chosen by users, so unless
+// private networks are allowed it refuses to connect to loopback, private
+// and link-local addresses, checked after name resolution, and does not
+// follow redirects: users cannot reach internal services through it.
+func (h *Handler) webhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !h.config.Watch.WebhookPrivateNetworks {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := addr.Addr().Unmap(); !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				return fmt.Errorf("webhook address %s is not public", ip)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:       dialer.DialContext,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// handleCreateFeedToken creates a new URL for the personal feed of the
+// user, which stops the old one from working. Like API tokens, the token
+// is shown once.
+func (h *Handler) handleCreateFeedToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := auth.UserFromContext(ctx)
+
+	token, err := auth.GenerateToken(32)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "generating feed token", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.watchers.SetFeedToken(ctx, user.ID, auth.HashToken(token)); err != nil {
+		h.logger.ErrorContext(ctx, "saving feed token", "error", err)
+		http.Error(w, "Failed to create feed URL", http.StatusInternalServerError)
+		return
+	}
+	h.renderProfile(w, r, map[string]any{
+		"FeedURL": h.publicURL(r) + "/watching.atom?token=" + token,
+		"Success": "Feed URL created. Copy it now, it is not shown again.",
+	})
+}
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+// uploadVersion uploads a version with release notes through the API.
+func uploadVersion(t *testing.T, app *testApp, slug, token, tag, notes string) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("version", tag)
+	writer.WriteField("release_notes", notes)
+	part, _ := writer.CreateFormFile("archive", "docs.zip")
+	io.Copy(part, createTestZip(t, map[string]string{"index.html": "<html></html>"}))
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", app.server.URL+"/api/project/"+slug+"/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		t.Fatalf("uploading %s: got %d", tag, resp.StatusCode)
+	}
+}
+
+// postWithCookies posts a form as a logged-in user and returns the
+// response body.
+func postWithCookies(t *testing.T, app *testApp, path string, cookies []*http.Cookie, form url.Values) string {
+	t.Helper()
+	req, _ := http.NewRequest("POST", app.server.URL+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+// getWithCookies gets a page as a logged-in user and returns the response
+// body.
+func getWithCookies(t *testing.T, app *testApp, path string, cookies []*http.Cookie) string {
+	t.Helper()
+	req, _ := http.NewRequest("GET", app.server.URL+path, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestWatchProject(t *testing.T) {
+	app := setupTestApp(t)
+	mailer := &fakeMailer{}
+	app.handler.mailer = mailer
+	app.handler.config.Server.PublicURL = "https://docs.example.com"
+	app.handler.config.Watch.WebhookPrivateNetworks = true
+	seedAdmin(t, app)
+	token := uploadTokenForProject(t, app, "guide")
+
+	var mu sync.Mutex
+	var hooks []webhookPayload
+	hookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		hooks = append(hooks, payload)
+		mu.Unlock()
+	}))
+	defer hookServer.Close()
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	body := postWithCookies(t, app, "/project/guide/watch", cookies, url.Values{
+		"channel":     {"email", "webhook", "rss"},
+		"webhook_url": {hookServer.URL + "/hook"},
+	})
+	if !strings.Contains(body, "You now watch this project") {
+		t.Fatal("expected the watch to be saved")
+	}
+	if body := postWithCookies(t, app, "/profile/feed-token", cookies, nil); !strings.Contains(body, "email, webhook, feed") {
+		t.Error("expected the watched project on the profile page")
+	}
+
+	uploadVersion(t, app, "guide", token, "2.0.0", "Adds a *new* chapter.")
+	sent := mailer.take(t, app)
+	if len(sent) != 1 || sent[0].To[0] != "admin@example.com" || !strings.Contains(sent[0].Subject, "Limits Project 2.0.0 was published") {
+		t.Fatalf("expected an email to the watcher, got %+v", sent)
+	}
+	if !strings.Contains(sent[0].Body, "https://docs.example.com/project/guide/2.0.0/") || !strings.Contains(sent[0].Body, "Adds a *new* chapter.") {
+		t.Errorf("unexpected body %q", sent[0].Body)
+	}
+	mu.Lock()
+	if len(hooks) != 1 || hooks[0].Version != "2.0.0" || hooks[0].Type != database.EventVersionPublished || hooks[0].URL != "https://docs.example.com/project/guide/2.0.0/" {
+		t.Errorf("expected the webhook to be posted, got %+v", hooks)
+	}
+	hooks = nil
+	mu.Unlock()
+
+	// Re-uploads are not new versions
+	uploadVersion(t, app, "guide", token, "2.0.0", "")
+	if sent := mailer.take(t, app); len(sent) != 0 {
+		t.Errorf("expected no email for a re-upload, got %+v", sent)
+	}
+
+	body = postWithCookies(t, app, "/project/guide/watch", cookies, url.Values{})
+	if !strings.Contains(body, "You no longer watch this project") {
+		t.Fatal("expected the project to be unwatched")
+	}
+	uploadVersion(t, app, "guide", token, "3.0.0", "")
+	if sent := mailer.take(t, app); len(sent) != 0 {
+		t.Errorf("expected no email after unwatching, got %+v", sent)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(hooks) != 0 {
+		t.Errorf("expected no webhook after unwatching, got %+v", hooks)
+	}
+}
+
+func TestWatchValidation(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	seedAdmin(t, app)
+	project := seedProject(t, app, "guide", "Guide", true)
+	cookies := loginUser(t, app, "admin", "admin123")
+
+	body := postWithCookies(t, app, "/project/guide/watch", cookies, url.Values{"channel": {"webhook"}, "webhook_url": {"ftp://example.com/"}})
+	if !strings.Contains(body, "must be an http or https URL") {
+		t.Error("expected an invalid webhook URL to be refused")
+	}
+
+	// Email is offered only once it is configured
+	postWithCookies(t, app, "/project/guide/watch", cookies, url.Values{"channel": {"email", "rss"}})
+	watchers, _ := app.handler.watchers.ListByProject(ctx, project.ID)
+	if len(watchers) != 1 || watchers[0].Channel != database.WatchFeed {
+		t.Errorf("expected only the feed to be watched, got %+v", watchers)
+	}
+}
+
+func TestWatchingFeed(t *testing.T) {
+	app := setupTestApp(t)
+	ctx := context.Background()
+	admin := seedAdmin(t, app)
+	guide := seedProject(t, app, "guide", "Guide", true)
+	other := seedProject(t, app, "other", "Other", true)
+	seedSEOVersion(t, app, guide, admin, "1.0.0")
+	seedSEOVersion(t, app, other, admin, "1.0.0")
+	app.handler.watchers.Set(ctx, admin.ID, guide.ID, []database.Watcher{{Channel: database.WatchFeed}})
+
+	cookies := loginUser(t, app, "admin", "admin123")
+	body := postWithCookies(t, app, "/profile/feed-token", cookies, nil)
+	_, rest, ok := strings.Cut(body, "/watching.atom?token=")
+	if !ok {
+		t.Fatal("expected the feed URL on the profile page")
+	}
+	token, _, _ := strings.Cut(rest, `"`)
+
+	feed := getBody(t, app.server.URL+"/watching.atom?token="+token)
+	if !strings.Contains(feed, "<title>Guide 1.0.0</title>") || strings.Contains(feed, "Other") {
+		t.Errorf("expected only the watched project in the feed:\n%s", feed)
+	}
+
+	// A new URL replaces the old one
+	postWithCookies(t, app, "/profile/feed-token", cookies, nil)
+	resp, err := http.Get(app.server.URL + "/watching.atom?token=" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the old feed URL to stop working, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebhookClientRefusesPrivateNetworks(t *testing.T) {
+	app := setupTestApp(t)
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	_, err := app.handler.webhookClient().Get(server.URL)
+	if err == nil || !strings.Contains(err.Error(), "not public") {
+		t.Errorf("expected a loopback webhook to be refused, got %v", err)
+	}
+
+	app.handler.config.Watch.WebhookPrivateNetworks = true
+	resp, err := app.handler.webhookClient().Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected private networks to be allowed, got %v", err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,193 @@
+// Package hooks runs site-specific logic at fixed points of uploads, page
+// views and logins, e.g. to register versions in a CMDB or to scan uploads,
+// without changes to the server. Hooks are compiled in, or external
+// commands configured in the hooks section.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Point is where in the server hooks run.
+type Point string
+
+const (
+	// PreUpload hooks run once an upload is extracted, before it is
+	// published; Event.Dir holds its files. An error refuses the upload.
+	PreUpload Point = "pre_upload"
+	// PostPublish hooks run in the background once a version is
+	// published.
+	PostPublish Point = "post_publish"
+	// PreServe hooks run before a page of a version is served, after the
+	// access checks. An error refuses the page with 403 Forbidden.
+	PreServe Point = "pre_serve"
+	// PostLogin hooks run in the background once a user has logged in.
+	PostLogin Point = "post_login"
+)
+
+// Points lists the hook points.
+var Points = []Point{PreUpload, PostPublish, PreServe, PostLogin}
+
+// Blocking reports whether the action at p waits for its hooks, which can
+// refuse it.
+func (p Point) Blocking() bool {
+	return p == PreUpload || p == PreServe
+}
+
+// Event describes what a hook runs for.
+type Event struct {
+	Point    Point  `json:"point"`
+	Project  string `json:"project,omitempty"`
+	Version  string `json:"version,omitempty"`
+	User     string `json:"user,omitempty"`
+	Dir      string `json:"dir,omitempty"`      // files of the version, for uploads
+	Filename string `json:"filename,omitempty"` // uploaded file
+	Path     string `json:"path,omitempty"`     // page within the version, for pre_serve
+	Method   string `json:"method,omitempty"`   // how the user logged in: "password" or "oauth2"
+}
+
+// Hook is logic run at a hook point. At blocking points, an error
+// refuses the action; a Rejection's message is shown to the user.
+type Hook interface {
+	Run(ctx context.Context, e Event) error
+}
+
+// HookFunc adapts a function to Hook.
+type HookFunc func(ctx context.Context, e Event) error
+
+func (f HookFunc) Run(ctx context.Context, e Event) error { return f(ctx, e) }
+
+// Rejection is the error of a hook refusing an action, with the reason
+// shown to the user.
+type Rejection struct {
+	Reason string
+}
+
+func (r *Rejection) Error() string {
+	return r.Reason
+}
+
+// Reason returns the reason to show the user for a hook's error, or "" if
+// the hook failed rather than refused.
+func Reason(err error) string {
+	var rej *Rejection
+	if errors.As(err, &rej) {
+		return rej.Reason
+	}
+	return ""
+}
+
+type registration struct {
+	hook     Hook
+	projects []string
+}
+
+// Registry holds the hooks by point. Hooks are registered at startup,
+// before the server runs them. A nil Registry has no hooks.
+type Registry struct {
+	hooks map[Point][]registration
+}
+
+func NewRegistry() *Registry {
+	return &Registry{hooks: make(map[Point][]registration)}
+}
+
+// Register adds a hook at p, for the given projects only, or for all
+// projects if there are none. Hooks run in the order they are registered.
+func (r *Registry) Register(p Point, h Hook, projects ...string) {
+	r.hooks[p] = append(r.hooks[p], registration{hook: h, projects: projects})
+}
+
+// Has reports whether hooks are registered at p.
+func (r *Registry) Has(p Point) bool {
+	return r != nil && len(r.hooks[p]) > 0
+}
+
+// Run runs the hooks at e.Point for e.Project, in order, and returns the
+// first error, after which the others are not run.
+func (r *Registry) Run(ctx context.Context, e Event) error {
+	if r == nil {
+		return nil
+	}
+	for _, reg := range r.hooks[e.Point] {
+		if len(reg.projects) > 0 && !slices.Contains(reg.projects, e.Project) {
+			continue
+		}
+		if err := reg.hook.Run(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultTimeout bounds a command without a timeout of its own.
+const DefaultTimeout = 10 * time.Second
+
+// Command is a hook running an external command, which gets the event as
+// JSON on its standard input and in ASIAKIRJAT_HOOK_* environment
+// variables. Exit status 0 lets the action proceed; otherwise the first
+// line of its output is the reason it is refused.
+type Command struct {
+	Args    []string
+	Timeout time.Duration
+}
+
+// NewCommand returns a hook running command, split on spaces.
+func NewCommand(command string, timeout time.Duration) (*Command, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("hook command is empty")
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Command{Args: args, Timeout: timeout}, nil
+}
+
+func (c *Command) Run(ctx context.Context, e Event) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	input, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	// Children of a killed command may hold its output open
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(cmd.Environ(),
+		"ASIAKIRJAT_HOOK_POINT="+string(e.Point),
+		"ASIAKIRJAT_HOOK_PROJECT="+e.Project,
+		"ASIAKIRJAT_HOOK_VERSION="+e.Version,
+		"ASIAKIRJAT_HOOK_USER="+e.User,
+		"ASIAKIRJAT_HOOK_DIR="+e.Dir,
+	)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("hook %s timed out after %s", c.Args[0], c.Timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		reason, _, _ := strings.Cut(strings.TrimSpace(output.String()), "\n")
+		if reason == "" {
+			reason = fmt.Sprintf("refused by %s (exit status %d)", c.Args[0], exitErr.ExitCode())
+		}
+		return &Rejection{Reason: reason}
+	}
+	if err != nil {
+		return fmt.Errorf("running hook %s: %w", c.Args[0], err)
+	}
+	return nil
+}
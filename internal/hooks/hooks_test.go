@@ -0,0 +1,99 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryRun(t *testing.T) {
+	ctx := context.Background()
+	var ran []string
+	hook := func(name string, err error) Hook {
+		return HookFunc(func(ctx context.Context, e Event) error {
+			ran = append(ran, name)
+			return err
+		})
+	}
+
+	r := NewRegistry()
+	r.Register(PreUpload, hook("all", nil))
+	r.Register(PreUpload, hook("guide", nil), "guide")
+	r.Register(PreUpload, hook("refuse", &Rejection{Reason: "no"}))
+	r.Register(PreUpload, hook("after", nil))
+
+	err := r.Run(ctx, Event{Point: PreUpload, Project: "other"})
+	if Reason(err) != "no" {
+		t.Errorf("expected the rejection, got %v", err)
+	}
+	if strings.Join(ran, ",") != "all,refuse" {
+		t.Errorf("expected hooks of other projects and after the rejection to be left out, ran %v", ran)
+	}
+	if !r.Has(PreUpload) || r.Has(PostLogin) {
+		t.Error("expected Has to report the points with hooks")
+	}
+
+	var none *Registry
+	if none.Has(PreServe) || none.Run(ctx, Event{Point: PreServe}) != nil {
+		t.Error("expected a nil registry to have no hooks")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	script := func(name, body string) *Command {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		c, err := NewCommand(path+" --flag", time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	event := Event{Point: PreUpload, Project: "guide", Version: "1.0", Dir: "/tmp/upload"}
+
+	out := filepath.Join(dir, "event.json")
+	accept := script("accept.sh", `cat > `+out+`; echo "$ASIAKIRJAT_HOOK_PROJECT $1" >> `+out)
+	if err := accept.Run(ctx, event); err != nil {
+		t.Fatalf("expected exit status 0 to accept, got %v", err)
+	}
+	data, _ := os.ReadFile(out)
+	var got Event
+	lines := strings.SplitN(string(data), "\n", 2)
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil || got != event {
+		t.Errorf("expected the event on stdin, got %q", data)
+	}
+	if !strings.Contains(string(data), "guide --flag") {
+		t.Errorf("expected the event in the environment and the arguments, got %q", data)
+	}
+
+	refuse := script("refuse.sh", "echo 'virus found in index.html'; echo details; exit 3")
+	if err := refuse.Run(ctx, event); Reason(err) != "virus found in index.html" {
+		t.Errorf("expected the first line of the output as reason, got %v", err)
+	}
+	silent := script("silent.sh", "exit 1")
+	if err := silent.Run(ctx, event); !strings.Contains(Reason(err), "exit status 1") {
+		t.Errorf("expected a reason for silent refusals, got %v", err)
+	}
+
+	slow := script("slow.sh", "sleep 5")
+	slow.Timeout = 50 * time.Millisecond
+	err := slow.Run(ctx, event)
+	var rej *Rejection
+	if err == nil || errors.As(err, &rej) {
+		t.Errorf("expected a timeout to fail rather than refuse, got %v", err)
+	}
+
+	if _, err := NewCommand("  ", 0); err == nil {
+		t.Error("expected an empty command to be refused")
+	}
+}
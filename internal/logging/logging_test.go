@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h, err := NewHandler(&buf, "json", slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(h).With("component", "test")
+
+	logger.InfoContext(WithRequestID(context.Background(), "abc-123"), "handled", "status", 200)
+	logger.Debug("hidden")
+	logger.Info("no request")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 JSON lines, got %q", buf.String())
+	}
+	var first, second map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal([]byte(lines[1]), &second)
+	if first["request_id"] != "abc-123" || first["component"] != "test" || first["msg"] != "handled" {
+		t.Errorf("unexpected record %v", first)
+	}
+	if _, ok := second["request_id"]; ok {
+		t.Errorf("expected no request_id without one in the context, got %v", second)
+	}
+
+	if _, err := NewHandler(&buf, "xml", slog.LevelInfo); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"":                       false,
+		"0f8fad5b-d9cb-469f":     true,
+		"trace:span.1_a":         true,
+		"has space":              false,
+		"<script>":               false,
+		strings.Repeat("a", 129): false,
+	} {
+		if got := ValidRequestID(id); got != want {
+			t.Errorf("ValidRequestID(%q) = %v, want %v", id, got, want)
+		}
+	}
+	if a, b := NewRequestID(), NewRequestID(); a == b || !ValidRequestID(a) {
+		t.Errorf("expected distinct valid IDs, got %q and %q", a, b)
+	}
+}
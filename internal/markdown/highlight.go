@@ -0,0 +1,269 @@
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// Highlighted tokens are wrapped in spans with these classes.
+const (
+	classKeyword = "hl-k"
+	classString  = "hl-s"
+	classComment = "hl-c"
+	classNumber  = "hl-n"
+)
+
+// syntax describes a language well enough to highlight its keywords,
+// strings, comments and numbers.
+type syntax struct {
+	keywords      map[string]bool
+	lineComments  []string
+	blockComment  [2]string
+	quotes        string
+	caseSensitive bool
+}
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	syntaxGo = &syntax{
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var true false nil iota`),
+		lineComments:  []string{"//"},
+		blockComment:  [2]string{"/*", "*/"},
+		quotes:        "\"'`",
+		caseSensitive: true,
+	}
+	syntaxPython = &syntax{
+		keywords: words(`and as assert async await break class continue def del elif else except False finally
+			for from global if import in is lambda None nonlocal not or pass raise return True try while with yield`),
+		lineComments:  []string{"#"},
+		quotes:        `"'`,
+		caseSensitive: true,
+	}
+	syntaxJS = &syntax{
+		keywords: words(`async await break case catch class const continue debugger default delete do else enum
+			export extends false finally for function if implements import in instanceof interface let new null
+			of return super switch this throw true try type typeof undefined var void while with yield`),
+		lineComments:  []string{"//"},
+		blockComment:  [2]string{"/*", "*/"},
+		quotes:        "\"'`",
+		caseSensitive: true,
+	}
+	syntaxShell = &syntax{
+		keywords:      words(`case do done elif else esac exit export fi for function if in local return then until while`),
+		lineComments:  []string{"#"},
+		quotes:        `"'`,
+		caseSensitive: true,
+	}
+	syntaxYAML = &syntax{
+		keywords:      words(`true false null yes no on off`),
+		lineComments:  []string{"#"},
+		quotes:        `"'`,
+		caseSensitive: true,
+	}
+	syntaxJSON = &syntax{
+		keywords:      words(`true false null`),
+		quotes:        `"`,
+		caseSensitive: true,
+	}
+	syntaxSQL = &syntax{
+		keywords: words(`alter and as asc by create delete desc distinct drop from group having in index inner
+			insert into is join key left limit not null on or order outer primary references right select set
+			table union update values where`),
+		lineComments: []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `'"`,
+	}
+	syntaxCLike = &syntax{
+		keywords: words(`abstract bool break case catch char class const continue default do double else enum
+			extends false final float fn for if impl implements import int interface let long match mod mut
+			namespace new null package private protected pub public return self static struct super switch
+			this throw throws trait true try use using void where while`),
+		lineComments:  []string{"//"},
+		blockComment:  [2]string{"/*", "*/"},
+		quotes:        `"'`,
+		caseSensitive: true,
+	}
+)
+
+// syntaxes maps the language of a fenced code block to its syntax.
+var syntaxes = map[string]*syntax{
+	"go":         syntaxGo,
+	"golang":     syntaxGo,
+	"python":     syntaxPython,
+	"py":         syntaxPython,
+	"javascript": syntaxJS,
+	"js":         syntaxJS,
+	"typescript": syntaxJS,
+	"ts":         syntaxJS,
+	"sh":         syntaxShell,
+	"bash":       syntaxShell,
+	"shell":      syntaxShell,
+	"console":    syntaxShell,
+	"yaml":       syntaxYAML,
+	"yml":        syntaxYAML,
+	"json":       syntaxJSON,
+	"sql":        syntaxSQL,
+	"c":          syntaxCLike,
+	"cpp":        syntaxCLike,
+	"c++":        syntaxCLike,
+	"csharp":     syntaxCLike,
+	"cs":         syntaxCLike,
+	"java":       syntaxCLike,
+	"kotlin":     syntaxCLike,
+	"rust":       syntaxCLike,
+	"rs":         syntaxCLike,
+}
+
+// Highlight writes code as HTML with the tokens of lang wrapped in spans.
+// Code in other languages is only escaped.
+func Highlight(buf *bytes.Buffer, lang string, code []byte) {
+	syn := syntaxes[strings.ToLower(lang)]
+	if syn == nil {
+		template.HTMLEscape(buf, code)
+		return
+	}
+
+	src := string(code)
+	span := func(class, s string) {
+		buf.WriteString(`<span class="` + class + `">`)
+		template.HTMLEscape(buf, []byte(s))
+		buf.WriteString(`</span>`)
+	}
+	for i := 0; i < len(src); {
+		rest := src[i:]
+		if start := syn.blockComment[0]; start != "" && strings.HasPrefix(rest, start) {
+			end := strings.Index(rest[len(start):], syn.blockComment[1])
+			n := len(rest)
+			if end >= 0 {
+				n = len(start) + end + len(syn.blockComment[1])
+			}
+			span(classComment, rest[:n])
+			i += n
+			continue
+		}
+		if lineComment(syn, rest) {
+			n := strings.IndexByte(rest, '\n')
+			if n < 0 {
+				n = len(rest)
+			}
+			span(classComment, rest[:n])
+			i += n
+			continue
+		}
+		c := rest[0]
+		switch {
+		case strings.IndexByte(syn.quotes, c) >= 0:
+			n := stringLen(rest)
+			span(classString, rest[:n])
+			i += n
+		case isDigit(c) && (i == 0 || !isIdent(src[i-1])):
+			n := 1
+			for n < len(rest) && (isIdent(rest[n]) || rest[n] == '.') {
+				n++
+			}
+			span(classNumber, rest[:n])
+			i += n
+		case isIdent(c):
+			n := 1
+			for n < len(rest) && isIdent(rest[n]) {
+				n++
+			}
+			word := rest[:n]
+			if !syn.caseSensitive {
+				word = strings.ToLower(word)
+			}
+			if syn.keywords[word] {
+				span(classKeyword, rest[:n])
+			} else {
+				template.HTMLEscape(buf, []byte(rest[:n]))
+			}
+			i += n
+		default:
+			template.HTMLEscape(buf, []byte{c})
+			i++
+		}
+	}
+}
+
+func lineComment(syn *syntax, s string) bool {
+	for _, prefix := range syn.lineComments {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringLen returns the length of the string literal at the start of s,
+// up to its closing quote or the end of the line. Backquoted strings may
+// span lines and have no escapes.
+func stringLen(s string) int {
+	quote := s[0]
+	for n := 1; n < len(s); n++ {
+		switch {
+		case s[n] == '\\' && quote != '`':
+			n++
+		case s[n] == quote:
+			return n + 1
+		case s[n] == '\n' && quote != '`':
+			return n
+		}
+	}
+	return len(s)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// codeBlockRenderer renders fenced code blocks with Highlight.
+type codeBlockRenderer struct{}
+
+func (r codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+}
+
+func (r codeBlockRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.FencedCodeBlock)
+	lang := string(n.Language(source))
+
+	var code bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<pre><code")
+	if lang != "" {
+		buf.WriteString(` class="language-`)
+		template.HTMLEscape(&buf, []byte(lang))
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(">")
+	Highlight(&buf, lang, code.Bytes())
+	buf.WriteString("</code></pre>\n")
+	_, err := w.Write(buf.Bytes())
+	return ast.WalkSkipChildren, err
+}
@@ -0,0 +1,56 @@
+package markdown
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	var buf bytes.Buffer
+	Highlight(&buf, "go", []byte(`func main() { // start
+	s := "a<b" + 42
+}`))
+	got := buf.String()
+	for _, want := range []string{
+		`<span class="hl-k">func</span> main()`,
+		`<span class="hl-c">// start</span>`,
+		`<span class="hl-s">&#34;a&lt;b&#34;</span>`,
+		`<span class="hl-n">42</span>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %s", want, got)
+		}
+	}
+
+	buf.Reset()
+	Highlight(&buf, "unknown", []byte("if <x>"))
+	if buf.String() != "if &lt;x&gt;" {
+		t.Errorf("expected unknown languages to be escaped only, got %q", buf.String())
+	}
+}
+
+func TestConvert(t *testing.T) {
+	md := New()
+	source := []byte("# Install *the* tool\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n```sql\nSELECT 1\n```\n\n<script>alert(1)</script>\n")
+	var buf bytes.Buffer
+	if err := md.Convert(source, &buf); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	if !strings.Contains(html, `<h1 id="install-the-tool">`) {
+		t.Errorf("expected a heading anchor, got %s", html)
+	}
+	if !strings.Contains(html, "<table>") {
+		t.Errorf("expected a table, got %s", html)
+	}
+	if !strings.Contains(html, `<code class="language-sql"><span class="hl-k">SELECT</span> <span class="hl-n">1</span>`) {
+		t.Errorf("expected highlighted SQL, got %s", html)
+	}
+	if strings.Contains(html, "<script>") {
+		t.Errorf("expected raw HTML to be left out, got %s", html)
+	}
+	if title := Title(md, source); title != "Install the tool" {
+		t.Errorf("expected the first heading as title, got %q", title)
+	}
+}
@@ -0,0 +1,246 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownTask = errors.New("unknown task")
+	ErrTaskRunning = errors.New("task is already running")
+	// ErrSkipped is returned, wrapped with the reason, by tasks that did
+	// not run, e.g. because another server ran them
+	ErrSkipped = errors.New("skipped")
+)
+
+type slotKey struct{}
+
+// ScheduledAt returns the time the run of the task with ctx was scheduled
+// for, or when it was started for manual runs.
+func ScheduledAt(ctx context.Context) time.Time {
+	slot, _ := ctx.Value(slotKey{}).(time.Time)
+	return slot
+}
+
+// Func is the work performed by a scheduled task.
+type Func func(ctx context.Context) error
+
+// Status is a snapshot of a task's schedule and last run.
+type Status struct {
+	Name         string
+	Description  string
+	Spec         string
+	Enabled      bool
+	Running      bool
+	NextRun      time.Time
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    string
+	Skipped      string // Why the last run was skipped, if it was
+}
+
+type task struct {
+	name        string
+	description string
+	spec        string
+	schedule    *Schedule // nil = manual runs only
+
+	running      bool
+	nextRun      time.Time
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastError    string
+	skipped      string
+	fn           Func
+}
+
+// Scheduler runs registered maintenance tasks on cron schedules. A task
+// never runs concurrently with itself.
+type Scheduler struct {
+	mu     sync.Mutex
+	tasks  []*task
+	ctx    context.Context
+	logger *slog.Logger
+	wg     sync.WaitGroup
+}
+
+func New(logger *slog.Logger) *Scheduler {
+	return &Scheduler{ctx: context.Background(), logger: logger}
+}
+
+// Register adds a task. An empty spec registers the task for manual runs
+// only (e.g. from the admin maintenance page).
+func (s *Scheduler) Register(name, description, spec string, fn Func) error {
+	t := &task{name: name, description: description, spec: spec, fn: fn}
+	if spec != "" {
+		schedule, err := ParseCron(spec)
+		if err != nil {
+			return fmt.Errorf("task %s: %w", name, err)
+		}
+		t.schedule = schedule
+		t.nextRun = schedule.Next(time.Now())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.tasks {
+		if existing.name == name {
+			return fmt.Errorf("task %s already registered", name)
+		}
+	}
+	s.tasks = append(s.tasks, t)
+	return nil
+}
+
+// Start runs due tasks until the context is cancelled, then waits for
+// running tasks to finish.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	s.logger.Info("maintenance scheduler started")
+	for {
+		wait := s.runDue(time.Now())
+		select {
+		case <-ctx.Done():
+			s.wg.Wait()
+			s.logger.Info("maintenance scheduler stopped")
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// runDue starts every task whose next run is at or before now and returns
+// how long to sleep before checking again.
+func (s *Scheduler) runDue(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait := time.Minute
+	for _, t := range s.tasks {
+		if t.schedule == nil || t.nextRun.IsZero() {
+			continue
+		}
+		if !now.Before(t.nextRun) {
+			if !t.running {
+				s.startLocked(t, t.nextRun)
+			} else {
+				s.logger.Warn("maintenance task still running, skipping scheduled run", "task", t.name)
+			}
+			t.nextRun = t.schedule.Next(now)
+		}
+		if d := t.nextRun.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
+
+// RunNow starts the named task immediately in the background.
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tasks {
+		if t.name != name {
+			continue
+		}
+		if t.running {
+			return ErrTaskRunning
+		}
+		s.startLocked(t, time.Now())
+		return nil
+	}
+	return ErrUnknownTask
+}
+
+// RunAtStart makes a scheduled task also run as soon as the scheduler
+// starts, not only at its next scheduled time. Manual-only tasks are left
+// alone.
+func (s *Scheduler) RunAtStart(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tasks {
+		if t.name != name {
+			continue
+		}
+		if t.schedule != nil {
+			t.nextRun = time.Now()
+		}
+		return nil
+	}
+	return ErrUnknownTask
+}
+
+// startLocked runs the task in a goroutine for the run scheduled at slot.
+// The caller must hold s.mu.
+func (s *Scheduler) startLocked(t *task, slot time.Time) {
+	t.running = true
+	ctx := context.WithValue(s.ctx, slotKey{}, slot)
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+		start := time.Now()
+		s.logger.Info("maintenance task started", "task", t.name)
+
+		err := t.fn(ctx)
+
+		s.mu.Lock()
+		t.running = false
+		t.lastRun = start
+		t.lastDuration = time.Since(start)
+		t.lastError, t.skipped = "", ""
+		skipped := errors.Is(err, ErrSkipped)
+		if skipped {
+			t.skipped = strings.TrimPrefix(err.Error(), ErrSkipped.Error()+": ")
+		} else if err != nil {
+			t.lastError = err.Error()
+		}
+		s.mu.Unlock()
+
+		if skipped {
+			s.logger.Info("maintenance task skipped", "task", t.name, "reason", err)
+			return
+		}
+		if err != nil {
+			s.logger.Error("maintenance task failed", "task", t.name, "error", err)
+			return
+		}
+		s.logger.Info("maintenance task finished", "task", t.name, "duration", time.Since(start))
+	}()
+}
+
+// Status returns a snapshot of all registered tasks in registration order.
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]Status, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		result = append(result, Status{
+			Name:         t.name,
+			Description:  t.description,
+			Spec:         t.spec,
+			Enabled:      t.schedule != nil,
+			Running:      t.running,
+			NextRun:      t.nextRun,
+			LastRun:      t.lastRun,
+			LastDuration: t.lastDuration,
+			LastError:    t.lastError,
+			Skipped:      t.skipped,
+		})
+	}
+	return result
+}
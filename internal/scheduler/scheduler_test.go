@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func waitIdle(t *testing.T, s *Scheduler, name string) Status {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, st := range s.Status() {
+			if st.Name == name && !st.Running && !st.LastRun.IsZero() {
+				return st
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("task %s did not finish", name)
+	return Status{}
+}
+
+func TestSchedulerRegisterInvalidSpec(t *testing.T) {
+	s := New(testLogger())
+	if err := s.Register("bad", "", "not a cron", func(context.Context) error { return nil }); err == nil {
+		t.Error("expected error for invalid spec")
+	}
+}
+
+func TestSchedulerRegisterDuplicate(t *testing.T) {
+	s := New(testLogger())
+	noop := func(context.Context) error { return nil }
+	if err := s.Register("task", "", "", noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("task", "", "", noop); err == nil {
+		t.Error("expected error for duplicate task")
+	}
+}
+
+func TestSchedulerRunNow(t *testing.T) {
+	s := New(testLogger())
+	var calls atomic.Int32
+	s.Register("manual", "Manual task", "", func(context.Context) error {
+		calls.Add(1)
+		return errors.New("boom")
+	})
+
+	if err := s.RunNow("missing"); !errors.Is(err, ErrUnknownTask) {
+		t.Errorf("expected ErrUnknownTask, got %v", err)
+	}
+	if err := s.RunNow("manual"); err != nil {
+		t.Fatal(err)
+	}
+
+	st := waitIdle(t, s, "manual")
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 call, got %d", calls.Load())
+	}
+	if st.LastError != "boom" {
+		t.Errorf("expected last error 'boom', got %q", st.LastError)
+	}
+	if st.Enabled {
+		t.Error("expected manual-only task to be disabled")
+	}
+}
+
+func TestSchedulerRunNowWhileRunning(t *testing.T) {
+	s := New(testLogger())
+	release := make(chan struct{})
+	s.Register("slow", "", "", func(context.Context) error {
+		<-release
+		return nil
+	})
+
+	if err := s.RunNow("slow"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RunNow("slow"); !errors.Is(err, ErrTaskRunning) {
+		t.Errorf("expected ErrTaskRunning, got %v", err)
+	}
+	close(release)
+	waitIdle(t, s, "slow")
+}
+
+func TestSchedulerRunDue(t *testing.T) {
+	s := New(testLogger())
+	var calls atomic.Int32
+	s.Register("every-minute", "", "* * * * *", func(context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+
+	next := s.Status()[0].NextRun
+	if next.IsZero() {
+		t.Fatal("expected next run to be set")
+	}
+
+	// Nothing is due before the next run
+	s.runDue(next.Add(-time.Second))
+	if calls.Load() != 0 {
+		t.Fatal("expected task not to run early")
+	}
+
+	s.runDue(next)
+	waitIdle(t, s, "every-minute")
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 call, got %d", calls.Load())
+	}
+	if got := s.Status()[0].NextRun; !got.After(next) {
+		t.Errorf("expected next run to advance past %v, got %v", next, got)
+	}
+}
+
+func TestSchedulerRunAtStart(t *testing.T) {
+	s := New(testLogger())
+	noop := func(context.Context) error { return nil }
+	s.Register("hourly", "", "0 * * * *", noop)
+	s.Register("manual", "", "", noop)
+
+	if err := s.RunAtStart("missing"); !errors.Is(err, ErrUnknownTask) {
+		t.Errorf("expected ErrUnknownTask, got %v", err)
+	}
+	before := time.Now()
+	s.RunAtStart("hourly")
+	s.RunAtStart("manual")
+
+	st := s.Status()
+	if st[0].NextRun.After(before.Add(time.Second)) {
+		t.Errorf("expected the task to be due at start, got %v", st[0].NextRun)
+	}
+	if !st[1].NextRun.IsZero() {
+		t.Errorf("expected the manual task to stay unscheduled, got %v", st[1].NextRun)
+	}
+
+	s.runDue(time.Now())
+	waitIdle(t, s, "hourly")
+	if got := s.Status()[0].NextRun; got.Minute() != 0 || !got.After(before) {
+		t.Errorf("expected the next run on the hour, got %v", got)
+	}
+}
+
+func TestSchedulerSkipped(t *testing.T) {
+	s := New(testLogger())
+	var slot atomic.Value
+	s.Register("shared", "Shared task", "", func(ctx context.Context) error {
+		slot.Store(ScheduledAt(ctx))
+		return fmt.Errorf("%w: another server runs it", ErrSkipped)
+	})
+
+	if err := s.RunNow("shared"); err != nil {
+		t.Fatal(err)
+	}
+	st := waitIdle(t, s, "shared")
+	if st.Skipped != "another server runs it" || st.LastError != "" {
+		t.Errorf("expected a skipped run, got %+v", st)
+	}
+	if at, _ := slot.Load().(time.Time); at.IsZero() {
+		t.Error("expected manual runs to be scheduled now")
+	}
+}
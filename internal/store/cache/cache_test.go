@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	sqlstore "github.com/qwc/asiakirjat/internal/store/sql"
+	"github.com/qwc/asiakirjat/internal/testutil"
+)
+
+func TestTTL(t *testing.T) {
+	c := NewTTL[string, int](time.Minute)
+	loads := 0
+	load := func() (int, error) {
+		loads++
+		return loads, nil
+	}
+
+	if v, _ := c.Load("a", load); v != 1 {
+		t.Fatalf("expected the loaded value, got %d", v)
+	}
+	if v, _ := c.Load("a", load); v != 1 || loads != 1 {
+		t.Errorf("expected the cached value, got %d after %d loads", v, loads)
+	}
+	c.Clear()
+	if v, _ := c.Load("a", load); v != 2 {
+		t.Errorf("expected a reload after Clear, got %d", v)
+	}
+
+	// A value loaded while the cache is cleared is stale and not kept
+	c.Load("b", func() (int, error) {
+		c.Clear()
+		return 0, nil
+	})
+	if c.Len() != 0 {
+		t.Errorf("expected the stale value to be dropped, got %d entries", c.Len())
+	}
+
+	if _, err := c.Load("c", func() (int, error) { return 0, errors.New("failed") }); err == nil || c.Len() != 0 {
+		t.Errorf("expected errors not to be cached, got %v with %d entries", err, c.Len())
+	}
+}
+
+func TestTTLDisabled(t *testing.T) {
+	c := NewTTL[string, int](0)
+	loads := 0
+	for range 2 {
+		c.Load("a", func() (int, error) {
+			loads++
+			return loads, nil
+		})
+	}
+	if loads != 2 {
+		t.Errorf("expected every lookup to load, got %d loads", loads)
+	}
+}
+
+func TestProjectStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	projects := New(time.Minute).Projects(sqlstore.NewProjectStore(db))
+	ctx := context.Background()
+
+	project := &database.Project{Slug: "docs", Name: "Docs", Visibility: database.VisibilityPublic}
+	if err := projects.Create(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	got, err := projects.GetBySlug(ctx, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Name = "Changed by a caller"
+
+	// Other writers are seen when the entries expire
+	db.MustExec(`UPDATE projects SET name = 'Changed elsewhere' WHERE id = ?`, project.ID)
+	if got, _ := projects.GetBySlug(ctx, "docs"); got.Name != "Docs" {
+		t.Errorf("expected the cached project unchanged by callers, got %q", got.Name)
+	}
+
+	project.Name = "Renamed"
+	if err := projects.Update(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := projects.GetBySlug(ctx, "docs"); got.Name != "Renamed" {
+		t.Errorf("expected the update to clear the cache, got %q", got.Name)
+	}
+	if got, _ := projects.GetByID(ctx, project.ID); got.Name != "Renamed" {
+		t.Errorf("expected the project by ID, got %q", got.Name)
+	}
+
+	if err := projects.Delete(ctx, project.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := projects.GetBySlug(ctx, "docs"); err == nil {
+		t.Error("expected the deleted project not to be found")
+	}
+}
+
+func TestAccessStores(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	c := New(time.Minute)
+	projects := c.Projects(sqlstore.NewProjectStore(db))
+	users := sqlstore.NewUserStore(db)
+	access := c.Access(sqlstore.NewProjectAccessStore(db))
+	global := c.GlobalAccess(sqlstore.NewGlobalAccessStore(db))
+	ctx := context.Background()
+
+	project := &database.Project{Slug: "docs", Name: "Docs", Visibility: database.VisibilityCustom}
+	projects.Create(ctx, project)
+	user := &database.User{Username: "reader", Role: "viewer", AuthSource: "builtin"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	if role, _ := access.GetEffectiveRole(ctx, project.ID, user.ID); role != "" {
+		t.Fatalf("expected no role, got %q", role)
+	}
+	if err := access.Grant(ctx, &database.ProjectAccess{ProjectID: project.ID, UserID: user.ID, Role: "editor", Source: "manual"}); err != nil {
+		t.Fatal(err)
+	}
+	if role, _ := access.GetEffectiveRole(ctx, project.ID, user.ID); role != "editor" {
+		t.Errorf("expected the grant to clear the cache, got %q", role)
+	}
+
+	if _, err := global.GetGrantByUser(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected no grant, got %v", err)
+	}
+	if _, err := global.GetGrantByUser(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected the cached absence of a grant, got %v", err)
+	}
+	if err := global.UpsertGrant(ctx, &database.GlobalAccessGrant{UserID: user.ID, Role: "viewer", Source: "ldap"}); err != nil {
+		t.Fatal(err)
+	}
+	if grant, err := global.GetGrantByUser(ctx, user.ID); err != nil || grant.Role != "viewer" {
+		t.Errorf("expected the new grant, got %v %v", grant, err)
+	}
+}
@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/store"
+)
+
+// Cache holds the cached lookups of documentation requests: projects by
+// slug and ID, versions by tag, project roles and global access grants.
+// Wrap the stores with its methods and use only the wrapped stores, or
+// their writes do not clear it.
+type Cache struct {
+	projectsBySlug *TTL[string, database.Project]
+	projectsByID   *TTL[int64, database.Project]
+	versions       *TTL[versionKey, database.Version]
+	roles          *TTL[accessKey, string]
+	grants         *TTL[int64, *database.GlobalAccessGrant]
+}
+
+type versionKey struct {
+	projectID int64
+	tag       string
+}
+
+type accessKey struct {
+	projectID, userID int64
+}
+
+// New returns a cache whose entries expire after ttl. With a ttl of 0 the
+// wrapped stores cache nothing.
+func New(ttl time.Duration) *Cache {
+	return &Cache{
+		projectsBySlug: NewTTL[string, database.Project](ttl),
+		projectsByID:   NewTTL[int64, database.Project](ttl),
+		versions:       NewTTL[versionKey, database.Version](ttl),
+		roles:          NewTTL[accessKey, string](ttl),
+		grants:         NewTTL[int64, *database.GlobalAccessGrant](ttl),
+	}
+}
+
+// Clear drops all entries.
+func (c *Cache) Clear() {
+	c.clearProjects()
+	c.versions.Clear()
+	c.roles.Clear()
+	c.grants.Clear()
+}
+
+func (c *Cache) clearProjects() {
+	c.projectsBySlug.Clear()
+	c.projectsByID.Clear()
+}
+
+// Projects caches GetBySlug and GetByID of s.
+func (c *Cache) Projects(s store.ProjectStore) store.ProjectStore {
+	return &projectStore{ProjectStore: s, c: c}
+}
+
+// Versions caches GetByProjectAndTag of s.
+func (c *Cache) Versions(s store.VersionStore) store.VersionStore {
+	return &versionStore{VersionStore: s, c: c}
+}
+
+// Access caches GetEffectiveRole of s.
+func (c *Cache) Access(s store.ProjectAccessStore) store.ProjectAccessStore {
+	return &accessStore{ProjectAccessStore: s, c: c}
+}
+
+// GlobalAccess caches GetGrantByUser of s.
+func (c *Cache) GlobalAccess(s store.GlobalAccessStore) store.GlobalAccessStore {
+	return &globalAccessStore{GlobalAccessStore: s, c: c}
+}
+
+// Cached values are copied on the way out, so that callers changing the
+// structs they get do not change the cache.
+
+type projectStore struct {
+	store.ProjectStore
+	c *Cache
+}
+
+func (s *projectStore) GetBySlug(ctx context.Context, slug string) (*database.Project, error) {
+	p, err := s.c.projectsBySlug.Load(slug, func() (database.Project, error) {
+		p, err := s.ProjectStore.GetBySlug(ctx, slug)
+		if err != nil {
+			return database.Project{}, err
+		}
+		return *p, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *projectStore) GetByID(ctx context.Context, id int64) (*database.Project, error) {
+	p, err := s.c.projectsByID.Load(id, func() (database.Project, error) {
+		p, err := s.ProjectStore.GetByID(ctx, id)
+		if err != nil {
+			return database.Project{}, err
+		}
+		return *p, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *projectStore) Create(ctx context.Context, project *database.Project) error {
+	defer s.c.clearProjects()
+	return s.ProjectStore.Create(ctx, project)
+}
+
+func (s *projectStore) Update(ctx context.Context, project *database.Project) error {
+	defer s.c.clearProjects()
+	return s.ProjectStore.Update(ctx, project)
+}
+
+func (s *projectStore) SetOwnerOrphaned(ctx context.Context, id int64, orphaned bool) error {
+	defer s.c.clearProjects()
+	return s.ProjectStore.SetOwnerOrphaned(ctx, id, orphaned)
+}
+
+// Delete also drops the versions and roles, which are deleted with the
+// project.
+func (s *projectStore) Delete(ctx context.Context, id int64) error {
+	defer s.c.Clear()
+	return s.ProjectStore.Delete(ctx, id)
+}
+
+type versionStore struct {
+	store.VersionStore
+	c *Cache
+}
+
+func (s *versionStore) GetByProjectAndTag(ctx context.Context, projectID int64, tag string) (*database.Version, error) {
+	v, err := s.c.versions.Load(versionKey{projectID, tag}, func() (database.Version, error) {
+		v, err := s.VersionStore.GetByProjectAndTag(ctx, projectID, tag)
+		if err != nil {
+			return database.Version{}, err
+		}
+		return *v, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (s *versionStore) Create(ctx context.Context, version *database.Version) error {
+	defer s.c.versions.Clear()
+	return s.VersionStore.Create(ctx, version)
+}
+
+func (s *versionStore) Update(ctx context.Context, version *database.Version) error {
+	defer s.c.versions.Clear()
+	return s.VersionStore.Update(ctx, version)
+}
+
+func (s *versionStore) SetProtected(ctx context.Context, id int64, protected bool) error {
+	defer s.c.versions.Clear()
+	return s.VersionStore.SetProtected(ctx, id, protected)
+}
+
+func (s *versionStore) SetLifecycle(ctx context.Context, id int64, lifecycle, message string) error {
+	defer s.c.versions.Clear()
+	return s.VersionStore.SetLifecycle(ctx, id, lifecycle, message)
+}
+
+func (s *versionStore) SetSize(ctx context.Context, id, size int64) error {
+	defer s.c.versions.Clear()
+	return s.VersionStore.SetSize(ctx, id, size)
+}
+
+func (s *versionStore) Rename(ctx context.Context, id int64, tag, storagePath string) error {
+	defer s.c.versions.Clear()
+	return s.VersionStore.Rename(ctx, id, tag, storagePath)
+}
+
+func (s *versionStore) Delete(ctx context.Context, id int64) error {
+	defer s.c.versions.Clear()
+	return s.VersionStore.Delete(ctx, id)
+}
+
+type accessStore struct {
+	store.ProjectAccessStore
+	c *Cache
+}
+
+func (s *accessStore) GetEffectiveRole(ctx context.Context, projectID, userID int64) (string, error) {
+	return s.c.roles.Load(accessKey{projectID, userID}, func() (string, error) {
+		return s.ProjectAccessStore.GetEffectiveRole(ctx, projectID, userID)
+	})
+}
+
+func (s *accessStore) Grant(ctx context.Context, access *database.ProjectAccess) error {
+	defer s.c.roles.Clear()
+	return s.ProjectAccessStore.Grant(ctx, access)
+}
+
+func (s *accessStore) Revoke(ctx context.Context, projectID, userID int64) error {
+	defer s.c.roles.Clear()
+	return s.ProjectAccessStore.Revoke(ctx, projectID, userID)
+}
+
+func (s *accessStore) RevokeBySource(ctx context.Context, projectID, userID int64, source string) error {
+	defer s.c.roles.Clear()
+	return s.ProjectAccessStore.RevokeBySource(ctx, projectID, userID, source)
+}
+
+type globalAccessStore struct {
+	store.GlobalAccessStore
+	c *Cache
+}
+
+// GetGrantByUser also caches that a user has no grant, which is the case
+// for most users.
+func (s *globalAccessStore) GetGrantByUser(ctx context.Context, userID int64) (*database.GlobalAccessGrant, error) {
+	g, err := s.c.grants.Load(userID, func() (*database.GlobalAccessGrant, error) {
+		g, err := s.GlobalAccessStore.GetGrantByUser(ctx, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return g, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, fmt.Errorf("getting global access grant: %w", sql.ErrNoRows)
+	}
+	grant := *g
+	return &grant, nil
+}
+
+func (s *globalAccessStore) UpsertGrant(ctx context.Context, grant *database.GlobalAccessGrant) error {
+	defer s.c.grants.Clear()
+	return s.GlobalAccessStore.UpsertGrant(ctx, grant)
+}
+
+func (s *globalAccessStore) DeleteGrantsBySource(ctx context.Context, userID int64, source string) error {
+	defer s.c.grants.Clear()
+	return s.GlobalAccessStore.DeleteGrantsBySource(ctx, userID, source)
+}
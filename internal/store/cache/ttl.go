@@ -0,0 +1,92 @@
+// Package cache keeps the results of frequent store lookups in memory.
+// The stores it wraps clear their cache on every write through them, so
+// that a single server never serves stale data; writes of other servers
+// sharing the database become visible when the entries expire.
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// maxEntries bounds the entries of a TTL. A full TTL drops its expired
+// entries, and all of them if none has expired.
+const maxEntries = 10000
+
+// TTL is a map of loaded values that expire after a time to live.
+type TTL[K comparable, V any] struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	gen     uint64 // incremented by every Clear
+	entries map[K]entry[V]
+}
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// NewTTL returns a TTL whose entries expire after ttl. With a ttl of 0
+// nothing is cached.
+func NewTTL[K comparable, V any](ttl time.Duration) *TTL[K, V] {
+	return &TTL[K, V]{ttl: ttl, entries: make(map[K]entry[V])}
+}
+
+// Load returns the value of key. On a miss it calls load and keeps its
+// result, unless load fails or the TTL was cleared while it ran, which
+// makes the result stale.
+func (c *TTL[K, V]) Load(key K, load func() (V, error)) (V, error) {
+	if c.ttl <= 0 {
+		return load()
+	}
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		c.mu.Unlock()
+		return e.value, nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return v, nil
+	}
+	if len(c.entries) >= maxEntries {
+		c.dropExpired(now)
+		if len(c.entries) >= maxEntries {
+			clear(c.entries)
+		}
+	}
+	c.entries[key] = entry[V]{value: v, expires: now.Add(c.ttl)}
+	return v, nil
+}
+
+// Clear drops all entries, e.g. after a write.
+func (c *TTL[K, V]) Clear() {
+	c.mu.Lock()
+	c.gen++
+	clear(c.entries)
+	c.mu.Unlock()
+}
+
+// Len returns the number of entries, including expired ones.
+func (c *TTL[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *TTL[K, V]) dropExpired(now time.Time) {
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type AnalyticsStore struct {
+	db *sqlx.DB
+}
+
+func NewAnalyticsStore(db *sqlx.DB) *AnalyticsStore {
+	return &AnalyticsStore{db: db}
+}
+
+func (s *AnalyticsStore) Record(ctx context.Context, hit *database.PageHit) error {
+	if hit.ViewedAt.IsZero() {
+		hit.ViewedAt = time.Now().UTC()
+	}
+	query := `INSERT INTO page_hits (project_id, version, path, user_id, status, viewed_at) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query),
+		hit.ProjectID, hit.Version, hit.Path, hit.UserID, hit.Status, hit.ViewedAt); err != nil {
+		return fmt.Errorf("recording page hit: %w", err)
+	}
+	return nil
+}
+
+// TopPages counts the successful hits per path, across all versions.
+func (s *AnalyticsStore) TopPages(ctx context.Context, projectID int64, since time.Time, limit int) ([]database.HitCount, error) {
+	var counts []database.HitCount
+	query := `SELECT '' AS version, path, COUNT(*) AS hits, COUNT(DISTINCT user_id) AS readers
+		FROM page_hits WHERE project_id = ? AND status < 400 AND viewed_at >= ?
+		GROUP BY path ORDER BY hits DESC, path LIMIT ?`
+	if err := s.db.SelectContext(ctx, &counts, s.db.Rebind(query), projectID, since.UTC(), limit); err != nil {
+		return nil, fmt.Errorf("counting top pages: %w", err)
+	}
+	return counts, nil
+}
+
+// NotFound counts the hits per version and path that found no file.
+func (s *AnalyticsStore) NotFound(ctx context.Context, projectID int64, since time.Time, limit int) ([]database.HitCount, error) {
+	var counts []database.HitCount
+	query := `SELECT version, path, COUNT(*) AS hits, COUNT(DISTINCT user_id) AS readers
+		FROM page_hits WHERE project_id = ? AND status = 404 AND viewed_at >= ?
+		GROUP BY version, path ORDER BY hits DESC, version, path LIMIT ?`
+	if err := s.db.SelectContext(ctx, &counts, s.db.Rebind(query), projectID, since.UTC(), limit); err != nil {
+		return nil, fmt.Errorf("counting missing pages: %w", err)
+	}
+	return counts, nil
+}
+
+// Versions counts the successful hits per version.
+func (s *AnalyticsStore) Versions(ctx context.Context, projectID int64, since time.Time) ([]database.HitCount, error) {
+	var counts []database.HitCount
+	query := `SELECT version, '' AS path, COUNT(*) AS hits, COUNT(DISTINCT user_id) AS readers
+		FROM page_hits WHERE project_id = ? AND status < 400 AND viewed_at >= ?
+		GROUP BY version ORDER BY hits DESC, version`
+	if err := s.db.SelectContext(ctx, &counts, s.db.Rebind(query), projectID, since.UTC()); err != nil {
+		return nil, fmt.Errorf("counting version hits: %w", err)
+	}
+	return counts, nil
+}
+
+// DeleteBefore removes the hits recorded before the given time and returns
+// how many were removed.
+func (s *AnalyticsStore) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(`DELETE FROM page_hits WHERE viewed_at < ?`), before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("deleting old page hits: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,57 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type APIKeyStore struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyStore(db *sqlx.DB) *APIKeyStore {
+	return &APIKeyStore{db: db}
+}
+
+func (s *APIKeyStore) Create(ctx context.Context, key *database.APIKey) error {
+	query := `INSERT INTO api_keys (name, key_hash, quota, created_by) VALUES (?, ?, ?, ?)`
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(query), key.Name, key.KeyHash, key.Quota, key.CreatedBy)
+	if err != nil {
+		return fmt.Errorf("creating api key: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	key.ID = id
+	return nil
+}
+
+func (s *APIKeyStore) GetByHash(ctx context.Context, hash string) (*database.APIKey, error) {
+	var key database.APIKey
+	query := `SELECT * FROM api_keys WHERE key_hash = ?`
+	if err := s.db.GetContext(ctx, &key, s.db.Rebind(query), hash); err != nil {
+		return nil, fmt.Errorf("getting api key: %w", err)
+	}
+	return &key, nil
+}
+
+func (s *APIKeyStore) List(ctx context.Context) ([]database.APIKey, error) {
+	var keys []database.APIKey
+	query := `SELECT * FROM api_keys ORDER BY name, id`
+	if err := s.db.SelectContext(ctx, &keys, query); err != nil {
+		return nil, fmt.Errorf("listing api keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (s *APIKeyStore) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM api_keys WHERE id = ?`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), id); err != nil {
+		return fmt.Errorf("deleting api key: %w", err)
+	}
+	return nil
+}
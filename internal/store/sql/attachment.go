@@ -0,0 +1,79 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type AttachmentStore struct {
+	db *sqlx.DB
+}
+
+func NewAttachmentStore(db *sqlx.DB) *AttachmentStore {
+	return &AttachmentStore{db: db}
+}
+
+func (s *AttachmentStore) Upsert(ctx context.Context, attachment *database.VersionAttachment) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM version_attachments WHERE version_id = ? AND kind = ?`),
+		attachment.VersionID, attachment.Kind); err != nil {
+		return fmt.Errorf("replacing attachment: %w", err)
+	}
+
+	query := `INSERT INTO version_attachments (version_id, kind, filename, size, sha256) VALUES (?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, tx.Rebind(query),
+		attachment.VersionID, attachment.Kind, attachment.Filename, attachment.Size, attachment.SHA256)
+	if err != nil {
+		return fmt.Errorf("creating attachment: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	attachment.ID = id
+
+	return tx.Commit()
+}
+
+func (s *AttachmentStore) GetByVersionAndKind(ctx context.Context, versionID int64, kind string) (*database.VersionAttachment, error) {
+	var attachment database.VersionAttachment
+	query := `SELECT * FROM version_attachments WHERE version_id = ? AND kind = ?`
+	if err := s.db.GetContext(ctx, &attachment, s.db.Rebind(query), versionID, kind); err != nil {
+		return nil, fmt.Errorf("getting attachment: %w", err)
+	}
+	return &attachment, nil
+}
+
+func (s *AttachmentStore) ListByVersion(ctx context.Context, versionID int64) ([]database.VersionAttachment, error) {
+	var attachments []database.VersionAttachment
+	query := `SELECT * FROM version_attachments WHERE version_id = ? ORDER BY kind`
+	if err := s.db.SelectContext(ctx, &attachments, s.db.Rebind(query), versionID); err != nil {
+		return nil, fmt.Errorf("listing attachments: %w", err)
+	}
+	return attachments, nil
+}
+
+func (s *AttachmentStore) ListByProject(ctx context.Context, projectID int64) ([]database.VersionAttachment, error) {
+	var attachments []database.VersionAttachment
+	query := `SELECT a.* FROM version_attachments a JOIN versions v ON v.id = a.version_id WHERE v.project_id = ? ORDER BY a.kind`
+	if err := s.db.SelectContext(ctx, &attachments, s.db.Rebind(query), projectID); err != nil {
+		return nil, fmt.Errorf("listing project attachments: %w", err)
+	}
+	return attachments, nil
+}
+
+func (s *AttachmentStore) DeleteByVersion(ctx context.Context, versionID int64) error {
+	query := `DELETE FROM version_attachments WHERE version_id = ?`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), versionID); err != nil {
+		return fmt.Errorf("deleting attachments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type AuditLogStore struct {
+	db *sqlx.DB
+}
+
+func NewAuditLogStore(db *sqlx.DB) *AuditLogStore {
+	return &AuditLogStore{db: db}
+}
+
+func (s *AuditLogStore) Create(ctx context.Context, entry *database.AuditEntry) error {
+	query := `INSERT INTO audit_log (action, actor, details) VALUES (?, ?, ?)`
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(query), entry.Action, entry.Actor, entry.Details)
+	if err != nil {
+		return fmt.Errorf("creating audit entry: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	entry.ID = id
+	return nil
+}
+
+// List returns the most recent entries, newest first.
+func (s *AuditLogStore) List(ctx context.Context, limit int) ([]database.AuditEntry, error) {
+	var entries []database.AuditEntry
+	query := `SELECT * FROM audit_log ORDER BY created_at DESC, id DESC LIMIT ?`
+	if err := s.db.SelectContext(ctx, &entries, s.db.Rebind(query), limit); err != nil {
+		return nil, fmt.Errorf("listing audit entries: %w", err)
+	}
+	return entries, nil
+}
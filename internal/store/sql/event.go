@@ -0,0 +1,43 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type EventStore struct {
+	db *sqlx.DB
+}
+
+func NewEventStore(db *sqlx.DB) *EventStore {
+	return &EventStore{db: db}
+}
+
+func (s *EventStore) Create(ctx context.Context, event *database.Event) error {
+	if event.Payload == "" {
+		event.Payload = "{}"
+	}
+	query := `INSERT INTO events (type, project, payload) VALUES (?, ?, ?)`
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(query), event.Type, event.Project, event.Payload)
+	if err != nil {
+		return fmt.Errorf("creating event: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	event.ID = id
+	return nil
+}
+
+func (s *EventStore) ListAfter(ctx context.Context, after int64, limit int) ([]database.Event, error) {
+	var events []database.Event
+	query := `SELECT * FROM events WHERE id > ? ORDER BY id LIMIT ?`
+	if err := s.db.SelectContext(ctx, &events, s.db.Rebind(query), after, limit); err != nil {
+		return nil, fmt.Errorf("listing events: %w", err)
+	}
+	return events, nil
+}
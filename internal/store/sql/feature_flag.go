@@ -0,0 +1,77 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type FeatureFlagStore struct {
+	db *sqlx.DB
+}
+
+func NewFeatureFlagStore(db *sqlx.DB) *FeatureFlagStore {
+	return &FeatureFlagStore{db: db}
+}
+
+func (s *FeatureFlagStore) List(ctx context.Context) ([]database.FeatureFlag, error) {
+	var flags []database.FeatureFlag
+	err := s.db.SelectContext(ctx, &flags, `
+		SELECT 0 AS project_id, name, enabled FROM feature_flags
+		UNION ALL
+		SELECT project_id, name, enabled FROM project_feature_flags
+		ORDER BY project_id, name`)
+	if err != nil {
+		return nil, fmt.Errorf("listing feature flags: %w", err)
+	}
+	return flags, nil
+}
+
+func (s *FeatureFlagStore) Set(ctx context.Context, flag database.FeatureFlag) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := deleteFeatureFlag(ctx, tx, flag.ProjectID, flag.Name); err != nil {
+		return err
+	}
+	if flag.ProjectID == 0 {
+		_, err = tx.ExecContext(ctx, tx.Rebind(`INSERT INTO feature_flags (name, enabled) VALUES (?, ?)`), flag.Name, flag.Enabled)
+	} else {
+		_, err = tx.ExecContext(ctx, tx.Rebind(`INSERT INTO project_feature_flags (project_id, name, enabled) VALUES (?, ?, ?)`), flag.ProjectID, flag.Name, flag.Enabled)
+	}
+	if err != nil {
+		return fmt.Errorf("setting feature flag %q: %w", flag.Name, err)
+	}
+	return tx.Commit()
+}
+
+func (s *FeatureFlagStore) Delete(ctx context.Context, projectID int64, name string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := deleteFeatureFlag(ctx, tx, projectID, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteFeatureFlag(ctx context.Context, tx *sqlx.Tx, projectID int64, name string) error {
+	var err error
+	if projectID == 0 {
+		_, err = tx.ExecContext(ctx, tx.Rebind(`DELETE FROM feature_flags WHERE name = ?`), name)
+	} else {
+		_, err = tx.ExecContext(ctx, tx.Rebind(`DELETE FROM project_feature_flags WHERE project_id = ? AND name = ?`), projectID, name)
+	}
+	if err != nil {
+		return fmt.Errorf("clearing feature flag %q: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type FeedbackStore struct {
+	db *sqlx.DB
+}
+
+func NewFeedbackStore(db *sqlx.DB) *FeedbackStore {
+	return &FeedbackStore{db: db}
+}
+
+func (s *FeedbackStore) Create(ctx context.Context, feedback *database.Feedback) error {
+	query := `INSERT INTO feedback (project_id, version_tag, page_url, selection, message, author) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(query),
+		feedback.ProjectID, feedback.VersionTag, feedback.PageURL, feedback.Selection, feedback.Message, feedback.Author)
+	if err != nil {
+		return fmt.Errorf("creating feedback: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	feedback.ID = id
+	return nil
+}
+
+// ListByProject returns the most recent reports of a project, newest first.
+func (s *FeedbackStore) ListByProject(ctx context.Context, projectID int64, limit int) ([]database.Feedback, error) {
+	var feedback []database.Feedback
+	query := `SELECT * FROM feedback WHERE project_id = ? ORDER BY created_at DESC, id DESC LIMIT ?`
+	if err := s.db.SelectContext(ctx, &feedback, s.db.Rebind(query), projectID, limit); err != nil {
+		return nil, fmt.Errorf("listing feedback: %w", err)
+	}
+	return feedback, nil
+}
+
+// Delete removes a report of a project.
+func (s *FeedbackStore) Delete(ctx context.Context, projectID, id int64) error {
+	query := `DELETE FROM feedback WHERE project_id = ? AND id = ?`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), projectID, id); err != nil {
+		return fmt.Errorf("deleting feedback: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type HistoryStore struct {
+	db *sqlx.DB
+}
+
+func NewHistoryStore(db *sqlx.DB) *HistoryStore {
+	return &HistoryStore{db: db}
+}
+
+func (s *HistoryStore) Record(ctx context.Context, view *database.PageView, keep int) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Deleting and inserting moves the page to the top of the history.
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM page_history WHERE user_id = ? AND project_id = ? AND path = ?`),
+		view.UserID, view.ProjectID, view.Path); err != nil {
+		return fmt.Errorf("replacing page view: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`INSERT INTO page_history (user_id, project_id, version, path) VALUES (?, ?, ?, ?)`),
+		view.UserID, view.ProjectID, view.Version, view.Path); err != nil {
+		return fmt.Errorf("recording page view: %w", err)
+	}
+
+	// Every view is pruned, so this reads at most a few rows more than keep.
+	var ids []int64
+	if err := tx.SelectContext(ctx, &ids, tx.Rebind(`SELECT id FROM page_history WHERE user_id = ? ORDER BY id DESC`), view.UserID); err != nil {
+		return fmt.Errorf("listing old page views: %w", err)
+	}
+	for _, id := range ids[min(keep, len(ids)):] {
+		if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM page_history WHERE id = ?`), id); err != nil {
+			return fmt.Errorf("forgetting old page view: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *HistoryStore) ListByUser(ctx context.Context, userID int64, limit int) ([]database.PageView, error) {
+	var views []database.PageView
+	query := `SELECT * FROM page_history WHERE user_id = ? ORDER BY id DESC LIMIT ?`
+	if err := s.db.SelectContext(ctx, &views, s.db.Rebind(query), userID, limit); err != nil {
+		return nil, fmt.Errorf("listing page history: %w", err)
+	}
+	return views, nil
+}
+
+func (s *HistoryStore) DeleteByUser(ctx context.Context, userID int64) error {
+	query := `DELETE FROM page_history WHERE user_id = ?`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), userID); err != nil {
+		return fmt.Errorf("clearing page history: %w", err)
+	}
+	return nil
+}
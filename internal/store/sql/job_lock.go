@@ -0,0 +1,58 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type JobLockStore struct {
+	db *sqlx.DB
+}
+
+func NewJobLockStore(db *sqlx.DB) *JobLockStore {
+	return &JobLockStore{db: db}
+}
+
+// Acquire takes the lock with a single conditional update, so that of
+// servers trying at the same time exactly one succeeds.
+func (s *JobLockStore) Acquire(ctx context.Context, name, holder string, slot, expires time.Time) (bool, error) {
+	insert := `INSERT INTO job_locks (name) VALUES (?) ON CONFLICT(name) DO NOTHING`
+	if s.db.DriverName() == "mysql" {
+		insert = `INSERT IGNORE INTO job_locks (name) VALUES (?)`
+	}
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(insert), name); err != nil {
+		return false, fmt.Errorf("creating job lock: %w", err)
+	}
+
+	query := `UPDATE job_locks SET holder = ?, slot = ?, expires_at = ?
+		WHERE name = ? AND (expires_at IS NULL OR expires_at < ?) AND (slot IS NULL OR slot < ?)`
+	res, err := s.db.ExecContext(ctx, s.db.Rebind(query),
+		holder, slot.UTC(), expires.UTC(), name, time.Now().UTC(), slot.UTC())
+	if err != nil {
+		return false, fmt.Errorf("acquiring job lock: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("acquiring job lock: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (s *JobLockStore) Extend(ctx context.Context, name, holder string, expires time.Time) error {
+	query := `UPDATE job_locks SET expires_at = ? WHERE name = ? AND holder = ? AND expires_at IS NOT NULL`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), expires.UTC(), name, holder); err != nil {
+		return fmt.Errorf("extending job lock: %w", err)
+	}
+	return nil
+}
+
+func (s *JobLockStore) Release(ctx context.Context, name, holder string) error {
+	query := `UPDATE job_locks SET expires_at = NULL WHERE name = ? AND holder = ?`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), name, holder); err != nil {
+		return fmt.Errorf("releasing job lock: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type MetadataStore struct {
+	db *sqlx.DB
+}
+
+func NewMetadataStore(db *sqlx.DB) *MetadataStore {
+	return &MetadataStore{db: db}
+}
+
+type metadataRow struct {
+	OwnerID int64  `db:"owner_id"`
+	Key     string `db:"meta_key"`
+	Value   string `db:"meta_value"`
+}
+
+func (s *MetadataStore) GetProject(ctx context.Context, projectID int64) (map[string]string, error) {
+	return s.get(ctx, `SELECT project_id AS owner_id, meta_key, meta_value FROM project_metadata WHERE project_id = ?`, projectID)
+}
+
+func (s *MetadataStore) SetProject(ctx context.Context, projectID int64, meta map[string]string) error {
+	return s.set(ctx, "project_metadata", "project_id", projectID, meta)
+}
+
+func (s *MetadataStore) ListProjects(ctx context.Context) (map[int64]map[string]string, error) {
+	return s.list(ctx, `SELECT project_id AS owner_id, meta_key, meta_value FROM project_metadata`)
+}
+
+func (s *MetadataStore) GetVersion(ctx context.Context, versionID int64) (map[string]string, error) {
+	return s.get(ctx, `SELECT version_id AS owner_id, meta_key, meta_value FROM version_metadata WHERE version_id = ?`, versionID)
+}
+
+func (s *MetadataStore) SetVersion(ctx context.Context, versionID int64, meta map[string]string) error {
+	return s.set(ctx, "version_metadata", "version_id", versionID, meta)
+}
+
+func (s *MetadataStore) ListVersionsByProject(ctx context.Context, projectID int64) (map[int64]map[string]string, error) {
+	return s.list(ctx, `SELECT m.version_id AS owner_id, m.meta_key, m.meta_value FROM version_metadata m
+		JOIN versions v ON v.id = m.version_id WHERE v.project_id = ?`, projectID)
+}
+
+func (s *MetadataStore) get(ctx context.Context, query string, id int64) (map[string]string, error) {
+	all, err := s.list(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	if meta, ok := all[id]; ok {
+		return meta, nil
+	}
+	return map[string]string{}, nil
+}
+
+func (s *MetadataStore) list(ctx context.Context, query string, args ...any) (map[int64]map[string]string, error) {
+	var rows []metadataRow
+	if err := s.db.SelectContext(ctx, &rows, s.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("listing metadata: %w", err)
+	}
+	result := make(map[int64]map[string]string)
+	for _, row := range rows {
+		if result[row.OwnerID] == nil {
+			result[row.OwnerID] = make(map[string]string)
+		}
+		result[row.OwnerID][row.Key] = row.Value
+	}
+	return result, nil
+}
+
+// set replaces all metadata of an owner. table and column are constants
+// supplied by the callers above.
+func (s *MetadataStore) set(ctx context.Context, table, column string, id int64, meta map[string]string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM `+table+` WHERE `+column+` = ?`), id); err != nil {
+		return fmt.Errorf("clearing metadata: %w", err)
+	}
+	insert := tx.Rebind(`INSERT INTO ` + table + ` (` + column + `, meta_key, meta_value) VALUES (?, ?, ?)`)
+	for key, value := range meta {
+		if _, err := tx.ExecContext(ctx, insert, id, key, value); err != nil {
+			return fmt.Errorf("setting metadata %q: %w", key, err)
+		}
+	}
+
+	return tx.Commit()
+}
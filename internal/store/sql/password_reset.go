@@ -0,0 +1,55 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type PasswordResetStore struct {
+	db *sqlx.DB
+}
+
+func NewPasswordResetStore(db *sqlx.DB) *PasswordResetStore {
+	return &PasswordResetStore{db: db}
+}
+
+func (s *PasswordResetStore) Create(ctx context.Context, reset *database.PasswordReset) error {
+	query := `INSERT INTO password_resets (token_hash, user_id, expires_at) VALUES (?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query),
+		reset.TokenHash, reset.UserID, reset.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("creating password reset: %w", err)
+	}
+	return nil
+}
+
+func (s *PasswordResetStore) GetByTokenHash(ctx context.Context, tokenHash string) (*database.PasswordReset, error) {
+	var reset database.PasswordReset
+	query := `SELECT * FROM password_resets WHERE token_hash = ?`
+	if err := s.db.GetContext(ctx, &reset, s.db.Rebind(query), tokenHash); err != nil {
+		return nil, fmt.Errorf("getting password reset: %w", err)
+	}
+	return &reset, nil
+}
+
+func (s *PasswordResetStore) DeleteByUser(ctx context.Context, userID int64) error {
+	query := `DELETE FROM password_resets WHERE user_id = ?`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), userID)
+	if err != nil {
+		return fmt.Errorf("deleting password resets: %w", err)
+	}
+	return nil
+}
+
+func (s *PasswordResetStore) DeleteExpired(ctx context.Context) error {
+	query := `DELETE FROM password_resets WHERE expires_at < ?`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("deleting expired password resets: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type PreviewStore struct {
+	db *sqlx.DB
+}
+
+func NewPreviewStore(db *sqlx.DB) *PreviewStore {
+	return &PreviewStore{db: db}
+}
+
+func (s *PreviewStore) Create(ctx context.Context, preview *database.Preview) error {
+	if preview.CreatedAt.IsZero() {
+		preview.CreatedAt = time.Now().UTC()
+	}
+	query := `INSERT INTO previews (project_id, name, content_type, uploaded_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(query),
+		preview.ProjectID, preview.Name, preview.ContentType, preview.UploadedBy, preview.CreatedAt, preview.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("creating preview: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	preview.ID = id
+	return nil
+}
+
+func (s *PreviewStore) Get(ctx context.Context, projectID int64, name string) (*database.Preview, error) {
+	var preview database.Preview
+	query := `SELECT * FROM previews WHERE project_id = ? AND name = ?`
+	if err := s.db.GetContext(ctx, &preview, s.db.Rebind(query), projectID, name); err != nil {
+		return nil, fmt.Errorf("getting preview: %w", err)
+	}
+	return &preview, nil
+}
+
+func (s *PreviewStore) ListByProject(ctx context.Context, projectID int64) ([]database.Preview, error) {
+	var previews []database.Preview
+	query := `SELECT * FROM previews WHERE project_id = ? ORDER BY created_at DESC, id DESC`
+	if err := s.db.SelectContext(ctx, &previews, s.db.Rebind(query), projectID); err != nil {
+		return nil, fmt.Errorf("listing previews: %w", err)
+	}
+	return previews, nil
+}
+
+func (s *PreviewStore) ListExpired(ctx context.Context, before time.Time) ([]database.Preview, error) {
+	var previews []database.Preview
+	query := `SELECT * FROM previews WHERE expires_at < ? ORDER BY id`
+	if err := s.db.SelectContext(ctx, &previews, s.db.Rebind(query), before.UTC()); err != nil {
+		return nil, fmt.Errorf("listing expired previews: %w", err)
+	}
+	return previews, nil
+}
+
+func (s *PreviewStore) Update(ctx context.Context, preview *database.Preview) error {
+	query := `UPDATE previews SET content_type = ?, uploaded_by = ?, created_at = ?, expires_at = ? WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query),
+		preview.ContentType, preview.UploadedBy, preview.CreatedAt, preview.ExpiresAt, preview.ID)
+	if err != nil {
+		return fmt.Errorf("updating preview: %w", err)
+	}
+	return nil
+}
+
+func (s *PreviewStore) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM previews WHERE id = ?`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), id); err != nil {
+		return fmt.Errorf("deleting preview: %w", err)
+	}
+	return nil
+}
@@ -3,11 +3,18 @@ package sql
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/store"
 )
 
+// projectColumns lists the columns selected into database.Project.
+const projectColumns = `id, slug, name, description, visibility, retention_days, pinned_version, pin_permanent, require_signature, signing_keys, hide_from_sitemap, index_old_versions, lifecycle, lifecycle_message, owner, owner_team, owner_contact, owner_orphaned, feedback_mode, feedback_url, overlay_include, overlay_exclude, overlay_position, overlay_theme, overlay_color, overlay_visibility, redirects, version_pattern, version_semver_only, normalize_versions, immutable_versions, landing_path, detect_landing, sanitize_html, storage_quota, max_upload_size, created_at, updated_at`
+
 type ProjectStore struct {
 	db *sqlx.DB
 }
@@ -17,9 +24,13 @@ func NewProjectStore(db *sqlx.DB) *ProjectStore {
 }
 
 func (s *ProjectStore) Create(ctx context.Context, project *database.Project) error {
-	query := `INSERT INTO projects (slug, name, description, visibility, retention_days) VALUES (?, ?, ?, ?, ?)`
+	if project.Lifecycle == "" {
+		project.Lifecycle = database.LifecycleActive
+	}
+	query := `INSERT INTO projects (slug, name, description, visibility, retention_days, require_signature, signing_keys, hide_from_sitemap, index_old_versions, lifecycle, lifecycle_message, owner, owner_team, owner_contact, owner_orphaned, feedback_mode, feedback_url, overlay_include, overlay_exclude, overlay_position, overlay_theme, overlay_color, overlay_visibility, redirects, version_pattern, version_semver_only, normalize_versions, immutable_versions, landing_path, detect_landing, sanitize_html, storage_quota, max_upload_size) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	result, err := s.db.ExecContext(ctx, s.db.Rebind(query),
-		project.Slug, project.Name, project.Description, project.Visibility, project.RetentionDays)
+		project.Slug, project.Name, project.Description, project.Visibility, project.RetentionDays, project.RequireSignature, project.SigningKeys, project.HideFromSitemap, project.IndexOldVersions,
+		project.Lifecycle, project.LifecycleMessage, project.Owner, project.OwnerTeam, project.OwnerContact, project.OwnerOrphaned, project.FeedbackMode, project.FeedbackURL, project.OverlayInclude, project.OverlayExclude, project.OverlayPosition, project.OverlayTheme, project.OverlayColor, project.OverlayVisibility, project.Redirects, project.VersionPattern, project.VersionSemverOnly, project.NormalizeVersions, project.ImmutableVersions, project.LandingPath, project.DetectLanding, project.SanitizeHTML, project.StorageQuota, project.MaxUploadSize)
 	if err != nil {
 		return fmt.Errorf("creating project: %w", err)
 	}
@@ -33,7 +44,7 @@ func (s *ProjectStore) Create(ctx context.Context, project *database.Project) er
 
 func (s *ProjectStore) GetBySlug(ctx context.Context, slug string) (*database.Project, error) {
 	var project database.Project
-	query := `SELECT id, slug, name, description, visibility, retention_days, pinned_version, pin_permanent, created_at, updated_at FROM projects WHERE slug = ?`
+	query := `SELECT ` + projectColumns + ` FROM projects WHERE slug = ?`
 	if err := s.db.GetContext(ctx, &project, s.db.Rebind(query), slug); err != nil {
 		return nil, fmt.Errorf("getting project by slug: %w", err)
 	}
@@ -42,7 +53,7 @@ func (s *ProjectStore) GetBySlug(ctx context.Context, slug string) (*database.Pr
 
 func (s *ProjectStore) GetByID(ctx context.Context, id int64) (*database.Project, error) {
 	var project database.Project
-	query := `SELECT id, slug, name, description, visibility, retention_days, pinned_version, pin_permanent, created_at, updated_at FROM projects WHERE id = ?`
+	query := `SELECT ` + projectColumns + ` FROM projects WHERE id = ?`
 	if err := s.db.GetContext(ctx, &project, s.db.Rebind(query), id); err != nil {
 		return nil, fmt.Errorf("getting project by id: %w", err)
 	}
@@ -51,7 +62,7 @@ func (s *ProjectStore) GetByID(ctx context.Context, id int64) (*database.Project
 
 func (s *ProjectStore) List(ctx context.Context) ([]database.Project, error) {
 	var projects []database.Project
-	query := `SELECT id, slug, name, description, visibility, retention_days, pinned_version, pin_permanent, created_at, updated_at FROM projects ORDER BY name`
+	query := `SELECT ` + projectColumns + ` FROM projects ORDER BY name`
 	if err := s.db.SelectContext(ctx, &projects, query); err != nil {
 		return nil, fmt.Errorf("listing projects: %w", err)
 	}
@@ -60,7 +71,7 @@ func (s *ProjectStore) List(ctx context.Context) ([]database.Project, error) {
 
 func (s *ProjectStore) ListByVisibility(ctx context.Context, visibility string) ([]database.Project, error) {
 	var projects []database.Project
-	query := `SELECT id, slug, name, description, visibility, retention_days, pinned_version, pin_permanent, created_at, updated_at FROM projects WHERE visibility = ? ORDER BY name`
+	query := `SELECT ` + projectColumns + ` FROM projects WHERE visibility = ? ORDER BY name`
 	if err := s.db.SelectContext(ctx, &projects, s.db.Rebind(query), visibility); err != nil {
 		return nil, fmt.Errorf("listing projects by visibility: %w", err)
 	}
@@ -69,7 +80,7 @@ func (s *ProjectStore) ListByVisibility(ctx context.Context, visibility string)
 
 func (s *ProjectStore) Search(ctx context.Context, q string) ([]database.Project, error) {
 	var projects []database.Project
-	query := `SELECT id, slug, name, description, visibility, retention_days, pinned_version, pin_permanent, created_at, updated_at FROM projects WHERE name LIKE ? OR slug LIKE ? OR description LIKE ? ORDER BY name`
+	query := `SELECT ` + projectColumns + ` FROM projects WHERE name LIKE ? OR slug LIKE ? OR description LIKE ? ORDER BY name`
 	pattern := "%" + q + "%"
 	if err := s.db.SelectContext(ctx, &projects, s.db.Rebind(query), pattern, pattern, pattern); err != nil {
 		return nil, fmt.Errorf("searching projects: %w", err)
@@ -77,16 +88,114 @@ func (s *ProjectStore) Search(ctx context.Context, q string) ([]database.Project
 	return projects, nil
 }
 
+// projectOrders are the ORDER BY clauses of the sort orders of
+// store.ProjectQuery, ascending and descending.
+var projectOrders = map[string][2]string{
+	store.SortLifecycle: {
+		"CASE lifecycle WHEN 'deprecated' THEN 1 WHEN 'eol' THEN 2 ELSE 0 END, name, id",
+		"CASE lifecycle WHEN 'deprecated' THEN 1 WHEN 'eol' THEN 2 ELSE 0 END DESC, name DESC, id DESC",
+	},
+	store.SortName:    {"name, id", "name DESC, id DESC"},
+	store.SortCreated: {"created_at, name, id", "created_at DESC, name, id"},
+	store.SortUpdated: {"updated_at, name, id", "updated_at DESC, name, id"},
+}
+
+func (s *ProjectStore) ListPage(ctx context.Context, q store.ProjectQuery) ([]database.Project, int, error) {
+	orders, ok := projectOrders[q.Sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown project order %q", q.Sort)
+	}
+	if q.IDs != nil && len(q.IDs) == 0 {
+		return []database.Project{}, 0, nil
+	}
+
+	var where []string
+	var args []any
+	if q.Search != "" {
+		pattern := "%" + q.Search + "%"
+		where = append(where, "(name LIKE ? OR slug LIKE ? OR description LIKE ?)")
+		args = append(args, pattern, pattern, pattern)
+	}
+	if q.Visibility != "" {
+		where = append(where, "visibility = ?")
+		args = append(args, q.Visibility)
+	}
+	if q.Lifecycle != "" {
+		where = append(where, "lifecycle = ?")
+		args = append(args, q.Lifecycle)
+	}
+	if q.Tag != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM project_tags t WHERE t.project_id = projects.id AND t.tag = ?)")
+		args = append(args, q.Tag)
+	}
+	for _, key := range slices.Sorted(maps.Keys(q.Metadata)) {
+		where = append(where, "EXISTS (SELECT 1 FROM project_metadata m WHERE m.project_id = projects.id AND m.meta_key = ? AND m.meta_value = ?)")
+		args = append(args, key, q.Metadata[key])
+	}
+	if q.IDs != nil {
+		where = append(where, "id IN (?)")
+		args = append(args, q.IDs)
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	countQuery, countArgs, err := sqlx.In(`SELECT COUNT(*) FROM projects`+filter, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("counting projects: %w", err)
+	}
+	var total int
+	if err := s.db.GetContext(ctx, &total, s.db.Rebind(countQuery), countArgs...); err != nil {
+		return nil, 0, fmt.Errorf("counting projects: %w", err)
+	}
+
+	order := orders[0]
+	if q.Desc {
+		order = orders[1]
+	}
+	query := `SELECT ` + projectColumns + ` FROM projects` + filter + ` ORDER BY ` + order
+	if q.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, q.Limit, q.Offset)
+	}
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing projects: %w", err)
+	}
+	projects := []database.Project{}
+	if err := s.db.SelectContext(ctx, &projects, s.db.Rebind(query), args...); err != nil {
+		return nil, 0, fmt.Errorf("listing projects: %w", err)
+	}
+	return projects, total, nil
+}
+
 func (s *ProjectStore) Update(ctx context.Context, project *database.Project) error {
-	query := `UPDATE projects SET slug = ?, name = ?, description = ?, visibility = ?, retention_days = ?, pinned_version = ?, pin_permanent = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	query := `UPDATE projects SET slug = ?, name = ?, description = ?, visibility = ?, retention_days = ?, pinned_version = ?, pin_permanent = ?, require_signature = ?, signing_keys = ?, hide_from_sitemap = ?, index_old_versions = ?, lifecycle = ?, lifecycle_message = ?, owner = ?, owner_team = ?, owner_contact = ?, owner_orphaned = ?, feedback_mode = ?, feedback_url = ?, overlay_include = ?, overlay_exclude = ?, overlay_position = ?, overlay_theme = ?, overlay_color = ?, overlay_visibility = ?, redirects = ?, version_pattern = ?, version_semver_only = ?, normalize_versions = ?, immutable_versions = ?, landing_path = ?, detect_landing = ?, sanitize_html = ?, storage_quota = ?, max_upload_size = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if project.Lifecycle == "" {
+		project.Lifecycle = database.LifecycleActive
+	}
 	_, err := s.db.ExecContext(ctx, s.db.Rebind(query),
-		project.Slug, project.Name, project.Description, project.Visibility, project.RetentionDays, project.PinnedVersion, project.PinPermanent, project.ID)
+		project.Slug, project.Name, project.Description, project.Visibility, project.RetentionDays, project.PinnedVersion, project.PinPermanent,
+		project.RequireSignature, project.SigningKeys, project.HideFromSitemap, project.IndexOldVersions, project.Lifecycle, project.LifecycleMessage,
+		project.Owner, project.OwnerTeam, project.OwnerContact, project.OwnerOrphaned, project.FeedbackMode, project.FeedbackURL, project.OverlayInclude, project.OverlayExclude, project.OverlayPosition, project.OverlayTheme, project.OverlayColor, project.OverlayVisibility, project.Redirects, project.VersionPattern, project.VersionSemverOnly, project.NormalizeVersions, project.ImmutableVersions, project.LandingPath, project.DetectLanding, project.SanitizeHTML, project.StorageQuota, project.MaxUploadSize, project.ID)
 	if err != nil {
 		return fmt.Errorf("updating project: %w", err)
 	}
 	return nil
 }
 
+// SetOwnerOrphaned records the result of an owner check without touching
+// updated_at.
+func (s *ProjectStore) SetOwnerOrphaned(ctx context.Context, id int64, orphaned bool) error {
+	query := `UPDATE projects SET owner_orphaned = ? WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), orphaned, id)
+	if err != nil {
+		return fmt.Errorf("setting project owner status: %w", err)
+	}
+	return nil
+}
+
 func (s *ProjectStore) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM projects WHERE id = ?`
 	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), id)
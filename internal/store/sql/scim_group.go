@@ -0,0 +1,106 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type SCIMGroupStore struct {
+	db *sqlx.DB
+}
+
+func NewSCIMGroupStore(db *sqlx.DB) *SCIMGroupStore {
+	return &SCIMGroupStore{db: db}
+}
+
+func (s *SCIMGroupStore) Create(ctx context.Context, group *database.SCIMGroup) error {
+	query := `INSERT INTO scim_groups (display_name, external_id) VALUES (?, ?)`
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(query), group.DisplayName, group.ExternalID)
+	if err != nil {
+		return fmt.Errorf("creating SCIM group: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	group.ID = id
+	return nil
+}
+
+func (s *SCIMGroupStore) GetByID(ctx context.Context, id int64) (*database.SCIMGroup, error) {
+	var group database.SCIMGroup
+	query := `SELECT * FROM scim_groups WHERE id = ?`
+	if err := s.db.GetContext(ctx, &group, s.db.Rebind(query), id); err != nil {
+		return nil, fmt.Errorf("getting SCIM group: %w", err)
+	}
+	return &group, nil
+}
+
+func (s *SCIMGroupStore) List(ctx context.Context) ([]database.SCIMGroup, error) {
+	var groups []database.SCIMGroup
+	query := `SELECT * FROM scim_groups ORDER BY display_name`
+	if err := s.db.SelectContext(ctx, &groups, query); err != nil {
+		return nil, fmt.Errorf("listing SCIM groups: %w", err)
+	}
+	return groups, nil
+}
+
+func (s *SCIMGroupStore) Update(ctx context.Context, group *database.SCIMGroup) error {
+	query := `UPDATE scim_groups SET display_name = ?, external_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), group.DisplayName, group.ExternalID, group.ID); err != nil {
+		return fmt.Errorf("updating SCIM group: %w", err)
+	}
+	return nil
+}
+
+func (s *SCIMGroupStore) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM scim_groups WHERE id = ?`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), id); err != nil {
+		return fmt.Errorf("deleting SCIM group: %w", err)
+	}
+	return nil
+}
+
+func (s *SCIMGroupStore) ListMembers(ctx context.Context, groupID int64) ([]int64, error) {
+	var userIDs []int64
+	query := `SELECT user_id FROM scim_group_members WHERE group_id = ? ORDER BY user_id`
+	if err := s.db.SelectContext(ctx, &userIDs, s.db.Rebind(query), groupID); err != nil {
+		return nil, fmt.Errorf("listing SCIM group members: %w", err)
+	}
+	return userIDs, nil
+}
+
+func (s *SCIMGroupStore) SetMembers(ctx context.Context, groupID int64, userIDs []int64) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM scim_group_members WHERE group_id = ?`), groupID); err != nil {
+		return fmt.Errorf("clearing SCIM group members: %w", err)
+	}
+	insert := tx.Rebind(`INSERT INTO scim_group_members (group_id, user_id) VALUES (?, ?)`)
+	for _, userID := range userIDs {
+		if _, err := tx.ExecContext(ctx, insert, groupID, userID); err != nil {
+			return fmt.Errorf("adding SCIM group member %d: %w", userID, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`UPDATE scim_groups SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`), groupID); err != nil {
+		return fmt.Errorf("updating SCIM group: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (s *SCIMGroupStore) ListByUser(ctx context.Context, userID int64) ([]database.SCIMGroup, error) {
+	var groups []database.SCIMGroup
+	query := `SELECT g.* FROM scim_groups g JOIN scim_group_members m ON m.group_id = g.id WHERE m.user_id = ? ORDER BY g.display_name`
+	if err := s.db.SelectContext(ctx, &groups, s.db.Rebind(query), userID); err != nil {
+		return nil, fmt.Errorf("listing SCIM groups of user: %w", err)
+	}
+	return groups, nil
+}
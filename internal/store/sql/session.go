@@ -18,9 +18,13 @@ func NewSessionStore(db *sqlx.DB) *SessionStore {
 }
 
 func (s *SessionStore) Create(ctx context.Context, session *database.Session) error {
-	query := `INSERT INTO sessions (id, user_id, expires_at) VALUES (?, ?, ?)`
+	if session.LastSeenAt.IsZero() {
+		session.LastSeenAt = time.Now().UTC()
+	}
+	query := `INSERT INTO sessions (id, user_id, expires_at, user_agent, ip_address, last_seen_at, remember_hash, remember_until) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
 	_, err := s.db.ExecContext(ctx, s.db.Rebind(query),
-		session.ID, session.UserID, session.ExpiresAt)
+		session.ID, session.UserID, session.ExpiresAt, session.UserAgent, session.IPAddress, session.LastSeenAt,
+		session.RememberHash, session.RememberUntil)
 	if err != nil {
 		return fmt.Errorf("creating session: %w", err)
 	}
@@ -36,6 +40,43 @@ func (s *SessionStore) GetByID(ctx context.Context, id string) (*database.Sessio
 	return &session, nil
 }
 
+func (s *SessionStore) GetByRememberHash(ctx context.Context, rememberHash string) (*database.Session, error) {
+	var session database.Session
+	query := `SELECT * FROM sessions WHERE remember_hash = ? AND remember_hash <> ''`
+	if err := s.db.GetContext(ctx, &session, s.db.Rebind(query), rememberHash); err != nil {
+		return nil, fmt.Errorf("getting session by remember token: %w", err)
+	}
+	return &session, nil
+}
+
+func (s *SessionStore) List(ctx context.Context) ([]database.Session, error) {
+	var sessions []database.Session
+	now := time.Now().UTC()
+	query := `SELECT * FROM sessions WHERE expires_at >= ? OR remember_until >= ? ORDER BY last_seen_at DESC`
+	if err := s.db.SelectContext(ctx, &sessions, s.db.Rebind(query), now, now); err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (s *SessionStore) ListByUser(ctx context.Context, userID int64) ([]database.Session, error) {
+	var sessions []database.Session
+	now := time.Now().UTC()
+	query := `SELECT * FROM sessions WHERE user_id = ? AND (expires_at >= ? OR remember_until >= ?) ORDER BY last_seen_at DESC`
+	if err := s.db.SelectContext(ctx, &sessions, s.db.Rebind(query), userID, now, now); err != nil {
+		return nil, fmt.Errorf("listing sessions of user: %w", err)
+	}
+	return sessions, nil
+}
+
+func (s *SessionStore) Touch(ctx context.Context, id string, lastSeen, expiresAt time.Time) error {
+	query := `UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE id = ?`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), lastSeen.UTC(), expiresAt.UTC(), id); err != nil {
+		return fmt.Errorf("touching session: %w", err)
+	}
+	return nil
+}
+
 func (s *SessionStore) Delete(ctx context.Context, id string) error {
 	query := `DELETE FROM sessions WHERE id = ?`
 	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), id)
@@ -45,11 +86,29 @@ func (s *SessionStore) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+func (s *SessionStore) DeleteByUser(ctx context.Context, userID int64) error {
+	query := `DELETE FROM sessions WHERE user_id = ?`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), userID)
+	if err != nil {
+		return fmt.Errorf("deleting sessions of user: %w", err)
+	}
+	return nil
+}
+
 func (s *SessionStore) DeleteExpired(ctx context.Context) error {
-	query := `DELETE FROM sessions WHERE expires_at < ?`
-	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), time.Now().UTC())
+	now := time.Now().UTC()
+	query := `DELETE FROM sessions WHERE expires_at < ? AND (remember_until IS NULL OR remember_until < ?)`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), now, now)
 	if err != nil {
 		return fmt.Errorf("deleting expired sessions: %w", err)
 	}
 	return nil
 }
+
+func (s *SessionStore) DeleteIdle(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM sessions WHERE last_seen_at < ? AND (remember_until IS NULL OR remember_until < ?)`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), before.UTC(), time.Now().UTC()); err != nil {
+		return fmt.Errorf("deleting idle sessions: %w", err)
+	}
+	return nil
+}
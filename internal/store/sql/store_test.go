@@ -2,10 +2,12 @@ package sql
 
 import (
 	"context"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/store"
 	"github.com/qwc/asiakirjat/internal/testutil"
 )
 
@@ -161,6 +163,30 @@ func TestVersionStoreCRUD(t *testing.T) {
 	if got.StoragePath != "/data/proj/v1.0.0" {
 		t.Errorf("expected storage path, got %q", got.StoragePath)
 	}
+	if got.Protected {
+		t.Error("expected new version to be unprotected")
+	}
+
+	// SetProtected
+	if err := vStore.SetProtected(ctx, version.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = vStore.GetByProjectAndTag(ctx, project.ID, "v1.0.0")
+	if !got.Protected {
+		t.Error("expected version to be protected")
+	}
+	if got.Lifecycle != database.LifecycleActive {
+		t.Errorf("expected new version to be active, got %q", got.Lifecycle)
+	}
+
+	// SetLifecycle
+	if err := vStore.SetLifecycle(ctx, version.ID, database.LifecycleEOL, "Use v2"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = vStore.GetByProjectAndTag(ctx, project.ID, "v1.0.0")
+	if got.Lifecycle != database.LifecycleEOL || got.LifecycleMessage != "Use v2" {
+		t.Errorf("expected eol lifecycle with message, got %q %q", got.Lifecycle, got.LifecycleMessage)
+	}
 
 	// ListByProject
 	list, err := vStore.ListByProject(ctx, project.ID)
@@ -471,6 +497,19 @@ func TestTokenStoreCRUD(t *testing.T) {
 		t.Errorf("expected 1 token, got %d", len(tokens))
 	}
 
+	// SetExpiresAt and List
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	if err := tStore.SetExpiresAt(ctx, token.ID, &expiry); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err = tStore.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].ExpiresAt == nil || !tokens[0].ExpiresAt.Equal(expiry) {
+		t.Errorf("expected the token to expire at %v, got %+v", expiry, tokens)
+	}
+
 	// Delete
 	if err := tStore.Delete(ctx, token.ID); err != nil {
 		t.Fatal(err)
@@ -726,3 +765,638 @@ func TestProjectStorePinnedVersion(t *testing.T) {
 		t.Error("expected PinPermanent to be false after clearing")
 	}
 }
+
+func TestAttachmentStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	store := NewAttachmentStore(db)
+	pStore := NewProjectStore(db)
+	vStore := NewVersionStore(db)
+	uStore := NewUserStore(db)
+	ctx := context.Background()
+
+	project := &database.Project{Slug: "test-proj", Name: "Test", Visibility: database.VisibilityPublic}
+	pStore.Create(ctx, project)
+	hash := "fakehash"
+	user := &database.User{Username: "uploader", Password: &hash, AuthSource: "builtin", Role: "editor"}
+	uStore.Create(ctx, user)
+	version := &database.Version{ProjectID: project.ID, Tag: "v1.0.0", StoragePath: "/tmp", ContentType: "archive", UploadedBy: user.ID}
+	if err := vStore.Create(ctx, version); err != nil {
+		t.Fatal(err)
+	}
+
+	sbom := &database.VersionAttachment{VersionID: version.ID, Kind: database.AttachmentSBOM, Filename: "sbom.json", Size: 10, SHA256: "abc"}
+	if err := store.Upsert(ctx, sbom); err != nil {
+		t.Fatal(err)
+	}
+	provenance := &database.VersionAttachment{VersionID: version.ID, Kind: database.AttachmentProvenance, Filename: "prov.intoto.jsonl", Size: 20}
+	if err := store.Upsert(ctx, provenance); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upsert replaces the existing attachment of the same kind
+	replacement := &database.VersionAttachment{VersionID: version.ID, Kind: database.AttachmentSBOM, Filename: "bom.xml", Size: 30}
+	if err := store.Upsert(ctx, replacement); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.GetByVersionAndKind(ctx, version.ID, database.AttachmentSBOM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Filename != "bom.xml" || got.Size != 30 {
+		t.Errorf("expected replaced sbom, got %+v", got)
+	}
+
+	list, err := store.ListByVersion(ctx, version.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Errorf("expected 2 attachments, got %d", len(list))
+	}
+
+	byProject, err := store.ListByProject(ctx, project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byProject) != 2 {
+		t.Errorf("expected 2 project attachments, got %d", len(byProject))
+	}
+
+	if err := store.DeleteByVersion(ctx, version.ID); err != nil {
+		t.Fatal(err)
+	}
+	list, _ = store.ListByVersion(ctx, version.ID)
+	if len(list) != 0 {
+		t.Errorf("expected no attachments after delete, got %d", len(list))
+	}
+}
+
+func TestAuditLogStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	store := NewAuditLogStore(db)
+	ctx := context.Background()
+
+	for _, action := range []string{"retention.prune", "retention.dry_run", "retention.prune"} {
+		if err := store.Create(ctx, &database.AuditEntry{Action: action, Actor: "system", Details: "details"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := store.List(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].ID < entries[1].ID {
+		t.Error("expected newest entry first")
+	}
+}
+
+func TestFeedbackStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	projects := NewProjectStore(db)
+	store := NewFeedbackStore(db)
+	ctx := context.Background()
+
+	project := &database.Project{Slug: "fb", Name: "Feedback", Visibility: database.VisibilityPublic, FeedbackMode: database.FeedbackInternal}
+	if err := projects.Create(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := projects.GetByID(ctx, project.ID); got.FeedbackMode != database.FeedbackInternal {
+		t.Errorf("expected feedback mode to be stored, got %q", got.FeedbackMode)
+	}
+
+	for _, message := range []string{"Typo", "Broken link"} {
+		if err := store.Create(ctx, &database.Feedback{ProjectID: project.ID, VersionTag: "1.0", PageURL: "/project/fb/1.0/", Message: message}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := store.ListByProject(ctx, project.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Message != "Broken link" {
+		t.Fatalf("expected newest feedback first, got %+v", list)
+	}
+
+	if err := store.Delete(ctx, project.ID+1, list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ = store.ListByProject(ctx, project.ID, 10); len(list) != 2 {
+		t.Error("expected delete to be limited to the project")
+	}
+	store.Delete(ctx, project.ID, list[0].ID)
+	if list, _ = store.ListByProject(ctx, project.ID, 10); len(list) != 1 {
+		t.Errorf("expected 1 report after delete, got %d", len(list))
+	}
+}
+
+func TestAPIKeyStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	store := NewAPIKeyStore(db)
+	ctx := context.Background()
+
+	key := &database.APIKey{Name: "status-page", KeyHash: "hash1", Quota: 100, CreatedBy: "admin"}
+	if err := store.Create(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(ctx, &database.APIKey{Name: "duplicate", KeyHash: "hash1"}); err == nil {
+		t.Error("expected an error for a duplicate key hash")
+	}
+
+	got, err := store.GetByHash(ctx, "hash1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != key.ID || got.Quota != 100 || got.CreatedBy != "admin" {
+		t.Errorf("unexpected key %+v", got)
+	}
+
+	if err := store.Delete(ctx, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := store.List(ctx); len(keys) != 0 {
+		t.Errorf("expected no keys after delete, got %d", len(keys))
+	}
+}
+
+func TestEventStoreListAfter(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	store := NewEventStore(db)
+	ctx := context.Background()
+
+	var ids []int64
+	for _, typ := range []string{database.EventProjectCreated, database.EventVersionPublished, database.EventVersionDeleted} {
+		event := &database.Event{Type: typ, Project: "proj"}
+		if err := store.Create(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, event.ID)
+	}
+
+	events, err := store.ListAfter(ctx, ids[0], 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].ID != ids[1] || events[1].ID != ids[2] {
+		t.Fatalf("expected events after the cursor in order, got %+v", events)
+	}
+	if events[0].Payload != "{}" {
+		t.Errorf("expected empty JSON payload, got %q", events[0].Payload)
+	}
+
+	events, _ = store.ListAfter(ctx, 0, 1)
+	if len(events) != 1 || events[0].Type != database.EventProjectCreated {
+		t.Errorf("expected limit to apply, got %+v", events)
+	}
+}
+
+func TestMetadataStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	pStore := NewProjectStore(db)
+	vStore := NewVersionStore(db)
+	uStore := NewUserStore(db)
+	store := NewMetadataStore(db)
+	ctx := context.Background()
+
+	user := &database.User{Username: "meta-user", AuthSource: "builtin", Role: "admin"}
+	uStore.Create(ctx, user)
+	project := &database.Project{Slug: "meta", Name: "Meta"}
+	if err := pStore.Create(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	version := &database.Version{ProjectID: project.ID, Tag: "v1.0.0", StoragePath: "/tmp/x", UploadedBy: user.ID}
+	if err := vStore.Create(ctx, version); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SetProject(ctx, project.ID, map[string]string{"team": "platform", "lifecycle": "production"}); err != nil {
+		t.Fatal(err)
+	}
+	// Set replaces all existing keys
+	if err := store.SetProject(ctx, project.ID, map[string]string{"team": "core"}); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := store.GetProject(ctx, project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta) != 1 || meta["team"] != "core" {
+		t.Errorf("expected replaced metadata, got %v", meta)
+	}
+
+	all, err := store.ListProjects(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all[project.ID]["team"] != "core" {
+		t.Errorf("expected project in list, got %v", all)
+	}
+
+	if err := store.SetVersion(ctx, version.ID, map[string]string{"component-id": "svc-42"}); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := store.ListVersionsByProject(ctx, project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versions[version.ID]["component-id"] != "svc-42" {
+		t.Errorf("expected version metadata, got %v", versions)
+	}
+
+	empty, err := store.GetVersion(ctx, version.ID+100)
+	if err != nil || len(empty) != 0 {
+		t.Errorf("expected empty metadata for unknown version, got %v, %v", empty, err)
+	}
+}
+
+func TestTagStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	pStore := NewProjectStore(db)
+	store := NewTagStore(db)
+	ctx := context.Background()
+
+	project := &database.Project{Slug: "tagged", Name: "Tagged"}
+	if err := pStore.Create(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	other := &database.Project{Slug: "other", Name: "Other"}
+	if err := pStore.Create(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Set(ctx, project.ID, []string{"sdk", "go", "api"}); err != nil {
+		t.Fatal(err)
+	}
+	// Set replaces all existing tags
+	if err := store.Set(ctx, project.ID, []string{"sdk", "go"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(ctx, other.ID, []string{"sdk"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := store.Get(ctx, project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tags, []string{"go", "sdk"}) {
+		t.Errorf("expected sorted, replaced tags, got %v", tags)
+	}
+
+	all, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || !slices.Equal(all[other.ID], []string{"sdk"}) {
+		t.Errorf("expected tags of both projects, got %v", all)
+	}
+
+	if err := pStore.Delete(ctx, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	empty, err := store.Get(ctx, other.ID)
+	if err != nil || len(empty) != 0 {
+		t.Errorf("expected tags removed with the project, got %v, %v", empty, err)
+	}
+}
+
+func TestTranslationStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	pStore := NewProjectStore(db)
+	store := NewTranslationStore(db)
+	ctx := context.Background()
+
+	project := &database.Project{Slug: "bilingual", Name: "Bilingual"}
+	if err := pStore.Create(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Set(ctx, project.ID, []database.ProjectTranslation{
+		{Locale: "fi", Name: "Kaksikielinen", Description: "Kuvaus"},
+		{Locale: "de", Name: "Zweisprachig"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Set replaces all existing translations
+	if err := store.Set(ctx, project.ID, []database.ProjectTranslation{
+		{Locale: "sv", Name: "Tvåspråkig"},
+		{Locale: "fi", Name: "Kaksikielinen", Description: "Kuvaus"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	translations, err := store.Get(ctx, project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(translations) != 2 || translations[0].Locale != "fi" || translations[0].Description != "Kuvaus" || translations[1].Name != "Tvåspråkig" {
+		t.Errorf("expected sorted, replaced translations, got %+v", translations)
+	}
+
+	all, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || len(all[project.ID]) != 2 {
+		t.Errorf("expected translations of the project, got %+v", all)
+	}
+
+	if err := pStore.Delete(ctx, project.ID); err != nil {
+		t.Fatal(err)
+	}
+	empty, err := store.Get(ctx, project.ID)
+	if err != nil || len(empty) != 0 {
+		t.Errorf("expected translations removed with the project, got %v, %v", empty, err)
+	}
+}
+
+func TestFeatureFlagStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	pStore := NewProjectStore(db)
+	store := NewFeatureFlagStore(db)
+	ctx := context.Background()
+
+	project := &database.Project{Slug: "flagged", Name: "Flagged"}
+	if err := pStore.Create(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, flag := range []database.FeatureFlag{
+		{Name: "export", Enabled: true},
+		{Name: "export", Enabled: false}, // replaces the first
+		{ProjectID: project.ID, Name: "export", Enabled: true},
+		{ProjectID: project.ID, Name: "search_suggest", Enabled: false},
+	} {
+		if err := store.Set(ctx, flag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Delete(ctx, project.ID, "search_suggest"); err != nil {
+		t.Fatal(err)
+	}
+
+	flags, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []database.FeatureFlag{
+		{Name: "export", Enabled: false},
+		{ProjectID: project.ID, Name: "export", Enabled: true},
+	}
+	if !slices.Equal(flags, want) {
+		t.Errorf("expected %+v, got %+v", want, flags)
+	}
+
+	if err := pStore.Delete(ctx, project.ID); err != nil {
+		t.Fatal(err)
+	}
+	flags, err = store.List(ctx)
+	if err != nil || len(flags) != 1 {
+		t.Errorf("expected project flags removed with the project, got %+v, %v", flags, err)
+	}
+}
+
+func TestVersionRedirectStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	pStore := NewProjectStore(db)
+	store := NewVersionRedirectStore(db)
+	ctx := context.Background()
+
+	project := &database.Project{Slug: "renamed", Name: "Renamed"}
+	if err := pStore.Create(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get(ctx, project.ID, "1.0"); err == nil {
+		t.Error("expected no redirect before a rename")
+	}
+
+	// 1.0 -> 1.0.0 -> 2.0.0, then 2.0.0 is renamed back to 1.0.
+	for _, rename := range [][2]string{{"1.0", "1.0.0"}, {"1.0.0", "2.0.0"}, {"2.0.0", "1.0"}} {
+		if err := store.Set(ctx, project.ID, rename[0], rename[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	redirects, err := store.ListByProject(ctx, project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"1.0.0": "1.0", "2.0.0": "1.0"}
+	if len(redirects) != len(want) || redirects["1.0.0"] != "1.0" || redirects["2.0.0"] != "1.0" {
+		t.Errorf("expected %v, got %v", want, redirects)
+	}
+}
+
+func TestPreviewStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	pStore := NewProjectStore(db)
+	store := NewPreviewStore(db)
+	ctx := context.Background()
+
+	project := &database.Project{Slug: "reviewed", Name: "Reviewed"}
+	if err := pStore.Create(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, name := range []string{"pr-1", "pr-2"} {
+		preview := &database.Preview{ProjectID: project.ID, Name: name, ContentType: "archive", UploadedBy: 1, ExpiresAt: now.Add(time.Hour)}
+		if err := store.Create(ctx, preview); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Create(ctx, &database.Preview{ProjectID: project.ID, Name: "pr-1", ExpiresAt: now}); err == nil {
+		t.Error("expected an error creating a preview twice")
+	}
+
+	preview, err := store.Get(ctx, project.ID, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview.ExpiresAt = now.Add(-time.Hour)
+	if err := store.Update(ctx, preview); err != nil {
+		t.Fatal(err)
+	}
+	expired, err := store.ListExpired(ctx, now)
+	if err != nil || len(expired) != 1 || expired[0].Name != "pr-1" {
+		t.Errorf("expected pr-1 to be expired, got %+v, %v", expired, err)
+	}
+
+	if err := store.Delete(ctx, preview.ID); err != nil {
+		t.Fatal(err)
+	}
+	previews, err := store.ListByProject(ctx, project.ID)
+	if err != nil || len(previews) != 1 || previews[0].Name != "pr-2" {
+		t.Errorf("expected only pr-2, got %+v, %v", previews, err)
+	}
+}
+
+func TestAnalyticsStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	pStore := NewProjectStore(db)
+	uStore := NewUserStore(db)
+	store := NewAnalyticsStore(db)
+	ctx := context.Background()
+
+	project := &database.Project{Slug: "counted", Name: "Counted"}
+	if err := pStore.Create(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	pwd := "test"
+	user := &database.User{Username: "reader", Password: &pwd, AuthSource: "builtin"}
+	if err := uStore.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	hits := []database.PageHit{
+		{Version: "1.0", Path: "guide/", Status: 200, UserID: &user.ID},
+		{Version: "2.0", Path: "guide/", Status: 200, UserID: &user.ID},
+		{Version: "2.0", Path: "guide/", Status: 304},
+		{Version: "2.0", Path: "", Status: 200},
+		{Version: "2.0", Path: "img/missing.png", Status: 404},
+		{Version: "2.0", Path: "old.html", Status: 200, ViewedAt: now.AddDate(0, 0, -40)},
+	}
+	for i := range hits {
+		hits[i].ProjectID = project.ID
+		if err := store.Record(ctx, &hits[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	since := now.AddDate(0, 0, -30)
+	top, err := store.TopPages(ctx, project.ID, since, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0].Path != "guide/" || top[0].Hits != 3 || top[0].Readers != 1 || top[1].Path != "" {
+		t.Errorf("unexpected top pages %+v", top)
+	}
+
+	missing, err := store.NotFound(ctx, project.ID, since, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0].Version != "2.0" || missing[0].Path != "img/missing.png" {
+		t.Errorf("unexpected missing pages %+v", missing)
+	}
+
+	versions, err := store.Versions(ctx, project.ID, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Version != "2.0" || versions[0].Hits != 3 || versions[1].Hits != 1 {
+		t.Errorf("unexpected versions %+v", versions)
+	}
+
+	deleted, err := store.DeleteBefore(ctx, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected the old hit to be deleted, deleted %d", deleted)
+	}
+}
+
+func TestProjectStoreListPage(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	projects := NewProjectStore(db)
+	tags := NewTagStore(db)
+	metadata := NewMetadataStore(db)
+	ctx := context.Background()
+
+	var ids []int64
+	for _, p := range []database.Project{
+		{Slug: "delta", Name: "Delta", Visibility: database.VisibilityPublic, Lifecycle: database.LifecycleDeprecated},
+		{Slug: "alpha", Name: "Alpha", Visibility: database.VisibilityPublic},
+		{Slug: "charlie", Name: "Charlie", Visibility: database.VisibilityPrivate, Description: "internal tooling"},
+		{Slug: "bravo", Name: "Bravo", Visibility: database.VisibilityPublic},
+	} {
+		if err := projects.Create(ctx, &p); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, p.ID)
+	}
+	tags.Set(ctx, ids[1], []string{"go"})
+	tags.Set(ctx, ids[3], []string{"go", "cli"})
+	metadata.SetProject(ctx, ids[3], map[string]string{"team": "platform"})
+
+	slugs := func(q store.ProjectQuery) ([]string, int) {
+		t.Helper()
+		page, total, err := projects.ListPage(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []string
+		for _, p := range page {
+			result = append(result, p.Slug)
+		}
+		return result, total
+	}
+
+	for _, tc := range []struct {
+		q     store.ProjectQuery
+		want  []string
+		total int
+	}{
+		{store.ProjectQuery{}, []string{"alpha", "bravo", "charlie", "delta"}, 4},
+		{store.ProjectQuery{Sort: store.SortName, Desc: true}, []string{"delta", "charlie", "bravo", "alpha"}, 4},
+		{store.ProjectQuery{Limit: 2, Offset: 1}, []string{"bravo", "charlie"}, 4},
+		{store.ProjectQuery{Visibility: database.VisibilityPublic, Limit: 2, Offset: 2}, []string{"delta"}, 3},
+		{store.ProjectQuery{Tag: "go"}, []string{"alpha", "bravo"}, 2},
+		{store.ProjectQuery{Tag: "go", Metadata: map[string]string{"team": "platform"}}, []string{"bravo"}, 1},
+		{store.ProjectQuery{Search: "tooling"}, []string{"charlie"}, 1},
+		{store.ProjectQuery{Lifecycle: database.LifecycleDeprecated}, []string{"delta"}, 1},
+		{store.ProjectQuery{IDs: []int64{ids[0], ids[2]}}, []string{"charlie", "delta"}, 2},
+		{store.ProjectQuery{IDs: []int64{}}, nil, 0},
+	} {
+		got, total := slugs(tc.q)
+		if !slices.Equal(got, tc.want) || total != tc.total {
+			t.Errorf("%+v: expected %v of %d, got %v of %d", tc.q, tc.want, tc.total, got, total)
+		}
+	}
+
+	if _, _, err := projects.ListPage(ctx, store.ProjectQuery{Sort: "size"}); err == nil {
+		t.Error("expected an unknown order to be refused")
+	}
+}
+
+func TestJobLockStore(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	locks := NewJobLockStore(db)
+	ctx := context.Background()
+	slot := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	expires := time.Now().Add(time.Hour)
+
+	if ok, err := locks.Acquire(ctx, "retention", "a", slot, expires); err != nil || !ok {
+		t.Fatalf("expected the first server to get the lock, got %v %v", ok, err)
+	}
+	if ok, _ := locks.Acquire(ctx, "retention", "b", slot, expires); ok {
+		t.Error("expected the lock to be held")
+	}
+	if ok, _ := locks.Acquire(ctx, "index_verify", "b", slot, expires); !ok {
+		t.Error("expected the lock of another job to be free")
+	}
+
+	if err := locks.Release(ctx, "retention", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := locks.Acquire(ctx, "retention", "b", slot, expires); ok {
+		t.Error("expected the slot to run once")
+	}
+	if ok, _ := locks.Acquire(ctx, "retention", "b", slot.Add(time.Hour), expires); !ok {
+		t.Error("expected the next slot to run")
+	}
+
+	// An expired lock of a server that stopped is taken over
+	if err := locks.Extend(ctx, "retention", "b", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := locks.Acquire(ctx, "retention", "a", slot.Add(2*time.Hour), expires); !ok {
+		t.Error("expected the expired lock to be taken over")
+	}
+}
@@ -0,0 +1,68 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type TagStore struct {
+	db *sqlx.DB
+}
+
+func NewTagStore(db *sqlx.DB) *TagStore {
+	return &TagStore{db: db}
+}
+
+type tagRow struct {
+	ProjectID int64  `db:"project_id"`
+	Tag       string `db:"tag"`
+}
+
+func (s *TagStore) Get(ctx context.Context, projectID int64) ([]string, error) {
+	all, err := s.list(ctx, `SELECT project_id, tag FROM project_tags WHERE project_id = ? ORDER BY tag`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if tags, ok := all[projectID]; ok {
+		return tags, nil
+	}
+	return []string{}, nil
+}
+
+func (s *TagStore) List(ctx context.Context) (map[int64][]string, error) {
+	return s.list(ctx, `SELECT project_id, tag FROM project_tags ORDER BY tag`)
+}
+
+func (s *TagStore) list(ctx context.Context, query string, args ...any) (map[int64][]string, error) {
+	var rows []tagRow
+	if err := s.db.SelectContext(ctx, &rows, s.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("listing tags: %w", err)
+	}
+	result := make(map[int64][]string)
+	for _, row := range rows {
+		result[row.ProjectID] = append(result[row.ProjectID], row.Tag)
+	}
+	return result, nil
+}
+
+func (s *TagStore) Set(ctx context.Context, projectID int64, tags []string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM project_tags WHERE project_id = ?`), projectID); err != nil {
+		return fmt.Errorf("clearing tags: %w", err)
+	}
+	insert := tx.Rebind(`INSERT INTO project_tags (project_id, tag) VALUES (?, ?)`)
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, insert, projectID, tag); err != nil {
+			return fmt.Errorf("setting tag %q: %w", tag, err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -3,6 +3,7 @@ package sql
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/qwc/asiakirjat/internal/database"
@@ -67,6 +68,25 @@ func (s *TokenStore) ListByProject(ctx context.Context, projectID int64) ([]data
 	return tokens, nil
 }
 
+// List returns all tokens, oldest first.
+func (s *TokenStore) List(ctx context.Context) ([]database.APIToken, error) {
+	var tokens []database.APIToken
+	query := `SELECT * FROM api_tokens ORDER BY created_at, id`
+	if err := s.db.SelectContext(ctx, &tokens, query); err != nil {
+		return nil, fmt.Errorf("listing tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// SetExpiresAt sets the expiry of a token; nil never expires.
+func (s *TokenStore) SetExpiresAt(ctx context.Context, id int64, expiresAt *time.Time) error {
+	query := `UPDATE api_tokens SET expires_at = ? WHERE id = ?`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), expiresAt, id); err != nil {
+		return fmt.Errorf("setting token expiry: %w", err)
+	}
+	return nil
+}
+
 func (s *TokenStore) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM api_tokens WHERE id = ?`
 	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), id)
@@ -75,3 +95,12 @@ func (s *TokenStore) Delete(ctx context.Context, id int64) error {
 	}
 	return nil
 }
+
+func (s *TokenStore) DeleteByUser(ctx context.Context, userID int64) error {
+	query := `DELETE FROM api_tokens WHERE user_id = ?`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), userID)
+	if err != nil {
+		return fmt.Errorf("deleting tokens of user: %w", err)
+	}
+	return nil
+}
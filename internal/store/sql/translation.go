@@ -0,0 +1,64 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type TranslationStore struct {
+	db *sqlx.DB
+}
+
+func NewTranslationStore(db *sqlx.DB) *TranslationStore {
+	return &TranslationStore{db: db}
+}
+
+func (s *TranslationStore) Get(ctx context.Context, projectID int64) ([]database.ProjectTranslation, error) {
+	all, err := s.list(ctx, `SELECT project_id, locale, name, description FROM project_translations WHERE project_id = ? ORDER BY locale`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if translations, ok := all[projectID]; ok {
+		return translations, nil
+	}
+	return []database.ProjectTranslation{}, nil
+}
+
+func (s *TranslationStore) List(ctx context.Context) (map[int64][]database.ProjectTranslation, error) {
+	return s.list(ctx, `SELECT project_id, locale, name, description FROM project_translations ORDER BY locale`)
+}
+
+func (s *TranslationStore) list(ctx context.Context, query string, args ...any) (map[int64][]database.ProjectTranslation, error) {
+	var rows []database.ProjectTranslation
+	if err := s.db.SelectContext(ctx, &rows, s.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("listing translations: %w", err)
+	}
+	result := make(map[int64][]database.ProjectTranslation)
+	for _, row := range rows {
+		result[row.ProjectID] = append(result[row.ProjectID], row)
+	}
+	return result, nil
+}
+
+func (s *TranslationStore) Set(ctx context.Context, projectID int64, translations []database.ProjectTranslation) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM project_translations WHERE project_id = ?`), projectID); err != nil {
+		return fmt.Errorf("clearing translations: %w", err)
+	}
+	insert := tx.Rebind(`INSERT INTO project_translations (project_id, locale, name, description) VALUES (?, ?, ?, ?)`)
+	for _, t := range translations {
+		if _, err := tx.ExecContext(ctx, insert, projectID, t.Locale, t.Name, t.Description); err != nil {
+			return fmt.Errorf("setting translation %q: %w", t.Locale, err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -17,9 +17,9 @@ func NewUserStore(db *sqlx.DB) *UserStore {
 }
 
 func (s *UserStore) Create(ctx context.Context, user *database.User) error {
-	query := `INSERT INTO users (username, email, password, auth_source, role, is_robot) VALUES (?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO users (username, email, password, auth_source, role, is_robot, theme, deactivated) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
 	result, err := s.db.ExecContext(ctx, s.db.Rebind(query),
-		user.Username, user.Email, user.Password, user.AuthSource, user.Role, user.IsRobot)
+		user.Username, user.Email, user.Password, user.AuthSource, user.Role, user.IsRobot, user.Theme, user.Deactivated)
 	if err != nil {
 		return fmt.Errorf("creating user: %w", err)
 	}
@@ -68,9 +68,9 @@ func (s *UserStore) ListRobots(ctx context.Context) ([]database.User, error) {
 }
 
 func (s *UserStore) Update(ctx context.Context, user *database.User) error {
-	query := `UPDATE users SET username = ?, email = ?, password = ?, auth_source = ?, role = ?, is_robot = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	query := `UPDATE users SET username = ?, email = ?, password = ?, auth_source = ?, role = ?, is_robot = ?, theme = ?, deactivated = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
 	_, err := s.db.ExecContext(ctx, s.db.Rebind(query),
-		user.Username, user.Email, user.Password, user.AuthSource, user.Role, user.IsRobot, user.ID)
+		user.Username, user.Email, user.Password, user.AuthSource, user.Role, user.IsRobot, user.Theme, user.Deactivated, user.ID)
 	if err != nil {
 		return fmt.Errorf("updating user: %w", err)
 	}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/store"
 )
 
 type VersionStore struct {
@@ -17,9 +18,16 @@ func NewVersionStore(db *sqlx.DB) *VersionStore {
 }
 
 func (s *VersionStore) Create(ctx context.Context, version *database.Version) error {
-	query := `INSERT INTO versions (project_id, tag, storage_path, content_type, uploaded_by) VALUES (?, ?, ?, ?, ?)`
+	if version.SignatureStatus == "" {
+		version.SignatureStatus = database.SignatureUnsigned
+	}
+	if version.Lifecycle == "" {
+		version.Lifecycle = database.LifecycleActive
+	}
+	query := `INSERT INTO versions (project_id, tag, storage_path, content_type, uploaded_by, signature_status, signature_key, lifecycle, lifecycle_message, landing_path, release_notes, size_bytes) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	result, err := s.db.ExecContext(ctx, s.db.Rebind(query),
-		version.ProjectID, version.Tag, version.StoragePath, version.ContentType, version.UploadedBy)
+		version.ProjectID, version.Tag, version.StoragePath, version.ContentType, version.UploadedBy, version.SignatureStatus, version.SignatureKey,
+		version.Lifecycle, version.LifecycleMessage, version.LandingPath, version.ReleaseNotes, version.SizeBytes)
 	if err != nil {
 		return fmt.Errorf("creating version: %w", err)
 	}
@@ -49,15 +57,88 @@ func (s *VersionStore) ListByProject(ctx context.Context, projectID int64) ([]da
 	return versions, nil
 }
 
+func (s *VersionStore) ListPageByProject(ctx context.Context, projectID int64, q store.VersionQuery) ([]database.Version, int, error) {
+	var total int
+	if err := s.db.GetContext(ctx, &total, s.db.Rebind(`SELECT COUNT(*) FROM versions WHERE project_id = ?`), projectID); err != nil {
+		return nil, 0, fmt.Errorf("counting versions: %w", err)
+	}
+	query := `SELECT * FROM versions WHERE project_id = ? ORDER BY created_at, id`
+	if q.Desc {
+		query = `SELECT * FROM versions WHERE project_id = ? ORDER BY created_at DESC, id DESC`
+	}
+	args := []any{projectID}
+	if q.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, q.Limit, q.Offset)
+	}
+	versions := []database.Version{}
+	if err := s.db.SelectContext(ctx, &versions, s.db.Rebind(query), args...); err != nil {
+		return nil, 0, fmt.Errorf("listing versions: %w", err)
+	}
+	return versions, total, nil
+}
+
 func (s *VersionStore) Update(ctx context.Context, version *database.Version) error {
-	query := `UPDATE versions SET storage_path = ?, content_type = ?, uploaded_by = ?, created_at = ? WHERE id = ?`
-	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), version.StoragePath, version.ContentType, version.UploadedBy, version.CreatedAt, version.ID)
+	query := `UPDATE versions SET storage_path = ?, content_type = ?, uploaded_by = ?, created_at = ?, signature_status = ?, signature_key = ?, landing_path = ?, release_notes = ?, size_bytes = ? WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), version.StoragePath, version.ContentType, version.UploadedBy, version.CreatedAt,
+		version.SignatureStatus, version.SignatureKey, version.LandingPath, version.ReleaseNotes, version.SizeBytes, version.ID)
 	if err != nil {
 		return fmt.Errorf("updating version: %w", err)
 	}
 	return nil
 }
 
+func (s *VersionStore) SetProtected(ctx context.Context, id int64, protected bool) error {
+	query := `UPDATE versions SET protected = ? WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), protected, id)
+	if err != nil {
+		return fmt.Errorf("setting version protection: %w", err)
+	}
+	return nil
+}
+
+func (s *VersionStore) SetLifecycle(ctx context.Context, id int64, lifecycle, message string) error {
+	query := `UPDATE versions SET lifecycle = ?, lifecycle_message = ? WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), lifecycle, message, id)
+	if err != nil {
+		return fmt.Errorf("setting version lifecycle: %w", err)
+	}
+	return nil
+}
+
+func (s *VersionStore) SetSize(ctx context.Context, id, size int64) error {
+	query := `UPDATE versions SET size_bytes = ? WHERE id = ?`
+	if _, err := s.db.ExecContext(ctx, s.db.Rebind(query), size, id); err != nil {
+		return fmt.Errorf("setting version size: %w", err)
+	}
+	return nil
+}
+
+func (s *VersionStore) UsageByProject(ctx context.Context) (map[int64]int64, error) {
+	var rows []struct {
+		ProjectID int64 `db:"project_id"`
+		Size      int64 `db:"size"`
+	}
+	query := `SELECT project_id, COALESCE(SUM(size_bytes), 0) AS size FROM versions GROUP BY project_id`
+	if err := s.db.SelectContext(ctx, &rows, query); err != nil {
+		return nil, fmt.Errorf("summing version sizes: %w", err)
+	}
+	usage := make(map[int64]int64, len(rows))
+	for _, r := range rows {
+		usage[r.ProjectID] = r.Size
+	}
+	return usage, nil
+}
+
+func (s *VersionStore) Rename(ctx context.Context, id int64, tag, storagePath string) error {
+	query := `UPDATE versions SET tag = ?, storage_path = ? WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), tag, storagePath, id)
+	if err != nil {
+		return fmt.Errorf("renaming version: %w", err)
+	}
+	return nil
+}
+
 func (s *VersionStore) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM versions WHERE id = ?`
 	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), id)
@@ -0,0 +1,64 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type VersionRedirectStore struct {
+	db *sqlx.DB
+}
+
+func NewVersionRedirectStore(db *sqlx.DB) *VersionRedirectStore {
+	return &VersionRedirectStore{db: db}
+}
+
+func (s *VersionRedirectStore) Get(ctx context.Context, projectID int64, oldTag string) (string, error) {
+	var newTag string
+	query := `SELECT new_tag FROM version_redirects WHERE project_id = ? AND old_tag = ?`
+	if err := s.db.GetContext(ctx, &newTag, s.db.Rebind(query), projectID, oldTag); err != nil {
+		return "", fmt.Errorf("getting version redirect: %w", err)
+	}
+	return newTag, nil
+}
+
+func (s *VersionRedirectStore) Set(ctx context.Context, projectID int64, oldTag, newTag string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The new tag is a version now, and redirects to the old tag follow it.
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM version_redirects WHERE project_id = ? AND old_tag IN (?, ?)`), projectID, oldTag, newTag); err != nil {
+		return fmt.Errorf("clearing version redirects: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`UPDATE version_redirects SET new_tag = ? WHERE project_id = ? AND new_tag = ?`), newTag, projectID, oldTag); err != nil {
+		return fmt.Errorf("updating version redirects: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`INSERT INTO version_redirects (project_id, old_tag, new_tag) VALUES (?, ?, ?)`), projectID, oldTag, newTag); err != nil {
+		return fmt.Errorf("setting version redirect: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+type versionRedirectRow struct {
+	OldTag string `db:"old_tag"`
+	NewTag string `db:"new_tag"`
+}
+
+func (s *VersionRedirectStore) ListByProject(ctx context.Context, projectID int64) (map[string]string, error) {
+	var rows []versionRedirectRow
+	query := `SELECT old_tag, new_tag FROM version_redirects WHERE project_id = ?`
+	if err := s.db.SelectContext(ctx, &rows, s.db.Rebind(query), projectID); err != nil {
+		return nil, fmt.Errorf("listing version redirects: %w", err)
+	}
+	result := make(map[string]string, len(rows))
+	for _, row := range rows {
+		result[row.OldTag] = row.NewTag
+	}
+	return result, nil
+}
@@ -0,0 +1,126 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/qwc/asiakirjat/internal/database"
+)
+
+type WatcherStore struct {
+	db *sqlx.DB
+}
+
+func NewWatcherStore(db *sqlx.DB) *WatcherStore {
+	return &WatcherStore{db: db}
+}
+
+func (s *WatcherStore) Set(ctx context.Context, userID, projectID int64, watchers []database.Watcher) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM watchers WHERE user_id = ? AND project_id = ?`), userID, projectID); err != nil {
+		return fmt.Errorf("clearing watchers: %w", err)
+	}
+	insert := tx.Rebind(`INSERT INTO watchers (user_id, project_id, channel, target) VALUES (?, ?, ?, ?)`)
+	for _, w := range watchers {
+		if _, err := tx.ExecContext(ctx, insert, userID, projectID, w.Channel, w.Target); err != nil {
+			return fmt.Errorf("setting watcher %q: %w", w.Channel, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *WatcherStore) ListByUser(ctx context.Context, userID int64) ([]database.Watcher, error) {
+	var watchers []database.Watcher
+	query := `SELECT * FROM watchers WHERE user_id = ? ORDER BY project_id, channel`
+	if err := s.db.SelectContext(ctx, &watchers, s.db.Rebind(query), userID); err != nil {
+		return nil, fmt.Errorf("listing watchers of user: %w", err)
+	}
+	return watchers, nil
+}
+
+func (s *WatcherStore) ListByProject(ctx context.Context, projectID int64) ([]database.Watcher, error) {
+	var watchers []database.Watcher
+	query := `SELECT * FROM watchers WHERE project_id = ? ORDER BY user_id, channel`
+	if err := s.db.SelectContext(ctx, &watchers, s.db.Rebind(query), projectID); err != nil {
+		return nil, fmt.Errorf("listing watchers of project: %w", err)
+	}
+	return watchers, nil
+}
+
+func (s *WatcherStore) SetFeedToken(ctx context.Context, userID int64, tokenHash string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM feed_tokens WHERE user_id = ?`), userID); err != nil {
+		return fmt.Errorf("clearing feed token: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`INSERT INTO feed_tokens (user_id, token_hash) VALUES (?, ?)`), userID, tokenHash); err != nil {
+		return fmt.Errorf("setting feed token: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (s *WatcherStore) GetFeedTokenUser(ctx context.Context, tokenHash string) (int64, error) {
+	var userID int64
+	query := `SELECT user_id FROM feed_tokens WHERE token_hash = ?`
+	if err := s.db.GetContext(ctx, &userID, s.db.Rebind(query), tokenHash); err != nil {
+		return 0, fmt.Errorf("getting feed token: %w", err)
+	}
+	return userID, nil
+}
+
+func (s *WatcherStore) DeleteFeedToken(ctx context.Context, userID int64) error {
+	query := `DELETE FROM feed_tokens WHERE user_id = ?`
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(query), userID)
+	if err != nil {
+		return fmt.Errorf("deleting feed token: %w", err)
+	}
+	return nil
+}
+
+func (s *WatcherStore) ListByChannel(ctx context.Context, channel string) ([]database.Watcher, error) {
+	var watchers []database.Watcher
+	query := `SELECT * FROM watchers WHERE channel = ? ORDER BY user_id, project_id`
+	if err := s.db.SelectContext(ctx, &watchers, s.db.Rebind(query), channel); err != nil {
+		return nil, fmt.Errorf("listing watchers of channel: %w", err)
+	}
+	return watchers, nil
+}
+
+func (s *WatcherStore) GetDigest(ctx context.Context, userID int64) (*database.Digest, error) {
+	var digest database.Digest
+	query := `SELECT * FROM watch_digests WHERE user_id = ?`
+	if err := s.db.GetContext(ctx, &digest, s.db.Rebind(query), userID); err != nil {
+		return nil, fmt.Errorf("getting watch digest: %w", err)
+	}
+	return &digest, nil
+}
+
+func (s *WatcherStore) SetDigest(ctx context.Context, digest *database.Digest) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM watch_digests WHERE user_id = ?`), digest.UserID); err != nil {
+		return fmt.Errorf("clearing watch digest: %w", err)
+	}
+	insert := tx.Rebind(`INSERT INTO watch_digests (user_id, frequency, sent_at) VALUES (?, ?, ?)`)
+	if _, err := tx.ExecContext(ctx, insert, digest.UserID, digest.Frequency, digest.SentAt.UTC()); err != nil {
+		return fmt.Errorf("setting watch digest: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/qwc/asiakirjat/internal/database"
 )
@@ -13,15 +14,59 @@ type ProjectStore interface {
 	List(ctx context.Context) ([]database.Project, error)
 	ListByVisibility(ctx context.Context, visibility string) ([]database.Project, error)
 	Search(ctx context.Context, query string) ([]database.Project, error)
+	// ListPage returns the projects q selects, in its order, and how many
+	// there are without Limit and Offset.
+	ListPage(ctx context.Context, q ProjectQuery) ([]database.Project, int, error)
 	Update(ctx context.Context, project *database.Project) error
+	SetOwnerOrphaned(ctx context.Context, id int64, orphaned bool) error
 	Delete(ctx context.Context, id int64) error
 }
 
+// Orders of ProjectQuery.Sort.
+const (
+	SortLifecycle = ""        // Active projects first, then by name
+	SortName      = "name"    // By name
+	SortCreated   = "created" // By creation time, then by name
+	SortUpdated   = "updated" // By time of the last change, then by name
+)
+
+// ProjectQuery selects a page of projects. Empty fields select all.
+type ProjectQuery struct {
+	Search     string            // Part of the name, slug or description
+	Visibility string            // e.g. database.VisibilityPublic
+	Lifecycle  string            // e.g. database.LifecycleActive
+	Tag        string            // A tag of the project
+	Metadata   map[string]string // Labels the project has, with these values
+	IDs        []int64           // Only these projects, unless nil
+	Sort       string            // One of the Sort constants
+	Desc       bool              // Reverse the order
+	Limit      int               // At most this many; 0 for all
+	Offset     int
+}
+
+// VersionQuery selects a page of the versions of a project, by upload
+// time.
+type VersionQuery struct {
+	Desc   bool // Latest uploads first
+	Limit  int  // At most this many; 0 for all
+	Offset int
+}
+
 type VersionStore interface {
 	Create(ctx context.Context, version *database.Version) error
 	GetByProjectAndTag(ctx context.Context, projectID int64, tag string) (*database.Version, error)
 	ListByProject(ctx context.Context, projectID int64) ([]database.Version, error)
+	// ListPageByProject returns the versions of a project by upload time,
+	// and how many there are without Limit and Offset.
+	ListPageByProject(ctx context.Context, projectID int64, q VersionQuery) ([]database.Version, int, error)
 	Update(ctx context.Context, version *database.Version) error
+	SetProtected(ctx context.Context, id int64, protected bool) error
+	SetLifecycle(ctx context.Context, id int64, lifecycle, message string) error
+	SetSize(ctx context.Context, id, size int64) error
+	// UsageByProject returns the summed sizes of the versions of each
+	// project with versions, by project ID.
+	UsageByProject(ctx context.Context) (map[int64]int64, error)
+	Rename(ctx context.Context, id int64, tag, storagePath string) error
 	Delete(ctx context.Context, id int64) error
 }
 
@@ -36,10 +81,58 @@ type UserStore interface {
 	Count(ctx context.Context) (int64, error)
 }
 
+// SessionStore keeps login sessions. Sessions idle since before the time
+// given to DeleteIdle are deleted with the expired ones, unless a
+// remember-me token may still renew them.
 type SessionStore interface {
 	Create(ctx context.Context, session *database.Session) error
 	GetByID(ctx context.Context, id string) (*database.Session, error)
+	GetByRememberHash(ctx context.Context, rememberHash string) (*database.Session, error)
+	List(ctx context.Context) ([]database.Session, error)
+	ListByUser(ctx context.Context, userID int64) ([]database.Session, error)
+	Touch(ctx context.Context, id string, lastSeen, expiresAt time.Time) error
 	Delete(ctx context.Context, id string) error
+	DeleteByUser(ctx context.Context, userID int64) error
+	DeleteExpired(ctx context.Context) error
+	DeleteIdle(ctx context.Context, before time.Time) error
+}
+
+// WatcherStore keeps what users watch, and the tokens of their personal
+// feeds. Set replaces the channels a user watches a project on; none
+// unwatches it.
+type WatcherStore interface {
+	Set(ctx context.Context, userID, projectID int64, watchers []database.Watcher) error
+	ListByUser(ctx context.Context, userID int64) ([]database.Watcher, error)
+	ListByProject(ctx context.Context, projectID int64) ([]database.Watcher, error)
+	SetFeedToken(ctx context.Context, userID int64, tokenHash string) error
+	GetFeedTokenUser(ctx context.Context, tokenHash string) (int64, error)
+	DeleteFeedToken(ctx context.Context, userID int64) error
+	ListByChannel(ctx context.Context, channel string) ([]database.Watcher, error)
+	GetDigest(ctx context.Context, userID int64) (*database.Digest, error)
+	SetDigest(ctx context.Context, digest *database.Digest) error
+}
+
+// SCIMGroupStore keeps the groups an identity provider pushes over SCIM.
+// SetMembers replaces the members of a group; ListByUser returns the
+// groups a user is a member of.
+type SCIMGroupStore interface {
+	Create(ctx context.Context, group *database.SCIMGroup) error
+	GetByID(ctx context.Context, id int64) (*database.SCIMGroup, error)
+	List(ctx context.Context) ([]database.SCIMGroup, error)
+	Update(ctx context.Context, group *database.SCIMGroup) error
+	Delete(ctx context.Context, id int64) error
+	ListMembers(ctx context.Context, groupID int64) ([]int64, error)
+	SetMembers(ctx context.Context, groupID int64, userIDs []int64) error
+	ListByUser(ctx context.Context, userID int64) ([]database.SCIMGroup, error)
+}
+
+// PasswordResetStore keeps the pending password resets. A reset is looked
+// up by the hash of its token; DeleteByUser ends all resets of a user once
+// one is used.
+type PasswordResetStore interface {
+	Create(ctx context.Context, reset *database.PasswordReset) error
+	GetByTokenHash(ctx context.Context, tokenHash string) (*database.PasswordReset, error)
+	DeleteByUser(ctx context.Context, userID int64) error
 	DeleteExpired(ctx context.Context) error
 }
 
@@ -72,7 +165,10 @@ type TokenStore interface {
 	GetByHash(ctx context.Context, hash string) (*database.APIToken, error)
 	ListByUser(ctx context.Context, userID int64) ([]database.APIToken, error)
 	ListByProject(ctx context.Context, projectID int64) ([]database.APIToken, error)
+	List(ctx context.Context) ([]database.APIToken, error)
+	SetExpiresAt(ctx context.Context, id int64, expiresAt *time.Time) error
 	Delete(ctx context.Context, id int64) error
+	DeleteByUser(ctx context.Context, userID int64) error
 }
 
 type UploadLogStore interface {
@@ -80,6 +176,131 @@ type UploadLogStore interface {
 	ListByProject(ctx context.Context, projectID int64) ([]database.UploadLog, error)
 }
 
+type AttachmentStore interface {
+	// Upsert stores the attachment, replacing any existing one of the same kind.
+	Upsert(ctx context.Context, attachment *database.VersionAttachment) error
+	GetByVersionAndKind(ctx context.Context, versionID int64, kind string) (*database.VersionAttachment, error)
+	ListByVersion(ctx context.Context, versionID int64) ([]database.VersionAttachment, error)
+	ListByProject(ctx context.Context, projectID int64) ([]database.VersionAttachment, error)
+	DeleteByVersion(ctx context.Context, versionID int64) error
+}
+
+type AuditLogStore interface {
+	Create(ctx context.Context, entry *database.AuditEntry) error
+	List(ctx context.Context, limit int) ([]database.AuditEntry, error)
+}
+
+// FeedbackStore holds problem reports sent from documentation pages.
+type FeedbackStore interface {
+	Create(ctx context.Context, feedback *database.Feedback) error
+	ListByProject(ctx context.Context, projectID int64, limit int) ([]database.Feedback, error)
+	Delete(ctx context.Context, projectID, id int64) error
+}
+
+// APIKeyStore holds the anonymous read-only API keys.
+type APIKeyStore interface {
+	Create(ctx context.Context, key *database.APIKey) error
+	GetByHash(ctx context.Context, hash string) (*database.APIKey, error)
+	List(ctx context.Context) ([]database.APIKey, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+// MetadataStore holds key/value labels of projects and versions. Set
+// replaces all labels of the project or version.
+type MetadataStore interface {
+	GetProject(ctx context.Context, projectID int64) (map[string]string, error)
+	SetProject(ctx context.Context, projectID int64, meta map[string]string) error
+	ListProjects(ctx context.Context) (map[int64]map[string]string, error)
+	GetVersion(ctx context.Context, versionID int64) (map[string]string, error)
+	SetVersion(ctx context.Context, versionID int64, meta map[string]string) error
+	ListVersionsByProject(ctx context.Context, projectID int64) (map[int64]map[string]string, error)
+}
+
+// TagStore holds the free-form tags of projects. Set replaces all tags of
+// the project; tags are returned sorted.
+type TagStore interface {
+	Get(ctx context.Context, projectID int64) ([]string, error)
+	Set(ctx context.Context, projectID int64, tags []string) error
+	List(ctx context.Context) (map[int64][]string, error)
+}
+
+// TranslationStore holds the translated names and descriptions of
+// projects. Set replaces all translations of the project; translations are
+// returned sorted by locale.
+type TranslationStore interface {
+	Get(ctx context.Context, projectID int64) ([]database.ProjectTranslation, error)
+	Set(ctx context.Context, projectID int64, translations []database.ProjectTranslation) error
+	List(ctx context.Context) (map[int64][]database.ProjectTranslation, error)
+}
+
+// FeatureFlagStore holds the feature flags switched by admins, which
+// override the configured defaults. A ProjectID of 0 stands for the whole
+// instance.
+type FeatureFlagStore interface {
+	List(ctx context.Context) ([]database.FeatureFlag, error)
+	Set(ctx context.Context, flag database.FeatureFlag) error
+	Delete(ctx context.Context, projectID int64, name string) error
+}
+
+// JobLockStore coordinates background jobs between servers sharing the
+// database. A job holds its lock until it releases it or the lock
+// expires, and runs once per slot, the time a run was scheduled for.
+type JobLockStore interface {
+	// Acquire takes the lock of a job for holder until expires. It returns
+	// false if another holder has the lock, or the job already ran for slot
+	// or a later one.
+	Acquire(ctx context.Context, name, holder string, slot, expires time.Time) (bool, error)
+	// Extend moves the expiry of a lock holder has.
+	Extend(ctx context.Context, name, holder string, expires time.Time) error
+	Release(ctx context.Context, name, holder string) error
+}
+
+// PreviewStore keeps the previews of projects. ListExpired returns the
+// previews of all projects that expired before a time.
+type PreviewStore interface {
+	Create(ctx context.Context, preview *database.Preview) error
+	Get(ctx context.Context, projectID int64, name string) (*database.Preview, error)
+	ListByProject(ctx context.Context, projectID int64) ([]database.Preview, error)
+	ListExpired(ctx context.Context, before time.Time) ([]database.Preview, error)
+	Update(ctx context.Context, preview *database.Preview) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// VersionRedirectStore maps the tags of renamed or merged versions to the
+// tag their URLs redirect to. Set points existing redirects to the old tag
+// at the new one, so redirects never chain.
+type VersionRedirectStore interface {
+	Get(ctx context.Context, projectID int64, oldTag string) (string, error)
+	Set(ctx context.Context, projectID int64, oldTag, newTag string) error
+	ListByProject(ctx context.Context, projectID int64) (map[string]string, error)
+}
+
+// HistoryStore keeps the documentation pages users viewed last. Record
+// replaces an earlier view of the same page and forgets all but the keep
+// latest pages of the user; ListByUser returns the latest first.
+type HistoryStore interface {
+	Record(ctx context.Context, view *database.PageView, keep int) error
+	ListByUser(ctx context.Context, userID int64, limit int) ([]database.PageView, error)
+	DeleteByUser(ctx context.Context, userID int64) error
+}
+
+// AnalyticsStore keeps the sampled page hits of the view analytics. The
+// counts cover hits since the given time, most hits first.
+type AnalyticsStore interface {
+	Record(ctx context.Context, hit *database.PageHit) error
+	TopPages(ctx context.Context, projectID int64, since time.Time, limit int) ([]database.HitCount, error)
+	NotFound(ctx context.Context, projectID int64, since time.Time, limit int) ([]database.HitCount, error)
+	Versions(ctx context.Context, projectID int64, since time.Time) ([]database.HitCount, error)
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type EventStore interface {
+	Create(ctx context.Context, event *database.Event) error
+	// ListAfter returns up to limit events with an ID greater than after,
+	// oldest first.
+	ListAfter(ctx context.Context, after int64, limit int) ([]database.Event, error)
+}
+
 type GlobalAccessStore interface {
 	// Rules (global_access table)
 	ListRules(ctx context.Context) ([]database.GlobalAccess, error)
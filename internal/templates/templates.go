@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"embed"
 	"fmt"
+	"hash/fnv"
 	"html/template"
 	"io"
+	"strconv"
 	"strings"
+	"sync"
 
-	"github.com/yuin/goldmark"
+	"github.com/qwc/asiakirjat/internal/markdown"
 )
 
 // basePath is the URL prefix for subdirectory deployment (e.g., "/docs")
@@ -25,6 +28,14 @@ type Branding struct {
 	AppName   string // Custom app name (default: "asiakirjat")
 	LogoURL   string // URL or path to custom logo
 	CustomCSS string // Path to custom CSS file
+
+	// Announcement is Markdown shown in a banner at the top of every page
+	// until the reader dismisses it; changing it shows it again.
+	Announcement string
+	// FooterHTML is added to the footer of every page, and ProjectHeaders
+	// at the top of a project's page, by project slug.
+	FooterHTML     string
+	ProjectHeaders map[string]string
 }
 
 // SetBasePath sets the URL prefix for all template URLs.
@@ -59,17 +70,43 @@ func SetVersion(v string) {
 //go:embed layouts/*.html pages/*.html partials/*.html overlay/*.html
 var templateFS embed.FS
 
+// fragmentCacheSize is the number of rendered fragments kept; the cache is
+// emptied when it is full.
+const fragmentCacheSize = 4096
+
 type Engine struct {
 	templates map[string]*template.Template
+	partials  *template.Template
 	overlay   *template.Template
+
+	fragmentsMu sync.Mutex
+	fragments   map[string]template.HTML
 }
 
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
 func New() (*Engine, error) {
 	engine := &Engine{
 		templates: make(map[string]*template.Template),
+		fragments: make(map[string]template.HTML),
 	}
 
-	md := goldmark.New()
+	md := markdown.New()
+
+	// The announcement is rendered once; its ID is a hash of its text, so
+	// that readers who dismissed it see it again when it changes.
+	var announcement template.HTML
+	var announcementID string
+	if branding.Announcement != "" {
+		var buf bytes.Buffer
+		if err := md.Convert([]byte(branding.Announcement), &buf); err != nil {
+			return nil, fmt.Errorf("rendering announcement: %w", err)
+		}
+		announcement = template.HTML(buf.String())
+		sum := fnv.New64a()
+		sum.Write([]byte(branding.Announcement))
+		announcementID = strconv.FormatUint(sum.Sum64(), 36)
+	}
 
 	funcMap := template.FuncMap{
 		"upper":    strings.ToUpper,
@@ -95,6 +132,12 @@ func New() (*Engine, error) {
 			}
 			return *s
 		},
+		"announcement":   func() template.HTML { return announcement },
+		"announcementID": func() string { return announcementID },
+		"footerHTML":     func() template.HTML { return template.HTML(branding.FooterHTML) },
+		"projectHeader": func(slug string) template.HTML {
+			return template.HTML(branding.ProjectHeaders[slug])
+		},
 		"markdown": func(s string) template.HTML {
 			var buf bytes.Buffer
 			if err := md.Convert([]byte(s), &buf); err != nil {
@@ -104,7 +147,13 @@ func New() (*Engine, error) {
 		},
 	}
 
-	// Parse page templates, each extending the base layout
+	// Parse the layout and partials once; every page extends a copy
+	base, err := template.New("base.html").Funcs(funcMap).ParseFS(templateFS, "layouts/base.html", "partials/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("parsing layout and partials: %w", err)
+	}
+	engine.partials = base
+
 	pages, err := templateFS.ReadDir("pages")
 	if err != nil {
 		return nil, fmt.Errorf("reading pages directory: %w", err)
@@ -116,13 +165,17 @@ func New() (*Engine, error) {
 		}
 		name := page.Name()
 
-		t, err := template.New("base.html").Funcs(funcMap).ParseFS(templateFS,
-			"layouts/base.html",
-			"partials/*.html",
-			"pages/"+name,
-		)
+		t, err := base.Clone()
 		if err != nil {
-			return nil, fmt.Errorf("parsing template %s: %w", name, err)
+			return nil, fmt.Errorf("copying layout for page %s: %w", name, err)
+		}
+		if _, err := t.ParseFS(templateFS, "pages/"+name); err != nil {
+			return nil, fmt.Errorf("parsing page %s: %w", name, err)
+		}
+		for _, block := range []string{"title", "content"} {
+			if t.Lookup(block) == nil {
+				return nil, fmt.Errorf("page %s does not define %q", name, block)
+			}
 		}
 
 		// Key by page name without extension
@@ -140,12 +193,51 @@ func New() (*Engine, error) {
 	return engine, nil
 }
 
+// Render executes a page template. The page is rendered completely before
+// it is written, so that a failing template never sends half a page.
 func (e *Engine) Render(w io.Writer, name string, data any) error {
 	t, ok := e.templates[name]
 	if !ok {
 		return fmt.Errorf("template %q not found", name)
 	}
-	return t.Execute(w, data)
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+
+	if err := t.Execute(buf, data); err != nil {
+		return fmt.Errorf("rendering page %s: %w", name, err)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// RenderFragment executes a partial template with the result of data and
+// caches the output under key; data is only called on a cache miss. The key
+// must identify the data completely, e.g. by including a version number of
+// the data that is bumped on every change.
+func (e *Engine) RenderFragment(name, key string, data func() any) (template.HTML, error) {
+	cacheKey := name + "\x00" + key
+	e.fragmentsMu.Lock()
+	html, ok := e.fragments[cacheKey]
+	e.fragmentsMu.Unlock()
+	if ok {
+		return html, nil
+	}
+
+	var buf bytes.Buffer
+	if err := e.partials.ExecuteTemplate(&buf, name, data()); err != nil {
+		return "", fmt.Errorf("rendering fragment %s: %w", name, err)
+	}
+	html = template.HTML(buf.String())
+
+	e.fragmentsMu.Lock()
+	if len(e.fragments) >= fragmentCacheSize {
+		clear(e.fragments)
+	}
+	e.fragments[cacheKey] = html
+	e.fragmentsMu.Unlock()
+	return html, nil
 }
 
 // OverlayData holds the data needed for the doc overlay.
@@ -153,6 +245,28 @@ type OverlayData struct {
 	Slug        string
 	ProjectName string
 	Version     string
+	// Lifecycle is "deprecated" or "eol" to show LifecycleMessage as a
+	// banner below the toolbar; empty for active documentation.
+	Lifecycle        string
+	LifecycleMessage string
+	// MaintainedBy and ContactURL link to the project's maintainers.
+	MaintainedBy string
+	ContactURL   string
+	// FeedbackMode is "issue_tracker" to link to FeedbackURL, "internal" to
+	// send reports to asiakirjat, or empty to hide the feedback button.
+	FeedbackMode string
+	FeedbackURL  string
+	// Offline shows the button that saves the version in the browser.
+	Offline bool
+	// Position is "bottom" to dock the overlay at the bottom of the page,
+	// Theme "light" for light colors or "auto" to follow the color scheme
+	// of the browser, and Color an accent color such as
+	// "#3b82f6". Collapsed starts the overlay collapsed for readers who
+	// have not expanded it.
+	Position  string
+	Theme     string
+	Color     string
+	Collapsed bool
 }
 
 // RenderOverlay renders the doc overlay HTML snippet.
@@ -10,7 +10,7 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-func NewTestDB(t *testing.T) *sqlx.DB {
+func NewTestDB(t testing.TB) *sqlx.DB {
 	t.Helper()
 
 	db, err := sqlx.Open("sqlite", ":memory:")
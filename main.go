@@ -4,24 +4,38 @@ import (
 	"context"
 	"embed"
 	"flag"
+	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strings"
+	"slices"
 	"syscall"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/qwc/asiakirjat/internal/auth"
+	"github.com/qwc/asiakirjat/internal/backup"
 	"github.com/qwc/asiakirjat/internal/config"
 	"github.com/qwc/asiakirjat/internal/database"
+	"github.com/qwc/asiakirjat/internal/demo"
 	"github.com/qwc/asiakirjat/internal/docs"
 	"github.com/qwc/asiakirjat/internal/docs/builtin"
+	"github.com/qwc/asiakirjat/internal/email"
+	"github.com/qwc/asiakirjat/internal/events"
 	"github.com/qwc/asiakirjat/internal/handler"
+	"github.com/qwc/asiakirjat/internal/hooks"
+	"github.com/qwc/asiakirjat/internal/logging"
+	"github.com/qwc/asiakirjat/internal/scheduler"
 	"github.com/qwc/asiakirjat/internal/store"
+	storecache "github.com/qwc/asiakirjat/internal/store/cache"
 	sqlstore "github.com/qwc/asiakirjat/internal/store/sql"
 	"github.com/qwc/asiakirjat/internal/templates"
+	"gopkg.in/yaml.v3"
 )
 
 // version is set via ldflags at build time.
@@ -30,8 +44,25 @@ var version = "dev"
 //go:embed static
 var staticFiles embed.FS
 
+// extensions add routes to the server, see handler.Extension. Forks
+// register theirs from init functions in files of their own, so that this
+// file stays as it is.
+var extensions []handler.Extension
+
+// compiledHooks are the hooks compiled in, see package hooks. Forks
+// register theirs from init functions like extensions; the commands of the
+// hooks section run after them.
+var compiledHooks = hooks.NewRegistry()
+
 func main() {
 	configPath := flag.String("config", "config.yaml", "path to config file")
+	seedDemo := flag.Bool("seed-demo", false, "create example projects, users and tokens before starting")
+	exportIndex := flag.String("export-search-index", "", "write a snapshot of the search index to `file` and exit")
+	importIndex := flag.String("import-search-index", "", "replace the search index with the snapshot in `file` and exit")
+	checkStorage := flag.Bool("check-storage", false, "report version directories without a version and versions whose files are missing, and exit")
+	cleanStorage := flag.Bool("clean-storage", false, "delete version directories without a version and versions whose files are missing, and exit")
+	backupPath := flag.String("backup", "", "write a backup of the database, storage, search index and config to `file` and exit")
+	restorePath := flag.String("restore", "", "restore the backup in `file` into an empty database and storage and exit")
 	flag.Parse()
 
 	// Set the version for built-in docs
@@ -44,26 +75,66 @@ func main() {
 		os.Exit(1)
 	}
 
-	logLevel := slog.LevelInfo
-	if cfg.Server.LogLevel != "" {
-		switch strings.ToLower(cfg.Server.LogLevel) {
-		case "debug":
-			logLevel = slog.LevelDebug
-		case "info":
-			logLevel = slog.LevelInfo
-		case "warn", "warning":
-			logLevel = slog.LevelWarn
-		case "error":
-			logLevel = slog.LevelError
-		default:
-			slog.Warn("unknown log_level, defaulting to info", "log_level", cfg.Server.LogLevel)
+	logLevel, err := logging.ParseLevel(cfg.Server.LogLevel)
+	if err != nil {
+		slog.Warn("unknown log_level, defaulting to info", "log_level", cfg.Server.LogLevel)
+	}
+	logHandler, err := logging.NewHandler(os.Stdout, cfg.Server.LogFormat, logLevel)
+	if err != nil {
+		slog.Error("configuring logging", "error", err)
+		os.Exit(1)
+	}
+	logger := slog.New(logHandler)
+	slog.SetDefault(logger)
+
+	// The index used to be kept below the storage base path
+	legacyIndexPath := docs.LegacyIndexPath(cfg.Storage.BasePath)
+	if moved, err := docs.RelocateSearchIndex(legacyIndexPath, cfg.Search.IndexPath); err != nil {
+		logger.Error("relocating search index", "error", err, "from", legacyIndexPath, "to", cfg.Search.IndexPath)
+		os.Exit(1)
+	} else if moved {
+		logger.Info("relocated search index", "from", legacyIndexPath, "to", cfg.Search.IndexPath)
+	}
+
+	// Search index snapshots are taken and restored without starting the
+	// server, which holds the index open
+	if *exportIndex != "" || *importIndex != "" {
+		if cfg.Search.Backend != "" && cfg.Search.Backend != "bleve" {
+			logger.Error("search index snapshot", "error", docs.ErrSnapshotUnsupported)
+			os.Exit(1)
 		}
+		if err := runSearchIndexSnapshot(cfg.Search.IndexPath, *exportIndex, *importIndex); err != nil {
+			logger.Error("search index snapshot", "error", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: logLevel,
-	}))
-	slog.SetDefault(logger)
+	// Backups are restored before the database is opened, which creates
+	// an SQLite database
+	if *restorePath != "" {
+		if err := runRestore(cfg, *configPath, *restorePath); err != nil {
+			logger.Error("restoring backup", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The server listens while it starts, answering health checks and
+	// refusing other requests, so that orchestrators wait for migrations
+	// instead of restarting it. Commands that exit do not listen.
+	startup := handler.NewStartup(cfg)
+	server := newHTTPServer(cfg, startup)
+	serveErr := make(chan error, 1)
+	if *backupPath == "" && !*checkStorage && !*cleanStorage {
+		listener, err := net.Listen("tcp", cfg.ListenAddr())
+		if err != nil {
+			logger.Error("server error", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("starting server", "address", cfg.ListenAddr())
+		go func() { serveErr <- server.Serve(listener) }()
+	}
 
 	// Ensure database directory exists (SQLite needs it before opening)
 	if dbDir := filepath.Dir(cfg.Database.DSN); dbDir != "" && dbDir != "." {
@@ -71,7 +142,15 @@ func main() {
 	}
 
 	// Open database
-	db, dialect, err := database.Open(cfg.Database.Driver, cfg.Database.DSN)
+	openDatabase := database.Open
+	if cfg.Chaos.Enabled && cfg.Chaos.DatabaseErrorPercent > 0 {
+		openDatabase = database.OpenWithFaults
+	}
+	db, dialect, err := openDatabase(cfg.Database.Driver, cfg.Database.DSN, database.Pool{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(cfg.Database.ConnMaxLifetime) * time.Second,
+	})
 	if err != nil {
 		logger.Error("opening database", "error", err)
 		os.Exit(1)
@@ -84,30 +163,60 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Initialize stores
-	projectStore := sqlstore.NewProjectStore(db)
-	versionStore := sqlstore.NewVersionStore(db)
+	// Initialize stores. The lookups made for every documentation request
+	// are cached; every store writing them must be a cached one.
+	storeCache := storecache.New(time.Duration(cfg.Cache.StoreTTL) * time.Second)
+	projectStore := storeCache.Projects(sqlstore.NewProjectStore(db))
+	versionStore := storeCache.Versions(sqlstore.NewVersionStore(db))
 	userStore := sqlstore.NewUserStore(db)
 	sessionStore := sqlstore.NewSessionStore(db)
-	accessStore := sqlstore.NewProjectAccessStore(db)
+	passwordResetStore := sqlstore.NewPasswordResetStore(db)
+	scimGroupStore := sqlstore.NewSCIMGroupStore(db)
+	accessStore := storeCache.Access(sqlstore.NewProjectAccessStore(db))
 	tokenStore := sqlstore.NewTokenStore(db)
 	groupMappingStore := sqlstore.NewAuthGroupMappingStore(db)
-	globalAccessStore := sqlstore.NewGlobalAccessStore(db)
+	globalAccessStore := storeCache.GlobalAccess(sqlstore.NewGlobalAccessStore(db))
 	uploadLogStore := sqlstore.NewUploadLogStore(db)
+	attachmentStore := sqlstore.NewAttachmentStore(db)
+	auditLogStore := sqlstore.NewAuditLogStore(db)
+	feedbackStore := sqlstore.NewFeedbackStore(db)
+	apiKeyStore := sqlstore.NewAPIKeyStore(db)
+	eventStore := sqlstore.NewEventStore(db)
+	watcherStore := sqlstore.NewWatcherStore(db)
+	metadataStore := sqlstore.NewMetadataStore(db)
+	tagStore := sqlstore.NewTagStore(db)
+	translationStore := sqlstore.NewTranslationStore(db)
+	versionRedirectStore := sqlstore.NewVersionRedirectStore(db)
+	historyStore := sqlstore.NewHistoryStore(db)
+	previewStore := sqlstore.NewPreviewStore(db)
+	analyticsStore := sqlstore.NewAnalyticsStore(db)
+	featureFlagStore := sqlstore.NewFeatureFlagStore(db)
 
 	// Initialize storage
 	storage := docs.NewFilesystemStorage(cfg.Storage.BasePath)
+	storage.Deduplicate = cfg.Storage.Deduplicate
 
 	// Ensure storage directory exists
 	os.MkdirAll(cfg.Storage.BasePath, 0755)
 
 	// Initialize search index
-	searchIndex, err := docs.NewSearchIndex(cfg.Storage.BasePath)
+	searchIndex, err := openSearchIndex(cfg)
 	if err != nil {
 		logger.Error("opening search index", "error", err)
 		os.Exit(1)
 	}
 	defer searchIndex.Close()
+	if searchIndex.Outdated() {
+		logger.Warn("search index was built with other analysis settings; rebuild it in Admin > Projects for them to apply", "changes", searchIndex.AnalysisChange())
+	}
+
+	if *backupPath != "" {
+		if err := runBackup(backupOptions(cfg, db, dialect, searchIndex), *backupPath); err != nil {
+			logger.Error("writing backup", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Initialize auth
 	sessionMgr := auth.NewSessionManager(
@@ -116,6 +225,9 @@ func main() {
 		cfg.Auth.Session.MaxAge,
 		cfg.Auth.Session.Secure,
 	)
+	sessionMgr.SetIdleTimeout(cfg.Auth.Session.IdleTimeout)
+	sessionMgr.SetSliding(cfg.Auth.Session.Sliding)
+	sessionMgr.SetRememberMaxAge(cfg.Auth.Session.RememberMaxAge)
 
 	builtinAuth := auth.NewBuiltinAuthenticator(userStore)
 	authenticators := []auth.Authenticator{builtinAuth}
@@ -160,12 +272,55 @@ func main() {
 		}
 	}
 
+	// Add reverse proxy authenticator if enabled
+	var proxyAuth *auth.ProxyAuthenticator
+	if cfg.Auth.Proxy.Enabled {
+		if err := auth.ValidateProxyAuthConfig(cfg.Auth.Proxy); err != nil {
+			logger.Error("invalid proxy auth config", "error", err)
+			os.Exit(1)
+		}
+		proxyAuth = auth.NewProxyAuthenticator(cfg.Auth.Proxy, userStore, logger)
+		proxyAuth.SetStores(accessStore, groupMappingStore, globalAccessStore)
+		authenticators = append(authenticators, proxyAuth)
+		logger.Info("proxy authentication enabled", "user_header", cfg.Auth.Proxy.UserHeader)
+
+		// Sync proxy project_groups from config to database
+		if len(cfg.Auth.Proxy.ProjectGroups) > 0 {
+			if err := syncConfigGroupMappings(context.Background(), logger, projectStore, groupMappingStore, "proxy", cfg.Auth.Proxy.ProjectGroups); err != nil {
+				logger.Error("syncing proxy project groups from config", "error", err)
+			}
+		}
+	}
+
+	if cfg.Auth.SCIM.Enabled && len(cfg.Auth.SCIM.ProjectGroups) > 0 {
+		if err := syncConfigGroupMappings(context.Background(), logger, projectStore, groupMappingStore, "scim", cfg.Auth.SCIM.ProjectGroups); err != nil {
+			logger.Error("syncing SCIM project groups from config", "error", err)
+		}
+	}
+
 	// Sync global access config (access.private section)
 	syncGlobalAccessConfig(context.Background(), logger, globalAccessStore, cfg)
 
 	// Create initial admin user if no users exist
 	ensureInitialAdmin(logger, userStore, cfg)
 
+	if *seedDemo {
+		seeder := &demo.Seeder{
+			Storage:     storage,
+			Projects:    projectStore,
+			Versions:    versionStore,
+			Users:       userStore,
+			Access:      accessStore,
+			Tokens:      tokenStore,
+			SearchIndex: searchIndex,
+			Logger:      logger,
+		}
+		if err := seeder.Seed(context.Background()); err != nil {
+			logger.Error("seeding demo content", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	// Initialize templates
 	templates.SetVersion(version)
 	templates.SetBasePath(cfg.Server.BasePath)
@@ -173,6 +328,10 @@ func main() {
 		AppName:   cfg.Branding.AppName,
 		LogoURL:   cfg.Branding.LogoURL,
 		CustomCSS: cfg.Branding.CustomCSS,
+
+		Announcement:   cfg.Branding.Announcement,
+		FooterHTML:     cfg.Branding.FooterHTML,
+		ProjectHeaders: cfg.Branding.ProjectHeaders,
 	})
 	tmpl, err := templates.New()
 	if err != nil {
@@ -187,62 +346,211 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Initialize maintenance scheduler
+	sched := scheduler.New(logger)
+
+	// Optional event publishing to NATS
+	var eventPublisher events.Publisher
+	if cfg.Events.NATSURL != "" {
+		natsPublisher, err := events.NewNATSPublisher(cfg.Events.NATSURL)
+		if err != nil {
+			logger.Error("configuring event publishing", "error", err)
+			os.Exit(1)
+		}
+		eventPublisher = natsPublisher
+		logger.Info("publishing events to NATS", "subject", cfg.Events.NATSSubject)
+	}
+
+	// Optional notification emails
+	var mailer email.Sender
+	if cfg.Email.SMTPHost != "" {
+		smtpSender, err := email.NewSMTPSender(cfg.Email.SMTPHost, cfg.Email.SMTPPort, cfg.Email.TLS, cfg.Email.Username, cfg.Email.Password, cfg.Email.From)
+		if err != nil {
+			logger.Error("configuring email", "error", err)
+			os.Exit(1)
+		}
+		mailer = smtpSender
+		logger.Info("sending notification emails", "smtp_host", cfg.Email.SMTPHost)
+	}
+
+	if err := registerHookCommands(compiledHooks, cfg.Hooks); err != nil {
+		logger.Error("configuring hooks", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize handler
 	h := handler.New(handler.Deps{
-		Config:         cfg,
-		Templates:      tmpl,
-		Storage:        storage,
-		StaticFS:       staticFS,
-		Projects:       projectStore,
-		Versions:       versionStore,
-		Users:          userStore,
-		Sessions:       sessionStore,
-		Access:         accessStore,
-		Tokens:         tokenStore,
-		GroupMappings:  groupMappingStore,
-		GlobalAccess:   globalAccessStore,
-		UploadLogs:     uploadLogStore,
-		Authenticators: authenticators,
-		OAuth2Auth:     oauth2Auth,
-		SessionMgr:     sessionMgr,
-		SearchIndex:    searchIndex,
-		Logger:         logger,
+		Services: handler.Services{
+			Config: cfg,
+			Logger: logger,
+			Projects: handler.ProjectService{
+				Projects:     projectStore,
+				Metadata:     metadataStore,
+				Tags:         tagStore,
+				Translations: translationStore,
+			},
+			Versions: handler.VersionService{
+				Versions:    versionStore,
+				Storage:     storage,
+				SearchIndex: searchIndex,
+				Attachments: attachmentStore,
+				UploadLogs:  uploadLogStore,
+				Redirects:   versionRedirectStore,
+				History:     historyStore,
+				Previews:    previewStore,
+			},
+			Access: handler.AccessService{
+				Users:          userStore,
+				Sessions:       sessionStore,
+				PasswordResets: passwordResetStore,
+				Access:         accessStore,
+				GlobalAccess:   globalAccessStore,
+				GroupMappings:  groupMappingStore,
+				SCIMGroups:     scimGroupStore,
+				Tokens:         tokenStore,
+				APIKeys:        apiKeyStore,
+				Authenticators: authenticators,
+				LDAPAuth:       ldapAuth,
+				OAuth2Auth:     oauth2Auth,
+				ProxyAuth:      proxyAuth,
+				SessionMgr:     sessionMgr,
+			},
+			Activity: handler.ActivityService{
+				AuditLog:       auditLogStore,
+				Events:         eventStore,
+				EventPublisher: eventPublisher,
+				Watchers:       watcherStore,
+				Mailer:         mailer,
+				Feedback:       feedbackStore,
+				Analytics:      analyticsStore,
+			},
+			FeatureFlags: featureFlagStore,
+			JobLocks:     sqlstore.NewJobLockStore(db),
+		},
+		Templates: tmpl,
+		StaticFS:  staticFS,
+		Scheduler: sched,
+		DBPing:    db.PingContext,
+		DBStats:   db.Stats,
+		Backup: func(ctx context.Context, w io.Writer) error {
+			return backup.Create(ctx, w, backupOptions(cfg, db, dialect, searchIndex))
+		},
+		Extensions: extensions,
+		Hooks:      compiledHooks,
 	})
 
-	// Start retention worker
-	retentionCtx, retentionCancel := context.WithCancel(context.Background())
-	defer retentionCancel()
-	go h.StartRetentionWorker(retentionCtx)
+	// Storage is checked against the database without starting the server
+	if *checkStorage || *cleanStorage {
+		report, err := h.CheckStorage(context.Background(), *cleanStorage)
+		if report != nil {
+			fmt.Println(report)
+		}
+		if err != nil {
+			logger.Error("checking storage", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Start maintenance scheduler (retention, session cleanup, index verification)
+	if err := h.RegisterMaintenanceTasks(); err != nil {
+		logger.Error("registering maintenance tasks", "error", err)
+		os.Exit(1)
+	}
+	schedulerCtx, schedulerCancel := context.WithCancel(context.Background())
+	defer schedulerCancel()
+	schedulerDone := make(chan struct{})
+	go func() {
+		sched.Start(schedulerCtx)
+		close(schedulerDone)
+	}()
+	h.ResumeIndexing()
+	h.WarmCaches(context.Background())
+	monitorCtx, monitorCancel := context.WithCancel(context.Background())
+	defer monitorCancel()
+	go h.MonitorDatabase(monitorCtx)
 
 	// Register routes
 	mux := http.NewServeMux()
 	h.RegisterRoutes(mux)
 
 	// Wrap with middleware
-	var httpHandler http.Handler = mux
-	httpHandler = handler.LoggingMiddleware(logger, httpHandler)
-	httpHandler = handler.RecoveryMiddleware(logger, httpHandler)
-
-	// Start server
-	server := &http.Server{
-		Addr:    cfg.ListenAddr(),
-		Handler: httpHandler,
+	var httpHandler http.Handler = h.DegradedMiddleware(mux)
+	if cfg.Chaos.Enabled {
+		logger.Warn("chaos testing enabled: requests are delayed and failed on purpose; never enable it in production",
+			"latency_percent", cfg.Chaos.LatencyPercent, "error_percent", cfg.Chaos.ErrorPercent, "database_error_percent", cfg.Chaos.DatabaseErrorPercent)
+		httpHandler = h.ChaosMiddleware(httpHandler)
+	}
+	if cfg.Compression.Enabled {
+		httpHandler = handler.CompressionMiddleware(cfg.Compression.MinSizeBytes(), httpHandler)
 	}
+	httpHandler = handler.RecoveryMiddleware(logger, httpHandler)
+	httpHandler = handler.LoggingMiddleware(logger, httpHandler)
 
-	// Graceful shutdown
+	// Graceful shutdown: refuse new uploads, let running requests finish,
+	// stop maintenance tasks and wait for background jobs such as search
+	// indexing before the deferred calls close the search index and the
+	// database.
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		<-sigCh
-		logger.Info("shutting down server")
-		server.Shutdown(context.Background())
+
+		timeout := time.Duration(cfg.Server.ShutdownTimeout) * time.Second
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		logger.Info("shutting down server", "timeout", timeout)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		h.BeginShutdown()
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Warn("requests still running at shutdown timeout", "error", err)
+		}
+		schedulerCancel()
+		select {
+		case <-schedulerDone:
+		case <-ctx.Done():
+			logger.Warn("maintenance tasks still running at shutdown timeout")
+		}
+		if err := h.WaitForJobs(ctx); err != nil {
+			logger.Warn("background jobs cancelled at shutdown timeout", "error", err)
+		}
+		logger.Info("server stopped")
 	}()
 
-	logger.Info("starting server", "address", cfg.ListenAddr())
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+	startup.Ready(httpHandler)
+	logger.Info("server ready")
+	if err := <-serveErr; err != http.ErrServerClosed {
 		logger.Error("server error", "error", err)
 		os.Exit(1)
 	}
+	<-shutdownDone
+}
+
+// newHTTPServer returns the server for the configured address, with the
+// connection timeouts and limits of the server config.
+func newHTTPServer(cfg *config.Config, h http.Handler) *http.Server {
+	seconds := func(n int) time.Duration { return time.Duration(n) * time.Second }
+	server := &http.Server{
+		Addr:              cfg.ListenAddr(),
+		Handler:           h,
+		ReadHeaderTimeout: seconds(cfg.Server.ReadHeaderTimeout),
+		ReadTimeout:       seconds(cfg.Server.ReadTimeout),
+		WriteTimeout:      seconds(cfg.Server.WriteTimeout),
+		IdleTimeout:       seconds(cfg.Server.IdleTimeout),
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes(),
+	}
+	server.SetKeepAlivesEnabled(cfg.Server.KeepAlive)
+	if cfg.Server.HTTP2 {
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return server
 }
 
 // syncConfigGroupMappings converts config file group mappings to database records.
@@ -304,6 +612,16 @@ func syncGlobalAccessConfig(ctx context.Context, logger *slog.Logger, globalAcce
 			SubjectType: "oauth2_group", SubjectIdentifier: g, Role: "viewer",
 		})
 	}
+	for _, g := range cfg.Access.Private.Viewers.ProxyGroups {
+		rules = append(rules, database.GlobalAccess{
+			SubjectType: "proxy_group", SubjectIdentifier: g, Role: "viewer",
+		})
+	}
+	for _, g := range cfg.Access.Private.Viewers.SCIMGroups {
+		rules = append(rules, database.GlobalAccess{
+			SubjectType: "scim_group", SubjectIdentifier: g, Role: "viewer",
+		})
+	}
 
 	// Editors
 	for _, u := range cfg.Access.Private.Editors.Users {
@@ -321,6 +639,16 @@ func syncGlobalAccessConfig(ctx context.Context, logger *slog.Logger, globalAcce
 			SubjectType: "oauth2_group", SubjectIdentifier: g, Role: "editor",
 		})
 	}
+	for _, g := range cfg.Access.Private.Editors.ProxyGroups {
+		rules = append(rules, database.GlobalAccess{
+			SubjectType: "proxy_group", SubjectIdentifier: g, Role: "editor",
+		})
+	}
+	for _, g := range cfg.Access.Private.Editors.SCIMGroups {
+		rules = append(rules, database.GlobalAccess{
+			SubjectType: "scim_group", SubjectIdentifier: g, Role: "editor",
+		})
+	}
 
 	if len(rules) > 0 {
 		if err := globalAccess.SyncFromConfig(ctx, rules); err != nil {
@@ -376,3 +704,184 @@ func ensureInitialAdmin(logger *slog.Logger, users store.UserStore, cfg *config.
 
 	logger.Info("created initial admin user", "username", admin.Username)
 }
+
+// registerHookCommands adds the commands of the hooks section to r.
+func registerHookCommands(r *hooks.Registry, cfgs []config.HookConfig) error {
+	for i, hc := range cfgs {
+		point := hooks.Point(hc.Point)
+		if !slices.Contains(hooks.Points, point) {
+			return fmt.Errorf("hook %d: unknown point %q", i+1, hc.Point)
+		}
+		cmd, err := hooks.NewCommand(hc.Command, time.Duration(hc.Timeout)*time.Second)
+		if err != nil {
+			return fmt.Errorf("hook %d: %w", i+1, err)
+		}
+		r.Register(point, cmd, hc.Projects...)
+	}
+	return nil
+}
+
+// openSearchIndex opens the embedded search index, or connects to the
+// external search engine configured.
+func openSearchIndex(cfg *config.Config) (*docs.SearchIndex, error) {
+	switch cfg.Search.Backend {
+	case "", "bleve":
+		return docs.NewSearchIndexWithOptions(cfg.Search.IndexPath, searchIndexOptions(cfg.Search))
+	case "meilisearch":
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		backend, err := docs.NewMeilisearchBackend(ctx, docs.MeilisearchOptions{
+			URL:    cfg.Search.URL,
+			APIKey: cfg.Search.APIKey,
+			Index:  cfg.Search.Index,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return docs.NewSearchIndexWithBackend(cfg.Search.IndexPath, backend), nil
+	}
+	return nil, fmt.Errorf("unknown search backend %q; use bleve or meilisearch", cfg.Search.Backend)
+}
+
+// searchIndexOptions returns the analysis settings of the search index.
+func searchIndexOptions(cfg config.SearchConfig) docs.IndexOptions {
+	opts := docs.IndexOptions{
+		Analysis: docs.Analysis{
+			Language:       cfg.Language,
+			Stemming:       cfg.Stemming,
+			StopWords:      cfg.StopWords,
+			ExtraStopWords: cfg.ExtraStopWords,
+		},
+	}
+	for slug, p := range cfg.Projects {
+		a := opts.Analysis
+		if p.Language != "" {
+			a.Language = p.Language
+		}
+		if p.Stemming != nil {
+			a.Stemming = *p.Stemming
+		}
+		if p.StopWords != nil {
+			a.StopWords = *p.StopWords
+		}
+		if p.ExtraStopWords != nil {
+			a.ExtraStopWords = p.ExtraStopWords
+		}
+		if opts.Projects == nil {
+			opts.Projects = make(map[string]docs.Analysis)
+		}
+		opts.Projects[slug] = a
+	}
+	return opts
+}
+
+// runSearchIndexSnapshot exports the search index below basePath to
+// exportPath, or imports it from importPath.
+func runSearchIndexSnapshot(indexPath, exportPath, importPath string) error {
+	if exportPath != "" && importPath != "" {
+		return fmt.Errorf("-export-search-index and -import-search-index cannot be combined")
+	}
+	if importPath != "" {
+		f, err := os.Open(importPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := docs.ImportSearchIndex(indexPath, f); err != nil {
+			return err
+		}
+		slog.Info("search index imported", "file", importPath)
+		return nil
+	}
+
+	f, err := os.Create(exportPath)
+	if err != nil {
+		return err
+	}
+	if err := docs.ExportSearchIndex(indexPath, f); err != nil {
+		f.Close()
+		os.Remove(exportPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	slog.Info("search index exported", "file", exportPath)
+	return nil
+}
+
+// backupOptions returns what backups of the server contain. The search
+// index is left out when it cannot be snapshotted or is being rebuilt.
+func backupOptions(cfg *config.Config, db *sqlx.DB, dialect database.Dialect, searchIndex *docs.SearchIndex) backup.Options {
+	snapshot, err := yaml.Marshal(cfg)
+	if err != nil {
+		slog.Warn("serializing config for backup", "error", err)
+	}
+	opts := backup.Options{
+		DB:          db,
+		Dialect:     dialect,
+		DSN:         cfg.Database.DSN,
+		StoragePath: cfg.Storage.BasePath,
+		Config:      snapshot,
+		AppVersion:  version,
+	}
+	if (cfg.Search.Backend == "" || cfg.Search.Backend == "bleve") && !searchIndex.Incomplete() {
+		opts.SearchIndex = searchIndex.Export
+	}
+	return opts
+}
+
+// runBackup writes a backup to path, replacing the file only once the
+// backup is complete.
+func runBackup(opts backup.Options, path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := backup.Create(context.Background(), f, opts); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	slog.Info("backup written", "file", path, "search_index", opts.SearchIndex != nil)
+	return nil
+}
+
+// runRestore restores the backup in path into the configured database and
+// storage. The configuration snapshot is written next to the config file
+// to compare with it.
+func runRestore(cfg *config.Config, configPath, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	opts := backup.RestoreOptions{
+		Dialect:     database.DetectDialect(cfg.Database.Driver),
+		DSN:         cfg.Database.DSN,
+		StoragePath: cfg.Storage.BasePath,
+		ConfigPath:  configPath + ".restored",
+	}
+	if cfg.Search.Backend == "" || cfg.Search.Backend == "bleve" {
+		opts.ImportSearchIndex = func(r io.Reader) error {
+			return docs.ImportSearchIndex(cfg.Search.IndexPath, r)
+		}
+	}
+	info, err := backup.Restore(context.Background(), f, opts)
+	if err != nil {
+		return err
+	}
+	slog.Info("backup restored", "file", path, "created_at", info.CreatedAt, "version", info.AppVersion, "config", opts.ConfigPath)
+	if !info.SearchIndex || opts.ImportSearchIndex == nil {
+		slog.Warn("the backup has no search index; rebuild it in Admin > Projects after starting the server")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+(function() {
+    "use strict";
+
+    var container = document.getElementById("navbar-recent");
+    if (!container) return;
+
+    var toggle = container.querySelector(".navbar-recent-toggle");
+    var dropdown = document.getElementById("navbar-recent-dropdown");
+    var basePath = window.BASE_PATH || "";
+
+    function setOpen(open) {
+        dropdown.hidden = !open;
+        toggle.setAttribute("aria-expanded", open ? "true" : "false");
+    }
+
+    // The history is only shown when it is enabled and not empty.
+    fetch(basePath + "/api/history", { credentials: "same-origin" })
+        .then(function(resp) { return resp.ok ? resp.json() : { pages: [] }; })
+        .then(function(data) {
+            if (!data.pages || data.pages.length === 0) return;
+
+            data.pages.forEach(function(p) {
+                var item = document.createElement("a");
+                item.className = "navbar-search-item";
+                item.href = p.url;
+
+                var title = document.createElement("div");
+                title.className = "navbar-search-item-title";
+                title.textContent = p.title;
+                item.appendChild(title);
+
+                var meta = document.createElement("div");
+                meta.className = "navbar-search-item-meta";
+                meta.textContent = p.project_name + " / " + p.version;
+                item.appendChild(meta);
+
+                dropdown.appendChild(item);
+            });
+            container.hidden = false;
+        })
+        .catch(function() {});
+
+    toggle.addEventListener("click", function() {
+        setOpen(dropdown.hidden);
+    });
+
+    document.addEventListener("click", function(e) {
+        if (!container.contains(e.target)) setOpen(false);
+    });
+
+    document.addEventListener("keydown", function(e) {
+        if (e.key === "Escape") setOpen(false);
+    });
+})();
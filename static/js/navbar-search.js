@@ -23,20 +23,44 @@
         return div.innerHTML;
     }
 
+    var pending = null;
+
+    function groupLabel(text) {
+        var label = document.createElement("div");
+        label.className = "navbar-search-group";
+        label.textContent = text;
+        dropdown.appendChild(label);
+    }
+
+    function searchURL(q) {
+        return basePath + "/search?q=" + encodeURIComponent(q);
+    }
+
+    // Suggestions complete the last word as it is typed; the full search
+    // runs on the search page. Without suggestions (see the search_suggest
+    // feature flag), the pages found by the full search are listed.
+    var suggest = window.SEARCH_SUGGEST !== false;
     function doSearch() {
         var q = input.value.trim();
+        if (pending) pending.abort();
         if (q.length < 2) {
             dropdown.style.display = "none";
             dropdown.innerHTML = "";
             return;
         }
 
-        fetch(basePath + "/api/search?q=" + encodeURIComponent(q) + "&limit=8")
+        pending = window.AbortController ? new AbortController() : null;
+        var api = suggest ? "/api/search/suggest" : "/api/search";
+        fetch(basePath + api + "?q=" + encodeURIComponent(q) + "&limit=8",
+              pending ? { signal: pending.signal } : undefined)
             .then(function(resp) { return resp.json(); })
             .then(function(data) {
                 dropdown.innerHTML = "";
 
-                if (!data.results || data.results.length === 0) {
+                var terms = data.terms || [];
+                var projects = data.projects || [];
+                var pages = data.pages || data.results || [];
+                if (terms.length === 0 && projects.length === 0 && pages.length === 0) {
                     var empty = document.createElement("div");
                     empty.className = "navbar-search-empty";
                     empty.textContent = "No results found";
@@ -45,55 +69,72 @@
                     return;
                 }
 
-                data.results.forEach(function(r) {
+                var words = q.split(/\s+/);
+                words.pop();
+                terms.forEach(function(term) {
+                    var completed = words.concat([term]).join(" ");
                     var item = document.createElement("a");
-                    item.className = "navbar-search-item";
-                    if (r.page_number > 0) {
-                        item.href = r.url + "?search=" + encodeURIComponent(q) + "#page=" + r.page_number;
-                    } else {
-                        item.href = r.url + "?highlight=" + encodeURIComponent(q);
-                    }
-
-                    var title = document.createElement("div");
-                    title.className = "navbar-search-item-title";
-                    var titleText = r.page_title || r.file_path;
-                    if (r.page_number > 0) {
-                        titleText += " (p. " + r.page_number + ")";
-                    }
-                    title.textContent = titleText;
-                    item.appendChild(title);
-
-                    var meta = document.createElement("div");
-                    meta.className = "navbar-search-item-meta";
-                    meta.textContent = r.project_name + " / " + r.version_tag;
-                    item.appendChild(meta);
-
-                    if (r.snippet) {
-                        var snippet = document.createElement("div");
-                        snippet.className = "navbar-search-item-snippet";
-                        snippet.innerHTML = r.snippet;
-                        item.appendChild(snippet);
-                    }
-
+                    item.className = "navbar-search-item navbar-search-term";
+                    item.href = searchURL(completed);
+                    item.textContent = completed;
                     dropdown.appendChild(item);
                 });
 
-                if (data.total > 8) {
-                    var viewAll = document.createElement("a");
-                    viewAll.className = "navbar-search-view-all";
-                    viewAll.href = basePath + "/search?q=" + encodeURIComponent(q);
-                    viewAll.textContent = "View all " + data.total + " results";
-                    dropdown.appendChild(viewAll);
+                if (projects.length > 0) {
+                    groupLabel("Projects");
+                    projects.forEach(function(p) {
+                        var item = document.createElement("a");
+                        item.className = "navbar-search-item";
+                        item.href = p.url;
+
+                        var title = document.createElement("div");
+                        title.className = "navbar-search-item-title";
+                        title.textContent = p.name;
+                        item.appendChild(title);
+                        dropdown.appendChild(item);
+                    });
+                }
+
+                if (pages.length > 0) {
+                    groupLabel("Pages");
+                    pages.forEach(function(r) {
+                        var item = document.createElement("a");
+                        item.className = "navbar-search-item";
+                        item.href = r.page_number > 0 ? r.url + "#page=" + r.page_number : r.url;
+
+                        var title = document.createElement("div");
+                        title.className = "navbar-search-item-title";
+                        var titleText = r.page_title || r.file_path;
+                        if (r.page_number > 0) {
+                            titleText += " (p. " + r.page_number + ")";
+                        }
+                        title.textContent = titleText;
+                        item.appendChild(title);
+
+                        var meta = document.createElement("div");
+                        meta.className = "navbar-search-item-meta";
+                        meta.textContent = r.project_name + " / " + r.version_tag;
+                        item.appendChild(meta);
+
+                        dropdown.appendChild(item);
+                    });
                 }
 
+                var viewAll = document.createElement("a");
+                viewAll.className = "navbar-search-view-all";
+                viewAll.href = searchURL(q);
+                viewAll.textContent = "Search for \u201c" + q + "\u201d";
+                dropdown.appendChild(viewAll);
+
                 dropdown.style.display = "block";
             })
-            .catch(function() {
+            .catch(function(err) {
+                if (err && err.name === "AbortError") return;
                 dropdown.style.display = "none";
             });
     }
 
-    input.addEventListener("input", debounce(doSearch, 300));
+    input.addEventListener("input", debounce(doSearch, 150));
 
     // Keyboard navigation
     var selectedIndex = -1;
@@ -138,9 +179,11 @@
             selectedIndex = selectedIndex <= 0 ? items.length - 1 : selectedIndex - 1;
             updateSelection();
         } else if (e.key === "Enter") {
+            e.preventDefault();
             if (selectedIndex >= 0 && items[selectedIndex]) {
-                e.preventDefault();
                 items[selectedIndex].click();
+            } else if (input.value.trim() !== "") {
+                window.location.href = searchURL(input.value.trim());
             }
         }
     });
@@ -0,0 +1,51 @@
+// Service worker for documentation saved offline. The overlay stores the
+// files of a version in caches named "asiakirjat-offline:<project>:<version>";
+// this worker answers from those caches when the network is unavailable.
+// Online, every request goes to the server as usual.
+(function() {
+    "use strict";
+
+    var cachePrefix = "asiakirjat-offline:";
+
+    self.addEventListener("install", function() {
+        self.skipWaiting();
+    });
+
+    self.addEventListener("activate", function(event) {
+        event.waitUntil(self.clients.claim());
+    });
+
+    function fromCache(request) {
+        var url = new URL(request.url);
+        url.search = "";
+        url.hash = "";
+        return caches.keys().then(function(names) {
+            var saved = names.filter(function(name) { return name.indexOf(cachePrefix) === 0; });
+            var lookup = function(i, target) {
+                if (i >= saved.length) return Promise.resolve(undefined);
+                return caches.open(saved[i]).then(function(cache) {
+                    return cache.match(target);
+                }).then(function(resp) {
+                    return resp || lookup(i + 1, target);
+                });
+            };
+            return lookup(0, url.href).then(function(resp) {
+                // Index pages are saved under their directory
+                if (!resp && /\/index\.html$/.test(url.pathname)) {
+                    return lookup(0, url.href.slice(0, -"index.html".length));
+                }
+                return resp;
+            });
+        });
+    }
+
+    self.addEventListener("fetch", function(event) {
+        if (event.request.method !== "GET") return;
+        event.respondWith(fetch(event.request).catch(function(err) {
+            return fromCache(event.request).then(function(resp) {
+                if (resp) return resp;
+                throw err;
+            });
+        }));
+    });
+})();
@@ -6,9 +6,81 @@
 
     var basePath = window.BASE_PATH || "";
 
-    // Push document content down so it's not hidden behind the fixed top bar
-    var overlayHeight = overlay.offsetHeight;
-    document.body.style.marginTop = overlayHeight + "px";
+    // The overlay is injected at the end of the page. Move it to the start
+    // so keyboard and screen reader users reach it, and its skip link, first.
+    var diffIndicatorEl = document.getElementById("asiakirjat-diff-indicator");
+    document.body.insertBefore(overlay, document.body.firstChild);
+    if (diffIndicatorEl) overlay.parentNode.insertBefore(diffIndicatorEl, overlay.nextSibling);
+
+    // Skip link: move focus past the overlay to the page's main content
+    var skipLink = document.getElementById("asiakirjat-skip-link");
+    if (skipLink) {
+        skipLink.addEventListener("click", function(e) {
+            e.preventDefault();
+            var target = document.querySelector("main, [role='main'], article, h1");
+            if (!target) {
+                target = diffIndicatorEl ? diffIndicatorEl.nextElementSibling : overlay.nextElementSibling;
+            }
+            if (!target) return;
+            if (!target.hasAttribute("tabindex")) target.setAttribute("tabindex", "-1");
+            target.focus();
+        });
+    }
+
+    // An overlay in the reader's theme is light if the reader chose the
+    // light theme, or did not choose one and the browser prefers light.
+    if (overlay.classList.contains("ao-theme-auto")) {
+        var themeCookie = document.cookie.match(/(?:^|;\s*)asiakirjat_theme=(\w+)/);
+        var prefersLight = window.matchMedia ? window.matchMedia("(prefers-color-scheme: light)") : null;
+        var applyTheme = function() {
+            var light = themeCookie ? themeCookie[1] === "light" : !!(prefersLight && prefersLight.matches);
+            overlay.classList.toggle("ao-theme-light", light);
+        };
+        applyTheme();
+        if (prefersLight && !themeCookie && prefersLight.addEventListener) {
+            prefersLight.addEventListener("change", applyTheme);
+        }
+    }
+
+    // Keep document content clear of the fixed bar, at the top or the
+    // bottom of the page. A collapsed bar floats in a corner instead.
+    var atBottom = overlay.classList.contains("ao-bottom");
+    function reserveSpace(extra) {
+        var height = overlay.classList.contains("ao-collapsed") ? 0 : overlay.offsetHeight;
+        height += extra || 0;
+        if (atBottom) {
+            document.body.style.marginBottom = height + "px";
+        } else {
+            document.body.style.marginTop = height + "px";
+        }
+    }
+
+    // Readers collapse the bar for all documentation with a cookie; the
+    // project decides whether it starts collapsed for everyone else.
+    var collapseCookie = document.cookie.match(/(?:^|;\s*)asiakirjat_overlay=(\w+)/);
+    var collapseButton = document.getElementById("asiakirjat-collapse");
+    var expandButton = document.getElementById("asiakirjat-expand");
+    function setCollapsed(collapsed, remember) {
+        overlay.classList.toggle("ao-collapsed", collapsed);
+        if (collapseButton) collapseButton.setAttribute("aria-expanded", collapsed ? "false" : "true");
+        if (remember) {
+            document.cookie = "asiakirjat_overlay=" + (collapsed ? "collapsed" : "expanded") +
+                "; path=" + (basePath || "/") + "; max-age=31536000; SameSite=Lax";
+        }
+        reserveSpace();
+        window.dispatchEvent(new Event("resize"));
+    }
+    setCollapsed(collapseCookie ? collapseCookie[1] === "collapsed" : overlay.hasAttribute("data-collapsed"), false);
+    if (collapseButton && expandButton) {
+        collapseButton.addEventListener("click", function() {
+            setCollapsed(true, true);
+            expandButton.focus();
+        });
+        expandButton.addEventListener("click", function() {
+            setCollapsed(false, true);
+            collapseButton.focus();
+        });
+    }
 
     var versionSelect = document.getElementById("asiakirjat-version-select");
     if (!versionSelect) return;
@@ -16,9 +88,27 @@
     var slug = versionSelect.getAttribute("data-slug");
     var current = versionSelect.getAttribute("data-current");
 
-    // Fetch versions from API
-    fetch(basePath + "/api/project/" + encodeURIComponent(slug) + "/versions")
-        .then(function(resp) { return resp.json(); })
+    // The page being read, relative to the root of the version, so that
+    // switching versions keeps it where the other version has it
+    var versionPrefix = basePath + "/project/" + slug + "/" + current + "/";
+    var pagePath = "";
+    try {
+        var decodedPath = decodeURIComponent(window.location.pathname);
+        if (decodedPath.indexOf(versionPrefix) === 0) {
+            pagePath = decodedPath.substring(versionPrefix.length);
+        }
+    } catch (e) {
+        pagePath = "";
+    }
+
+    // Versions the user can access, shared by the version and compare selects
+    var versionsPromise = fetch(basePath + "/project/" + encodeURIComponent(slug) + "/versions.json?path=" + encodeURIComponent(pagePath))
+        .then(function(resp) {
+            if (!resp.ok) throw new Error("HTTP " + resp.status);
+            return resp.json();
+        });
+
+    versionsPromise
         .then(function(versions) {
             // Clear and rebuild options
             versionSelect.innerHTML = "";
@@ -26,6 +116,10 @@
                 var opt = document.createElement("option");
                 opt.value = v.tag;
                 opt.textContent = v.tag;
+                opt.setAttribute("data-url", v.url);
+                if (v.has_page) {
+                    opt.setAttribute("data-has-page", "");
+                }
                 if (v.tag === current) {
                     opt.selected = true;
                 }
@@ -36,17 +130,20 @@
             console.error("Failed to load versions:", err);
         });
 
-    // Handle version switch
+    // Handle version switch: go to the same page in the other version, or
+    // to its root if it does not have the page
     versionSelect.addEventListener("change", function() {
         var newVersion = versionSelect.value;
         if (newVersion === current) return;
 
-        // Preserve the current path within the doc
-        var path = window.location.pathname;
-        var prefix = basePath + "/project/" + slug + "/" + current;
-        var suffix = path.substring(prefix.length);
-
-        window.location.href = basePath + "/project/" + slug + "/" + newVersion + suffix;
+        var opt = versionSelect.options[versionSelect.selectedIndex];
+        var url = opt && opt.getAttribute("data-url");
+        if (!url) {
+            url = basePath + "/project/" + slug + "/" + encodeURIComponent(newVersion) + "/";
+        } else if (opt.hasAttribute("data-has-page")) {
+            url += window.location.hash;
+        }
+        window.location.href = url;
     });
 
     // Update download link when version changes
@@ -72,8 +169,7 @@
 
     if (compareSelect) {
         // Populate compare dropdown with versions (excluding current)
-        fetch(basePath + "/api/project/" + encodeURIComponent(slug) + "/versions")
-            .then(function(resp) { return resp.json(); })
+        versionsPromise
             .then(function(versions) {
                 compareSelect.innerHTML = '<option value="">Select version...</option>';
                 versions.forEach(function(v) {
@@ -334,6 +430,7 @@
             var counter = document.getElementById("asiakirjat-diff-change-counter");
             if (counter) {
                 counter.textContent = (index + 1) + " / " + diffChanges.length;
+                counter.setAttribute("aria-label", "Change " + (index + 1) + " of " + diffChanges.length);
             }
         }
 
@@ -376,11 +473,15 @@
                     nav.style.display = (hasChanges && changeCount > 0) ? "" : "none";
                 }
 
-                // Position indicator below the main overlay
-                indicator.style.top = overlay.offsetHeight + "px";
+                // Position indicator next to the main overlay
+                if (atBottom) {
+                    indicator.style.bottom = overlay.offsetHeight + "px";
+                } else {
+                    indicator.style.top = overlay.offsetHeight + "px";
+                }
                 indicator.style.display = "flex";
                 // Update body margin to account for both bars
-                document.body.style.marginTop = (overlay.offsetHeight + indicator.offsetHeight) + "px";
+                reserveSpace(indicator.offsetHeight);
             }
             diffModeActive = true;
         }
@@ -396,7 +497,7 @@
                 indicator.style.display = "none";
             }
             // Reset body margin
-            document.body.style.marginTop = overlay.offsetHeight + "px";
+            reserveSpace();
             // Reset compare select
             var cmpSelect = document.getElementById("asiakirjat-compare-select");
             if (cmpSelect) {
@@ -407,6 +508,11 @@
             diffChanges = [];
             currentChangeIndex = -1;
 
+            // The exit button is gone, so keep focus in the overlay
+            if (indicator && indicator.contains(document.activeElement) && cmpSelect) {
+                cmpSelect.focus();
+            }
+
             // Remove ?compare= from URL
             var params = new URLSearchParams(window.location.search);
             if (params.has("compare")) {
@@ -420,7 +526,7 @@
         function showLoading() {
             var loadingDiv = document.createElement("div");
             loadingDiv.id = "asiakirjat-diff-loading-overlay";
-            loadingDiv.innerHTML = '<div class="ao-loading-spinner">Computing diff...</div>';
+            loadingDiv.innerHTML = '<div class="ao-loading-spinner" role="status">Computing diff...</div>';
             document.body.appendChild(loadingDiv);
         }
 
@@ -436,7 +542,7 @@
             if (indicator && fromVersion) {
                 fromVersion.innerHTML = '<span style="color: #dc2626;">' + message + '</span>';
                 indicator.style.display = "flex";
-                document.body.style.marginTop = (overlay.offsetHeight + indicator.offsetHeight) + "px";
+                reserveSpace(indicator.offsetHeight);
             }
             diffModeActive = true;
         }
@@ -648,20 +754,226 @@
         });
     }
 
+    // Report an issue: open the project's issue tracker or send the report
+    // to asiakirjat, with the current page and selected text as context
+    var feedbackButton = document.getElementById("asiakirjat-feedback");
+    if (feedbackButton) {
+        var feedbackSelection = "";
+
+        // Read the selection before the click moves focus away from it
+        feedbackButton.addEventListener("mousedown", function() {
+            feedbackSelection = String(window.getSelection() || "").trim();
+        });
+
+        if (feedbackButton.getAttribute("data-mode") === "issue_tracker") {
+            feedbackButton.addEventListener("click", function(e) {
+                e.preventDefault();
+                var values = {
+                    url: window.location.href,
+                    title: document.title,
+                    project: feedbackButton.getAttribute("data-slug"),
+                    version: feedbackButton.getAttribute("data-version"),
+                    selection: feedbackSelection || String(window.getSelection() || "").trim()
+                };
+                var target = feedbackButton.getAttribute("data-template").replace(/\{(url|title|project|version|selection)\}/g, function(m, key) {
+                    return encodeURIComponent(values[key]);
+                });
+                window.open(target, "_blank", "noopener");
+            });
+        } else {
+            var feedbackForm = document.getElementById("asiakirjat-feedback-form");
+            var feedbackMessage = document.getElementById("asiakirjat-feedback-message");
+            var feedbackQuote = document.getElementById("asiakirjat-feedback-selection");
+            var feedbackStatus = document.getElementById("asiakirjat-feedback-status");
+
+            var toggleFeedbackForm = function(show) {
+                feedbackForm.hidden = !show;
+                feedbackButton.setAttribute("aria-expanded", show ? "true" : "false");
+                reserveSpace();
+                if (show) {
+                    feedbackMessage.focus();
+                } else if (feedbackForm.contains(document.activeElement)) {
+                    feedbackButton.focus();
+                }
+            };
+
+            feedbackButton.addEventListener("click", function() {
+                if (!feedbackSelection) feedbackSelection = String(window.getSelection() || "").trim();
+                feedbackQuote.textContent = feedbackSelection;
+                feedbackQuote.hidden = !feedbackSelection;
+                feedbackStatus.textContent = "";
+                toggleFeedbackForm(feedbackForm.hidden);
+            });
+
+            document.getElementById("asiakirjat-feedback-cancel").addEventListener("click", function() {
+                toggleFeedbackForm(false);
+            });
+
+            feedbackForm.addEventListener("keydown", function(e) {
+                if (e.key === "Escape") {
+                    e.stopPropagation();
+                    toggleFeedbackForm(false);
+                }
+            });
+
+            feedbackForm.addEventListener("submit", function(e) {
+                e.preventDefault();
+                feedbackStatus.textContent = "Sending...";
+                fetch(basePath + "/project/" + encodeURIComponent(feedbackButton.getAttribute("data-slug")) + "/feedback", {
+                    method: "POST",
+                    headers: { "Content-Type": "application/json" },
+                    credentials: "same-origin",
+                    body: JSON.stringify({
+                        version: feedbackButton.getAttribute("data-version"),
+                        page_url: window.location.pathname + window.location.hash,
+                        selection: feedbackSelection,
+                        message: feedbackMessage.value
+                    })
+                })
+                    .then(function(resp) {
+                        if (!resp.ok) {
+                            return resp.json().catch(function() { return {}; }).then(function(data) { throw new Error(data.error || resp.statusText); });
+                        }
+                        feedbackMessage.value = "";
+                        feedbackSelection = "";
+                        feedbackQuote.hidden = true;
+                        feedbackStatus.textContent = "Thank you for your feedback!";
+                    })
+                    .catch(function(err) {
+                        feedbackStatus.textContent = "Could not send feedback: " + err.message;
+                    });
+            });
+        }
+    }
+
+    // Save offline: store every file of the version in the browser cache.
+    // The service worker answers from there when the network is down.
+    // Saved copies are refreshed when the version was re-uploaded.
+    var offlineButton = document.getElementById("asiakirjat-offline");
+    if (offlineButton && "serviceWorker" in navigator && window.caches) {
+        var offlineSlug = offlineButton.getAttribute("data-slug");
+        var offlineVersion = offlineButton.getAttribute("data-version");
+        var offlineCache = "asiakirjat-offline:" + offlineSlug + ":" + offlineVersion;
+        var manifestURL = basePath + "/project/" + encodeURIComponent(offlineSlug) +
+            "/version/" + encodeURIComponent(offlineVersion) + "/offline.json";
+        var offlineBusy = false;
+
+        var setOfflineState = function(saved, text, title) {
+            offlineButton.classList.toggle("ao-offline-saved", saved);
+            offlineButton.textContent = text;
+            offlineButton.title = title || "";
+        };
+
+        var fetchManifest = function() {
+            return fetch(manifestURL, { credentials: "same-origin", cache: "no-store" }).then(function(resp) {
+                if (!resp.ok) {
+                    return resp.json().catch(function() { return {}; }).then(function(data) { throw new Error(data.error || resp.statusText); });
+                }
+                return resp.json();
+            });
+        };
+
+        var saveOffline = function(manifest) {
+            offlineBusy = true;
+            return caches.delete(offlineCache)
+                .then(function() { return caches.open(offlineCache); })
+                .then(function(cache) {
+                    var files = manifest.files.slice();
+                    var total = files.length;
+                    var next = function() {
+                        var batch = files.splice(0, 6);
+                        if (batch.length === 0) {
+                            // The manifest is stored last and marks a complete copy
+                            return cache.put(manifestURL, new Response(JSON.stringify(manifest), {
+                                headers: { "Content-Type": "application/json" }
+                            }));
+                        }
+                        return cache.addAll(batch).then(function() {
+                            setOfflineState(false, "Saving " + Math.round((total - files.length) * 100 / total) + "%");
+                            return next();
+                        });
+                    };
+                    return next();
+                })
+                .then(function() {
+                    setOfflineState(true, "Saved offline", "Click to remove the offline copy");
+                })
+                .catch(function(err) {
+                    caches.delete(offlineCache);
+                    setOfflineState(false, "Save offline", "Could not save: " + err.message);
+                })
+                .then(function() { offlineBusy = false; });
+        };
+
+        navigator.serviceWorker.register(basePath + "/offline-sw.js", { scope: basePath + "/project/" })
+            .then(function() {
+                offlineButton.hidden = false;
+                reserveSpace();
+                return caches.open(offlineCache).then(function(cache) { return cache.match(manifestURL); });
+            })
+            .then(function(saved) {
+                if (!saved) {
+                    setOfflineState(false, "Save offline", "Make this version available without a network connection");
+                    return;
+                }
+                return saved.json().then(function(savedManifest) {
+                    setOfflineState(true, "Saved offline", "Click to remove the offline copy");
+                    if (!navigator.onLine) return;
+                    return fetchManifest().then(function(manifest) {
+                        if (manifest.revision !== savedManifest.revision) {
+                            setOfflineState(false, "Updating...");
+                            return saveOffline(manifest);
+                        }
+                    }, function() {});
+                });
+            })
+            .catch(function() {});
+
+        offlineButton.addEventListener("click", function() {
+            if (offlineBusy) return;
+            if (offlineButton.classList.contains("ao-offline-saved")) {
+                caches.delete(offlineCache).then(function() {
+                    setOfflineState(false, "Save offline", "Make this version available without a network connection");
+                });
+                return;
+            }
+            offlineBusy = true;
+            setOfflineState(false, "Saving...");
+            fetchManifest().then(saveOffline, function(err) {
+                offlineBusy = false;
+                setOfflineState(false, "Save offline", "Could not save: " + err.message);
+            });
+        });
+    }
+
     // Overlay in-doc search
     var searchInput = document.getElementById("asiakirjat-overlay-search");
     var searchDropdown = document.getElementById("asiakirjat-overlay-search-dropdown");
 
+    var searchStatus = document.getElementById("asiakirjat-overlay-search-status");
+
     if (searchInput && searchDropdown) {
         var searchTimer = null;
         var searchSlug = searchInput.getAttribute("data-slug");
         var searchVersion = searchInput.getAttribute("data-version");
 
+        // The input is a combobox: keep its state in sync for screen readers
+        function showSearchDropdown(show) {
+            searchDropdown.style.display = show ? "block" : "none";
+            searchInput.setAttribute("aria-expanded", show ? "true" : "false");
+            if (!show) searchInput.removeAttribute("aria-activedescendant");
+        }
+
+        function announceSearch(text) {
+            if (searchStatus) searchStatus.textContent = text;
+        }
+
         function overlaySearch() {
             var q = searchInput.value.trim();
             if (q.length < 2) {
-                searchDropdown.style.display = "none";
+                showSearchDropdown(false);
                 searchDropdown.innerHTML = "";
+                announceSearch("");
                 return;
             }
 
@@ -680,12 +992,17 @@
                         empty.className = "ao-search-empty";
                         empty.textContent = "No results found";
                         searchDropdown.appendChild(empty);
-                        searchDropdown.style.display = "block";
+                        showSearchDropdown(true);
+                        announceSearch("No results found");
                         return;
                     }
 
-                    data.results.forEach(function(r) {
+                    data.results.forEach(function(r, i) {
                         var item = document.createElement("a");
+                        item.id = "asiakirjat-search-option-" + i;
+                        item.setAttribute("role", "option");
+                        item.setAttribute("aria-selected", "false");
+                        item.tabIndex = -1;
                         if (r.page_number > 0) {
                             item.href = r.url + "?search=" + encodeURIComponent(q) + "#page=" + r.page_number;
                         } else {
@@ -716,15 +1033,21 @@
                         var viewAll = document.createElement("a");
                         viewAll.className = "ao-search-view-all";
                         viewAll.href = basePath + "/search?q=" + encodeURIComponent(q) +
-                            "&project=" + encodeURIComponent(searchSlug);
+                            "&project=" + encodeURIComponent(searchSlug) +
+                            "&version=" + encodeURIComponent(searchVersion);
+                        viewAll.id = "asiakirjat-search-option-all";
+                        viewAll.setAttribute("role", "option");
+                        viewAll.setAttribute("aria-selected", "false");
+                        viewAll.tabIndex = -1;
                         viewAll.textContent = "View all " + data.total + " results";
                         searchDropdown.appendChild(viewAll);
                     }
 
-                    searchDropdown.style.display = "block";
+                    showSearchDropdown(true);
+                    announceSearch(data.total + " result" + (data.total !== 1 ? "s" : "") + ", use the arrow keys to choose");
                 })
                 .catch(function() {
-                    searchDropdown.style.display = "none";
+                    showSearchDropdown(false);
                 });
         }
 
@@ -743,9 +1066,13 @@
                 } else {
                     item.classList.remove("ao-search-item-selected");
                 }
+                item.setAttribute("aria-selected", i === overlaySelectedIndex ? "true" : "false");
             });
             if (overlaySelectedIndex >= 0 && items[overlaySelectedIndex]) {
                 items[overlaySelectedIndex].scrollIntoView({ block: "nearest" });
+                searchInput.setAttribute("aria-activedescendant", items[overlaySelectedIndex].id);
+            } else {
+                searchInput.removeAttribute("aria-activedescendant");
             }
         }
 
@@ -760,7 +1087,13 @@
             var visible = searchDropdown.style.display === "block";
 
             if (e.key === "Escape") {
-                searchDropdown.style.display = "none";
+                // Stop diff mode from exiting while the search is in use
+                e.stopPropagation();
+                if (!visible) {
+                    searchInput.value = "";
+                    announceSearch("");
+                }
+                showSearchDropdown(false);
                 overlaySelectedIndex = -1;
                 return;
             }
@@ -785,10 +1118,19 @@
 
         document.addEventListener("click", function(e) {
             if (!searchInput.contains(e.target) && !searchDropdown.contains(e.target)) {
-                searchDropdown.style.display = "none";
+                showSearchDropdown(false);
                 overlaySelectedIndex = -1;
             }
         });
+
+        // "/" focuses the search, as on many documentation sites
+        document.addEventListener("keydown", function(e) {
+            if (e.key !== "/" || e.ctrlKey || e.metaKey || e.altKey) return;
+            var el = document.activeElement;
+            if (el && (el.tagName === "INPUT" || el.tagName === "TEXTAREA" || el.tagName === "SELECT" || el.isContentEditable)) return;
+            e.preventDefault();
+            searchInput.focus();
+        });
     }
 
     // Highlight search terms from URL parameter
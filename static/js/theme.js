@@ -0,0 +1,51 @@
+// Applies the theme the reader chose before the page is painted, and
+// switches between the system, light and dark themes with the theme
+// button in the navbar.
+(function() {
+    "use strict";
+
+    var root = document.documentElement;
+
+    // The server sets the theme of logged-in users; everyone else keeps
+    // theirs in a cookie. No theme follows the color scheme of the system.
+    if (!root.hasAttribute("data-theme")) {
+        var cookie = document.cookie.match(/(?:^|;\s*)asiakirjat_theme=(light|dark)/);
+        root.setAttribute("data-theme", cookie ? cookie[1] : "");
+    }
+
+    var labels = { "": "System theme", light: "Light theme", dark: "Dark theme" };
+    var next = { "": "light", light: "dark", dark: "" };
+
+    document.addEventListener("DOMContentLoaded", function() {
+        var button = document.getElementById("theme-toggle");
+        if (!button) return;
+
+        function update() {
+            var theme = root.getAttribute("data-theme") || "";
+            button.textContent = labels[theme];
+            button.title = "Switch to the " + labels[next[theme]].toLowerCase();
+        }
+        update();
+
+        button.addEventListener("click", function() {
+            var theme = next[root.getAttribute("data-theme") || ""];
+            root.setAttribute("data-theme", theme);
+            update();
+
+            var basePath = window.BASE_PATH || "";
+            document.cookie = "asiakirjat_theme=" + theme + "; path=" + (basePath || "/") +
+                "; max-age=" + (theme ? 31536000 : 0) + "; SameSite=Lax";
+
+            // Logged-in users keep their theme on every device
+            var saveURL = button.getAttribute("data-save-url");
+            if (saveURL) {
+                var body = new URLSearchParams();
+                body.set("theme", theme);
+                fetch(saveURL, { method: "POST", body: body, credentials: "same-origin", redirect: "manual" })
+                    .catch(function(err) {
+                        console.error("Failed to save theme:", err);
+                    });
+            }
+        });
+    });
+})();